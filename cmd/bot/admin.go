@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"parent-bot/internal/models"
+	"parent-bot/internal/validator"
+)
+
+const adminUsage = "bot admin add <phone> [--name NAME] [--role ROLE] | remove <phone> | list"
+
+// runAdminCommand handles `bot admin add|remove|list`. Changes go through
+// the role service, so the same rules apply as in the bot: ADMIN_PHONES are
+// managed in the config and the last super-admin stays.
+func runAdminCommand(args []string) error {
+	if len(args) == 0 {
+		usage(adminUsage)
+	}
+
+	ctx := cliContext()
+
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("admin add", flag.ExitOnError)
+		name := fs.String("name", "Admin", "admin's name")
+		role := fs.String("role", models.RoleAdmin, "staff role")
+		rest := parseFlags(fs, args[1:])
+		if len(rest) != 1 {
+			usage(adminUsage)
+		}
+		if !slices.Contains(models.StaffRoles, *role) {
+			return fmt.Errorf("unknown role %q; one of %v", *role, models.StaffRoles)
+		}
+		phone, err := normalizePhone(rest[0])
+		if err != nil {
+			return err
+		}
+
+		s, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer s.close()
+
+		existing, err := s.admins.GetByPhoneNumber(ctx, phone)
+		if err != nil {
+			return fmt.Errorf("failed to check admin: %w", err)
+		}
+		if existing != nil && existing.Role == *role {
+			return fmt.Errorf("%s is already %s", phone, *role)
+		}
+
+		if err := s.roles.AssignRole(ctx, phone, *role, *name); err != nil {
+			return fmt.Errorf("failed to add admin: %w", err)
+		}
+
+		admin, err := s.admins.GetByPhoneNumber(ctx, phone)
+		if err != nil {
+			return fmt.Errorf("failed to get admin: %w", err)
+		}
+
+		if existing != nil {
+			fmt.Printf("✓ Changed %s from %s to %s\n", phone, existing.Role, admin.Role)
+			return nil
+		}
+		fmt.Printf("✓ Added %s %s (id %d)\n", admin.Role, admin.PhoneNumber, admin.ID)
+		fmt.Println("  They get the admin menu after sharing this phone number with the bot")
+
+	case "remove":
+		if len(args) != 2 {
+			usage(adminUsage)
+		}
+		phone, err := normalizePhone(args[1])
+		if err != nil {
+			return err
+		}
+
+		s, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer s.close()
+
+		if err := s.roles.RevokeStaff(ctx, phone); err != nil {
+			return fmt.Errorf("failed to remove admin: %w", err)
+		}
+
+		fmt.Printf("✓ Removed admin %s\n", phone)
+
+	case "list":
+		s, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer s.close()
+
+		admins, err := s.admins.GetAll(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get admins: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPHONE\tNAME\tROLE\tTELEGRAM ID\tSOURCE\tADDED AT")
+		for _, admin := range admins {
+			telegramID := "-"
+			if admin.TelegramID != nil {
+				telegramID = strconv.FormatInt(*admin.TelegramID, 10)
+			}
+			source := "database"
+			if slices.Contains(s.cfg.Admin.PhoneNumbers, admin.PhoneNumber) {
+				source = "config"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", admin.ID, admin.PhoneNumber, admin.Name, admin.Role,
+				telegramID, source, admin.AddedAt.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+
+	default:
+		fmt.Printf("Unknown admin command: %s\n", args[0])
+		usage(adminUsage)
+	}
+
+	return nil
+}
+
+// normalizePhone validates a phone number given on the command line
+func normalizePhone(phone string) (string, error) {
+	normalized, err := validator.ValidateUzbekPhone(phone)
+	if err != nil {
+		return "", fmt.Errorf("invalid phone number %s: %w", phone, err)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"parent-bot/internal/models"
+)
+
+const auditUsage = "bot audit export [--entity <type>] [--id <id>] [--action <action>] [--days <n>] > audit.csv"
+
+// runAuditCommand handles `bot audit export`, writing audit log entries as
+// CSV to stdout, newest first
+func runAuditCommand(args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		usage(auditUsage)
+	}
+
+	fs := flag.NewFlagSet("audit export", flag.ExitOnError)
+	entityType := fs.String("entity", "", "only changes to this entity type")
+	entityID := fs.String("id", "", "only changes to this entity (needs --entity)")
+	action := fs.String("action", "", `only this action, e.g. "test_result.update"`)
+	days := fs.Int("days", 0, "only changes in the last n days (0 for all)")
+	if rest := parseFlags(fs, args[1:]); len(rest) != 0 {
+		usage(auditUsage)
+	}
+
+	if *entityType != "" && !slices.Contains(models.AuditEntityTypes, *entityType) {
+		return fmt.Errorf("unknown entity type %q; one of %v", *entityType, models.AuditEntityTypes)
+	}
+	if *entityID != "" && *entityType == "" {
+		usage(auditUsage)
+	}
+
+	ctx := cliContext()
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	loc, err := time.LoadLocation(s.cfg.School.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid school timezone: %w", err)
+	}
+
+	filter := &models.AuditFilter{EntityType: *entityType, EntityID: *entityID, Action: *action}
+	if *days > 0 {
+		since := time.Now().AddDate(0, 0, -*days)
+		filter.Since = &since
+	}
+
+	total, err := s.audit.Count(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	written, err := s.audit.ExportCSV(ctx, filter, loc, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("failed to export audit log: %w", err)
+	}
+
+	// To stderr, so the CSV can be redirected to a file
+	fmt.Fprintf(os.Stderr, "✓ Exported %d of %d entries\n", written, total)
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"parent-bot/internal/config"
+	"parent-bot/internal/database"
+)
+
+// runBackupCommand handles `bot backup [file]`. The bot may keep running.
+func runBackupCommand(args []string) error {
+	if len(args) > 1 {
+		fmt.Println("Usage: bot backup [file]")
+		os.Exit(2)
+	}
+
+	cfg, err := loadSQLiteConfig("backup")
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(cfg.Backup.Dir, "parent_bot-"+time.Now().Format("20060102-150405")+".db")
+	if len(args) == 1 {
+		dest = args[0]
+	} else if err := os.MkdirAll(cfg.Backup.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	if err := database.Backup(context.Background(), cfg.Database.GetDBPath(), dest); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	if err := database.IntegrityCheck(dest); err != nil {
+		return fmt.Errorf("backup failed verification: %w", err)
+	}
+
+	fmt.Printf("✓ Backed up %s to %s\n", cfg.Database.GetDBPath(), dest)
+
+	return nil
+}
+
+// runRestoreCommand handles `bot restore <file>`. Stop the bot first.
+func runRestoreCommand(args []string) error {
+	if len(args) != 1 {
+		fmt.Println("Usage: bot restore <file>")
+		os.Exit(2)
+	}
+
+	cfg, err := loadSQLiteConfig("restore")
+	if err != nil {
+		return err
+	}
+
+	safetyCopy, err := database.Restore(context.Background(), args[0], cfg.Database.GetDBPath())
+	if safetyCopy != "" {
+		fmt.Printf("✓ Previous database saved to %s\n", safetyCopy)
+	}
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	fmt.Printf("✓ Restored %s from %s\n", cfg.Database.GetDBPath(), args[0])
+	fmt.Println("  Start the bot to apply any newer migrations")
+
+	return nil
+}
+
+// loadSQLiteConfig loads the config for a command that only works on SQLite
+func loadSQLiteConfig(command string) (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Database.Driver != config.DriverSQLite {
+		return nil, fmt.Errorf("bot %s works with SQLite only; use pg_dump and pg_restore for PostgreSQL", command)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+
+	"parent-bot/internal/authz"
+	"parent-bot/internal/config"
+	"parent-bot/internal/database"
+	"parent-bot/internal/logging"
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+	"parent-bot/internal/services"
+	"parent-bot/internal/state"
+)
+
+// store is what the data subcommands work with: the configured database and
+// the services on top of it. It needs no Telegram connection, so support
+// staff can fix data over SSH while the bot keeps running.
+type store struct {
+	cfg           *config.Config
+	db            *sql.DB
+	admins        *repository.AdminRepository
+	classes       *repository.ClassRepository
+	notifications *repository.NotificationRepository
+	audit         *services.AuditService
+	roles         *services.RoleService
+	users         *services.UserService
+	classService  *services.ClassService
+	teachers      *services.TeacherService
+	students      *services.StudentService
+	complaints    *services.ComplaintService
+	proposals     *services.ProposalService
+	states        *state.Manager
+}
+
+// openStore loads the config and connects to its database. The schema must
+// be up to date, as the subcommands are built for the current one.
+func openStore() (*store, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	logger, err := logging.New(&cfg.Log, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create logger: %w", err)
+	}
+
+	if err := database.Connect(&cfg.Database); err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	db := database.DB
+
+	if err := checkSchema(db); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	classRepo := repository.NewClassRepository(db)
+	adminRepo := repository.NewAdminRepository(db)
+	audit := services.NewAuditService(repository.NewAuditRepository(db), logger)
+	teachers := services.NewTeacherService(db, audit)
+
+	return &store{
+		cfg:           cfg,
+		db:            db,
+		admins:        adminRepo,
+		classes:       classRepo,
+		notifications: repository.NewNotificationRepository(db),
+		audit:         audit,
+		roles: services.NewRoleService(repository.NewRoleRepository(db), adminRepo, teachers, func() []string {
+			return cfg.Admin.PhoneNumbers
+		}, audit),
+		users:        services.NewUserService(userRepo, audit),
+		classService: services.NewClassService(classRepo, audit),
+		teachers:     teachers,
+		students:     services.NewStudentService(db, audit),
+		complaints:   services.NewComplaintService(repository.NewComplaintRepository(db), userRepo, audit),
+		proposals:    services.NewProposalService(repository.NewProposalRepository(db), userRepo, audit),
+		states:       state.NewManager(db, cfg.Updates, logger),
+	}, nil
+}
+
+// checkSchema fails unless every migration is applied
+func checkSchema(db *sql.DB) error {
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+	statuses, err := migrator.Status()
+	if err != nil {
+		return fmt.Errorf("failed to get migration status: %w", err)
+	}
+	for _, st := range statuses {
+		if !st.Applied {
+			return fmt.Errorf("database schema is not up to date; run `bot migrate up` first")
+		}
+	}
+	return nil
+}
+
+// cliContext returns the context subcommands make changes with. They are
+// recorded in the audit log as made by the operating system user, who acts
+// with a super-admin's rights: whoever can run the CLI can change the
+// database anyway.
+func cliContext() context.Context {
+	name := os.Getenv("SUDO_USER")
+	if name == "" {
+		if current, err := user.Current(); err == nil {
+			name = current.Username
+		}
+	}
+
+	ctx := services.WithActor(context.Background(), services.Actor{
+		Name:   name,
+		Role:   "support",
+		Source: models.AuditSourceCLI,
+	})
+	return authz.WithCaller(ctx, &authz.Caller{
+		Admin:       &models.Admin{Name: name, Role: models.RoleSuperAdmin},
+		IsAdmin:     true,
+		Permissions: models.AllPermissions(),
+	})
+}
+
+// close closes the database connection
+func (s *store) close() {
+	database.Close()
+}
+
+// actingAdmin returns the admin that records created from the command line
+// are attributed to: the one with the given phone, or the first admin
+func (s *store) actingAdmin(ctx context.Context, phone string) (*models.Admin, error) {
+	if phone != "" {
+		normalized, err := normalizePhone(phone)
+		if err != nil {
+			return nil, err
+		}
+		admin, err := s.admins.GetByPhoneNumber(ctx, normalized)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get admin: %w", err)
+		}
+		if admin == nil {
+			return nil, fmt.Errorf("no admin with phone %s", phone)
+		}
+		return admin, nil
+	}
+
+	admins, err := s.admins.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admins: %w", err)
+	}
+	if len(admins) == 0 {
+		return nil, fmt.Errorf("there are no admins yet; add one with `bot admin add <phone>`")
+	}
+
+	return admins[0], nil
+}
+
+// classByName looks up an existing class by name
+func (s *store) classByName(ctx context.Context, name string) (*models.Class, error) {
+	class, err := s.classes.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if class == nil {
+		return nil, fmt.Errorf("class %s %w", name, services.ErrNotFound)
+	}
+	return class, nil
+}
+
+// parseFlags parses args with fs, allowing flags after positional
+// arguments, and returns the positional ones. Invalid flags exit with usage.
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args) // fs exits on error
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// usage prints how to run a subcommand and exits
+func usage(text string) {
+	fmt.Println("Usage: " + text)
+	os.Exit(2)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"parent-bot/internal/config"
+)
+
+// runConfigCommand handles `bot config check [file]`
+func runConfigCommand(args []string) error {
+	if len(args) == 0 || args[0] != "check" || len(args) > 2 {
+		fmt.Println("Usage: bot config check [file]")
+		os.Exit(2)
+	}
+
+	// Same layering as the bot: file, then .env, then the environment
+	_ = godotenv.Load(".env")
+
+	path := config.FilePath()
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		return err
+	}
+
+	source := "environment only"
+	if cfg.File != "" {
+		source = cfg.File + " + environment"
+	}
+
+	fmt.Printf("✓ Configuration is valid (%s)\n", source)
+	fmt.Printf("  admins:        %s (max %d)\n", strings.Join(cfg.Admin.PhoneNumbers, ", "), cfg.Admin.MaxAdmins)
+	fmt.Printf("  database:      %s\n", cfg.Database.String())
+	fmt.Printf("  timezone:      %s\n", cfg.School.Timezone)
+	fmt.Printf("  rate limit:    %d (teachers %d) per %s, admins exempt: %t\n",
+		cfg.RateLimit.Requests, cfg.RateLimit.TeacherRequests, cfg.RateLimit.Duration, cfg.RateLimit.ExemptAdmins)
+	fmt.Printf("  notifications: admin attendance %t, parent absence %t, parent grades %t\n",
+		cfg.Notifications.AdminAttendanceReports, cfg.Notifications.ParentAbsenceAlerts, cfg.Notifications.ParentGradeAlerts)
+	fmt.Printf("  outbox:        %d attempts, retry after %s up to %s, kept %s\n",
+		cfg.Outbox.MaxAttempts, cfg.Outbox.RetryBackoff, cfg.Outbox.MaxBackoff, cfg.Outbox.Retention)
+	fmt.Printf("  sending:       %d messages/s, %s between messages to one chat\n", cfg.Outbox.Rate, cfg.Outbox.ChatInterval)
+	if cfg.Backup.Schedule != "" {
+		fmt.Printf("  backups:       %q to %s, kept %s, sent to admins: %t\n",
+			cfg.Backup.Schedule, cfg.Backup.Dir, cfg.Backup.Retention, cfg.Backup.SendToAdmins)
+	} else {
+		fmt.Println("  backups:       not scheduled")
+	}
+
+	return nil
+}
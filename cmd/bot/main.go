@@ -1,27 +1,81 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/gin-gonic/gin"
 
+	"parent-bot/internal/api"
 	"parent-bot/internal/config"
 	"parent-bot/internal/database"
+	"parent-bot/internal/dispatcher"
 	"parent-bot/internal/handlers"
+	"parent-bot/internal/logging"
+	"parent-bot/internal/metrics"
 	"parent-bot/internal/services"
 )
 
+// subcommands run instead of the bot when named as the first argument. They
+// return their error rather than exiting, so their deferred cleanup runs.
+var subcommands = map[string]func(args []string) error{
+	"migrate": runMigrateCommand,
+	"config":  runConfigCommand,
+	"backup":  runBackupCommand,
+	"restore": runRestoreCommand,
+
+	// Data fixes for support staff; see cli.go
+	"admin":   runAdminCommand,
+	"teacher": runTeacherCommand,
+	"class":   runClassCommand,
+	"student": runStudentCommand,
+	"parent":  runParentCommand,
+	"state":   runStateCommand,
+	"stats":   runStatsCommand,
+	"audit":   runAuditCommand,
+}
+
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Structured logger; plain log.Printf output is routed through it at info level
+	logger, err := logging.New(&cfg.Log, os.Stderr)
+	if err != nil {
+		log.Fatalf("Failed to create logger: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	if cfg.File != "" {
+		log.Printf("✓ Loaded config file %s", cfg.File)
+	}
+
 	// Connect to database
 	err = database.Connect(&cfg.Database)
 	if err != nil {
@@ -29,75 +83,156 @@ func main() {
 	}
 	defer database.Close()
 
-	log.Println("✓ Connected to database")
+	log.Printf("✓ Connected to database (%s)", cfg.Database.String())
 
 	// Create temp_docs directory for document generation
-	if err := os.MkdirAll("./temp_docs", 0755); err != nil {
-		log.Fatalf("Failed to create temp_docs directory: %v", err)
+	if err := os.MkdirAll(cfg.Documents.TempDir, 0755); err != nil {
+		log.Fatalf("Failed to create %s directory: %v", cfg.Documents.TempDir, err)
 	}
 	log.Println("✓ Temporary documents directory created")
 
-	// Run migrations (SQLite version)
-	// Only run migrations if database is new (check if admins table exists)
-	var tableExists bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type='table' AND name='admins')").Scan(&tableExists)
+	// Apply pending schema migrations
+	applied, err := database.RunMigrations()
 	if err != nil {
-		log.Fatalf("Failed to check if tables exist: %v", err)
+		log.Fatalf("Failed to run migrations: %v", err)
 	}
-
-	if !tableExists {
-		log.Println("⚠️  Database tables not found. Running initial migration...")
-		migrationFiles := []string{
-			"internal/database/migrations/006_complete_schema.sql",
-		}
-
-		for _, migrationPath := range migrationFiles {
-			if _, err := os.Stat(migrationPath); err == nil {
-				err = database.RunMigrations(migrationPath)
-				if err != nil {
-					log.Fatalf("Migration %s failed: %v", migrationPath, err)
-				} else {
-					log.Printf("✓ Migration %s completed", migrationPath)
-				}
-			}
-		}
-		log.Println("✓ All database migrations completed")
-	} else {
-		log.Println("✓ Database tables already exist, skipping migrations")
+	for _, m := range applied {
+		log.Printf("✓ Migration %03d_%s applied", m.Version, m.Name)
 	}
+	log.Println("✓ Database schema is up to date")
 
 	// Initialize bot service
-	botService, err := services.NewBotService(cfg, database.DB)
+	botService, err := services.NewBotService(cfg, database.DB, logger)
 	if err != nil {
 		log.Fatalf("Failed to create bot service: %v", err)
 	}
 
-	log.Printf("✓ Bot authorized: @%s", botService.Bot.Self.UserName)
+	log.Printf("✓ Bot authorized: @%s", botService.Self.UserName)
+
+	// Register inline button routes
+	handlers.RegisterCallbackRoutes(botService)
+
+	// Resume announcements a previous run stopped sending
+	handlers.RegisterAnnouncementResume(botService)
+
+	metrics.RegisterGauge("state_cache_entries", "Conversation states held in the StateManager cache.", func() float64 {
+		return float64(botService.StateManager.CacheStats().Size)
+	})
+	metrics.RegisterCounter("state_cache_hits_total", "Conversation state reads served from the cache.", func() float64 {
+		return float64(botService.StateManager.CacheStats().Hits)
+	})
+	metrics.RegisterCounter("state_cache_misses_total", "Conversation state reads that went to the database.", func() float64 {
+		return float64(botService.StateManager.CacheStats().Misses)
+	})
+	metrics.RegisterCounter("state_cache_evictions_total", "Conversation states dropped from the full cache.", func() float64 {
+		return float64(botService.StateManager.CacheStats().Evictions)
+	})
+	metrics.RegisterCounter("callbacks_dispatched_total", "Callback queries passed to their route's handler.", func() float64 {
+		return float64(botService.CallbackRouter.Stats().Dispatched)
+	})
+	metrics.RegisterCounter("callbacks_failed_total", "Callback queries whose rule check or handler returned an error.", func() float64 {
+		return float64(botService.CallbackRouter.Stats().Failed)
+	})
+	metrics.RegisterCounter("callbacks_unknown_total", "Callback queries matching no route.", func() float64 {
+		return float64(botService.CallbackRouter.Stats().Unknown)
+	})
+	metrics.RegisterCounter("callbacks_malformed_total", "Callback queries whose parameters failed to parse.", func() float64 {
+		return float64(botService.CallbackRouter.Stats().Malformed)
+	})
+	metrics.RegisterCounter("callbacks_denied_total", "Callback queries refused by their route's rule.", func() float64 {
+		return float64(botService.CallbackRouter.Stats().Denied)
+	})
+
+	// Register background jobs
+	if err := botService.RegisterJobs(); err != nil {
+		log.Fatalf("Failed to register jobs: %v", err)
+	}
+
+	// Stop gracefully on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Initialize admins
-	err = botService.InitializeAdmins()
+	err = botService.InitializeAdmins(ctx)
 	if err != nil {
 		log.Printf("Warning: Failed to initialize admins: %v", err)
 	} else {
 		log.Println("✓ Admins initialized")
 	}
 
+	// Announcement broadcasts are started by handlers, so accept them first
+	if err := botService.Broadcaster.Start(ctx); err != nil {
+		log.Fatalf("Failed to start broadcaster: %v", err)
+	}
+
+	// Start update workers
+	updateDispatcher := dispatcher.New(func(ctx context.Context, update tgbotapi.Update) {
+		handlers.HandleUpdate(ctx, botService, update)
+	}, cfg.Updates.Workers, cfg.Updates.QueueSize)
+	updateDispatcher.Start()
+	log.Printf("✓ Started %d update workers", cfg.Updates.Workers)
+
+	// Start background jobs, catching up runs missed while the bot was down
+	if err := botService.Scheduler.Start(ctx); err != nil {
+		log.Fatalf("Failed to start scheduler: %v", err)
+	}
+	log.Printf("✓ Scheduler started (%s)", botService.Scheduler.Location())
+
+	// Deliver queued notifications, including any left from the last run
+	if err := botService.Outbox.Start(ctx); err != nil {
+		log.Fatalf("Failed to start notification outbox: %v", err)
+	}
+	log.Println("✓ Notification outbox started")
+
+	// Reload rate limits, admin phones and notification settings on SIGHUP
+	go watchReload(ctx, botService)
+
+	// Metrics on their own listener, meant to be reachable only privately;
+	// webhook mode also serves them as /api/admin/metrics
+	if cfg.Metrics.Addr != "" {
+		go serveMetrics(ctx, cfg.Metrics.Addr)
+	}
+
 	// Determine mode: webhook or polling
 	useWebhook := cfg.Bot.WebhookURL != ""
 
 	if useWebhook {
 		// WEBHOOK MODE (Production)
 		log.Println("🌐 Starting in WEBHOOK mode")
-		startWebhookMode(cfg, botService)
+		startWebhookMode(ctx, cfg, botService, updateDispatcher)
 	} else {
 		// POLLING MODE (Development/Testing)
 		log.Println("🔄 Starting in POLLING mode (for local testing)")
-		startPollingMode(botService)
+		startPollingMode(ctx, botService, updateDispatcher)
+	}
+
+	// Drain in-flight updates before the database is closed
+	log.Println("⏳ Waiting for in-flight updates to finish...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Updates.ShutdownTimeout)
+	defer cancel()
+
+	if err := updateDispatcher.Stop(shutdownCtx); err != nil {
+		log.Printf("Warning: %v", err)
+	} else {
+		log.Println("✓ All updates processed, shutting down")
+	}
+
+	if err := botService.Scheduler.Stop(shutdownCtx); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	if err := botService.Broadcaster.Stop(shutdownCtx); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	if err := botService.Outbox.Stop(shutdownCtx); err != nil {
+		log.Printf("Warning: %v", err)
 	}
 }
 
-// startWebhookMode starts the bot with webhook (for production)
-func startWebhookMode(cfg *config.Config, botService *services.BotService) {
+// startWebhookMode starts the bot with webhook (for production).
+// It returns once ctx is cancelled and the HTTP server has shut down.
+func startWebhookMode(ctx context.Context, cfg *config.Config, botService *services.BotService, updateDispatcher *dispatcher.Dispatcher) {
 	// Set Gin mode
 	gin.SetMode(cfg.Server.GinMode)
 
@@ -106,7 +241,7 @@ func startWebhookMode(cfg *config.Config, botService *services.BotService) {
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
-		err := database.HealthCheck()
+		err := database.HealthCheck(c.Request.Context())
 		if err != nil {
 			c.JSON(500, gin.H{"status": "unhealthy", "error": err.Error()})
 			return
@@ -114,62 +249,56 @@ func startWebhookMode(cfg *config.Config, botService *services.BotService) {
 		c.JSON(200, gin.H{"status": "healthy"})
 	})
 
+
+	// Secret Telegram must echo back on every webhook request
+	webhookSecret := cfg.Bot.WebhookSecret
+	if webhookSecret == "" {
+		webhookSecret = randomWebhookSecret()
+		log.Println("⚠️  WEBHOOK_SECRET not set, using a random secret for this run")
+	}
+
 	// Webhook endpoint
 	router.POST("/webhook", func(c *gin.Context) {
+		logger := botService.Logger.With("client_ip", c.ClientIP())
+
+		header := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(header), []byte(webhookSecret)) != 1 {
+			logger.Warn("rejected webhook request: bad secret token")
+			c.JSON(401, gin.H{"error": "unauthorized"})
+			return
+		}
+
 		var update tgbotapi.Update
 
 		if err := c.BindJSON(&update); err != nil {
-			log.Printf("Error binding update: %v", err)
+			logger.Warn("invalid webhook update", "error", err)
 			c.JSON(400, gin.H{"error": "invalid update"})
 			return
 		}
 
-		// Handle update in goroutine to not block webhook response
-		go handlers.HandleUpdate(botService, update)
+		// Telegram retries deliveries it thinks failed; drop ones we already have
+		if !botService.UpdateLogService.MarkReceived(c.Request.Context(), update.UpdateID) {
+			logger.Info("skipping duplicate update", "update_id", update.UpdateID)
+			c.JSON(200, gin.H{"ok": true})
+			return
+		}
+
+		// Queue update for the worker pool; Telegram retries on non-2xx
+		if !updateDispatcher.Submit(c.Request.Context(), update) {
+			botService.UpdateLogService.Forget(c.Request.Context(), update.UpdateID)
+			c.JSON(503, gin.H{"error": "shutting down"})
+			return
+		}
 
 		c.JSON(200, gin.H{"ok": true})
 	})
 
-	// Admin API endpoints
-	api := router.Group("/api")
-	{
-		admin := api.Group("/admin")
-		{
-			admin.GET("/users", func(c *gin.Context) {
-				users, err := botService.UserService.GetAllUsers(100, 0)
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
-				c.JSON(200, gin.H{"users": users})
-			})
-
-			admin.GET("/complaints", func(c *gin.Context) {
-				complaints, err := botService.ComplaintService.GetAllComplaintsWithUser(100, 0)
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
-				c.JSON(200, gin.H{"complaints": complaints})
-			})
-
-			admin.GET("/stats", func(c *gin.Context) {
-				userCount, _ := botService.UserService.CountUsers()
-				complaintCount, _ := botService.ComplaintService.CountComplaints()
-				pendingCount, _ := botService.ComplaintService.CountComplaintsByStatus("pending")
-
-				c.JSON(200, gin.H{
-					"total_users":        userCount,
-					"total_complaints":   complaintCount,
-					"pending_complaints": pendingCount,
-				})
-			})
-		}
-	}
+	// Admin API endpoints (bearer token required)
+	api.RegisterRoutes(router, botService)
 
 	// Setup webhook
 	webhookURL := cfg.Bot.WebhookURL + "/webhook"
-	err := botService.SetWebhook(webhookURL)
+	err := botService.SetWebhook(webhookURL, webhookSecret)
 	if err != nil {
 		log.Printf("Warning: Failed to set webhook: %v", err)
 	} else {
@@ -181,13 +310,90 @@ func startWebhookMode(cfg *config.Config, botService *services.BotService) {
 	log.Printf("🚀 Server starting on %s", serverAddr)
 	log.Printf("📱 Bot is ready to receive messages via webhook!")
 
-	if err := router.Run(serverAddr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Addr:    serverAddr,
+		Handler: router,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("🛑 Shutdown signal received, stopping HTTP server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Updates.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: HTTP server shutdown: %v", err)
 	}
 }
 
-// startPollingMode starts the bot with polling (for development/testing)
-func startPollingMode(botService *services.BotService) {
+// watchReload re-reads the configuration on every SIGHUP until ctx is cancelled.
+// An invalid configuration is rejected and the running one is kept.
+func watchReload(ctx context.Context, botService *services.BotService) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	logger := botService.Logger
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+
+		next, err := config.Load()
+		if err != nil {
+			logger.Error("config reload rejected, keeping current settings", "error", err)
+			continue
+		}
+
+		applied, needRestart, err := botService.ReloadConfig(ctx, next)
+		if err != nil {
+			logger.Error("config reload incomplete", "applied", applied, "error", err)
+			continue
+		}
+		if len(needRestart) > 0 {
+			logger.Warn("config changes need a restart to take effect", "settings", needRestart)
+		}
+		logger.Info("config reloaded", "file", next.File, "applied", applied)
+	}
+}
+
+// serveMetrics exposes /metrics on its own listener until ctx is cancelled
+func serveMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	log.Printf("📈 Metrics listening on %s/metrics", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Warning: metrics listener: %v", err)
+	}
+}
+
+// randomWebhookSecret generates a secret_token valid for Telegram (hex charset)
+func randomWebhookSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Failed to generate webhook secret: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// startPollingMode starts the bot with polling (for development/testing).
+// It returns once ctx is cancelled.
+func startPollingMode(ctx context.Context, botService *services.BotService, updateDispatcher *dispatcher.Dispatcher) {
 	// Remove webhook if set
 	err := botService.RemoveWebhook()
 	if err != nil {
@@ -206,9 +412,24 @@ func startPollingMode(botService *services.BotService) {
 	log.Println("💡 Press Ctrl+C to stop")
 	log.Println(strings.Repeat("─", 50))
 
-	// Process updates
-	for update := range updates {
-		// Handle each update
-		handlers.HandleUpdate(botService, update)
+	// Hand updates to the worker pool until shutdown
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("🛑 Shutdown signal received, stopping polling...")
+			botService.Bot.StopReceivingUpdates()
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if !botService.UpdateLogService.MarkReceived(ctx, update.UpdateID) {
+				botService.Logger.Info("skipping duplicate update", "update_id", update.UpdateID)
+				continue
+			}
+			if !updateDispatcher.Submit(ctx, update) {
+				botService.UpdateLogService.Forget(ctx, update.UpdateID)
+			}
+		}
 	}
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"parent-bot/internal/config"
+	"parent-bot/internal/database"
+)
+
+// runMigrateCommand handles `bot migrate up|down [steps]|status`
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Println("Usage: bot migrate up|down [steps]|status")
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := database.Connect(&cfg.Database); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer database.Close()
+
+	migrator, err := database.NewMigrator(database.DB)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("✓ Applied %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("✓ Nothing to apply, schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			fmt.Printf("✓ Reverted %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("revert failed: %w", err)
+		}
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return fmt.Errorf("failed to get migration status: %w", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, st := range statuses {
+			status, appliedAt := "pending", "-"
+			if st.Applied {
+				status = "applied"
+				appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if st.Modified {
+				status = "modified"
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", st.Migration.Version, st.Migration.Name, status, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		fmt.Printf("Unknown migrate command: %s\n", args[0])
+		fmt.Println("Usage: bot migrate up|down [steps]|status")
+		os.Exit(2)
+	}
+
+	return nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"parent-bot/internal/models"
+	"parent-bot/internal/utils"
+	"parent-bot/internal/validator"
+)
+
+const (
+	teacherUsage = "bot teacher add --phone PHONE --first-name NAME --last-name NAME [--language uz|ru] [--classes 5A,6B] [--admin PHONE]"
+	classUsage   = "bot class create <name>"
+	studentUsage = "bot student import <file.csv> [--class NAME] [--admin PHONE] [--dry-run]"
+	parentUsage  = "bot parent unlink <phone> <student_id|all>"
+)
+
+// runTeacherCommand handles `bot teacher add`
+func runTeacherCommand(args []string) error {
+	if len(args) == 0 || args[0] != "add" {
+		usage(teacherUsage)
+	}
+
+	fs := flag.NewFlagSet("teacher add", flag.ExitOnError)
+	phone := fs.String("phone", "", "teacher's phone number")
+	firstName := fs.String("first-name", "", "teacher's first name")
+	lastName := fs.String("last-name", "", "teacher's last name")
+	language := fs.String("language", "uz", "teacher's language, uz or ru")
+	classList := fs.String("classes", "", "comma-separated names of the classes the teacher teaches")
+	adminPhone := fs.String("admin", "", "phone of the admin the teacher is added by (default: the first admin)")
+	if rest := parseFlags(fs, args[1:]); len(rest) != 0 || *phone == "" || *firstName == "" || *lastName == "" {
+		usage(teacherUsage)
+	}
+
+	first, err := validator.ValidateName(*firstName)
+	if err != nil {
+		return fmt.Errorf("invalid first name: %w", err)
+	}
+	last, err := validator.ValidateName(*lastName)
+	if err != nil {
+		return fmt.Errorf("invalid last name: %w", err)
+	}
+	lang, err := validator.ValidateLanguage(*language)
+	if err != nil {
+		return fmt.Errorf("invalid language: %w", err)
+	}
+
+	ctx := cliContext()
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	admin, err := s.actingAdmin(ctx, *adminPhone)
+	if err != nil {
+		return err
+	}
+
+	req := &models.CreateTeacherRequest{
+		PhoneNumber:    *phone,
+		FirstName:      first,
+		LastName:       last,
+		Language:       lang,
+		AddedByAdminID: admin.ID,
+	}
+
+	var classNames []string
+	for _, name := range strings.Split(*classList, ",") {
+		if name = utils.SanitizeClassName(name); name == "" {
+			continue
+		}
+		class, err := s.classByName(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to find class: %w", err)
+		}
+		req.ClassIDs = append(req.ClassIDs, class.ID)
+		classNames = append(classNames, class.ClassName)
+	}
+
+	id, err := s.teachers.CreateTeacher(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to add teacher: %w", err)
+	}
+
+	fmt.Printf("✓ Added teacher %s %s, %s (id %d)\n", first, last, req.PhoneNumber, id)
+	if len(classNames) > 0 {
+		fmt.Printf("  classes: %s\n", strings.Join(classNames, ", "))
+	}
+	fmt.Println("  They get the teacher menu after sharing this phone number with the bot")
+
+	return nil
+}
+
+// runClassCommand handles `bot class create <name>`
+func runClassCommand(args []string) error {
+	if len(args) != 2 || args[0] != "create" {
+		usage(classUsage)
+	}
+
+	name := utils.SanitizeClassName(args[1])
+	if name == "" {
+		return fmt.Errorf("invalid class name: %q", args[1])
+	}
+
+	ctx := cliContext()
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	existing, err := s.classes.GetByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to check class: %w", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("class %s already exists (id %d)", name, existing.ID)
+	}
+
+	class, err := s.classService.CreateClass(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to create class: %w", err)
+	}
+
+	fmt.Printf("✓ Created class %s (id %d)\n", class.ClassName, class.ID)
+
+	return nil
+}
+
+// runStudentCommand handles `bot student import <file.csv>`. The file has
+// first name, last name and class columns, or just the names with --class;
+// a header row is skipped.
+func runStudentCommand(args []string) error {
+	if len(args) == 0 || args[0] != "import" {
+		usage(studentUsage)
+	}
+
+	fs := flag.NewFlagSet("student import", flag.ExitOnError)
+	className := fs.String("class", "", "class of every student in the file")
+	adminPhone := fs.String("admin", "", "phone of the admin the students are added by (default: the first admin)")
+	dryRun := fs.Bool("dry-run", false, "check the file without saving anything")
+	rest := parseFlags(fs, args[1:])
+	if len(rest) != 1 {
+		usage(studentUsage)
+	}
+
+	file, err := os.Open(rest[0])
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	ctx := cliContext()
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	admin, err := s.actingAdmin(ctx, *adminPhone)
+	if err != nil {
+		return err
+	}
+	adminID := admin.ID
+	classes := make(map[string]*models.Class)
+	var reqs []*models.CreateStudentRequest
+	var problems []string
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if line == 1 {
+			// Spreadsheets often save a byte order mark and a header row
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			if strings.EqualFold(strings.TrimSpace(record[0]), "first_name") {
+				continue
+			}
+		}
+
+		req, name, err := studentRow(record, *className)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+
+		class, ok := classes[name]
+		if !ok {
+			class, err = s.classByName(ctx, name)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+				continue
+			}
+			classes[name] = class
+		}
+
+		req.ClassID = class.ID
+		req.AddedByAdminID = &adminID
+		reqs = append(reqs, req)
+	}
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, "✗ "+problem)
+		}
+		return fmt.Errorf("nothing imported: fix the %d problem(s) above and run the import again", len(problems))
+	}
+
+	if *dryRun {
+		fmt.Printf("✓ %d students are ready to import into %d classes; nothing was saved\n", len(reqs), len(classes))
+		return nil
+	}
+
+	added, skipped, err := s.students.ImportStudents(ctx, reqs)
+	if err != nil {
+		return fmt.Errorf("import failed, nothing was saved: %w", err)
+	}
+
+	fmt.Printf("✓ Imported %d students", added)
+	if skipped > 0 {
+		fmt.Printf(", skipped %d already in their class", skipped)
+	}
+	fmt.Println()
+
+	return nil
+}
+
+// studentRow reads one student from a CSV record and returns the name of
+// their class
+func studentRow(record []string, className string) (*models.CreateStudentRequest, string, error) {
+	want := 3
+	if className != "" {
+		want = 2
+	}
+	if len(record) != want {
+		return nil, "", fmt.Errorf("expected %d columns, got %d", want, len(record))
+	}
+
+	first, err := validator.ValidateName(record[0])
+	if err != nil {
+		return nil, "", fmt.Errorf("first name: %w", err)
+	}
+	last, err := validator.ValidateName(record[1])
+	if err != nil {
+		return nil, "", fmt.Errorf("last name: %w", err)
+	}
+
+	if className == "" {
+		className = record[2]
+	}
+	className = utils.SanitizeClassName(className)
+	if className == "" {
+		return nil, "", fmt.Errorf("class is missing")
+	}
+
+	return &models.CreateStudentRequest{FirstName: first, LastName: last}, className, nil
+}
+
+// runParentCommand handles `bot parent unlink <phone> <student_id|all>`
+func runParentCommand(args []string) error {
+	if len(args) != 3 || args[0] != "unlink" {
+		usage(parentUsage)
+	}
+
+	phone, err := normalizePhone(args[1])
+	if err != nil {
+		return err
+	}
+	studentID := 0
+	if args[2] != "all" {
+		id, err := strconv.Atoi(args[2])
+		if err != nil || id < 1 {
+			return fmt.Errorf("invalid student ID: %s", args[2])
+		}
+		studentID = id
+	}
+
+	ctx := cliContext()
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	parent, err := s.users.GetUserByPhoneNumber(ctx, phone)
+	if err != nil {
+		return fmt.Errorf("failed to get parent: %w", err)
+	}
+	if parent == nil {
+		return fmt.Errorf("no parent is registered with phone %s", phone)
+	}
+
+	children, err := s.students.GetParentStudents(ctx, parent.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get children: %w", err)
+	}
+
+	unlinked := 0
+	for _, child := range children {
+		if studentID != 0 && child.StudentID != studentID {
+			continue
+		}
+		if err := s.students.UnlinkFromParent(ctx, parent.ID, child.StudentID); err != nil {
+			return fmt.Errorf("failed to unlink student %d: %v", child.StudentID, err)
+		}
+		fmt.Printf("✓ Unlinked %s %s (%s, id %d) from %s\n", child.StudentFirstName, child.StudentLastName,
+			child.ClassName, child.StudentID, phone)
+		unlinked++
+	}
+
+	if unlinked == 0 {
+		if studentID != 0 {
+			return fmt.Errorf("student %d is not linked to %s", studentID, phone)
+		}
+		fmt.Printf("✓ %s has no linked children\n", phone)
+	}
+
+	return nil
+}
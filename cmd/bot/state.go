@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const stateUsage = "bot state show|reset <telegram_id>"
+
+// runStateCommand handles `bot state show|reset <telegram_id>`, for users
+// stuck in a conversation
+func runStateCommand(args []string) error {
+	if len(args) != 2 || (args[0] != "show" && args[0] != "reset") {
+		usage(stateUsage)
+	}
+
+	telegramID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid Telegram ID: %s", args[1])
+	}
+
+	ctx := cliContext()
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	// As saved, so that looking at a state the bot can't read doesn't drop it
+	current, err := s.states.Saved(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get state: %w", err)
+	}
+
+	if current == nil {
+		fmt.Printf("✓ %d has no saved state\n", telegramID)
+		return nil
+	}
+
+	fmt.Printf("  state:   %s\n", current.State)
+	if current.Flow != "" {
+		fmt.Printf("  flow:    %s (version %d)\n", current.Flow, current.FlowVersion)
+		fmt.Printf("  data:    %s\n", current.Data)
+	}
+	if current.ExpiresAt != nil {
+		status := ""
+		if current.Expired(time.Now()) {
+			status = " (expired)"
+		}
+		fmt.Printf("  expires: %s%s\n", current.ExpiresAt.Local().Format("2006-01-02 15:04:05"), status)
+	}
+	fmt.Printf("  updated: %s\n", current.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+
+	if args[0] == "show" {
+		return nil
+	}
+
+	if err := s.states.Delete(ctx, telegramID); err != nil {
+		return fmt.Errorf("failed to reset state: %w", err)
+	}
+
+	fmt.Printf("✓ Reset the state of %d; their next message starts from the menu\n", telegramID)
+	fmt.Println("  A message the bot is handling right now fails to save over the reset")
+
+	return nil
+}
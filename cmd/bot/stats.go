@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"parent-bot/internal/models"
+)
+
+// runStatsCommand handles `bot stats`
+func runStatsCommand(args []string) error {
+	if len(args) != 0 {
+		usage("bot stats")
+	}
+
+	ctx := cliContext()
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	// The first failed count is returned; nothing is printed before the flush
+	var failed error
+	count := func(what string, fn func(context.Context) (int, error)) int {
+		if failed != nil {
+			return 0
+		}
+		n, err := fn(ctx)
+		if err != nil {
+			failed = fmt.Errorf("failed to count %s: %w", what, err)
+		}
+		return n
+	}
+	countStatus := func(what, status string, fn func(context.Context, string) (int, error)) int {
+		return count(what, func(ctx context.Context) (int, error) { return fn(ctx, status) })
+	}
+	countNotifications := func(status string) int {
+		return count("notifications", func(ctx context.Context) (int, error) {
+			return s.notifications.CountFiltered(ctx, &models.NotificationFilter{Status: status})
+		})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "parents\t%d\n", count("parents", s.users.CountUsers))
+	fmt.Fprintf(w, "admins\t%d\n", count("admins", s.admins.Count))
+	fmt.Fprintf(w, "teachers\t%d\n", count("teachers", s.teachers.CountTeachers))
+	fmt.Fprintf(w, "classes\t%d\n", count("classes", s.classes.Count))
+	fmt.Fprintf(w, "students\t%d\n", count("students", s.students.CountStudents))
+	fmt.Fprintf(w, "complaints\t%d (%d pending)\n",
+		count("complaints", s.complaints.CountComplaints),
+		countStatus("complaints", models.StatusPending, s.complaints.CountComplaintsByStatus))
+	fmt.Fprintf(w, "proposals\t%d (%d pending)\n",
+		count("proposals", s.proposals.CountProposals),
+		countStatus("proposals", models.StatusPending, s.proposals.CountProposalsByStatus))
+	fmt.Fprintf(w, "notifications\t%d pending, %d failed\n",
+		countNotifications(models.NotificationPending), countNotifications(models.NotificationFailed))
+
+	if failed != nil {
+		return failed
+	}
+
+	flows, err := s.states.CountFlows(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count flows: %w", err)
+	}
+	total := 0
+	for _, n := range flows {
+		total += n
+	}
+	fmt.Fprintf(w, "in a conversation\t%d\n", total)
+	names := make([]string, 0, len(flows))
+	for name := range flows {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%d\n", name, flows[name])
+	}
+
+	w.Flush()
+
+	return nil
+}
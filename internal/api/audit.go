@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"parent-bot/internal/models"
+)
+
+// listAudit handles GET /audit?entity_type=&entity_id=&action=&actor_telegram_id=&source=&since=&until=&limit=&offset=
+// with since/until in RFC 3339. format=csv returns every matching entry, up
+// to services.AuditExportLimit, as a CSV file instead of a page.
+func (h *handler) listAudit(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	limit, offset, err := pagination(c)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	filter := &models.AuditFilter{
+		EntityType: c.Query("entity_type"),
+		EntityID:   c.Query("entity_id"),
+		Action:     c.Query("action"),
+		Source:     c.Query("source"),
+		Limit:      limit,
+		Offset:     offset,
+	}
+
+	if v := c.Query("actor_telegram_id"); v != "" {
+		telegramID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			badRequest(c, fmt.Errorf("invalid actor_telegram_id: %s", v))
+			return
+		}
+		filter.ActorTelegramID = &telegramID
+	}
+
+	for name, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				badRequest(c, fmt.Errorf("invalid %s: %s", name, v))
+				return
+			}
+			*dst = &t
+		}
+	}
+
+	if c.Query("format") == "csv" {
+		filename := fmt.Sprintf("audit_%s.csv", time.Now().In(h.bot.Location).Format("2006-01-02_1504"))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		if _, err := h.bot.AuditService.ExportCSV(ctx, filter, h.bot.Location, c.Writer); err != nil {
+			respondError(c, err)
+		}
+		return
+	}
+
+	entries, err := h.bot.AuditService.List(ctx, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	total, err := h.bot.AuditService.Count(ctx, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPage(entries, total, limit, offset))
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"parent-bot/internal/models"
+	"parent-bot/internal/utils"
+)
+
+// listClasses handles GET /classes?search=&is_active=&limit=&offset=
+func (h *handler) listClasses(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	limit, offset, err := pagination(c)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	isActive, err := queryBool(c, "is_active")
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	filter := &models.ClassFilter{
+		Search:   c.Query("search"),
+		IsActive: isActive,
+		Limit:    limit,
+		Offset:   offset,
+	}
+
+	classes, err := h.bot.ClassRepo.List(ctx, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	total, err := h.bot.ClassRepo.CountFiltered(ctx, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPage(classes, total, limit, offset))
+}
+
+// getClass handles GET /classes/:id
+func (h *handler) getClass(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	class, err := h.bot.ClassRepo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if class == nil {
+		notFound(c, "class")
+		return
+	}
+
+	c.JSON(http.StatusOK, class)
+}
+
+// createClass handles POST /classes
+func (h *handler) createClass(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req models.CreateClassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	req.ClassName = utils.SanitizeClassName(req.ClassName)
+	if !validateRequest(c, &req) {
+		return
+	}
+
+	existing, err := h.bot.ClassRepo.GetByName(ctx, req.ClassName)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "class already exists", "id": existing.ID})
+		return
+	}
+
+	class, err := h.bot.ClassService.CreateClass(ctx, req.ClassName)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, class)
+}
+
+// updateClass handles PATCH /classes/:id
+func (h *handler) updateClass(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateClassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	req.ClassName = utils.SanitizeClassName(req.ClassName)
+	if !validateRequest(c, &req) {
+		return
+	}
+
+	class, err := h.bot.ClassRepo.GetByID(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if class == nil {
+		notFound(c, "class")
+		return
+	}
+
+	if req.ClassName != "" && req.ClassName != class.ClassName {
+		existing, err := h.bot.ClassRepo.GetByName(ctx, req.ClassName)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if existing != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "class already exists", "id": existing.ID})
+			return
+		}
+	}
+
+	if err := h.bot.ClassService.UpdateClass(ctx, id, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	class, err = h.bot.ClassRepo.GetByID(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, class)
+}
+
+// deleteClass handles DELETE /classes/:id
+func (h *handler) deleteClass(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	class, err := h.bot.ClassRepo.GetByID(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if class == nil {
+		notFound(c, "class")
+		return
+	}
+
+	if err := h.bot.ClassService.DeleteClass(ctx, id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
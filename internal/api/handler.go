@@ -0,0 +1,197 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	playvalidator "github.com/go-playground/validator/v10"
+	"parent-bot/internal/database"
+	"parent-bot/internal/middleware"
+	"parent-bot/internal/models"
+	"parent-bot/internal/services"
+)
+
+// Pagination bounds for list endpoints
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+// validate checks request models against their `validate` struct tags and
+// names fields in its errors by their JSON names
+var validate = newValidator()
+
+// newValidator creates a validator that reports the `json` tag name of a
+// field, or the Go name if it has none
+func newValidator() *playvalidator.Validate {
+	v := playvalidator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// handler serves the admin CRUD endpoints
+type handler struct {
+	bot *services.BotService
+}
+
+// page is the JSON envelope for paginated lists
+type page struct {
+	Items  any `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// newPage builds a list response, rendering an empty result as [] rather than null
+func newPage[T any](items []T, total, limit, offset int) page {
+	if items == nil {
+		items = []T{}
+	}
+	return page{Items: items, Total: total, Limit: limit, Offset: offset}
+}
+
+// pagination reads limit/offset query parameters
+func pagination(c *gin.Context) (limit, offset int, err error) {
+	limit, offset = defaultLimit, 0
+
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("invalid limit: %s", v)
+		}
+		if limit > maxLimit {
+			limit = maxLimit
+		}
+	}
+
+	if v := c.Query("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", v)
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// queryInt reads an optional integer query parameter
+func queryInt(c *gin.Context, name string) (*int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", name, v)
+	}
+	return &n, nil
+}
+
+// queryBool reads an optional boolean query parameter
+func queryBool(c *gin.Context, name string) (*bool, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", name, v)
+	}
+	return &b, nil
+}
+
+// pathID reads a positive integer path parameter
+func pathID(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id < 1 {
+		badRequest(c, fmt.Errorf("invalid %s: %s", name, c.Param(name)))
+		return 0, false
+	}
+	return id, true
+}
+
+// bindJSON decodes and validates a request body
+func bindJSON(c *gin.Context, req any) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		badRequest(c, fmt.Errorf("invalid JSON body: %w", err))
+		return false
+	}
+	return validateRequest(c, req)
+}
+
+// validateRequest validates a decoded request model and reports field errors
+func validateRequest(c *gin.Context, req any) bool {
+	err := validate.Struct(req)
+	if err == nil {
+		return true
+	}
+
+	var fieldErrors playvalidator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		badRequest(c, err)
+		return false
+	}
+
+	fields := make(map[string]string, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		rule := fe.Tag()
+		if fe.Param() != "" {
+			rule += "=" + fe.Param()
+		}
+		fields[fe.Field()] = rule
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "fields": fields})
+	return false
+}
+
+// tokenAdminID returns the admin who owns the request's API token
+func tokenAdminID(c *gin.Context) int {
+	if v, ok := c.Get(middleware.TokenContextKey); ok {
+		if token, ok := v.(*models.APIToken); ok {
+			return token.AdminID
+		}
+	}
+	return 0
+}
+
+// badRequest responds with 400
+func badRequest(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// notFound responds with 404
+func notFound(c *gin.Context, what string) {
+	c.JSON(http.StatusNotFound, gin.H{"error": what + " not found"})
+}
+
+// respondError maps service and database errors to HTTP status codes
+func respondError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrConflict),
+		errors.Is(err, database.ErrDuplicate),
+		errors.Is(err, database.ErrForeignKey):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
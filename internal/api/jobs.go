@@ -0,0 +1,71 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"parent-bot/internal/models"
+	"parent-bot/internal/scheduler"
+)
+
+// jobResponse is a background job with its schedule and run history
+type jobResponse struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Schedule    string      `json:"schedule"`
+	Timezone    string      `json:"timezone"`
+	NextRunAt   time.Time   `json:"next_run_at"`
+	Running     bool        `json:"running"`
+	History     *models.Job `json:"history,omitempty"`
+}
+
+// listJobs handles GET /jobs
+func (h *handler) listJobs(c *gin.Context) {
+	jobs, err := h.bot.Scheduler.Jobs(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	timezone := h.bot.Scheduler.Location().String()
+	items := make([]jobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		items = append(items, jobResponse{
+			Name:        job.Name,
+			Description: job.Description,
+			Schedule:    job.Schedule,
+			Timezone:    timezone,
+			NextRunAt:   job.NextRun,
+			Running:     job.Running,
+			History:     job.History,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": items})
+}
+
+// runJob handles POST /jobs/:name/run; the job runs in the background
+func (h *handler) runJob(c *gin.Context) {
+	name := c.Param("name")
+
+	err := h.bot.Scheduler.Trigger(name)
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		notFound(c, "job")
+		return
+	case errors.Is(err, scheduler.ErrJobRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, scheduler.ErrStopped):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		respondError(c, err)
+		return
+	}
+
+	h.bot.Logger.Info("job triggered via API", "job", name, "admin_id", tokenAdminID(c))
+	c.JSON(http.StatusAccepted, gin.H{"job": name, "status": models.JobStatusRunning})
+}
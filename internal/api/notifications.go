@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"parent-bot/internal/models"
+)
+
+// listNotifications handles GET /notifications?chat_id=&kind=&status=&ref=&limit=&offset=
+func (h *handler) listNotifications(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	limit, offset, err := pagination(c)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	filter := &models.NotificationFilter{
+		Kind:   c.Query("kind"),
+		Status: c.Query("status"),
+		Ref:    c.Query("ref"),
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	if v := c.Query("chat_id"); v != "" {
+		chatID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			badRequest(c, fmt.Errorf("invalid chat_id: %s", v))
+			return
+		}
+		filter.ChatID = &chatID
+	}
+
+	notifications, err := h.bot.NotificationRepo.List(ctx, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	total, err := h.bot.NotificationRepo.CountFiltered(ctx, filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPage(notifications, total, limit, offset))
+}
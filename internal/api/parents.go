@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// linkStudentRequest is the body of POST /parents/:id/students
+type linkStudentRequest struct {
+	StudentID int `json:"student_id" validate:"required,min=1"`
+}
+
+// listParentStudents handles GET /parents/:id/students
+func (h *handler) listParentStudents(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	parentID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	parent, err := h.bot.UserRepo.GetByID(ctx, parentID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if parent == nil {
+		notFound(c, "parent")
+		return
+	}
+
+	children, err := h.bot.StudentService.GetParentStudents(ctx, parentID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPage(children, len(children), len(children), 0))
+}
+
+// linkParentStudent handles POST /parents/:id/students
+func (h *handler) linkParentStudent(c *gin.Context) {
+	parentID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req linkStudentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.bot.StudentService.LinkToParent(c.Request.Context(), parentID, req.StudentID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// unlinkParentStudent handles DELETE /parents/:id/students/:student_id
+func (h *handler) unlinkParentStudent(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	parentID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	studentID, ok := pathID(c, "student_id")
+	if !ok {
+		return
+	}
+
+	linked, err := h.bot.StudentService.IsStudentLinkedToParent(ctx, parentID, studentID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !linked {
+		notFound(c, "link")
+		return
+	}
+
+	if err := h.bot.StudentService.UnlinkFromParent(ctx, parentID, studentID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"parent-bot/internal/metrics"
+	"parent-bot/internal/middleware"
+	"parent-bot/internal/models"
+	"parent-bot/internal/services"
+)
+
+// RegisterRoutes registers the authenticated admin API under /api/admin
+func RegisterRoutes(router *gin.Engine, botService *services.BotService) {
+	admin := router.Group("/api/admin")
+	h := &handler{bot: botService}
+
+	// Each endpoint needs a token of the scope whose issuer's role grants the
+	// permission the bot's admin panel needs for the same data
+	read := func(permission models.Permission) gin.HandlerFunc {
+		return middleware.AdminAuth(botService.APITokenService, models.APIScopeRead, permission)
+	}
+	write := func(permission models.Permission) gin.HandlerFunc {
+		return middleware.AdminAuth(botService.APITokenService, models.APIScopeWrite, permission)
+	}
+
+	admin.GET("/users", read(models.PermUsersView), func(c *gin.Context) {
+		users, err := botService.UserService.GetAllUsers(c.Request.Context(), 100, 0)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"users": users})
+	})
+
+	admin.GET("/complaints", read(models.PermComplaintsView), func(c *gin.Context) {
+		complaints, err := botService.ComplaintService.GetAllComplaintsWithUser(c.Request.Context(), 100, 0)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"complaints": complaints})
+	})
+
+	admin.GET("/stats", read(models.PermStatsView), func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userCount, _ := botService.UserService.CountUsers(ctx)
+		complaintCount, _ := botService.ComplaintService.CountComplaints(ctx)
+		pendingCount, _ := botService.ComplaintService.CountComplaintsByStatus(ctx, "pending")
+
+		stats := gin.H{
+			"total_users":        userCount,
+			"total_complaints":   complaintCount,
+			"pending_complaints": pendingCount,
+		}
+		if botService.CallbackRouter != nil {
+			stats["callbacks"] = botService.CallbackRouter.Stats()
+		}
+
+		c.JSON(200, stats)
+	})
+
+	// Prometheus metrics, for a scraper holding a read token
+	admin.GET("/metrics", read(models.PermStatsView), gin.WrapH(metrics.Handler()))
+
+	admin.GET("/classes", read(models.PermClassesManage), h.listClasses)
+	admin.GET("/classes/:id", read(models.PermClassesManage), h.getClass)
+
+	admin.GET("/students", read(models.PermStudentsManage), h.listStudents)
+	admin.GET("/students/:id", read(models.PermStudentsManage), h.getStudent)
+
+	admin.GET("/teachers", read(models.PermTeachersManage), h.listTeachers)
+	admin.GET("/teachers/:id", read(models.PermTeachersManage), h.getTeacher)
+	admin.GET("/teachers/:id/classes", read(models.PermTeachersManage), h.listTeacherClasses)
+
+	admin.GET("/parents/:id/students", read(models.PermStudentsManage), h.listParentStudents)
+
+	admin.GET("/jobs", read(models.PermJobsManage), h.listJobs)
+
+	admin.GET("/notifications", read(models.PermJobsManage), h.listNotifications)
+
+	admin.GET("/audit", read(models.PermAuditView), h.listAudit)
+
+	admin.POST("/classes", write(models.PermClassesManage), h.createClass)
+	admin.PATCH("/classes/:id", write(models.PermClassesManage), h.updateClass)
+	admin.DELETE("/classes/:id", write(models.PermClassesManage), h.deleteClass)
+
+	admin.POST("/students", write(models.PermStudentsManage), h.createStudent)
+	admin.PATCH("/students/:id", write(models.PermStudentsManage), h.updateStudent)
+	admin.DELETE("/students/:id", write(models.PermStudentsManage), h.deleteStudent)
+
+	admin.POST("/teachers", write(models.PermTeachersManage), h.createTeacher)
+	admin.PATCH("/teachers/:id", write(models.PermTeachersManage), h.updateTeacher)
+	admin.DELETE("/teachers/:id", write(models.PermTeachersManage), h.deleteTeacher)
+	admin.PUT("/teachers/:id/classes/:class_id", write(models.PermTeachersManage), h.assignTeacherClass)
+	admin.DELETE("/teachers/:id/classes/:class_id", write(models.PermTeachersManage), h.unassignTeacherClass)
+
+	admin.POST("/parents/:id/students", write(models.PermStudentsManage), h.linkParentStudent)
+	admin.DELETE("/parents/:id/students/:student_id", write(models.PermStudentsManage), h.unlinkParentStudent)
+
+	admin.POST("/jobs/:name/run", write(models.PermJobsManage), h.runJob)
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"parent-bot/internal/models"
+)
+
+// listStudents handles GET /students?class_id=&search=&include_inactive=&limit=&offset=
+func (h *handler) listStudents(c *gin.Context) {
+	limit, offset, err := pagination(c)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	classID, err := queryInt(c, "class_id")
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	includeInactive, err := queryBool(c, "include_inactive")
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	filter := &models.StudentFilter{
+		ClassID:         classID,
+		Search:          c.Query("search"),
+		IncludeInactive: includeInactive != nil && *includeInactive,
+		Limit:           limit,
+		Offset:          offset,
+	}
+
+	students, total, err := h.bot.StudentService.ListStudents(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPage(students, total, limit, offset))
+}
+
+// getStudent handles GET /students/:id
+func (h *handler) getStudent(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	student, err := h.bot.StudentService.GetStudentByIDWithClass(c.Request.Context(), id)
+	if err == sql.ErrNoRows {
+		notFound(c, "student")
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, student)
+}
+
+// createStudent handles POST /students
+func (h *handler) createStudent(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req models.CreateStudentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	// Records created over the API are attributed to the token's admin
+	adminID := tokenAdminID(c)
+	req.AddedByAdminID = &adminID
+	req.AddedByTeacherID = nil
+
+	id, err := h.bot.StudentService.CreateStudent(ctx, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	student, err := h.bot.StudentService.GetStudentByIDWithClass(ctx, int(id))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, student)
+}
+
+// updateStudent handles PATCH /students/:id
+func (h *handler) updateStudent(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateStudentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.bot.StudentService.UpdateStudent(ctx, id, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	student, err := h.bot.StudentService.GetStudentByIDWithClass(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, student)
+}
+
+// deleteStudent handles DELETE /students/:id[?hard=true].
+// By default the student is deactivated; hard=true removes the row.
+func (h *handler) deleteStudent(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	hard, err := queryBool(c, "hard")
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if _, err := h.bot.StudentService.GetStudentByID(ctx, id); err != nil {
+		if err == sql.ErrNoRows {
+			notFound(c, "student")
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	if hard != nil && *hard {
+		err = h.bot.StudentService.HardDeleteStudent(ctx, id)
+	} else {
+		err = h.bot.StudentService.DeleteStudent(ctx, id)
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
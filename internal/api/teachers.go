@@ -0,0 +1,261 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"parent-bot/internal/models"
+	"parent-bot/internal/validator"
+)
+
+// listTeachers handles GET /teachers?search=&is_active=&class_id=&limit=&offset=
+func (h *handler) listTeachers(c *gin.Context) {
+	limit, offset, err := pagination(c)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	isActive, err := queryBool(c, "is_active")
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	classID, err := queryInt(c, "class_id")
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	filter := &models.TeacherFilter{
+		Search:   c.Query("search"),
+		IsActive: isActive,
+		ClassID:  classID,
+		Limit:    limit,
+		Offset:   offset,
+	}
+
+	teachers, total, err := h.bot.TeacherService.ListTeachers(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPage(teachers, total, limit, offset))
+}
+
+// getTeacher handles GET /teachers/:id
+func (h *handler) getTeacher(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	teacher, err := h.bot.TeacherService.GetTeacherByID(c.Request.Context(), id)
+	if err == sql.ErrNoRows {
+		notFound(c, "teacher")
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, teacher)
+}
+
+// createTeacher handles POST /teachers
+func (h *handler) createTeacher(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req models.CreateTeacherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	// Records created over the API are attributed to the token's admin
+	req.AddedByAdminID = tokenAdminID(c)
+	if req.Language == "" {
+		req.Language = "uz"
+	}
+
+	if !validateRequest(c, &req) {
+		return
+	}
+
+	if _, err := validator.ValidateUzbekPhone(req.PhoneNumber); err != nil {
+		badRequest(c, fmt.Errorf("invalid phone number: %w", err))
+		return
+	}
+
+	id, err := h.bot.TeacherService.CreateTeacher(ctx, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	teacher, err := h.bot.TeacherService.GetTeacherByID(ctx, int(id))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, teacher)
+}
+
+// updateTeacher handles PATCH /teachers/:id
+func (h *handler) updateTeacher(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateTeacherRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.bot.TeacherService.UpdateTeacher(ctx, id, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	teacher, err := h.bot.TeacherService.GetTeacherByID(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, teacher)
+}
+
+// deleteTeacher handles DELETE /teachers/:id[?hard=true].
+// By default the teacher is deactivated; hard=true removes the row.
+func (h *handler) deleteTeacher(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	hard, err := queryBool(c, "hard")
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+
+	if _, err := h.bot.TeacherService.GetTeacherByID(ctx, id); err != nil {
+		if err == sql.ErrNoRows {
+			notFound(c, "teacher")
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	if hard != nil && *hard {
+		err = h.bot.TeacherService.DeleteTeacher(ctx, id)
+	} else {
+		err = h.bot.TeacherService.DeactivateTeacher(ctx, id)
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// listTeacherClasses handles GET /teachers/:id/classes
+func (h *handler) listTeacherClasses(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if _, err := h.bot.TeacherService.GetTeacherByID(ctx, id); err != nil {
+		if err == sql.ErrNoRows {
+			notFound(c, "teacher")
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	classes, err := h.bot.TeacherService.GetTeacherClasses(ctx, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newPage(classes, len(classes), len(classes), 0))
+}
+
+// assignTeacherClass handles PUT /teachers/:id/classes/:class_id
+func (h *handler) assignTeacherClass(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	classID, ok := pathID(c, "class_id")
+	if !ok {
+		return
+	}
+
+	assigned, err := h.bot.TeacherService.IsTeacherAssignedToClass(ctx, id, classID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if !assigned {
+		if err := h.bot.TeacherService.AssignToClass(ctx, id, classID); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// unassignTeacherClass handles DELETE /teachers/:id/classes/:class_id
+func (h *handler) unassignTeacherClass(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	classID, ok := pathID(c, "class_id")
+	if !ok {
+		return
+	}
+
+	assigned, err := h.bot.TeacherService.IsTeacherAssignedToClass(ctx, id, classID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !assigned {
+		notFound(c, "assignment")
+		return
+	}
+
+	if err := h.bot.TeacherService.RemoveFromClass(ctx, id, classID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,271 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"parent-bot/internal/i18n"
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+)
+
+// ErrDenied is returned when a caller fails an action's rule
+var ErrDenied = errors.New("access denied")
+
+// Caller is the identity behind an update, resolved once per update
+type Caller struct {
+	TelegramID  int64
+	User        *models.User    // parent record, nil if not registered
+	Teacher     *models.Teacher // nil if not a teacher
+	Admin       *models.Admin   // staff record, nil if not staff
+	IsAdmin     bool            // has a staff record, whatever its role
+	Permissions models.PermissionSet
+	Language    i18n.Language
+}
+
+// Can reports whether the caller's roles grant a permission
+func (c *Caller) Can(permission models.Permission) bool {
+	return c.Permissions.Has(permission)
+}
+
+// IsSuperAdmin reports whether the caller's staff role is super-admin
+func (c *Caller) IsSuperAdmin() bool {
+	return c.Admin != nil && c.Admin.Role == models.RoleSuperAdmin
+}
+
+// HasAdminPanel reports whether the caller's roles grant any permission of
+// the admin panel
+func (c *Caller) HasAdminPanel() bool {
+	return c.Permissions.HasAny(models.AdminPermissions...)
+}
+
+// HasPhone reports whether phone is the caller's, as staff, teacher or parent
+func (c *Caller) HasPhone(phone string) bool {
+	return (c.Admin != nil && c.Admin.PhoneNumber == phone) ||
+		(c.Teacher != nil && c.Teacher.PhoneNumber == phone) ||
+		(c.User != nil && c.User.PhoneNumber == phone)
+}
+
+// IsParent reports whether the caller is a registered parent
+func (c *Caller) IsParent() bool {
+	return c.User != nil
+}
+
+// IsTeacher reports whether the caller is an active teacher
+func (c *Caller) IsTeacher() bool {
+	return c.Teacher != nil && c.Teacher.IsActive
+}
+
+// Roles returns a readable role list for logs
+func (c *Caller) Roles() string {
+	var roles []string
+	if c.Admin != nil {
+		roles = append(roles, c.Admin.Role)
+	}
+	if c.IsTeacher() {
+		roles = append(roles, c.Teacher.Role)
+	}
+	if c.IsParent() {
+		roles = append(roles, "parent")
+	}
+	if len(roles) == 0 {
+		return "guest"
+	}
+	return strings.Join(roles, "|")
+}
+
+// Args exposes an action's parsed parameters to rules
+type Args interface {
+	Int(name string) int
+}
+
+// noArgs is used for actions without parameters, such as commands
+type noArgs struct{}
+
+func (noArgs) Int(string) int { return 0 }
+
+// Auditor records changes and denials in the audit log
+type Auditor interface {
+	Record(ctx context.Context, entityType, verb string, entityID any, before, after any)
+}
+
+// Policy resolves callers and checks them against action rules
+type Policy struct {
+	adminRepo        *repository.AdminRepository
+	teacherRepo      *repository.TeacherRepository
+	userRepo         *repository.UserRepository
+	studentRepo      *repository.StudentRepository
+	announcementRepo *repository.AnnouncementRepository
+	roleRepo         *repository.RoleRepository
+	auditor          Auditor
+	logger           *slog.Logger
+}
+
+// NewPolicy creates a new authorization policy
+func NewPolicy(
+	adminRepo *repository.AdminRepository,
+	teacherRepo *repository.TeacherRepository,
+	userRepo *repository.UserRepository,
+	studentRepo *repository.StudentRepository,
+	announcementRepo *repository.AnnouncementRepository,
+	roleRepo *repository.RoleRepository,
+	auditor Auditor,
+	logger *slog.Logger,
+) *Policy {
+	return &Policy{
+		adminRepo:        adminRepo,
+		teacherRepo:      teacherRepo,
+		userRepo:         userRepo,
+		studentRepo:      studentRepo,
+		announcementRepo: announcementRepo,
+		roleRepo:         roleRepo,
+		auditor:          auditor,
+		logger:           logger,
+	}
+}
+
+// Resolve looks up everything the policy needs to know about a Telegram user
+func (p *Policy) Resolve(ctx context.Context, telegramID int64) (*Caller, error) {
+	caller := &Caller{TelegramID: telegramID, Language: i18n.LanguageUzbek}
+
+	user, err := p.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve user: %w", err)
+	}
+	caller.User = user
+
+	phone := ""
+	if user != nil {
+		phone = user.PhoneNumber
+		caller.Language = i18n.GetLanguage(user.Language)
+	}
+
+	caller.Admin, err = p.adminRepo.Find(ctx, phone, telegramID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve admin: %w", err)
+	}
+
+	// Staff added by phone are linked on first contact, so notifications reach them
+	if caller.Admin != nil && caller.Admin.TelegramID == nil {
+		if err := p.adminRepo.UpdateTelegramID(ctx, phone, telegramID); err != nil {
+			p.logger.Warn("failed to link admin telegram ID", "telegram_id", telegramID, "error", err)
+		} else {
+			before := *caller.Admin
+			caller.Admin.TelegramID = &telegramID
+			p.auditor.Record(ctx, models.AuditEntityAdmin, "link_telegram", before.ID, &before, caller.Admin)
+		}
+	}
+	caller.IsAdmin = caller.Admin != nil
+
+	teacher, err := p.teacherRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve teacher: %w", err)
+	}
+	caller.Teacher = teacher
+	if teacher != nil && user == nil {
+		caller.Language = i18n.GetLanguage(teacher.Language)
+	}
+
+	caller.Permissions, err = p.Permissions(ctx, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	return caller, nil
+}
+
+// Permissions gets what the caller's staff and teacher roles grant. Super-
+// admins have every permission; inactive teachers have none of a teacher's.
+func (p *Policy) Permissions(ctx context.Context, caller *Caller) (models.PermissionSet, error) {
+	var roles []string
+	if caller.Admin != nil {
+		if caller.Admin.Role == models.RoleSuperAdmin {
+			return models.AllPermissions(), nil
+		}
+		roles = append(roles, caller.Admin.Role)
+	}
+	if caller.IsTeacher() {
+		roles = append(roles, caller.Teacher.Role)
+	}
+
+	permissions, err := p.roleRepo.Permissions(ctx, roles...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve permissions: %w", err)
+	}
+	return permissions, nil
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context carrying the caller of the update it handles
+func WithCaller(ctx context.Context, caller *Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFrom returns the caller carried by ctx, or one without identity or
+// permissions
+func CallerFrom(ctx context.Context) *Caller {
+	if caller, ok := ctx.Value(callerKey{}).(*Caller); ok {
+		return caller
+	}
+	return &Caller{Permissions: models.PermissionSet{}, Language: i18n.LanguageUzbek}
+}
+
+// Authorize checks the caller against an action's rule. Denials are
+// written to the audit log and returned as ErrDenied.
+func (p *Policy) Authorize(ctx context.Context, caller *Caller, action string, rule Rule, args Args) error {
+	if args == nil {
+		args = noArgs{}
+	}
+
+	// A route registered without a rule is never allowed
+	if rule.check == nil {
+		p.audit(ctx, caller, action, rule)
+		return ErrDenied
+	}
+
+	allowed, err := rule.check(ctx, p, caller, args)
+	if err != nil {
+		return fmt.Errorf("failed to authorize %s: %w", action, err)
+	}
+
+	if !allowed {
+		p.audit(ctx, caller, action, rule)
+		return ErrDenied
+	}
+
+	return nil
+}
+
+// DeniedMessage returns the localized reply for a denied action.
+// Unregistered callers are asked to register instead.
+func (p *Policy) DeniedMessage(caller *Caller, rule Rule) string {
+	if rule.forParents && !caller.IsParent() && !caller.IsAdmin && !caller.IsTeacher() {
+		return i18n.Get(i18n.ErrNotRegistered, caller.Language)
+	}
+	return i18n.Get(i18n.ErrAccessDenied, caller.Language)
+}
+
+// audit records a denied action in the audit log, as the caller's
+func (p *Policy) audit(ctx context.Context, caller *Caller, action string, rule Rule) {
+	requires := rule.name
+	if requires == "" {
+		requires = "nothing (no rule)"
+	}
+
+	p.logger.Warn("access denied",
+		"audit", true,
+		"telegram_id", caller.TelegramID,
+		"roles", caller.Roles(),
+		"action", action,
+		"requires", requires,
+	)
+
+	p.auditor.Record(ctx, models.AuditEntityAccess, "denied", action, nil, map[string]string{
+		"roles":    caller.Roles(),
+		"requires": requires,
+	})
+}
@@ -0,0 +1,194 @@
+package authz
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"parent-bot/internal/models"
+)
+
+// Rule is the requirement an action declares for its caller
+type Rule struct {
+	name       string
+	forParents bool // denial should point unregistered callers to /start
+	check      func(ctx context.Context, p *Policy, c *Caller, args Args) (bool, error)
+}
+
+// String returns the rule's name for logs
+func (r Rule) String() string {
+	return r.name
+}
+
+// Anyone allows every caller, including unregistered users
+var Anyone = Rule{
+	name: "anyone",
+	check: func(context.Context, *Policy, *Caller, Args) (bool, error) {
+		return true, nil
+	},
+}
+
+// Staff requires a member of staff, whatever their role
+var Staff = Rule{
+	name: "staff",
+	check: func(_ context.Context, _ *Policy, c *Caller, _ Args) (bool, error) {
+		return c.IsAdmin, nil
+	},
+}
+
+// AdminPanel requires a role that grants any permission of the admin panel
+var AdminPanel = Rule{
+	name: "admin_panel",
+	check: func(_ context.Context, _ *Policy, c *Caller, _ Args) (bool, error) {
+		return c.HasAdminPanel(), nil
+	},
+}
+
+// Can requires a role that grants the permission
+func Can(permission models.Permission) Rule {
+	return Rule{
+		name: string(permission),
+		check: func(_ context.Context, _ *Policy, c *Caller, _ Args) (bool, error) {
+			return c.Can(permission), nil
+		},
+	}
+}
+
+// TeacherCan requires an active teacher whose role grants the permission,
+// assigned to the class in the given parameter
+func TeacherCan(permission models.Permission, classParam string) Rule {
+	return AllOf(Can(permission), TeacherOfClass(classParam))
+}
+
+// Teacher requires an active teacher
+var Teacher = Rule{
+	name: "teacher",
+	check: func(_ context.Context, _ *Policy, c *Caller, _ Args) (bool, error) {
+		return c.IsTeacher(), nil
+	},
+}
+
+// Parent requires a registered parent
+var Parent = Rule{
+	name:       "parent",
+	forParents: true,
+	check: func(_ context.Context, _ *Policy, c *Caller, _ Args) (bool, error) {
+		return c.IsParent(), nil
+	},
+}
+
+// TeacherOfClass requires an active teacher assigned to the class in the given parameter
+func TeacherOfClass(param string) Rule {
+	return Rule{
+		name: "teacher of " + param,
+		check: func(ctx context.Context, p *Policy, c *Caller, args Args) (bool, error) {
+			if !c.IsTeacher() {
+				return false, nil
+			}
+			return p.teacherRepo.IsTeacherAssignedToClass(ctx, c.Teacher.ID, args.Int(param))
+		},
+	}
+}
+
+// TeacherOfStudent requires an active teacher assigned to the class of the student in the given parameter
+func TeacherOfStudent(param string) Rule {
+	return Rule{
+		name: "teacher of " + param,
+		check: func(ctx context.Context, p *Policy, c *Caller, args Args) (bool, error) {
+			if !c.IsTeacher() {
+				return false, nil
+			}
+
+			student, err := p.studentRepo.GetByID(ctx, args.Int(param))
+			if err == sql.ErrNoRows {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+
+			return p.teacherRepo.IsTeacherAssignedToClass(ctx, c.Teacher.ID, student.ClassID)
+		},
+	}
+}
+
+// ParentOfStudent requires a parent linked to the student in the given parameter
+func ParentOfStudent(param string) Rule {
+	return Rule{
+		name:       "parent of " + param,
+		forParents: true,
+		check: func(ctx context.Context, p *Policy, c *Caller, args Args) (bool, error) {
+			if !c.IsParent() {
+				return false, nil
+			}
+			return p.studentRepo.IsStudentLinkedToParent(ctx, c.User.ID, args.Int(param))
+		},
+	}
+}
+
+// AuthorOfAnnouncement requires the active teacher who posted the announcement in the given parameter
+func AuthorOfAnnouncement(param string) Rule {
+	return Rule{
+		name: "author of " + param,
+		check: func(ctx context.Context, p *Policy, c *Caller, args Args) (bool, error) {
+			if !c.IsTeacher() {
+				return false, nil
+			}
+
+			announcement, err := p.announcementRepo.GetByID(ctx, args.Int(param))
+			if err != nil || announcement == nil {
+				return false, err
+			}
+
+			return announcement.PostedByTeacherID != nil && *announcement.PostedByTeacherID == c.Teacher.ID, nil
+		},
+	}
+}
+
+// AnyOf allows the caller if any of the rules does
+func AnyOf(rules ...Rule) Rule {
+	names := make([]string, len(rules))
+	forParents := false
+	for i, rule := range rules {
+		names[i] = rule.name
+		forParents = forParents || rule.forParents
+	}
+
+	return Rule{
+		name:       strings.Join(names, " or "),
+		forParents: forParents,
+		check: func(ctx context.Context, p *Policy, c *Caller, args Args) (bool, error) {
+			for _, rule := range rules {
+				allowed, err := rule.check(ctx, p, c, args)
+				if err != nil || allowed {
+					return allowed, err
+				}
+			}
+			return false, nil
+		},
+	}
+}
+
+// AllOf allows the caller only if every rule does
+func AllOf(rules ...Rule) Rule {
+	names := make([]string, len(rules))
+	forParents := false
+	for i, rule := range rules {
+		names[i] = rule.name
+		forParents = forParents || rule.forParents
+	}
+
+	return Rule{
+		name:       strings.Join(names, " and "),
+		forParents: forParents,
+		check: func(ctx context.Context, p *Policy, c *Caller, args Args) (bool, error) {
+			for _, rule := range rules {
+				allowed, err := rule.check(ctx, p, c, args)
+				if err != nil || !allowed {
+					return false, err
+				}
+			}
+			return true, nil
+		},
+	}
+}
@@ -0,0 +1,474 @@
+// Package broadcast sends one message to all parents of a set of classes.
+//
+// Recipients are read page by page, so there is no cap on how many a
+// broadcast reaches, and queued in the notification outbox, which paces the
+// sends under Telegram's limits. The author follows the progress in a single
+// status message that is edited as notifications are delivered.
+//
+// A tracked broadcast records all of its recipients before queueing any, so
+// one stopped by a shutdown can be resumed from those records on Start.
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/models"
+	"parent-bot/internal/outbox"
+	"parent-bot/internal/repository"
+)
+
+const (
+	pageSize         = 500             // recipients read and queued at a time
+	progressInterval = 3 * time.Second // shortest gap between edits of the status message
+)
+
+// ErrRunning is returned by Send while a broadcast with the same key runs
+var ErrRunning = errors.New("broadcast already running")
+
+// Bot is the part of the Bot API used for the status message
+type Bot interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+// Recipients returns up to limit recipients with IDs above afterID, ordered by ID
+type Recipients func(ctx context.Context, afterID, limit int) ([]*models.User, error)
+
+// Broadcast is a message for the parents of some classes
+type Broadcast struct {
+	Ref       string // shared by the broadcast's notifications, e.g. "announcement:42"
+	Key       string // only one broadcast with a key runs at a time; defaults to Ref
+	Kind      string // notification kind
+	ClassIDs  []int
+	Text      string // HTML; the caption when FileID is set
+	FileID    string
+	MediaType string
+
+	// Recipients replaces the parents of ClassIDs as the recipients; optional
+	Recipients Recipients
+
+	// Markup returns the keyboard to attach for a recipient; optional
+	Markup func(ctx context.Context, user *models.User) any
+
+	// Track records a page of recipients before it is queued; optional. The
+	// broadcast stops if it fails.
+	Track func(ctx context.Context, users []*models.User) error
+
+	// Pending returns the recorded recipients not queued yet; optional. When
+	// set, recipients are queued from Pending, and with Track set, all of
+	// them are recorded before the first is queued.
+	Pending Recipients
+
+	// Queued records that a page of recipients is in the outbox, so they
+	// drop out of Pending; optional
+	Queued func(ctx context.Context, users []*models.User) error
+
+	// AuthorChatID gets the progress message; 0 sends none
+	AuthorChatID int64
+}
+
+// Broadcaster runs broadcasts in the background
+type Broadcaster struct {
+	users         *repository.UserRepository
+	notifications *repository.NotificationRepository
+	broadcasts    *repository.BroadcastRepository
+	outbox        *outbox.Outbox
+	bot           Bot
+	logger        *slog.Logger
+
+	mu      sync.Mutex
+	ctx     context.Context // cancelled by Stop
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running map[string]bool // keys of running broadcasts
+	resume  func(ctx context.Context) ([]*Broadcast, error)
+}
+
+// New creates a broadcaster queueing messages in ob
+func New(users *repository.UserRepository, notifications *repository.NotificationRepository, broadcasts *repository.BroadcastRepository, ob *outbox.Outbox, bot Bot, logger *slog.Logger) *Broadcaster {
+	return &Broadcaster{
+		users:         users,
+		notifications: notifications,
+		broadcasts:    broadcasts,
+		outbox:        ob,
+		bot:           bot,
+		logger:        logger.With("component", "broadcast"),
+		running:       make(map[string]bool),
+	}
+}
+
+// SetResume sets how Start finds the broadcasts a previous run stopped
+// before queueing every recipient. It must be called before Start.
+func (b *Broadcaster) SetResume(resume func(ctx context.Context) ([]*Broadcast, error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.resume = resume
+}
+
+// Start lets broadcasts run until ctx is cancelled or Stop is called, and
+// resumes the broadcasts a previous run stopped
+func (b *Broadcaster) Start(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ctx != nil {
+		return fmt.Errorf("broadcaster already started")
+	}
+	b.ctx, b.cancel = context.WithCancel(ctx)
+
+	if b.resume == nil {
+		return nil
+	}
+
+	resumed, err := b.resume(b.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get broadcasts to resume: %w", err)
+	}
+	for _, bc := range resumed {
+		b.logger.Info("resuming broadcast", "ref", bc.Ref)
+		if err := b.start(bc); err != nil {
+			b.logger.Warn("broadcast not resumed", "ref", bc.Ref, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// Stop stops running broadcasts and waits for them, or for ctx to expire.
+// Recipients already queued still get the message from the outbox. The rest
+// of an interrupted broadcast is queued on the next Start if it has Pending,
+// and not at all otherwise.
+func (b *Broadcaster) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	cancel := b.cancel
+	b.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("broadcast: still running at shutdown: %w", ctx.Err())
+	}
+}
+
+// Send starts a broadcast in the background, or returns ErrRunning if one
+// with the same key is still running
+func (b *Broadcaster) Send(bc *Broadcast) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ctx == nil {
+		return fmt.Errorf("broadcaster not started")
+	}
+	if b.ctx.Err() != nil {
+		return fmt.Errorf("broadcaster stopped")
+	}
+
+	return b.start(bc)
+}
+
+// start runs a broadcast unless one with the same key is running; b.mu must be held
+func (b *Broadcaster) start(bc *Broadcast) error {
+	key := bc.Key
+	if key == "" {
+		key = bc.Ref
+	}
+	if b.running[key] {
+		return ErrRunning
+	}
+	b.running[key] = true
+
+	b.wg.Add(1)
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			delete(b.running, key)
+			b.mu.Unlock()
+		}()
+		b.run(bc)
+	}()
+
+	return nil
+}
+
+// run records and queues the broadcast for every recipient, then reports
+// progress until nothing is pending
+func (b *Broadcaster) run(bc *Broadcast) {
+	defer b.wg.Done()
+
+	ctx := b.ctx
+	logger := b.logger.With("ref", bc.Ref)
+	p := b.newProgress(bc.AuthorChatID, logger)
+
+	recipients := bc.Recipients
+	if recipients == nil {
+		recipients = func(ctx context.Context, afterID, limit int) ([]*models.User, error) {
+			return b.users.GetParentsByClassIDs(ctx, bc.ClassIDs, afterID, limit)
+		}
+	}
+
+	if bc.Pending != nil {
+		if bc.Track != nil {
+			// Recording is finished even when stopping, so that the resumed
+			// broadcast reaches everyone this one would have
+			if err := b.track(context.WithoutCancel(ctx), bc, recipients); err != nil {
+				logger.Error("failed to track broadcast recipients", "error", err)
+				p.fail()
+				return
+			}
+		}
+		recipients = bc.Pending
+	}
+
+	total, skipped := 0, 0
+	afterID := 0
+	for {
+		users, err := recipients(ctx, afterID, pageSize)
+		if err != nil {
+			logger.Error("failed to get broadcast recipients", "queued", total, "error", err)
+			p.fail()
+			return
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		if bc.Track != nil && bc.Pending == nil {
+			if err := bc.Track(ctx, users); err != nil {
+				logger.Error("failed to track broadcast recipients", "queued", total, "error", err)
+				p.fail()
+				return
+			}
+		}
+
+		notifications := make([]*models.Notification, 0, len(users))
+		for _, user := range users {
+			n := &models.Notification{
+				ChatID:    user.TelegramID,
+				Kind:      bc.Kind,
+				Text:      bc.Text,
+				FileID:    bc.FileID,
+				MediaType: bc.MediaType,
+				Ref:       bc.Ref,
+				Bulk:      true,
+			}
+			if bc.Markup != nil {
+				if err := n.SetReplyMarkup(bc.Markup(ctx, user)); err != nil {
+					logger.Warn("failed to attach broadcast keyboard", "user_id", user.ID, "error", err)
+				}
+			}
+			notifications = append(notifications, n)
+		}
+
+		if err := b.outbox.Enqueue(ctx, notifications...); err != nil {
+			logger.Error("failed to queue broadcast", "queued", total, "error", err)
+			p.fail()
+			return
+		}
+		if bc.Queued != nil {
+			// The page is in the outbox even if stopping now; not recording
+			// it would send it twice once resumed
+			if err := bc.Queued(context.WithoutCancel(ctx), users); err != nil {
+				logger.Error("failed to record queued broadcast recipients", "queued", total, "error", err)
+				p.fail()
+				return
+			}
+		}
+		pageSkipped := 0
+		for _, n := range notifications {
+			if n.Status == models.NotificationUnreachable {
+				pageSkipped++
+			}
+		}
+		if pageSkipped > 0 {
+			// Skipped recipients are not in the outbox, so a resumed
+			// broadcast only knows of them from this record
+			if err := b.broadcasts.AddSkipped(context.WithoutCancel(ctx), bc.Ref, pageSkipped); err != nil {
+				logger.Warn("failed to record skipped broadcast recipients", "skipped", pageSkipped, "error", err)
+			}
+		}
+		skipped += pageSkipped
+		total += len(users)
+		afterID = users[len(users)-1].ID
+
+		p.update(total, skipped, nil, false)
+		if len(users) < pageSize {
+			break
+		}
+	}
+
+	logger.Info("broadcast queued", "recipients", total, "skipped", skipped)
+
+	// Counted across the ref from here on, like sent and failed, so a
+	// resumed broadcast includes the pages queued before the restart
+	if recorded, err := b.broadcasts.Skipped(ctx, bc.Ref); err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("failed to get skipped broadcast recipients", "error", err)
+		}
+	} else {
+		skipped = max(recorded, skipped)
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		counts, err := b.notifications.CountByStatus(ctx, bc.Ref)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("failed to count broadcast progress", "error", err)
+			}
+		} else {
+			everyone := skipped
+			for _, n := range counts {
+				everyone += n
+			}
+
+			done := counts[models.NotificationPending] == 0
+			p.update(everyone, skipped, counts, done)
+			if done {
+				logger.Info("broadcast delivered",
+					"recipients", everyone,
+					"sent", counts[models.NotificationSent],
+					"failed", counts[models.NotificationFailed],
+					"unreachable", counts[models.NotificationUnreachable]+skipped)
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// track records every recipient of a broadcast with its Track
+func (b *Broadcaster) track(ctx context.Context, bc *Broadcast, recipients Recipients) error {
+	afterID := 0
+	for {
+		users, err := recipients(ctx, afterID, pageSize)
+		if err != nil {
+			return fmt.Errorf("failed to get recipients: %w", err)
+		}
+		if len(users) == 0 {
+			return nil
+		}
+
+		if err := bc.Track(ctx, users); err != nil {
+			return err
+		}
+
+		afterID = users[len(users)-1].ID
+		if len(users) < pageSize {
+			return nil
+		}
+	}
+}
+
+// progress is the status message shown to the author of a broadcast
+type progress struct {
+	bot       Bot
+	logger    *slog.Logger
+	chatID    int64
+	messageID int // 0 until the message is sent
+	text      string
+	editedAt  time.Time
+}
+
+// newProgress sends the initial status message to chatID, if any
+func (b *Broadcaster) newProgress(chatID int64, logger *slog.Logger) *progress {
+	p := &progress{bot: b.bot, logger: logger, chatID: chatID}
+	if chatID == 0 {
+		return p
+	}
+
+	p.text = "📤 <b>E'lon yuborilmoqda... / Объявление отправляется...</b>"
+	msg := tgbotapi.NewMessage(chatID, p.text)
+	msg.ParseMode = tgbotapi.ModeHTML
+
+	sent, err := p.bot.Send(msg)
+	if err != nil {
+		logger.Warn("failed to send broadcast status", "error", err)
+		return p
+	}
+	p.messageID = sent.MessageID
+	p.editedAt = time.Now()
+
+	return p
+}
+
+// update shows the current counts; counts is nil while recipients are still
+// being queued. Edits closer than progressInterval are skipped unless done.
+func (p *progress) update(total, skipped int, counts map[string]int, done bool) {
+	if !done && time.Since(p.editedAt) < progressInterval {
+		return
+	}
+
+	var text string
+	switch {
+	case done && total == 0:
+		text = "ℹ️ <b>E'lon uchun qabul qiluvchilar topilmadi / Получатели объявления не найдены</b>"
+	case done:
+		text = "✅ <b>E'lon yuborildi / Объявление отправлено</b>"
+	default:
+		text = "📤 <b>E'lon yuborilmoqda... / Объявление отправляется...</b>"
+	}
+
+	if total > 0 {
+		text += fmt.Sprintf("\n\n👥 Qabul qiluvchilar / Получатели: %d", total)
+		if counts != nil {
+			text += fmt.Sprintf("\n✅ Yuborildi / Отправлено: %d", counts[models.NotificationSent])
+			if pending := counts[models.NotificationPending]; pending > 0 {
+				text += fmt.Sprintf("\n⏳ Navbatda / В очереди: %d", pending)
+			}
+			if failed := counts[models.NotificationFailed]; failed > 0 {
+				text += fmt.Sprintf("\n❌ Xatolik / Ошибки: %d", failed)
+			}
+		}
+		if blocked := skipped + counts[models.NotificationUnreachable]; blocked > 0 {
+			text += fmt.Sprintf("\n🚫 Botni bloklagan / Заблокировали бота: %d", blocked)
+		}
+	}
+
+	p.show(text)
+}
+
+// fail tells the author the broadcast stopped before everyone was queued
+func (p *progress) fail() {
+	p.show(p.text + "\n\n❌ Yuborish to'xtatildi, xatolik yuz berdi / Отправка прервана из-за ошибки")
+}
+
+// show edits the status message to text, if it changed
+func (p *progress) show(text string) {
+	if p.messageID == 0 || text == p.text {
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(p.chatID, p.messageID, text)
+	edit.ParseMode = tgbotapi.ModeHTML
+	if _, err := p.bot.Send(edit); err != nil {
+		p.logger.Warn("failed to update broadcast status", "error", err)
+		return
+	}
+	p.text = text
+	p.editedAt = time.Now()
+}
@@ -0,0 +1,291 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
+)
+
+// Dispatch errors, returned so the caller can answer the callback query
+var (
+	ErrUnknown   = errors.New("unknown callback")
+	ErrMalformed = errors.New("malformed callback payload")
+	ErrForbidden = authz.ErrDenied
+)
+
+// Handler handles a callback whose payload matched a route
+type Handler func(ctx context.Context, query *tgbotapi.CallbackQuery, params Params) error
+
+// Params holds the typed values parsed from a callback payload
+type Params struct {
+	ints    map[string]int
+	strings map[string]string
+}
+
+// Int returns an {name:int} parameter
+func (p Params) Int(name string) int {
+	return p.ints[name]
+}
+
+// String returns a {name} parameter
+func (p Params) String(name string) string {
+	return p.strings[name]
+}
+
+// param describes one placeholder in a route pattern
+type param struct {
+	name  string
+	isInt bool
+}
+
+// route is a compiled route pattern
+type route struct {
+	pattern string
+	prefix  string // literal text before the first placeholder
+	literal int    // total literal length, used to prefer the most specific match
+	re      *regexp.Regexp
+	params  []param
+	rule    authz.Rule
+	handler Handler
+}
+
+// placeholder matches {name} and {name:int} in route patterns
+var placeholder = regexp.MustCompile(`\{([a-z_]+)(?::(int|str))?\}`)
+
+// Stats counts dispatch outcomes
+type Stats struct {
+	Dispatched uint64 `json:"dispatched"`
+	Failed     uint64 `json:"failed"`
+	Unknown    uint64 `json:"unknown"`
+	Malformed  uint64 `json:"malformed"`
+	Denied     uint64 `json:"denied"`
+}
+
+// Router dispatches callback queries to handlers registered by pattern.
+//
+// Patterns are literal text with typed placeholders, e.g.
+// "admin_delete_student_{class_id:int}_{student_id:int}" or
+// "select_class_{class_name}". A payload must match a pattern in full; when
+// several match, the one with the most literal text wins, then the one with
+// the longer literal prefix, then the one with fewer parameters. Remaining
+// ties are broken by pattern, so registration order does not matter.
+type Router struct {
+	routes []*route
+	policy *authz.Policy
+
+	dispatched atomic.Uint64
+	failed     atomic.Uint64
+	unknown    atomic.Uint64
+	malformed  atomic.Uint64
+	denied     atomic.Uint64
+}
+
+// NewRouter creates a router that checks routes against policy
+func NewRouter(policy *authz.Policy) *Router {
+	return &Router{policy: policy}
+}
+
+// Handle registers a handler for a pattern. Callers failing rule are
+// rejected before the handler runs. It panics on an invalid or duplicate
+// pattern, since routes are registered at startup.
+func (r *Router) Handle(pattern string, rule authz.Rule, handler Handler) {
+	rt, err := compile(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("callback: %v", err))
+	}
+
+	for _, existing := range r.routes {
+		if existing.pattern == pattern {
+			panic(fmt.Sprintf("callback: duplicate route %q", pattern))
+		}
+	}
+
+	rt.rule = rule
+	rt.handler = handler
+	r.routes = append(r.routes, rt)
+}
+
+// Dispatch parses the query's payload, checks the caller against the
+// route's rule and runs the matching handler. It returns ErrUnknown,
+// ErrMalformed or ErrForbidden when the query is not dispatched, or the
+// handler's error. On ErrForbidden the returned rule is the one that failed.
+func (r *Router) Dispatch(ctx context.Context, caller *authz.Caller, query *tgbotapi.CallbackQuery) (authz.Rule, error) {
+	data := query.Data
+
+	rt, params, err := r.match(data)
+	if err != nil {
+		if errors.Is(err, ErrMalformed) {
+			r.malformed.Add(1)
+		} else {
+			r.unknown.Add(1)
+		}
+		return authz.Rule{}, err
+	}
+
+	if err := r.policy.Authorize(ctx, caller, rt.pattern, rt.rule, params); err != nil {
+		if errors.Is(err, authz.ErrDenied) {
+			r.denied.Add(1)
+		} else {
+			r.failed.Add(1)
+		}
+		return rt.rule, err
+	}
+
+	r.dispatched.Add(1)
+	if err := rt.handler(ctx, query, params); err != nil {
+		r.failed.Add(1)
+		return rt.rule, err
+	}
+
+	return rt.rule, nil
+}
+
+// Route returns the pattern a payload would be dispatched to, or "" if none matches
+func (r *Router) Route(data string) string {
+	rt, _, err := r.match(data)
+	if err != nil {
+		return ""
+	}
+	return rt.pattern
+}
+
+// Stats returns a snapshot of the dispatch counters
+func (r *Router) Stats() Stats {
+	return Stats{
+		Dispatched: r.dispatched.Load(),
+		Failed:     r.failed.Load(),
+		Unknown:    r.unknown.Load(),
+		Malformed:  r.malformed.Load(),
+		Denied:     r.denied.Load(),
+	}
+}
+
+// match finds the most specific route for a payload
+func (r *Router) match(data string) (*route, Params, error) {
+	var best *route
+	var bestValues []string
+	prefixMatched := false
+
+	for _, rt := range r.routes {
+		values := rt.re.FindStringSubmatch(data)
+		if values == nil {
+			if len(rt.params) > 0 && strings.HasPrefix(data, rt.prefix) {
+				prefixMatched = true
+			}
+			continue
+		}
+
+		if best == nil || rt.moreSpecific(best) {
+			best, bestValues = rt, values[1:]
+		}
+	}
+
+	if best == nil {
+		if prefixMatched {
+			return nil, Params{}, ErrMalformed
+		}
+		return nil, Params{}, ErrUnknown
+	}
+
+	params, err := best.parse(bestValues)
+	if err != nil {
+		return nil, Params{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	return best, params, nil
+}
+
+// moreSpecific reports whether rt wins over other when both match a payload
+func (rt *route) moreSpecific(other *route) bool {
+	if rt.literal != other.literal {
+		return rt.literal > other.literal
+	}
+	if len(rt.prefix) != len(other.prefix) {
+		return len(rt.prefix) > len(other.prefix)
+	}
+	if len(rt.params) != len(other.params) {
+		return len(rt.params) < len(other.params)
+	}
+	return rt.pattern < other.pattern
+}
+
+// parse converts matched placeholder values to typed params
+func (rt *route) parse(values []string) (Params, error) {
+	params := Params{ints: map[string]int{}, strings: map[string]string{}}
+
+	for i, p := range rt.params {
+		if !p.isInt {
+			params.strings[p.name] = values[i]
+			continue
+		}
+
+		n, err := strconv.Atoi(values[i])
+		if err != nil {
+			return Params{}, fmt.Errorf("%s: %w", p.name, err)
+		}
+		params.ints[p.name] = n
+	}
+
+	return params, nil
+}
+
+// compile turns a route pattern into an anchored regular expression
+func compile(pattern string) (*route, error) {
+	rt := &route{pattern: pattern}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+
+	last := 0
+	for _, loc := range placeholder.FindAllStringSubmatchIndex(pattern, -1) {
+		literal := pattern[last:loc[0]]
+		if len(rt.params) == 0 {
+			rt.prefix = literal
+		}
+		rt.literal += len(literal)
+		expr.WriteString(regexp.QuoteMeta(literal))
+
+		p := param{name: pattern[loc[2]:loc[3]]}
+		p.isInt = loc[4] >= 0 && pattern[loc[4]:loc[5]] == "int"
+		for _, existing := range rt.params {
+			if existing.name == p.name {
+				return nil, fmt.Errorf("duplicate parameter %q in %q", p.name, pattern)
+			}
+		}
+		rt.params = append(rt.params, p)
+
+		if p.isInt {
+			expr.WriteString(`(-?\d+)`)
+		} else {
+			expr.WriteString(`(.+)`)
+		}
+		last = loc[1]
+	}
+
+	tail := pattern[last:]
+	if len(rt.params) == 0 {
+		rt.prefix = tail
+	}
+	rt.literal += len(tail)
+	expr.WriteString(regexp.QuoteMeta(tail))
+	expr.WriteString("$")
+
+	if strings.ContainsAny(placeholder.ReplaceAllString(pattern, ""), "{}") {
+		return nil, fmt.Errorf("invalid placeholder in %q", pattern)
+	}
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	rt.re = re
+
+	return rt, nil
+}
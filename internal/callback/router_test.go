@@ -0,0 +1,178 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
+)
+
+// denials counts the denials a policy records
+type denials struct {
+	actions []string
+}
+
+func (d *denials) Record(_ context.Context, _, _ string, entityID any, _, _ any) {
+	d.actions = append(d.actions, entityID.(string))
+}
+
+// patterns mirror routes whose prefixes overlap in the bot
+var patterns = []string{
+	"view_child_{student_id:int}",
+	"view_child_attendance_{student_id:int}",
+	"view_child_grades_{student_id:int}",
+	"view_grades_class_{class_id:int}",
+	"admin_delete_student_{class_id:int}_{student_id:int}",
+	"select_class_{class_name}",
+	"class_{class_name}",
+	"x_{a}_y",
+	"x_y_{a}",
+	"lang_uz",
+}
+
+// newRouter registers patterns in the given order. Each handler records the
+// pattern it was registered for and the params it received.
+func newRouter(order []string, auditor authz.Auditor) (*Router, *string, *Params) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r := NewRouter(authz.NewPolicy(nil, nil, nil, nil, nil, nil, auditor, logger))
+
+	var handled string
+	var got Params
+	for _, pattern := range order {
+		r.Handle(pattern, authz.Anyone, func(_ context.Context, _ *tgbotapi.CallbackQuery, p Params) error {
+			handled, got = pattern, p
+			return nil
+		})
+	}
+	return r, &handled, &got
+}
+
+func dispatch(r *Router, caller *authz.Caller, data string) (authz.Rule, error) {
+	query := &tgbotapi.CallbackQuery{ID: "1", From: &tgbotapi.User{ID: caller.TelegramID}, Data: data}
+	return r.Dispatch(context.Background(), caller, query)
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    string // pattern dispatched to
+		ints    map[string]int
+		strs    map[string]string
+		wantErr error
+	}{
+		{data: "view_child_12", want: "view_child_{student_id:int}", ints: map[string]int{"student_id": 12}},
+		{data: "view_child_attendance_12", want: "view_child_attendance_{student_id:int}", ints: map[string]int{"student_id": 12}},
+		{data: "view_child_grades_5", want: "view_child_grades_{student_id:int}", ints: map[string]int{"student_id": 5}},
+		{data: "view_grades_class_7", want: "view_grades_class_{class_id:int}", ints: map[string]int{"class_id": 7}},
+		{data: "view_grades_class_17", want: "view_grades_class_{class_id:int}", ints: map[string]int{"class_id": 17}},
+		{data: "admin_delete_student_3_45", want: "admin_delete_student_{class_id:int}_{student_id:int}", ints: map[string]int{"class_id": 3, "student_id": 45}},
+		{data: "select_class_9A", want: "select_class_{class_name}", strs: map[string]string{"class_name": "9A"}},
+		{data: "class_9A", want: "class_{class_name}", strs: map[string]string{"class_name": "9A"}},
+		{data: "x_y_y", want: "x_y_{a}", strs: map[string]string{"a": "y"}},
+		{data: "lang_uz", want: "lang_uz"},
+		{data: "view_child_abc", wantErr: ErrMalformed},
+		{data: "view_grades_class_", wantErr: ErrMalformed},
+		{data: "view_child_99999999999999999999", wantErr: ErrMalformed},
+		{data: "admin_delete_student_3_x", wantErr: ErrMalformed},
+		{data: "lang_de", wantErr: ErrUnknown},
+		{data: "", wantErr: ErrUnknown},
+	}
+
+	reversed := make([]string, len(patterns))
+	for i, p := range patterns {
+		reversed[len(patterns)-1-i] = p
+	}
+
+	// Registration order must not change the outcome
+	for name, order := range map[string][]string{"in order": patterns, "reversed": reversed} {
+		t.Run(name, func(t *testing.T) {
+			for _, tt := range tests {
+				r, handled, got := newRouter(order, &denials{})
+
+				_, err := dispatch(r, &authz.Caller{TelegramID: 1}, tt.data)
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("%q: error = %v, want %v", tt.data, err, tt.wantErr)
+					continue
+				}
+				if *handled != tt.want {
+					t.Errorf("%q: dispatched to %q, want %q", tt.data, *handled, tt.want)
+				}
+				for name, want := range tt.ints {
+					if v := got.Int(name); v != want {
+						t.Errorf("%q: %s = %d, want %d", tt.data, name, v, want)
+					}
+				}
+				for name, want := range tt.strs {
+					if v := got.String(name); v != want {
+						t.Errorf("%q: %s = %q, want %q", tt.data, name, v, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDispatchDenied(t *testing.T) {
+	audit := &denials{}
+	r, handled, _ := newRouter(nil, audit)
+	r.Handle("admin_users", authz.Staff, func(context.Context, *tgbotapi.CallbackQuery, Params) error {
+		*handled = "admin_users"
+		return nil
+	})
+
+	rule, err := dispatch(r, &authz.Caller{TelegramID: 1}, "admin_users")
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("error = %v, want %v", err, ErrForbidden)
+	}
+	if rule.String() != authz.Staff.String() {
+		t.Errorf("failed rule = %s, want %s", rule, authz.Staff)
+	}
+	if *handled != "" {
+		t.Error("handler ran for a denied caller")
+	}
+	if len(audit.actions) != 1 || audit.actions[0] != "admin_users" {
+		t.Errorf("audited denials = %v, want admin_users", audit.actions)
+	}
+
+	if _, err := dispatch(r, &authz.Caller{TelegramID: 2, IsAdmin: true}, "admin_users"); err != nil {
+		t.Fatalf("staff: %v", err)
+	}
+	if *handled != "admin_users" {
+		t.Error("handler did not run for staff")
+	}
+}
+
+func TestStats(t *testing.T) {
+	r, _, _ := newRouter(patterns, &denials{})
+	r.Handle("admin_users", authz.Staff, func(context.Context, *tgbotapi.CallbackQuery, Params) error {
+		return nil
+	})
+	r.Handle("fails", authz.Anyone, func(context.Context, *tgbotapi.CallbackQuery, Params) error {
+		return errors.New("boom")
+	})
+
+	caller := &authz.Caller{TelegramID: 1}
+	for _, data := range []string{"lang_uz", "view_child_x", "nope", "admin_users", "fails"} {
+		_, _ = dispatch(r, caller, data)
+	}
+
+	want := Stats{Dispatched: 2, Failed: 1, Unknown: 1, Malformed: 1, Denied: 1}
+	if got := r.Stats(); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandlePanicsOnDuplicate(t *testing.T) {
+	r, _, _ := newRouter([]string{"lang_uz"}, &denials{})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a pattern twice did not panic")
+		}
+	}()
+	r.Handle("lang_uz", authz.Anyone, func(context.Context, *tgbotapi.CallbackQuery, Params) error { return nil })
+}
@@ -1,29 +1,56 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/robfig/cron/v3"
 )
 
 type Config struct {
-	Bot       BotConfig
-	Database  DatabaseConfig
-	Server    ServerConfig
-	Admin     AdminConfig
-	RateLimit RateLimitConfig
+	File          string // config file the values were read from; empty if none
+	Bot           BotConfig
+	Database      DatabaseConfig
+	Server        ServerConfig
+	Admin         AdminConfig
+	RateLimit     RateLimitConfig
+	Updates       UpdatesConfig
+	Log           LogConfig
+	Metrics       MetricsConfig
+	School        SchoolConfig
+	Documents     DocumentsConfig
+	Notifications NotificationsConfig
+	Outbox        OutboxConfig
+	Scheduler     SchedulerConfig
+	Backup        BackupConfig
+
+	envErrors []error // invalid environment variable values, reported by Validate
 }
 
 type BotConfig struct {
-	Token      string
-	WebhookURL string
+	Token         string
+	WebhookURL    string
+	WebhookSecret string // Sent by Telegram in X-Telegram-Bot-Api-Secret-Token; random per start if empty
+	APIEndpoint   string // Bot API URL format (token, method); empty means api.telegram.org
 }
 
+// Database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
 type DatabaseConfig struct {
-	Path string // Path to SQLite database file
+	Driver       string // DriverSQLite or DriverPostgres
+	Path         string // Path to SQLite database file
+	URL          string // PostgreSQL connection string
+	MaxOpenConns int    // PostgreSQL connection pool size; SQLite always uses one connection
 }
 
 type ServerConfig struct {
@@ -33,61 +60,362 @@ type ServerConfig struct {
 
 type AdminConfig struct {
 	PhoneNumbers []string
+	MaxAdmins    int    // upper bound on PhoneNumbers
+	APISecret    string // HMAC key for admin API tokens; empty disables /api/admin
 }
 
 type RateLimitConfig struct {
-	Requests int
-	Duration time.Duration
+	Requests        int // Requests per Duration for parents and unregistered users (0 disables)
+	Duration        time.Duration
+	TeacherRequests int  // Requests per Duration for teachers and other staff (0 disables)
+	ExemptAdmins    bool // The admin and super_admin roles are never throttled
+}
+
+// UpdatesConfig controls how incoming Telegram updates are processed
+type UpdatesConfig struct {
+	Workers         int           // Number of update worker goroutines
+	QueueSize       int           // Buffered updates per worker before senders block
+	ShutdownTimeout time.Duration // How long to wait for in-flight updates on shutdown
+	HandlerTimeout  time.Duration // Deadline for the database work of one update
+	FlowTTL         time.Duration // Unfinished conversation flows expire this long after their last step
+	StateCacheSize  int           // Most conversation states kept in memory
+	StateCacheTTL   time.Duration // Cached states are read again from the database after this long
+}
+
+// LogConfig controls structured logging
+type LogConfig struct {
+	Level  string // debug, info, warn or error
+	Format string // text or json
 }
 
-// Load loads configuration from environment variables
+// MetricsConfig controls the Prometheus endpoint
+type MetricsConfig struct {
+	Addr string // Private listen address for /metrics, unauthenticated; empty disables. Webhook mode also serves /api/admin/metrics
+}
+
+// SchoolConfig describes the school the bot serves
+type SchoolConfig struct {
+	Timezone string // IANA timezone for "today" in attendance and for job schedules
+}
+
+// DocumentsConfig controls generated documents
+type DocumentsConfig struct {
+	TempDir string // where generated DOCX files are written before sending
+}
+
+// NotificationsConfig controls messages the bot sends on its own
+type NotificationsConfig struct {
+	AdminAttendanceReports bool // tell admins when a class's attendance is taken
+	ParentAbsenceAlerts    bool // tell parents when their child is marked absent
+	ParentGradeAlerts      bool // tell parents about new test results
+}
+
+// OutboxConfig controls delivery of queued notifications
+type OutboxConfig struct {
+	MaxAttempts     int           // failed sends tried before a notification is given up
+	RetryBackoff    time.Duration // wait before the first retry; doubled for each further one
+	MaxBackoff      time.Duration // longest wait between retries
+	Retention       time.Duration // delivered and abandoned notifications older than this are removed
+	CleanupSchedule string        // cron expression for removing old notifications
+	Rate            int           // messages sent per second across all chats; Telegram allows about 30
+	ChatInterval    time.Duration // shortest gap between two messages to one chat; Telegram allows about 1s
+}
+
+// SchedulerConfig controls background jobs
+type SchedulerConfig struct {
+	StateCleanupSchedule string        // cron expression for removing stale conversation states
+	StateRetention       time.Duration // conversation states untouched for longer are removed
+	TempCleanupSchedule  string        // cron expression for removing old generated documents
+	TempFileRetention    time.Duration // generated documents older than this are removed
+}
+
+// BackupConfig controls scheduled SQLite backups
+type BackupConfig struct {
+	Dir          string        // where snapshots are written
+	Schedule     string        // cron expression for scheduled backups; empty disables them
+	Retention    time.Duration // local snapshots older than this are removed; 0 keeps all
+	SendToAdmins bool          // send each scheduled snapshot to admins as a document
+}
+
+// Load loads configuration from the config file (see FilePath), if any,
+// with environment variables and .env layered on top
 func Load() (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load(".env")
 
-	cfg := &Config{
-		Bot: BotConfig{
-			Token:      getEnv("BOT_TOKEN", ""),
-			WebhookURL: getEnv("WEBHOOK_URL", ""),
-		},
+	return LoadFile(FilePath())
+}
+
+// LoadFile loads configuration from path ("" for none) with environment
+// variables layered on top, and validates it
+func LoadFile(path string) (*Config, error) {
+	cfg := Defaults()
+
+	if path != "" {
+		file, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file.apply(cfg)
+		cfg.File = path
+	}
+
+	cfg.applyEnv()
+
+	// Debug output is only on by default outside production
+	if cfg.Log.Level == "" {
+		cfg.Log.Level = "debug"
+		if cfg.Server.GinMode == "release" {
+			cfg.Log.Level = "info"
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Defaults returns the configuration used for keys set neither in the file nor the environment
+func Defaults() *Config {
+	return &Config{
 		Database: DatabaseConfig{
-			Path: getEnv("DB_PATH", "parent_bot.db"),
+			Driver:       DriverSQLite,
+			Path:         "parent_bot.db",
+			MaxOpenConns: 10,
 		},
 		Server: ServerConfig{
-			Port:    getEnv("SERVER_PORT", "8080"),
-			GinMode: getEnv("GIN_MODE", "debug"),
+			Port:    "8080",
+			GinMode: "debug",
 		},
 		Admin: AdminConfig{
-			PhoneNumbers: parseAdminPhones(getEnv("ADMIN_PHONES", "")),
+			PhoneNumbers: []string{},
+			MaxAdmins:    3,
 		},
 		RateLimit: RateLimitConfig{
-			Requests: 20,
-			Duration: 60 * time.Second,
+			Requests:        20,
+			Duration:        60 * time.Second,
+			TeacherRequests: 60,
+			ExemptAdmins:    true,
+		},
+		Updates: UpdatesConfig{
+			Workers:         8,
+			QueueSize:       100,
+			ShutdownTimeout: 30 * time.Second,
+			HandlerTimeout:  30 * time.Second,
+			FlowTTL:         30 * time.Minute,
+			StateCacheSize:  10000,
+			StateCacheTTL:   time.Minute,
+		},
+		Log: LogConfig{
+			Format: "text",
+		},
+		School: SchoolConfig{
+			Timezone: "Asia/Tashkent",
+		},
+		Documents: DocumentsConfig{
+			TempDir: "./temp_docs",
+		},
+		Notifications: NotificationsConfig{
+			AdminAttendanceReports: true,
+			ParentAbsenceAlerts:    true,
+			ParentGradeAlerts:      true,
+		},
+		Outbox: OutboxConfig{
+			MaxAttempts:     8,
+			RetryBackoff:    5 * time.Second,
+			MaxBackoff:      30 * time.Minute,
+			Retention:       30 * 24 * time.Hour,
+			CleanupSchedule: "45 3 * * *",
+			Rate:            25,
+			ChatInterval:    time.Second,
+		},
+		Scheduler: SchedulerConfig{
+			StateCleanupSchedule: "30 3 * * *",
+			StateRetention:       48 * time.Hour,
+			TempCleanupSchedule:  "0 * * * *",
+			TempFileRetention:    6 * time.Hour,
+		},
+		Backup: BackupConfig{
+			Dir:          "./backups",
+			Retention:    7 * 24 * time.Hour,
+			SendToAdmins: true,
 		},
 	}
+}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, err
+// applyEnv overrides cfg with the environment variables that are set
+func (c *Config) applyEnv() {
+	c.Bot.Token = getEnv("BOT_TOKEN", c.Bot.Token)
+	c.Bot.WebhookURL = getEnv("WEBHOOK_URL", c.Bot.WebhookURL)
+	c.Bot.WebhookSecret = getEnv("WEBHOOK_SECRET", c.Bot.WebhookSecret)
+	c.Bot.APIEndpoint = getEnv("TELEGRAM_API_ENDPOINT", c.Bot.APIEndpoint)
+
+	c.Database.Driver = getEnv("DB_DRIVER", c.Database.Driver)
+	c.Database.Path = getEnv("DB_PATH", c.Database.Path)
+	c.Database.URL = getEnv("DATABASE_URL", c.Database.URL)
+	c.Database.MaxOpenConns = c.envInt("DB_MAX_OPEN_CONNS", c.Database.MaxOpenConns)
+
+	c.Server.Port = getEnv("SERVER_PORT", c.Server.Port)
+	c.Server.GinMode = getEnv("GIN_MODE", c.Server.GinMode)
+
+	if phones := os.Getenv("ADMIN_PHONES"); phones != "" {
+		c.Admin.PhoneNumbers = parseAdminPhones(phones)
 	}
+	c.Admin.MaxAdmins = c.envInt("MAX_ADMINS", c.Admin.MaxAdmins)
+	c.Admin.APISecret = getEnv("ADMIN_API_SECRET", c.Admin.APISecret)
 
-	return cfg, nil
+	c.RateLimit.Requests = c.envInt("RATE_LIMIT_REQUESTS", c.RateLimit.Requests)
+	c.RateLimit.Duration = c.envDuration("RATE_LIMIT_DURATION", c.RateLimit.Duration)
+	c.RateLimit.TeacherRequests = c.envInt("RATE_LIMIT_TEACHER_REQUESTS", c.RateLimit.TeacherRequests)
+	c.RateLimit.ExemptAdmins = c.envBool("RATE_LIMIT_EXEMPT_ADMINS", c.RateLimit.ExemptAdmins)
+
+	c.Updates.Workers = c.envInt("UPDATE_WORKERS", c.Updates.Workers)
+	c.Updates.QueueSize = c.envInt("UPDATE_QUEUE_SIZE", c.Updates.QueueSize)
+	c.Updates.ShutdownTimeout = c.envDuration("SHUTDOWN_TIMEOUT", c.Updates.ShutdownTimeout)
+	c.Updates.HandlerTimeout = c.envDuration("UPDATE_TIMEOUT", c.Updates.HandlerTimeout)
+	c.Updates.FlowTTL = c.envDuration("FLOW_TTL", c.Updates.FlowTTL)
+	c.Updates.StateCacheSize = c.envInt("STATE_CACHE_SIZE", c.Updates.StateCacheSize)
+	c.Updates.StateCacheTTL = c.envDuration("STATE_CACHE_TTL", c.Updates.StateCacheTTL)
+
+	c.Log.Level = getEnv("LOG_LEVEL", c.Log.Level)
+	c.Log.Format = getEnv("LOG_FORMAT", c.Log.Format)
+
+	c.Metrics.Addr = getEnv("METRICS_ADDR", c.Metrics.Addr)
+
+	c.School.Timezone = getEnv("SCHOOL_TIMEZONE", c.School.Timezone)
+
+	c.Documents.TempDir = getEnv("TEMP_DOCS_DIR", c.Documents.TempDir)
+
+	c.Notifications.AdminAttendanceReports = c.envBool("NOTIFY_ADMIN_ATTENDANCE", c.Notifications.AdminAttendanceReports)
+	c.Notifications.ParentAbsenceAlerts = c.envBool("NOTIFY_PARENT_ABSENCE", c.Notifications.ParentAbsenceAlerts)
+	c.Notifications.ParentGradeAlerts = c.envBool("NOTIFY_PARENT_GRADES", c.Notifications.ParentGradeAlerts)
+
+	c.Outbox.MaxAttempts = c.envInt("OUTBOX_MAX_ATTEMPTS", c.Outbox.MaxAttempts)
+	c.Outbox.RetryBackoff = c.envDuration("OUTBOX_RETRY_BACKOFF", c.Outbox.RetryBackoff)
+	c.Outbox.MaxBackoff = c.envDuration("OUTBOX_MAX_BACKOFF", c.Outbox.MaxBackoff)
+	c.Outbox.Retention = c.envDuration("OUTBOX_RETENTION", c.Outbox.Retention)
+	c.Outbox.CleanupSchedule = getEnv("OUTBOX_CLEANUP_SCHEDULE", c.Outbox.CleanupSchedule)
+	c.Outbox.Rate = c.envInt("OUTBOX_RATE", c.Outbox.Rate)
+	c.Outbox.ChatInterval = c.envDuration("OUTBOX_CHAT_INTERVAL", c.Outbox.ChatInterval)
+
+	c.Backup.Dir = getEnv("BACKUP_DIR", c.Backup.Dir)
+	c.Backup.Schedule = getEnv("BACKUP_SCHEDULE", c.Backup.Schedule)
+	c.Backup.Retention = c.envDuration("BACKUP_RETENTION", c.Backup.Retention)
+	c.Backup.SendToAdmins = c.envBool("BACKUP_SEND_TO_ADMINS", c.Backup.SendToAdmins)
+
+	c.Scheduler.StateCleanupSchedule = getEnv("STATE_CLEANUP_SCHEDULE", c.Scheduler.StateCleanupSchedule)
+	c.Scheduler.StateRetention = c.envDuration("STATE_RETENTION", c.Scheduler.StateRetention)
+	c.Scheduler.TempCleanupSchedule = getEnv("TEMP_CLEANUP_SCHEDULE", c.Scheduler.TempCleanupSchedule)
+	c.Scheduler.TempFileRetention = c.envDuration("TEMP_FILE_RETENTION", c.Scheduler.TempFileRetention)
 }
 
-// Validate validates the configuration
+// Validate validates the configuration and reports every problem found.
+// Messages name the config file key followed by its environment variable.
 func (c *Config) Validate() error {
-	if c.Bot.Token == "" {
-		return fmt.Errorf("BOT_TOKEN is required")
+	errs := append([]error(nil), c.envErrors...)
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
 	}
 
-	if len(c.Admin.PhoneNumbers) == 0 {
-		return fmt.Errorf("at least one admin phone number is required")
+	check(c.Bot.Token != "", "bot.token (BOT_TOKEN) is required")
+	check(validWebhookSecret(c.Bot.WebhookSecret),
+		"bot.webhook_secret (WEBHOOK_SECRET) must be up to 256 characters of A-Z, a-z, 0-9, _ and -")
+
+	switch c.Database.Driver {
+	case DriverSQLite:
+		check(c.Database.Path != "", "database.path (DB_PATH) is required for the sqlite driver")
+	case DriverPostgres:
+		check(c.Database.URL != "", "database.url (DATABASE_URL) is required for the postgres driver")
+		check(c.Database.MaxOpenConns >= 1,
+			"database.max_open_conns (DB_MAX_OPEN_CONNS) must be at least 1, got %d", c.Database.MaxOpenConns)
+	default:
+		check(false, "database.driver (DB_DRIVER) must be %s or %s, got %q", DriverSQLite, DriverPostgres, c.Database.Driver)
 	}
 
-	if len(c.Admin.PhoneNumbers) > 3 {
-		return fmt.Errorf("maximum 3 admin phone numbers allowed, got %d", len(c.Admin.PhoneNumbers))
+	check(c.Admin.MaxAdmins >= 1, "admin.max_admins (MAX_ADMINS) must be at least 1, got %d", c.Admin.MaxAdmins)
+	check(len(c.Admin.PhoneNumbers) > 0, "admin.phones (ADMIN_PHONES): at least one admin phone number is required")
+	check(len(c.Admin.PhoneNumbers) <= c.Admin.MaxAdmins,
+		"admin.phones (ADMIN_PHONES): maximum %d admin phone numbers allowed, got %d", c.Admin.MaxAdmins, len(c.Admin.PhoneNumbers))
+	check(c.Admin.APISecret == "" || len(c.Admin.APISecret) >= 32,
+		"admin.api_secret (ADMIN_API_SECRET) must be at least 32 characters")
+
+	check(c.RateLimit.Requests >= 0, "rate_limit.requests (RATE_LIMIT_REQUESTS) cannot be negative, got %d", c.RateLimit.Requests)
+	check(c.RateLimit.TeacherRequests >= 0,
+		"rate_limit.teacher_requests (RATE_LIMIT_TEACHER_REQUESTS) cannot be negative, got %d", c.RateLimit.TeacherRequests)
+	check(c.RateLimit.Duration > 0, "rate_limit.duration (RATE_LIMIT_DURATION) must be positive, got %s", c.RateLimit.Duration)
+
+	check(c.Updates.Workers >= 1, "updates.workers (UPDATE_WORKERS) must be at least 1, got %d", c.Updates.Workers)
+	check(c.Updates.QueueSize >= 1, "updates.queue_size (UPDATE_QUEUE_SIZE) must be at least 1, got %d", c.Updates.QueueSize)
+	check(c.Updates.ShutdownTimeout > 0,
+		"updates.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive, got %s", c.Updates.ShutdownTimeout)
+	check(c.Updates.HandlerTimeout > 0,
+		"updates.handler_timeout (UPDATE_TIMEOUT) must be positive, got %s", c.Updates.HandlerTimeout)
+	check(c.Updates.FlowTTL >= time.Minute,
+		"updates.flow_ttl (FLOW_TTL) must be at least 1m, got %s", c.Updates.FlowTTL)
+	check(c.Updates.StateCacheSize >= 1,
+		"updates.state_cache_size (STATE_CACHE_SIZE) must be at least 1, got %d", c.Updates.StateCacheSize)
+	check(c.Updates.StateCacheTTL >= time.Second,
+		"updates.state_cache_ttl (STATE_CACHE_TTL) must be at least 1s, got %s", c.Updates.StateCacheTTL)
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level (LOG_LEVEL) must be debug, info, warn or error, got %q", c.Log.Level)
 	}
 
-	return nil
+	switch strings.ToLower(c.Log.Format) {
+	case "text", "json":
+	default:
+		check(false, "log.format (LOG_FORMAT) must be text or json, got %q", c.Log.Format)
+	}
+
+	_, err := time.LoadLocation(c.School.Timezone)
+	check(err == nil, "school.timezone (SCHOOL_TIMEZONE) %q is not a valid timezone", c.School.Timezone)
+
+	check(c.Documents.TempDir != "", "documents.temp_dir (TEMP_DOCS_DIR) is required")
+
+	check(c.Outbox.MaxAttempts >= 1, "outbox.max_attempts (OUTBOX_MAX_ATTEMPTS) must be at least 1, got %d", c.Outbox.MaxAttempts)
+	check(c.Outbox.RetryBackoff > 0, "outbox.retry_backoff (OUTBOX_RETRY_BACKOFF) must be positive, got %s", c.Outbox.RetryBackoff)
+	check(c.Outbox.MaxBackoff >= c.Outbox.RetryBackoff,
+		"outbox.max_backoff (OUTBOX_MAX_BACKOFF) must be at least outbox.retry_backoff, got %s", c.Outbox.MaxBackoff)
+	check(c.Outbox.Retention >= time.Hour, "outbox.retention (OUTBOX_RETENTION) must be at least 1h, got %s", c.Outbox.Retention)
+	_, err = cron.ParseStandard(c.Outbox.CleanupSchedule)
+	check(err == nil, "outbox.cleanup_schedule (OUTBOX_CLEANUP_SCHEDULE): %v", err)
+	check(c.Outbox.Rate >= 1 && c.Outbox.Rate <= 30, "outbox.rate (OUTBOX_RATE) must be between 1 and 30, got %d", c.Outbox.Rate)
+	check(c.Outbox.ChatInterval >= 0, "outbox.chat_interval (OUTBOX_CHAT_INTERVAL) must not be negative, got %s", c.Outbox.ChatInterval)
+
+	_, err = cron.ParseStandard(c.Scheduler.StateCleanupSchedule)
+	check(err == nil, "scheduler.state_cleanup_schedule (STATE_CLEANUP_SCHEDULE): %v", err)
+	_, err = cron.ParseStandard(c.Scheduler.TempCleanupSchedule)
+	check(err == nil, "scheduler.temp_cleanup_schedule (TEMP_CLEANUP_SCHEDULE): %v", err)
+	check(c.Scheduler.StateRetention >= time.Hour,
+		"scheduler.state_retention (STATE_RETENTION) must be at least 1h, got %s", c.Scheduler.StateRetention)
+	check(c.Scheduler.StateRetention >= c.Updates.FlowTTL,
+		"scheduler.state_retention (STATE_RETENTION) must be at least updates.flow_ttl (FLOW_TTL), got %s < %s",
+		c.Scheduler.StateRetention, c.Updates.FlowTTL)
+	check(c.Scheduler.TempFileRetention > 0,
+		"scheduler.temp_file_retention (TEMP_FILE_RETENTION) must be positive, got %s", c.Scheduler.TempFileRetention)
+
+	check(c.Backup.Dir != "", "backup.dir (BACKUP_DIR) is required")
+	if c.Backup.Schedule != "" {
+		_, err = cron.ParseStandard(c.Backup.Schedule)
+		check(err == nil, "backup.schedule (BACKUP_SCHEDULE): %v", err)
+		check(c.Database.Driver == DriverSQLite,
+			"backup.schedule (BACKUP_SCHEDULE) needs the sqlite driver; back up PostgreSQL with pg_dump")
+	}
+	check(c.Backup.Retention >= 0, "backup.retention (BACKUP_RETENTION) cannot be negative, got %s", c.Backup.Retention)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	if c.File != "" {
+		return fmt.Errorf("invalid configuration (%s and environment):\n%w", c.File, errors.Join(errs...))
+	}
+	return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
 }
 
 // GetDBPath returns the SQLite database file path
@@ -95,6 +423,36 @@ func (c *DatabaseConfig) GetDBPath() string {
 	return c.Path
 }
 
+// String describes the database for logs, without the PostgreSQL password
+func (c *DatabaseConfig) String() string {
+	if c.Driver != DriverPostgres {
+		return c.Driver + " " + c.Path
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Scheme == "" {
+		// key=value connection strings may hold a password anywhere
+		return c.Driver
+	}
+	return c.Driver + " " + u.Redacted()
+}
+
+// validWebhookSecret checks the charset Telegram allows for secret_token
+func validWebhookSecret(secret string) bool {
+	if len(secret) > 256 {
+		return false
+	}
+
+	for _, r := range secret {
+		isAlnum := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !isAlnum && r != '_' && r != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
 // getEnv gets environment variable with fallback
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
@@ -103,16 +461,65 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// envInt gets integer environment variable with fallback, recording invalid values
+func (c *Config) envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		c.envErrors = append(c.envErrors, fmt.Errorf("%s: %q is not an integer", key, value))
+		return fallback
+	}
+	return parsed
+}
+
+// envDuration gets duration environment variable (e.g. "30s") with fallback, recording invalid values
+func (c *Config) envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		c.envErrors = append(c.envErrors, fmt.Errorf("%s: %q is not a duration (use e.g. 30s, 5m, 48h)", key, value))
+		return fallback
+	}
+	return parsed
+}
+
+// envBool gets boolean environment variable with fallback, recording invalid values
+func (c *Config) envBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		c.envErrors = append(c.envErrors, fmt.Errorf("%s: %q is not a boolean (use true or false)", key, value))
+		return fallback
+	}
+	return parsed
+}
+
 // parseAdminPhones parses comma-separated admin phone numbers
 func parseAdminPhones(phones string) []string {
 	if phones == "" {
 		return []string{}
 	}
 
-	parts := strings.Split(phones, ",")
-	result := make([]string, 0, len(parts))
+	return normalizePhones(strings.Split(phones, ","))
+}
+
+// normalizePhones trims admin phone numbers and drops empty entries
+func normalizePhones(phones []string) []string {
+	result := make([]string, 0, len(phones))
 
-	for _, phone := range parts {
+	for _, phone := range phones {
 		trimmed := strings.TrimSpace(phone)
 		if trimmed != "" {
 			result = append(result, trimmed)
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// defaultFiles are looked up in the working directory when CONFIG_FILE is not set
+var defaultFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
+// FilePath returns the config file to load: CONFIG_FILE, else the first
+// default file that exists, else "" (environment variables only)
+func FilePath() string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+
+	for _, name := range defaultFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// fileConfig is the schema of the config file. Every key is optional; keys
+// that are absent keep their default, and environment variables override
+// keys that are present. Unknown keys are rejected.
+type fileConfig struct {
+	Bot           *fileBot           `yaml:"bot" toml:"bot"`
+	Database      *fileDatabase      `yaml:"database" toml:"database"`
+	Server        *fileServer        `yaml:"server" toml:"server"`
+	Admin         *fileAdmin         `yaml:"admin" toml:"admin"`
+	RateLimit     *fileRateLimit     `yaml:"rate_limit" toml:"rate_limit"`
+	Updates       *fileUpdates       `yaml:"updates" toml:"updates"`
+	Log           *fileLog           `yaml:"log" toml:"log"`
+	Metrics       *fileMetrics       `yaml:"metrics" toml:"metrics"`
+	School        *fileSchool        `yaml:"school" toml:"school"`
+	Documents     *fileDocuments     `yaml:"documents" toml:"documents"`
+	Notifications *fileNotifications `yaml:"notifications" toml:"notifications"`
+	Outbox        *fileOutbox        `yaml:"outbox" toml:"outbox"`
+	Scheduler     *fileScheduler     `yaml:"scheduler" toml:"scheduler"`
+	Backup        *fileBackup        `yaml:"backup" toml:"backup"`
+}
+
+// fileBot is the [bot] section
+type fileBot struct {
+	Token         *string `yaml:"token" toml:"token"`
+	WebhookURL    *string `yaml:"webhook_url" toml:"webhook_url"`
+	WebhookSecret *string `yaml:"webhook_secret" toml:"webhook_secret"`
+	APIEndpoint   *string `yaml:"api_endpoint" toml:"api_endpoint"`
+}
+
+// fileDatabase is the [database] section
+type fileDatabase struct {
+	Driver       *string `yaml:"driver" toml:"driver"`
+	Path         *string `yaml:"path" toml:"path"`
+	URL          *string `yaml:"url" toml:"url"`
+	MaxOpenConns *int    `yaml:"max_open_conns" toml:"max_open_conns"`
+}
+
+// fileServer is the [server] section
+type fileServer struct {
+	Port    *string `yaml:"port" toml:"port"`
+	GinMode *string `yaml:"gin_mode" toml:"gin_mode"`
+}
+
+// fileAdmin is the [admin] section
+type fileAdmin struct {
+	Phones    []string `yaml:"phones" toml:"phones"`
+	MaxAdmins *int     `yaml:"max_admins" toml:"max_admins"`
+	APISecret *string  `yaml:"api_secret" toml:"api_secret"`
+}
+
+// fileRateLimit is the [rate_limit] section
+type fileRateLimit struct {
+	Requests        *int      `yaml:"requests" toml:"requests"`
+	Duration        *duration `yaml:"duration" toml:"duration"`
+	TeacherRequests *int      `yaml:"teacher_requests" toml:"teacher_requests"`
+	ExemptAdmins    *bool     `yaml:"exempt_admins" toml:"exempt_admins"`
+}
+
+// fileUpdates is the [updates] section
+type fileUpdates struct {
+	Workers         *int      `yaml:"workers" toml:"workers"`
+	QueueSize       *int      `yaml:"queue_size" toml:"queue_size"`
+	ShutdownTimeout *duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	HandlerTimeout  *duration `yaml:"handler_timeout" toml:"handler_timeout"`
+	FlowTTL         *duration `yaml:"flow_ttl" toml:"flow_ttl"`
+	StateCacheSize  *int      `yaml:"state_cache_size" toml:"state_cache_size"`
+	StateCacheTTL   *duration `yaml:"state_cache_ttl" toml:"state_cache_ttl"`
+}
+
+// fileLog is the [log] section
+type fileLog struct {
+	Level  *string `yaml:"level" toml:"level"`
+	Format *string `yaml:"format" toml:"format"`
+}
+
+// fileMetrics is the [metrics] section
+type fileMetrics struct {
+	Addr *string `yaml:"addr" toml:"addr"`
+}
+
+// fileSchool is the [school] section
+type fileSchool struct {
+	Timezone *string `yaml:"timezone" toml:"timezone"`
+}
+
+// fileDocuments is the [documents] section
+type fileDocuments struct {
+	TempDir *string `yaml:"temp_dir" toml:"temp_dir"`
+}
+
+// fileNotifications is the [notifications] section
+type fileNotifications struct {
+	BroadcastLimit         *int  `yaml:"broadcast_limit" toml:"broadcast_limit"` // ignored; broadcasts are no longer capped
+	AdminAttendanceReports *bool `yaml:"admin_attendance_reports" toml:"admin_attendance_reports"`
+	ParentAbsenceAlerts    *bool `yaml:"parent_absence_alerts" toml:"parent_absence_alerts"`
+	ParentGradeAlerts      *bool `yaml:"parent_grade_alerts" toml:"parent_grade_alerts"`
+}
+
+// fileOutbox is the [outbox] section
+type fileOutbox struct {
+	MaxAttempts     *int      `yaml:"max_attempts" toml:"max_attempts"`
+	RetryBackoff    *duration `yaml:"retry_backoff" toml:"retry_backoff"`
+	MaxBackoff      *duration `yaml:"max_backoff" toml:"max_backoff"`
+	Retention       *duration `yaml:"retention" toml:"retention"`
+	CleanupSchedule *string   `yaml:"cleanup_schedule" toml:"cleanup_schedule"`
+	Rate            *int      `yaml:"rate" toml:"rate"`
+	ChatInterval    *duration `yaml:"chat_interval" toml:"chat_interval"`
+}
+
+// fileScheduler is the [scheduler] section
+type fileScheduler struct {
+	StateCleanupSchedule *string   `yaml:"state_cleanup_schedule" toml:"state_cleanup_schedule"`
+	StateRetention       *duration `yaml:"state_retention" toml:"state_retention"`
+	TempCleanupSchedule  *string   `yaml:"temp_cleanup_schedule" toml:"temp_cleanup_schedule"`
+	TempFileRetention    *duration `yaml:"temp_file_retention" toml:"temp_file_retention"`
+}
+
+// fileBackup is the [backup] section
+type fileBackup struct {
+	Dir          *string   `yaml:"dir" toml:"dir"`
+	Schedule     *string   `yaml:"schedule" toml:"schedule"`
+	Retention    *duration `yaml:"retention" toml:"retention"`
+	SendToAdmins *bool     `yaml:"send_to_admins" toml:"send_to_admins"`
+}
+
+// duration is a time.Duration written as a string such as "30s" or "48h"
+type duration time.Duration
+
+// UnmarshalText parses a Go duration string
+func (d *duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q (use e.g. 30s, 5m, 48h)", text)
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// readFile decodes a YAML or TOML config file, chosen by extension
+func readFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file fileConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalWithOptions(data, &file, yaml.Strict()); err != nil {
+			return nil, fmt.Errorf("%s:\n%s", path, yaml.FormatError(err, false, true))
+		}
+
+	case ".toml":
+		decoder := toml.NewDecoder(strings.NewReader(string(data))).DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("%s:\n%s", path, tomlErrorText(err))
+		}
+
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file type (use .yaml, .yml or .toml)", path)
+	}
+
+	return &file, nil
+}
+
+// tomlErrorText renders go-toml errors with their source position
+func tomlErrorText(err error) string {
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		return decodeErr.String()
+	}
+
+	var strictErr *toml.StrictMissingError
+	if errors.As(err, &strictErr) {
+		return "unknown keys:\n" + strictErr.String()
+	}
+
+	return err.Error()
+}
+
+// apply copies the keys present in the file onto cfg
+func (f *fileConfig) apply(cfg *Config) {
+	if b := f.Bot; b != nil {
+		set(&cfg.Bot.Token, b.Token)
+		set(&cfg.Bot.WebhookURL, b.WebhookURL)
+		set(&cfg.Bot.WebhookSecret, b.WebhookSecret)
+		set(&cfg.Bot.APIEndpoint, b.APIEndpoint)
+	}
+
+	if d := f.Database; d != nil {
+		set(&cfg.Database.Driver, d.Driver)
+		set(&cfg.Database.Path, d.Path)
+		set(&cfg.Database.URL, d.URL)
+		set(&cfg.Database.MaxOpenConns, d.MaxOpenConns)
+	}
+
+	if s := f.Server; s != nil {
+		set(&cfg.Server.Port, s.Port)
+		set(&cfg.Server.GinMode, s.GinMode)
+	}
+
+	if a := f.Admin; a != nil {
+		if a.Phones != nil {
+			cfg.Admin.PhoneNumbers = normalizePhones(a.Phones)
+		}
+		set(&cfg.Admin.MaxAdmins, a.MaxAdmins)
+		set(&cfg.Admin.APISecret, a.APISecret)
+	}
+
+	if r := f.RateLimit; r != nil {
+		set(&cfg.RateLimit.Requests, r.Requests)
+		setDuration(&cfg.RateLimit.Duration, r.Duration)
+		set(&cfg.RateLimit.TeacherRequests, r.TeacherRequests)
+		set(&cfg.RateLimit.ExemptAdmins, r.ExemptAdmins)
+	}
+
+	if u := f.Updates; u != nil {
+		set(&cfg.Updates.Workers, u.Workers)
+		set(&cfg.Updates.QueueSize, u.QueueSize)
+		setDuration(&cfg.Updates.ShutdownTimeout, u.ShutdownTimeout)
+		setDuration(&cfg.Updates.HandlerTimeout, u.HandlerTimeout)
+		setDuration(&cfg.Updates.FlowTTL, u.FlowTTL)
+		set(&cfg.Updates.StateCacheSize, u.StateCacheSize)
+		setDuration(&cfg.Updates.StateCacheTTL, u.StateCacheTTL)
+	}
+
+	if l := f.Log; l != nil {
+		set(&cfg.Log.Level, l.Level)
+		set(&cfg.Log.Format, l.Format)
+	}
+
+	if m := f.Metrics; m != nil {
+		set(&cfg.Metrics.Addr, m.Addr)
+	}
+
+	if s := f.School; s != nil {
+		set(&cfg.School.Timezone, s.Timezone)
+	}
+
+	if d := f.Documents; d != nil {
+		set(&cfg.Documents.TempDir, d.TempDir)
+	}
+
+	if n := f.Notifications; n != nil {
+		set(&cfg.Notifications.AdminAttendanceReports, n.AdminAttendanceReports)
+		set(&cfg.Notifications.ParentAbsenceAlerts, n.ParentAbsenceAlerts)
+		set(&cfg.Notifications.ParentGradeAlerts, n.ParentGradeAlerts)
+	}
+
+	if o := f.Outbox; o != nil {
+		set(&cfg.Outbox.MaxAttempts, o.MaxAttempts)
+		setDuration(&cfg.Outbox.RetryBackoff, o.RetryBackoff)
+		setDuration(&cfg.Outbox.MaxBackoff, o.MaxBackoff)
+		setDuration(&cfg.Outbox.Retention, o.Retention)
+		set(&cfg.Outbox.CleanupSchedule, o.CleanupSchedule)
+		set(&cfg.Outbox.Rate, o.Rate)
+		setDuration(&cfg.Outbox.ChatInterval, o.ChatInterval)
+	}
+
+	if s := f.Scheduler; s != nil {
+		set(&cfg.Scheduler.StateCleanupSchedule, s.StateCleanupSchedule)
+		setDuration(&cfg.Scheduler.StateRetention, s.StateRetention)
+		set(&cfg.Scheduler.TempCleanupSchedule, s.TempCleanupSchedule)
+		setDuration(&cfg.Scheduler.TempFileRetention, s.TempFileRetention)
+	}
+
+	if b := f.Backup; b != nil {
+		set(&cfg.Backup.Dir, b.Dir)
+		set(&cfg.Backup.Schedule, b.Schedule)
+		setDuration(&cfg.Backup.Retention, b.Retention)
+		set(&cfg.Backup.SendToAdmins, b.SendToAdmins)
+	}
+}
+
+// set overwrites dst when the file has a value for it
+func set[T any](dst *T, value *T) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+// setDuration overwrites dst when the file has a duration for it
+func setDuration(dst *time.Duration, value *duration) {
+	if value != nil {
+		*dst = time.Duration(*value)
+	}
+}
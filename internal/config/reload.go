@@ -0,0 +1,57 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+)
+
+// Reload returns a copy of c with the settings that are safe to change while
+// the bot runs taken from next: rate limits, admin phones and notifications.
+// It also names the changed settings that were not applied because they need
+// a restart.
+func (c *Config) Reload(next *Config) (reloaded *Config, needRestart []string) {
+	merged := *c
+	merged.RateLimit = next.RateLimit
+	merged.Admin.PhoneNumbers = slices.Clone(next.Admin.PhoneNumbers)
+	merged.Admin.MaxAdmins = next.Admin.MaxAdmins // validated together with the phones
+	merged.Notifications = next.Notifications
+
+	// Whatever still differs from next is a restart-only setting
+	sections := map[string][2]any{
+		"bot":              {merged.Bot, next.Bot},
+		"database":         {merged.Database, next.Database},
+		"server":           {merged.Server, next.Server},
+		"admin.api_secret": {merged.Admin.APISecret, next.Admin.APISecret},
+		"updates":          {merged.Updates, next.Updates},
+		"log":              {merged.Log, next.Log},
+		"metrics":          {merged.Metrics, next.Metrics},
+		"school":           {merged.School, next.School},
+		"documents":        {merged.Documents, next.Documents},
+		"outbox":           {merged.Outbox, next.Outbox},
+		"scheduler":        {merged.Scheduler, next.Scheduler},
+		"backup":           {merged.Backup, next.Backup},
+	}
+	for name, pair := range sections {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			needRestart = append(needRestart, name)
+		}
+	}
+	slices.Sort(needRestart)
+
+	return &merged, needRestart
+}
+
+// Changed names the reloadable settings that differ between c and next
+func (c *Config) Changed(next *Config) []string {
+	var changed []string
+	if c.RateLimit != next.RateLimit {
+		changed = append(changed, "rate_limit")
+	}
+	if !slices.Equal(c.Admin.PhoneNumbers, next.Admin.PhoneNumbers) {
+		changed = append(changed, "admin.phones")
+	}
+	if c.Notifications != next.Notifications {
+		changed = append(changed, "notifications")
+	}
+	return changed
+}
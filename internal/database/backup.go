@@ -0,0 +1,260 @@
+package database
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup copies the SQLite database at srcPath to destPath with SQLite's
+// online backup API. The copy is a consistent snapshot that includes pages
+// still in the WAL, and the bot can keep writing while it runs. destPath must
+// not exist; the snapshot is written next to it and renamed into place.
+func Backup(ctx context.Context, srcPath, destPath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(srcPath); err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	if _, err := os.Stat(destPath); err == nil {
+		return fmt.Errorf("backup file %s already exists", destPath)
+	}
+
+	tmpPath := destPath + ".tmp"
+	_ = os.Remove(tmpPath)
+	if err := copyDatabase(srcPath, tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to save backup: %w", err)
+	}
+
+	return nil
+}
+
+// Restore replaces the database at dbPath with a backup made by Backup,
+// optionally gzip-compressed. The backup must pass PRAGMA integrity_check
+// before anything is touched, and the current database is first saved as
+// <dbPath>.before-restore-<time>, whose path is returned. Stop the bot
+// before restoring: open connections would keep using the old data.
+func Restore(ctx context.Context, backupPath, dbPath string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(backupPath); err != nil {
+		return "", fmt.Errorf("failed to open backup: %w", err)
+	}
+
+	if strings.HasSuffix(backupPath, ".gz") {
+		plain, err := decompress(backupPath, filepath.Dir(dbPath))
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(plain)
+		backupPath = plain
+	}
+
+	if err := IntegrityCheck(backupPath); err != nil {
+		return "", fmt.Errorf("backup is not usable: %w", err)
+	}
+	if err := checkBotSchema(backupPath); err != nil {
+		return "", fmt.Errorf("backup is not usable: %w", err)
+	}
+
+	var safetyCopy string
+	if _, err := os.Stat(dbPath); err == nil {
+		safetyCopy = fmt.Sprintf("%s.before-restore-%s", dbPath, time.Now().Format("20060102-150405"))
+		if err := Backup(ctx, dbPath, safetyCopy); err != nil {
+			return "", fmt.Errorf("failed to save current database: %w", err)
+		}
+	}
+
+	// Copying into the live file through the backup API, rather than renaming
+	// over it, keeps its WAL and shared-memory files consistent
+	if err := copyDatabase(backupPath, dbPath); err != nil {
+		return safetyCopy, err
+	}
+
+	if err := IntegrityCheck(dbPath); err != nil {
+		return safetyCopy, fmt.Errorf("restored database failed verification: %w", err)
+	}
+
+	return safetyCopy, nil
+}
+
+// IntegrityCheck runs PRAGMA integrity_check on a SQLite database file
+func IntegrityCheck(path string) error {
+	conn, err := openSQLiteFile(path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query("PRAGMA integrity_check", nil)
+	if err != nil {
+		return fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	values := make([]driver.Value, 1)
+	for {
+		err := rows.Next(values)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to run integrity check: %w", err)
+		}
+		if result := fmt.Sprint(values[0]); result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// Compress gzips path to path.gz and removes the original
+func Compress(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	gzPath := path + ".gz"
+	dst, err := os.Create(gzPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(gzPath)
+		return "", fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+
+	src.Close()
+	_ = os.Remove(path)
+	return gzPath, nil
+}
+
+// decompress gunzips path into a temporary file in dir
+func decompress(path, dir string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer src.Close()
+
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	dst, err := os.CreateTemp(dir, "restore-*.db")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+
+	_, err = io.Copy(dst, zr)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return "", fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+
+	return dst.Name(), nil
+}
+
+// checkBotSchema makes sure a file is one of our databases, not just any
+// valid SQLite file
+func checkBotSchema(path string) error {
+	conn, err := openSQLiteFile(path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'", nil)
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+	defer rows.Close()
+
+	if err := rows.Next(make([]driver.Value, 1)); err != nil {
+		return fmt.Errorf("no schema_migrations table, not a bot database")
+	}
+
+	return nil
+}
+
+// copyDatabase copies every page of srcPath into destPath in one backup step,
+// so the result is a single consistent snapshot
+func copyDatabase(srcPath, destPath string) error {
+	src, err := openSQLiteFile(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := openSQLiteFile(destPath)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	backup, err := dest.Backup("main", src, "main")
+	if err != nil {
+		return fmt.Errorf("failed to start backup: %w", err)
+	}
+
+	if _, err := backup.Step(-1); err != nil {
+		backup.Finish()
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	if err := backup.Finish(); err != nil {
+		return fmt.Errorf("failed to finish backup: %w", err)
+	}
+
+	return nil
+}
+
+// openSQLiteFile opens a raw connection outside the DB pool, so backups work
+// from the command line and never compete with the bot's single connection
+func openSQLiteFile(path string) (*sqlite3.SQLiteConn, error) {
+	conn, err := (&sqlite3.SQLiteDriver{}).Open(path + "?_busy_timeout=10000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return conn.(*sqlite3.SQLiteConn), nil
+}
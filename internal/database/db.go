@@ -4,12 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
 	"time"
 
 	"parent-bot/internal/config"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 // DB is the global database connection
@@ -17,12 +14,29 @@ var DB *sql.DB
 
 // Connect establishes database connection with connection pooling
 func Connect(cfg *config.DatabaseConfig) error {
+	var db *sql.DB
+	var err error
+	if cfg.Driver == config.DriverPostgres {
+		db, err = connectPostgres(cfg)
+	} else {
+		db, err = connectSQLite(cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	DB = db
+	return nil
+}
+
+// connectSQLite opens the database file with a single connection
+func connectSQLite(cfg *config.DatabaseConfig) (*sql.DB, error) {
 	// SQLite uses a file path instead of DSN
 	dbPath := cfg.GetDBPath()
 
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open(driverName, dbPath)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Configure connection pool for SQLite
@@ -33,21 +47,47 @@ func Connect(cfg *config.DatabaseConfig) error {
 	// Enable foreign keys and WAL mode for better performance
 	_, err = db.Exec("PRAGMA foreign_keys = ON")
 	if err != nil {
-		return fmt.Errorf("failed to enable foreign keys: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
 	}
 
 	_, err = db.Exec("PRAGMA journal_mode = WAL")
 	if err != nil {
-		return fmt.Errorf("failed to enable WAL mode: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
 	}
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	DB = db
-	return nil
+	return db, nil
+}
+
+// connectPostgres opens a connection pool to a PostgreSQL server. Tables are
+// created in the first schema of the connection's search_path, so schools
+// sharing a server use separate databases or search_path schemas.
+func connectPostgres(cfg *config.DatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open(pgDriverName, cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxOpenConns)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, nil
 }
 
 // Close closes the database connection
@@ -58,32 +98,27 @@ func Close() error {
 	return nil
 }
 
-// RunMigrations executes SQL migration files
-func RunMigrations(migrationPath string) error {
+// RunMigrations applies all pending embedded migrations
+func RunMigrations() ([]*Migration, error) {
 	if DB == nil {
-		return fmt.Errorf("database not connected")
-	}
-
-	sqlBytes, err := os.ReadFile(migrationPath)
-	if err != nil {
-		return fmt.Errorf("failed to read migration file: %w", err)
+		return nil, fmt.Errorf("database not connected")
 	}
 
-	_, err = DB.Exec(string(sqlBytes))
+	migrator, err := NewMigrator(DB)
 	if err != nil {
-		return fmt.Errorf("failed to execute migration: %w", err)
+		return nil, err
 	}
 
-	return nil
+	return migrator.Up()
 }
 
 // HealthCheck checks if database is reachable
-func HealthCheck() error {
+func HealthCheck(ctx context.Context) error {
 	if DB == nil {
 		return fmt.Errorf("database not initialized")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	return DB.PingContext(ctx)
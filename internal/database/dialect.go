@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"parent-bot/internal/config"
+)
+
+// Dialect is the SQL flavour of a connection. Repositories write portable SQL
+// with ? placeholders (the PostgreSQL driver rewrites them to $1, $2, ...) and
+// ask the dialect only for the few expressions that differ.
+type Dialect interface {
+	// Name is the driver name from DatabaseConfig: sqlite or postgres
+	Name() string
+
+	// Date returns an expression for the calendar date of expr. SQLite stores
+	// dates as text in several formats, so compare dates only through Date.
+	Date(expr string) string
+
+	// HoursAgo returns an expression for the current time minus the number of
+	// hours bound to one ? placeholder
+	HoursAgo() string
+
+	// migrationDir is the directory of the dialect's migration set
+	migrationDir() string
+
+	// versionTableDDL creates schema_migrations
+	versionTableDDL() string
+}
+
+// The supported dialects
+var (
+	SQLite   Dialect = sqliteDialect{}
+	Postgres Dialect = postgresDialect{}
+)
+
+// DialectOf returns the dialect of a connection opened by Connect.
+// Connections opened any other way are assumed to be SQLite.
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*instrumentedPgDriver); ok {
+		return Postgres
+	}
+	return SQLite
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return config.DriverSQLite }
+
+func (sqliteDialect) Date(expr string) string { return "date(" + expr + ")" }
+
+func (sqliteDialect) HoursAgo() string { return "datetime('now', '-' || ? || ' hours')" }
+
+func (sqliteDialect) migrationDir() string { return "migrations/sqlite" }
+
+func (sqliteDialect) versionTableDDL() string {
+	return `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return config.DriverPostgres }
+
+func (postgresDialect) Date(expr string) string { return "CAST(" + expr + " AS DATE)" }
+
+func (postgresDialect) HoursAgo() string { return "CURRENT_TIMESTAMP - make_interval(hours => ?)" }
+
+func (postgresDialect) migrationDir() string { return "migrations/postgres" }
+
+func (postgresDialect) versionTableDDL() string {
+	return `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+}
+
+// rebind rewrites ? placeholders to PostgreSQL's $1, $2, ... Question marks
+// inside quoted strings, quoted identifiers and comments are left alone.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+1])
+			i += end
+
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package database
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "no placeholders",
+			query: "SELECT 1",
+			want:  "SELECT 1",
+		},
+		{
+			name:  "numbered in order",
+			query: "UPDATE users SET language = ? WHERE id = ? AND phone_number = ?",
+			want:  "UPDATE users SET language = $1 WHERE id = $2 AND phone_number = $3",
+		},
+		{
+			name:  "string literal",
+			query: "SELECT * FROM complaints WHERE complaint_text = 'why?' AND user_id = ?",
+			want:  "SELECT * FROM complaints WHERE complaint_text = 'why?' AND user_id = $1",
+		},
+		{
+			name:  "escaped quote in literal",
+			query: "SELECT 'it''s ? here', ?",
+			want:  "SELECT 'it''s ? here', $1",
+		},
+		{
+			name:  "quoted identifier",
+			query: `SELECT "odd?name" FROM t WHERE id = ?`,
+			want:  `SELECT "odd?name" FROM t WHERE id = $1`,
+		},
+		{
+			name:  "line comment",
+			query: "SELECT id -- which one?\nFROM t WHERE id = ?",
+			want:  "SELECT id -- which one?\nFROM t WHERE id = $1",
+		},
+		{
+			name:  "comment at end",
+			query: "SELECT ? -- done?",
+			want:  "SELECT $1 -- done?",
+		},
+		{
+			name:  "unterminated literal",
+			query: "SELECT ? WHERE x = 'open?",
+			want:  "SELECT $1 WHERE x = 'open?",
+		},
+		{
+			name:  "minus is not a comment",
+			query: "SELECT ? - ?",
+			want:  "SELECT $1 - $2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rebind(tt.query); got != tt.want {
+				t.Errorf("rebind(%q)\n got %q\nwant %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
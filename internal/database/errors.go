@@ -0,0 +1,57 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Constraint violations, matched with errors.Is whichever driver is in use
+var (
+	ErrDuplicate  = errors.New("duplicate key")
+	ErrForeignKey = errors.New("foreign key violation")
+)
+
+// ConstraintError is a UNIQUE or FOREIGN KEY violation reported by SQLite or
+// PostgreSQL. errors.Is matches it against ErrDuplicate or ErrForeignKey.
+type ConstraintError struct {
+	Kind  error  // ErrDuplicate or ErrForeignKey
+	Table string // table of the violated constraint, when the driver reports it
+	Err   error  // the driver's error
+}
+
+func (e *ConstraintError) Error() string { return e.Err.Error() }
+
+func (e *ConstraintError) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+// Classify turns driver constraint violations into *ConstraintError and
+// returns any other error unchanged. Repositories call it on write errors.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return &ConstraintError{Kind: ErrDuplicate, Err: err}
+		case sqlite3.ErrConstraintForeignKey:
+			return &ConstraintError{Kind: ErrForeignKey, Err: err}
+		}
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return &ConstraintError{Kind: ErrDuplicate, Table: pgErr.TableName, Err: err}
+		case "23503": // foreign_key_violation
+			return &ConstraintError{Kind: ErrForeignKey, Table: pgErr.TableName, Err: err}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/mattn/go-sqlite3"
+
+	"parent-bot/internal/metrics"
+)
+
+// Driver names of the sqlite3 and pgx drivers wrapped to time every statement
+const (
+	driverName   = "sqlite3_instrumented"
+	pgDriverName = "pgx_instrumented"
+)
+
+func init() {
+	sql.Register(driverName, &instrumentedDriver{&sqlite3.SQLiteDriver{}})
+	sql.Register(pgDriverName, &instrumentedPgDriver{stdlib.GetDefaultDriver()})
+}
+
+// instrumentedDriver opens sqlite3 connections that report query durations
+type instrumentedDriver struct {
+	driver *sqlite3.SQLiteDriver
+}
+
+func (d *instrumentedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// instrumentedConn times ExecContext and QueryContext, which database/sql
+// uses for every DB and Tx call. Everything else is the embedded conn's.
+type instrumentedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(query, time.Now())
+	return c.SQLiteConn.ExecContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(query, time.Now())
+	return c.SQLiteConn.QueryContext(ctx, query, args)
+}
+
+// instrumentedPgDriver opens pgx connections that report query durations and
+// accept the ? placeholders the repositories are written with
+type instrumentedPgDriver struct {
+	driver driver.Driver
+}
+
+func (d *instrumentedPgDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedPgConn{conn.(*stdlib.Conn)}, nil
+}
+
+// instrumentedPgConn rebinds placeholders in every statement with arguments.
+// Statements without arguments, such as migration scripts, are sent as is.
+type instrumentedPgConn struct {
+	*stdlib.Conn
+}
+
+func (c *instrumentedPgConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(query, time.Now())
+	if len(args) > 0 {
+		query = rebind(query)
+	}
+	return c.Conn.ExecContext(ctx, query, args)
+}
+
+func (c *instrumentedPgConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(query, time.Now())
+	if len(args) > 0 {
+		query = rebind(query)
+	}
+	return c.Conn.QueryContext(ctx, query, args)
+}
+
+func (c *instrumentedPgConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c *instrumentedPgConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.PrepareContext(ctx, rebind(query))
+}
+
+// observeQuery records a statement's duration under its leading keyword
+func observeQuery(query string, start time.Time) {
+	metrics.DBQueryDuration.WithLabelValues(queryOperation(query)).Observe(time.Since(start).Seconds())
+}
+
+// queryOperation returns select, insert, update, delete or other
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+
+	switch op := strings.ToLower(fields[0]); op {
+	case "select", "insert", "update", "delete":
+		return op
+	case "with":
+		return "select"
+	default:
+		return "other"
+	}
+}
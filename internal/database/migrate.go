@@ -0,0 +1,308 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFS embed.FS
+
+// baselineVersion is the migration that created the schema of SQLite databases
+// deployed before schema_migrations existed (main.go used to run 006 only)
+const baselineVersion = 6
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version  int
+	Name     string
+	UpSQL    string
+	DownSQL  string // empty if the migration cannot be reverted
+	Checksum string // sha256 of UpSQL
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	Migration *Migration
+	Applied   bool
+	AppliedAt *time.Time
+	Modified  bool // applied checksum differs from the embedded file
+}
+
+// Migrator applies embedded migrations and records them in schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []*Migration
+}
+
+// NewMigrator creates a migrator for the embedded migration set of the
+// connection's dialect. SQLite and PostgreSQL have separate sets that keep
+// the same version numbers.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	dialect := DialectOf(db)
+
+	migrations, err := loadMigrations(migrationFS, dialect.migrationDir())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// loadMigrations parses NNN_name.sql and optional NNN_name.down.sql files
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".sql") {
+			continue
+		}
+
+		isDown := strings.HasSuffix(fileName, ".down.sql")
+		base := strings.TrimSuffix(strings.TrimSuffix(fileName, ".sql"), ".down")
+
+		prefix, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", fileName)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", fileName, err)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("duplicate migration version %03d: %s and %s", version, m.Name, name)
+		}
+
+		if isDown {
+			m.DownSQL = string(content)
+		} else {
+			m.UpSQL = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpSQL == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// ensureVersionTable creates schema_migrations and baselines legacy databases
+func (m *Migrator) ensureVersionTable() error {
+	_, err := m.db.Exec(m.dialect.versionTableDDL())
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var count int
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count); err != nil {
+		return fmt.Errorf("failed to count applied migrations: %w", err)
+	}
+	if count > 0 || m.dialect != SQLite {
+		return nil
+	}
+
+	// Databases created before versioning already have the baseline schema.
+	// Record it as applied so it is not re-run (006 drops every table).
+	var legacy bool
+	err = m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type='table' AND name='admins')").Scan(&legacy)
+	if err != nil {
+		return fmt.Errorf("failed to detect existing schema: %w", err)
+	}
+	if !legacy {
+		return nil
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > baselineVersion {
+			break
+		}
+		_, err := m.db.Exec(
+			"INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)",
+			migration.Version, migration.Name, migration.Checksum,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record baseline migration %03d: %w", migration.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// applied returns recorded checksums and timestamps keyed by version
+func (m *Migrator) applied() (map[int]string, map[int]time.Time, error) {
+	rows, err := m.db.Query("SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	checksums := make(map[int]string)
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var checksum string
+		var at time.Time
+		if err := rows.Scan(&version, &checksum, &at); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		checksums[version] = checksum
+		appliedAt[version] = at
+	}
+
+	return checksums, appliedAt, rows.Err()
+}
+
+// Up applies all pending migrations in order, each in its own transaction.
+// It returns the migrations that were applied.
+func (m *Migrator) Up() ([]*Migration, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	checksums, _, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	for _, migration := range m.migrations {
+		if checksum, ok := checksums[migration.Version]; ok {
+			if checksum != migration.Checksum {
+				return done, fmt.Errorf("migration %03d_%s was modified after it was applied", migration.Version, migration.Name)
+			}
+			continue
+		}
+
+		err := m.runInTx(migration.UpSQL, func(tx *sql.Tx) error {
+			_, err := tx.Exec(
+				"INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)",
+				migration.Version, migration.Name, migration.Checksum,
+			)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %03d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down reverts the last `steps` applied migrations, newest first
+func (m *Migrator) Down(steps int) ([]*Migration, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	checksums, _, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := checksums[migration.Version]; !ok {
+			continue
+		}
+
+		if migration.DownSQL == "" {
+			return done, fmt.Errorf("migration %03d_%s cannot be reverted (no down script)", migration.Version, migration.Name)
+		}
+
+		err := m.runInTx(migration.DownSQL, func(tx *sql.Tx) error {
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("revert of %03d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Status reports every known migration and whether it has been applied
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	checksums, appliedAt, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := &MigrationStatus{Migration: migration}
+		if checksum, ok := checksums[migration.Version]; ok {
+			at := appliedAt[migration.Version]
+			status.Applied = true
+			status.AppliedAt = &at
+			status.Modified = checksum != migration.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// runInTx executes a migration script and its bookkeeping atomically
+func (m *Migrator) runInTx(script string, record func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+
+	if err := record(tx); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	return tx.Commit()
+}
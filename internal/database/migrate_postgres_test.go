@@ -0,0 +1,81 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"parent-bot/internal/config"
+)
+
+// TestPostgresMigrations applies the PostgreSQL migration set to the server
+// in TEST_DATABASE_URL, which must be a throwaway database. It is skipped
+// when the variable is not set.
+func TestPostgresMigrations(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := connectPostgres(&config.DatabaseConfig{Driver: config.DriverPostgres, URL: url, MaxOpenConns: 2})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer db.Close()
+
+	if DialectOf(db) != Postgres {
+		t.Fatalf("dialect = %s, want postgres", DialectOf(db).Name())
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.Modified {
+			t.Errorf("migration %03d_%s: applied=%v modified=%v", s.Migration.Version, s.Migration.Name, s.Applied, s.Modified)
+		}
+	}
+
+	again, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("second up: %v", err)
+	}
+	if len(again) != 0 {
+		t.Errorf("second up applied %d migrations, want none", len(again))
+	}
+
+	// Every migration after the baseline can be reverted and applied again
+	reverted, err := migrator.Down(len(statuses))
+	if err == nil {
+		t.Error("down past the baseline succeeded, want an error for its missing down script")
+	}
+	if len(reverted) != len(statuses)-1 {
+		t.Errorf("down reverted %d migrations, want %d", len(reverted), len(statuses)-1)
+	}
+	reapplied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("up after down: %v", err)
+	}
+	if len(reapplied) != len(reverted) {
+		t.Errorf("up after down applied %d migrations, want %d", len(reapplied), len(reverted))
+	}
+
+	// Placeholders are rebound by the driver, including next to literals
+	// that contain a question mark
+	var name string
+	err = db.QueryRow("SELECT CAST(? AS TEXT) || '?'", "9A").Scan(&name)
+	if err != nil {
+		t.Fatalf("rebound query: %v", err)
+	}
+	if name != "9A?" {
+		t.Errorf("rebound query = %q, want %q", name, "9A?")
+	}
+}
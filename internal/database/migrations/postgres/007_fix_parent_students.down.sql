@@ -0,0 +1,2 @@
+-- Revert migration 007
+-- 007 changes nothing on PostgreSQL, so there is nothing to undo here
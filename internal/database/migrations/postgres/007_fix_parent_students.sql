@@ -0,0 +1,3 @@
+-- Migration 007: Fix parent_students to allow multiple parents per student
+-- On PostgreSQL, 006 already creates parent_students without UNIQUE(student_id),
+-- so there is nothing to change. Kept so versions match the SQLite set.
@@ -0,0 +1,2 @@
+-- Revert migration 008
+-- 008 changes nothing on PostgreSQL, so there is nothing to undo here
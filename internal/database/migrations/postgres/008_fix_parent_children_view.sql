@@ -0,0 +1,3 @@
+-- Migration 008: Fix v_parent_children view column names
+-- On PostgreSQL, 006 already creates the view with the corrected column names,
+-- so there is nothing to change. Kept so versions match the SQLite set.
@@ -0,0 +1,2 @@
+-- Revert migration 010
+DROP TABLE IF EXISTS processed_updates;
@@ -0,0 +1,9 @@
+-- Migration 010: Recently processed Telegram update IDs
+-- Used to drop webhook retries so they don't create duplicate records
+
+CREATE TABLE IF NOT EXISTS processed_updates (
+    update_id BIGINT PRIMARY KEY,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_updates_received ON processed_updates(received_at);
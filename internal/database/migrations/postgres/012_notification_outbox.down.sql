@@ -0,0 +1,4 @@
+-- Revert migration 012
+DROP TABLE IF EXISTS unreachable_chats;
+DROP INDEX IF EXISTS idx_notification_outbox_pending;
+DROP TABLE IF EXISTS notification_outbox;
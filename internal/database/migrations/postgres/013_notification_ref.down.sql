@@ -0,0 +1,3 @@
+-- Revert migration 013
+DROP INDEX IF EXISTS idx_notification_outbox_ref;
+ALTER TABLE notification_outbox DROP COLUMN ref;
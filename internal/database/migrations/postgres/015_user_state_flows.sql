@@ -0,0 +1,8 @@
+-- Migration 015: Conversation flows
+-- A state's data belongs to the flow the state is part of, saved by a given
+-- version of that flow. Unfinished flows expire. Rows saved before this
+-- migration keep flow '' and version 0 and are upgraded when next read.
+
+ALTER TABLE user_states ADD COLUMN flow TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_states ADD COLUMN flow_version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_states ADD COLUMN expires_at TIMESTAMPTZ;
@@ -0,0 +1,6 @@
+-- Migration 016: User state revisions
+-- Every write of a user's state bumps its revision. A write only succeeds
+-- while the row is still at the revision the writer read, so two updates or
+-- two bot instances can't silently overwrite each other's state.
+
+ALTER TABLE user_states ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- Migration 019: Announcement delivery enqueue time
+-- Every recipient of an announcement is recorded before any of them is
+-- queued in the outbox. Rows still without enqueued_at when the bot stops
+-- are queued when it starts again.
+
+ALTER TABLE announcement_deliveries ADD COLUMN enqueued_at TIMESTAMPTZ;
+
+-- Deliveries recorded so far were queued as they were recorded
+UPDATE announcement_deliveries SET enqueued_at = queued_at;
@@ -0,0 +1,2 @@
+-- Revert migration 020
+DROP TABLE IF EXISTS broadcasts;
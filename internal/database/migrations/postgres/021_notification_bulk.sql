@@ -0,0 +1,10 @@
+-- Migration 021: Bulk notifications
+-- Broadcasts to many chats are marked bulk and sent after every other
+-- pending notification, so an alert such as an absence is not held up
+-- behind a large announcement
+
+ALTER TABLE notification_outbox ADD COLUMN bulk BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The sender looks up the next pending notification of each chat, bulk last
+DROP INDEX IF EXISTS idx_notification_outbox_pending;
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_pending ON notification_outbox(status, chat_id, bulk, id);
@@ -0,0 +1,70 @@
+-- Revert migration 007: restore UNIQUE constraint on parent_students.student_id
+-- Fails if any student is already linked to more than one parent
+
+DROP VIEW IF EXISTS v_parent_children;
+DROP VIEW IF EXISTS v_students_with_parent;
+DROP TABLE IF EXISTS parent_students_old;
+
+CREATE TABLE parent_students_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parent_id INTEGER NOT NULL,
+    student_id INTEGER NOT NULL UNIQUE,
+    linked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (parent_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+    UNIQUE(parent_id, student_id)
+);
+
+INSERT INTO parent_students_old (id, parent_id, student_id, linked_at)
+SELECT id, parent_id, student_id, linked_at FROM parent_students;
+
+DROP TABLE parent_students;
+
+ALTER TABLE parent_students_old RENAME TO parent_students;
+
+CREATE INDEX idx_parent_students_parent ON parent_students(parent_id);
+CREATE INDEX idx_parent_students_student ON parent_students(student_id);
+
+CREATE TRIGGER enforce_max_children
+BEFORE INSERT ON parent_students
+FOR EACH ROW
+BEGIN
+    SELECT CASE
+        WHEN (SELECT COUNT(*) FROM parent_students WHERE parent_id = NEW.parent_id) >= 4
+        THEN RAISE(ABORT, 'A parent cannot have more than 4 children')
+    END;
+END;
+
+CREATE VIEW v_parent_children AS
+SELECT
+    ps.id,
+    ps.parent_id,
+    u.telegram_id,
+    u.phone_number,
+    ps.student_id,
+    s.first_name as student_first_name,
+    s.last_name as student_last_name,
+    s.class_id,
+    c.class_name,
+    ps.linked_at
+FROM parent_students ps
+JOIN users u ON ps.parent_id = u.id
+JOIN students s ON ps.student_id = s.id
+JOIN classes c ON s.class_id = c.id;
+
+CREATE VIEW v_students_with_parent AS
+SELECT
+    s.id,
+    s.first_name,
+    s.last_name,
+    s.class_id,
+    c.class_name,
+    s.is_active,
+    ps.parent_id,
+    u.telegram_id as parent_telegram_id,
+    u.phone_number as parent_phone,
+    u.telegram_username as parent_username
+FROM students s
+JOIN classes c ON s.class_id = c.id
+LEFT JOIN parent_students ps ON s.id = ps.student_id
+LEFT JOIN users u ON ps.parent_id = u.id;
@@ -1,6 +1,12 @@
 -- Migration 007: Fix parent_students to allow multiple parents per student
 -- Remove UNIQUE constraint on student_id to allow both mother and father to link
 
+-- Step 0: Drop views that reference parent_students (SQLite refuses to rename
+-- a table while a view points at it) and any leftover from a failed run
+DROP VIEW IF EXISTS v_parent_children;
+DROP VIEW IF EXISTS v_students_with_parent;
+DROP TABLE IF EXISTS parent_students_new;
+
 -- Step 1: Create new table with correct schema
 CREATE TABLE parent_students_new (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -36,3 +42,21 @@ BEGIN
         THEN RAISE(ABORT, 'A parent cannot have more than 4 children')
     END;
 END;
+
+-- Step 7: Recreate view dropped in step 0 (v_parent_children is recreated by 008)
+CREATE VIEW v_students_with_parent AS
+SELECT
+    s.id,
+    s.first_name,
+    s.last_name,
+    s.class_id,
+    c.class_name,
+    s.is_active,
+    ps.parent_id,
+    u.telegram_id as parent_telegram_id,
+    u.phone_number as parent_phone,
+    u.telegram_username as parent_username
+FROM students s
+JOIN classes c ON s.class_id = c.id
+LEFT JOIN parent_students ps ON s.id = ps.student_id
+LEFT JOIN users u ON ps.parent_id = u.id;
@@ -0,0 +1,3 @@
+-- Revert migration 008
+-- The view definition in 006 already uses the corrected column names and
+-- 007.down recreates it, so there is nothing to undo here
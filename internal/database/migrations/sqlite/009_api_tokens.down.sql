@@ -0,0 +1,2 @@
+-- Revert migration 009
+DROP TABLE IF EXISTS api_tokens;
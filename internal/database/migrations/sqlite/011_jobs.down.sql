@@ -0,0 +1,2 @@
+-- Revert migration 011
+DROP TABLE IF EXISTS jobs;
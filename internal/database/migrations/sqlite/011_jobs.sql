@@ -0,0 +1,16 @@
+-- Migration 011: Background job run history
+-- One row per scheduled job; next_run_at lets missed runs be caught up after a restart
+
+CREATE TABLE IF NOT EXISTS jobs (
+    name TEXT PRIMARY KEY,
+    schedule TEXT NOT NULL,
+    next_run_at DATETIME,
+    last_started_at DATETIME,
+    last_finished_at DATETIME,
+    last_status TEXT NOT NULL DEFAULT '' CHECK (last_status IN ('', 'running', 'ok', 'failed')),
+    last_trigger TEXT NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT '',
+    run_count INTEGER NOT NULL DEFAULT 0,
+    failure_count INTEGER NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
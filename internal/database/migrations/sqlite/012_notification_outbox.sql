@@ -0,0 +1,28 @@
+-- Migration 012: Notification outbox
+-- Notifications are queued here and delivered by a background sender, in
+-- order per chat, with retries; chats that blocked the bot are remembered
+
+CREATE TABLE IF NOT EXISTS notification_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    text TEXT NOT NULL,
+    file_id TEXT NOT NULL DEFAULT '',
+    media_type TEXT NOT NULL DEFAULT '' CHECK (media_type IN ('', 'document', 'photo')),
+    reply_markup TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed', 'unreachable')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at DATETIME
+);
+
+-- The sender looks up the oldest pending notification of each chat
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_pending ON notification_outbox(status, chat_id, id);
+
+CREATE TABLE IF NOT EXISTS unreachable_chats (
+    chat_id INTEGER PRIMARY KEY,
+    reason TEXT NOT NULL,
+    marked_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
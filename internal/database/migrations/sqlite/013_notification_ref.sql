@@ -0,0 +1,7 @@
+-- Migration 013: Notification references
+-- Notifications sent for the same thing, such as one announcement broadcast,
+-- share a reference so their progress can be counted together
+
+ALTER TABLE notification_outbox ADD COLUMN ref TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_ref ON notification_outbox(ref, status);
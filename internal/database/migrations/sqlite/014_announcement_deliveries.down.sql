@@ -0,0 +1,4 @@
+-- Revert migration 014
+DROP INDEX IF EXISTS idx_announcement_deliveries_status;
+DROP INDEX IF EXISTS idx_announcement_deliveries_chat;
+DROP TABLE IF EXISTS announcement_deliveries;
@@ -0,0 +1,22 @@
+-- Migration 014: Announcement deliveries
+-- One row per parent an announcement was sent to, updated as the outbox
+-- delivers it, so authors can see who got it and resend to who did not
+
+CREATE TABLE IF NOT EXISTS announcement_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    announcement_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    chat_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'sent', 'failed', 'blocked')),
+    error TEXT NOT NULL DEFAULT '',
+    queued_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at DATETIME,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (announcement_id) REFERENCES announcements(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (announcement_id, user_id)
+);
+
+-- Delivery results are matched by announcement and chat
+CREATE INDEX IF NOT EXISTS idx_announcement_deliveries_chat ON announcement_deliveries(announcement_id, chat_id);
+CREATE INDEX IF NOT EXISTS idx_announcement_deliveries_status ON announcement_deliveries(announcement_id, status);
@@ -0,0 +1,4 @@
+-- Revert migration 015
+ALTER TABLE user_states DROP COLUMN expires_at;
+ALTER TABLE user_states DROP COLUMN flow_version;
+ALTER TABLE user_states DROP COLUMN flow;
@@ -0,0 +1,2 @@
+-- Revert migration 016
+ALTER TABLE user_states DROP COLUMN revision;
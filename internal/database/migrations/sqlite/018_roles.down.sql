@@ -0,0 +1,4 @@
+-- Revert migration 018
+DROP TABLE IF EXISTS role_permissions;
+ALTER TABLE teachers DROP COLUMN role;
+ALTER TABLE admins DROP COLUMN role;
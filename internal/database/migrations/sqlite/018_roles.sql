@@ -0,0 +1,58 @@
+-- Migration 018: Roles and permissions
+-- Admins get a staff role (super_admin, admin, deputy_director, inspector)
+-- and teachers a teacher role (class_teacher, subject_teacher). What each role
+-- may do is granted in role_permissions, which super-admins edit in the bot.
+-- super_admin has every permission and has no rows. Existing admins and
+-- teachers keep what they could do before.
+
+ALTER TABLE admins ADD COLUMN role TEXT NOT NULL DEFAULT 'admin';
+ALTER TABLE teachers ADD COLUMN role TEXT NOT NULL DEFAULT 'class_teacher';
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role TEXT NOT NULL,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'classes.manage'),
+    ('admin', 'students.manage'),
+    ('admin', 'teachers.manage'),
+    ('admin', 'timetables.manage'),
+    ('admin', 'announcements.manage'),
+    ('admin', 'complaints.view'),
+    ('admin', 'users.view'),
+    ('admin', 'stats.view'),
+    ('admin', 'attendance.view'),
+    ('admin', 'grades.view'),
+    ('admin', 'reports.export'),
+    ('admin', 'jobs.manage'),
+    ('admin', 'audit.view'),
+    ('admin', 'api_tokens.manage'),
+
+    ('deputy_director', 'students.manage'),
+    ('deputy_director', 'timetables.manage'),
+    ('deputy_director', 'announcements.manage'),
+    ('deputy_director', 'complaints.view'),
+    ('deputy_director', 'users.view'),
+    ('deputy_director', 'stats.view'),
+    ('deputy_director', 'attendance.view'),
+    ('deputy_director', 'grades.view'),
+    ('deputy_director', 'reports.export'),
+    ('deputy_director', 'audit.view'),
+
+    ('inspector', 'complaints.view'),
+    ('inspector', 'users.view'),
+    ('inspector', 'stats.view'),
+    ('inspector', 'attendance.view'),
+    ('inspector', 'grades.view'),
+    ('inspector', 'reports.export'),
+    ('inspector', 'audit.view'),
+
+    ('class_teacher', 'attendance.mark'),
+    ('class_teacher', 'grades.edit'),
+    ('class_teacher', 'class_students.manage'),
+    ('class_teacher', 'class_announcements.post'),
+
+    ('subject_teacher', 'attendance.mark'),
+    ('subject_teacher', 'grades.edit');
@@ -0,0 +1,2 @@
+-- Revert migration 019
+ALTER TABLE announcement_deliveries DROP COLUMN enqueued_at;
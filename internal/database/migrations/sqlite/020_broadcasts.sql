@@ -0,0 +1,10 @@
+-- Migration 020: Broadcasts
+-- Recipients who blocked the bot are skipped by a broadcast and never reach
+-- the outbox; their count is kept per broadcast so it survives a resume
+
+CREATE TABLE IF NOT EXISTS broadcasts (
+    ref TEXT PRIMARY KEY,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
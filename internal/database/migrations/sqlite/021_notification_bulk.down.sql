@@ -0,0 +1,4 @@
+-- Revert migration 021
+DROP INDEX IF EXISTS idx_notification_outbox_pending;
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_pending ON notification_outbox(status, chat_id, id);
+ALTER TABLE notification_outbox DROP COLUMN bulk;
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DBTX is what repositories run statements on: the connection pool, or a
+// transaction shared by a unit of work. Both *sql.DB and *sql.Tx satisfy it.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// UnitOfWork runs several repository calls as one all-or-nothing operation.
+// Repositories join the transaction through their WithTx method.
+type UnitOfWork struct {
+	db *sql.DB
+}
+
+// NewUnitOfWork creates a unit of work on the connection pool
+func NewUnitOfWork(db *sql.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+// Do runs fn in a transaction, committing it if fn returns nil and rolling it
+// back otherwise. Inside fn, use only repositories bound with WithTx(tx): the
+// SQLite pool has a single connection, which the transaction holds until Do
+// returns, so a statement on the pool would wait forever.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// InTx runs fn in db's transaction when db is already one, and otherwise in
+// a new transaction on the pool. Repository methods that write several rows
+// use it so they are atomic on their own and also join a caller's unit of work.
+func InTx(ctx context.Context, db DBTX, fn func(tx *sql.Tx) error) error {
+	switch db := db.(type) {
+	case *sql.Tx:
+		return fn(db)
+	case *sql.DB:
+		return NewUnitOfWork(db).Do(ctx, fn)
+	default:
+		return fmt.Errorf("cannot start a transaction on %T", db)
+	}
+}
@@ -0,0 +1,163 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// HandlerFunc processes a single update. ctx is cancelled when Stop gives up
+// waiting for in-flight updates.
+type HandlerFunc func(ctx context.Context, update tgbotapi.Update)
+
+// Dispatcher runs updates on a fixed pool of workers.
+// Updates are sharded by chat ID so that one chat is always handled by the
+// same worker, which keeps a user's messages (and state transitions) in order.
+type Dispatcher struct {
+	handler HandlerFunc
+	queues  []chan tgbotapi.Update
+	wg      sync.WaitGroup
+	ctx     context.Context // passed to handlers; cancelled when Stop times out
+	cancel  context.CancelFunc
+
+	mu      sync.RWMutex
+	stopped bool
+	done    chan struct{}  // closed when Stop is called, to unblock Submit
+	submits sync.WaitGroup // Submit calls that may still send to a queue
+}
+
+// New creates a dispatcher with the given number of workers and per-worker queue size
+func New(handler HandlerFunc, workers, queueSize int) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	d := &Dispatcher{
+		handler: handler,
+		queues:  make([]chan tgbotapi.Update, workers),
+		done:    make(chan struct{}),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+
+	for i := range d.queues {
+		d.queues[i] = make(chan tgbotapi.Update, queueSize)
+	}
+
+	return d
+}
+
+// Start launches the worker goroutines
+func (d *Dispatcher) Start() {
+	for i, queue := range d.queues {
+		d.wg.Add(1)
+		go d.worker(i, queue)
+	}
+}
+
+// Submit enqueues an update. It blocks while the target worker's queue is
+// full and returns false if the dispatcher is stopped or ctx is done first.
+func (d *Dispatcher) Submit(ctx context.Context, update tgbotapi.Update) bool {
+	d.mu.RLock()
+	if d.stopped {
+		d.mu.RUnlock()
+		return false
+	}
+	d.submits.Add(1)
+	d.mu.RUnlock()
+	defer d.submits.Done()
+
+	select {
+	case d.queues[d.shard(update)] <- update:
+		return true
+	case <-d.done:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Stop stops accepting updates and waits for queued work to finish.
+// If ctx expires first, the context of in-flight handlers is cancelled so
+// their database calls return, and an error is returned.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	first := !d.stopped
+	if first {
+		d.stopped = true
+		close(d.done)
+	}
+	d.mu.Unlock()
+
+	// Queues are closed once no Submit can send to them any more
+	if first {
+		go func() {
+			d.submits.Wait()
+			for _, queue := range d.queues {
+				close(queue)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		return fmt.Errorf("dispatcher did not drain in time: %w", ctx.Err())
+	}
+}
+
+// shard picks the worker for an update based on its chat (or sender) ID
+func (d *Dispatcher) shard(update tgbotapi.Update) int {
+	var key int64
+	if chat := update.FromChat(); chat != nil {
+		key = chat.ID
+	} else if user := update.SentFrom(); user != nil {
+		key = user.ID
+	}
+
+	if key < 0 {
+		key = -key
+	}
+
+	return int(key % int64(len(d.queues)))
+}
+
+// worker processes updates from its queue until the queue is closed
+func (d *Dispatcher) worker(id int, queue <-chan tgbotapi.Update) {
+	defer d.wg.Done()
+
+	for update := range queue {
+		d.handle(id, update)
+	}
+}
+
+// handle runs the handler and keeps the worker alive if it panics
+func (d *Dispatcher) handle(workerID int, update tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic handling update",
+				"worker", workerID,
+				"update_id", update.UpdateID,
+				"panic", r,
+				"stack", string(debug.Stack()),
+			)
+		}
+	}()
+
+	d.handler(d.ctx, update)
+}
@@ -0,0 +1,173 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// updateIn builds an update from a chat
+func updateIn(chatID int64, id int) tgbotapi.Update {
+	return tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}}}
+}
+
+func TestChatOrderIsKept(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[int64][]int{}
+
+	d := New(func(_ context.Context, u tgbotapi.Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[u.Message.Chat.ID] = append(seen[u.Message.Chat.ID], u.UpdateID)
+	}, 4, 8)
+	d.Start()
+
+	chats := []int64{1, 2, 3, -100500}
+	for i := 0; i < 200; i++ {
+		if !d.Submit(context.Background(), updateIn(chats[i%len(chats)], i)) {
+			t.Fatalf("update %d refused", i)
+		}
+	}
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, chat := range chats {
+		ids := seen[chat]
+		if len(ids) != 50 {
+			t.Errorf("chat %d: handled %d updates, want 50", chat, len(ids))
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Errorf("chat %d: update %d handled after %d", chat, ids[i], ids[i-1])
+			}
+		}
+	}
+}
+
+func TestWorkersAreBounded(t *testing.T) {
+	var running, peak atomic.Int32
+
+	d := New(func(context.Context, tgbotapi.Update) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+	}, 3, 4)
+	d.Start()
+
+	for i := 0; i < 60; i++ {
+		d.Submit(context.Background(), updateIn(int64(i), i))
+	}
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := peak.Load(); p > 3 {
+		t.Errorf("%d updates handled at once, want at most 3", p)
+	}
+}
+
+func TestStopDrainsQueuedUpdates(t *testing.T) {
+	var handled atomic.Int32
+
+	d := New(func(context.Context, tgbotapi.Update) {
+		time.Sleep(time.Millisecond)
+		handled.Add(1)
+	}, 2, 50)
+	d.Start()
+
+	for i := 0; i < 40; i++ {
+		d.Submit(context.Background(), updateIn(int64(i), i))
+	}
+	if err := d.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := handled.Load(); n != 40 {
+		t.Errorf("handled %d updates, want 40", n)
+	}
+	if d.Submit(context.Background(), updateIn(1, 41)) {
+		t.Error("Submit accepted an update after Stop")
+	}
+}
+
+func TestSubmitGivesUpWithItsContext(t *testing.T) {
+	release := make(chan struct{})
+	d := New(func(context.Context, tgbotapi.Update) { <-release }, 1, 1)
+	d.Start()
+	defer func() {
+		close(release)
+		_ = d.Stop(context.Background())
+	}()
+
+	// One update is being handled and one waits in the queue
+	d.Submit(context.Background(), updateIn(1, 1))
+	d.Submit(context.Background(), updateIn(1, 2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if d.Submit(ctx, updateIn(1, 3)) {
+		t.Error("Submit accepted an update into a full queue")
+	}
+}
+
+// Run with -race: senders blocked on a full shard must not keep Stop past
+// its deadline, nor send on a closed queue
+func TestStopWhileShardIsFlooded(t *testing.T) {
+	d := New(func(ctx context.Context, _ tgbotapi.Update) {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Millisecond):
+		}
+	}, 2, 1)
+	d.Start()
+
+	var senders sync.WaitGroup
+	for s := 0; s < 8; s++ {
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			for i := 0; i < 1000; i++ {
+				// Chat 2 always lands on the same shard
+				if !d.Submit(context.Background(), updateIn(2, i)) {
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := d.Stop(ctx)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Stop took %s with a 50ms deadline", elapsed)
+	}
+
+	returned := make(chan struct{})
+	go func() {
+		senders.Wait()
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("Submit still blocked after Stop")
+	}
+}
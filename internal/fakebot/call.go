@@ -0,0 +1,79 @@
+package fakebot
+
+import (
+	"encoding/json"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Call is one recorded Bot API request
+type Call struct {
+	Method    string
+	ChatID    int64
+	MessageID int    // ID of the sent message, or of the edited/deleted one
+	Text      string // text or caption
+	Params    map[string]string
+	Files     []string // names of uploaded files
+}
+
+// InlineKeyboard returns the call's inline keyboard, or nil if it has none
+func (c Call) InlineKeyboard() *tgbotapi.InlineKeyboardMarkup {
+	var markup tgbotapi.InlineKeyboardMarkup
+	if !c.decodeMarkup(&markup) || markup.InlineKeyboard == nil {
+		return nil
+	}
+	return &markup
+}
+
+// ReplyKeyboard returns the call's reply keyboard, or nil if it has none
+func (c Call) ReplyKeyboard() *tgbotapi.ReplyKeyboardMarkup {
+	var markup tgbotapi.ReplyKeyboardMarkup
+	if !c.decodeMarkup(&markup) || markup.Keyboard == nil {
+		return nil
+	}
+	return &markup
+}
+
+// Buttons returns the text of every inline or reply keyboard button, row by row
+func (c Call) Buttons() []string {
+	var texts []string
+	if kb := c.InlineKeyboard(); kb != nil {
+		for _, row := range kb.InlineKeyboard {
+			for _, b := range row {
+				texts = append(texts, b.Text)
+			}
+		}
+	}
+	if kb := c.ReplyKeyboard(); kb != nil {
+		for _, row := range kb.Keyboard {
+			for _, b := range row {
+				texts = append(texts, b.Text)
+			}
+		}
+	}
+	return texts
+}
+
+// CallbackData returns the payload of the inline button with the given text
+func (c Call) CallbackData(text string) (string, bool) {
+	kb := c.InlineKeyboard()
+	if kb == nil {
+		return "", false
+	}
+	for _, row := range kb.InlineKeyboard {
+		for _, b := range row {
+			if b.Text == text && b.CallbackData != nil {
+				return *b.CallbackData, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (c Call) decodeMarkup(v any) bool {
+	raw := c.Params["reply_markup"]
+	if raw == "" {
+		return false
+	}
+	return json.Unmarshal([]byte(raw), v) == nil
+}
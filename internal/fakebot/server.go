@@ -0,0 +1,422 @@
+// Package fakebot is an in-process stand-in for the Telegram Bot API.
+//
+// It records every call the bot makes, answers with plausible results and
+// queues injected updates for getUpdates, so conversation flows can be
+// scripted end to end without network access:
+//
+//	srv := fakebot.NewServer()
+//	defer srv.Close()
+//	api, _ := srv.NewBotAPI()
+//	botService, _ := services.NewBotServiceWithMessenger(cfg, db, api, logger)
+//	handlers.HandleUpdate(ctx, botService, srv.Text(parent, "/start"))
+//	reply, _ := srv.LastTo(parent.ID)
+package fakebot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Token is the bot token the fake server accepts
+const Token = "123456:fake-token"
+
+// maxPoll caps how long getUpdates blocks so shutdown stays fast
+const maxPoll = time.Second
+
+// failure is a canned error response for the next call to a method
+type failure struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+// Server is a fake Bot API HTTP server
+type Server struct {
+	Bot tgbotapi.User // returned by getMe
+
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	calls         []Call
+	updates       []tgbotapi.Update // queued for getUpdates
+	failures      map[string][]failure
+	nextUpdateID  int
+	nextMessageID int
+	nextFileID    int
+	nextQueryID   int
+	wake          chan struct{} // closed when an update is injected
+}
+
+// NewServer starts a fake Bot API server on a local port
+func NewServer() *Server {
+	s := &Server{
+		Bot: tgbotapi.User{
+			ID:        123456,
+			IsBot:     true,
+			FirstName: "Fake Bot",
+			UserName:  "fake_bot",
+		},
+		failures: make(map[string][]failure),
+		wake:     make(chan struct{}),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Endpoint returns the API endpoint format for tgbotapi.NewBotAPIWithAPIEndpoint
+// and the TELEGRAM_API_ENDPOINT setting
+func (s *Server) Endpoint() string {
+	return s.srv.URL + "/bot%s/%s"
+}
+
+// NewBotAPI returns a real Bot API client talking to this server
+func (s *Server) NewBotAPI() (*tgbotapi.BotAPI, error) {
+	return tgbotapi.NewBotAPIWithAPIEndpoint(Token, s.Endpoint())
+}
+
+// Calls returns every recorded call except getMe and getUpdates, oldest first
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// CallsTo returns the recorded calls addressed to a chat
+func (s *Server) CallsTo(chatID int64) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var calls []Call
+	for _, c := range s.calls {
+		if c.ChatID == chatID {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// LastTo returns the most recent message sent to or edited in a chat
+func (s *Server) LastTo(chatID int64) (Call, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.calls) - 1; i >= 0; i-- {
+		c := s.calls[i]
+		if c.ChatID == chatID && c.Text != "" {
+			return c, true
+		}
+	}
+	return Call{}, false
+}
+
+// Reset forgets all recorded calls
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = nil
+}
+
+// FailNext makes the next call to method fail with the given Bot API error.
+// A positive retryAfter is reported as parameters.retry_after, as Telegram does for 429.
+func (s *Server) FailNext(method string, code int, description string, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method] = append(s.failures[method], failure{code, description, retryAfter})
+}
+
+// Inject queues an update for getUpdates. Updates without an ID get the next one.
+func (s *Server) Inject(update tgbotapi.Update) tgbotapi.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if update.UpdateID == 0 {
+		s.nextUpdateID++
+		update.UpdateID = s.nextUpdateID
+	}
+	s.updates = append(s.updates, update)
+
+	close(s.wake)
+	s.wake = make(chan struct{})
+
+	return update
+}
+
+// Text builds a private-chat text message update. Text starting with "/" is marked as a command.
+func (s *Server) Text(from tgbotapi.User, text string) tgbotapi.Update {
+	msg := s.message(from)
+	msg.Text = text
+
+	if strings.HasPrefix(text, "/") {
+		length := len(text)
+		if i := strings.IndexByte(text, ' '); i > 0 {
+			length = i
+		}
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+
+	return s.update(tgbotapi.Update{Message: msg})
+}
+
+// Contact builds an update sharing the sender's own phone number
+func (s *Server) Contact(from tgbotapi.User, phone string) tgbotapi.Update {
+	msg := s.message(from)
+	msg.Contact = &tgbotapi.Contact{
+		PhoneNumber: phone,
+		FirstName:   from.FirstName,
+		LastName:    from.LastName,
+		UserID:      from.ID,
+	}
+
+	return s.update(tgbotapi.Update{Message: msg})
+}
+
+// Press builds a callback query update for an inline button on a message the bot sent
+func (s *Server) Press(from tgbotapi.User, messageID int, data string) tgbotapi.Update {
+	msg := s.message(from)
+	msg.MessageID = messageID
+	msg.From = &s.Bot
+
+	s.mu.Lock()
+	s.nextQueryID++
+	id := fmt.Sprintf("query-%d", s.nextQueryID)
+	s.mu.Unlock()
+
+	return s.update(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:           id,
+		From:         &from,
+		Message:      msg,
+		ChatInstance: strconv.FormatInt(from.ID, 10),
+		Data:         data,
+	}})
+}
+
+// message builds an incoming private message from a user
+func (s *Server) message(from tgbotapi.User) *tgbotapi.Message {
+	s.mu.Lock()
+	s.nextMessageID++
+	id := s.nextMessageID
+	s.mu.Unlock()
+
+	return &tgbotapi.Message{
+		MessageID: id,
+		From:      &from,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: from.ID, Type: "private", FirstName: from.FirstName, UserName: from.UserName},
+	}
+}
+
+// update assigns the next update ID without queueing the update
+func (s *Server) update(u tgbotapi.Update) tgbotapi.Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextUpdateID++
+	u.UpdateID = s.nextUpdateID
+	return u
+}
+
+// serveHTTP handles /bot<token>/<method>
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/bot")
+	token, method, ok := strings.Cut(path, "/")
+	if !ok || token != Token {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"ok": false, "error_code": 401, "description": "Unauthorized"})
+		return
+	}
+
+	call, err := parseCall(method, r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error_code": 400, "description": err.Error()})
+		return
+	}
+
+	switch method {
+	case "getMe":
+		writeResult(w, s.Bot)
+		return
+	case "getUpdates":
+		writeResult(w, s.pollUpdates(r, call))
+		return
+	}
+
+	s.mu.Lock()
+	if queued := s.failures[method]; len(queued) > 0 {
+		f := queued[0]
+		s.failures[method] = queued[1:]
+		s.mu.Unlock()
+		writeFailure(w, f)
+		return
+	}
+	result := s.result(&call)
+	s.calls = append(s.calls, call)
+	s.mu.Unlock()
+
+	writeResult(w, result)
+}
+
+// result builds the method's response and fills in IDs on the call. s.mu must be held.
+func (s *Server) result(call *Call) any {
+	switch call.Method {
+	case "sendMessage", "sendDocument", "sendPhoto":
+		s.nextMessageID++
+		call.MessageID = s.nextMessageID
+		msg := s.sentMessage(call)
+
+		if call.Method == "sendDocument" {
+			fileID := s.fileID(call.Params["document"], call.Files)
+			msg.Document = &tgbotapi.Document{FileID: fileID, FileUniqueID: fileID, FileName: firstOr(call.Files, "")}
+		}
+		if call.Method == "sendPhoto" {
+			fileID := s.fileID(call.Params["photo"], call.Files)
+			msg.Photo = []tgbotapi.PhotoSize{{FileID: fileID, FileUniqueID: fileID}}
+		}
+		return msg
+
+	case "editMessageText", "editMessageCaption", "editMessageReplyMarkup":
+		return s.sentMessage(call)
+
+	case "getFile":
+		fileID := call.Params["file_id"]
+		return tgbotapi.File{FileID: fileID, FileUniqueID: fileID, FilePath: "documents/" + fileID}
+
+	default:
+		return true
+	}
+}
+
+// sentMessage is the message Telegram would return for a send or edit call
+func (s *Server) sentMessage(call *Call) *tgbotapi.Message {
+	msg := &tgbotapi.Message{
+		MessageID: call.MessageID,
+		From:      &s.Bot,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: call.ChatID, Type: "private"},
+	}
+	if call.Method == "sendMessage" || call.Method == "editMessageText" {
+		msg.Text = call.Text
+	} else {
+		msg.Caption = call.Text
+	}
+	return msg
+}
+
+// fileID returns the referenced file ID, or a new one for an upload
+func (s *Server) fileID(param string, uploads []string) string {
+	if len(uploads) == 0 && param != "" {
+		return param
+	}
+	s.nextFileID++
+	return fmt.Sprintf("file-%d", s.nextFileID)
+}
+
+// pollUpdates implements getUpdates: it acknowledges updates below offset
+// and waits briefly for new ones when none are pending
+func (s *Server) pollUpdates(r *http.Request, call Call) []tgbotapi.Update {
+	offset, _ := strconv.Atoi(call.Params["offset"])
+	timeout, _ := strconv.Atoi(call.Params["timeout"])
+
+	wait := time.Duration(timeout) * time.Second
+	if wait > maxPoll {
+		wait = maxPoll
+	}
+	deadline := time.After(wait)
+
+	for {
+		s.mu.Lock()
+		pending := s.updates[:0]
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				pending = append(pending, u)
+			}
+		}
+		s.updates = pending
+		wake := s.wake
+		result := append([]tgbotapi.Update{}, pending...)
+		s.mu.Unlock()
+
+		if len(result) > 0 {
+			return result
+		}
+
+		select {
+		case <-wake:
+		case <-deadline:
+			return result
+		case <-r.Context().Done():
+			return result
+		}
+	}
+}
+
+// parseCall reads a form or multipart Bot API request
+func parseCall(method string, r *http.Request) (Call, error) {
+	call := Call{Method: method, Params: make(map[string]string)}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return call, fmt.Errorf("bad multipart body: %w", err)
+		}
+		for field, headers := range r.MultipartForm.File {
+			for _, h := range headers {
+				call.Files = append(call.Files, h.Filename)
+			}
+			call.Params[field] = "attach://" + field
+		}
+	} else if err := r.ParseForm(); err != nil {
+		return call, fmt.Errorf("bad form body: %w", err)
+	}
+
+	for key := range r.Form {
+		call.Params[key] = r.Form.Get(key)
+	}
+
+	call.ChatID, _ = strconv.ParseInt(call.Params["chat_id"], 10, 64)
+	call.MessageID, _ = strconv.Atoi(call.Params["message_id"])
+	call.Text = call.Params["text"]
+	if call.Text == "" {
+		call.Text = call.Params["caption"]
+	}
+
+	return call, nil
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "result": result})
+}
+
+func writeFailure(w http.ResponseWriter, f failure) {
+	body := map[string]any{"ok": false, "error_code": f.code, "description": f.description}
+	if f.retryAfter > 0 {
+		body["parameters"] = map[string]any{"retry_after": f.retryAfter}
+	}
+	writeJSON(w, f.code, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func firstOr(values []string, fallback string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return fallback
+}
@@ -1,11 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
@@ -13,31 +14,18 @@ import (
 )
 
 // HandleAdminCommand handles /admin command
-func HandleAdminCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleAdminCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
-	// Get user to extract phone number
-	// Note: If user hasn't registered yet, IsAdmin will check by telegram_id
-	// and also look up the user internally if needed
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	// Get user for language
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	// Extract phone number for admin check
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	// Check if user is admin (checks DB and config admin phones)
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
+	// Staff see the panel if their role grants any admin permission
+	if !authz.CallerFrom(ctx).HasAdminPanel() {
 		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -49,24 +37,24 @@ func HandleAdminCommand(botService *services.BotService, message *tgbotapi.Messa
 
 	// Show admin panel
 	text := i18n.Get(i18n.MsgAdminPanel, lang)
-	keyboard := utils.MakeAdminKeyboard(lang)
+	keyboard := utils.MakeAdminKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
 // HandleAdminUsersCallback handles admin users list callback
-func HandleAdminUsersCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminUsersCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	chatID := callback.Message.Chat.ID
 
 	// Get users
-	users, err := botService.UserService.GetAllUsers(20, 0)
+	users, err := botService.UserService.GetAllUsers(ctx, 20, 0)
 	if err != nil {
 		text := "Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Count total users
-	totalCount, _ := botService.UserService.CountUsers()
+	totalCount, _ := botService.UserService.CountUsers(ctx)
 
 	// Format user list
 	text := fmt.Sprintf("👥 Ro'yxatdan o'tgan foydalanuvchilar / Зарегистрированные пользователи\n\n")
@@ -81,7 +69,7 @@ func HandleAdminUsersCallback(botService *services.BotService, callback *tgbotap
 
 	for i, user := range users {
 		// Get children count for this parent
-		children, _ := botService.StudentService.GetParentStudents(user.ID)
+		children, _ := botService.StudentService.GetParentStudents(ctx, user.ID)
 		childrenCount := len(children)
 
 		text += fmt.Sprintf("%d. 📱 %s\n", i+1, user.PhoneNumber)
@@ -112,18 +100,18 @@ func HandleAdminUsersCallback(botService *services.BotService, callback *tgbotap
 }
 
 // HandleAdminComplaintsCallback handles admin complaints list callback
-func HandleAdminComplaintsCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminComplaintsCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	chatID := callback.Message.Chat.ID
 
 	// Get complaints with user info
-	complaints, err := botService.ComplaintService.GetAllComplaintsWithUser(10, 0)
+	complaints, err := botService.ComplaintService.GetAllComplaintsWithUser(ctx, 10, 0)
 	if err != nil {
 		text := "Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Count total complaints
-	totalCount, _ := botService.ComplaintService.CountComplaints()
+	totalCount, _ := botService.ComplaintService.CountComplaints(ctx)
 
 	// Format complaints list
 	text := fmt.Sprintf("📋 Shikoyatlar / Жалобы\n\n")
@@ -169,14 +157,14 @@ func HandleAdminComplaintsCallback(botService *services.BotService, callback *tg
 }
 
 // HandleAdminStatsCallback handles admin statistics callback
-func HandleAdminStatsCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminStatsCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	chatID := callback.Message.Chat.ID
 
 	// Get statistics
-	totalUsers, _ := botService.UserService.CountUsers()
-	totalComplaints, _ := botService.ComplaintService.CountComplaints()
-	pendingComplaints, _ := botService.ComplaintService.CountComplaintsByStatus(models.StatusPending)
-	reviewedComplaints, _ := botService.ComplaintService.CountComplaintsByStatus(models.StatusReviewed)
+	totalUsers, _ := botService.UserService.CountUsers(ctx)
+	totalComplaints, _ := botService.ComplaintService.CountComplaints(ctx)
+	pendingComplaints, _ := botService.ComplaintService.CountComplaintsByStatus(ctx, models.StatusPending)
+	reviewedComplaints, _ := botService.ComplaintService.CountComplaintsByStatus(ctx, models.StatusReviewed)
 
 	// Format statistics
 	text := "📊 Statistika / Статистика\n\n"
@@ -195,28 +183,17 @@ func HandleAdminStatsCallback(botService *services.BotService, callback *tgbotap
 }
 
 // HandleManageClassesCommand handles /manage_classes command
-func HandleManageClassesCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleManageClassesCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	if !isAdmin {
+	if !authz.CallerFrom(ctx).Permissions.HasAny(models.PermClassesManage, models.PermStudentsManage) {
 		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -227,7 +204,7 @@ func HandleManageClassesCommand(botService *services.BotService, message *tgbota
 	}
 
 	// Get all classes
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -264,32 +241,9 @@ func HandleManageClassesCommand(botService *services.BotService, message *tgbota
 }
 
 // HandleAddClassCommand handles /add_class command
-func HandleAddClassCommand(botService *services.BotService, message *tgbotapi.Message) error {
-	telegramID := message.From.ID
+func HandleAddClassCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	chatID := message.Chat.ID
 
-	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	// Parse class name from command
 	className := message.CommandArguments()
 	if className == "" {
@@ -301,7 +255,7 @@ func HandleAddClassCommand(botService *services.BotService, message *tgbotapi.Me
 	className = utils.SanitizeClassName(className)
 
 	// Create class
-	class, err := botService.ClassRepo.Create(className)
+	class, err := botService.ClassService.CreateClass(ctx, className)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -312,32 +266,9 @@ func HandleAddClassCommand(botService *services.BotService, message *tgbotapi.Me
 }
 
 // HandleDeleteClassCommand handles /delete_class command
-func HandleDeleteClassCommand(botService *services.BotService, message *tgbotapi.Message) error {
-	telegramID := message.From.ID
+func HandleDeleteClassCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	chatID := message.Chat.ID
 
-	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	// Parse class name from command
 	className := message.CommandArguments()
 	if className == "" {
@@ -346,7 +277,7 @@ func HandleDeleteClassCommand(botService *services.BotService, message *tgbotapi
 	}
 
 	// Delete class
-	err = botService.ClassRepo.Delete(className)
+	err := botService.ClassService.DeleteClassByName(ctx, className)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -357,32 +288,9 @@ func HandleDeleteClassCommand(botService *services.BotService, message *tgbotapi
 }
 
 // HandleToggleClassCommand handles /toggle_class command
-func HandleToggleClassCommand(botService *services.BotService, message *tgbotapi.Message) error {
-	telegramID := message.From.ID
+func HandleToggleClassCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	chatID := message.Chat.ID
 
-	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	// Parse class name from command
 	className := message.CommandArguments()
 	if className == "" {
@@ -391,7 +299,7 @@ func HandleToggleClassCommand(botService *services.BotService, message *tgbotapi
 	}
 
 	// Toggle class
-	err = botService.ClassRepo.ToggleActive(className)
+	err := botService.ClassService.ToggleClassActive(ctx, className)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -402,28 +310,17 @@ func HandleToggleClassCommand(botService *services.BotService, message *tgbotapi
 }
 
 // HandleAdminManageClassesCallback handles admin manage classes callback
-func HandleAdminManageClassesCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminManageClassesCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
+	if !authz.CallerFrom(ctx).Permissions.HasAny(models.PermClassesManage, models.PermStudentsManage) {
 		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
 		return nil
@@ -435,7 +332,7 @@ func HandleAdminManageClassesCallback(botService *services.BotService, callback
 	}
 
 	// Get all classes
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -511,37 +408,25 @@ func makeClassManagementKeyboard(classes []*models.Class, lang i18n.Language) tg
 }
 
 // HandleAdminViewClassCallback handles viewing class details with student management
-func HandleAdminViewClassCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleAdminViewClassCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	chatID := callback.Message.Chat.ID
 	telegramID := callback.From.ID
 
-	// Check if user is admin
-	user, _ := botService.UserService.GetUserByTelegramID(telegramID)
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, _ := botService.IsAdmin(phoneNumber, telegramID)
-	if !isAdmin {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Bu buyruq faqat ma'murlar uchun")
-		return nil
-	}
-
+	user, _ := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	lang := i18n.LanguageUzbek
 	if user != nil {
 		lang = i18n.GetLanguage(user.Language)
 	}
 
 	// Get class info
-	class, err := botService.ClassRepo.GetByID(classID)
+	class, err := botService.ClassRepo.GetByID(ctx, classID)
 	if err != nil {
 		text := "❌ Sinf topilmadi / Класс не найден"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get students in this class
-	students, err := botService.StudentService.GetStudentsByClassID(classID)
+	students, err := botService.StudentService.GetStudentsByClassID(ctx, classID)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -591,35 +476,22 @@ func HandleAdminViewClassCallback(botService *services.BotService, callback *tgb
 }
 
 // HandleAdminAddStudentCallback handles adding a student to a class (admin)
-func HandleAdminAddStudentCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleAdminAddStudentCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	chatID := callback.Message.Chat.ID
 	telegramID := callback.From.ID
 
-	// Check if user is admin
-	user, _ := botService.UserService.GetUserByTelegramID(telegramID)
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, _ := botService.IsAdmin(phoneNumber, telegramID)
-	if !isAdmin {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Bu buyruq faqat ma'murlar uchun")
-		return nil
-	}
-
 	// Get class info
-	class, err := botService.ClassRepo.GetByID(classID)
+	class, err := botService.ClassRepo.GetByID(ctx, classID)
 	if err != nil {
 		text := "❌ Sinf topilmadi / Класс не найден"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Set state for student name input (class already selected)
-	stateData := &models.StateData{
+	stateData := &models.StudentData{
 		ClassID: &classID,
 	}
-	err = botService.StateManager.Set(telegramID, "awaiting_admin_student_name", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingAdminStudentName, stateData)
 	if err != nil {
 		return err
 	}
@@ -647,42 +519,14 @@ func HandleAdminAddStudentCallback(botService *services.BotService, callback *tg
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleClassToggleCallback handles toggling class active status
-func HandleClassToggleCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
-	telegramID := callback.From.ID
-
-	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
-		text := "❌ Faqat ma'murlar uchun / Только для администраторов"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
-	// Extract class name from callback data
-	className := callback.Data[13:] // Remove "class_toggle_" prefix
-
+func HandleClassToggleCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, className string) error {
 	// Toggle class status
-	err = botService.ClassRepo.ToggleActive(className)
+	err := botService.ClassService.ToggleClassActive(ctx, className)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
@@ -693,58 +537,21 @@ func HandleClassToggleCallback(botService *services.BotService, callback *tgbota
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "✅ Holat o'zgartirildi / Статус изменен")
 
 	// Refresh the class management view
-	return HandleAdminManageClassesCallback(botService, callback)
+	return HandleAdminManageClassesCallback(ctx, botService, callback)
 }
 
 // HandleClassDeleteCallback handles deleting a class
-func HandleClassDeleteCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleClassDeleteCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	telegramID := callback.From.ID
 
-	// Debug log
-	fmt.Printf("[DEBUG] HandleClassDeleteCallback called. CallbackData: %s, UserID: %d\n", callback.Data, telegramID)
-
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
-		text := "❌ Faqat ma'murlar uchun / Только для администраторов"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
-	// Extract class ID from callback data
-	var classID int
-	n, err := fmt.Sscanf(callback.Data, "class_delete_%d", &classID)
-	fmt.Printf("[DEBUG] Parsed class ID: %d, n=%d, err=%v\n", classID, n, err)
-
-	if err != nil || n != 1 || classID == 0 {
-		text := "❌ Noto'g'ri ma'lumot / Неверные данные"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return fmt.Errorf("failed to parse class ID from callback data: %s", callback.Data)
-	}
-
 	// Delete class
-	fmt.Printf("[DEBUG] Attempting to delete class with ID: %d\n", classID)
-	err = botService.ClassRepo.DeleteByID(classID)
-	if err != nil {
-		fmt.Printf("[DEBUG] Delete failed: %v\n", err)
-	} else {
-		fmt.Printf("[DEBUG] Delete successful for class ID: %d\n", classID)
-	}
+	err = botService.ClassService.DeleteClass(ctx, classID)
 	if err != nil {
 		text := fmt.Sprintf("❌ Xatolik / Ошибка: %v", err)
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
@@ -761,7 +568,7 @@ func HandleClassDeleteCallback(botService *services.BotService, callback *tgbota
 	}
 
 	// Get updated list of classes
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		return err
 	}
@@ -797,42 +604,12 @@ func HandleClassDeleteCallback(botService *services.BotService, callback *tgbota
 }
 
 // HandleAdminCreateClassCallback handles admin create class callback
-func HandleAdminCreateClassCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminCreateClassCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
-	lang := i18n.LanguageUzbek
-	if user != nil {
-		lang = i18n.GetLanguage(user.Language)
-	}
-
 	// Set state to awaiting class name
-	err = botService.StateManager.Set(telegramID, models.StateAwaitingClassName, &models.StateData{
-		Language: string(lang),
-	})
+	err := botService.StateManager.Set(ctx, telegramID, models.StateAwaitingClassName, nil)
 	if err != nil {
 		return err
 	}
@@ -850,40 +627,23 @@ func HandleAdminCreateClassCallback(botService *services.BotService, callback *t
 }
 
 // HandleClassNameInput handles class name input from admin
-func HandleClassNameInput(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleClassNameInput(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Check if user cancelled
 	if message.Text == "/cancel" {
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		text := "❌ Bekor qilindi / Отменено"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		_ = botService.StateManager.Clear(telegramID)
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	// Validate and sanitize class name
 	className := utils.SanitizeClassName(message.Text)
 
@@ -893,7 +653,7 @@ func HandleClassNameInput(botService *services.BotService, message *tgbotapi.Mes
 	}
 
 	// Check if class already exists
-	exists, err := botService.ClassRepo.GetByName(className)
+	exists, err := botService.ClassRepo.GetByName(ctx, className)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -905,14 +665,14 @@ func HandleClassNameInput(botService *services.BotService, message *tgbotapi.Mes
 	}
 
 	// Create the class
-	class, err := botService.ClassRepo.Create(className)
+	class, err := botService.ClassService.CreateClass(ctx, className)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	lang := i18n.LanguageUzbek
 	if user != nil {
@@ -938,33 +698,16 @@ func HandleClassNameInput(botService *services.BotService, message *tgbotapi.Mes
 }
 
 // HandleAdminBackCallback handles going back to admin panel
-func HandleAdminBackCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminBackCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
 	lang := i18n.LanguageUzbek
 	if user != nil {
 		lang = i18n.GetLanguage(user.Language)
@@ -975,13 +718,13 @@ func HandleAdminBackCallback(botService *services.BotService, callback *tgbotapi
 
 	// Show admin panel
 	text := i18n.Get(i18n.MsgAdminPanel, lang)
-	keyboard := utils.MakeAdminKeyboard(lang)
+	keyboard := utils.MakeAdminKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
 // HandleAdminUploadTimetableCallback handles admin upload timetable callback
-func HandleAdminUploadTimetableCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminUploadTimetableCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	// Answer callback
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
@@ -993,11 +736,11 @@ func HandleAdminUploadTimetableCallback(botService *services.BotService, callbac
 		},
 	}
 
-	return HandleUploadTimetableCommand(botService, message)
+	return HandleUploadTimetableCommand(ctx, botService, message)
 }
 
 // HandleAdminPostAnnouncementCallback handles admin post announcement callback
-func HandleAdminPostAnnouncementCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminPostAnnouncementCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	// Answer callback
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
@@ -1009,22 +752,22 @@ func HandleAdminPostAnnouncementCallback(botService *services.BotService, callba
 		},
 	}
 
-	return HandlePostAnnouncementCommand(botService, message)
+	return HandlePostAnnouncementCommand(ctx, botService, message)
 }
 
 // HandleAdminProposalsCallback handles admin proposals list callback
-func HandleAdminProposalsCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminProposalsCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	chatID := callback.Message.Chat.ID
 
 	// Get proposals with user info
-	proposals, err := botService.ProposalService.GetAllProposals(10, 0)
+	proposals, err := botService.ProposalService.GetAllProposals(ctx, 10, 0)
 	if err != nil {
 		text := "Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Count total proposals
-	totalCount, _ := botService.ProposalService.CountProposals()
+	totalCount, _ := botService.ProposalService.CountProposals(ctx)
 
 	// Format proposals list
 	text := fmt.Sprintf("💡 Takliflar / Предложения\n\n")
@@ -1050,7 +793,7 @@ func HandleAdminProposalsCallback(botService *services.BotService, callback *tgb
 		}
 
 		// Get user info
-		user, _ := botService.UserService.GetUserByID(p.UserID)
+		user, _ := botService.UserService.GetUserByID(ctx, p.UserID)
 		userPhone := "N/A"
 		if user != nil {
 			userPhone = user.PhoneNumber
@@ -1073,47 +816,30 @@ func HandleAdminProposalsCallback(botService *services.BotService, callback *tgb
 }
 
 // HandleAdminViewTimetablesCallback handles admin view timetables callback
-func HandleAdminViewTimetablesCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminViewTimetablesCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
 	lang := i18n.LanguageUzbek
 	if user != nil {
 		lang = i18n.GetLanguage(user.Language)
 	}
 
 	// Get all timetables
-	timetables, err := botService.TimetableRepo.GetAll(50, 0)
+	timetables, err := botService.TimetableRepo.GetAll(ctx, 50, 0)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get all classes for mapping
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -1206,38 +932,9 @@ func makeTimetableManagementKeyboard(timetables []*models.Timetable, classMap ma
 }
 
 // HandleTimetableDeleteCallback handles deleting a timetable
-func HandleTimetableDeleteCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
-	telegramID := callback.From.ID
-
-	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return err
-	}
-
-	if !isAdmin {
-		text := "❌ Faqat ma'murlar uchun / Только для администраторов"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
-	// Extract timetable ID from callback data
-	var timetableID int
-	fmt.Sscanf(callback.Data, "timetable_delete_%d", &timetableID)
-
+func HandleTimetableDeleteCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, timetableID int) error {
 	// Delete timetable
-	err = botService.TimetableRepo.Delete(timetableID)
+	err := botService.TimetableService.DeleteTimetable(ctx, timetableID)
 	if err != nil {
 		text := "❌ Xatolik / Ошибка"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
@@ -1248,15 +945,15 @@ func HandleTimetableDeleteCallback(botService *services.BotService, callback *tg
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "✅ Dars jadvali o'chirildi / Расписание удалено")
 
 	// Refresh the timetable management view
-	return HandleAdminViewTimetablesCallback(botService, callback)
+	return HandleAdminViewTimetablesCallback(ctx, botService, callback)
 }
 
 // HandleAdminManageTeachersCallback handles admin manage teachers callback
-func HandleAdminManageTeachersCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminManageTeachersCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	chatID := callback.Message.Chat.ID
 
 	// Get all teachers
-	teachers, err := botService.TeacherRepo.GetAll(100, 0)
+	teachers, err := botService.TeacherRepo.GetAll(ctx, 100, 0)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -1317,18 +1014,18 @@ func HandleAdminManageTeachersCallback(botService *services.BotService, callback
 }
 
 // HandleAdminDeleteTeacherCallback handles admin delete teacher callback
-func HandleAdminDeleteTeacherCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, teacherID int) error {
+func HandleAdminDeleteTeacherCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, teacherID int) error {
 	// Get teacher info before deleting
-	teacher, err := botService.TeacherRepo.GetByID(teacherID)
+	teacher, err := botService.TeacherRepo.GetByID(ctx, teacherID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ O'qituvchi topilmadi")
 		return nil
 	}
 
 	// Delete the teacher
-	err = botService.TeacherRepo.Delete(teacherID)
+	err = botService.TeacherService.DeleteTeacher(ctx, teacherID)
 	if err != nil {
-		log.Printf("Failed to delete teacher %d: %v", teacherID, err)
+		botService.Log(callback.From.ID).Error("failed to delete teacher", "teacher_id", teacherID, "error", err)
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ O'chirishda xatolik")
 		return nil
 	}
@@ -1337,11 +1034,11 @@ func HandleAdminDeleteTeacherCallback(botService *services.BotService, callback
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, fmt.Sprintf("✅ %s %s o'chirildi", teacher.FirstName, teacher.LastName))
 
 	// Refresh the teacher list
-	return HandleAdminManageTeachersCallback(botService, callback)
+	return HandleAdminManageTeachersCallback(ctx, botService, callback)
 }
 
 // HandleAdminAddTeacherCallback handles admin add teacher callback
-func HandleAdminAddTeacherCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminAddTeacherCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	// Convert callback to message for the add teacher command
 	message := &tgbotapi.Message{
 		From: callback.From,
@@ -1351,17 +1048,17 @@ func HandleAdminAddTeacherCallback(botService *services.BotService, callback *tg
 	}
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
-	return HandleAddTeacherCommand(botService, message)
+	return HandleAddTeacherCommand(ctx, botService, message)
 }
 
 // HandleAdminExportAttendanceCallback handles admin export attendance callback
-func HandleAdminExportAttendanceCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminExportAttendanceCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	chatID := callback.Message.Chat.ID
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Get today's attendance for all classes
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -1372,9 +1069,8 @@ func HandleAdminExportAttendanceCallback(botService *services.BotService, callba
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
-	// Use Uzbekistan timezone to match attendance taking
-	location, _ := time.LoadLocation("Asia/Tashkent")
-	today := time.Now().In(location)
+	// Use the school's timezone to match attendance taking
+	today := time.Now().In(botService.Location)
 
 	text := fmt.Sprintf("📋 <b>Bugungi davomat / Сегодняшняя посещаемость</b>\n📅 <b>%s</b>\n\n", today.Format("02.01.2006"))
 
@@ -1383,7 +1079,7 @@ func HandleAdminExportAttendanceCallback(botService *services.BotService, callba
 
 	for _, class := range classes {
 		// Get today's attendance for this class
-		attendance, err := botService.AttendanceRepo.GetTodayAttendanceByClass(class.ID)
+		attendance, err := botService.AttendanceRepo.GetTodayAttendanceByClass(ctx, class.ID)
 		if err != nil {
 			continue
 		}
@@ -1426,13 +1122,13 @@ func HandleAdminExportAttendanceCallback(botService *services.BotService, callba
 }
 
 // HandleAdminExportTestResultsCallback handles admin export test results callback
-func HandleAdminExportTestResultsCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminExportTestResultsCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	chatID := callback.Message.Chat.ID
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Get all classes for selection
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -1469,13 +1165,13 @@ func HandleAdminExportTestResultsCallback(botService *services.BotService, callb
 }
 
 // HandleAdminExportGradesSelectClassCallback handles class selection for grade export
-func HandleAdminExportGradesSelectClassCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleAdminExportGradesSelectClassCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	chatID := callback.Message.Chat.ID
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Get class info
-	class, err := botService.ClassRepo.GetByID(classID)
+	class, err := botService.ClassRepo.GetByID(ctx, classID)
 	if err != nil || class == nil {
 		text := "❌ Sinf topilmadi / Класс не найден"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -1507,17 +1203,17 @@ func HandleAdminExportGradesSelectClassCallback(botService *services.BotService,
 }
 
 // HandleAdminExportGradesCustomDateCallback handles custom date input for grade export
-func HandleAdminExportGradesCustomDateCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleAdminExportGradesCustomDateCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Set state for custom date input
-	stateData := &models.StateData{
+	stateData := &models.ExportData{
 		ClassID: &classID,
 	}
-	_ = botService.StateManager.Set(telegramID, "admin_awaiting_export_custom_dates", stateData)
+	_ = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingExportCustomDates, stateData)
 
 	text := "📅 <b>Vaqt oralig'ini kiriting / Введите период</b>\n\n" +
 		"Format: <code>YYYY-MM-DD YYYY-MM-DD</code>\n\n" +
@@ -1527,12 +1223,12 @@ func HandleAdminExportGradesCustomDateCallback(botService *services.BotService,
 }
 
 // HandleAdminExportCustomDatesInput handles custom date input for exports
-func HandleAdminExportCustomDatesInput(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleAdminExportCustomDatesInput(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.ExportData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	if stateData.ClassID == nil {
 		text := "❌ Sessiya tugagan / Сессия истекла"
@@ -1540,14 +1236,14 @@ func HandleAdminExportCustomDatesInput(botService *services.BotService, message
 	}
 
 	// For now, just export all grades
-	return HandleAdminExportGradesCallback(botService, &tgbotapi.CallbackQuery{
+	return HandleAdminExportGradesCallback(ctx, botService, &tgbotapi.CallbackQuery{
 		From:    message.From,
 		Message: &tgbotapi.Message{Chat: message.Chat},
 	}, *stateData.ClassID)
 }
 
 // HandleAdminExportGradesCallback handles exporting grades for a class
-func HandleAdminExportGradesCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleAdminExportGradesCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	chatID := callback.Message.Chat.ID
 
 	if callback.ID != "" {
@@ -1555,14 +1251,14 @@ func HandleAdminExportGradesCallback(botService *services.BotService, callback *
 	}
 
 	// Get class info
-	class, err := botService.ClassRepo.GetByID(classID)
+	class, err := botService.ClassRepo.GetByID(ctx, classID)
 	if err != nil || class == nil {
 		text := "❌ Sinf topilmadi / Класс не найден"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get test results for the class
-	results, err := botService.TestResultRepo.GetAllByClassID(classID)
+	results, err := botService.TestResultRepo.GetAllByClassID(ctx, classID)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -1621,31 +1317,16 @@ func HandleAdminExportGradesCallback(botService *services.BotService, callback *
 }
 
 // HandleAdminDeleteStudentCallback handles deleting a student (admin)
-func HandleAdminDeleteStudentCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID, studentID int) error {
-	telegramID := callback.From.ID
-
-	// Check if user is admin
-	user, _ := botService.UserService.GetUserByTelegramID(telegramID)
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, _ := botService.IsAdmin(phoneNumber, telegramID)
-	if !isAdmin {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Faqat ma'murlar uchun")
-		return nil
-	}
-
+func HandleAdminDeleteStudentCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID, studentID int) error {
 	// Get student info before deleting
-	student, err := botService.StudentRepo.GetByID(studentID)
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil || student == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ O'quvchi topilmadi")
 		return nil
 	}
 
 	// Delete the student
-	err = botService.StudentRepo.Delete(studentID)
+	err = botService.StudentService.DeleteStudent(ctx, studentID)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik yuz berdi")
 		return nil
@@ -1655,5 +1336,5 @@ func HandleAdminDeleteStudentCallback(botService *services.BotService, callback
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, fmt.Sprintf("✅ %s %s o'chirildi", student.FirstName, student.LastName))
 
 	// Refresh the class view
-	return HandleAdminViewClassCallback(botService, callback, classID)
+	return HandleAdminViewClassCallback(ctx, botService, callback, classID)
 }
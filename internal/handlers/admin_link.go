@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
 	"parent-bot/internal/utils"
@@ -11,7 +13,7 @@ import (
 )
 
 // HandleAdminLinkCommand handles /admin_link command for admins to link their telegram account
-func HandleAdminLinkCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleAdminLinkCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -26,45 +28,46 @@ func HandleAdminLinkCommand(botService *services.BotService, message *tgbotapi.M
 	text += "Принимаются только номера администраторов, указанные в файле .env."
 
 	// Set state to awaiting phone for admin link
-	err := botService.StateManager.Set(telegramID, models.StateAwaitingAdminPhone, &models.StateData{})
+	err := botService.StateManager.Set(ctx, telegramID, models.StateAwaitingAdminPhone, nil)
 	if err != nil {
 		return err
 	}
 
-	// Create keyboard with phone sharing button
-	keyboard := tgbotapi.NewReplyKeyboard(
+	return botService.TelegramService.SendMessage(chatID, text, adminLinkKeyboard())
+}
+
+// adminLinkKeyboard has the button that shares the admin's own phone number
+func adminLinkKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButtonContact("📱 Telefon raqamni ulashish / Поделиться номером"),
 		),
 	)
-
-	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
 // HandleAdminLinkPhone handles phone number for admin linking
-func HandleAdminLinkPhone(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleAdminLinkPhone(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
-	// Extract phone number
-	var phoneNumber string
-	if message.Contact != nil {
-		phoneNumber = message.Contact.PhoneNumber
-	} else {
-		phoneNumber = message.Text
+	// Only the sender's own contact proves the number is theirs
+	phoneNumber, ok := ownPhoneNumber(message)
+	if !ok {
+		text := i18n.Get(i18n.ErrOwnPhoneOnly, i18n.LanguageUzbek) + "\n\n" + i18n.Get(i18n.ErrOwnPhoneOnly, i18n.LanguageRussian)
+		return botService.TelegramService.SendMessage(chatID, text, adminLinkKeyboard())
 	}
 
 	// Validate phone number
 	validPhone, err := validator.ValidateUzbekPhone(phoneNumber)
 	if err != nil {
 		text := "❌ Noto'g'ri telefon raqam / Неверный номер телефона\n\n" + err.Error()
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, utils.RemoveKeyboard())
 	}
 
 	// Check if this phone is in admin config
 	isAdminPhone := false
-	for _, adminPhone := range botService.Config.Admin.PhoneNumbers {
+	for _, adminPhone := range botService.Settings().Admin.PhoneNumbers {
 		if validPhone == adminPhone {
 			isAdminPhone = true
 			break
@@ -74,24 +77,24 @@ func HandleAdminLinkPhone(botService *services.BotService, message *tgbotapi.Mes
 	if !isAdminPhone {
 		text := "❌ Bu raqam admin sifatida ro'yxatga olinmagan / Этот номер не зарегистрирован как администратор\n\n"
 		text += fmt.Sprintf("Sizning raqamingiz: %s\n", validPhone)
-		text += "\n\nAdmin raqamlari .env faylida ko'rsatilgan.\n"
-		text += "Номера администраторов указаны в файле .env."
+		text += "\n\nAdmin raqamlari ADMIN_PHONES sozlamasida ko'rsatilgan.\n"
+		text += "Номера администраторов указаны в настройке ADMIN_PHONES."
 
 		// Clear state
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, utils.RemoveKeyboard())
 	}
 
 	// Link telegram_id to admin record
-	err = botService.AdminRepo.UpdateTelegramID(validPhone, telegramID)
+	err = botService.RoleService.LinkTelegramID(ctx, validPhone, telegramID)
 	if err != nil {
 		text := "❌ Xatolik yuz berdi / Произошла ошибка\n\n" + err.Error()
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, utils.RemoveKeyboard())
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Send success message with keyboard removed
 	text := "✅ <b>Muvaffaqiyatli!</b> / <b>Успешно!</b>\n\n"
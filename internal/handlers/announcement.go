@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"sync"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
+	"parent-bot/internal/broadcast"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
@@ -12,36 +16,34 @@ import (
 )
 
 // HandleViewAnnouncementsCommand shows all active announcements for parents
-func HandleViewAnnouncementsCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleViewAnnouncementsCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	// Determine language and check admin status
+	// Determine language
 	language := string(i18n.LanguageUzbek)
-	phoneNumber := ""
 	if user != nil {
 		language = user.Language
-		phoneNumber = user.PhoneNumber
 	}
 	lang := i18n.GetLanguage(language)
 
-	// Check if user is admin (works even if user is nil)
-	isAdmin, _ := botService.IsAdmin(phoneNumber, telegramID)
+	// Staff may view announcements without registering as parents
+	caller := authz.CallerFrom(ctx)
 
-	// If not admin and not registered, return error
-	if user == nil && !isAdmin {
+	// If not staff and not registered, return error
+	if user == nil && !caller.HasAdminPanel() {
 		text := i18n.Get(i18n.ErrNotRegistered, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get active announcements
-	announcements, err := botService.AnnouncementService.GetActiveAnnouncements(10, 0)
+	announcements, err := botService.AnnouncementService.GetActiveAnnouncements(ctx, 10, 0)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -66,7 +68,7 @@ func HandleViewAnnouncementsCommand(botService *services.BotService, message *tg
 
 		// Create inline keyboard for admin with edit and delete buttons
 		var inlineKeyboard *tgbotapi.InlineKeyboardMarkup
-		if isAdmin {
+		if caller.Can(models.PermAnnouncementsManage) {
 			inlineKeyboard = &tgbotapi.InlineKeyboardMarkup{
 				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 					{
@@ -86,7 +88,7 @@ func HandleViewAnnouncementsCommand(botService *services.BotService, message *tg
 		// Send announcement with image if available
 		if announcement.TelegramFileID != nil && *announcement.TelegramFileID != "" {
 			fileID := *announcement.TelegramFileID
-			log.Printf("Sending announcement #%d with media (FileID: %s, Type: %v)", announcement.ID, fileID, announcement.FileType)
+			logger := botService.Log(telegramID).With("announcement_id", announcement.ID, "file_id", fileID)
 
 			// Check if it's a document or photo based on FileID prefix
 			// Document FileIDs start with "BQAC", Photo FileIDs start with "AgAC"
@@ -95,88 +97,73 @@ func HandleViewAnnouncementsCommand(botService *services.BotService, message *tg
 			var sendErr error
 			if isDocument {
 				// Send as document
-				log.Printf("Detected document type, sending as document")
+				logger.Debug("sending announcement as document")
 				doc := tgbotapi.NewDocument(chatID, tgbotapi.FileID(fileID))
 				doc.Caption = text
 				doc.ParseMode = "HTML"
 				if inlineKeyboard != nil {
 					doc.ReplyMarkup = *inlineKeyboard
 				}
-				_, sendErr = botService.Bot.Send(doc)
+				_, sendErr = botService.TelegramService.Send(doc)
 			} else {
 				// Send as photo
-				log.Printf("Detected photo type, sending as photo")
+				logger.Debug("sending announcement as photo")
 				photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(fileID))
 				photo.Caption = text
 				photo.ParseMode = "HTML"
 				if inlineKeyboard != nil {
 					photo.ReplyMarkup = *inlineKeyboard
 				}
-				_, sendErr = botService.Bot.Send(photo)
+				_, sendErr = botService.TelegramService.Send(photo)
 			}
 
 			if sendErr != nil {
-				log.Printf("ERROR: Failed to send media for announcement #%d: %v (FileID: %s)", announcement.ID, sendErr, fileID)
+				logger.Error("failed to send announcement media", "error", sendErr)
 				// Fallback to text only
 				msg := tgbotapi.NewMessage(chatID, text)
 				msg.ParseMode = "HTML"
 				if inlineKeyboard != nil {
 					msg.ReplyMarkup = *inlineKeyboard
 				}
-				_, textErr := botService.Bot.Send(msg)
+				_, textErr := botService.TelegramService.Send(msg)
 				if textErr != nil {
-					log.Printf("ERROR: Failed to send text fallback: %v", textErr)
+					logger.Error("failed to send text fallback", "error", textErr)
 				}
-			} else {
-				log.Printf("Successfully sent announcement #%d with media", announcement.ID)
 			}
 		} else {
-			log.Printf("Sending announcement #%d without image (text only)", announcement.ID)
 			// Send text only
 			msg := tgbotapi.NewMessage(chatID, text)
 			msg.ParseMode = "HTML"
 			if inlineKeyboard != nil {
 				msg.ReplyMarkup = *inlineKeyboard
 			}
-			_, sendErr := botService.Bot.Send(msg)
+			_, sendErr := botService.TelegramService.Send(msg)
 			if sendErr != nil {
-				log.Printf("ERROR: Failed to send text message: %v", sendErr)
+				botService.Log(telegramID).Error("failed to send text message", "error", sendErr)
 			}
 		}
 	}
 
 	// Send a final message with the main menu keyboard to ensure it stays visible
-	mainMenuKeyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+	mainMenuKeyboard := utils.MakeMainMenuKeyboardForUser(lang, caller.HasAdminPanel())
 	finalMsg := tgbotapi.NewMessage(chatID, "👆 E'lonlar yuqorida / Объявления выше")
 	finalMsg.ReplyMarkup = mainMenuKeyboard
-	_, _ = botService.Bot.Send(finalMsg)
+	_, _ = botService.TelegramService.Send(finalMsg)
 
 	return nil
 }
 
 // HandlePostAnnouncementCommand initiates announcement posting (admin only)
-func HandlePostAnnouncementCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandlePostAnnouncementCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Get user (may be nil for admin-only accounts)
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	// Check if user is admin (works with or without user registration)
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil || !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	// Determine language
 	language := string(i18n.LanguageUzbek)
 	if user != nil {
@@ -185,10 +172,10 @@ func HandlePostAnnouncementCommand(botService *services.BotService, message *tgb
 	lang := i18n.GetLanguage(language)
 
 	// Set state to awaiting announcement content
-	stateData := &models.StateData{
+	stateData := &models.AnnouncementData{
 		Language: language,
 	}
-	err = botService.StateManager.Set(telegramID, models.StateAwaitingAnnouncementContent, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingAnnouncementContent, stateData)
 	if err != nil {
 		return err
 	}
@@ -199,25 +186,13 @@ func HandlePostAnnouncementCommand(botService *services.BotService, message *tgb
 }
 
 // HandleAnnouncementContent handles announcement content input
-func HandleAnnouncementContent(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleAnnouncementContent(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.AnnouncementData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(stateData.Language)
 
-	// Get user to check admin status for keyboard
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	var isAdmin bool
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-		isAdmin, _ = botService.IsAdmin(phoneNumber, telegramID)
-	} else {
-		isAdmin, _ = botService.IsAdmin("", telegramID)
-	}
+	// Staff keep their admin panel button
+	hasAdminPanel := authz.CallerFrom(ctx).HasAdminPanel()
 
 	// Check if message contains media instead of text
 	if message.Text == "" {
@@ -239,7 +214,7 @@ func HandleAnnouncementContent(botService *services.BotService, message *tgbotap
 		}
 
 		// Keep the main menu keyboard visible
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, errorMsg, &keyboard)
 	}
 
@@ -247,7 +222,7 @@ func HandleAnnouncementContent(botService *services.BotService, message *tgbotap
 	if len(message.Text) < 10 {
 		text := "❌ E'lon matni juda qisqa! Kamida 10 ta belgi kiriting.\n\n❌ Текст объявления слишком короткий! Введите минимум 10 символов."
 		// Keep the main menu keyboard visible on validation errors too
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 	}
 
@@ -255,7 +230,7 @@ func HandleAnnouncementContent(botService *services.BotService, message *tgbotap
 	stateData.AnnouncementText = message.Text
 
 	// Move to file upload state
-	err = botService.StateManager.Set(telegramID, models.StateAwaitingAnnouncementFile, stateData)
+	err := botService.StateManager.Set(ctx, telegramID, models.StateAwaitingAnnouncementFile, stateData)
 	if err != nil {
 		return err
 	}
@@ -277,25 +252,13 @@ func HandleAnnouncementContent(botService *services.BotService, message *tgbotap
 }
 
 // HandleAnnouncementFile handles announcement file upload
-func HandleAnnouncementFile(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleAnnouncementFile(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.AnnouncementData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(stateData.Language)
 
-	// Get user to check admin status for keyboard
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	var isAdmin bool
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-		isAdmin, _ = botService.IsAdmin(phoneNumber, telegramID)
-	} else {
-		isAdmin, _ = botService.IsAdmin("", telegramID)
-	}
+	// Staff keep their admin panel button
+	hasAdminPanel := authz.CallerFrom(ctx).HasAdminPanel()
 
 	var fileID, filename *string
 	fileType := "image"
@@ -320,28 +283,28 @@ func HandleAnnouncementFile(botService *services.BotService, message *tgbotapi.M
 		} else {
 			text := i18n.Get(i18n.ErrInvalidFile, lang) + "\n\nIltimos, rasm formatini yuboring (JPG, PNG, GIF, HEIC). / Пожалуйста, отправьте изображение в формате JPG, PNG, GIF или HEIC."
 			// Keep the main menu keyboard visible on errors
-			keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+			keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 			return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 		}
 	} else if message.Text != "" {
 		// User sent text instead of image - show a helpful error
 		text := "❌ Iltimos, rasm yuboring yoki 'O'tkazib yuborish' tugmasini bosing.\n\n❌ Пожалуйста, отправьте изображение или нажмите кнопку 'Пропустить'."
 		// Keep the main menu keyboard visible
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 	} else {
 		text := i18n.Get(i18n.ErrInvalidFile, lang) + "\n\nIltimos, rasm yuboring. / Пожалуйста, отправьте изображение."
 		// Keep the main menu keyboard visible on errors
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 	}
 
 	// Save announcement with file
-	return saveAnnouncement(botService, telegramID, chatID, stateData, fileID, filename, &fileType)
+	return saveAnnouncement(ctx, botService, telegramID, chatID, stateData, fileID, filename, &fileType)
 }
 
 // HandleAnnouncementSkipFile handles skipping file upload
-func HandleAnnouncementSkipFile(botService *services.BotService, callback *tgbotapi.CallbackQuery, stateData *models.StateData) error {
+func HandleAnnouncementSkipFile(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, stateData *models.AnnouncementData) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
@@ -349,17 +312,17 @@ func HandleAnnouncementSkipFile(botService *services.BotService, callback *tgbot
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "✅")
 
 	// Save announcement without file
-	return saveAnnouncement(botService, telegramID, chatID, stateData, nil, nil, nil)
+	return saveAnnouncement(ctx, botService, telegramID, chatID, stateData, nil, nil, nil)
 }
 
 // saveAnnouncement saves the announcement to database
-func saveAnnouncement(botService *services.BotService, telegramID int64, chatID int64, stateData *models.StateData, fileID, filename, fileType *string) error {
+func saveAnnouncement(ctx context.Context, botService *services.BotService, telegramID int64, chatID int64, stateData *models.AnnouncementData, fileID, filename, fileType *string) error {
 	lang := i18n.GetLanguage(stateData.Language)
 
 	// Get admin record
-	admin, err := botService.AdminRepo.GetByTelegramID(telegramID)
+	admin, err := botService.AdminRepo.GetByTelegramID(ctx, telegramID)
 	if err != nil {
-		log.Printf("Failed to get admin: %v", err)
+		botService.Log(telegramID).Error("failed to get admin", "error", err)
 	}
 
 	var adminID *int
@@ -377,49 +340,66 @@ func saveAnnouncement(botService *services.BotService, telegramID int64, chatID
 		PostedByAdminID: adminID,
 	}
 
-	// Log file ID for debugging
-	if fileID != nil {
-		log.Printf("Creating announcement with FileID: %s", *fileID)
-	} else {
-		log.Printf("Creating announcement without image (FileID is nil)")
-	}
-
-	announcement, err := botService.AnnouncementService.CreateAnnouncement(announcementReq)
+	announcement, err := botService.AnnouncementService.CreateAnnouncement(ctx, announcementReq)
 	if err != nil {
-		log.Printf("Failed to save announcement: %v", err)
+		botService.Log(telegramID).Error("failed to save announcement", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
-	// Verify the announcement was created with file ID
-	if announcement.TelegramFileID != nil {
-		log.Printf("Announcement #%d created successfully with FileID: %s", announcement.ID, *announcement.TelegramFileID)
-	} else {
-		log.Printf("Announcement #%d created successfully without image", announcement.ID)
-	}
+	botService.Log(telegramID).Info("announcement created", "announcement_id", announcement.ID, "has_file", announcement.TelegramFileID != nil)
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Send success message
 	text := i18n.Get(i18n.MsgAnnouncementPosted, lang)
 	_ = botService.TelegramService.SendMessage(chatID, text, nil)
 
-	// Notify all users about new announcement
-	go notifyUsersAboutAnnouncement(botService, announcement)
+	// Send the announcement to parents
+	notifyUsersAboutAnnouncement(ctx, botService, announcement, chatID)
 
 	return nil
 }
 
-// notifyUsersAboutAnnouncement sends announcement to all registered users
-func notifyUsersAboutAnnouncement(botService *services.BotService, announcement *models.Announcement) {
-	// Get all users
-	users, err := botService.UserService.GetAllUsers(1000, 0) // Get first 1000 users
+// notifyUsersAboutAnnouncement broadcasts the announcement to the parents of
+// its classes, or of every active class when it has none, and reports the
+// progress to authorChatID
+func notifyUsersAboutAnnouncement(ctx context.Context, botService *services.BotService, announcement *models.Announcement, authorChatID int64) {
+	logger := botService.Logger.With("announcement_id", announcement.ID)
+
+	classIDs, err := botService.AnnouncementRepo.GetClassIDs(ctx, announcement.ID)
 	if err != nil {
-		log.Printf("Failed to get users: %v", err)
+		logger.Error("failed to get announcement classes", "error", err)
 		return
 	}
+	if len(classIDs) == 0 {
+		classes, err := botService.ClassRepo.GetActive(ctx)
+		if err != nil {
+			logger.Error("failed to get classes for announcement", "error", err)
+			return
+		}
+		for _, class := range classes {
+			classIDs = append(classIDs, class.ID)
+		}
+	}
+
+	bc := announcementBroadcast(botService, announcement, authorChatID)
+	bc.Ref = models.AnnouncementRef(announcement.ID, false)
+	bc.ClassIDs = classIDs
 
+	if err := botService.Broadcaster.Send(bc); err != nil {
+		logger.Error("failed to start announcement broadcast", "error", err)
+		return
+	}
+
+	logger.Info("announcement broadcast started", "classes", len(classIDs))
+}
+
+// announcementBroadcast builds the broadcast of an announcement without its
+// recipients. Every recipient is recorded in announcement_deliveries, and
+// only one broadcast of an announcement, first send or resend, runs at a time.
+func announcementBroadcast(botService *services.BotService, announcement *models.Announcement, authorChatID int64) *broadcast.Broadcast {
 	// Format announcement
 	text := "📢 YANGI E'LON / НОВОЕ ОБЪЯВЛЕНИЕ\n\n"
 
@@ -430,80 +410,173 @@ func notifyUsersAboutAnnouncement(botService *services.BotService, announcement
 	text += announcement.Content
 	text += fmt.Sprintf("\n\n📅 %s", utils.FormatDateTime(announcement.CreatedAt))
 
-	// Send to all users
-	successCount := 0
-	failCount := 0
-	for _, user := range users {
-		chatID := user.TelegramID
-		lang := i18n.GetLanguage(user.Language)
-
-		// Check if user is admin to show appropriate keyboard
-		isAdmin, _ := botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+	// Attach the file as a document or photo based on its FileID prefix;
+	// if Telegram rejects it, the outbox falls back to the text alone
+	var fileID, mediaType string
+	if announcement.TelegramFileID != nil && *announcement.TelegramFileID != "" {
+		fileID = *announcement.TelegramFileID
+		mediaType = models.MediaPhoto
+		if len(fileID) > 4 && fileID[:4] == "BQAC" {
+			mediaType = models.MediaDocument
+		}
+	}
 
-		if announcement.TelegramFileID != nil && *announcement.TelegramFileID != "" {
-			fileID := *announcement.TelegramFileID
-			// Check if it's a document or photo based on FileID prefix
-			isDocument := len(fileID) > 4 && fileID[:4] == "BQAC"
+	// Parents who are also staff keep their admin panel button; staff are
+	// looked up once, when the first recipient is queued
+	var staffOnce sync.Once
+	staff := map[int64]bool{}
+
+	return &broadcast.Broadcast{
+		Key:       models.AnnouncementRef(announcement.ID, false),
+		Kind:      models.NotificationAnnouncement,
+		Text:      text,
+		FileID:    fileID,
+		MediaType: mediaType,
+		Markup: func(ctx context.Context, user *models.User) any {
+			staffOnce.Do(func() {
+				ids, err := botService.GetAdminTelegramIDs(ctx, models.AdminPermissions...)
+				if err != nil {
+					botService.Logger.Warn("failed to get staff for announcement keyboards", "announcement_id", announcement.ID, "error", err)
+				}
+				for _, id := range ids {
+					staff[id] = true
+				}
+			})
+			return utils.MakeMainMenuKeyboardForUser(i18n.GetLanguage(user.Language), staff[user.TelegramID])
+		},
+		Track: func(ctx context.Context, users []*models.User) error {
+			return botService.AnnouncementService.QueueDeliveries(ctx, announcement.ID, users)
+		},
+		Pending: func(ctx context.Context, afterID, limit int) ([]*models.User, error) {
+			return botService.AnnouncementService.GetPendingRecipients(ctx, announcement.ID, afterID, limit)
+		},
+		Queued: func(ctx context.Context, users []*models.User) error {
+			return botService.AnnouncementService.MarkDeliveriesEnqueued(ctx, announcement.ID, users)
+		},
+		AuthorChatID: authorChatID,
+	}
+}
 
-			var sendErr error
-			if isDocument {
-				// Send as document with caption and keyboard
-				doc := tgbotapi.NewDocument(chatID, tgbotapi.FileID(fileID))
-				doc.Caption = text
-				doc.ParseMode = "HTML"
-				doc.ReplyMarkup = keyboard
-				_, sendErr = botService.Bot.Send(doc)
-			} else {
-				// Send as photo with caption and keyboard
-				photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(fileID))
-				photo.Caption = text
-				photo.ParseMode = "HTML"
-				photo.ReplyMarkup = keyboard
-				_, sendErr = botService.Bot.Send(photo)
-			}
+// RegisterAnnouncementResume has the broadcaster, when it starts, queue the
+// announcements for the recipients a stopped broadcast did not get to
+func RegisterAnnouncementResume(botService *services.BotService) {
+	botService.Broadcaster.SetResume(func(ctx context.Context) ([]*broadcast.Broadcast, error) {
+		ids, err := botService.AnnouncementService.GetPendingAnnouncementIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
 
-			if sendErr != nil {
-				log.Printf("Failed to send announcement with media to user %d (TelegramID: %d): %v", user.ID, chatID, sendErr)
-				// Try fallback to text only
-				msg := tgbotapi.NewMessage(chatID, text)
-				msg.ParseMode = "HTML"
-				msg.ReplyMarkup = keyboard
-				_, fallbackErr := botService.Bot.Send(msg)
-				if fallbackErr != nil {
-					log.Printf("Fallback also failed for user %d: %v", user.ID, fallbackErr)
-					failCount++
-				} else {
-					successCount++
-				}
-			} else {
-				successCount++
-			}
-		} else {
-			// Send text with keyboard
-			msg := tgbotapi.NewMessage(chatID, text)
-			msg.ParseMode = "HTML"
-			msg.ReplyMarkup = keyboard
-			_, err = botService.Bot.Send(msg)
+		var resumed []*broadcast.Broadcast
+		for _, id := range ids {
+			announcement, err := botService.AnnouncementService.GetAnnouncementByID(ctx, id)
 			if err != nil {
-				log.Printf("Failed to send announcement to user %d: %v", user.ID, err)
-				failCount++
-			} else {
-				successCount++
+				return nil, err
+			}
+			if announcement == nil {
+				continue
 			}
+
+			// The recipients are already recorded, only the queueing is left
+			bc := announcementBroadcast(botService, announcement, 0)
+			bc.Ref = models.AnnouncementRef(announcement.ID, false)
+			bc.Track = nil
+			resumed = append(resumed, bc)
 		}
+
+		return resumed, nil
+	})
+}
+
+// HandleAnnouncementResendCallback sends an announcement again to the parents
+// it failed to reach
+func HandleAnnouncementResendCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, announcementID int) error {
+	chatID := callback.Message.Chat.ID
+	logger := botService.Log(callback.From.ID).With("announcement_id", announcementID)
+
+	announcement, err := botService.AnnouncementService.GetAnnouncementByID(ctx, announcementID)
+	if err != nil || announcement == nil {
+		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ E'lon topilmadi / Объявление не найдено")
+		return nil
+	}
+
+	summary, err := botService.AnnouncementService.GetDeliverySummary(ctx, announcementID)
+	if err != nil {
+		logger.Error("failed to get delivery summary", "error", err)
+		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
+		return nil
+	}
+	if summary.Failed == 0 {
+		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID,
+			"✅ Qayta yuboriladigan xabarlar yo'q / Нет сообщений для повторной отправки")
+		return nil
 	}
 
-	log.Printf("Announcement notification complete: %d successful, %d failed out of %d users", successCount, failCount, len(users))
+	bc := announcementBroadcast(botService, announcement, chatID)
+	bc.Ref = models.AnnouncementRef(announcement.ID, true)
+	bc.Recipients = func(ctx context.Context, afterID, limit int) ([]*models.User, error) {
+		return botService.AnnouncementService.GetFailedRecipients(ctx, announcement.ID, afterID, limit)
+	}
+
+	err = botService.Broadcaster.Send(bc)
+	if errors.Is(err, broadcast.ErrRunning) {
+		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID,
+			"⏳ E'lon hali yuborilmoqda / Объявление ещё отправляется")
+		return nil
+	}
+	if err != nil {
+		logger.Error("failed to start announcement resend", "error", err)
+		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
+		return nil
+	}
+
+	logger.Info("announcement resend started", "failed", summary.Failed)
+	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID,
+		fmt.Sprintf("🔁 %d ta qabul qiluvchiga qayta yuborilmoqda / Повторная отправка: %d", summary.Failed, summary.Failed))
+	return nil
+}
+
+// deliverySummaryText describes who an announcement reached, or returns ""
+// if it was never sent to anyone
+func deliverySummaryText(summary *models.DeliverySummary) string {
+	if summary == nil || summary.Total() == 0 {
+		return ""
+	}
+
+	text := fmt.Sprintf("\n\n📬 <b>Yetkazish / Доставка</b> (%d):\n✅ Yuborildi / Отправлено: %d", summary.Total(), summary.Sent)
+	if summary.Queued > 0 {
+		text += fmt.Sprintf("\n⏳ Navbatda / В очереди: %d", summary.Queued)
+	}
+	if summary.Failed > 0 {
+		text += fmt.Sprintf("\n❌ Xatolik / Ошибки: %d", summary.Failed)
+	}
+	if summary.Blocked > 0 {
+		text += fmt.Sprintf("\n🚫 Botni bloklagan / Заблокировали бота: %d", summary.Blocked)
+	}
+	return text
+}
+
+// resendButtonRow offers to resend an announcement to the parents it failed
+// to reach, or returns nil if there are none
+func resendButtonRow(announcementID int, summary *models.DeliverySummary) []tgbotapi.InlineKeyboardButton {
+	if summary == nil || summary.Failed == 0 {
+		return nil
+	}
+
+	return tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("🔁 Qayta yuborish / Повторить (%d)", summary.Failed),
+			fmt.Sprintf("announcement_resend_%d", announcementID),
+		),
+	)
 }
 
 // HandleAnnouncementDeleteCallback handles announcement deletion request
-func HandleAnnouncementDeleteCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, announcementID int) error {
+func HandleAnnouncementDeleteCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, announcementID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -515,23 +588,10 @@ func HandleAnnouncementDeleteCallback(botService *services.BotService, callback
 	}
 	lang := i18n.GetLanguage(language)
 
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil || !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
 	// Delete the announcement
-	err = botService.AnnouncementService.DeleteAnnouncement(announcementID)
+	err = botService.AnnouncementService.DeleteAnnouncement(ctx, announcementID)
 	if err != nil {
-		log.Printf("Failed to delete announcement: %v", err)
+		botService.Log(telegramID).Error("failed to delete announcement", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -546,12 +606,12 @@ func HandleAnnouncementDeleteCallback(botService *services.BotService, callback
 }
 
 // HandleAnnouncementEditCallback handles announcement edit request
-func HandleAnnouncementEditCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, announcementID int) error {
+func HandleAnnouncementEditCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, announcementID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -563,23 +623,10 @@ func HandleAnnouncementEditCallback(botService *services.BotService, callback *t
 	}
 	lang := i18n.GetLanguage(language)
 
-	// Check if user is admin
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil || !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
 	// Get the announcement
-	announcement, err := botService.AnnouncementService.GetAnnouncementByID(announcementID)
+	announcement, err := botService.AnnouncementService.GetAnnouncementByID(ctx, announcementID)
 	if err != nil {
-		log.Printf("Failed to get announcement: %v", err)
+		botService.Log(telegramID).Error("failed to get announcement", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -595,11 +642,11 @@ func HandleAnnouncementEditCallback(botService *services.BotService, callback *t
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Set state to awaiting edited announcement content
-	stateData := &models.StateData{
+	stateData := &models.AnnouncementEditData{
 		Language:       language,
 		AnnouncementID: announcementID,
 	}
-	err = botService.StateManager.Set(telegramID, models.StateAwaitingEditedAnnouncementContent, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingEditedAnnouncementContent, stateData)
 	if err != nil {
 		return err
 	}
@@ -615,25 +662,13 @@ func HandleAnnouncementEditCallback(botService *services.BotService, callback *t
 }
 
 // HandleEditedAnnouncementContent handles the edited announcement content
-func HandleEditedAnnouncementContent(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleEditedAnnouncementContent(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.AnnouncementEditData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(stateData.Language)
 
-	// Get user to check admin status for keyboard
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	var isAdmin bool
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-		isAdmin, _ = botService.IsAdmin(phoneNumber, telegramID)
-	} else {
-		isAdmin, _ = botService.IsAdmin("", telegramID)
-	}
+	// Staff keep their admin panel button
+	hasAdminPanel := authz.CallerFrom(ctx).HasAdminPanel()
 
 	// Check if message contains media instead of text
 	if message.Text == "" {
@@ -655,7 +690,7 @@ func HandleEditedAnnouncementContent(botService *services.BotService, message *t
 		}
 
 		// Keep the main menu keyboard visible
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, errorMsg, &keyboard)
 	}
 
@@ -663,16 +698,16 @@ func HandleEditedAnnouncementContent(botService *services.BotService, message *t
 	if len(message.Text) < 10 {
 		text := "❌ E'lon matni juda qisqa! Kamida 10 ta belgi kiriting.\n\n❌ Текст объявления слишком короткий! Введите минимум 10 символов."
 		// Keep the main menu keyboard visible on validation errors too
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 	}
 
 	// Get the announcement to check if it exists
-	announcement, err := botService.AnnouncementService.GetAnnouncementByID(stateData.AnnouncementID)
+	announcement, err := botService.AnnouncementService.GetAnnouncementByID(ctx, stateData.AnnouncementID)
 	if err != nil || announcement == nil {
-		log.Printf("Failed to get announcement: %v", err)
+		botService.Log(telegramID).Error("failed to get announcement", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 	}
 
@@ -686,56 +721,46 @@ func HandleEditedAnnouncementContent(botService *services.BotService, message *t
 		PostedByAdminID: announcement.PostedByAdminID,
 	}
 
-	_, err = botService.AnnouncementService.UpdateAnnouncement(stateData.AnnouncementID, updateReq)
+	_, err = botService.AnnouncementService.UpdateAnnouncement(ctx, stateData.AnnouncementID, updateReq)
 	if err != nil {
-		log.Printf("Failed to update announcement: %v", err)
+		botService.Log(telegramID).Error("failed to update announcement", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Send success message with keyboard
 	text := "✅ E'lon muvaffaqiyatli tahrirlandi! / Объявление успешно отредактировано!"
-	keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+	keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 	return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 }
 
 // HandleAdminViewAnnouncementsCallback shows all announcements to admin with edit/delete buttons
-func HandleAdminViewAnnouncementsCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAdminViewAnnouncementsCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
 	// Determine language
 	language := string(i18n.LanguageUzbek)
-	phoneNumber := ""
 	if user != nil {
 		language = user.Language
-		phoneNumber = user.PhoneNumber
 	}
 	lang := i18n.GetLanguage(language)
 
-	// Check if user is admin
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil || !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
 	// Answer callback query
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Get all announcements (not just active)
-	announcements, err := botService.AnnouncementService.GetAllAnnouncements(20, 0)
+	announcements, err := botService.AnnouncementService.GetAllAnnouncements(ctx, 20, 0)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -767,6 +792,12 @@ func HandleAdminViewAnnouncementsCallback(botService *services.BotService, callb
 			text += "\n\n⚠️ Nofaol / Неактивно"
 		}
 
+		summary, err := botService.AnnouncementService.GetDeliverySummary(ctx, announcement.ID)
+		if err != nil {
+			botService.Log(telegramID).Warn("failed to get delivery summary", "announcement_id", announcement.ID, "error", err)
+		}
+		text += deliverySummaryText(summary)
+
 		// Create keyboard with edit and delete buttons
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
@@ -780,11 +811,14 @@ func HandleAdminViewAnnouncementsCallback(botService *services.BotService, callb
 				),
 			),
 		)
+		if row := resendButtonRow(announcement.ID, summary); row != nil {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+		}
 
 		// Send announcement with image if available
 		if announcement.TelegramFileID != nil && *announcement.TelegramFileID != "" {
 			fileID := *announcement.TelegramFileID
-			log.Printf("Admin view: Sending announcement #%d with media (FileID: %s, Type: %v)", announcement.ID, fileID, announcement.FileType)
+			logger := botService.Log(telegramID).With("announcement_id", announcement.ID, "file_id", fileID)
 
 			// Check if it's a document or photo based on FileID prefix
 			isDocument := len(fileID) > 4 && fileID[:4] == "BQAC"
@@ -792,44 +826,41 @@ func HandleAdminViewAnnouncementsCallback(botService *services.BotService, callb
 			var sendErr error
 			if isDocument {
 				// Send as document
-				log.Printf("Admin view: Detected document type, sending as document")
+				logger.Debug("sending announcement as document")
 				doc := tgbotapi.NewDocument(chatID, tgbotapi.FileID(fileID))
 				doc.Caption = text
 				doc.ParseMode = "HTML"
 				doc.ReplyMarkup = keyboard
-				_, sendErr = botService.Bot.Send(doc)
+				_, sendErr = botService.TelegramService.Send(doc)
 			} else {
 				// Send as photo
-				log.Printf("Admin view: Detected photo type, sending as photo")
+				logger.Debug("sending announcement as photo")
 				photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(fileID))
 				photo.Caption = text
 				photo.ParseMode = "HTML"
 				photo.ReplyMarkup = keyboard
-				_, sendErr = botService.Bot.Send(photo)
+				_, sendErr = botService.TelegramService.Send(photo)
 			}
 
 			if sendErr != nil {
-				log.Printf("ERROR: Admin view failed to send media for announcement #%d: %v (FileID: %s)", announcement.ID, sendErr, fileID)
+				logger.Error("failed to send announcement media", "error", sendErr)
 				// Fallback to text only
 				msg := tgbotapi.NewMessage(chatID, text)
 				msg.ParseMode = "HTML"
 				msg.ReplyMarkup = keyboard
-				_, textErr := botService.Bot.Send(msg)
+				_, textErr := botService.TelegramService.Send(msg)
 				if textErr != nil {
-					log.Printf("ERROR: Failed to send text fallback: %v", textErr)
+					logger.Error("failed to send text fallback", "error", textErr)
 				}
-			} else {
-				log.Printf("Successfully sent admin announcement #%d with media", announcement.ID)
 			}
 		} else {
-			log.Printf("Admin view: Sending announcement #%d without image (text only)", announcement.ID)
 			// Send text only
 			msg := tgbotapi.NewMessage(chatID, text)
 			msg.ParseMode = "HTML"
 			msg.ReplyMarkup = keyboard
-			_, sendErr := botService.Bot.Send(msg)
+			_, sendErr := botService.TelegramService.Send(msg)
 			if sendErr != nil {
-				log.Printf("ERROR: Failed to send text message: %v", sendErr)
+				botService.Log(telegramID).Error("failed to send text message", "error", sendErr)
 			}
 		}
 	}
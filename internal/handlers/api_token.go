@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
+	"parent-bot/internal/models"
+	"parent-bot/internal/services"
+)
+
+// requireAdminRecord returns the caller's admin record, or nil if they may
+// not manage API tokens
+func requireAdminRecord(ctx context.Context) *models.Admin {
+	caller := authz.CallerFrom(ctx)
+	if !caller.Can(models.PermAPITokensManage) {
+		return nil
+	}
+	return caller.Admin
+}
+
+// HandleAPITokenCommand handles /api_token [read|write] [name] - issues an admin API token
+func HandleAPITokenCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	chatID := message.Chat.ID
+
+	admin := requireAdminRecord(ctx)
+	if admin == nil {
+		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	if !botService.APITokenService.Enabled() {
+		text := "❌ API o'chirilgan: ADMIN_API_SECRET sozlanmagan.\n"
+		text += "API отключен: ADMIN_API_SECRET не настроен."
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	scope := models.APIScopeRead
+	name := ""
+	args := strings.Fields(message.CommandArguments())
+	if len(args) > 0 {
+		scope = strings.ToLower(args[0])
+		name = strings.Join(args[1:], " ")
+	}
+
+	if scope != models.APIScopeRead && scope != models.APIScopeWrite {
+		text := "❌ Format: /api_token read|write [nom / название]"
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	bearer, token, err := botService.APITokenService.Issue(ctx, admin.ID, name, scope)
+	if err != nil {
+		text := "❌ Xatolik / Ошибка: " + err.Error()
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	text := "🔑 <b>API token yaratildi / API токен создан</b>\n\n"
+	text += fmt.Sprintf("ID: %d\n", token.ID)
+	text += fmt.Sprintf("Huquq / Права: <b>%s</b>\n\n", token.Scope)
+	text += fmt.Sprintf("<code>%s</code>\n\n", bearer)
+	text += "⚠️ Tokenni hech kimga bermang. Bekor qilish: /revoke_api_token " + strconv.Itoa(token.ID) + "\n"
+	text += "⚠️ Никому не передавайте токен. Отозвать: /revoke_api_token " + strconv.Itoa(token.ID) + "\n\n"
+	text += "Header: <code>Authorization: Bearer &lt;token&gt;</code>"
+
+	return botService.TelegramService.SendMessage(chatID, text, nil)
+}
+
+// HandleAPITokensCommand handles /api_tokens - lists issued admin API tokens
+func HandleAPITokensCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	chatID := message.Chat.ID
+
+	admin := requireAdminRecord(ctx)
+	if admin == nil {
+		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	tokens, err := botService.APITokenService.GetAll(ctx)
+	if err != nil {
+		text := "❌ Xatolik / Ошибка: " + err.Error()
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	if len(tokens) == 0 {
+		text := "🔑 API tokenlar yo'q / API токенов нет\n\nYaratish / Создать: /api_token read|write"
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	text := "🔑 <b>API tokenlar / API токены</b>\n\n"
+	for _, token := range tokens {
+		status := "✅"
+		if token.IsRevoked() {
+			status = "🚫"
+		}
+
+		text += fmt.Sprintf("%s <b>#%d</b> %s (admin %d)", status, token.ID, token.Scope, token.AdminID)
+		if token.Name != "" {
+			text += " — " + html.EscapeString(token.Name)
+		}
+		text += fmt.Sprintf("\n   📅 %s", token.CreatedAt.Format("02.01.2006 15:04"))
+		if token.LastUsedAt != nil {
+			text += fmt.Sprintf(" | 🕐 %s", token.LastUsedAt.Format("02.01.2006 15:04"))
+		}
+		text += "\n"
+	}
+
+	return botService.TelegramService.SendMessage(chatID, text, nil)
+}
+
+// HandleRevokeAPITokenCommand handles /revoke_api_token <id>
+func HandleRevokeAPITokenCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	chatID := message.Chat.ID
+
+	admin := requireAdminRecord(ctx)
+	if admin == nil {
+		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	tokenID, err := strconv.Atoi(strings.TrimSpace(message.CommandArguments()))
+	if err != nil {
+		text := "❌ Format: /revoke_api_token &lt;ID&gt;"
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	if err := botService.APITokenService.Revoke(ctx, tokenID); err != nil {
+		text := "❌ Xatolik / Ошибка: " + err.Error()
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	text := fmt.Sprintf("✅ Token #%d bekor qilindi / Токен #%d отозван", tokenID, tokenID)
+	return botService.TelegramService.SendMessage(chatID, text, nil)
+}
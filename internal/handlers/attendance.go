@@ -1,25 +1,29 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
+	"parent-bot/internal/database"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
+	"parent-bot/internal/state"
 	"parent-bot/internal/utils"
 )
 
 // HandleTeacherTakeAttendanceCommand allows teacher to mark attendance by class
-func HandleTeacherTakeAttendanceCommand(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherTakeAttendanceCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	chatID := message.Chat.ID
 
 	// Get all classes (teachers can access all classes)
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы danных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -51,20 +55,20 @@ func HandleTeacherTakeAttendanceCommand(botService *services.BotService, message
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleAttendanceClassSelection handles when teacher selects a class for attendance
-func HandleAttendanceClassSelection(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleAttendanceClassSelection(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		// Could also be admin
-		admin, err := botService.AdminRepo.GetByTelegramID(telegramID)
+		admin, err := botService.AdminRepo.GetByTelegramID(ctx, telegramID)
 		if err != nil || admin == nil {
 			text := "❌ Ruxsat yo'q / Нет разрешения"
 			_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -75,7 +79,7 @@ func HandleAttendanceClassSelection(botService *services.BotService, callback *t
 	// Teachers can access all classes - no verification needed
 
 	// Get students in this class
-	students, err := botService.StudentRepo.GetByClassID(classID)
+	students, err := botService.StudentRepo.GetByClassID(ctx, classID)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -89,19 +93,18 @@ func HandleAttendanceClassSelection(botService *services.BotService, callback *t
 	}
 
 	// Get class name
-	class, _ := botService.ClassRepo.GetByID(classID)
+	class, _ := botService.ClassRepo.GetByID(ctx, classID)
 	className := fmt.Sprintf("%d", classID)
 	if class != nil {
 		className = class.ClassName
 	}
 
-	// Get today's date in Uzbekistan time (Asia/Tashkent UTC+5)
-	location, _ := time.LoadLocation("Asia/Tashkent")
-	today := time.Now().In(location)
+	// Get today's date in the school's timezone
+	today := time.Now().In(botService.Location)
 	todayStr := today.Format("2006-01-02")
 
 	// Check if attendance already exists for today
-	existingRecords, _ := botService.AttendanceService.GetAttendanceByClassIDAndDate(classID, todayStr)
+	existingRecords, _ := botService.AttendanceService.GetAttendanceByClassIDAndDate(ctx, classID, todayStr)
 	existingAbsentMap := make(map[int]bool) // studentID -> isAbsent
 	for _, record := range existingRecords {
 		if record.Status == "absent" {
@@ -154,14 +157,14 @@ func HandleAttendanceClassSelection(botService *services.BotService, callback *t
 		initialAbsentList = append(initialAbsentList, studentID)
 	}
 
-	stateData := &models.StateData{
+	stateData := &models.AttendanceData{
 		ClassID:    &classID,
 		AbsentList: initialAbsentList,
 		Date:       todayStr,
 	}
-	err = botService.StateManager.Set(telegramID, "taking_attendance", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateTakingAttendance, stateData)
 	if err != nil {
-		log.Printf("Failed to set state: %v", err)
+		botService.Log(telegramID).Error("failed to set state", "error", err)
 	}
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -170,12 +173,12 @@ func HandleAttendanceClassSelection(botService *services.BotService, callback *t
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleAttendanceInfo processes attendance input from teacher/admin
-func HandleAttendanceInfo(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleAttendanceInfo(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -211,7 +214,7 @@ func HandleAttendanceInfo(botService *services.BotService, message *tgbotapi.Mes
 	}
 
 	// Verify student exists
-	student, err := botService.StudentRepo.GetByID(studentID)
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil || student == nil {
 		text := "❌ O'quvchi topilmadi / Ученик не найден"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -226,7 +229,7 @@ func HandleAttendanceInfo(botService *services.BotService, message *tgbotapi.Mes
 	}
 
 	// Check if user is teacher or admin
-	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	var adminID *int
 	var teacherID *int
 
@@ -234,7 +237,7 @@ func HandleAttendanceInfo(botService *services.BotService, message *tgbotapi.Mes
 		teacherID = &teacher.ID
 	} else {
 		// Check if admin
-		admin, err := botService.AdminRepo.GetByTelegramID(telegramID)
+		admin, err := botService.AdminRepo.GetByTelegramID(ctx, telegramID)
 		if err != nil || admin == nil {
 			text := "❌ Ruxsat yo'q / Нет разрешения"
 			return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -251,10 +254,10 @@ func HandleAttendanceInfo(botService *services.BotService, message *tgbotapi.Mes
 		MarkedByAdminID:   adminID,
 	}
 
-	attendanceID, err := botService.AttendanceService.CreateAttendance(req)
+	attendanceID, err := botService.AttendanceService.CreateAttendance(ctx, req)
 	if err != nil {
-		log.Printf("Failed to create attendance: %v", err)
-		if strings.Contains(err.Error(), "UNIQUE constraint") {
+		botService.Log(telegramID).Error("failed to create attendance", "error", err)
+		if errors.Is(err, database.ErrDuplicate) {
 			text := "❌ Bu sana uchun allaqachon yo'qlama olingan / Посещаемость уже отмечена для этой даты"
 			return botService.TelegramService.SendMessage(chatID, text, nil)
 		}
@@ -263,10 +266,10 @@ func HandleAttendanceInfo(botService *services.BotService, message *tgbotapi.Mes
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Get class name
-	class, _ := botService.ClassRepo.GetByID(student.ClassID)
+	class, _ := botService.ClassRepo.GetByID(ctx, student.ClassID)
 	className := fmt.Sprintf("%d", student.ClassID)
 	if class != nil {
 		className = class.ClassName
@@ -299,32 +302,19 @@ func HandleAttendanceInfo(botService *services.BotService, message *tgbotapi.Mes
 
 	// Send notification to parent if absent
 	if status == "absent" {
-		go notifyParentAboutAbsence(botService, student.ID, dateStr)
+		notifyParentAboutAbsence(ctx, botService, student.ID, dateStr)
 	}
 
 	return botService.TelegramService.SendMessage(chatID, text, nil)
 }
 
 // HandleViewChildAttendanceCallback handles viewing a specific child's attendance
-func HandleViewChildAttendanceCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleViewChildAttendanceCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Extract student ID from callback data (format: "view_child_attendance_123")
-	parts := strings.Split(callback.Data, "_")
-	if len(parts) != 4 {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
-	studentID, err := strconv.Atoi(parts[3])
-	if err != nil {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -335,7 +325,7 @@ func HandleViewChildAttendanceCallback(botService *services.BotService, callback
 	}
 
 	// Verify student belongs to this parent
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -355,9 +345,9 @@ func HandleViewChildAttendanceCallback(botService *services.BotService, callback
 	}
 
 	// Get attendance records (last 30 days)
-	records, err := botService.AttendanceService.GetAttendanceByStudentID(studentID, 30, 0)
+	records, err := botService.AttendanceService.GetAttendanceByStudentID(ctx, studentID, 30, 0)
 	if err != nil {
-		log.Printf("Failed to get attendance: %v", err)
+		botService.Log(telegramID).Error("failed to get attendance", "error", err)
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -400,11 +390,11 @@ func HandleViewChildAttendanceCallback(botService *services.BotService, callback
 }
 
 // HandleTeacherViewClassAttendanceCommand allows teacher to view class attendance
-func HandleTeacherViewClassAttendanceCommand(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherViewClassAttendanceCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	chatID := message.Chat.ID
 
 	// Get all classes (teachers can access all classes)
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -435,19 +425,19 @@ func HandleTeacherViewClassAttendanceCommand(botService *services.BotService, me
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleViewClassAttendanceCallback handles class selection for viewing attendance
-func HandleViewClassAttendanceCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleViewClassAttendanceCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	chatID := callback.Message.Chat.ID
 
 	// Get today's date
 	today := time.Now().Format("2006-01-02")
 
 	// Get attendance for class today
-	records, err := botService.AttendanceService.GetAttendanceByClassIDAndDate(classID, today)
+	records, err := botService.AttendanceService.GetAttendanceByClassIDAndDate(ctx, classID, today)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -455,7 +445,7 @@ func HandleViewClassAttendanceCallback(botService *services.BotService, callback
 	}
 
 	// Get class info
-	class, _ := botService.ClassRepo.GetByID(classID)
+	class, _ := botService.ClassRepo.GetByID(ctx, classID)
 	className := fmt.Sprintf("%d", classID)
 	if class != nil {
 		className = class.ClassName
@@ -493,13 +483,13 @@ func HandleViewClassAttendanceCallback(botService *services.BotService, callback
 }
 
 // HandleAttendanceToggle handles toggling a student's attendance status
-func HandleAttendanceToggle(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID, studentID int) error {
+func HandleAttendanceToggle(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID, studentID int) error {
 	telegramID := callback.From.ID
 
 	// Get state data
-	stateData, err := botService.StateManager.GetData(telegramID)
-	if err != nil || stateData == nil {
-		stateData = &models.StateData{
+	stateData, err := state.Load[models.AttendanceData](ctx, botService.StateManager, telegramID)
+	if err != nil || stateData.ClassID == nil {
+		stateData = &models.AttendanceData{
 			ClassID:    &classID,
 			AbsentList: []int{},
 		}
@@ -525,31 +515,30 @@ func HandleAttendanceToggle(botService *services.BotService, callback *tgbotapi.
 	stateData.AbsentList = newAbsentList
 
 	// Update state
-	err = botService.StateManager.Set(telegramID, "taking_attendance", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateTakingAttendance, stateData)
 	if err != nil {
-		log.Printf("Failed to update state: %v", err)
+		botService.Log(telegramID).Error("failed to update state", "error", err)
 	}
 
 	// Re-render the attendance selection screen with updated state
 	chatID := callback.Message.Chat.ID
 
 	// Get students in this class
-	students, err := botService.StudentRepo.GetByClassID(classID)
+	students, err := botService.StudentRepo.GetByClassID(ctx, classID)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
 		return nil
 	}
 
 	// Get class name
-	class, _ := botService.ClassRepo.GetByID(classID)
+	class, _ := botService.ClassRepo.GetByID(ctx, classID)
 	className := fmt.Sprintf("%d", classID)
 	if class != nil {
 		className = class.ClassName
 	}
 
-	// Get today's date in Uzbekistan time
-	location, _ := time.LoadLocation("Asia/Tashkent")
-	today := time.Now().In(location)
+	// Get today's date in the school's timezone
+	today := time.Now().In(botService.Location)
 
 	// Create absent map for quick lookup
 	absentMap := make(map[int]bool)
@@ -598,19 +587,19 @@ func HandleAttendanceToggle(botService *services.BotService, callback *tgbotapi.
 	editMsg.ParseMode = "HTML"
 	editMsg.ReplyMarkup = &keyboard
 
-	_, err = botService.Bot.Send(editMsg)
+	_, err = botService.TelegramService.Send(editMsg)
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 	return err
 }
 
 // HandleAttendanceFinish handles finishing attendance for a class
-func HandleAttendanceFinish(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleAttendanceFinish(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get state data
-	stateData, err := botService.StateManager.GetData(telegramID)
-	if err != nil || stateData == nil {
+	stateData, err := state.Load[models.AttendanceData](ctx, botService.StateManager, telegramID)
+	if err != nil || stateData.ClassID == nil {
 		text := "❌ Xatolik: Sessiya tugagan. Iltimos, qaytadan boshlang.\n\n" +
 			"❌ Ошибка: Сессия истекла. Пожалуйста, начните заново."
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -618,8 +607,8 @@ func HandleAttendanceFinish(botService *services.BotService, callback *tgbotapi.
 	}
 
 	// Get teacher or admin
-	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(telegramID)
-	admin, _ := botService.AdminRepo.GetByTelegramID(telegramID)
+	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
+	admin, _ := botService.AdminRepo.GetByTelegramID(ctx, telegramID)
 
 	var teacherID *int
 	var adminID *int
@@ -638,16 +627,15 @@ func HandleAttendanceFinish(botService *services.BotService, callback *tgbotapi.
 	}
 
 	// Get all students in class
-	students, err := botService.StudentRepo.GetByClassID(classID)
+	students, err := botService.StudentRepo.GetByClassID(ctx, classID)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
-	// Get today's date in Uzbekistan time
-	location, _ := time.LoadLocation("Asia/Tashkent")
-	today := time.Now().In(location)
+	// Get today's date in the school's timezone
+	today := time.Now().In(botService.Location)
 	todayStr := today.Format("2006-01-02")
 
 	// Create absent map
@@ -656,51 +644,35 @@ func HandleAttendanceFinish(botService *services.BotService, callback *tgbotapi.
 		absentMap[id] = true
 	}
 
-	// Create attendance records for all students
-	successCount := 0
-	errorCount := 0
-	updatedCount := 0
 	absentStudentNames := []string{}
-
 	for _, student := range students {
-		status := "present"
 		if absentMap[student.ID] {
-			status = "absent"
 			absentStudentNames = append(absentStudentNames, student.FirstName+" "+student.LastName)
 		}
+	}
 
-		req := &models.CreateAttendanceRequest{
-			StudentID:         student.ID,
-			Date:              todayStr,
-			Status:            status,
-			MarkedByTeacherID: teacherID,
-			MarkedByAdminID:   adminID,
-		}
+	// Record the whole class in one transaction; records already taken today
+	// are overwritten. On failure nothing is saved and the selection is kept,
+	// so the teacher can press the button again.
+	err = botService.AttendanceService.MarkAllPresentExcept(ctx, classID, todayStr, stateData.AbsentList, teacherID, adminID)
+	if err != nil {
+		botService.Log(telegramID).Error("failed to save attendance", "class_id", classID, "error", err)
+		text := "❌ Yo'qlama saqlanmadi, qaytadan urinib ko'ring / Посещаемость не сохранена, попробуйте ещё раз"
+		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
 
-		_, err := botService.AttendanceService.CreateAttendance(req)
-		if err != nil {
-			if strings.Contains(err.Error(), "UNIQUE constraint") {
-				// Already exists for today, skip
-				log.Printf("Attendance already exists for student %d on %s, skipping", student.ID, todayStr)
-				updatedCount++
-			} else {
-				errorCount++
-				log.Printf("Failed to create attendance for student %d: %v", student.ID, err)
-			}
-		} else {
-			successCount++
-			// Send notification if absent
-			if status == "absent" {
-				go notifyParentAboutAbsence(botService, student.ID, todayStr)
-			}
+	for _, student := range students {
+		if absentMap[student.ID] {
+			notifyParentAboutAbsence(ctx, botService, student.ID, todayStr)
 		}
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Get class name
-	class, _ := botService.ClassRepo.GetByID(classID)
+	class, _ := botService.ClassRepo.GetByID(ctx, classID)
 	className := fmt.Sprintf("%d", classID)
 	if class != nil {
 		className = class.ClassName
@@ -722,17 +694,16 @@ func HandleAttendanceFinish(botService *services.BotService, callback *tgbotapi.
 	)
 
 	// Delete the selection message
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	// Return appropriate keyboard based on who finished attendance
 	var keyboard interface{}
 	if teacher != nil {
 		lang := i18n.GetLanguage(teacher.Language)
-		keyboard = utils.MakeTeacherMainMenuKeyboard(lang)
+		keyboard = utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 	} else if admin != nil {
 		// Get admin's user record for language
-		user, _ := botService.UserService.GetUserByTelegramID(telegramID)
+		user, _ := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 		lang := i18n.LanguageUzbek
 		if user != nil {
 			lang = i18n.GetLanguage(user.Language)
@@ -746,17 +717,22 @@ func HandleAttendanceFinish(botService *services.BotService, callback *tgbotapi.
 	err = botService.TelegramService.SendMessage(chatID, text, keyboard)
 
 	// Send notification to ALL admins about attendance
-	go notifyAdminsAboutAttendance(botService, className, todayStr, markedByName, presentCount, absentCount, absentStudentNames)
+	notifyAdminsAboutAttendance(ctx, botService, className, todayStr, markedByName, presentCount, absentCount, absentStudentNames)
 
 	return err
 }
 
-// notifyAdminsAboutAttendance sends notification to all admins about completed attendance
-func notifyAdminsAboutAttendance(botService *services.BotService, className, date, markedBy string, presentCount, absentCount int, absentStudentNames []string) {
-	// Get all admins
-	admins, err := botService.AdminRepo.GetAll()
+// notifyAdminsAboutAttendance queues a notification about completed attendance
+// to the admins who may see attendance
+func notifyAdminsAboutAttendance(ctx context.Context, botService *services.BotService, className, date, markedBy string, presentCount, absentCount int, absentStudentNames []string) {
+	if !botService.Settings().Notifications.AdminAttendanceReports {
+		return
+	}
+
+	// Get the admins who may see attendance
+	adminIDs, err := botService.GetAdminTelegramIDs(ctx, models.PermAttendanceView)
 	if err != nil {
-		log.Printf("Failed to get admins for attendance notification: %v", err)
+		botService.Logger.Error("failed to get admins for attendance notification", "class", className, "error", err)
 		return
 	}
 
@@ -779,31 +755,41 @@ func notifyAdminsAboutAttendance(botService *services.BotService, className, dat
 		}
 	}
 
-	// Send to all admins
-	for _, admin := range admins {
-		if admin.TelegramID == nil || *admin.TelegramID == 0 {
-			continue
-		}
+	// Queue for those admins
+	var notifications []*models.Notification
+	for _, adminID := range adminIDs {
+		notifications = append(notifications, &models.Notification{
+			ChatID: adminID,
+			Kind:   models.NotificationAttendanceReport,
+			Text:   text,
+		})
+	}
 
-		_ = botService.TelegramService.SendMessage(*admin.TelegramID, text, nil)
+	if err := botService.Outbox.Enqueue(ctx, notifications...); err != nil {
+		botService.Logger.Error("failed to queue attendance notification", "class", className, "error", err)
 	}
 }
 
-// notifyParentAboutAbsence sends notification to parent about absence
-func notifyParentAboutAbsence(botService *services.BotService, studentID int, date string) {
+// notifyParentAboutAbsence queues a notification to the student's parents about an absence
+func notifyParentAboutAbsence(ctx context.Context, botService *services.BotService, studentID int, date string) {
+	if !botService.Settings().Notifications.ParentAbsenceAlerts {
+		return
+	}
+
 	// Get parents linked to this student
-	parents, err := botService.StudentRepo.GetStudentParents(studentID)
+	parents, err := botService.StudentRepo.GetStudentParents(ctx, studentID)
 	if err != nil {
-		log.Printf("Failed to get parents for notification: %v", err)
+		botService.Logger.Error("failed to get parents for absence notification", "student_id", studentID, "error", err)
 		return
 	}
 
 	// Get student info
-	student, err := botService.StudentRepo.GetByID(studentID)
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil {
 		return
 	}
 
+	var notifications []*models.Notification
 	for _, parent := range parents {
 		if parent.TelegramID == 0 {
 			continue
@@ -826,6 +812,14 @@ func notifyParentAboutAbsence(botService *services.BotService, studentID int, da
 				student.FirstName, student.LastName, date)
 		}
 
-		_ = botService.TelegramService.SendMessage(parent.TelegramID, text, nil)
+		notifications = append(notifications, &models.Notification{
+			ChatID: parent.TelegramID,
+			Kind:   models.NotificationAbsence,
+			Text:   text,
+		})
+	}
+
+	if err := botService.Outbox.Enqueue(ctx, notifications...); err != nil {
+		botService.Logger.Error("failed to queue absence notification", "student_id", studentID, "error", err)
 	}
 }
@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/models"
+	"parent-bot/internal/services"
+)
+
+// auditPageSize is how many audit entries one page shows
+const auditPageSize = 10
+
+// auditPeriods are the period filters offered, in days; 0 is all time
+var auditPeriods = []int{1, 7, 30, 0}
+
+// auditEntityLabels name entity types on filter buttons
+var auditEntityLabels = map[string]string{
+	models.AuditEntityTestResult:   "📝 Baholar / Оценки",
+	models.AuditEntityAttendance:   "📋 Davomat / Посещаемость",
+	models.AuditEntityStudent:      "👦 O'quvchilar / Ученики",
+	models.AuditEntityClass:        "🏫 Sinflar / Классы",
+	models.AuditEntityTeacher:      "👨‍🏫 O'qituvchilar / Учителя",
+	models.AuditEntityAnnouncement: "📢 E'lonlar / Объявления",
+	models.AuditEntityTimetable:    "📅 Jadvallar / Расписания",
+	models.AuditEntityParent:       "👨‍👩‍👧 Ota-onalar / Родители",
+	models.AuditEntityComplaint:    "📨 Shikoyatlar / Жалобы",
+	models.AuditEntityProposal:     "💡 Takliflar / Предложения",
+	models.AuditEntityAdmin:        "👑 Adminlar / Админы",
+	models.AuditEntityRole:         "🔐 Rollar / Роли",
+	models.AuditEntityAPIToken:     "🔑 API tokenlar / API токены",
+	models.AuditEntityAccess:       "🚫 Rad etilgan / Отказы в доступе",
+}
+
+// auditView is what an audit log page shows: every entity, one entity type
+// or one entity, changed in the last days (0 for all time)
+type auditView struct {
+	entityType string
+	entityID   string
+	days       int
+}
+
+// parseAuditView reads a view from its callback scope: "all", an entity
+// type, or "<type>:<id>"
+func parseAuditView(scope string, days int) auditView {
+	if scope == "all" {
+		return auditView{days: days}
+	}
+	entityType, entityID, _ := strings.Cut(scope, ":")
+	return auditView{entityType: entityType, entityID: entityID, days: days}
+}
+
+// scope encodes the view's entity filter for callbacks
+func (v auditView) scope() string {
+	switch {
+	case v.entityType == "":
+		return "all"
+	case v.entityID != "":
+		return v.entityType + ":" + v.entityID
+	default:
+		return v.entityType
+	}
+}
+
+// page returns the callback payload for a page of the view
+func (v auditView) page(offset int) string {
+	return fmt.Sprintf("audit_%s_%d_%d", v.scope(), v.days, offset)
+}
+
+// filter selects the view's entries
+func (v auditView) filter(now time.Time, limit, offset int) *models.AuditFilter {
+	filter := &models.AuditFilter{
+		EntityType: v.entityType,
+		EntityID:   v.entityID,
+		Limit:      limit,
+		Offset:     offset,
+	}
+	if v.days > 0 {
+		since := now.AddDate(0, 0, -v.days)
+		filter.Since = &since
+	}
+	return filter
+}
+
+// describe names the view's filters
+func (v auditView) describe() string {
+	what := "Hammasi / Все"
+	if label, ok := auditEntityLabels[v.entityType]; ok {
+		what = label
+	}
+	if v.entityID != "" {
+		what += " #" + html.EscapeString(v.entityID)
+	}
+	return what + " · " + auditPeriodLabel(v.days)
+}
+
+// auditPeriodLabel names a period filter
+func auditPeriodLabel(days int) string {
+	switch days {
+	case 0:
+		return "Hammasi / Всё время"
+	case 1:
+		return "24 soat / 24 часа"
+	default:
+		return fmt.Sprintf("%d kun / дней", days)
+	}
+}
+
+// HandleAuditCommand handles /audit [entity_type [id]] - the audit log,
+// optionally of one entity type or one entity
+func HandleAuditCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	var view auditView
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) > 0 {
+		valid := slices.Contains(models.AuditEntityTypes, args[0]) && len(args) <= 2
+		if valid && len(args) == 2 {
+			_, err := strconv.ParseInt(args[1], 10, 64)
+			valid = err == nil
+		}
+		if !valid {
+			text := "❌ Format: /audit [tur / тип] [id]\n\n" +
+				"Turlar / Типы: <code>" + strings.Join(models.AuditEntityTypes, "</code>, <code>") + "</code>\n\n" +
+				"Misol / Пример: <code>/audit test_result 17</code>"
+			return botService.TelegramService.SendMessage(message.Chat.ID, text, nil)
+		}
+		view.entityType = args[0]
+		if len(args) == 2 {
+			view.entityID = args[1]
+		}
+	}
+
+	text, keyboard, err := renderAuditPage(ctx, botService, view, 0)
+	if err != nil {
+		return err
+	}
+	return botService.TelegramService.SendMessage(message.Chat.ID, text, keyboard)
+}
+
+// HandleAdminAuditCallback handles the audit log button in the admin panel
+func HandleAdminAuditCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
+
+	text, keyboard, err := renderAuditPage(ctx, botService, auditView{days: 7}, 0)
+	if err != nil {
+		return err
+	}
+	return botService.TelegramService.SendMessage(callback.Message.Chat.ID, text, keyboard)
+}
+
+// HandleAuditPageCallback shows another page or filter of the audit log in place
+func HandleAuditPageCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, view auditView, offset int) error {
+	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
+
+	text, keyboard, err := renderAuditPage(ctx, botService, view, offset)
+	if err != nil {
+		return err
+	}
+	return botService.TelegramService.EditMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, &keyboard)
+}
+
+// HandleAuditExportCallback sends the entries of an audit log view as a CSV file
+func HandleAuditExportCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, view auditView) error {
+	chatID := callback.Message.Chat.ID
+	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "⏳")
+
+	now := time.Now()
+	filter := view.filter(now, 0, 0)
+
+	total, err := botService.AuditService.Count(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	written, err := botService.AuditService.ExportCSV(ctx, filter, botService.Location, &buf)
+	if err != nil {
+		return err
+	}
+
+	caption := fmt.Sprintf("📜 %s\n%d", view.describe(), written)
+	if written < total {
+		caption += fmt.Sprintf(" / %d (eng yangilari / самые новые)", total)
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("audit_%s.csv", now.In(botService.Location).Format("2006-01-02_1504")),
+		Bytes: buf.Bytes(),
+	})
+	doc.Caption = caption
+	doc.ParseMode = "HTML"
+	if _, err := botService.TelegramService.Send(doc); err != nil {
+		return fmt.Errorf("failed to send audit export: %w", err)
+	}
+
+	botService.Log(callback.From.ID).Info("audit log exported", "scope", view.scope(), "days", view.days, "entries", written)
+	return nil
+}
+
+// renderAuditPage builds one page of an audit log view with its filter,
+// navigation and export buttons
+func renderAuditPage(ctx context.Context, botService *services.BotService, view auditView, offset int) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	now := time.Now()
+	filter := view.filter(now, auditPageSize, max(offset, 0))
+
+	entries, err := botService.AuditService.List(ctx, filter)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	total, err := botService.AuditService.Count(ctx, filter)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	text := "📜 <b>Audit jurnali / Журнал аудита</b>\n"
+	text += view.describe() + "\n"
+	if total == 0 {
+		text += "\nO'zgarishlar yo'q / Изменений нет"
+	} else {
+		text += fmt.Sprintf("%d–%d / %d\n", filter.Offset+1, filter.Offset+len(entries), total)
+	}
+
+	for _, e := range entries {
+		text += "\n" + formatAuditEntry(e, botService.Location)
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	// Entity filters, unless the view is of one entity
+	if view.entityID == "" {
+		mark := func(selected bool, label string) string {
+			if selected {
+				return "✅ " + label
+			}
+			return label
+		}
+
+		all := view
+		all.entityType = ""
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(mark(view.entityType == "", "Hammasi / Все"), all.page(0)),
+		))
+
+		var row []tgbotapi.InlineKeyboardButton
+		for _, entityType := range models.AuditEntityTypes {
+			v := view
+			v.entityType = entityType
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(
+				mark(view.entityType == entityType, auditEntityLabels[entityType]), v.page(0)))
+			if len(row) == 2 {
+				rows = append(rows, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+
+	// Period filters
+	var periods []tgbotapi.InlineKeyboardButton
+	for _, days := range auditPeriods {
+		v := view
+		v.days = days
+		label := fmt.Sprintf("%dd", days)
+		if days == 0 {
+			label = "∞"
+		}
+		if days == view.days {
+			label = "✅ " + label
+		}
+		periods = append(periods, tgbotapi.NewInlineKeyboardButtonData(label, v.page(0)))
+	}
+	rows = append(rows, periods)
+
+	// Navigation
+	var nav []tgbotapi.InlineKeyboardButton
+	if filter.Offset > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀️", view.page(max(filter.Offset-auditPageSize, 0))))
+	}
+	if filter.Offset+len(entries) < total {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("▶️", view.page(filter.Offset+auditPageSize)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+
+	if total > 0 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📤 CSV", fmt.Sprintf("audit_export_%s_%d", view.scope(), view.days)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("◀️ Orqaga / Назад", "admin_back"),
+	))
+
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
+
+// formatAuditEntry renders one audit entry with what it changed
+func formatAuditEntry(e *models.AuditEntry, loc *time.Location) string {
+	text := fmt.Sprintf("🕐 %s · <b>%s</b>", e.CreatedAt.In(loc).Format("02.01 15:04"), html.EscapeString(e.Action))
+	if e.EntityID != "" {
+		text += " #" + html.EscapeString(e.EntityID)
+	}
+	text += "\n"
+
+	actor := html.EscapeString(e.ActorName)
+	if e.ActorTelegramID != nil {
+		actor += fmt.Sprintf(" (<code>%d</code>)", *e.ActorTelegramID)
+	}
+	text += fmt.Sprintf("👤 %s · %s · %s\n", actor, html.EscapeString(e.ActorRole), e.Source)
+
+	for _, change := range auditChanges(e) {
+		text += "   " + html.EscapeString(change) + "\n"
+	}
+	return text
+}
+
+// auditMaxChanges is how many changed fields an entry lists
+const auditMaxChanges = 4
+
+// auditChanges lists the fields an entry changed as "field: old → new"
+func auditChanges(e *models.AuditEntry) []string {
+	var before, after map[string]json.RawMessage
+	_ = json.Unmarshal(e.Before, &before)
+	_ = json.Unmarshal(e.After, &after)
+
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		return []string{"➕ " + auditSummary(after)}
+	case after == nil:
+		return []string{"🗑 " + auditSummary(before)}
+	}
+
+	var keys []string
+	for key := range after {
+		keys = append(keys, key)
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	var changes []string
+	for _, key := range keys {
+		if key == "updated_at" || bytes.Equal(before[key], after[key]) {
+			continue
+		}
+		if len(changes) == auditMaxChanges {
+			changes = append(changes, "…")
+			break
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s → %s", key, auditValue(before[key]), auditValue(after[key])))
+	}
+	return changes
+}
+
+// auditSummaryFields are shown for created and deleted entities, when present
+var auditSummaryFields = []string{
+	"class_name", "first_name", "last_name", "phone_number", "subject_name", "score",
+	"title", "name", "status", "student_id", "class_id", "date",
+}
+
+// auditSummary names a created or deleted entity by its identifying fields
+func auditSummary(fields map[string]json.RawMessage) string {
+	var parts []string
+	for _, key := range auditSummaryFields {
+		if value, ok := fields[key]; ok && string(value) != "null" {
+			parts = append(parts, fmt.Sprintf("%s: %s", key, auditValue(value)))
+		}
+		if len(parts) == auditMaxChanges {
+			break
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// auditValue renders a JSON value briefly
+func auditValue(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "—"
+	}
+
+	var s string
+	value := string(raw)
+	if json.Unmarshal(raw, &s) == nil {
+		value = s
+	}
+
+	if runes := []rune(value); len(runes) > 40 {
+		value = string(runes[:40]) + "…"
+	}
+	return value
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
+	"parent-bot/internal/callback"
+	"parent-bot/internal/models"
+	"parent-bot/internal/services"
+	"parent-bot/internal/state"
+)
+
+// RegisterCallbackRoutes builds the callback router and attaches it to the bot service.
+// Every inline button's payload must be registered here with the rule its caller must pass.
+func RegisterCallbackRoutes(botService *services.BotService) *callback.Router {
+	r := callback.NewRouter(botService.Policy)
+
+	// on adapts a handler for a route without parameters
+	on := func(pattern string, rule authz.Rule, h func(context.Context, *services.BotService, *tgbotapi.CallbackQuery) error) {
+		r.Handle(pattern, rule, func(ctx context.Context, q *tgbotapi.CallbackQuery, _ callback.Params) error {
+			return h(ctx, botService, q)
+		})
+	}
+
+	// onInt adapts a handler that takes one parsed integer
+	onInt := func(pattern, name string, rule authz.Rule, h func(context.Context, *services.BotService, *tgbotapi.CallbackQuery, int) error) {
+		r.Handle(pattern, rule, func(ctx context.Context, q *tgbotapi.CallbackQuery, p callback.Params) error {
+			return h(ctx, botService, q, p.Int(name))
+		})
+	}
+
+	// onStr adapts a handler that takes one string parameter
+	onStr := func(pattern, name string, rule authz.Rule, h func(context.Context, *services.BotService, *tgbotapi.CallbackQuery, string) error) {
+		r.Handle(pattern, rule, func(ctx context.Context, q *tgbotapi.CallbackQuery, p callback.Params) error {
+			return h(ctx, botService, q, p.String(name))
+		})
+	}
+
+	// onInt2 adapts a handler that takes a class ID and a student ID
+	onInt2 := func(pattern string, rule authz.Rule, h func(context.Context, *services.BotService, *tgbotapi.CallbackQuery, int, int) error) {
+		r.Handle(pattern, rule, func(ctx context.Context, q *tgbotapi.CallbackQuery, p callback.Params) error {
+			return h(ctx, botService, q, p.Int("class_id"), p.Int("student_id"))
+		})
+	}
+
+	// Language selection (before registration)
+	on("lang_uz", authz.Anyone, HandleLanguageSelection)
+	on("lang_ru", authz.Anyone, HandleLanguageSelection)
+
+	// Parent registration
+	onStr("select_class_{class_name}", "class_name", authz.Parent, HandleSelectClassCallback)
+	onInt("select_student_{student_id:int}", "student_id", authz.Parent, HandleSelectStudentCallback)
+	on("skip_child_selection", authz.Parent, HandleSkipChildSelectionCallback)
+	on("back_to_class_selection", authz.Parent, HandleBackToClassSelectionCallback)
+
+	// Parent: my kids
+	on("add_another_child", authz.Parent, HandleAddAnotherChildCallback)
+	onStr("mykids_class_{class_name}", "class_name", authz.Parent, HandleMyKidsClassCallback)
+	onInt("mykids_student_{student_id:int}", "student_id", authz.Parent, HandleMyKidsStudentCallback)
+	on("back_to_my_kids", authz.Parent, HandleBackToMyKidsCallback)
+	on("back_to_mykids_class_selection", authz.Parent, HandleBackToMyKidsClassSelectionCallback)
+	on("back_to_main", authz.Parent, HandleBackToMainCallback)
+	on("show_my_kids", authz.Parent, HandleShowMyKidsCallback)
+	onInt("view_child_{student_id:int}", "student_id", authz.ParentOfStudent("student_id"), HandleViewChildCallback)
+	onInt("view_child_attendance_{student_id:int}", "student_id", authz.ParentOfStudent("student_id"), HandleViewChildAttendanceCallback)
+	onInt("view_child_grades_{student_id:int}", "student_id", authz.ParentOfStudent("student_id"), HandleViewChildGradesCallback)
+	onInt("select_child_{student_id:int}", "student_id", authz.ParentOfStudent("student_id"), HandleChildInfoCallback) // deprecated, use view_child_
+
+	// Deprecated registration class keyboard
+	onStr("class_{class_name}", "class_name", authz.Anyone, HandleClassSelection)
+	r.Handle("class_info_{class_name}", authz.Anyone, func(ctx context.Context, q *tgbotapi.CallbackQuery, _ callback.Params) error {
+		return botService.TelegramService.AnswerCallbackQuery(q.ID, "")
+	})
+
+	// Complaints
+	onInt("complaint_select_child_{student_id:int}", "student_id", authz.ParentOfStudent("student_id"), HandleComplaintSelectChildCallback)
+	on("confirm_complaint", authz.Parent, HandleComplaintConfirmation)
+	on("cancel_complaint", authz.Parent, HandleComplaintCancellation)
+	onInt("complaints_page_{offset:int}", "offset", authz.Parent, HandleComplaintsPageCallback)
+
+	// Proposals
+	onInt("proposal_select_child_{student_id:int}", "student_id", authz.ParentOfStudent("student_id"), HandleProposalSelectChildCallback)
+	on("confirm_proposal", authz.Parent, HandleProposalConfirmation)
+	on("cancel_proposal", authz.Parent, HandleProposalCancellation)
+	onInt("proposals_page_{offset:int}", "offset", authz.Parent, HandleProposalsPageCallback)
+
+	// Timetables
+	onInt("timetable_child_{student_id:int}", "student_id", authz.ParentOfStudent("student_id"), HandleTimetableChildSelection)
+	onInt("timetable_select_{class_id:int}", "class_id", authz.Can(models.PermTimetablesManage), HandleTimetableClassSelection)
+	onInt("timetable_delete_{timetable_id:int}", "timetable_id", authz.Can(models.PermTimetablesManage), HandleTimetableDeleteCallback)
+
+	// Announcements
+	r.Handle("announcement_skip_file", authz.Can(models.PermAnnouncementsManage), func(ctx context.Context, q *tgbotapi.CallbackQuery, _ callback.Params) error {
+		stateData, err := state.Load[models.AnnouncementData](ctx, botService.StateManager, q.From.ID)
+		if err != nil {
+			return err
+		}
+		return HandleAnnouncementSkipFile(ctx, botService, q, stateData)
+	})
+	onInt("announcement_edit_{announcement_id:int}", "announcement_id", authz.Can(models.PermAnnouncementsManage), HandleAnnouncementEditCallback)
+	onInt("announcement_delete_{announcement_id:int}", "announcement_id", authz.Can(models.PermAnnouncementsManage), HandleAnnouncementDeleteCallback)
+	onInt("announcement_resend_{announcement_id:int}", "announcement_id",
+		authz.AnyOf(authz.Can(models.PermAnnouncementsManage), authz.AllOf(authz.Can(models.PermClassAnnouncementsPost), authz.AuthorOfAnnouncement("announcement_id"))), HandleAnnouncementResendCallback)
+
+	// Admin panel
+	on("admin_users", authz.Can(models.PermUsersView), HandleAdminUsersCallback)
+	on("admin_complaints", authz.Can(models.PermComplaintsView), HandleAdminComplaintsCallback)
+	on("admin_stats", authz.Can(models.PermStatsView), HandleAdminStatsCallback)
+	on("admin_manage_classes", manageClasses, HandleAdminManageClassesCallback)
+	on("admin_create_class", authz.Can(models.PermClassesManage), HandleAdminCreateClassCallback)
+	onInt("class_delete_{class_id:int}", "class_id", authz.Can(models.PermClassesManage), HandleClassDeleteCallback)
+	onInt("admin_view_class_{class_id:int}", "class_id", authz.Can(models.PermStudentsManage), HandleAdminViewClassCallback)
+	onInt("admin_add_student_{class_id:int}", "class_id", authz.Can(models.PermStudentsManage), HandleAdminAddStudentCallback)
+	onInt2("admin_delete_student_{class_id:int}_{student_id:int}", authz.Can(models.PermStudentsManage), HandleAdminDeleteStudentCallback)
+	on("admin_upload_timetable", authz.Can(models.PermTimetablesManage), HandleAdminUploadTimetableCallback)
+	on("admin_post_announcement", authz.Can(models.PermAnnouncementsManage), HandleAdminPostAnnouncementCallback)
+	on("admin_proposals", authz.Can(models.PermComplaintsView), HandleAdminProposalsCallback)
+	on("admin_view_timetables", authz.Can(models.PermTimetablesManage), HandleAdminViewTimetablesCallback)
+	on("admin_view_announcements", authz.Can(models.PermAnnouncementsManage), HandleAdminViewAnnouncementsCallback)
+	on("admin_manage_teachers", authz.Can(models.PermTeachersManage), HandleAdminManageTeachersCallback)
+	on("admin_add_teacher", authz.Can(models.PermTeachersManage), HandleAdminAddTeacherCallback)
+	onInt("admin_delete_teacher_{teacher_id:int}", "teacher_id", authz.Can(models.PermTeachersManage), HandleAdminDeleteTeacherCallback)
+	on("admin_export_attendance", authz.Can(models.PermReportsExport), HandleAdminExportAttendanceCallback)
+	on("admin_export_test_results", authz.Can(models.PermReportsExport), HandleAdminExportTestResultsCallback)
+	on("admin_back", authz.AdminPanel, HandleAdminBackCallback)
+
+	// Background jobs
+	on("admin_jobs", authz.Can(models.PermJobsManage), HandleAdminJobsCallback)
+	r.Handle("job_run_{name}", authz.Can(models.PermJobsManage), func(ctx context.Context, q *tgbotapi.CallbackQuery, p callback.Params) error {
+		return HandleJobRunCallback(botService, q, p.String("name"))
+	})
+
+	// Audit log
+	on("admin_audit", authz.Can(models.PermAuditView), HandleAdminAuditCallback)
+	r.Handle("audit_{scope}_{days:int}_{offset:int}", authz.Can(models.PermAuditView), func(ctx context.Context, q *tgbotapi.CallbackQuery, p callback.Params) error {
+		return HandleAuditPageCallback(ctx, botService, q, parseAuditView(p.String("scope"), p.Int("days")), p.Int("offset"))
+	})
+	r.Handle("audit_export_{scope}_{days:int}", authz.Can(models.PermAuditView), func(ctx context.Context, q *tgbotapi.CallbackQuery, p callback.Params) error {
+		return HandleAuditExportCallback(ctx, botService, q, parseAuditView(p.String("scope"), p.Int("days")))
+	})
+
+	// Roles and permissions
+	on("admin_roles", authz.Can(models.PermRolesManage), HandleAdminRolesCallback)
+	r.Handle("role_view_{role}", authz.Can(models.PermRolesManage), func(ctx context.Context, q *tgbotapi.CallbackQuery, p callback.Params) error {
+		return HandleRoleViewCallback(ctx, botService, q, p.String("role"))
+	})
+	r.Handle("role_perm_{role}_{index:int}", authz.Can(models.PermRolesManage), func(ctx context.Context, q *tgbotapi.CallbackQuery, p callback.Params) error {
+		return HandleRolePermissionCallback(ctx, botService, q, p.String("role"), p.Int("index"))
+	})
+
+	// Grade exports
+	onInt("export_grades_{class_id:int}", "class_id", authz.Can(models.PermReportsExport), HandleAdminExportGradesCallback)
+	onInt("export_grades_select_{class_id:int}", "class_id", authz.Can(models.PermReportsExport), HandleAdminExportGradesSelectClassCallback)
+	onInt("export_grades_custom_{class_id:int}", "class_id", authz.Can(models.PermReportsExport), HandleAdminExportGradesCustomDateCallback)
+
+	// Teacher panel
+	onInt("teacher_manage_class_{class_id:int}", "class_id", authz.TeacherOfClass("class_id"), HandleTeacherManageClassCallback)
+	onInt("teacher_add_student_{class_id:int}", "class_id", authz.TeacherCan(models.PermClassStudentsManage, "class_id"), HandleTeacherAddStudentCallback)
+	onInt2("teacher_delete_student_{class_id:int}_{student_id:int}", authz.AllOf(authz.Can(models.PermClassStudentsManage), authz.TeacherOfStudent("student_id")), HandleTeacherDeleteStudentCallback)
+	on("teacher_manage_students_back", authz.Teacher, HandleTeacherManageStudentsBackCallback)
+	on("teacher_back_to_main", authz.Teacher, HandleTeacherBackToMainCallback)
+
+	// Teacher announcements
+	onInt("teacher_announcement_toggle_class_{class_id:int}", "class_id", authz.TeacherCan(models.PermClassAnnouncementsPost, "class_id"), HandleTeacherAnnouncementToggleClass)
+	on("teacher_announcement_continue", postClassAnnouncements, HandleTeacherAnnouncementContinue)
+	on("teacher_announcement_cancel", postClassAnnouncements, HandleTeacherAnnouncementCancel)
+	on("teacher_announcement_skip_file", postClassAnnouncements, HandleTeacherAnnouncementSkipFile)
+	onInt("teacher_announcement_edit_{announcement_id:int}", "announcement_id", authz.AllOf(postClassAnnouncements, authz.AuthorOfAnnouncement("announcement_id")), HandleTeacherAnnouncementEdit)
+	onInt("teacher_announcement_delete_{announcement_id:int}", "announcement_id", authz.AllOf(postClassAnnouncements, authz.AuthorOfAnnouncement("announcement_id")), HandleTeacherAnnouncementDelete)
+
+	// Attendance
+	onInt("attendance_select_class_{class_id:int}", "class_id", authz.TeacherCan(models.PermAttendanceMark, "class_id"), HandleAttendanceClassSelection)
+	onInt2("attendance_toggle_{class_id:int}_{student_id:int}",
+		authz.AllOf(authz.TeacherCan(models.PermAttendanceMark, "class_id"), authz.TeacherOfStudent("student_id")), HandleAttendanceToggle)
+	onInt("attendance_finish_{class_id:int}", "class_id", authz.TeacherCan(models.PermAttendanceMark, "class_id"), HandleAttendanceFinish)
+	onInt("view_attendance_class_{class_id:int}", "class_id", authz.AnyOf(authz.Can(models.PermAttendanceView), authz.TeacherOfClass("class_id")), HandleViewClassAttendanceCallback)
+
+	// Test results
+	onInt("view_grades_class_{class_id:int}", "class_id", authz.AnyOf(authz.Can(models.PermGradesView), authz.TeacherOfClass("class_id")), HandleViewClassGradesCallback)
+	onInt("test_result_select_class_{class_id:int}", "class_id", authz.TeacherCan(models.PermGradesEdit, "class_id"), HandleTestResultClassSelectionCallback)
+	onInt("test_result_add_student_{student_id:int}", "student_id", authz.AllOf(authz.Can(models.PermGradesEdit), authz.TeacherOfStudent("student_id")), HandleTestResultAddStudentCallback)
+	on("test_result_back_to_classes", editGrades, HandleTestResultBackToClassesCallback)
+
+	botService.CallbackRouter = r
+	return r
+}
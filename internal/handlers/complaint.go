@@ -1,24 +1,26 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"log"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
+	"parent-bot/internal/state"
 	"parent-bot/internal/utils"
 	"parent-bot/internal/validator"
 )
 
 // HandleComplaintCommand initiates complaint submission
-func HandleComplaintCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleComplaintCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Check if user is registered
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -32,7 +34,7 @@ func HandleComplaintCommand(botService *services.BotService, message *tgbotapi.M
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get parent's children
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		return err
 	}
@@ -44,11 +46,11 @@ func HandleComplaintCommand(botService *services.BotService, message *tgbotapi.M
 
 	// If only one child, use that child automatically
 	if len(children) == 1 {
-		stateData := &models.StateData{
+		stateData := &models.ComplaintData{
 			Language:          user.Language,
 			SelectedStudentID: &children[0].StudentID,
 		}
-		err = botService.StateManager.Set(telegramID, models.StateAwaitingComplaint, stateData)
+		err = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingComplaint, stateData)
 		if err != nil {
 			return err
 		}
@@ -73,10 +75,10 @@ func HandleComplaintCommand(botService *services.BotService, message *tgbotapi.M
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
 
 	// Set state to selecting child for complaint
-	stateData := &models.StateData{
+	stateData := &models.ComplaintData{
 		Language: user.Language,
 	}
-	err = botService.StateManager.Set(telegramID, "selecting_child_for_complaint", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateSelectingChildForComplaint, stateData)
 	if err != nil {
 		return err
 	}
@@ -84,26 +86,18 @@ func HandleComplaintCommand(botService *services.BotService, message *tgbotapi.M
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleComplaintText handles complaint text input
-func HandleComplaintText(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleComplaintText(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.ComplaintData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(stateData.Language)
 
-	// Get user to check admin status for keyboard
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	var isAdmin bool
-	if user != nil {
-		isAdmin, _ = botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-	}
+	// Staff keep their admin panel button
+	hasAdminPanel := authz.CallerFrom(ctx).HasAdminPanel()
 
 	// Check if message contains media instead of text
 	if message.Text == "" {
@@ -125,7 +119,7 @@ func HandleComplaintText(botService *services.BotService, message *tgbotapi.Mess
 		}
 
 		// Keep the main menu keyboard visible
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, errorMsg, &keyboard)
 	}
 
@@ -134,13 +128,13 @@ func HandleComplaintText(botService *services.BotService, message *tgbotapi.Mess
 	if err != nil {
 		text := i18n.Get(i18n.ErrInvalidComplaint, lang) + "\n\n" + err.Error()
 		// Keep the main menu keyboard visible on validation errors too
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 	}
 
 	// Save complaint text in state
 	stateData.ComplaintText = complaintText
-	err = botService.StateManager.Set(telegramID, models.StateConfirmingComplaint, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateConfirmingComplaint, stateData)
 	if err != nil {
 		return err
 	}
@@ -153,12 +147,12 @@ func HandleComplaintText(botService *services.BotService, message *tgbotapi.Mess
 }
 
 // HandleComplaintConfirmation handles complaint confirmation
-func HandleComplaintConfirmation(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleComplaintConfirmation(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -170,7 +164,7 @@ func HandleComplaintConfirmation(botService *services.BotService, callback *tgbo
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get complaint text from state
-	stateData, err := botService.StateManager.GetData(telegramID)
+	stateData, err := state.Load[models.ComplaintData](ctx, botService.StateManager, telegramID)
 	if err != nil {
 		return err
 	}
@@ -185,9 +179,9 @@ func HandleComplaintConfirmation(botService *services.BotService, callback *tgbo
 	// Get selected student from state data
 	var student *models.StudentWithClass
 	if stateData.SelectedStudentID != nil {
-		student, err = botService.StudentService.GetStudentByIDWithClass(*stateData.SelectedStudentID)
+		student, err = botService.StudentService.GetStudentByIDWithClass(ctx, *stateData.SelectedStudentID)
 		if err != nil || student == nil {
-			log.Printf("Failed to get student: %v", err)
+			botService.Log(telegramID).Error("failed to get student", "error", err)
 			text := "⚠️ Iltimos, avval farzandingizni tanlang / Пожалуйста, сначала выберите ребенка"
 			return botService.TelegramService.SendMessage(chatID, text, nil)
 		}
@@ -199,7 +193,7 @@ func HandleComplaintConfirmation(botService *services.BotService, callback *tgbo
 	// Generate DOCX document
 	docPath, filename, err := botService.DocumentService.GenerateComplaintDocument(user, student, stateData.ComplaintText)
 	if err != nil {
-		log.Printf("Failed to generate document: %v", err)
+		botService.Log(telegramID).Error("failed to generate document", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -207,7 +201,7 @@ func HandleComplaintConfirmation(botService *services.BotService, callback *tgbo
 	// Upload document to Telegram and get file_id
 	fileID, err := botService.TelegramService.UploadDocument(chatID, docPath, filename)
 	if err != nil {
-		log.Printf("Failed to upload document: %v", err)
+		botService.Log(telegramID).Error("failed to upload document", "error", err)
 		// Clean up temp file
 		_ = botService.DocumentService.DeleteTempFile(docPath)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
@@ -225,15 +219,15 @@ func HandleComplaintConfirmation(botService *services.BotService, callback *tgbo
 		Filename:       filename,
 	}
 
-	complaint, err := botService.ComplaintService.CreateComplaint(complaintReq)
+	complaint, err := botService.ComplaintService.CreateComplaint(ctx, complaintReq)
 	if err != nil {
-		log.Printf("Failed to save complaint: %v", err)
+		botService.Log(telegramID).Error("failed to save complaint", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Send success message
 	text := i18n.Get(i18n.MsgComplaintSubmitted, lang)
@@ -241,18 +235,18 @@ func HandleComplaintConfirmation(botService *services.BotService, callback *tgbo
 	_ = botService.TelegramService.SendMessage(chatID, text, keyboard)
 
 	// Notify admins with DOCX document
-	go notifyAdminsWithDocument(botService, user, student, complaint, fileID)
+	notifyAdminsWithDocument(ctx, botService, user, student, complaint, fileID)
 
 	return nil
 }
 
 // HandleComplaintCancellation handles complaint cancellation
-func HandleComplaintCancellation(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleComplaintCancellation(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -264,7 +258,7 @@ func HandleComplaintCancellation(botService *services.BotService, callback *tgbo
 	lang := i18n.GetLanguage(user.Language)
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Answer callback query
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, i18n.Get(i18n.MsgComplaintCancelled, lang))
@@ -276,17 +270,17 @@ func HandleComplaintCancellation(botService *services.BotService, callback *tgbo
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
-// notifyAdminsWithDocument sends complaint as DOCX document to all admins
-func notifyAdminsWithDocument(botService *services.BotService, user *models.User, student *models.StudentWithClass, complaint *models.Complaint, fileID string) {
-	// Get admin telegram IDs
-	adminIDs, err := botService.GetAdminTelegramIDs()
+// notifyAdminsWithDocument queues the complaint DOCX document for the admins who may see complaints
+func notifyAdminsWithDocument(ctx context.Context, botService *services.BotService, user *models.User, student *models.StudentWithClass, complaint *models.Complaint, fileID string) {
+	// Get the telegram IDs of admins who may see complaints and proposals
+	adminIDs, err := botService.GetAdminTelegramIDs(ctx, models.PermComplaintsView)
 	if err != nil {
-		log.Printf("Failed to get admin IDs: %v", err)
+		botService.Log(user.TelegramID).Error("failed to get admin IDs", "complaint_id", complaint.ID, "error", err)
 		return
 	}
 
 	if len(adminIDs) == 0 {
-		log.Println("No admins configured")
+		botService.Log(user.TelegramID).Warn("no admins to notify", "complaint_id", complaint.ID)
 		return
 	}
 
@@ -315,22 +309,32 @@ func notifyAdminsWithDocument(botService *services.BotService, user *models.User
 		utils.FormatDateTime(complaint.CreatedAt),
 	)
 
-	// Send document to all admins
-	err = botService.TelegramService.SendDocumentToAdmins(adminIDs, fileID, caption)
-	if err != nil {
-		log.Printf("Failed to send document to admins: %v", err)
+	// Queue the document for all admins
+	notifications := make([]*models.Notification, 0, len(adminIDs))
+	for _, adminID := range adminIDs {
+		notifications = append(notifications, &models.Notification{
+			ChatID:    adminID,
+			Kind:      models.NotificationComplaint,
+			Text:      caption,
+			FileID:    fileID,
+			MediaType: models.MediaDocument,
+		})
+	}
+
+	if err := botService.Outbox.Enqueue(ctx, notifications...); err != nil {
+		botService.Log(user.TelegramID).Error("failed to queue document for admins", "complaint_id", complaint.ID, "error", err)
 	}
 }
 
 // HandleMyComplaintsCommand shows user's complaint history
-func HandleMyComplaintsCommand(botService *services.BotService, message *tgbotapi.Message) error {
-	return handleComplaintsPage(botService, message.From.ID, message.Chat.ID, 0)
+func HandleMyComplaintsCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	return handleComplaintsPage(ctx, botService, message.From.ID, message.Chat.ID, 0)
 }
 
 // handleComplaintsPage shows complaints with pagination
-func handleComplaintsPage(botService *services.BotService, telegramID int64, chatID int64, offset int) error {
+func handleComplaintsPage(ctx context.Context, botService *services.BotService, telegramID int64, chatID int64, offset int) error {
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -345,7 +349,7 @@ func handleComplaintsPage(botService *services.BotService, telegramID int64, cha
 
 	// Get user complaints with pagination (10 per page)
 	const pageSize = 10
-	complaints, err := botService.ComplaintService.GetUserComplaints(user.ID, pageSize, offset)
+	complaints, err := botService.ComplaintService.GetUserComplaints(ctx, user.ID, pageSize, offset)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -408,7 +412,7 @@ func handleComplaintsPage(botService *services.BotService, telegramID int64, cha
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ReplyMarkup = keyboard
-		_, err = botService.Bot.Send(msg)
+		_, err = botService.TelegramService.Send(msg)
 		return err
 	}
 
@@ -416,24 +420,23 @@ func handleComplaintsPage(botService *services.BotService, telegramID int64, cha
 }
 
 // HandleComplaintsPageCallback handles pagination for complaints
-func HandleComplaintsPageCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, offset int) error {
+func HandleComplaintsPageCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, offset int) error {
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Delete old message
-	deleteMsg := tgbotapi.NewDeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID)
 
 	// Show new page
-	return handleComplaintsPage(botService, callback.From.ID, callback.Message.Chat.ID, offset)
+	return handleComplaintsPage(ctx, botService, callback.From.ID, callback.Message.Chat.ID, offset)
 }
 
 // HandleSettingsCommand shows settings menu
-func HandleSettingsCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleSettingsCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -448,7 +451,7 @@ func HandleSettingsCommand(botService *services.BotService, message *tgbotapi.Me
 	text := "⚙️ Sozlamalar / Настройки\n\n"
 
 	// Get all children
-	children, err := botService.StudentService.GetParentStudents(user.ID)
+	children, err := botService.StudentService.GetParentStudents(ctx, user.ID)
 	if err == nil && len(children) > 0 {
 		text += fmt.Sprintf("👨‍👩‍👧‍👦 Barcha farzandlar / Все дети: %d\n\n", len(children))
 	}
@@ -460,12 +463,12 @@ func HandleSettingsCommand(botService *services.BotService, message *tgbotapi.Me
 }
 
 // HandleComplaintSelectChildCallback handles child selection for complaint
-func HandleComplaintSelectChildCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
+func HandleComplaintSelectChildCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
 		return nil
@@ -474,7 +477,7 @@ func HandleComplaintSelectChildCallback(botService *services.BotService, callbac
 	lang := i18n.GetLanguage(user.Language)
 
 	// Verify student belongs to parent
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
 		return nil
@@ -495,11 +498,11 @@ func HandleComplaintSelectChildCallback(botService *services.BotService, callbac
 	}
 
 	// Set state with selected student
-	stateData := &models.StateData{
+	stateData := &models.ComplaintData{
 		Language:          user.Language,
 		SelectedStudentID: &studentID,
 	}
-	err = botService.StateManager.Set(telegramID, models.StateAwaitingComplaint, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingComplaint, stateData)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
 		return nil
@@ -509,8 +512,7 @@ func HandleComplaintSelectChildCallback(botService *services.BotService, callbac
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "✅")
 
 	// Delete the selection message
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	// Send request for complaint text
 	text := i18n.Get(i18n.MsgRequestComplaint, lang)
@@ -0,0 +1,375 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/config"
+	"parent-bot/internal/database"
+	"parent-bot/internal/fakebot"
+	"parent-bot/internal/handlers"
+	"parent-bot/internal/i18n"
+	"parent-bot/internal/models"
+	"parent-bot/internal/services"
+)
+
+var (
+	parent  = tgbotapi.User{ID: 5001, FirstName: "Dilnoza", UserName: "dilnoza"}
+	teacher = tgbotapi.User{ID: 6001, FirstName: "Malika", UserName: "malika"}
+)
+
+const (
+	parentPhone  = "+998901234567"
+	teacherPhone = "+998907654321"
+)
+
+// dialogue drives the bot through the fake Bot API, one update at a time
+type dialogue struct {
+	t     *testing.T
+	ctx   context.Context
+	srv   *fakebot.Server
+	bot   *services.BotService
+	admin *models.Admin
+	class *models.Class
+}
+
+// newDialogue starts a bot on an in-memory SQLite database with one class of
+// one student
+func newDialogue(t *testing.T) *dialogue {
+	t.Helper()
+
+	cfg := config.Defaults()
+	cfg.Bot.Token = fakebot.Token
+	cfg.Database.Path = ":memory:"
+	cfg.Documents.TempDir = t.TempDir()
+
+	if err := database.Connect(&cfg.Database); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if _, err := database.RunMigrations(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	srv := fakebot.NewServer()
+	t.Cleanup(srv.Close)
+	api, err := srv.NewBotAPI()
+	if err != nil {
+		t.Fatalf("bot api: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bot, err := services.NewBotServiceWithMessenger(cfg, database.DB, api, logger)
+	if err != nil {
+		t.Fatalf("bot service: %v", err)
+	}
+	handlers.RegisterCallbackRoutes(bot)
+
+	ctx := context.Background()
+	admin, err := bot.AdminRepo.Create(ctx, "+998909876543", "Admin", models.RoleAdmin)
+	if err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	class, err := bot.ClassService.CreateClass(ctx, "9A")
+	if err != nil {
+		t.Fatalf("create class: %v", err)
+	}
+	_, err = bot.StudentService.CreateStudent(ctx, &models.CreateStudentRequest{
+		FirstName:      "Ali",
+		LastName:       "Karimov",
+		ClassID:        class.ID,
+		AddedByAdminID: &admin.ID,
+	})
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+
+	return &dialogue{t: t, ctx: ctx, srv: srv, bot: bot, admin: admin, class: class}
+}
+
+// send hands an update to the bot and returns the last message it sent the user
+func (d *dialogue) send(update tgbotapi.Update) fakebot.Call {
+	d.t.Helper()
+
+	handlers.HandleUpdate(d.ctx, d.bot, update)
+
+	reply, ok := d.srv.LastTo(update.SentFrom().ID)
+	if !ok {
+		d.t.Fatalf("no reply to update %d", update.UpdateID)
+	}
+	return reply
+}
+
+// press clicks the inline button with the given text on a message
+func (d *dialogue) press(from tgbotapi.User, msg fakebot.Call, button string) fakebot.Call {
+	d.t.Helper()
+
+	data, ok := msg.CallbackData(button)
+	if !ok {
+		d.t.Fatalf("no button %q in %q, have %v", button, msg.Text, msg.Buttons())
+	}
+	return d.send(d.srv.Press(from, msg.MessageID, data))
+}
+
+// register takes the parent through /start, language, phone and child selection
+func (d *dialogue) register() fakebot.Call {
+	d.t.Helper()
+
+	reply := d.send(d.srv.Text(parent, "/start"))
+	reply = d.press(parent, reply, i18n.Get(i18n.BtnUzbek, i18n.LanguageUzbek))
+	if !strings.Contains(reply.Text, i18n.Get(i18n.MsgRequestPhone, i18n.LanguageUzbek)) {
+		d.t.Fatalf("after language: got %q, want the phone request", reply.Text)
+	}
+
+	reply = d.send(d.srv.Contact(parent, parentPhone))
+	reply = d.press(parent, reply, "9A")
+	return d.press(parent, reply, "Karimov Ali")
+}
+
+func TestRegistrationDialogue(t *testing.T) {
+	d := newDialogue(t)
+
+	reply := d.register()
+	if !strings.Contains(reply.Text, "Karimov Ali") {
+		t.Errorf("after choosing the child: got %q, want the child linked", reply.Text)
+	}
+
+	user, err := d.bot.UserService.GetUserByTelegramID(d.ctx, parent.ID)
+	if err != nil || user == nil {
+		t.Fatalf("user not saved: %v", err)
+	}
+	if user.PhoneNumber != parentPhone || user.Language != string(i18n.LanguageUzbek) {
+		t.Errorf("user = %s/%s, want %s/%s", user.PhoneNumber, user.Language, parentPhone, i18n.LanguageUzbek)
+	}
+
+	children, err := d.bot.StudentRepo.GetParentStudents(d.ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || children[0].StudentFirstName != "Ali" {
+		t.Errorf("children = %+v, want Ali", children)
+	}
+
+	current, _ := d.bot.StateManager.GetState(d.ctx, parent.ID)
+	if current != models.StateRegistered {
+		t.Errorf("state after registration = %q, want %q", current, models.StateRegistered)
+	}
+}
+
+func TestRegistrationNeedsOwnContact(t *testing.T) {
+	d := newDialogue(t)
+	lang := i18n.LanguageUzbek
+
+	reply := d.send(d.srv.Text(parent, "/start"))
+	d.press(parent, reply, i18n.Get(i18n.BtnUzbek, lang))
+
+	// Typing an admin's number, or sharing their contact, must not make the
+	// sender that admin
+	typed := d.srv.Text(parent, d.admin.PhoneNumber)
+	shared := d.srv.Contact(parent, d.admin.PhoneNumber)
+	shared.Message.Contact.UserID = parent.ID + 1
+
+	for name, update := range map[string]tgbotapi.Update{"typed": typed, "someone else's contact": shared} {
+		reply = d.send(update)
+		if reply.Text != i18n.Get(i18n.ErrOwnPhoneOnly, lang) {
+			t.Errorf("%s: got %q, want the own phone request", name, reply.Text)
+		}
+	}
+
+	user, err := d.bot.UserService.GetUserByTelegramID(d.ctx, parent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		t.Errorf("user registered with %s", user.PhoneNumber)
+	}
+	admin, err := d.bot.AdminRepo.GetByPhoneNumber(d.ctx, d.admin.PhoneNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.TelegramID != nil {
+		t.Errorf("admin linked to Telegram ID %d", *admin.TelegramID)
+	}
+
+	current, _ := d.bot.StateManager.GetState(d.ctx, parent.ID)
+	if current != models.StateAwaitingPhone {
+		t.Errorf("state = %q, want %q", current, models.StateAwaitingPhone)
+	}
+}
+
+func TestComplaintDialogue(t *testing.T) {
+	d := newDialogue(t)
+	d.register()
+
+	lang := i18n.LanguageUzbek
+	text := "Darsdan keyin sinf xonasi yopiq qolmoqda"
+
+	reply := d.send(d.srv.Text(parent, "/complaint"))
+	if reply.Text != i18n.Get(i18n.MsgRequestComplaint, lang) {
+		t.Fatalf("after /complaint: got %q", reply.Text)
+	}
+
+	reply = d.send(d.srv.Text(parent, text))
+	reply = d.press(parent, reply, i18n.Get(i18n.BtnConfirm, lang))
+	if reply.Text != i18n.Get(i18n.MsgComplaintSubmitted, lang) {
+		t.Errorf("after confirming: got %q", reply.Text)
+	}
+
+	var uploaded bool
+	for _, c := range d.srv.CallsTo(parent.ID) {
+		uploaded = uploaded || c.Method == "sendDocument"
+	}
+	if !uploaded {
+		t.Error("complaint document was not uploaded")
+	}
+
+	user, _ := d.bot.UserService.GetUserByTelegramID(d.ctx, parent.ID)
+	complaints, err := d.bot.ComplaintService.GetUserComplaints(d.ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(complaints) != 1 || complaints[0].ComplaintText != text {
+		t.Fatalf("complaints = %+v, want one with the text sent", complaints)
+	}
+	if complaints[0].TelegramFileID == "" {
+		t.Error("complaint saved without the document's file ID")
+	}
+}
+
+func TestAdminCommandNeedsPermission(t *testing.T) {
+	d := newDialogue(t)
+	d.register()
+
+	reply := d.send(d.srv.Text(parent, "/add_class 10B"))
+	if strings.Contains(reply.Text, "10B") {
+		t.Errorf("a parent ran /add_class: got %q", reply.Text)
+	}
+	if exists, _ := d.bot.ClassRepo.Exists(d.ctx, "10B"); exists {
+		t.Error("a parent created a class")
+	}
+
+	denials, err := d.bot.AuditService.List(d.ctx, &models.AuditFilter{
+		EntityType:      models.AuditEntityAccess,
+		ActorTelegramID: &parent.ID,
+		Limit:           10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(denials) != 1 || denials[0].EntityID != "/add_class" {
+		t.Errorf("denials = %+v, want /add_class", denials)
+	}
+}
+
+func TestRevokedStaffCannotFinishFlow(t *testing.T) {
+	d := newDialogue(t)
+	staff := tgbotapi.User{ID: 8001, FirstName: "Aziz"}
+
+	if err := d.bot.AdminRepo.UpdateTelegramID(d.ctx, d.admin.PhoneNumber, staff.ID); err != nil {
+		t.Fatal(err)
+	}
+	reply := d.send(d.srv.Text(staff, "/admin"))
+	reply = d.press(staff, reply, i18n.Get(i18n.BtnManageClasses, i18n.LanguageUzbek))
+	d.press(staff, reply, i18n.Get(i18n.BtnCreateClass, i18n.LanguageUzbek))
+	if current, _ := d.bot.StateManager.GetState(d.ctx, staff.ID); current != models.StateAwaitingClassName {
+		t.Fatalf("state = %q, want %q", current, models.StateAwaitingClassName)
+	}
+
+	// Removed from staff while the bot waits for the class name
+	if err := d.bot.AdminRepo.Delete(d.ctx, d.admin.PhoneNumber); err != nil {
+		t.Fatal(err)
+	}
+
+	reply = d.send(d.srv.Text(staff, "10B"))
+	if exists, _ := d.bot.ClassRepo.Exists(d.ctx, "10B"); exists {
+		t.Error("a removed admin created a class")
+	}
+	if want := i18n.Get(i18n.ErrAccessDenied, i18n.LanguageUzbek); reply.Text != want {
+		t.Errorf("reply = %q, want %q", reply.Text, want)
+	}
+	if current, _ := d.bot.StateManager.GetState(d.ctx, staff.ID); current == models.StateAwaitingClassName {
+		t.Error("flow still active after the denial")
+	}
+
+	denials, err := d.bot.AuditService.List(d.ctx, &models.AuditFilter{
+		EntityType:      models.AuditEntityAccess,
+		ActorTelegramID: &staff.ID,
+		Limit:           10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(denials) != 1 || denials[0].EntityID != "state:"+models.StateAwaitingClassName {
+		t.Errorf("denials = %+v, want the class name step", denials)
+	}
+}
+
+func TestAttendanceDialogue(t *testing.T) {
+	d := newDialogue(t)
+	d.register()
+
+	_, err := d.bot.StudentService.CreateStudent(d.ctx, &models.CreateStudentRequest{
+		FirstName:      "Bobur",
+		LastName:       "Toshmatov",
+		ClassID:        d.class.ID,
+		AddedByAdminID: &d.admin.ID,
+	})
+	if err != nil {
+		t.Fatalf("create student: %v", err)
+	}
+	_, err = d.bot.TeacherService.CreateTeacher(d.ctx, &models.CreateTeacherRequest{
+		PhoneNumber:    teacherPhone,
+		FirstName:      "Malika",
+		LastName:       "Yusupova",
+		Language:       string(i18n.LanguageUzbek),
+		AddedByAdminID: d.admin.ID,
+		ClassIDs:       []int{d.class.ID},
+	})
+	if err != nil {
+		t.Fatalf("create teacher: %v", err)
+	}
+	if err := d.bot.TeacherService.LinkTelegramID(d.ctx, teacherPhone, teacher.ID, string(i18n.LanguageUzbek)); err != nil {
+		t.Fatalf("link teacher: %v", err)
+	}
+
+	reply := d.send(d.srv.Text(teacher, i18n.Get(i18n.BtnMarkAttendance, i18n.LanguageUzbek)))
+	reply = d.press(teacher, reply, "9A")
+	reply = d.press(teacher, reply, "➖ 1. Ali Karimov")
+	reply = d.press(teacher, reply, "✅ Tugatish / Завершить")
+	if !strings.Contains(reply.Text, "Yo'qlama saqlandi") {
+		t.Errorf("after finishing: got %q", reply.Text)
+	}
+
+	today := time.Now().In(d.bot.Location).Format("2006-01-02")
+	records, err := d.bot.AttendanceService.GetAttendanceByClassIDAndDate(d.ctx, d.class.ID, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]string{}
+	for _, r := range records {
+		statuses[r.FirstName] = r.Status
+	}
+	if len(records) != 2 || statuses["Ali"] != "absent" || statuses["Bobur"] != "present" {
+		t.Errorf("attendance = %v, want Ali absent and Bobur present", statuses)
+	}
+
+	notifications, err := d.bot.NotificationRepo.List(d.ctx, &models.NotificationFilter{
+		ChatID: &parent.ID,
+		Kind:   models.NotificationAbsence,
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 || !strings.Contains(notifications[0].Text, "Ali Karimov") {
+		t.Fatalf("absence notifications = %+v, want one about Ali", notifications)
+	}
+	if notifications[0].Status != models.NotificationPending {
+		t.Errorf("absence notification status = %q, want %q", notifications[0].Status, models.NotificationPending)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/models"
+	"parent-bot/internal/scheduler"
+	"parent-bot/internal/services"
+)
+
+// HandleJobsCommand handles /jobs - lists background jobs with their last run
+func HandleJobsCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	return sendJobList(ctx, botService, message.Chat.ID)
+}
+
+// HandleAdminJobsCallback handles the background jobs button in the admin panel
+func HandleAdminJobsCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
+	return sendJobList(ctx, botService, callback.Message.Chat.ID)
+}
+
+// HandleRunJobCommand handles /run_job <name> - runs a background job now
+func HandleRunJobCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	name := strings.TrimSpace(message.CommandArguments())
+	if name == "" {
+		text := "❌ Format: /run_job &lt;nom / название&gt;\n\nRo'yxat / Список: /jobs"
+		return botService.TelegramService.SendMessage(message.Chat.ID, text, nil)
+	}
+
+	text := triggerJob(botService, message.From.ID, name)
+	return botService.TelegramService.SendMessage(message.Chat.ID, text, nil)
+}
+
+// HandleJobRunCallback handles the run button next to a job
+func HandleJobRunCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, name string) error {
+	text := triggerJob(botService, callback.From.ID, name)
+	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
+	return botService.TelegramService.SendMessage(callback.Message.Chat.ID, text, nil)
+}
+
+// triggerJob starts a job and returns the reply for the admin
+func triggerJob(botService *services.BotService, telegramID int64, name string) string {
+	err := botService.Scheduler.Trigger(name)
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		return fmt.Sprintf("❌ Vazifa topilmadi / Задача не найдена: %s", html.EscapeString(name))
+	case errors.Is(err, scheduler.ErrJobRunning):
+		return fmt.Sprintf("⏳ %s allaqachon bajarilmoqda / уже выполняется", html.EscapeString(name))
+	case err != nil:
+		return "❌ Xatolik / Ошибка: " + html.EscapeString(err.Error())
+	}
+
+	botService.Log(telegramID).Info("job triggered by admin", "job", name)
+
+	text := fmt.Sprintf("▶️ <b>%s</b> ishga tushirildi / запущена\n\n", html.EscapeString(name))
+	text += "Natija / Результат: /jobs"
+	return text
+}
+
+// sendJobList sends registered jobs with a run button for each
+func sendJobList(ctx context.Context, botService *services.BotService, chatID int64) error {
+	jobs, err := botService.Scheduler.Jobs(ctx)
+	if err != nil {
+		text := "❌ Xatolik / Ошибка: " + html.EscapeString(err.Error())
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	if len(jobs) == 0 {
+		text := "⏱ Fon vazifalari yo'q / Фоновых задач нет"
+		return botService.TelegramService.SendMessage(chatID, text, nil)
+	}
+
+	location := botService.Scheduler.Location()
+	text := fmt.Sprintf("⏱ <b>Fon vazifalari / Фоновые задачи</b> (%s)\n\n", location)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, job := range jobs {
+		text += fmt.Sprintf("%s <b>%s</b> — <code>%s</code>\n", jobStatusIcon(job), job.Name, html.EscapeString(job.Schedule))
+		text += fmt.Sprintf("   %s\n", job.Description)
+
+		if h := job.History; h != nil && h.LastStartedAt != nil {
+			text += fmt.Sprintf("   🕐 %s", h.LastStartedAt.In(location).Format("02.01.2006 15:04"))
+			if h.LastStatus != models.JobStatusRunning {
+				text += fmt.Sprintf(" (%s)", h.LastDuration().Round(time.Millisecond))
+			}
+			text += fmt.Sprintf(" | ▶️ %d | ❌ %d\n", h.RunCount, h.FailureCount)
+			if h.LastError != "" {
+				text += fmt.Sprintf("   ⚠️ %s\n", html.EscapeString(h.LastError))
+			}
+		}
+
+		text += fmt.Sprintf("   ⏭ %s\n\n", job.NextRun.In(location).Format("02.01.2006 15:04"))
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶️ "+job.Name, "job_run_"+job.Name),
+		))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return botService.TelegramService.SendMessage(chatID, text, keyboard)
+}
+
+// jobStatusIcon summarizes a job's current or last run
+func jobStatusIcon(job scheduler.Info) string {
+	switch {
+	case job.Running:
+		return "⏳"
+	case job.History == nil || job.History.LastStatus == "":
+		return "⚪️"
+	case job.History.LastStatus == models.JobStatusFailed:
+		return "❌"
+	case job.History.LastStatus == models.JobStatusRunning:
+		// Recorded as running but not running now: interrupted by a restart
+		return "⚠️"
+	default:
+		return "✅"
+	}
+}
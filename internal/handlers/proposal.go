@@ -1,24 +1,26 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"log"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
+	"parent-bot/internal/state"
 	"parent-bot/internal/utils"
 	"parent-bot/internal/validator"
 )
 
 // HandleProposalCommand initiates proposal submission
-func HandleProposalCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleProposalCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Check if user is registered
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -32,7 +34,7 @@ func HandleProposalCommand(botService *services.BotService, message *tgbotapi.Me
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get parent's children
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		return err
 	}
@@ -44,11 +46,11 @@ func HandleProposalCommand(botService *services.BotService, message *tgbotapi.Me
 
 	// If only one child, use that child automatically
 	if len(children) == 1 {
-		stateData := &models.StateData{
+		stateData := &models.ProposalData{
 			Language:          user.Language,
 			SelectedStudentID: &children[0].StudentID,
 		}
-		err = botService.StateManager.Set(telegramID, models.StateAwaitingProposal, stateData)
+		err = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingProposal, stateData)
 		if err != nil {
 			return err
 		}
@@ -73,10 +75,10 @@ func HandleProposalCommand(botService *services.BotService, message *tgbotapi.Me
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
 
 	// Set state to selecting child for proposal
-	stateData := &models.StateData{
+	stateData := &models.ProposalData{
 		Language: user.Language,
 	}
-	err = botService.StateManager.Set(telegramID, "selecting_child_for_proposal", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateSelectingChildForProposal, stateData)
 	if err != nil {
 		return err
 	}
@@ -84,26 +86,18 @@ func HandleProposalCommand(botService *services.BotService, message *tgbotapi.Me
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleProposalText handles proposal text input
-func HandleProposalText(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleProposalText(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.ProposalData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(stateData.Language)
 
-	// Get user to check admin status for keyboard
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	var isAdmin bool
-	if user != nil {
-		isAdmin, _ = botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-	}
+	// Staff keep their admin panel button
+	hasAdminPanel := authz.CallerFrom(ctx).HasAdminPanel()
 
 	// Check if message contains media instead of text
 	if message.Text == "" {
@@ -125,7 +119,7 @@ func HandleProposalText(botService *services.BotService, message *tgbotapi.Messa
 		}
 
 		// Keep the main menu keyboard visible
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, errorMsg, &keyboard)
 	}
 
@@ -134,13 +128,13 @@ func HandleProposalText(botService *services.BotService, message *tgbotapi.Messa
 	if err != nil {
 		text := i18n.Get(i18n.ErrInvalidProposal, lang) + "\n\n" + err.Error()
 		// Keep the main menu keyboard visible on validation errors too
-		keyboard := utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard := utils.MakeMainMenuKeyboardForUser(lang, hasAdminPanel)
 		return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 	}
 
 	// Save proposal text in state
 	stateData.ProposalText = proposalText
-	err = botService.StateManager.Set(telegramID, models.StateConfirmingProposal, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateConfirmingProposal, stateData)
 	if err != nil {
 		return err
 	}
@@ -153,12 +147,12 @@ func HandleProposalText(botService *services.BotService, message *tgbotapi.Messa
 }
 
 // HandleProposalConfirmation handles proposal confirmation
-func HandleProposalConfirmation(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleProposalConfirmation(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -170,7 +164,7 @@ func HandleProposalConfirmation(botService *services.BotService, callback *tgbot
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get proposal text from state
-	stateData, err := botService.StateManager.GetData(telegramID)
+	stateData, err := state.Load[models.ProposalData](ctx, botService.StateManager, telegramID)
 	if err != nil {
 		return err
 	}
@@ -185,9 +179,9 @@ func HandleProposalConfirmation(botService *services.BotService, callback *tgbot
 	// Get selected student from state data
 	var student *models.StudentWithClass
 	if stateData.SelectedStudentID != nil {
-		student, err = botService.StudentService.GetStudentByIDWithClass(*stateData.SelectedStudentID)
+		student, err = botService.StudentService.GetStudentByIDWithClass(ctx, *stateData.SelectedStudentID)
 		if err != nil || student == nil {
-			log.Printf("Failed to get student: %v", err)
+			botService.Log(telegramID).Error("failed to get student", "error", err)
 			text := "⚠️ Iltimos, avval farzandingizni tanlang / Пожалуйста, сначала выберите ребенка"
 			return botService.TelegramService.SendMessage(chatID, text, nil)
 		}
@@ -199,7 +193,7 @@ func HandleProposalConfirmation(botService *services.BotService, callback *tgbot
 	// Generate DOCX document
 	docPath, filename, err := botService.DocumentService.GenerateProposalDocument(user, student, stateData.ProposalText)
 	if err != nil {
-		log.Printf("Failed to generate document: %v", err)
+		botService.Log(telegramID).Error("failed to generate document", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -207,7 +201,7 @@ func HandleProposalConfirmation(botService *services.BotService, callback *tgbot
 	// Upload document to Telegram and get file_id
 	fileID, err := botService.TelegramService.UploadDocument(chatID, docPath, filename)
 	if err != nil {
-		log.Printf("Failed to upload document: %v", err)
+		botService.Log(telegramID).Error("failed to upload document", "error", err)
 		// Clean up temp file
 		_ = botService.DocumentService.DeleteTempFile(docPath)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
@@ -225,15 +219,15 @@ func HandleProposalConfirmation(botService *services.BotService, callback *tgbot
 		Filename:       filename,
 	}
 
-	proposal, err := botService.ProposalService.CreateProposal(proposalReq)
+	proposal, err := botService.ProposalService.CreateProposal(ctx, proposalReq)
 	if err != nil {
-		log.Printf("Failed to save proposal: %v", err)
+		botService.Log(telegramID).Error("failed to save proposal", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Send success message
 	text := i18n.Get(i18n.MsgProposalSubmitted, lang)
@@ -241,18 +235,18 @@ func HandleProposalConfirmation(botService *services.BotService, callback *tgbot
 	_ = botService.TelegramService.SendMessage(chatID, text, keyboard)
 
 	// Notify admins with DOCX document
-	go notifyAdminsWithProposalDocument(botService, user, proposal, fileID)
+	notifyAdminsWithProposalDocument(ctx, botService, user, proposal, fileID)
 
 	return nil
 }
 
 // HandleProposalCancellation handles proposal cancellation
-func HandleProposalCancellation(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleProposalCancellation(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -264,7 +258,7 @@ func HandleProposalCancellation(botService *services.BotService, callback *tgbot
 	lang := i18n.GetLanguage(user.Language)
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Answer callback query
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, i18n.Get(i18n.MsgProposalCancelled, lang))
@@ -276,17 +270,17 @@ func HandleProposalCancellation(botService *services.BotService, callback *tgbot
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
-// notifyAdminsWithProposalDocument sends proposal as DOCX document to all admins
-func notifyAdminsWithProposalDocument(botService *services.BotService, user *models.User, proposal *models.Proposal, fileID string) {
-	// Get admin telegram IDs
-	adminIDs, err := botService.GetAdminTelegramIDs()
+// notifyAdminsWithProposalDocument queues the proposal DOCX document for the admins who may see proposals
+func notifyAdminsWithProposalDocument(ctx context.Context, botService *services.BotService, user *models.User, proposal *models.Proposal, fileID string) {
+	// Get the telegram IDs of admins who may see complaints and proposals
+	adminIDs, err := botService.GetAdminTelegramIDs(ctx, models.PermComplaintsView)
 	if err != nil {
-		log.Printf("Failed to get admin IDs: %v", err)
+		botService.Log(user.TelegramID).Error("failed to get admin IDs", "proposal_id", proposal.ID, "error", err)
 		return
 	}
 
 	if len(adminIDs) == 0 {
-		log.Println("No admins configured")
+		botService.Log(user.TelegramID).Warn("no admins to notify", "proposal_id", proposal.ID)
 		return
 	}
 
@@ -310,22 +304,32 @@ func notifyAdminsWithProposalDocument(botService *services.BotService, user *mod
 		utils.FormatDateTime(proposal.CreatedAt),
 	)
 
-	// Send document to all admins
-	err = botService.TelegramService.SendDocumentToAdmins(adminIDs, fileID, caption)
-	if err != nil {
-		log.Printf("Failed to send document to admins: %v", err)
+	// Queue the document for all admins
+	notifications := make([]*models.Notification, 0, len(adminIDs))
+	for _, adminID := range adminIDs {
+		notifications = append(notifications, &models.Notification{
+			ChatID:    adminID,
+			Kind:      models.NotificationProposal,
+			Text:      caption,
+			FileID:    fileID,
+			MediaType: models.MediaDocument,
+		})
+	}
+
+	if err := botService.Outbox.Enqueue(ctx, notifications...); err != nil {
+		botService.Log(user.TelegramID).Error("failed to queue document for admins", "proposal_id", proposal.ID, "error", err)
 	}
 }
 
 // HandleMyProposalsCommand shows user's proposal history
-func HandleMyProposalsCommand(botService *services.BotService, message *tgbotapi.Message) error {
-	return handleProposalsPage(botService, message.From.ID, message.Chat.ID, 0)
+func HandleMyProposalsCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	return handleProposalsPage(ctx, botService, message.From.ID, message.Chat.ID, 0)
 }
 
 // handleProposalsPage shows proposals with pagination
-func handleProposalsPage(botService *services.BotService, telegramID int64, chatID int64, offset int) error {
+func handleProposalsPage(ctx context.Context, botService *services.BotService, telegramID int64, chatID int64, offset int) error {
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -340,7 +344,7 @@ func handleProposalsPage(botService *services.BotService, telegramID int64, chat
 
 	// Get user proposals with pagination (10 per page)
 	const pageSize = 10
-	proposals, err := botService.ProposalService.GetUserProposals(user.ID, pageSize, offset)
+	proposals, err := botService.ProposalService.GetUserProposals(ctx, user.ID, pageSize, offset)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -403,7 +407,7 @@ func handleProposalsPage(botService *services.BotService, telegramID int64, chat
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ReplyMarkup = keyboard
-		_, err = botService.Bot.Send(msg)
+		_, err = botService.TelegramService.Send(msg)
 		return err
 	}
 
@@ -411,24 +415,23 @@ func handleProposalsPage(botService *services.BotService, telegramID int64, chat
 }
 
 // HandleProposalsPageCallback handles pagination for proposals
-func HandleProposalsPageCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, offset int) error {
+func HandleProposalsPageCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, offset int) error {
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Delete old message
-	deleteMsg := tgbotapi.NewDeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID)
 
 	// Show new page
-	return handleProposalsPage(botService, callback.From.ID, callback.Message.Chat.ID, offset)
+	return handleProposalsPage(ctx, botService, callback.From.ID, callback.Message.Chat.ID, offset)
 }
 
 // HandleProposalSelectChildCallback handles child selection for proposal
-func HandleProposalSelectChildCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
+func HandleProposalSelectChildCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
 		return nil
@@ -437,7 +440,7 @@ func HandleProposalSelectChildCallback(botService *services.BotService, callback
 	lang := i18n.GetLanguage(user.Language)
 
 	// Verify student belongs to parent
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
 		return nil
@@ -458,11 +461,11 @@ func HandleProposalSelectChildCallback(botService *services.BotService, callback
 	}
 
 	// Set state with selected student
-	stateData := &models.StateData{
+	stateData := &models.ProposalData{
 		Language:          user.Language,
 		SelectedStudentID: &studentID,
 	}
-	err = botService.StateManager.Set(telegramID, models.StateAwaitingProposal, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingProposal, stateData)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
 		return nil
@@ -472,8 +475,7 @@ func HandleProposalSelectChildCallback(botService *services.BotService, callback
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "✅")
 
 	// Delete the selection message
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	// Send request for proposal text
 	text := i18n.Get(i18n.MsgRequestProposal, lang)
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log/slog"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
+	"parent-bot/internal/i18n"
+	"parent-bot/internal/models"
+	"parent-bot/internal/ratelimit"
+	"parent-bot/internal/services"
+)
+
+// allowUpdate applies the per-user rate limit to an update before anything
+// is looked up for it, using the role the sender had on their last update.
+// Throttled users get a localized "slow down" reply once per burst.
+func allowUpdate(botService *services.BotService, logger *slog.Logger, update tgbotapi.Update) bool {
+	from := update.SentFrom()
+	if from == nil || from.IsBot {
+		return true
+	}
+
+	role := botService.RateLimiter.Role(from.ID)
+
+	allowed, notify := botService.RateLimiter.Allow(from.ID, role)
+	if allowed {
+		return true
+	}
+
+	logger.Info("rate limited", "limit_role", role)
+
+	text := i18n.Get(i18n.ErrRateLimited, i18n.GetLanguage(from.LanguageCode))
+
+	// Callback buttons must always be answered to stop the loading spinner
+	if update.CallbackQuery != nil {
+		_ = botService.TelegramService.AnswerCallbackQuery(update.CallbackQuery.ID, text)
+		return false
+	}
+
+	if notify {
+		if chat := update.FromChat(); chat != nil {
+			_ = botService.TelegramService.SendMessage(chat.ID, text, nil)
+		}
+	}
+
+	return false
+}
+
+// rateLimitRole picks the limiter role for a caller. Only admins and
+// super-admins get the admin limit; other staff are limited like teachers.
+func rateLimitRole(caller *authz.Caller) string {
+	if caller.Admin != nil {
+		switch caller.Admin.Role {
+		case models.RoleSuperAdmin, models.RoleAdmin:
+			return ratelimit.RoleAdmin
+		}
+		return ratelimit.RoleTeacher
+	}
+
+	if caller.Teacher != nil {
+		return ratelimit.RoleTeacher
+	}
+
+	return ratelimit.RoleParent
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
@@ -12,7 +14,7 @@ import (
 )
 
 // HandleLanguageSelection handles language selection callback
-func HandleLanguageSelection(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleLanguageSelection(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
@@ -27,8 +29,8 @@ func HandleLanguageSelection(botService *services.BotService, callback *tgbotapi
 	}
 
 	// Save language in state
-	data := &models.StateData{Language: string(lang)}
-	err := botService.StateManager.Set(telegramID, models.StateAwaitingPhone, data)
+	data := &models.RegistrationData{Language: string(lang)}
+	err := botService.StateManager.Set(ctx, telegramID, models.StateAwaitingPhone, data)
 	if err != nil {
 		return err
 	}
@@ -45,18 +47,26 @@ func HandleLanguageSelection(botService *services.BotService, callback *tgbotapi
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
+// ownPhoneNumber returns the phone number of a contact the sender shared of
+// themselves. Typed numbers and other people's contacts are not accepted.
+func ownPhoneNumber(message *tgbotapi.Message) (string, bool) {
+	if message.Contact == nil || message.Contact.UserID != message.From.ID {
+		return "", false
+	}
+	return message.Contact.PhoneNumber, true
+}
+
 // HandlePhoneNumber handles phone number input and proceeds to class selection
-func HandlePhoneNumber(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandlePhoneNumber(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.RegistrationData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(stateData.Language)
 
-	// Extract phone number
-	var phoneNumber string
-	if message.Contact != nil {
-		phoneNumber = message.Contact.PhoneNumber
-	} else {
-		phoneNumber = message.Text
+	// The phone number identifies staff, so only the sender's own contact counts
+	phoneNumber, ok := ownPhoneNumber(message)
+	if !ok {
+		text := i18n.Get(i18n.ErrOwnPhoneOnly, lang)
+		return botService.TelegramService.SendMessage(chatID, text, utils.MakePhoneKeyboard(lang))
 	}
 
 	// Validate phone number
@@ -67,7 +77,7 @@ func HandlePhoneNumber(botService *services.BotService, message *tgbotapi.Messag
 	}
 
 	// Check if phone number already registered
-	existingUser, _ := botService.UserService.GetUserByPhoneNumber(validPhone)
+	existingUser, _ := botService.UserService.GetUserByPhoneNumber(ctx, validPhone)
 	if existingUser != nil {
 		text := i18n.Get(i18n.ErrAlreadyRegistered, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -81,20 +91,26 @@ func HandlePhoneNumber(botService *services.BotService, message *tgbotapi.Messag
 		Language:         stateData.Language,
 	}
 
-	user, err := botService.UserService.CreateUser(userReq)
+	user, err := botService.UserService.CreateUser(ctx, userReq)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Link admin telegram ID if this user is an admin
-	_ = botService.AdminRepo.UpdateTelegramID(user.PhoneNumber, user.TelegramID)
+	_ = botService.RoleService.LinkTelegramID(ctx, user.PhoneNumber, user.TelegramID)
+
+	// The caller was resolved before they had a phone number, so staff are
+	// only recognised now
+	caller, err := botService.Policy.Resolve(ctx, telegramID)
+	if err != nil {
+		return err
+	}
 
-	// Check if user is admin - if so, skip child selection
-	isAdmin, _ := botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-	if isAdmin {
+	// Check if user is staff - if so, skip child selection
+	if caller.HasAdminPanel() {
 		// Admin doesn't need to select child
-		err = botService.StateManager.Clear(telegramID)
+		err = botService.StateManager.Clear(ctx, telegramID)
 		if err != nil {
 			return err
 		}
@@ -113,30 +129,34 @@ func HandlePhoneNumber(botService *services.BotService, message *tgbotapi.Messag
 	}
 
 	// Check if user is teacher
-	teacher, _ := botService.TeacherService.GetTeacherByPhoneNumber(validPhone)
+	teacher, _ := botService.TeacherService.GetTeacherByPhoneNumber(ctx, validPhone)
 	if teacher != nil {
 		// Teacher doesn't need to select child
-		err = botService.StateManager.Clear(telegramID)
+		err = botService.StateManager.Clear(ctx, telegramID)
 		if err != nil {
 			return err
 		}
 
 		// Update teacher telegram ID
-		_ = botService.TeacherService.LinkTelegramID(validPhone, telegramID, stateData.Language)
+		_ = botService.TeacherService.LinkTelegramID(ctx, validPhone, telegramID, stateData.Language)
+
+		// The caller was resolved before they were linked as a teacher
+		perms := authz.CallerFrom(ctx).Permissions
+		if caller, err := botService.Policy.Resolve(ctx, telegramID); err == nil {
+			perms = caller.Permissions
+		}
 
 		text := i18n.Get(i18n.MsgTeacherRegistered, lang)
-		keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+		keyboard := utils.MakeTeacherMainMenuKeyboard(lang, perms)
 		return botService.TelegramService.SendMessage(chatID, text, keyboard)
 	}
 
 	// Parent flow - proceed to class selection for first child
-	stateData.PhoneNumber = validPhone
-
 	// Get active classes
-	classes, err := botService.ClassRepo.GetActive()
+	classes, err := botService.ClassRepo.GetActive(ctx)
 	if err != nil || len(classes) == 0 {
 		// No classes yet, complete registration without child
-		err = botService.StateManager.Clear(telegramID)
+		err = botService.StateManager.Clear(ctx, telegramID)
 		if err != nil {
 			return err
 		}
@@ -155,7 +175,7 @@ func HandlePhoneNumber(botService *services.BotService, message *tgbotapi.Messag
 	}
 
 	// Set state to selecting class
-	err = botService.StateManager.Set(telegramID, models.StateSelectingClass, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateSelectingClass, nil)
 	if err != nil {
 		return err
 	}
@@ -174,26 +194,23 @@ func HandlePhoneNumber(botService *services.BotService, message *tgbotapi.Messag
 
 // HandleChildName - DEPRECATED: No longer used in new architecture
 // Students are now managed separately and linked to parents by admin/teachers
-func HandleChildName(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleChildName(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Redirect to registration completion
 	text := "Registration flow has been updated. Please use /start to begin registration."
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 	return botService.TelegramService.SendMessage(chatID, text, nil)
 }
 
 // HandleClassSelection handles class selection from inline keyboard
-func HandleClassSelection(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleClassSelection(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, className string) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Extract class name from callback data
-	className := callback.Data[6:] // Remove "class_" prefix
-
 	// Verify class exists and is active
-	exists, err := botService.ClassRepo.Exists(className)
+	exists, err := botService.ClassRepo.Exists(ctx, className)
 	if err != nil {
 		return err
 	}
@@ -209,18 +226,18 @@ func HandleClassSelection(botService *services.BotService, callback *tgbotapi.Ca
 
 	// Redirect to new registration flow
 	text := "Registration flow has been updated. Please use /start to begin registration."
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 	return botService.TelegramService.SendMessage(chatID, text, nil)
 }
 
 // HandleChildClass - DEPRECATED: No longer used in new architecture
 // This is kept for backward compatibility but now we prefer inline buttons
-func HandleChildClass(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleChildClass(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Redirect to new registration flow
 	text := "Registration flow has been updated. Please use /start to begin registration."
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 	return botService.TelegramService.SendMessage(chatID, text, nil)
 }
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/models"
+	"parent-bot/internal/services"
+)
+
+// roleLabels name roles in both languages
+var roleLabels = map[string]string{
+	models.RoleSuperAdmin:     "👑 Bosh admin / Главный админ",
+	models.RoleAdmin:          "🛡 Admin / Админ",
+	models.RoleDeputyDirector: "🎓 Direktor o'rinbosari / Завуч",
+	models.RoleInspector:      "🔍 Nazoratchi / Инспектор",
+	models.RoleClassTeacher:   "👨‍🏫 Sinf rahbari / Классный руководитель",
+	models.RoleSubjectTeacher: "📚 Fan o'qituvchisi / Учитель-предметник",
+}
+
+// permissionLabels name permissions in both languages
+var permissionLabels = map[models.Permission]string{
+	models.PermClassesManage:          "Sinflar / Классы",
+	models.PermStudentsManage:         "O'quvchilar / Ученики",
+	models.PermTeachersManage:         "O'qituvchilar / Учителя",
+	models.PermTimetablesManage:       "Jadvallar / Расписания",
+	models.PermAnnouncementsManage:    "E'lonlar / Объявления",
+	models.PermComplaintsView:         "Shikoyat va takliflar / Жалобы и предложения",
+	models.PermUsersView:              "Foydalanuvchilar / Пользователи",
+	models.PermStatsView:              "Statistika / Статистика",
+	models.PermAttendanceView:         "Davomatni ko'rish / Просмотр посещаемости",
+	models.PermGradesView:             "Baholarni ko'rish / Просмотр оценок",
+	models.PermReportsExport:          "Hisobotlar eksporti / Экспорт отчётов",
+	models.PermJobsManage:             "Fon vazifalari / Фоновые задачи",
+	models.PermAuditView:              "Audit jurnali / Журнал аудита",
+	models.PermAPITokensManage:        "API tokenlar / API токены",
+	models.PermRolesManage:            "Rollar / Роли",
+	models.PermAttendanceMark:         "Davomat belgilash / Отметка посещаемости",
+	models.PermGradesEdit:             "Baho qo'yish / Выставление оценок",
+	models.PermClassStudentsManage:    "Sinf o'quvchilari / Ученики класса",
+	models.PermClassAnnouncementsPost: "Sinfga e'lon / Объявления классу",
+}
+
+// setRoleUsage explains /set_role and /revoke_role
+var setRoleUsage = "❌ Format: /set_role &lt;telefon / телефон&gt; &lt;rol / роль&gt; [ism / имя]\n" +
+	"/revoke_role &lt;telefon / телефон&gt;\n\n" +
+	"Rollar / Роли: <code>" + strings.Join(models.Roles, "</code>, <code>") + "</code>\n\n" +
+	"Misol / Пример: <code>/set_role +998901234567 inspector Karimova</code>"
+
+// HandleRolesCommand handles /roles - the roles and who has them
+func HandleRolesCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	text, keyboard, err := renderRoles(ctx, botService)
+	if err != nil {
+		return err
+	}
+	return botService.TelegramService.SendMessage(message.Chat.ID, text, keyboard)
+}
+
+// HandleAdminRolesCallback handles the roles button in the admin panel
+func HandleAdminRolesCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
+
+	text, keyboard, err := renderRoles(ctx, botService)
+	if err != nil {
+		return err
+	}
+	return botService.TelegramService.EditMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, &keyboard)
+}
+
+// HandleRoleViewCallback shows a role's members and permissions
+func HandleRoleViewCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, role string) error {
+	if !slices.Contains(models.Roles, role) {
+		return botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌")
+	}
+	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
+
+	text, keyboard, err := renderRole(ctx, botService, role)
+	if err != nil {
+		return err
+	}
+	return botService.TelegramService.EditMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, &keyboard)
+}
+
+// HandleRolePermissionCallback grants or revokes the index-th of
+// models.Permissions for a role and shows the role again
+func HandleRolePermissionCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, role string, index int) error {
+	if !slices.Contains(models.Roles, role) || role == models.RoleSuperAdmin || index < 0 || index >= len(models.Permissions) {
+		return botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌")
+	}
+	permission := models.Permissions[index]
+
+	granted, err := botService.RoleService.Permissions(ctx, role)
+	if err != nil {
+		return err
+	}
+	if err := botService.RoleService.SetPermission(ctx, role, permission, !granted.Has(permission)); err != nil {
+		if errors.Is(err, services.ErrSuperAdminOnly) || errors.Is(err, services.ErrOwnRole) {
+			return botService.TelegramService.AnswerCallbackQuery(callback.ID, roleErrorText(err))
+		}
+		return err
+	}
+	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "✅")
+
+	botService.Log(callback.From.ID).Info("role permission changed", "role", role, "permission", permission, "granted", !granted.Has(permission))
+
+	text, keyboard, err := renderRole(ctx, botService, role)
+	if err != nil {
+		return err
+	}
+	return botService.TelegramService.EditMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, &keyboard)
+}
+
+// HandleSetRoleCommand handles /set_role <phone> <role> [name] - gives a
+// staff member or teacher a role
+func HandleSetRoleCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	chatID := message.Chat.ID
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) < 2 || !slices.Contains(models.Roles, args[1]) {
+		return botService.TelegramService.SendMessage(chatID, setRoleUsage, nil)
+	}
+	phone, role, name := args[0], args[1], strings.Join(args[2:], " ")
+
+	if err := botService.RoleService.AssignRole(ctx, phone, role, name); err != nil {
+		return botService.TelegramService.SendMessage(chatID, roleErrorText(err), nil)
+	}
+
+	text := fmt.Sprintf("✅ %s: %s", html.EscapeString(phone), roleLabels[role])
+	return botService.TelegramService.SendMessage(chatID, text, nil)
+}
+
+// HandleRevokeRoleCommand handles /revoke_role <phone> - takes away a staff
+// member's role and with it their access to the admin panel
+func HandleRevokeRoleCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
+	chatID := message.Chat.ID
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 1 {
+		return botService.TelegramService.SendMessage(chatID, setRoleUsage, nil)
+	}
+
+	if err := botService.RoleService.RevokeStaff(ctx, args[0]); err != nil {
+		return botService.TelegramService.SendMessage(chatID, roleErrorText(err), nil)
+	}
+
+	text := fmt.Sprintf("✅ %s: roli olib tashlandi / роль снята", html.EscapeString(args[0]))
+	return botService.TelegramService.SendMessage(chatID, text, nil)
+}
+
+// roleErrorText explains why a role change was refused
+func roleErrorText(err error) string {
+	switch {
+	case errors.Is(err, services.ErrConfigAdmin):
+		return "❌ Bu raqam ADMIN_PHONES ro'yxatida, uning roli konfiguratsiyada o'zgartiriladi.\n" +
+			"Этот номер в списке ADMIN_PHONES, его роль меняется в конфигурации."
+	case errors.Is(err, services.ErrSuperAdminOnly):
+		return "❌ Buni faqat bosh admin qila oladi / Это может только главный админ"
+	case errors.Is(err, services.ErrOwnRole):
+		return "❌ O'z rolingizni o'zgartira olmaysiz / Нельзя менять свою роль"
+	case errors.Is(err, services.ErrLastSuperAdmin):
+		return "❌ Oxirgi bosh adminni olib bo'lmaydi / Нельзя снять последнего главного админа"
+	case errors.Is(err, services.ErrNotFound):
+		return "❌ Topilmadi / Не найдено: " + html.EscapeString(err.Error())
+	case errors.Is(err, services.ErrUnknownRole):
+		return setRoleUsage
+	default:
+		return "❌ Xatolik / Ошибка: " + html.EscapeString(err.Error())
+	}
+}
+
+// renderRoles builds the list of roles with how many people have each
+func renderRoles(ctx context.Context, botService *services.BotService) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	text := "🔐 <b>Rollar va huquqlar / Роли и права</b>\n\n"
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, role := range models.Roles {
+		count, err := roleMemberCount(ctx, botService, role)
+		if err != nil {
+			return "", tgbotapi.InlineKeyboardMarkup{}, err
+		}
+
+		text += fmt.Sprintf("%s — %d\n", roleLabels[role], count)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(roleLabels[role], "role_view_"+role),
+		))
+	}
+
+	text += "\nRol berish / Назначить роль: /set_role\n"
+	text += "Rolni olish / Снять роль: /revoke_role"
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("◀️ Orqaga / Назад", "admin_back"),
+	))
+
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
+
+// roleMemberCount counts the staff or teachers with a role
+func roleMemberCount(ctx context.Context, botService *services.BotService, role string) (int, error) {
+	if slices.Contains(models.TeacherRoles, role) {
+		teachers, err := botService.RoleService.Teachers(ctx, role)
+		return len(teachers), err
+	}
+	staff, err := botService.RoleService.Staff(ctx, role)
+	return len(staff), err
+}
+
+// renderRole builds a role's members and a toggle for each permission.
+// Super-admins have every permission, so theirs are not toggles.
+func renderRole(ctx context.Context, botService *services.BotService, role string) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	text := fmt.Sprintf("%s (<code>%s</code>)\n\n", roleLabels[role], role)
+
+	var members []string
+	if slices.Contains(models.TeacherRoles, role) {
+		teachers, err := botService.RoleService.Teachers(ctx, role)
+		if err != nil {
+			return "", tgbotapi.InlineKeyboardMarkup{}, err
+		}
+		for _, t := range teachers {
+			member := html.EscapeString(t.LastName+" "+t.FirstName) + " · " + t.PhoneNumber
+			if !t.IsActive {
+				member += " 🚫"
+			}
+			members = append(members, member)
+		}
+	} else {
+		staff, err := botService.RoleService.Staff(ctx, role)
+		if err != nil {
+			return "", tgbotapi.InlineKeyboardMarkup{}, err
+		}
+		for _, a := range staff {
+			members = append(members, html.EscapeString(a.Name)+" · "+a.PhoneNumber)
+		}
+	}
+
+	if len(members) == 0 {
+		text += "Hech kim yo'q / Никого нет\n"
+	} else {
+		text += "👥 " + strings.Join(members, "\n👥 ") + "\n"
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if role == models.RoleSuperAdmin {
+		text += "\n✅ Barcha huquqlar, o'zgarmaydi / Все права, не меняются"
+	} else {
+		granted, err := botService.RoleService.Permissions(ctx, role)
+		if err != nil {
+			return "", tgbotapi.InlineKeyboardMarkup{}, err
+		}
+
+		text += "\nHuquqni yoqish yoki o'chirish uchun bosing:\nНажмите, чтобы выдать или снять право:"
+		for i, permission := range models.Permissions {
+			mark := "▫️ "
+			if granted.Has(permission) {
+				mark = "✅ "
+			}
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(mark+permissionLabels[permission], fmt.Sprintf("role_perm_%s_%d", role, i)),
+			))
+		}
+	}
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("◀️ Orqaga / Назад", "admin_roles"),
+	))
+
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"context"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
@@ -9,12 +12,17 @@ import (
 )
 
 // HandleStart handles /start command
-func HandleStart(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleStart(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
+	// Someone who blocked the bot and came back gets notifications again
+	if err := botService.Outbox.MarkReachable(ctx, chatID); err != nil {
+		botService.Log(telegramID).Warn("failed to mark chat reachable", "error", err)
+	}
+
 	// FIRST: Check if this person is a teacher
-	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if teacher != nil {
 		// Teacher interface - show teacher menu
 		lang := i18n.GetLanguage(teacher.Language)
@@ -22,21 +30,14 @@ func HandleStart(botService *services.BotService, message *tgbotapi.Message) err
 		text += "Assalomu aleykum! / Здравствуйте!\n\n"
 		text += i18n.Get(i18n.MsgMainMenu, lang)
 
-		keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+		keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 		return botService.TelegramService.SendMessage(chatID, text, keyboard)
 	}
 
 	// SECOND: Check if this person is an admin
-	user, _ := botService.UserService.GetUserByTelegramID(telegramID)
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, _ := botService.IsAdmin(phoneNumber, telegramID)
-
+	user, _ := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	// ADMIN INTERFACE - No registration needed, but they can also register as parent if they want
-	if isAdmin {
+	if authz.CallerFrom(ctx).HasAdminPanel() {
 		lang := i18n.LanguageUzbek
 		if user != nil {
 			lang = i18n.GetLanguage(user.Language)
@@ -76,7 +77,7 @@ func HandleStart(botService *services.BotService, message *tgbotapi.Message) err
 	keyboard := utils.MakeLanguageKeyboard()
 
 	// Set initial state
-	err := botService.StateManager.Set(telegramID, models.StateAwaitingLanguage, &models.StateData{})
+	err := botService.StateManager.Set(ctx, telegramID, models.StateAwaitingLanguage, nil)
 	if err != nil {
 		return err
 	}
@@ -85,11 +86,11 @@ func HandleStart(botService *services.BotService, message *tgbotapi.Message) err
 }
 
 // HandleHelp handles /help command
-func HandleHelp(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleHelp(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 
 	// Get user language
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -125,15 +126,15 @@ func HandleHelp(botService *services.BotService, message *tgbotapi.Message) erro
 }
 
 // HandleCancelCommand handles /cancel command - clears any active state
-func HandleCancelCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleCancelCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Clear any active state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Check if this is a teacher
-	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if teacher != nil {
 		lang := i18n.GetLanguage(teacher.Language)
 		var text string
@@ -142,12 +143,12 @@ func HandleCancelCommand(botService *services.BotService, message *tgbotapi.Mess
 		} else {
 			text = "❌ Действие отменено."
 		}
-		keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+		keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 		return botService.TelegramService.SendMessage(chatID, text, keyboard)
 	}
 
 	// Get user (parent/admin)
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -169,8 +170,7 @@ func HandleCancelCommand(botService *services.BotService, message *tgbotapi.Mess
 	// Check if admin to show appropriate keyboard
 	var keyboard tgbotapi.ReplyKeyboardMarkup
 	if user != nil {
-		isAdmin, _ := botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-		keyboard = utils.MakeMainMenuKeyboardForUser(lang, isAdmin)
+		keyboard = utils.MakeMainMenuKeyboardForUser(lang, authz.CallerFrom(ctx).HasAdminPanel())
 	} else {
 		// No keyboard for unregistered users
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -178,3 +178,30 @@ func HandleCancelCommand(botService *services.BotService, message *tgbotapi.Mess
 
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
+
+// HandleExpiredFlow tells a user whose flow expired that it was cancelled and
+// returns them to the menu. The message that arrived is not processed: after
+// so long it is unlikely to be the answer the flow was waiting for.
+func HandleExpiredFlow(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, current *models.UserState, user *models.User) error {
+	telegramID := message.From.ID
+	chatID := message.Chat.ID
+
+	botService.Log(telegramID).Info("flow expired", "flow", current.Flow, "expired_state", current.State)
+	if err := botService.StateManager.Clear(ctx, telegramID); err != nil {
+		return err
+	}
+
+	if user == nil {
+		// Not registered yet: registration starts over
+		text := i18n.Get(i18n.ErrFlowExpired, i18n.LanguageUzbek)
+		if err := botService.TelegramService.SendMessage(chatID, text, nil); err != nil {
+			return err
+		}
+		return HandleStart(ctx, botService, message)
+	}
+
+	lang := i18n.GetLanguage(user.Language)
+	keyboard := utils.MakeMainMenuKeyboardForUser(lang, authz.CallerFrom(ctx).HasAdminPanel())
+
+	return botService.TelegramService.SendMessage(chatID, i18n.Get(i18n.ErrFlowExpired, lang), keyboard)
+}
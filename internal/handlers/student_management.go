@@ -1,24 +1,26 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/database"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
 )
 
 // HandleAddStudentCommand initiates adding a new student (admin only)
-func HandleAddStudentCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleAddStudentCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
-	// Check if user is admin
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	// Get user for language
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -28,18 +30,8 @@ func HandleAddStudentCommand(botService *services.BotService, message *tgbotapi.
 		lang = i18n.GetLanguage(user.Language)
 	}
 
-	isAdmin := false
-	if user != nil {
-		isAdmin, _ = botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat administratorlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	// Get active classes
-	classes, err := botService.ClassRepo.GetActive()
+	classes, err := botService.ClassRepo.GetActive(ctx)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -61,8 +53,7 @@ func HandleAddStudentCommand(botService *services.BotService, message *tgbotapi.
 		"5-A</code>"
 
 	// Set state
-	stateData := &models.StateData{}
-	err = botService.StateManager.Set(telegramID, "awaiting_student_info", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingStudentInfo, nil)
 	if err != nil {
 		return err
 	}
@@ -71,7 +62,7 @@ func HandleAddStudentCommand(botService *services.BotService, message *tgbotapi.
 }
 
 // HandleStudentInfo processes student information input from admin
-func HandleStudentInfo(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleStudentInfo(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -98,7 +89,7 @@ func HandleStudentInfo(botService *services.BotService, message *tgbotapi.Messag
 	lastName := strings.Join(nameParts[1:], " ")
 
 	// Verify class exists
-	class, err := botService.ClassRepo.GetByName(className)
+	class, err := botService.ClassRepo.GetByName(ctx, className)
 	if err != nil {
 		return err
 	}
@@ -110,12 +101,12 @@ func HandleStudentInfo(botService *services.BotService, message *tgbotapi.Messag
 	}
 
 	// Get admin info
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	admin, err := botService.AdminRepo.GetByTelegramID(telegramID)
+	admin, err := botService.AdminRepo.GetByTelegramID(ctx, telegramID)
 	if err != nil || admin == nil {
 		text := "❌ Admin ma'lumotlari topilmadi / Данные администратора не найдены"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -128,9 +119,9 @@ func HandleStudentInfo(botService *services.BotService, message *tgbotapi.Messag
 		ClassID:        class.ID,
 		AddedByAdminID: &admin.ID,
 	}
-	studentID, err := botService.StudentRepo.Create(studentReq)
+	studentID, err := botService.StudentService.CreateStudent(ctx, studentReq)
 	if err != nil {
-		log.Printf("Failed to create student: %v", err)
+		botService.Log(telegramID).Error("failed to create student", "error", err)
 		studentLang := i18n.LanguageUzbek
 		if user != nil {
 			studentLang = i18n.GetLanguage(user.Language)
@@ -140,7 +131,7 @@ func HandleStudentInfo(botService *services.BotService, message *tgbotapi.Messag
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Success message
 	text := fmt.Sprintf(
@@ -176,19 +167,19 @@ func HandleStudentInfo(botService *services.BotService, message *tgbotapi.Messag
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleAdminStudentNameInput handles student name input when admin adds student to a specific class
-func HandleAdminStudentNameInput(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleAdminStudentNameInput(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.StudentData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Check if classID is set
 	if stateData.ClassID == nil {
 		text := "❌ Xatolik: sinf ma'lumoti topilmadi / Ошибка: информация о классе не найдена"
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
@@ -208,18 +199,18 @@ func HandleAdminStudentNameInput(botService *services.BotService, message *tgbot
 	lastName := strings.Join(nameParts[1:], " ")
 
 	// Get class info
-	class, err := botService.ClassRepo.GetByID(classID)
+	class, err := botService.ClassRepo.GetByID(ctx, classID)
 	if err != nil || class == nil {
 		text := "❌ Sinf topilmadi / Класс не найден"
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get admin info
-	admin, err := botService.AdminRepo.GetByTelegramID(telegramID)
+	admin, err := botService.AdminRepo.GetByTelegramID(ctx, telegramID)
 	if err != nil || admin == nil {
 		text := "❌ Admin ma'lumotlari topilmadi / Данные администратора не найдены"
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
@@ -230,15 +221,15 @@ func HandleAdminStudentNameInput(botService *services.BotService, message *tgbot
 		ClassID:        classID,
 		AddedByAdminID: &admin.ID,
 	}
-	studentID, err := botService.StudentRepo.Create(studentReq)
+	studentID, err := botService.StudentService.CreateStudent(ctx, studentReq)
 	if err != nil {
-		log.Printf("Failed to create student: %v", err)
+		botService.Log(telegramID).Error("failed to create student", "error", err)
 		text := "❌ Xatolik / Ошибка: " + err.Error()
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Success message
 	text := fmt.Sprintf(
@@ -273,31 +264,15 @@ func HandleAdminStudentNameInput(botService *services.BotService, message *tgbot
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleLinkStudentCommand initiates linking a student to a parent (admin only)
-func HandleLinkStudentCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleLinkStudentCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
-	// Check if user is admin
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	isAdmin := false
-	if user != nil {
-		isAdmin, _ = botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat administratorlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	text := "🔗 <b>O'quvchini ota-onaga bog'lash / Привязать ученика к родителю</b>\n\n" +
 		"Iltimos, quyidagi formatda ma'lumotlarni yuboring:\n" +
 		"Пожалуйста, отправьте данные в следующем формате:\n\n" +
@@ -310,8 +285,7 @@ func HandleLinkStudentCommand(botService *services.BotService, message *tgbotapi
 		"Для получения ID ученика используйте команду /list_students"
 
 	// Set state
-	stateData := &models.StateData{}
-	err = botService.StateManager.Set(telegramID, "awaiting_link_info", stateData)
+	err := botService.StateManager.Set(ctx, telegramID, models.StateAwaitingLinkInfo, nil)
 	if err != nil {
 		return err
 	}
@@ -320,7 +294,7 @@ func HandleLinkStudentCommand(botService *services.BotService, message *tgbotapi
 }
 
 // HandleLinkInfo processes linking information input from admin
-func HandleLinkInfo(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleLinkInfo(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -350,9 +324,9 @@ func HandleLinkInfo(botService *services.BotService, message *tgbotapi.Message,
 	}
 
 	// Find parent by phone
-	parent, err := botService.UserRepo.GetByPhone(phoneNumber)
+	parent, err := botService.UserRepo.GetByPhone(ctx, phoneNumber)
 	if err != nil {
-		log.Printf("Error finding parent: %v", err)
+		botService.Log(telegramID).Error("failed to find parent", "error", err)
 		text := "❌ Xatolik yuz berdi / Произошла ошибка"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -364,16 +338,16 @@ func HandleLinkInfo(botService *services.BotService, message *tgbotapi.Message,
 	}
 
 	// Verify student exists
-	student, err := botService.StudentRepo.GetByID(studentID)
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil || student == nil {
 		text := fmt.Sprintf("❌ ID %d bo'lgan o'quvchi topilmadi / Ученик с ID %d не найден", studentID, studentID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Check if already linked
-	existingLinks, err := botService.StudentRepo.GetParentStudents(parent.ID)
+	existingLinks, err := botService.StudentRepo.GetParentStudents(ctx, parent.ID)
 	if err != nil {
-		log.Printf("Error checking existing links: %v", err)
+		botService.Log(telegramID).Error("failed to check existing links", "error", err)
 		text := "❌ Xatolik yuz berdi / Произошла ошибка"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -395,11 +369,11 @@ func HandleLinkInfo(botService *services.BotService, message *tgbotapi.Message,
 	}
 
 	// Create link
-	err = botService.StudentRepo.LinkToParent(parent.ID, studentID)
+	err = botService.StudentService.LinkToParent(ctx, parent.ID, studentID)
 	if err != nil {
-		log.Printf("Failed to link student to parent: %v", err)
+		botService.Log(telegramID).Error("failed to link student to parent", "error", err)
 		// Check if it's a UNIQUE constraint violation (student already linked to another parent)
-		if strings.Contains(err.Error(), "UNIQUE") {
+		if errors.Is(err, database.ErrDuplicate) {
 			text := "❌ Bu o'quvchi allaqachon boshqa ota-onaga bog'langan!\n" +
 				"Bir o'quvchi faqat BITTA ota-onaga tegishli bo'lishi mumkin.\n\n" +
 				"❌ Этот ученик уже привязан к другому родителю!\n" +
@@ -414,10 +388,10 @@ func HandleLinkInfo(botService *services.BotService, message *tgbotapi.Message,
 	// Multi-child system uses callback-based selection
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Get class info for display
-	class, _ := botService.ClassRepo.GetByID(student.ClassID)
+	class, _ := botService.ClassRepo.GetByID(ctx, student.ClassID)
 	className := "N/A"
 	if class != nil {
 		className = class.ClassName
@@ -456,28 +430,11 @@ func HandleLinkInfo(botService *services.BotService, message *tgbotapi.Message,
 }
 
 // HandleListStudentsCommand lists all students (admin only)
-func HandleListStudentsCommand(botService *services.BotService, message *tgbotapi.Message) error {
-	telegramID := message.From.ID
+func HandleListStudentsCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	chatID := message.Chat.ID
 
-	// Check if user is admin
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	isAdmin := false
-	if user != nil {
-		isAdmin, _ = botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat administratorlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	// Get all students
-	students, err := botService.StudentRepo.GetAll(100, 0)
+	students, err := botService.StudentRepo.GetAll(ctx, 100, 0)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -507,34 +464,17 @@ func HandleListStudentsCommand(botService *services.BotService, message *tgbotap
 }
 
 // HandleViewParentChildrenCommand shows parent's children links (admin only)
-func HandleViewParentChildrenCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleViewParentChildrenCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
-	// Check if user is admin
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	isAdmin := false
-	if user != nil {
-		isAdmin, _ = botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat administratorlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	text := "🔍 <b>Ota-ona farzandlarini ko'rish / Просмотр детей родителя</b>\n\n" +
 		"Iltimos, ota-onaning telefon raqamini yuboring:\n" +
 		"Пожалуйста, отправьте номер телефона родителя:\n\n" +
 		"Format: <code>+998XXXXXXXXX</code>"
 
 	// Set state
-	stateData := &models.StateData{}
-	err = botService.StateManager.Set(telegramID, "awaiting_parent_phone_for_view", stateData)
+	err := botService.StateManager.Set(ctx, telegramID, models.StateAwaitingParentPhoneForView, nil)
 	if err != nil {
 		return err
 	}
@@ -543,7 +483,7 @@ func HandleViewParentChildrenCommand(botService *services.BotService, message *t
 }
 
 // HandleParentPhoneForView processes parent phone to view their children
-func HandleParentPhoneForView(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleParentPhoneForView(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -557,9 +497,9 @@ func HandleParentPhoneForView(botService *services.BotService, message *tgbotapi
 	}
 
 	// Find parent
-	parent, err := botService.UserRepo.GetByPhone(phoneNumber)
+	parent, err := botService.UserRepo.GetByPhone(ctx, phoneNumber)
 	if err != nil {
-		log.Printf("Error finding parent: %v", err)
+		botService.Log(telegramID).Error("failed to find parent", "error", err)
 		text := "❌ Xatolik yuz berdi / Произошла ошибка"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -571,15 +511,15 @@ func HandleParentPhoneForView(botService *services.BotService, message *tgbotapi
 	}
 
 	// Get parent's children
-	children, err := botService.StudentRepo.GetParentStudents(parent.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, parent.ID)
 	if err != nil {
-		log.Printf("Error getting students: %v", err)
+		botService.Log(telegramID).Error("failed to get students", "error", err)
 		text := "❌ Xatolik yuz berdi / Произошла ошибка"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	if len(children) == 0 {
 		text := fmt.Sprintf("📝 '%s' raqamli ota-onaga farzandlar bog'lanmagan.\n\n"+
@@ -1,24 +1,24 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"strconv"
-	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
+	"parent-bot/internal/state"
 	"parent-bot/internal/utils"
 )
 
 // HandleMyChildrenCommand shows parent's children with action buttons
-func HandleMyChildrenCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleMyChildrenCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -32,7 +32,7 @@ func HandleMyChildrenCommand(botService *services.BotService, message *tgbotapi.
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get parent's children
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -46,14 +46,14 @@ func HandleMyChildrenCommand(botService *services.BotService, message *tgbotapi.
 		text := i18n.Get(i18n.MsgNoChildrenLinked, lang)
 
 		// Get active classes
-		classes, err := botService.ClassRepo.GetActive()
+		classes, err := botService.ClassRepo.GetActive(ctx)
 		if err != nil || len(classes) == 0 {
 			text += "\n\n" + i18n.Get(i18n.MsgWaitForStudentAdd, lang)
 			return botService.TelegramService.SendMessage(chatID, text, nil)
 		}
 
 		// Set state for adding child
-		err = botService.StateManager.Set(telegramID, models.StateAddingChild, &models.StateData{})
+		err = botService.StateManager.Set(ctx, telegramID, models.StateAddingChild, nil)
 		if err != nil {
 			return err
 		}
@@ -108,29 +108,16 @@ func HandleMyChildrenCommand(botService *services.BotService, message *tgbotapi.
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleChildInfoCallback handles showing child info when parent clicks on child button
-func HandleChildInfoCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleChildInfoCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 
-	// Extract student ID from callback data (format: "child_info_123")
-	parts := strings.Split(callback.Data, "_")
-	if len(parts) != 3 {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
-	studentID, err := strconv.Atoi(parts[2])
-	if err != nil {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -143,7 +130,7 @@ func HandleChildInfoCallback(botService *services.BotService, callback *tgbotapi
 	lang := i18n.GetLanguage(user.Language)
 
 	// Verify student belongs to this parent
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, i18n.Get(i18n.ErrDatabaseError, lang))
 		return nil
@@ -172,15 +159,12 @@ func HandleChildInfoCallback(botService *services.BotService, callback *tgbotapi
 }
 
 // HandleSelectClassCallback handles class selection during registration
-func HandleSelectClassCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleSelectClassCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, className string) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Extract class name from callback data (format: "select_class_9A")
-	className := strings.TrimPrefix(callback.Data, "select_class_")
-
 	// Get user and state data
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -189,23 +173,23 @@ func HandleSelectClassCallback(botService *services.BotService, callback *tgbota
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get class by name
-	class, err := botService.ClassRepo.GetByName(className)
+	class, err := botService.ClassRepo.GetByName(ctx, className)
 	if err != nil || class == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Sinf topilmadi / Класс не найден")
 		return nil
 	}
 
 	// Get state data
-	stateData, err := botService.StateManager.GetData(telegramID)
+	stateData, err := state.Load[models.ChildData](ctx, botService.StateManager, telegramID)
 	if err != nil {
-		stateData = &models.StateData{}
+		stateData = &models.ChildData{}
 	}
 
 	// Store selected class in state
 	stateData.ClassID = &class.ID
 
 	// Set state to selecting child
-	err = botService.StateManager.Set(telegramID, models.StateSelectingChild, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateSelectingChild, stateData)
 	if err != nil {
 		return err
 	}
@@ -214,7 +198,7 @@ func HandleSelectClassCallback(botService *services.BotService, callback *tgbota
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, fmt.Sprintf("✅ %s", className))
 
 	// Get students in this class
-	students, err := botService.StudentRepo.GetByClassID(class.ID)
+	students, err := botService.StudentRepo.GetByClassID(ctx, class.ID)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -245,25 +229,12 @@ func HandleSelectClassCallback(botService *services.BotService, callback *tgbota
 }
 
 // HandleSelectStudentCallback handles student selection during registration
-func HandleSelectStudentCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleSelectStudentCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Extract student ID from callback data (format: "select_student_123")
-	parts := strings.Split(callback.Data, "_")
-	if len(parts) != 3 {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
-	studentID, err := strconv.Atoi(parts[2])
-	if err != nil {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -272,7 +243,7 @@ func HandleSelectStudentCallback(botService *services.BotService, callback *tgbo
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get student
-	student, err := botService.StudentRepo.GetByIDWithClass(studentID)
+	student, err := botService.StudentRepo.GetByIDWithClass(ctx, studentID)
 	if err != nil || student == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, i18n.Get(i18n.MsgChildNotFound, lang))
 		return nil
@@ -283,14 +254,14 @@ func HandleSelectStudentCallback(botService *services.BotService, callback *tgbo
 	// the SAME parent from linking to the SAME student multiple times
 
 	// Link student to parent
-	err = botService.StudentRepo.LinkToParent(user.ID, studentID)
+	err = botService.StudentService.LinkToParent(ctx, user.ID, studentID)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state and show success
-	err = botService.StateManager.Clear(telegramID)
+	err = botService.StateManager.Clear(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -307,12 +278,12 @@ func HandleSelectStudentCallback(botService *services.BotService, callback *tgbo
 }
 
 // HandleSkipChildSelectionCallback handles skipping child selection during registration
-func HandleSkipChildSelectionCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleSkipChildSelectionCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -321,7 +292,7 @@ func HandleSkipChildSelectionCallback(botService *services.BotService, callback
 	lang := i18n.GetLanguage(user.Language)
 
 	// Clear state
-	err = botService.StateManager.Clear(telegramID)
+	err = botService.StateManager.Clear(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -340,12 +311,12 @@ func HandleSkipChildSelectionCallback(botService *services.BotService, callback
 }
 
 // HandleBackToClassSelectionCallback handles going back to class selection
-func HandleBackToClassSelectionCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleBackToClassSelectionCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -354,18 +325,18 @@ func HandleBackToClassSelectionCallback(botService *services.BotService, callbac
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get active classes
-	classes, err := botService.ClassRepo.GetActive()
+	classes, err := botService.ClassRepo.GetActive(ctx)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Set state
-	stateData, _ := botService.StateManager.GetData(telegramID)
+	stateData, _ := state.Load[models.ChildData](ctx, botService.StateManager, telegramID)
 	if stateData == nil {
-		stateData = &models.StateData{}
+		stateData = &models.ChildData{}
 	}
-	err = botService.StateManager.Set(telegramID, models.StateSelectingClass, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateSelectingClass, stateData)
 	if err != nil {
 		return err
 	}
@@ -463,12 +434,12 @@ func makeClassSelectionKeyboardForMyKids(classes []*models.Class, lang i18n.Lang
 }
 
 // HandleAddAnotherChildCallback handles the "Add Another Child" button
-func HandleAddAnotherChildCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleAddAnotherChildCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -477,7 +448,7 @@ func HandleAddAnotherChildCallback(botService *services.BotService, callback *tg
 	lang := i18n.GetLanguage(user.Language)
 
 	// Check if parent can add more children
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		return err
 	}
@@ -488,7 +459,7 @@ func HandleAddAnotherChildCallback(botService *services.BotService, callback *tg
 	}
 
 	// Get active classes
-	classes, err := botService.ClassRepo.GetActive()
+	classes, err := botService.ClassRepo.GetActive(ctx)
 	if err != nil || len(classes) == 0 {
 		text := i18n.Get(i18n.MsgWaitForStudentAdd, lang)
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -496,7 +467,7 @@ func HandleAddAnotherChildCallback(botService *services.BotService, callback *tg
 	}
 
 	// Set state for adding child
-	err = botService.StateManager.Set(telegramID, models.StateAddingChild, &models.StateData{})
+	err = botService.StateManager.Set(ctx, telegramID, models.StateAddingChild, nil)
 	if err != nil {
 		return err
 	}
@@ -511,15 +482,12 @@ func HandleAddAnotherChildCallback(botService *services.BotService, callback *tg
 }
 
 // HandleMyKidsClassCallback handles class selection when adding a child from My Kids
-func HandleMyKidsClassCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleMyKidsClassCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, className string) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Extract class name from callback data (format: "mykids_class_9A")
-	className := strings.TrimPrefix(callback.Data, "mykids_class_")
-
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -528,23 +496,23 @@ func HandleMyKidsClassCallback(botService *services.BotService, callback *tgbota
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get class by name
-	class, err := botService.ClassRepo.GetByName(className)
+	class, err := botService.ClassRepo.GetByName(ctx, className)
 	if err != nil || class == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Sinf topilmadi / Класс не найден")
 		return nil
 	}
 
 	// Get state data
-	stateData, err := botService.StateManager.GetData(telegramID)
+	stateData, err := state.Load[models.ChildData](ctx, botService.StateManager, telegramID)
 	if err != nil {
-		stateData = &models.StateData{}
+		stateData = &models.ChildData{}
 	}
 
 	// Store selected class in state
 	stateData.ClassID = &class.ID
 
 	// Set state to selecting child from class
-	err = botService.StateManager.Set(telegramID, models.StateSelectingChildFromClass, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateSelectingChildFromClass, stateData)
 	if err != nil {
 		return err
 	}
@@ -553,7 +521,7 @@ func HandleMyKidsClassCallback(botService *services.BotService, callback *tgbota
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, fmt.Sprintf("✅ %s", className))
 
 	// Get students in this class
-	students, err := botService.StudentRepo.GetByClassID(class.ID)
+	students, err := botService.StudentRepo.GetByClassID(ctx, class.ID)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -577,7 +545,7 @@ func HandleMyKidsClassCallback(botService *services.BotService, callback *tgbota
 	}
 
 	// Filter out students that are already linked to this parent
-	children, _ := botService.StudentRepo.GetParentStudents(user.ID)
+	children, _ := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	linkedStudentIDs := make(map[int]bool)
 	for _, child := range children {
 		linkedStudentIDs[child.StudentID] = true
@@ -635,25 +603,12 @@ func makeStudentSelectionKeyboardForMyKids(students []*models.StudentWithClass,
 }
 
 // HandleMyKidsStudentCallback handles student selection when adding a child from My Kids
-func HandleMyKidsStudentCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleMyKidsStudentCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Extract student ID from callback data (format: "mykids_student_123")
-	parts := strings.Split(callback.Data, "_")
-	if len(parts) != 3 {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
-	studentID, err := strconv.Atoi(parts[2])
-	if err != nil {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -662,7 +617,7 @@ func HandleMyKidsStudentCallback(botService *services.BotService, callback *tgbo
 	lang := i18n.GetLanguage(user.Language)
 
 	// Check if parent can add more children
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		return err
 	}
@@ -673,7 +628,7 @@ func HandleMyKidsStudentCallback(botService *services.BotService, callback *tgbo
 	}
 
 	// Get student
-	student, err := botService.StudentRepo.GetByIDWithClass(studentID)
+	student, err := botService.StudentRepo.GetByIDWithClass(ctx, studentID)
 	if err != nil || student == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, i18n.Get(i18n.MsgChildNotFound, lang))
 		return nil
@@ -692,14 +647,14 @@ func HandleMyKidsStudentCallback(botService *services.BotService, callback *tgbo
 	// the SAME parent from linking to the SAME student multiple times
 
 	// Link student to parent
-	err = botService.StudentRepo.LinkToParent(user.ID, studentID)
+	err = botService.StudentService.LinkToParent(ctx, user.ID, studentID)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	err = botService.StateManager.Clear(telegramID)
+	err = botService.StateManager.Clear(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -730,18 +685,18 @@ func HandleMyKidsStudentCallback(botService *services.BotService, callback *tgbo
 }
 
 // HandleBackToMyKidsCallback handles going back to My Kids menu
-func HandleBackToMyKidsCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleBackToMyKidsCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Answer callback
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		return nil
 	}
@@ -749,7 +704,7 @@ func HandleBackToMyKidsCallback(botService *services.BotService, callback *tgbot
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get parent's children
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -762,13 +717,13 @@ func HandleBackToMyKidsCallback(botService *services.BotService, callback *tgbot
 		text := i18n.Get(i18n.MsgNoChildrenLinked, lang)
 
 		// Get active classes
-		classes, err := botService.ClassRepo.GetActive()
+		classes, err := botService.ClassRepo.GetActive(ctx)
 		if err != nil || len(classes) == 0 {
 			text += "\n\n" + i18n.Get(i18n.MsgWaitForStudentAdd, lang)
 			return botService.TelegramService.SendMessage(chatID, text, nil)
 		}
 
-		err = botService.StateManager.Set(telegramID, models.StateAddingChild, &models.StateData{})
+		err = botService.StateManager.Set(ctx, telegramID, models.StateAddingChild, nil)
 		if err != nil {
 			return err
 		}
@@ -819,17 +774,17 @@ func HandleBackToMyKidsCallback(botService *services.BotService, callback *tgbot
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleBackToMyKidsClassSelectionCallback handles going back to class selection in My Kids
-func HandleBackToMyKidsClassSelectionCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleBackToMyKidsClassSelectionCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -838,14 +793,14 @@ func HandleBackToMyKidsClassSelectionCallback(botService *services.BotService, c
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get active classes
-	classes, err := botService.ClassRepo.GetActive()
+	classes, err := botService.ClassRepo.GetActive(ctx)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Set state
-	err = botService.StateManager.Set(telegramID, models.StateAddingChild, &models.StateData{})
+	err = botService.StateManager.Set(ctx, telegramID, models.StateAddingChild, nil)
 	if err != nil {
 		return err
 	}
@@ -860,18 +815,18 @@ func HandleBackToMyKidsClassSelectionCallback(botService *services.BotService, c
 }
 
 // HandleBackToMainCallback handles going back to main menu
-func HandleBackToMainCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleBackToMainCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Answer callback
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		return nil
 	}
@@ -885,25 +840,12 @@ func HandleBackToMainCallback(botService *services.BotService, callback *tgbotap
 }
 
 // HandleViewChildCallback handles viewing a specific child's info
-func HandleViewChildCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleViewChildCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Extract student ID from callback data (format: "view_child_123")
-	parts := strings.Split(callback.Data, "_")
-	if len(parts) != 3 {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
-	studentID, err := strconv.Atoi(parts[2])
-	if err != nil {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -912,7 +854,7 @@ func HandleViewChildCallback(botService *services.BotService, callback *tgbotapi
 	lang := i18n.GetLanguage(user.Language)
 
 	// Verify student belongs to this parent
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		return err
 	}
@@ -962,6 +904,6 @@ func HandleViewChildCallback(botService *services.BotService, callback *tgbotapi
 }
 
 // HandleShowMyKidsCallback handles showing my kids menu (for after adding child)
-func HandleShowMyKidsCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
-	return HandleBackToMyKidsCallback(botService, callback)
+func HandleShowMyKidsCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+	return HandleBackToMyKidsCallback(ctx, botService, callback)
 }
@@ -1,30 +1,31 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"log"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
+	"parent-bot/internal/state"
 )
 
 // HandleTeacherAnnouncementToggleClass handles toggling class selection for announcement
-func HandleTeacherAnnouncementToggleClass(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleTeacherAnnouncementToggleClass(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
 		return nil
 	}
 
 	// Get state data
-	stateData, err := botService.StateManager.GetData(telegramID)
-	if err != nil || stateData == nil {
-		stateData = &models.StateData{
+	stateData, err := state.Load[models.AnnouncementData](ctx, botService.StateManager, telegramID)
+	if err != nil {
+		stateData = &models.AnnouncementData{
 			SelectedClasses: []int{},
 		}
 	}
@@ -49,14 +50,14 @@ func HandleTeacherAnnouncementToggleClass(botService *services.BotService, callb
 	stateData.SelectedClasses = newSelectedClasses
 
 	// Update state
-	err = botService.StateManager.Set(telegramID, "teacher_selecting_announcement_classes", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateTeacherSelectingAnnouncementClasses, stateData)
 	if err != nil {
-		log.Printf("Failed to update state: %v", err)
+		botService.Log(telegramID).Error("failed to update state", "error", err)
 	}
 
 	// Re-render the class selection screen with updated checkboxes
 	// Teachers can see all classes
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
 		return nil
@@ -110,27 +111,26 @@ func HandleTeacherAnnouncementToggleClass(botService *services.BotService, callb
 	editMsg.ParseMode = "HTML"
 	editMsg.ReplyMarkup = &keyboard
 
-	_, err = botService.Bot.Send(editMsg)
+	_, err = botService.TelegramService.Send(editMsg)
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 	return err
 }
 
 // HandleTeacherAnnouncementContinue handles continuing to announcement content input
-func HandleTeacherAnnouncementContinue(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleTeacherAnnouncementContinue(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get state data
-	stateData, err := botService.StateManager.GetData(telegramID)
-	if err != nil || stateData == nil || len(stateData.SelectedClasses) == 0 {
+	stateData, err := state.Load[models.AnnouncementData](ctx, botService.StateManager, telegramID)
+	if err != nil || len(stateData.SelectedClasses) == 0 {
 		text := "❌ Iltimos, kamida bitta sinf tanlang.\n\n❌ Пожалуйста, выберите хотя бы один класс."
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
 		return nil
 	}
 
 	// Delete the selection message
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	// Ask for announcement content
 	text := "📢 <b>E'lon matni / Текст объявления</b>\n\n" +
@@ -140,9 +140,9 @@ func HandleTeacherAnnouncementContinue(botService *services.BotService, callback
 		"💡 Возможность добавить изображение будет на следующем шаге."
 
 	// Update state
-	err = botService.StateManager.Set(telegramID, "teacher_awaiting_announcement_content", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateTeacherAwaitingAnnouncementContent, stateData)
 	if err != nil {
-		log.Printf("Failed to update state: %v", err)
+		botService.Log(telegramID).Error("failed to update state", "error", err)
 	}
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -150,16 +150,15 @@ func HandleTeacherAnnouncementContinue(botService *services.BotService, callback
 }
 
 // HandleTeacherAnnouncementCancel handles canceling announcement creation
-func HandleTeacherAnnouncementCancel(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleTeacherAnnouncementCancel(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Delete the selection message
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	text := "❌ E'lon qo'shish bekor qilindi.\n\n❌ Создание объявления отменено."
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -167,7 +166,7 @@ func HandleTeacherAnnouncementCancel(botService *services.BotService, callback *
 }
 
 // HandleTeacherAnnouncementContent handles announcement content input
-func HandleTeacherAnnouncementContent(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleTeacherAnnouncementContent(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -187,11 +186,11 @@ func HandleTeacherAnnouncementContent(botService *services.BotService, message *
 	}
 
 	// Get state data
-	stateData, err := botService.StateManager.GetData(telegramID)
-	if err != nil || stateData == nil {
+	stateData, err := state.Load[models.AnnouncementData](ctx, botService.StateManager, telegramID)
+	if err != nil || len(stateData.SelectedClasses) == 0 {
 		text := "❌ Sessiya tugagan. Iltimos, qaytadan boshlang.\n\n" +
 			"❌ Сессия истекла. Пожалуйста, начните заново."
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
@@ -199,9 +198,9 @@ func HandleTeacherAnnouncementContent(botService *services.BotService, message *
 	stateData.AnnouncementText = content
 
 	// Move to file upload state (ask for optional image)
-	err = botService.StateManager.Set(telegramID, "teacher_awaiting_announcement_file", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateTeacherAwaitingAnnouncementFile, stateData)
 	if err != nil {
-		log.Printf("Failed to update state: %v", err)
+		botService.Log(telegramID).Error("failed to update state", "error", err)
 	}
 
 	// Ask for optional image
@@ -224,37 +223,23 @@ func HandleTeacherAnnouncementContent(botService *services.BotService, message *
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleTeacherAnnouncementEdit handles editing an announcement
-func HandleTeacherAnnouncementEdit(botService *services.BotService, callback *tgbotapi.CallbackQuery, announcementID int) error {
+func HandleTeacherAnnouncementEdit(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, announcementID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
-	if err != nil || teacher == nil {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
-		return nil
-	}
-
 	// Get announcement
-	announcement, err := botService.AnnouncementRepo.GetByID(announcementID)
+	announcement, err := botService.AnnouncementRepo.GetByID(ctx, announcementID)
 	if err != nil || announcement == nil {
 		text := "❌ E'lon topilmadi / Объявление не найдено"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
-	// Verify teacher owns this announcement
-	if announcement.PostedByTeacherID == nil || *announcement.PostedByTeacherID != teacher.ID {
-		text := "❌ Siz bu e'lonni tahrirlay olmaysiz / Вы не можете редактировать это объявление"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
 	// Ask for new content
 	text := fmt.Sprintf(
 		"✏️ <b>E'lonni tahrirlash / Редактирование объявления</b>\n\n"+
@@ -266,12 +251,12 @@ func HandleTeacherAnnouncementEdit(botService *services.BotService, callback *tg
 	)
 
 	// Set state
-	stateData := &models.StateData{
+	stateData := &models.AnnouncementEditData{
 		AnnouncementID: announcementID,
 	}
-	err = botService.StateManager.Set(telegramID, "teacher_editing_announcement_content", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateTeacherEditingAnnouncementContent, stateData)
 	if err != nil {
-		log.Printf("Failed to set state: %v", err)
+		botService.Log(telegramID).Error("failed to set state", "error", err)
 	}
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -279,7 +264,7 @@ func HandleTeacherAnnouncementEdit(botService *services.BotService, callback *tg
 }
 
 // HandleTeacherEditedAnnouncementContent handles the edited announcement content
-func HandleTeacherEditedAnnouncementContent(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleTeacherEditedAnnouncementContent(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -293,18 +278,18 @@ func HandleTeacherEditedAnnouncementContent(botService *services.BotService, mes
 	}
 
 	// Get state data
-	stateData, err := botService.StateManager.GetData(telegramID)
-	if err != nil || stateData == nil {
+	stateData, err := state.Load[models.AnnouncementEditData](ctx, botService.StateManager, telegramID)
+	if err != nil || stateData.AnnouncementID == 0 {
 		text := "❌ Sessiya tugagan. Iltimos, qaytadan boshlang.\n\n" +
 			"❌ Сессия истекла. Пожалуйста, начните заново."
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get existing announcement to preserve fields
-	existingAnnouncement, err := botService.AnnouncementRepo.GetByID(stateData.AnnouncementID)
+	existingAnnouncement, err := botService.AnnouncementRepo.GetByID(ctx, stateData.AnnouncementID)
 	if err != nil || existingAnnouncement == nil {
-		log.Printf("Failed to get announcement: %v", err)
+		botService.Log(telegramID).Error("failed to get announcement", "error", err)
 		text := "❌ E'lon topilmadi / Объявление не найдено"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -319,15 +304,15 @@ func HandleTeacherEditedAnnouncementContent(botService *services.BotService, mes
 		PostedByTeacherID: existingAnnouncement.PostedByTeacherID,
 	}
 
-	_, err = botService.AnnouncementService.UpdateAnnouncement(stateData.AnnouncementID, req)
+	_, err = botService.AnnouncementService.UpdateAnnouncement(ctx, stateData.AnnouncementID, req)
 	if err != nil {
-		log.Printf("Failed to update announcement: %v", err)
+		botService.Log(telegramID).Error("failed to update announcement", "error", err)
 		text := "❌ E'lonni yangilashda xatolik / Ошибка при обновлении объявления"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Success message
 	text := fmt.Sprintf(
@@ -343,44 +328,29 @@ func HandleTeacherEditedAnnouncementContent(botService *services.BotService, mes
 }
 
 // HandleTeacherAnnouncementDelete handles deleting an announcement
-func HandleTeacherAnnouncementDelete(botService *services.BotService, callback *tgbotapi.CallbackQuery, announcementID int) error {
+func HandleTeacherAnnouncementDelete(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, announcementID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
-	if err != nil || teacher == nil {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik")
-		return nil
-	}
-
 	// Get announcement
-	announcement, err := botService.AnnouncementRepo.GetByID(announcementID)
+	announcement, err := botService.AnnouncementRepo.GetByID(ctx, announcementID)
 	if err != nil || announcement == nil {
 		text := "❌ E'lon topilmadi / Объявление не найдено"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
-	// Verify teacher owns this announcement
-	if announcement.PostedByTeacherID == nil || *announcement.PostedByTeacherID != teacher.ID {
-		text := "❌ Siz bu e'lonni o'chira olmaysiz / Вы не можете удалить это объявление"
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, text)
-		return nil
-	}
-
 	// Delete announcement
-	err = botService.AnnouncementRepo.Delete(announcementID)
+	err = botService.AnnouncementService.DeleteAnnouncement(ctx, announcementID)
 	if err != nil {
-		log.Printf("Failed to delete announcement: %v", err)
+		botService.Log(telegramID).Error("failed to delete announcement", "error", err)
 		text := "❌ E'lonni o'chirishda xatolik / Ошибка при удалении объявления"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Delete the message
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	text := fmt.Sprintf(
 		"✅ E'lon o'chirildi!\n\n"+
@@ -396,7 +366,7 @@ func HandleTeacherAnnouncementDelete(botService *services.BotService, callback *
 }
 
 // HandleTeacherAnnouncementFile handles announcement file upload for teachers
-func HandleTeacherAnnouncementFile(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleTeacherAnnouncementFile(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.AnnouncementData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -436,17 +406,17 @@ func HandleTeacherAnnouncementFile(botService *services.BotService, message *tgb
 	}
 
 	// Save announcement with file
-	return saveTeacherAnnouncement(botService, telegramID, chatID, stateData, fileID, filename, &fileType)
+	return saveTeacherAnnouncement(ctx, botService, telegramID, chatID, stateData, fileID, filename, &fileType)
 }
 
 // HandleTeacherAnnouncementSkipFile handles skipping file upload for teacher announcements
-func HandleTeacherAnnouncementSkipFile(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleTeacherAnnouncementSkipFile(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get state data
-	stateData, err := botService.StateManager.GetData(telegramID)
-	if err != nil || stateData == nil {
+	stateData, err := state.Load[models.AnnouncementData](ctx, botService.StateManager, telegramID)
+	if err != nil || stateData.AnnouncementText == "" {
 		text := "❌ Sessiya tugagan. Iltimos, qaytadan boshlang.\n\n" +
 			"❌ Сессия истекла. Пожалуйста, начните заново."
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -457,13 +427,13 @@ func HandleTeacherAnnouncementSkipFile(botService *services.BotService, callback
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "✅")
 
 	// Save announcement without file
-	return saveTeacherAnnouncement(botService, telegramID, chatID, stateData, nil, nil, nil)
+	return saveTeacherAnnouncement(ctx, botService, telegramID, chatID, stateData, nil, nil, nil)
 }
 
 // saveTeacherAnnouncement saves the teacher's announcement to database
-func saveTeacherAnnouncement(botService *services.BotService, telegramID int64, chatID int64, stateData *models.StateData, fileID, filename, fileType *string) error {
+func saveTeacherAnnouncement(ctx context.Context, botService *services.BotService, telegramID int64, chatID int64, stateData *models.AnnouncementData, fileID, filename, fileType *string) error {
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		text := "❌ O'qituvchi ma'lumotlari topilmadi / Данные учителя не найдены"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -479,20 +449,20 @@ func saveTeacherAnnouncement(botService *services.BotService, telegramID int64,
 		ClassIDs:          stateData.SelectedClasses,
 	}
 
-	announcement, err := botService.AnnouncementService.CreateAnnouncement(req)
+	announcement, err := botService.AnnouncementService.CreateAnnouncement(ctx, req)
 	if err != nil {
-		log.Printf("Failed to create announcement: %v", err)
+		botService.Log(telegramID).Error("failed to create announcement", "error", err)
 		text := "❌ E'lon yaratishda xatolik / Ошибка при создании объявления"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Get class names
 	classNames := []string{}
 	for _, classID := range stateData.SelectedClasses {
-		class, err := botService.ClassRepo.GetByID(classID)
+		class, err := botService.ClassRepo.GetByID(ctx, classID)
 		if err == nil && class != nil {
 			classNames = append(classNames, class.ClassName)
 		}
@@ -509,15 +479,22 @@ func saveTeacherAnnouncement(botService *services.BotService, telegramID int64,
 			"ID: <code>%d</code>\n"+
 			"%s"+
 			"Sinflar / Классы: <b>%s</b>\n\n"+
-			"E'lon ota-onalarga ko'rsatilmoqda.\n\n"+
+			"E'lon ota-onalarga yuborilmoqda.\n\n"+
 			"✅ <b>Объявление успешно создано!</b>\n\n"+
 			"ID: <code>%d</code>\n"+
 			"%s"+
 			"Классы: <b>%s</b>\n\n"+
-			"Объявление показывается родителям.",
+			"Объявление отправляется родителям.",
 		announcement.ID, imageInfo, fmt.Sprintf("%v", classNames),
 		announcement.ID, imageInfo, fmt.Sprintf("%v", classNames),
 	)
 
-	return botService.TelegramService.SendMessage(chatID, text, nil)
+	if err := botService.TelegramService.SendMessage(chatID, text, nil); err != nil {
+		return err
+	}
+
+	// Send the announcement to the parents of the selected classes
+	notifyUsersAboutAnnouncement(ctx, botService, announcement, chatID)
+
+	return nil
 }
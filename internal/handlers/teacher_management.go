@@ -1,47 +1,34 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
 	"parent-bot/internal/i18n"
 	"parent-bot/internal/models"
 	"parent-bot/internal/services"
+	"parent-bot/internal/state"
 	"parent-bot/internal/utils"
 	"parent-bot/internal/validator"
 )
 
 // HandleAddTeacherCommand initiates adding a new teacher (admin only)
-func HandleAddTeacherCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleAddTeacherCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
-	// Check if user is admin
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	isAdmin := false
-	if user != nil {
-		isAdmin, _ = botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat administratorlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	text := "👨‍🏫 <b>Yangi o'qituvchi qo'shish / Добавить нового учителя</b>\n\n" +
 		"Iltimos, o'qituvchining to'liq ismini kiriting:\n" +
 		"Пожалуйста, введите полное имя учителя:\n\n" +
 		"<b>Misol / Пример:</b> Shahlo Rahimova"
 
 	// Set state
-	stateData := &models.StateData{}
-	err = botService.StateManager.Set(telegramID, "awaiting_teacher_full_name", stateData)
+	err := botService.StateManager.Set(ctx, telegramID, models.StateAwaitingTeacherFullName, nil)
 	if err != nil {
 		return err
 	}
@@ -50,7 +37,7 @@ func HandleAddTeacherCommand(botService *services.BotService, message *tgbotapi.
 }
 
 // HandleTeacherFullName processes teacher full name input
-func HandleTeacherFullName(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleTeacherFullName(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.TeacherData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -83,7 +70,7 @@ func HandleTeacherFullName(botService *services.BotService, message *tgbotapi.Me
 	// Save names and ask for phone
 	stateData.TeacherFirstName = firstName
 	stateData.TeacherLastName = lastName
-	err := botService.StateManager.Set(telegramID, "awaiting_teacher_phone", stateData)
+	err := botService.StateManager.Set(ctx, telegramID, models.StateAwaitingTeacherPhone, stateData)
 	if err != nil {
 		return err
 	}
@@ -98,13 +85,13 @@ func HandleTeacherFullName(botService *services.BotService, message *tgbotapi.Me
 }
 
 // HandleTeacherPhone processes teacher phone number input
-func HandleTeacherPhone(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleTeacherPhone(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.TeacherData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	if stateData.TeacherFirstName == "" || stateData.TeacherLastName == "" {
 		text := "❌ Sessiya tugagan. Iltimos, qaytadan boshlang.\n\n❌ Сессия истекла. Пожалуйста, начните заново."
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
@@ -121,38 +108,48 @@ func HandleTeacherPhone(botService *services.BotService, message *tgbotapi.Messa
 	}
 
 	// Check if phone already exists
-	existingTeacher, err := botService.TeacherRepo.GetByPhone(validPhone)
+	existingTeacher, err := botService.TeacherRepo.GetByPhone(ctx, validPhone)
 	if err != nil {
-		log.Printf("Error checking existing teacher: %v", err)
+		botService.Log(telegramID).Error("failed to check existing teacher", "error", err)
 	}
 	if existingTeacher != nil {
 		text := fmt.Sprintf("❌ Bu telefon raqami allaqachon ro'yxatdan o'tgan.\n\n"+
 			"❌ Этот номер телефона уже зарегистрирован.\n\n"+
 			"O'qituvchi / Учитель: %s %s", existingTeacher.FirstName, existingTeacher.LastName)
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get admin info
-	admin, err := botService.AdminRepo.GetByTelegramID(telegramID)
+	admin, err := botService.AdminRepo.GetByTelegramID(ctx, telegramID)
 	if err != nil || admin == nil {
 		text := "❌ Admin ma'lumotlari topilmadi / Данные администратора не найдены"
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Create teacher with default language "uz"
 	language := "uz"
-	teacherID, err := botService.TeacherRepo.Create(firstName, lastName, validPhone, language, admin.ID)
+	teacherID, err := botService.TeacherService.CreateTeacher(ctx, &models.CreateTeacherRequest{
+		PhoneNumber:    validPhone,
+		FirstName:      firstName,
+		LastName:       lastName,
+		Language:       language,
+		AddedByAdminID: admin.ID,
+	})
 	if err != nil {
-		log.Printf("Failed to create teacher: %v", err)
+		botService.Log(telegramID).Error("failed to create teacher", "error", err)
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
-		_ = botService.StateManager.Clear(telegramID)
+		if errors.Is(err, services.ErrConflict) {
+			text = "❌ Bu telefon raqami allaqachon ro'yxatdan o'tgan.\n\n" +
+				"❌ Этот номер телефона уже зарегистрирован."
+		}
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Success message with created teacher info
 	text := fmt.Sprintf(
@@ -174,28 +171,11 @@ func HandleTeacherPhone(botService *services.BotService, message *tgbotapi.Messa
 }
 
 // HandleListTeachersCommand lists all teachers (admin only)
-func HandleListTeachersCommand(botService *services.BotService, message *tgbotapi.Message) error {
-	telegramID := message.From.ID
+func HandleListTeachersCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	chatID := message.Chat.ID
 
-	// Check if user is admin
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
-	if err != nil {
-		return err
-	}
-
-	isAdmin := false
-	if user != nil {
-		isAdmin, _ = botService.IsAdmin(user.PhoneNumber, user.TelegramID)
-	}
-
-	if !isAdmin {
-		text := "❌ Bu buyruq faqat administratorlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	// Get all teachers
-	teachers, err := botService.TeacherRepo.GetAll(100, 0)
+	teachers, err := botService.TeacherRepo.GetAll(ctx, 100, 0)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -234,7 +214,7 @@ func HandleListTeachersCommand(botService *services.BotService, message *tgbotap
 }
 
 // HandleTeacherRegistration handles teacher registration when they share phone
-func HandleTeacherRegistration(botService *services.BotService, message *tgbotapi.Message, phoneNumber string) error {
+func HandleTeacherRegistration(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, phoneNumber string) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -246,36 +226,36 @@ func HandleTeacherRegistration(botService *services.BotService, message *tgbotap
 	}
 
 	// Find teacher by phone
-	teacher, err := botService.TeacherRepo.GetByPhone(validPhone)
+	teacher, err := botService.TeacherRepo.GetByPhone(ctx, validPhone)
 	if err != nil {
-		log.Printf("Error finding teacher: %v", err)
+		botService.Log(telegramID).Error("failed to find teacher", "error", err)
 		text := "❌ Xatolik yuz berdi / Произошла ошибка"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	if teacher == nil {
 		// Not a teacher, try parent registration
-		return HandlePhoneNumber(botService, message, &models.StateData{Language: "uz"})
+		return HandlePhoneNumber(ctx, botService, message, &models.RegistrationData{Language: "uz"})
 	}
 
 	// Check if already registered
 	if teacher.TelegramID != nil && *teacher.TelegramID == telegramID {
 		lang := i18n.GetLanguage(teacher.Language)
 		text := "✅ Siz allaqachon ro'yxatdan o'tgansiz!\n\n✅ Вы уже зарегистрированы!"
-		keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+		keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 		return botService.TelegramService.SendMessage(chatID, text, keyboard)
 	}
 
 	// Register teacher
-	err = botService.TeacherRepo.UpdateTelegramID(teacher.ID, telegramID, message.From.UserName)
+	err = botService.TeacherService.Register(ctx, teacher.ID, telegramID, message.From.UserName)
 	if err != nil {
-		log.Printf("Failed to register teacher: %v", err)
+		botService.Log(telegramID).Error("failed to register teacher", "error", err)
 		text := "❌ Ro'yxatdan o'tishda xatolik / Ошибка при регистрации"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Success message
 	lang := i18n.GetLanguage(teacher.Language)
@@ -290,13 +270,13 @@ func HandleTeacherRegistration(botService *services.BotService, message *tgbotap
 		teacher.FirstName, teacher.LastName,
 	)
 
-	keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+	keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
 // HandleTeacherMessage routes messages from registered teachers
 // IMPORTANT: This function handles ALL teacher states internally and NEVER falls through to parent handlers
-func HandleTeacherMessage(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherMessage(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(teacher.Language)
@@ -310,34 +290,42 @@ func HandleTeacherMessage(botService *services.BotService, message *tgbotapi.Mes
 	buttonText := message.Text
 	if isTeacherMenuButton(buttonText) {
 		// Clear any existing state when pressing menu buttons
-		_ = botService.StateManager.Clear(telegramID)
-		return HandleTeacherMainMenu(botService, message, teacher)
+		_ = botService.StateManager.Clear(ctx, telegramID)
+		return HandleTeacherMainMenu(ctx, botService, message, teacher)
 	}
 
 	// Check if teacher has an active state
-	state, err := botService.StateManager.Get(telegramID)
+	current, err := botService.StateManager.Get(ctx, telegramID)
 	if err != nil {
-		log.Printf("[TEACHER] Error getting state for %d: %v", telegramID, err)
+		botService.Log(telegramID).Error("failed to get teacher state", "error", err)
 		// Clear any bad state and show teacher menu
-		_ = botService.StateManager.Clear(telegramID)
-		return showTeacherMainMenu(botService, chatID, lang)
+		_ = botService.StateManager.Clear(ctx, telegramID)
+		return showTeacherMainMenu(ctx, botService, chatID, lang)
 	}
 
 	// If teacher has a state, route by teacher-specific state handler
-	if state != nil && state.State != "" {
-		stateData, err := botService.StateManager.GetData(telegramID)
+	if current != nil && current.State != "" {
+		// A flow left unfinished too long must not capture this message
+		if current.Expired(time.Now()) {
+			botService.Log(telegramID).Info("flow expired", "flow", current.Flow, "expired_state", current.State)
+			_ = botService.StateManager.Clear(ctx, telegramID)
+			keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
+			return botService.TelegramService.SendMessage(chatID, i18n.Get(i18n.ErrFlowExpired, lang), keyboard)
+		}
+
+		data, err := botService.StateManager.Data(current)
 		if err != nil {
-			log.Printf("[TEACHER] Error getting state data for %d: %v", telegramID, err)
-			_ = botService.StateManager.Clear(telegramID)
-			return showTeacherMainMenu(botService, chatID, lang)
+			botService.Log(telegramID).Error("failed to get teacher state data", "error", err)
+			_ = botService.StateManager.Clear(ctx, telegramID)
+			return showTeacherMainMenu(ctx, botService, chatID, lang)
 		}
 
 		// Route ONLY teacher states - never fall through to parent states
-		return routeTeacherState(botService, message, teacher, state.State, stateData)
+		return routeTeacherState(ctx, botService, message, teacher, current.State, data)
 	}
 
 	// No state - route to teacher menu handler
-	return HandleTeacherMainMenu(botService, message, teacher)
+	return HandleTeacherMainMenu(ctx, botService, message, teacher)
 }
 
 // isTeacherMenuButton checks if the button text is one of the teacher main menu buttons
@@ -366,94 +354,122 @@ func isTeacherMenuButton(buttonText string) bool {
 
 // routeTeacherState handles teacher-specific states only
 // If state doesn't match any teacher state, clears it and processes button press
-func routeTeacherState(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher, state string, stateData *models.StateData) error {
+func routeTeacherState(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher, current string, data any) error {
 	telegramID := message.From.ID
 
-	switch state {
-	case "teacher_selecting_announcement_classes":
+	if ok, err := authorizeState(ctx, botService, message, current); !ok {
+		return err
+	}
+
+	switch current {
+	case models.StateTeacherSelectingAnnouncementClasses:
 		// Waiting for callback selection - ignore text messages
 		return nil
 
-	case "taking_attendance":
+	case models.StateTakingAttendance:
 		// Waiting for callback selection (toggle/finish buttons) - ignore text messages
 		return nil
 
-	case "teacher_awaiting_announcement_content":
-		return HandleTeacherAnnouncementContent(botService, message)
+	case models.StateTeacherAwaitingAnnouncementContent:
+		return HandleTeacherAnnouncementContent(ctx, botService, message)
 
-	case "teacher_awaiting_announcement_file":
-		return HandleTeacherAnnouncementFile(botService, message, stateData)
+	case models.StateTeacherAwaitingAnnouncementFile:
+		return HandleTeacherAnnouncementFile(ctx, botService, message, state.As[models.AnnouncementData](data))
 
-	case "teacher_editing_announcement_content":
-		return HandleTeacherEditedAnnouncementContent(botService, message)
+	case models.StateTeacherEditingAnnouncementContent:
+		return HandleTeacherEditedAnnouncementContent(ctx, botService, message)
 
-	case "teacher_awaiting_student_name":
-		return HandleTeacherStudentNameInput(botService, message, stateData)
+	case models.StateTeacherAwaitingStudentName:
+		return HandleTeacherStudentNameInput(ctx, botService, message, state.As[models.StudentData](data))
 
-	case "teacher_awaiting_test_results_text":
-		return HandleTeacherTestResultsTextInput(botService, message, stateData)
+	case models.StateTeacherAwaitingTestResultsText:
+		return HandleTeacherTestResultsTextInput(ctx, botService, message, state.As[models.TestResultData](data))
 
 	default:
 		// Unknown or stale state (like 'registered' from parent flow) - clear it and PROCESS the button
-		log.Printf("[TEACHER] Unknown state '%s' for teacher %d, clearing and processing button press", state, telegramID)
-		_ = botService.StateManager.Clear(telegramID)
+		botService.Log(telegramID).Warn("unknown teacher state, clearing and processing button press", "teacher_state", current)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		// Process the button press instead of just showing menu
-		return HandleTeacherMainMenu(botService, message, teacher)
+		return HandleTeacherMainMenu(ctx, botService, message, teacher)
 	}
 }
 
 // showTeacherMainMenu displays the teacher main menu with keyboard
-func showTeacherMainMenu(botService *services.BotService, chatID int64, lang i18n.Language) error {
+func showTeacherMainMenu(ctx context.Context, botService *services.BotService, chatID int64, lang i18n.Language) error {
 	text := "👨‍🏫 Bosh menyu / Главное меню"
-	keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+	keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
 // HandleTeacherMainMenu handles teacher menu button presses
-func HandleTeacherMainMenu(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherMainMenu(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	buttonText := message.Text
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(teacher.Language)
 
+	// Buttons missing from the teacher's menu can still be typed, so their
+	// permissions are checked here too
+	caller := authz.CallerFrom(ctx)
+	denied := func(button string, permission models.Permission) bool {
+		rule := authz.Can(permission)
+		if err := botService.Policy.Authorize(ctx, caller, button, rule, nil); err != nil {
+			_ = botService.TelegramService.SendMessage(chatID, botService.Policy.DeniedMessage(caller, rule), nil)
+			return true
+		}
+		return false
+	}
+
 	// Add student
 	if buttonText == i18n.Get(i18n.BtnAddStudent, i18n.LanguageUzbek) ||
 	   buttonText == i18n.Get(i18n.BtnAddStudent, i18n.LanguageRussian) {
-		return HandleTeacherManageStudentsCommand(botService, message, teacher)
+		if denied(i18n.BtnAddStudent, models.PermClassStudentsManage) {
+			return nil
+		}
+		return HandleTeacherManageStudentsCommand(ctx, botService, message, teacher)
 	}
 
 	// View class students
 	if buttonText == i18n.Get(i18n.BtnViewClassStudents, i18n.LanguageUzbek) ||
 	   buttonText == i18n.Get(i18n.BtnViewClassStudents, i18n.LanguageRussian) {
-		return HandleTeacherManageStudentsCommand(botService, message, teacher)
+		return HandleTeacherManageStudentsCommand(ctx, botService, message, teacher)
 	}
 
 	// Mark attendance
 	if buttonText == i18n.Get(i18n.BtnMarkAttendance, i18n.LanguageUzbek) ||
 	   buttonText == i18n.Get(i18n.BtnMarkAttendance, i18n.LanguageRussian) {
-		return HandleTeacherTakeAttendanceCommand(botService, message, teacher)
+		if denied(i18n.BtnMarkAttendance, models.PermAttendanceMark) {
+			return nil
+		}
+		return HandleTeacherTakeAttendanceCommand(ctx, botService, message, teacher)
 	}
 
 	// Add test result
 	if buttonText == i18n.Get(i18n.BtnAddTestResult, i18n.LanguageUzbek) ||
 	   buttonText == i18n.Get(i18n.BtnAddTestResult, i18n.LanguageRussian) {
-		return HandleTeacherEnterGradesCommand(botService, message, teacher)
+		if denied(i18n.BtnAddTestResult, models.PermGradesEdit) {
+			return nil
+		}
+		return HandleTeacherEnterGradesCommand(ctx, botService, message, teacher)
 	}
 
 	// Post announcement
 	if buttonText == i18n.Get(i18n.BtnPostAnnouncement, i18n.LanguageUzbek) ||
 	   buttonText == i18n.Get(i18n.BtnPostAnnouncement, i18n.LanguageRussian) {
-		return HandleTeacherPostAnnouncementCommand(botService, message, teacher)
+		if denied(i18n.BtnPostAnnouncement, models.PermClassAnnouncementsPost) {
+			return nil
+		}
+		return HandleTeacherPostAnnouncementCommand(ctx, botService, message, teacher)
 	}
 
 	// Default: show main menu
 	text := "👨‍🏫 Bosh menyu / Главное меню"
-	keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+	keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
 // IsTeacher checks if user is a registered teacher
-func IsTeacher(botService *services.BotService, telegramID int64) (*models.Teacher, bool) {
-	teacher, err := botService.TeacherRepo.GetByTelegramID(telegramID)
+func IsTeacher(ctx context.Context, botService *services.BotService, telegramID int64) (*models.Teacher, bool) {
+	teacher, err := botService.TeacherRepo.GetByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		return nil, false
 	}
@@ -461,13 +477,13 @@ func IsTeacher(botService *services.BotService, telegramID int64) (*models.Teach
 }
 
 // HandleTeacherManageStudentsCommand allows teacher to manage students
-func HandleTeacherManageStudentsCommand(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherManageStudentsCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	chatID := message.Chat.ID
 	telegramID := message.From.ID
 	lang := i18n.GetLanguage(teacher.Language)
 
 	// Get all classes (teachers can access all classes)
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -476,7 +492,7 @@ func HandleTeacherManageStudentsCommand(botService *services.BotService, message
 	if len(classes) == 0 {
 		text := "📚 Hozircha sinflar yo'q. Admin sinf qo'shishi kerak.\n\n" +
 			"📚 Пока нет классов. Администратор должен добавить классы."
-		keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+		keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 		return botService.TelegramService.SendMessage(chatID, text, keyboard)
 	}
 
@@ -505,23 +521,23 @@ func HandleTeacherManageStudentsCommand(botService *services.BotService, message
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
 
 	// Clear any existing state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleTeacherManageClassCallback handles when teacher selects a class to manage
-func HandleTeacherManageClassCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleTeacherManageClassCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -530,14 +546,14 @@ func HandleTeacherManageClassCallback(botService *services.BotService, callback
 	lang := i18n.GetLanguage(teacher.Language)
 
 	// Get class info
-	class, err := botService.ClassRepo.GetByID(classID)
+	class, err := botService.ClassRepo.GetByID(ctx, classID)
 	if err != nil || class == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Sinf topilmadi")
 		return nil
 	}
 
 	// Get students in this class
-	students, err := botService.StudentRepo.GetByClassID(classID)
+	students, err := botService.StudentRepo.GetByClassID(ctx, classID)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -586,44 +602,43 @@ func HandleTeacherManageClassCallback(botService *services.BotService, callback
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
 	// Delete previous message and send new one
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	_ = lang // for future use
 	return err
 }
 
 // HandleTeacherAddStudentCallback handles initiating adding a student
-func HandleTeacherAddStudentCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleTeacherAddStudentCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
 	}
 
 	// Get class info
-	class, err := botService.ClassRepo.GetByID(classID)
+	class, err := botService.ClassRepo.GetByID(ctx, classID)
 	if err != nil || class == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Sinf topilmadi")
 		return nil
 	}
 
 	// Set state for adding student
-	stateData := &models.StateData{
+	stateData := &models.StudentData{
 		ClassID: &classID,
 	}
-	err = botService.StateManager.Set(telegramID, "teacher_awaiting_student_name", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateTeacherAwaitingStudentName, stateData)
 	if err != nil {
-		log.Printf("Failed to set state: %v", err)
+		botService.Log(telegramID).Error("failed to set state", "error", err)
 	}
 
 	text := fmt.Sprintf(
@@ -649,8 +664,7 @@ func HandleTeacherAddStudentCallback(botService *services.BotService, callback *
 	)
 
 	// Delete previous message
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
@@ -658,17 +672,17 @@ func HandleTeacherAddStudentCallback(botService *services.BotService, callback *
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleTeacherStudentNameInput handles student name input from teacher
-func HandleTeacherStudentNameInput(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleTeacherStudentNameInput(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.StudentData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		text := "❌ Xatolik / Ошибка"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -680,8 +694,8 @@ func HandleTeacherStudentNameInput(botService *services.BotService, message *tgb
 	if stateData.ClassID == nil {
 		text := "❌ Sessiya tugagan. Iltimos, qaytadan boshlang.\n\n" +
 			"❌ Сессия истекла. Пожалуйста, начните заново."
-		_ = botService.StateManager.Clear(telegramID)
-		keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+		_ = botService.StateManager.Clear(ctx, telegramID)
+		keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 		return botService.TelegramService.SendMessage(chatID, text, &keyboard)
 	}
 
@@ -707,7 +721,7 @@ func HandleTeacherStudentNameInput(botService *services.BotService, message *tgb
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "HTML"
 		msg.ReplyMarkup = keyboard
-		_, err := botService.Bot.Send(msg)
+		_, err := botService.TelegramService.Send(msg)
 		return err
 	}
 
@@ -722,11 +736,11 @@ func HandleTeacherStudentNameInput(botService *services.BotService, message *tgb
 		AddedByTeacherID: &teacher.ID,
 	}
 
-	log.Printf("[TEACHER ADD STUDENT] Creating student: %s %s in class %d by teacher %d", firstName, lastName, classID, teacher.ID)
+	botService.Log(telegramID).Debug("teacher creating student", "class_id", classID, "teacher_id", teacher.ID)
 
-	studentID, err := botService.StudentRepo.Create(studentReq)
+	studentID, err := botService.StudentService.CreateStudent(ctx, studentReq)
 	if err != nil {
-		log.Printf("[TEACHER ADD STUDENT ERROR] Failed to create student: %v", err)
+		botService.Log(telegramID).Error("failed to create student", "class_id", classID, "error", err)
 		text := "❌ O'quvchi qo'shishda xatolik / Ошибка при добавлении ученика"
 		// Create cancel button
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(
@@ -740,18 +754,17 @@ func HandleTeacherStudentNameInput(botService *services.BotService, message *tgb
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "HTML"
 		msg.ReplyMarkup = keyboard
-		_, sendErr := botService.Bot.Send(msg)
+		_, sendErr := botService.TelegramService.Send(msg)
 		return sendErr
 	}
 
-	log.Printf("[TEACHER ADD STUDENT] Student created successfully with ID: %d", studentID)
+	botService.Log(telegramID).Info("teacher created student", "student_id", studentID, "class_id", classID, "teacher_id", teacher.ID)
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
-	log.Printf("[TEACHER ADD STUDENT] State cleared for telegram ID: %d", telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Get class info
-	class, _ := botService.ClassRepo.GetByID(classID)
+	class, _ := botService.ClassRepo.GetByID(ctx, classID)
 	className := fmt.Sprintf("%d", classID)
 	if class != nil {
 		className = class.ClassName
@@ -797,23 +810,20 @@ func HandleTeacherStudentNameInput(botService *services.BotService, message *tgb
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	log.Printf("[TEACHER ADD STUDENT] Sending success message with student info and buttons")
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	if err != nil {
-		log.Printf("[TEACHER ADD STUDENT ERROR] Failed to send success message: %v", err)
-	} else {
-		log.Printf("[TEACHER ADD STUDENT] Success message sent successfully")
+		botService.Log(telegramID).Error("failed to send student created message", "error", err)
 	}
 	return err
 }
 
 // HandleTeacherManageStudentsBackCallback handles back button in manage students
-func HandleTeacherManageStudentsBackCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleTeacherManageStudentsBackCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -822,7 +832,7 @@ func HandleTeacherManageStudentsBackCallback(botService *services.BotService, ca
 	lang := i18n.GetLanguage(teacher.Language)
 
 	// Get all classes (teachers can access all classes)
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -854,8 +864,7 @@ func HandleTeacherManageStudentsBackCallback(botService *services.BotService, ca
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
 
 	// Delete previous message and send new one
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
@@ -863,18 +872,18 @@ func HandleTeacherManageStudentsBackCallback(botService *services.BotService, ca
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	_ = lang // for future use
 	return err
 }
 
 // HandleTeacherBackToMainCallback handles going back to teacher main menu
-func HandleTeacherBackToMainCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleTeacherBackToMainCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -883,12 +892,11 @@ func HandleTeacherBackToMainCallback(botService *services.BotService, callback *
 	lang := i18n.GetLanguage(teacher.Language)
 
 	// Delete previous message
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	// Send main menu
 	text := "👨‍🏫 Bosh menyu / Главное меню"
-	keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+	keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
@@ -898,13 +906,13 @@ func HandleTeacherBackToMainCallback(botService *services.BotService, callback *
 // HandleTeacherTakeAttendanceCommand is now in attendance.go
 
 // HandleTeacherPostAnnouncementCommand allows teacher to post announcements
-func HandleTeacherPostAnnouncementCommand(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherPostAnnouncementCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(teacher.Language)
 
 	// Get all classes (teachers can access all classes)
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка bazы danних"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -913,7 +921,7 @@ func HandleTeacherPostAnnouncementCommand(botService *services.BotService, messa
 	if len(classes) == 0 {
 		text := "📚 Hozircha sinflar yo'q. Admin sinf qo'shishi kerak.\n\n" +
 			"📚 Пока нет классов. Администратор должен добавить классы."
-		keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+		keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 		return botService.TelegramService.SendMessage(chatID, text, keyboard)
 	}
 
@@ -952,29 +960,29 @@ func HandleTeacherPostAnnouncementCommand(botService *services.BotService, messa
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
 
 	// Initialize state for multi-class selection
-	stateData := &models.StateData{
+	stateData := &models.AnnouncementData{
 		SelectedClasses: []int{}, // Empty initially
 	}
-	err = botService.StateManager.Set(telegramID, "teacher_selecting_announcement_classes", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateTeacherSelectingAnnouncementClasses, stateData)
 	if err != nil {
-		log.Printf("Failed to set state: %v", err)
+		botService.Log(telegramID).Error("failed to set state", "error", err)
 	}
 
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleTeacherMyAnnouncementsCommand shows teacher's announcements
-func HandleTeacherMyAnnouncementsCommand(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherMyAnnouncementsCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(teacher.Language)
 
 	// Get teacher's announcements
-	announcements, err := botService.AnnouncementRepo.GetByTeacherID(teacher.ID, 100, 0)
+	announcements, err := botService.AnnouncementRepo.GetByTeacherID(ctx, teacher.ID, 100, 0)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -982,7 +990,7 @@ func HandleTeacherMyAnnouncementsCommand(botService *services.BotService, messag
 
 	if len(announcements) == 0 {
 		text := "📊 Sizda hali e'lonlar yo'q.\n\n📊 У вас еще нет объявлений."
-		keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+		keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 		return botService.TelegramService.SendMessage(chatID, text, keyboard)
 	}
 
@@ -1006,6 +1014,12 @@ func HandleTeacherMyAnnouncementsCommand(botService *services.BotService, messag
 		}
 		text += fmt.Sprintf("\n%s %s", statusEmoji, statusText)
 
+		summary, err := botService.AnnouncementService.GetDeliverySummary(ctx, announcement.ID)
+		if err != nil {
+			botService.Log(message.From.ID).Warn("failed to get delivery summary", "announcement_id", announcement.ID, "error", err)
+		}
+		text += deliverySummaryText(summary)
+
 		// Create inline keyboard with edit and delete buttons
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
@@ -1019,6 +1033,9 @@ func HandleTeacherMyAnnouncementsCommand(botService *services.BotService, messag
 				),
 			),
 		)
+		if row := resendButtonRow(announcement.ID, summary); row != nil {
+			keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, row)
+		}
 
 		// Send announcement with image if available
 		if announcement.TelegramFileID != nil && *announcement.TelegramFileID != "" {
@@ -1026,23 +1043,23 @@ func HandleTeacherMyAnnouncementsCommand(botService *services.BotService, messag
 			photo.Caption = text
 			photo.ParseMode = "HTML"
 			photo.ReplyMarkup = keyboard
-			_, err = botService.Bot.Send(photo)
+			_, err = botService.TelegramService.Send(photo)
 			if err != nil {
-				log.Printf("Failed to send photo: %v", err)
+				botService.Log(message.From.ID).Error("failed to send photo", "error", err)
 				// Fallback to text only
 				msg := tgbotapi.NewMessage(chatID, text)
 				msg.ParseMode = "HTML"
 				msg.ReplyMarkup = keyboard
-				_, _ = botService.Bot.Send(msg)
+				_, _ = botService.TelegramService.Send(msg)
 			}
 		} else {
 			// Send text only
 			msg := tgbotapi.NewMessage(chatID, text)
 			msg.ParseMode = "HTML"
 			msg.ReplyMarkup = keyboard
-			_, err = botService.Bot.Send(msg)
+			_, err = botService.TelegramService.Send(msg)
 			if err != nil {
-				log.Printf("Failed to send announcement: %v", err)
+				botService.Log(message.From.ID).Error("failed to send announcement", "error", err)
 			}
 		}
 	}
@@ -1051,7 +1068,7 @@ func HandleTeacherMyAnnouncementsCommand(botService *services.BotService, messag
 }
 
 // HandleTeacherSettingsCommand shows teacher settings
-func HandleTeacherSettingsCommand(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherSettingsCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	chatID := message.Chat.ID
 	text := fmt.Sprintf(
 		"⚙️ <b>Sozlamalar / Настройки</b>\n\n"+
@@ -1066,30 +1083,30 @@ func HandleTeacherSettingsCommand(botService *services.BotService, message *tgbo
 	)
 
 	lang := i18n.GetLanguage(teacher.Language)
-	keyboard := utils.MakeTeacherMainMenuKeyboard(lang)
+	keyboard := utils.MakeTeacherMainMenuKeyboard(lang, authz.CallerFrom(ctx).Permissions)
 	return botService.TelegramService.SendMessage(chatID, text, keyboard)
 }
 
 // HandleTeacherDeleteStudentCallback handles deleting a student (teacher)
-func HandleTeacherDeleteStudentCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID, studentID int) error {
+func HandleTeacherDeleteStudentCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID, studentID int) error {
 	telegramID := callback.From.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
 	}
 
 	// Get student info before deleting
-	student, err := botService.StudentRepo.GetByID(studentID)
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil || student == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ O'quvchi topilmadi / Ученик не найден")
 		return nil
 	}
 
 	// Delete the student
-	err = botService.StudentRepo.Delete(studentID)
+	err = botService.StudentService.DeleteStudent(ctx, studentID)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik yuz berdi / Произошла ошибка")
 		return nil
@@ -1099,5 +1116,5 @@ func HandleTeacherDeleteStudentCallback(botService *services.BotService, callbac
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, fmt.Sprintf("✅ %s %s o'chirildi", student.LastName, student.FirstName))
 
 	// Refresh the class view
-	return HandleTeacherManageClassCallback(botService, callback, classID)
+	return HandleTeacherManageClassCallback(ctx, botService, callback, classID)
 }
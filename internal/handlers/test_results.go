@@ -1,8 +1,8 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -13,15 +13,15 @@ import (
 )
 
 // HandleTeacherEnterGradesCommand allows teacher to enter test results
-func HandleTeacherEnterGradesCommand(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherEnterGradesCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	chatID := message.Chat.ID
 	telegramID := message.From.ID
 
 	// Clear any existing state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Get all classes (teachers can access all classes)
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -60,12 +60,12 @@ func HandleTeacherEnterGradesCommand(botService *services.BotService, message *t
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleTestResultInfo processes test result input from teacher/admin
-func HandleTestResultInfo(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleTestResultInfo(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
@@ -90,7 +90,7 @@ func HandleTestResultInfo(botService *services.BotService, message *tgbotapi.Mes
 	}
 
 	// Verify student exists
-	student, err := botService.StudentRepo.GetByID(studentID)
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil || student == nil {
 		text := "❌ O'quvchi topilmadi / Ученик не найден"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -105,7 +105,7 @@ func HandleTestResultInfo(botService *services.BotService, message *tgbotapi.Mes
 	}
 
 	// Check if user is teacher or admin
-	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	var adminID *int
 	var teacherID *int
 
@@ -113,7 +113,7 @@ func HandleTestResultInfo(botService *services.BotService, message *tgbotapi.Mes
 		teacherID = &teacher.ID
 	} else {
 		// Check if admin
-		admin, err := botService.AdminRepo.GetByTelegramID(telegramID)
+		admin, err := botService.AdminRepo.GetByTelegramID(ctx, telegramID)
 		if err != nil || admin == nil {
 			text := "❌ Ruxsat yo'q / Нет разрешения"
 			return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -131,18 +131,18 @@ func HandleTestResultInfo(botService *services.BotService, message *tgbotapi.Mes
 		AdminID:     adminID,
 	}
 
-	resultID, err := botService.TestResultService.CreateTestResult(req)
+	resultID, err := botService.TestResultService.CreateTestResult(ctx, req)
 	if err != nil {
-		log.Printf("Failed to create test result: %v", err)
+		botService.Log(telegramID).Error("failed to create test result", "error", err)
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Get class name
-	class, _ := botService.ClassRepo.GetByID(student.ClassID)
+	class, _ := botService.ClassRepo.GetByID(ctx, student.ClassID)
 	className := fmt.Sprintf("%d", student.ClassID)
 	if class != nil {
 		className = class.ClassName
@@ -169,31 +169,18 @@ func HandleTestResultInfo(botService *services.BotService, message *tgbotapi.Mes
 	)
 
 	// Send to parent if they have telegram
-	go notifyParentAboutGrade(botService, student.ID, subjectName, score, testDate)
+	notifyParentAboutGrade(ctx, botService, student.ID, subjectName, score, testDate)
 
 	return botService.TelegramService.SendMessage(chatID, text, nil)
 }
 
 // HandleViewChildGradesCallback handles viewing a specific child's grades
-func HandleViewChildGradesCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleViewChildGradesCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
-	// Extract student ID from callback data (format: "view_child_grades_123")
-	parts := strings.Split(callback.Data, "_")
-	if len(parts) != 4 {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
-	studentID, err := strconv.Atoi(parts[3])
-	if err != nil {
-		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
-		return nil
-	}
-
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -204,7 +191,7 @@ func HandleViewChildGradesCallback(botService *services.BotService, callback *tg
 	}
 
 	// Verify student belongs to this parent
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -224,9 +211,9 @@ func HandleViewChildGradesCallback(botService *services.BotService, callback *tg
 	}
 
 	// Get test results
-	results, err := botService.TestResultService.GetTestResultsByStudentID(studentID, 50, 0)
+	results, err := botService.TestResultService.GetTestResultsByStudentID(ctx, studentID, 50, 0)
 	if err != nil {
-		log.Printf("Failed to get test results: %v", err)
+		botService.Log(telegramID).Error("failed to get test results", "error", err)
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -264,11 +251,11 @@ func HandleViewChildGradesCallback(botService *services.BotService, callback *tg
 }
 
 // HandleTeacherViewClassGradesCommand allows teacher to view class test results
-func HandleTeacherViewClassGradesCommand(botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
+func HandleTeacherViewClassGradesCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, teacher *models.Teacher) error {
 	chatID := message.Chat.ID
 
 	// Get all classes (teachers can access all classes)
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка bazы danных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -299,16 +286,16 @@ func HandleTeacherViewClassGradesCommand(botService *services.BotService, messag
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleViewClassGradesCallback handles class selection for viewing grades
-func HandleViewClassGradesCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleViewClassGradesCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	chatID := callback.Message.Chat.ID
 
 	// Get test results for class
-	results, err := botService.TestResultService.GetTestResultsByClassID(classID, 50, 0)
+	results, err := botService.TestResultService.GetTestResultsByClassID(ctx, classID, 50, 0)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -321,7 +308,7 @@ func HandleViewClassGradesCallback(botService *services.BotService, callback *tg
 	}
 
 	// Check if user is teacher to show edit buttons
-	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(callback.From.ID)
+	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(ctx, callback.From.ID)
 	isTeacher := teacher != nil
 
 	// Format results
@@ -372,21 +359,26 @@ func HandleViewClassGradesCallback(botService *services.BotService, callback *tg
 	return botService.TelegramService.SendMessage(chatID, text, nil)
 }
 
-// notifyParentAboutGrade sends notification to parent about new grade
-func notifyParentAboutGrade(botService *services.BotService, studentID int, subject, score, date string) {
+// notifyParentAboutGrade queues a notification to the student's parents about a new grade
+func notifyParentAboutGrade(ctx context.Context, botService *services.BotService, studentID int, subject, score, date string) {
+	if !botService.Settings().Notifications.ParentGradeAlerts {
+		return
+	}
+
 	// Get parents linked to this student
-	parents, err := botService.StudentRepo.GetStudentParents(studentID)
+	parents, err := botService.StudentRepo.GetStudentParents(ctx, studentID)
 	if err != nil {
-		log.Printf("Failed to get parents for notification: %v", err)
+		botService.Logger.Error("failed to get parents for grade notification", "student_id", studentID, "error", err)
 		return
 	}
 
 	// Get student info
-	student, err := botService.StudentRepo.GetByID(studentID)
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil {
 		return
 	}
 
+	var notifications []*models.Notification
 	for _, parent := range parents {
 		if parent.TelegramID == 0 {
 			continue
@@ -411,17 +403,25 @@ func notifyParentAboutGrade(botService *services.BotService, studentID int, subj
 				student.FirstName, student.LastName, subject, score, date)
 		}
 
-		_ = botService.TelegramService.SendMessage(parent.TelegramID, text, nil)
+		notifications = append(notifications, &models.Notification{
+			ChatID: parent.TelegramID,
+			Kind:   models.NotificationGrade,
+			Text:   text,
+		})
+	}
+
+	if err := botService.Outbox.Enqueue(ctx, notifications...); err != nil {
+		botService.Logger.Error("failed to queue grade notification", "student_id", studentID, "error", err)
 	}
 }
 
 // HandleEditGradeCommand handles the /edit_grade command for teachers
-func HandleEditGradeCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleEditGradeCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	chatID := message.Chat.ID
 	telegramID := message.From.ID
 
 	// Check if user is teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		text := "❌ Faqat o'qituvchilar baholarni o'zgartira oladi.\n\n" +
 			"❌ Только учителя могут изменять оценки."
@@ -449,7 +449,7 @@ func HandleEditGradeCommand(botService *services.BotService, message *tgbotapi.M
 	newScore := parts[2]
 
 	// Get test result
-	testResult, err := botService.TestResultService.GetTestResultByID(testResultID)
+	testResult, err := botService.TestResultService.GetTestResultByID(ctx, testResultID)
 	if err != nil || testResult == nil {
 		text := "❌ Baho topilmadi / Оценка не найдена"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -459,9 +459,9 @@ func HandleEditGradeCommand(botService *services.BotService, message *tgbotapi.M
 	updateReq := &models.UpdateTestResultRequest{
 		Score: newScore,
 	}
-	err = botService.TestResultService.UpdateTestResult(testResultID, updateReq)
+	err = botService.TestResultService.UpdateTestResult(ctx, testResultID, updateReq)
 	if err != nil {
-		log.Printf("Failed to update test result: %v", err)
+		botService.Log(telegramID).Error("failed to update test result", "error", err)
 		text := "❌ Bahoni yangilashda xatolik / Ошибка при обновлении оценки"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -478,12 +478,12 @@ func HandleEditGradeCommand(botService *services.BotService, message *tgbotapi.M
 }
 
 // HandleDeleteGradeCommand handles the /delete_grade command for teachers
-func HandleDeleteGradeCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleDeleteGradeCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	chatID := message.Chat.ID
 	telegramID := message.From.ID
 
 	// Check if user is teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		text := "❌ Faqat o'qituvchilar baholarni o'chira oladi.\n\n" +
 			"❌ Только учителя могут удалять оценки."
@@ -509,16 +509,16 @@ func HandleDeleteGradeCommand(botService *services.BotService, message *tgbotapi
 	}
 
 	// Get test result to show what's being deleted
-	testResult, err := botService.TestResultService.GetTestResultByID(testResultID)
+	testResult, err := botService.TestResultService.GetTestResultByID(ctx, testResultID)
 	if err != nil || testResult == nil {
 		text := "❌ Baho topilmadi / Оценка не найдена"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Delete the test result
-	err = botService.TestResultService.DeleteTestResult(testResultID)
+	err = botService.TestResultService.DeleteTestResult(ctx, testResultID)
 	if err != nil {
-		log.Printf("Failed to delete test result: %v", err)
+		botService.Log(telegramID).Error("failed to delete test result", "error", err)
 		text := "❌ Bahoni o'chirishda xatolik / Ошибка при удалении оценки"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
@@ -534,26 +534,26 @@ func HandleDeleteGradeCommand(botService *services.BotService, message *tgbotapi
 }
 
 // HandleTestResultClassSelectionCallback handles class selection for adding test results
-func HandleTestResultClassSelectionCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleTestResultClassSelectionCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
 	}
 
 	// Get class info
-	class, err := botService.ClassRepo.GetByID(classID)
+	class, err := botService.ClassRepo.GetByID(ctx, classID)
 	if err != nil || class == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Sinf topilmadi")
 		return nil
 	}
 
 	// Get students in this class
-	students, err := botService.StudentRepo.GetByClassID(classID)
+	students, err := botService.StudentRepo.GetByClassID(ctx, classID)
 	if err != nil {
 		text := "❌ Ma'lumotlar bazasida xatolik / Ошибка базы данных"
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
@@ -593,8 +593,7 @@ func HandleTestResultClassSelectionCallback(botService *services.BotService, cal
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
 
 	// Delete previous message and send new one
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
@@ -602,43 +601,43 @@ func HandleTestResultClassSelectionCallback(botService *services.BotService, cal
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleTestResultAddStudentCallback handles student selection for adding test results
-func HandleTestResultAddStudentCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
+func HandleTestResultAddStudentCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
 	}
 
 	// Get student info
-	student, err := botService.StudentRepo.GetByID(studentID)
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil || student == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ O'quvchi topilmadi")
 		return nil
 	}
 
 	// Get class info
-	class, err := botService.ClassRepo.GetByID(student.ClassID)
+	class, err := botService.ClassRepo.GetByID(ctx, student.ClassID)
 	if err != nil || class == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Sinf topilmadi")
 		return nil
 	}
 
 	// Set state with student ID
-	stateData := &models.StateData{
+	stateData := &models.TestResultData{
 		SelectedStudentID: &studentID,
 	}
-	err = botService.StateManager.Set(telegramID, "teacher_awaiting_test_results_text", stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateTeacherAwaitingTestResultsText, stateData)
 	if err != nil {
-		log.Printf("Failed to set state: %v", err)
+		botService.Log(telegramID).Error("failed to set state", "error", err)
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
 	}
@@ -671,8 +670,7 @@ func HandleTestResultAddStudentCallback(botService *services.BotService, callbac
 	)
 
 	// Delete previous message
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(chatID, callback.Message.MessageID)
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
@@ -680,17 +678,17 @@ func HandleTestResultAddStudentCallback(botService *services.BotService, callbac
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
 // HandleTeacherTestResultsTextInput handles free-form test results text input
-func HandleTeacherTestResultsTextInput(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleTeacherTestResultsTextInput(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.TestResultData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		text := "❌ Xatolik / Ошибка"
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -700,17 +698,17 @@ func HandleTeacherTestResultsTextInput(botService *services.BotService, message
 	if stateData.SelectedStudentID == nil {
 		text := "❌ Sessiya tugagan. Iltimos, qaytadan boshlang.\n\n" +
 			"❌ Сессия истекла. Пожалуйста, начните заново."
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	studentID := *stateData.SelectedStudentID
 
 	// Get student info
-	student, err := botService.StudentRepo.GetByID(studentID)
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil || student == nil {
 		text := "❌ O'quvchi topilmadi / Ученик не найден"
-		_ = botService.StateManager.Clear(telegramID)
+		_ = botService.StateManager.Clear(ctx, telegramID)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
@@ -728,7 +726,7 @@ func HandleTeacherTestResultsTextInput(botService *services.BotService, message
 	}
 
 	// Get today's date for test results
-	today := time.Now().Format("2006-01-02")
+	today := time.Now().In(botService.Location).Format("2006-01-02")
 
 	// Create test results for each subject
 	var createdResults []struct {
@@ -747,9 +745,9 @@ func HandleTeacherTestResultsTextInput(botService *services.BotService, message
 			AdminID:     nil,
 		}
 
-		resultID, err := botService.TestResultService.CreateTestResult(req)
+		resultID, err := botService.TestResultService.CreateTestResult(ctx, req)
 		if err != nil {
-			log.Printf("Failed to create test result for %s: %v", subject, err)
+			botService.Log(telegramID).Error("failed to create test result", "subject", subject, "error", err)
 			continue
 		}
 
@@ -760,11 +758,11 @@ func HandleTeacherTestResultsTextInput(botService *services.BotService, message
 		}{Subject: subject, Score: score, ID: resultID})
 
 		// Notify parent about each grade
-		go notifyParentAboutGrade(botService, studentID, subject, score, today)
+		notifyParentAboutGrade(ctx, botService, studentID, subject, score, today)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	if len(createdResults) == 0 {
 		text := "❌ Baholarni kiritishda xatolik yuz berdi.\n\n" +
@@ -773,7 +771,7 @@ func HandleTeacherTestResultsTextInput(botService *services.BotService, message
 	}
 
 	// Get class info
-	class, _ := botService.ClassRepo.GetByID(student.ClassID)
+	class, _ := botService.ClassRepo.GetByID(ctx, student.ClassID)
 	className := fmt.Sprintf("%d", student.ClassID)
 	if class != nil {
 		className = class.ClassName
@@ -822,7 +820,7 @@ func HandleTeacherTestResultsTextInput(botService *services.BotService, message
 	msg.ParseMode = "HTML"
 	msg.ReplyMarkup = keyboard
 
-	_, err = botService.Bot.Send(msg)
+	_, err = botService.TelegramService.Send(msg)
 	return err
 }
 
@@ -865,14 +863,14 @@ func parseTestResultsText(text string) map[string]string {
 }
 
 // HandleTestResultBackToClassesCallback handles back button to classes list
-func HandleTestResultBackToClassesCallback(botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
+func HandleTestResultBackToClassesCallback(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery) error {
 	telegramID := callback.From.ID
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Get teacher
-	teacher, err := botService.TeacherService.GetTeacherByTelegramID(telegramID)
+	teacher, err := botService.TeacherService.GetTeacherByTelegramID(ctx, telegramID)
 	if err != nil || teacher == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -887,10 +885,9 @@ func HandleTestResultBackToClassesCallback(botService *services.BotService, call
 	}
 
 	// Delete previous message
-	deleteMsg := tgbotapi.NewDeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID)
-	_, _ = botService.Bot.Request(deleteMsg)
+	_ = botService.TelegramService.DeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID)
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
-	return HandleTeacherEnterGradesCommand(botService, fakeMessage, teacher)
+	return HandleTeacherEnterGradesCommand(ctx, botService, fakeMessage, teacher)
 }
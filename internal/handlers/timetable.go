@@ -1,8 +1,8 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"log"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"parent-bot/internal/i18n"
@@ -11,12 +11,12 @@ import (
 )
 
 // HandleViewTimetableCommand shows timetable for user's class
-func HandleViewTimetableCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleViewTimetableCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
@@ -30,7 +30,7 @@ func HandleViewTimetableCommand(botService *services.BotService, message *tgbota
 	lang := i18n.GetLanguage(user.Language)
 
 	// Get parent's children
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		return err
 	}
@@ -62,31 +62,31 @@ func HandleViewTimetableCommand(botService *services.BotService, message *tgbota
 		msg.ParseMode = "HTML"
 		msg.ReplyMarkup = keyboard
 
-		_, err = botService.Bot.Send(msg)
+		_, err = botService.TelegramService.Send(msg)
 		return err
 	}
 
 	// Single child - show timetable directly
-	return showTimetableForStudent(botService, chatID, children[0].StudentID, lang)
+	return showTimetableForStudent(ctx, botService, chatID, children[0].StudentID, lang)
 }
 
 // showTimetableForStudent displays timetable for a specific student
-func showTimetableForStudent(botService *services.BotService, chatID int64, studentID int, lang i18n.Language) error {
-	student, err := botService.StudentRepo.GetByID(studentID)
+func showTimetableForStudent(ctx context.Context, botService *services.BotService, chatID int64, studentID int, lang i18n.Language) error {
+	student, err := botService.StudentRepo.GetByID(ctx, studentID)
 	if err != nil || student == nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get class information
-	class, err := botService.ClassRepo.GetByID(student.ClassID)
+	class, err := botService.ClassRepo.GetByID(ctx, student.ClassID)
 	if err != nil || class == nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Get timetable for student's class
-	timetable, err := botService.TimetableService.GetTimetableByClassName(class.ClassName)
+	timetable, err := botService.TimetableService.GetTimetableByClassName(ctx, class.ClassName)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -104,12 +104,12 @@ func showTimetableForStudent(botService *services.BotService, chatID int64, stud
 }
 
 // HandleTimetableChildSelection handles child selection for timetable view
-func HandleTimetableChildSelection(botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
+func HandleTimetableChildSelection(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, studentID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil || user == nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -118,7 +118,7 @@ func HandleTimetableChildSelection(botService *services.BotService, callback *tg
 	lang := i18n.GetLanguage(user.Language)
 
 	// Verify student belongs to this parent
-	children, err := botService.StudentRepo.GetParentStudents(user.ID)
+	children, err := botService.StudentRepo.GetParentStudents(ctx, user.ID)
 	if err != nil {
 		_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "❌ Xatolik / Ошибка")
 		return nil
@@ -139,32 +139,20 @@ func HandleTimetableChildSelection(botService *services.BotService, callback *tg
 
 	_ = botService.TelegramService.AnswerCallbackQuery(callback.ID, "")
 
-	return showTimetableForStudent(botService, chatID, studentID, lang)
+	return showTimetableForStudent(ctx, botService, chatID, studentID, lang)
 }
 
 // HandleUploadTimetableCommand initiates timetable upload (admin only)
-func HandleUploadTimetableCommand(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleUploadTimetableCommand(ctx context.Context, botService *services.BotService, message *tgbotapi.Message) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 
 	// Get user (may be nil for admin-only accounts)
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	// Check if user is admin (works with or without user registration)
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil || !isAdmin {
-		text := "❌ Bu buyruq faqat ma'murlar uchun / Эта команда только для администраторов"
-		return botService.TelegramService.SendMessage(chatID, text, nil)
-	}
-
 	// Determine language
 	lang := i18n.LanguageUzbek
 	if user != nil {
@@ -172,7 +160,7 @@ func HandleUploadTimetableCommand(botService *services.BotService, message *tgbo
 	}
 
 	// Get all classes
-	classes, err := botService.ClassRepo.GetAll()
+	classes, err := botService.ClassRepo.GetAll(ctx)
 	if err != nil {
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
@@ -200,27 +188,16 @@ func HandleUploadTimetableCommand(botService *services.BotService, message *tgbo
 }
 
 // HandleTimetableClassSelection handles class selection for timetable upload
-func HandleTimetableClassSelection(botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
+func HandleTimetableClassSelection(ctx context.Context, botService *services.BotService, callback *tgbotapi.CallbackQuery, classID int) error {
 	telegramID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 
 	// Get user (may be nil for admin-only accounts)
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
 		return err
 	}
 
-	// Check if user is admin (works with or without user registration)
-	phoneNumber := ""
-	if user != nil {
-		phoneNumber = user.PhoneNumber
-	}
-
-	isAdmin, err := botService.IsAdmin(phoneNumber, telegramID)
-	if err != nil || !isAdmin {
-		return botService.TelegramService.AnswerCallbackQuery(callback.ID, "Access denied")
-	}
-
 	// Determine language
 	lang := i18n.LanguageUzbek
 	langStr := "uz"
@@ -230,11 +207,11 @@ func HandleTimetableClassSelection(botService *services.BotService, callback *tg
 	}
 
 	// Save class ID in state
-	stateData := &models.StateData{
+	stateData := &models.TimetableData{
 		Language: langStr,
 		ClassID:  &classID,
 	}
-	err = botService.StateManager.Set(telegramID, models.StateAwaitingTimetableFile, stateData)
+	err = botService.StateManager.Set(ctx, telegramID, models.StateAwaitingTimetableFile, stateData)
 	if err != nil {
 		return err
 	}
@@ -248,7 +225,7 @@ func HandleTimetableClassSelection(botService *services.BotService, callback *tg
 }
 
 // HandleTimetableFileUpload handles timetable file upload
-func HandleTimetableFileUpload(botService *services.BotService, message *tgbotapi.Message, stateData *models.StateData) error {
+func HandleTimetableFileUpload(ctx context.Context, botService *services.BotService, message *tgbotapi.Message, stateData *models.TimetableData) error {
 	telegramID := message.From.ID
 	chatID := message.Chat.ID
 	lang := i18n.GetLanguage(stateData.Language)
@@ -275,9 +252,9 @@ func HandleTimetableFileUpload(botService *services.BotService, message *tgbotap
 	}
 
 	// Get admin record
-	admin, err := botService.AdminRepo.GetByTelegramID(telegramID)
+	admin, err := botService.AdminRepo.GetByTelegramID(ctx, telegramID)
 	if err != nil {
-		log.Printf("Failed to get admin: %v", err)
+		botService.Log(telegramID).Error("failed to get admin", "error", err)
 	}
 
 	var adminID *int
@@ -295,15 +272,15 @@ func HandleTimetableFileUpload(botService *services.BotService, message *tgbotap
 		UploadedByAdminID: adminID,
 	}
 
-	_, err = botService.TimetableService.CreateTimetable(timetableReq)
+	_, err = botService.TimetableService.CreateTimetable(ctx, timetableReq)
 	if err != nil {
-		log.Printf("Failed to save timetable: %v", err)
+		botService.Log(telegramID).Error("failed to save timetable", "error", err)
 		text := i18n.Get(i18n.ErrDatabaseError, lang)
 		return botService.TelegramService.SendMessage(chatID, text, nil)
 	}
 
 	// Clear state
-	_ = botService.StateManager.Clear(telegramID)
+	_ = botService.StateManager.Clear(ctx, telegramID)
 
 	// Send success message
 	text := i18n.Get(i18n.MsgTimetableUploaded, lang)
@@ -1,40 +1,178 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	"errors"
+	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
 	"parent-bot/internal/i18n"
+	"parent-bot/internal/metrics"
+	"parent-bot/internal/models"
 	"parent-bot/internal/services"
+	"parent-bot/internal/state"
 )
 
-// HandleUpdate is the main update handler that routes all Telegram updates
-func HandleUpdate(botService *services.BotService, update tgbotapi.Update) {
-	// Handle callback queries (inline button clicks)
-	if update.CallbackQuery != nil {
-		if err := HandleCallbackQuery(botService, update.CallbackQuery); err != nil {
-			log.Printf("Error handling callback query: %v", err)
-		}
+// HandleUpdate is the main update handler that routes all Telegram updates.
+// Every database call made for the update shares one deadline.
+func HandleUpdate(ctx context.Context, botService *services.BotService, update tgbotapi.Update) {
+	from := update.SentFrom()
+	if from == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, botService.Config.Updates.HandlerTimeout)
+	defer cancel()
+
+	logger := botService.Logger.With("update_id", update.UpdateID, "telegram_id", from.ID)
+	kind, handler := updateType(update), handlerName(botService, update)
+
+	// Drop updates from users who exceed their rate limit before touching
+	// the database for them
+	if !allowUpdate(botService, logger.With("handler", handler), update) {
+		metrics.UpdatesTotal.WithLabelValues(kind, handler, "throttled").Inc()
+		return
+	}
+
+	// Resolve who is calling once; every handler below authorizes against it
+	caller, err := botService.Policy.Resolve(ctx, from.ID)
+	if err != nil {
+		logger.Error("failed to resolve caller", "error", err)
+		return
+	}
+
+	// Limit the caller's next updates by the role they have now
+	botService.RateLimiter.SetRole(from.ID, rateLimitRole(caller))
+
+	// Changes made while handling the update are audited as the caller's, and
+	// menus are built from the caller's permissions
+	ctx = services.WithActor(ctx, actorOf(from, caller))
+	ctx = authz.WithCaller(ctx, caller)
+
+	// Keep the state this update reads, so writes can be checked against it
+	botService.StateManager.Begin(from.ID)
+	defer botService.StateManager.End(from.ID)
+
+	current, _ := botService.StateManager.GetState(ctx, from.ID)
+	logger = logger.With(
+		"role", caller.Roles(),
+		"state", current,
+		"handler", handler,
+	)
+
+	// Handlers find this logger through botService.Log(telegramID)
+	botService.UpdateLoggers.Begin(from.ID, logger)
+	defer botService.UpdateLoggers.End(from.ID)
+
+	start := time.Now()
+
+	switch {
+	case update.CallbackQuery != nil:
+		// Inline button clicks
+		err = HandleCallbackQuery(ctx, botService, caller, update.CallbackQuery)
+	case update.Message != nil:
+		err = HandleMessage(ctx, botService, caller, update.Message)
+	case update.EditedMessage != nil:
+		metrics.UpdatesTotal.WithLabelValues(kind, handler, "ignored").Inc()
+		logger.Debug("ignoring edited message")
+		return
+	default:
 		return
 	}
 
-	// Handle messages
-	if update.Message != nil {
-		if err := HandleMessage(botService, update.Message); err != nil {
-			log.Printf("Error handling message: %v", err)
+	duration := time.Since(start)
+	metrics.HandlerDuration.WithLabelValues(kind, handler).Observe(duration.Seconds())
+
+	if errors.Is(err, state.ErrConflict) {
+		// Another update or bot instance changed the user's state meanwhile
+		metrics.UpdatesTotal.WithLabelValues(kind, handler, "conflict").Inc()
+		logger.Warn("state changed while handling update", "error", err, "duration", duration)
+		if chat := update.FromChat(); chat != nil {
+			_ = botService.TelegramService.SendMessage(chat.ID, i18n.Get(i18n.ErrStateConflict, caller.Language), nil)
 		}
 		return
 	}
 
-	// Handle edited messages (optional)
-	if update.EditedMessage != nil {
-		log.Printf("Received edited message from %d", update.EditedMessage.From.ID)
+	if err != nil {
+		metrics.UpdatesTotal.WithLabelValues(kind, handler, "error").Inc()
+		logger.Error("update failed", "error", err, "duration", duration)
 		return
 	}
+
+	metrics.UpdatesTotal.WithLabelValues(kind, handler, "ok").Inc()
+	logger.Debug("update handled", "duration", duration)
+}
+
+// actorOf describes the caller for the audit log: by name for teachers, by
+// phone for registered users and by Telegram name otherwise
+func actorOf(from *tgbotapi.User, caller *authz.Caller) services.Actor {
+	name := strings.TrimSpace(from.FirstName + " " + from.LastName)
+	switch {
+	case caller.Teacher != nil:
+		name = caller.Teacher.LastName + " " + caller.Teacher.FirstName
+	case caller.User != nil:
+		name = caller.User.PhoneNumber
+	}
+
+	return services.Actor{
+		TelegramID: from.ID,
+		Name:       name,
+		Role:       caller.Roles(),
+		Source:     models.AuditSourceBot,
+	}
+}
+
+// updateType names the kind of update, for metrics
+func updateType(update tgbotapi.Update) string {
+	switch {
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.Message != nil:
+		return "message"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	default:
+		return "other"
+	}
+}
+
+// handlerName names the handler an update is routed to, for logs and metric
+// labels. Commands the bot does not have share one name, so made-up commands
+// can't create new metric series.
+func handlerName(botService *services.BotService, update tgbotapi.Update) string {
+	if q := update.CallbackQuery; q != nil {
+		if route := botService.CallbackRouter.Route(q.Data); route != "" {
+			return "callback:" + route
+		}
+		return "callback:unknown"
+	}
+
+	message := update.Message
+	if message == nil {
+		return "other"
+	}
+
+	switch {
+	case message.IsCommand():
+		if _, ok := commands[message.Command()]; ok {
+			return "/" + message.Command()
+		}
+		return "/unknown"
+	case message.Contact != nil:
+		return "message:contact"
+	case message.Document != nil:
+		return "message:document"
+	case message.Photo != nil:
+		return "message:photo"
+	default:
+		return "message:text"
+	}
 }
 
 // HandleMessage routes messages based on type and user state
-func HandleMessage(botService *services.BotService, message *tgbotapi.Message) error {
+func HandleMessage(ctx context.Context, botService *services.BotService, caller *authz.Caller, message *tgbotapi.Message) error {
 	// Ignore messages from bots
 	if message.From.IsBot {
 		return nil
@@ -44,24 +182,23 @@ func HandleMessage(botService *services.BotService, message *tgbotapi.Message) e
 
 	// Handle commands first
 	if message.IsCommand() {
-		return HandleCommand(botService, message)
+		return HandleCommand(ctx, botService, caller, message)
 	}
 
 	// Check for critical button presses that should override state (like admin panel)
 	buttonText := message.Text
 	if buttonText == "👨‍💼 Ma'muriyat paneli" || buttonText == "👨‍💼 Панель администратора" {
-		_ = botService.StateManager.Clear(telegramID)
-		return HandleAdminCommand(botService, message)
+		_ = botService.StateManager.Clear(ctx, telegramID)
+		return HandleAdminCommand(ctx, botService, message)
 	}
 
 	// ============================================
 	// TEACHER CHECK - Teachers get their own flow
 	// ============================================
-	teacher, _ := botService.TeacherService.GetTeacherByTelegramID(telegramID)
-	if teacher != nil {
+	if caller.Teacher != nil {
 		// Found a teacher - ALWAYS use teacher flow, regardless of IsActive
 		// HandleTeacherMessage will handle everything internally
-		return HandleTeacherMessage(botService, message, teacher)
+		return HandleTeacherMessage(ctx, botService, message, caller.Teacher)
 	}
 
 	// ============================================
@@ -69,36 +206,41 @@ func HandleMessage(botService *services.BotService, message *tgbotapi.Message) e
 	// ============================================
 
 	// Check if user is registered as parent FIRST
-	user, err := botService.UserService.GetUserByTelegramID(telegramID)
+	user, err := botService.UserService.GetUserByTelegramID(ctx, telegramID)
 	if err != nil {
-		log.Printf("[WEBHOOK] Error getting user for %d: %v", telegramID, err)
+		botService.Log(telegramID).Error("failed to get user", "error", err)
 	}
 
 	// IMPORTANT: Check for parent menu button presses FIRST - these should override any active state
 	if user != nil && isParentMenuButton(buttonText) {
 		// Clear any existing state when pressing menu buttons
-		_ = botService.StateManager.Clear(telegramID)
-		return HandleRegisteredUserMessage(botService, message, user)
+		_ = botService.StateManager.Clear(ctx, telegramID)
+		return HandleRegisteredUserMessage(ctx, botService, message, user)
 	}
 
 	// Check if user has an active state (registration/complaint/etc.)
-	state, _ := botService.StateManager.Get(telegramID)
-	if state != nil && state.State != "" {
-		stateData, err := botService.StateManager.GetData(telegramID)
+	current, _ := botService.StateManager.Get(ctx, telegramID)
+	if current != nil && current.State != "" {
+		// A flow left unfinished too long must not capture this message
+		if current.Expired(time.Now()) {
+			return HandleExpiredFlow(ctx, botService, message, current, user)
+		}
+
+		data, err := botService.StateManager.Data(current)
 		if err != nil {
-			log.Printf("[WEBHOOK] Error getting state data for %d: %v", telegramID, err)
-			_ = botService.StateManager.Clear(telegramID)
+			botService.Log(telegramID).Error("failed to get state data, clearing state", "error", err)
+			_ = botService.StateManager.Clear(ctx, telegramID)
 		} else {
-			return RouteByState(botService, message, state.State, stateData)
+			return RouteByState(ctx, botService, message, current.State, data)
 		}
 	}
 
 	if user != nil {
-		return HandleRegisteredUserMessage(botService, message, user)
+		return HandleRegisteredUserMessage(ctx, botService, message, user)
 	}
 
 	// New user - start registration
-	return HandleStart(botService, message)
+	return HandleStart(ctx, botService, message)
 }
 
 // isParentMenuButton checks if the button text is one of the parent main menu buttons
@@ -129,61 +271,78 @@ func isParentMenuButton(buttonText string) bool {
 	return false
 }
 
-// HandleCommand handles bot commands
-func HandleCommand(botService *services.BotService, message *tgbotapi.Message) error {
-	switch message.Command() {
-	case "start":
-		return HandleStart(botService, message)
-	case "help":
-		return HandleHelp(botService, message)
-	case "cancel":
-		return HandleCancelCommand(botService, message)
-	case "complaint":
-		return HandleComplaintCommand(botService, message)
-	case "proposal":
-		return HandleProposalCommand(botService, message)
-	case "my_proposals":
-		return HandleMyProposalsCommand(botService, message)
-	case "timetable":
-		return HandleViewTimetableCommand(botService, message)
-	case "announcements":
-		return HandleViewAnnouncementsCommand(botService, message)
-	case "admin":
-		return HandleAdminCommand(botService, message)
-	case "admin_link":
-		return HandleAdminLinkCommand(botService, message)
-	case "manage_classes":
-		return HandleManageClassesCommand(botService, message)
-	case "add_class":
-		return HandleAddClassCommand(botService, message)
-	case "delete_class":
-		return HandleDeleteClassCommand(botService, message)
-	case "toggle_class":
-		return HandleToggleClassCommand(botService, message)
-	case "upload_timetable":
-		return HandleUploadTimetableCommand(botService, message)
-	case "post_announcement":
-		return HandlePostAnnouncementCommand(botService, message)
-	case "add_student":
-		return HandleAddStudentCommand(botService, message)
-	case "link_student":
-		return HandleLinkStudentCommand(botService, message)
-	case "list_students":
-		return HandleListStudentsCommand(botService, message)
-	case "view_parent_children":
-		return HandleViewParentChildrenCommand(botService, message)
-	case "my_children":
-		return HandleMyChildrenCommand(botService, message)
-	case "add_teacher":
-		return HandleAddTeacherCommand(botService, message)
-	case "list_teachers":
-		return HandleListTeachersCommand(botService, message)
-	case "edit_grade":
-		return HandleEditGradeCommand(botService, message)
-	case "delete_grade":
-		return HandleDeleteGradeCommand(botService, message)
-	default:
+// command is a bot command handler and the rule its caller must pass
+type command struct {
+	rule    authz.Rule
+	handler func(context.Context, *services.BotService, *tgbotapi.Message) error
+}
+
+// Rules shared by commands and callbacks
+var (
+	// The class list leads to both class and student management
+	manageClasses = authz.AnyOf(authz.Can(models.PermClassesManage), authz.Can(models.PermStudentsManage))
+
+	// Teachers edit the grades of their own classes' students
+	editGrades = authz.AllOf(authz.Teacher, authz.Can(models.PermGradesEdit))
+
+	// Teachers post announcements to their own classes
+	postClassAnnouncements = authz.AllOf(authz.Teacher, authz.Can(models.PermClassAnnouncementsPost))
+)
+
+// commands declares every bot command. Unknown commands fall back to /start.
+var commands = map[string]command{
+	"start":                {authz.Anyone, HandleStart},
+	"help":                 {authz.Anyone, HandleHelp},
+	"cancel":               {authz.Anyone, HandleCancelCommand},
+	"complaint":            {authz.Parent, HandleComplaintCommand},
+	"proposal":             {authz.Parent, HandleProposalCommand},
+	"my_proposals":         {authz.Parent, HandleMyProposalsCommand},
+	"my_children":          {authz.Parent, HandleMyChildrenCommand},
+	"timetable":            {authz.Anyone, HandleViewTimetableCommand},
+	"announcements":        {authz.Anyone, HandleViewAnnouncementsCommand},
+	"admin":                {authz.Staff, HandleAdminCommand},
+	"admin_link":           {authz.Anyone, HandleAdminLinkCommand},
+	"manage_classes":       {manageClasses, HandleManageClassesCommand},
+	"add_class":            {authz.Can(models.PermClassesManage), HandleAddClassCommand},
+	"delete_class":         {authz.Can(models.PermClassesManage), HandleDeleteClassCommand},
+	"toggle_class":         {authz.Can(models.PermClassesManage), HandleToggleClassCommand},
+	"upload_timetable":     {authz.Can(models.PermTimetablesManage), HandleUploadTimetableCommand},
+	"post_announcement":    {authz.Can(models.PermAnnouncementsManage), HandlePostAnnouncementCommand},
+	"add_student":          {authz.Can(models.PermStudentsManage), HandleAddStudentCommand},
+	"link_student":         {authz.Can(models.PermStudentsManage), HandleLinkStudentCommand},
+	"list_students":        {authz.Can(models.PermStudentsManage), HandleListStudentsCommand},
+	"view_parent_children": {authz.Can(models.PermUsersView), HandleViewParentChildrenCommand},
+	"add_teacher":          {authz.Can(models.PermTeachersManage), HandleAddTeacherCommand},
+	"list_teachers":        {authz.Can(models.PermTeachersManage), HandleListTeachersCommand},
+	"edit_grade":           {editGrades, HandleEditGradeCommand},
+	"delete_grade":         {editGrades, HandleDeleteGradeCommand},
+	"api_token":            {authz.Can(models.PermAPITokensManage), HandleAPITokenCommand},
+	"api_tokens":           {authz.Can(models.PermAPITokensManage), HandleAPITokensCommand},
+	"revoke_api_token":     {authz.Can(models.PermAPITokensManage), HandleRevokeAPITokenCommand},
+	"jobs":                 {authz.Can(models.PermJobsManage), HandleJobsCommand},
+	"run_job":              {authz.Can(models.PermJobsManage), HandleRunJobCommand},
+	"audit":                {authz.Can(models.PermAuditView), HandleAuditCommand},
+	"roles":                {authz.Can(models.PermRolesManage), HandleRolesCommand},
+	"set_role":             {authz.Can(models.PermRolesManage), HandleSetRoleCommand},
+	"revoke_role":          {authz.Can(models.PermRolesManage), HandleRevokeRoleCommand},
+}
+
+// HandleCommand handles bot commands after checking the caller against the command's rule
+func HandleCommand(ctx context.Context, botService *services.BotService, caller *authz.Caller, message *tgbotapi.Message) error {
+	cmd, ok := commands[message.Command()]
+	if !ok {
 		// Unknown command
-		return HandleStart(botService, message)
+		return HandleStart(ctx, botService, message)
+	}
+
+	err := botService.Policy.Authorize(ctx, caller, "/"+message.Command(), cmd.rule, nil)
+	if errors.Is(err, authz.ErrDenied) {
+		text := botService.Policy.DeniedMessage(caller, cmd.rule)
+		return botService.TelegramService.SendMessage(message.Chat.ID, text, nil)
 	}
+	if err != nil {
+		return err
+	}
+
+	return cmd.handler(ctx, botService, message)
 }
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestHandlerName(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "known command",
+			text: "/complaint",
+			want: "/complaint",
+		},
+		{
+			name: "known command with bot name",
+			text: "/help@parent_bot",
+			want: "/help",
+		},
+		{
+			name: "unknown command",
+			text: "/xyz",
+			want: "/unknown",
+		},
+		{
+			name: "another unknown command",
+			text: "/a1b2c3 with arguments",
+			want: "/unknown",
+		},
+		{
+			name: "text",
+			text: "hello",
+			want: "message:text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := &tgbotapi.Message{Text: tt.text}
+			if strings.HasPrefix(tt.text, "/") {
+				command, _, _ := strings.Cut(tt.text, " ")
+				message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(command)}}
+			}
+
+			update := tgbotapi.Update{Message: message}
+			if got := handlerName(nil, update); got != tt.want {
+				t.Errorf("handlerName(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
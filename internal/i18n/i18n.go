@@ -173,6 +173,9 @@ const (
 	BtnManageStudents         = "btn_manage_students"
 	BtnExportTestResults      = "btn_export_test_results"
 	BtnExportAttendance       = "btn_export_attendance"
+	BtnBackgroundJobs         = "btn_background_jobs"
+	BtnAuditLog               = "btn_audit_log"
+	BtnRoles                  = "btn_roles"
 
 	// Teacher buttons
 	BtnTeacherPanel           = "btn_teacher_panel"
@@ -193,6 +196,7 @@ const (
 
 	// Errors
 	ErrInvalidPhone           = "err_invalid_phone"
+	ErrOwnPhoneOnly           = "err_own_phone_only"
 	ErrInvalidName            = "err_invalid_name"
 	ErrInvalidClass           = "err_invalid_class"
 	ErrInvalidComplaint       = "err_invalid_complaint"
@@ -205,6 +209,11 @@ const (
 	ErrUnknownCommand         = "err_unknown_command"
 	ErrTextOnly               = "err_text_only"
 	ErrWrongInputType         = "err_wrong_input_type"
+	ErrRateLimited            = "err_rate_limited"
+	ErrAccessDenied           = "err_access_denied"
+	ErrUnknownAction          = "err_unknown_action"
+	ErrFlowExpired            = "err_flow_expired"
+	ErrStateConflict          = "err_state_conflict"
 
 	// Info
 	InfoProcessing            = "info_processing"
@@ -189,6 +189,9 @@ var russian = map[string]string{
 	BtnManageStudents:       "👥 Управление учениками",
 	BtnExportTestResults:    "📊 Экспорт результатов",
 	BtnExportAttendance:     "📋 Экспорт посещаемости",
+	BtnBackgroundJobs:       "⏱ Фоновые задачи",
+	BtnAuditLog:             "📜 Журнал аудита",
+	BtnRoles:                "🔐 Роли и права",
 
 	// Teacher buttons
 	BtnTeacherPanel:      "👨‍🏫 Панель учителя",
@@ -209,6 +212,7 @@ var russian = map[string]string{
 
 	// Errors
 	ErrInvalidPhone:      "❌ Неверный формат номера телефона!\n\nНомер должен начинаться с +998 и содержать 9 цифр.\n\nПример: +998901234567",
+	ErrOwnPhoneOnly:      "❌ Отправьте свой номер телефона кнопкой ниже.\n\nНабранный вручную номер или чужой контакт не принимается.",
 	ErrInvalidName:       "❌ Неверный формат имени!\n\nИмя должно содержать только буквы.",
 	ErrInvalidClass:      "❌ Неверный формат класса!\n\nНеобходимо указать номер класса (1-11) и букву (A-Z).\n\nПример: 9A, 11B",
 	ErrInvalidComplaint:  "❌ Текст жалобы слишком короткий!\n\nВведите минимум 10 символов.",
@@ -221,6 +225,11 @@ var russian = map[string]string{
 	ErrUnknownCommand:    "❌ Неизвестная команда. Нажмите /help.",
 	ErrTextOnly:          "❌ Пожалуйста, отправьте только текст!\n\nНельзя отправлять изображения, видео, GIF или другие файлы.",
 	ErrWrongInputType:    "❌ Неправильный тип данных!\n\nПожалуйста, введите только текст.",
+	ErrRateLimited:       "⏳ Слишком много запросов. Пожалуйста, подождите немного и попробуйте снова.",
+	ErrAccessDenied:      "🚫 У вас нет прав на это действие.",
+	ErrUnknownAction:     "❓ Неизвестное действие. Откройте меню заново.",
+	ErrFlowExpired:       "⌛ Время предыдущего действия истекло, и оно отменено. При необходимости начните заново из меню.",
+	ErrStateConflict:     "🔄 Пока выполнялось это действие, было принято другое ваше действие. Пожалуйста, попробуйте ещё раз.",
 
 	// Info
 	InfoProcessing:  "⏳ Обрабатывается...",
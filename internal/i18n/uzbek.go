@@ -189,6 +189,9 @@ var uzbek = map[string]string{
 	BtnManageStudents:       "👥 O'quvchilarni boshqarish",
 	BtnExportTestResults:    "📊 Test natijalarini eksport",
 	BtnExportAttendance:     "📋 Davomatni eksport",
+	BtnBackgroundJobs:       "⏱ Fon vazifalari",
+	BtnAuditLog:             "📜 Audit jurnali",
+	BtnRoles:                "🔐 Rollar va huquqlar",
 
 	// Teacher buttons
 	BtnTeacherPanel:      "👨‍🏫 O'qituvchi paneli",
@@ -209,6 +212,7 @@ var uzbek = map[string]string{
 
 	// Errors
 	ErrInvalidPhone:      "❌ Noto'g'ri telefon raqam formati!\n\nTelefon raqam +998 bilan boshlanishi va 9 ta raqamdan iborat bo'lishi kerak.\n\nMisol: +998901234567",
+	ErrOwnPhoneOnly:      "❌ Telefon raqamingizni quyidagi tugma orqali ulashing.\n\nYozilgan raqam yoki boshqa kishining kontakti qabul qilinmaydi.",
 	ErrInvalidName:       "❌ Noto'g'ri ism formati!\n\nIsm faqat harflardan iborat bo'lishi kerak.",
 	ErrInvalidClass:      "❌ Noto'g'ri sinf formati!\n\nSinf raqami (1-11) va harfi (A-Z) ko'rsatilishi kerak.\n\nMisol: 9A, 11B",
 	ErrInvalidComplaint:  "❌ Shikoyat matni juda qisqa!\n\nKamida 10 ta belgi kiriting.",
@@ -221,6 +225,11 @@ var uzbek = map[string]string{
 	ErrUnknownCommand:    "❌ Noma'lum buyruq. /help ni bosing.",
 	ErrTextOnly:          "❌ Iltimos, faqat matn yuboring!\n\nRasm, video, GIF yoki boshqa fayllarni yuborish mumkin emas.",
 	ErrWrongInputType:    "❌ Noto'g'ri ma'lumot turi!\n\nIltimos, faqat matn kiriting.",
+	ErrRateLimited:       "⏳ Juda ko'p so'rov yuborildi. Iltimos, biroz kuting va qaytadan urinib ko'ring.",
+	ErrAccessDenied:      "🚫 Bu amal uchun ruxsatingiz yo'q.",
+	ErrUnknownAction:     "❓ Noma'lum amal. Menyuni qaytadan oching.",
+	ErrFlowExpired:       "⌛ Oldingi amalning vaqti tugadi va u bekor qilindi. Kerak bo'lsa, menyudan qaytadan boshlang.",
+	ErrStateConflict:     "🔄 Bu amal bajarilayotganda boshqa amalingiz qabul qilindi. Iltimos, qaytadan urinib ko'ring.",
 
 	// Info
 	InfoProcessing:  "⏳ Ishlov berilmoqda...",
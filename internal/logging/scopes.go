@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Scopes holds the logger of each user's in-flight update. The dispatcher
+// handles one update per chat at a time, so code deep inside a handler can
+// find its update's fields (update_id, role, state, handler) by Telegram ID.
+type Scopes struct {
+	base *slog.Logger
+
+	mu      sync.RWMutex
+	loggers map[int64]*slog.Logger
+}
+
+// NewScopes creates an empty scope set falling back to base
+func NewScopes(base *slog.Logger) *Scopes {
+	return &Scopes{
+		base:    base,
+		loggers: make(map[int64]*slog.Logger),
+	}
+}
+
+// Begin attaches a logger to a user's in-flight update
+func (s *Scopes) Begin(telegramID int64, logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loggers[telegramID] = logger
+}
+
+// End detaches the user's update logger
+func (s *Scopes) End(telegramID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loggers, telegramID)
+}
+
+// For returns the logger of the user's in-flight update, or the base
+// logger tagged with telegram_id when the user has none
+func (s *Scopes) For(telegramID int64) *slog.Logger {
+	s.mu.RLock()
+	logger, ok := s.loggers[telegramID]
+	s.mu.RUnlock()
+
+	if ok {
+		return logger
+	}
+	return s.base.With("telegram_id", telegramID)
+}
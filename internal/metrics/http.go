@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+// HTTPClient is the client interface tgbotapi uses for Bot API calls
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// telegramClient times Bot API requests and counts failures
+type telegramClient struct {
+	next HTTPClient
+}
+
+// InstrumentTelegram wraps a Bot API HTTP client. The method name is the
+// last path segment of the request URL, so the bot token never becomes a label.
+func InstrumentTelegram(next HTTPClient) HTTPClient {
+	return &telegramClient{next: next}
+}
+
+func (c *telegramClient) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	start := time.Now()
+
+	resp, err := c.next.Do(req)
+
+	TelegramRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+	switch {
+	case err != nil:
+		TelegramErrorsTotal.WithLabelValues(method, "network").Inc()
+	case resp.StatusCode >= 300:
+		TelegramErrorsTotal.WithLabelValues(method, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+
+	return resp, err
+}
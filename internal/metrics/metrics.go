@@ -0,0 +1,126 @@
+// Package metrics defines the bot's Prometheus metrics and the /metrics handler.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "parentbot"
+
+// Registry holds every bot metric plus the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	// UpdatesTotal counts handled updates by type, handler and status (ok, error, conflict, throttled)
+	UpdatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_total",
+		Help:      "Telegram updates processed, by update type, handler and status.",
+	}, []string{"type", "handler", "status"})
+
+	// HandlerDuration observes how long each handler takes
+	HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time spent handling an update, by update type and handler.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type", "handler"})
+
+	// TelegramRequestDuration observes Bot API round trips by method
+	TelegramRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_request_duration_seconds",
+		Help:      "Bot API request latency, by method.",
+		Buckets:   []float64{.025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method"})
+
+	// TelegramErrorsTotal counts failed Bot API requests by method and HTTP status code
+	// ("network" when no response was received)
+	TelegramErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_api_errors_total",
+		Help:      "Failed Bot API requests, by method and status code.",
+	}, []string{"method", "code"})
+
+	// DBQueryDuration observes database statements by operation (select, insert, update, delete, other)
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database statement latency, by operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation"})
+
+	// NotificationsTotal counts outbox notifications by kind and result
+	// (queued, skipped, sent, retried, throttled, failed, unreachable)
+	NotificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Outbox notifications, by kind and result.",
+	}, []string{"kind", "result"})
+
+	// NotificationDelay observes the time from queueing a notification to its delivery
+	NotificationDelay = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "notification_delay_seconds",
+		Help:      "Time from queueing a notification to delivering it, by kind.",
+		Buckets:   []float64{.1, .5, 1, 5, 15, 30, 60, 300, 900, 3600},
+	}, []string{"kind"})
+
+	// JobRunsTotal counts background job runs by job and status (ok, failed)
+	JobRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Background job runs, by job and status.",
+	}, []string{"job", "status"})
+
+	// JobDuration observes how long each background job run takes
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Background job run time, by job.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 15, 60, 300, 900},
+	}, []string{"job"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		UpdatesTotal,
+		HandlerDuration,
+		TelegramRequestDuration,
+		TelegramErrorsTotal,
+		DBQueryDuration,
+		NotificationsTotal,
+		NotificationDelay,
+		JobRunsTotal,
+		JobDuration,
+	)
+}
+
+// RegisterGauge exposes a value read at scrape time, such as a cache size
+func RegisterGauge(name, help string, value func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+// RegisterCounter exposes a running total read at scrape time, such as cache hits
+func RegisterCounter(name, help string, value func() float64) {
+	Registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -2,12 +2,14 @@ package models
 
 import "time"
 
-// Admin represents an admin user
+// Admin represents a member of the school staff who uses the admin panel.
+// What they may do there depends on their role.
 type Admin struct {
 	ID          int       `json:"id" db:"id"`
 	PhoneNumber string    `json:"phone_number" db:"phone_number"`
 	TelegramID  *int64    `json:"telegram_id,omitempty" db:"telegram_id"`
 	Name        string    `json:"name" db:"name"`
+	Role        string    `json:"role" db:"role"` // one of StaffRoles
 	AddedAt     time.Time `json:"added_at" db:"added_at"`
 }
 
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Announcement represents a school announcement
 type Announcement struct {
@@ -48,3 +53,62 @@ type AnnouncementWithClasses struct {
 	ClassIDs   []int    `json:"class_ids"`
 	ClassNames []string `json:"class_names"`
 }
+
+// Announcement delivery statuses
+const (
+	DeliveryQueued  = "queued"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliveryBlocked = "blocked" // the parent blocked the bot or the chat is gone
+)
+
+// AnnouncementDelivery is the delivery of an announcement to one parent
+type AnnouncementDelivery struct {
+	ID             int64      `json:"id" db:"id"`
+	AnnouncementID int        `json:"announcement_id" db:"announcement_id"`
+	UserID         int        `json:"user_id" db:"user_id"`
+	ChatID         int64      `json:"chat_id" db:"chat_id"`
+	Status         string     `json:"status" db:"status"`
+	Error          string     `json:"error,omitempty" db:"error"`
+	QueuedAt       time.Time  `json:"queued_at" db:"queued_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// DeliverySummary counts the deliveries of an announcement by status
+type DeliverySummary struct {
+	Queued  int `json:"queued"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+	Blocked int `json:"blocked"`
+}
+
+// Total returns the number of recipients
+func (s *DeliverySummary) Total() int {
+	return s.Queued + s.Sent + s.Failed + s.Blocked
+}
+
+// AnnouncementRef returns the notification ref of an announcement's broadcast.
+// A resend gets its own ref, so its progress is counted separately.
+func AnnouncementRef(announcementID int, resend bool) string {
+	ref := fmt.Sprintf("announcement:%d", announcementID)
+	if resend {
+		ref += fmt.Sprintf(":resend:%d", time.Now().UnixNano())
+	}
+	return ref
+}
+
+// ParseAnnouncementRef returns the announcement a notification ref belongs to
+func ParseAnnouncementRef(ref string) (int, bool) {
+	rest, ok := strings.CutPrefix(ref, "announcement:")
+	if !ok {
+		return 0, false
+	}
+	id, _, _ := strings.Cut(rest, ":")
+
+	announcementID, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, false
+	}
+	return announcementID, true
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// API token scopes
+const (
+	APIScopeRead  = "read"
+	APIScopeWrite = "write"
+)
+
+// APIToken is a revocable credential for the admin HTTP API
+type APIToken struct {
+	ID         int        `json:"id" db:"id"`
+	AdminID    int        `json:"admin_id" db:"admin_id"`
+	Name       string     `json:"name" db:"name"`
+	Scope      string     `json:"scope" db:"scope"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	AdminRole  string     `json:"admin_role,omitempty" db:"-"` // issuer's current role, empty if they were removed
+}
+
+// IsRevoked checks if the token has been revoked
+func (t *APIToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
+
+// Allows checks if the token's scope covers the required scope
+func (t *APIToken) Allows(scope string) bool {
+	if t.Scope == APIScopeWrite {
+		return true
+	}
+	return t.Scope == scope
+}
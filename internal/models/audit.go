@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Where an audited change was made
+const (
+	AuditSourceBot    = "bot"
+	AuditSourceAPI    = "api"
+	AuditSourceCLI    = "cli"
+	AuditSourceSystem = "system" // background jobs and startup
+)
+
+// Audited entity types
+const (
+	AuditEntityAccess       = "access" // denied bot actions
+	AuditEntityAdmin        = "admin"
+	AuditEntityAPIToken     = "api_token"
+	AuditEntityAnnouncement = "announcement"
+	AuditEntityAttendance   = "attendance"
+	AuditEntityClass        = "class"
+	AuditEntityComplaint    = "complaint"
+	AuditEntityParent       = "parent"
+	AuditEntityProposal     = "proposal"
+	AuditEntityRole         = "role"
+	AuditEntityStudent      = "student"
+	AuditEntityTeacher      = "teacher"
+	AuditEntityTestResult   = "test_result"
+	AuditEntityTimetable    = "timetable"
+)
+
+// AuditEntityTypes lists the audited entity types, in the order filters show them
+var AuditEntityTypes = []string{
+	AuditEntityTestResult,
+	AuditEntityAttendance,
+	AuditEntityStudent,
+	AuditEntityClass,
+	AuditEntityTeacher,
+	AuditEntityAnnouncement,
+	AuditEntityTimetable,
+	AuditEntityParent,
+	AuditEntityComplaint,
+	AuditEntityProposal,
+	AuditEntityAdmin,
+	AuditEntityRole,
+	AuditEntityAPIToken,
+	AuditEntityAccess,
+}
+
+// AuditEntry records one change: who made it, to what, and the entity
+// before and after as JSON (null when it didn't exist)
+type AuditEntry struct {
+	ID              int64           `json:"id" db:"id"`
+	ActorTelegramID *int64          `json:"actor_telegram_id,omitempty" db:"actor_telegram_id"`
+	ActorName       string          `json:"actor_name" db:"actor_name"`
+	ActorRole       string          `json:"actor_role" db:"actor_role"`
+	Source          string          `json:"source" db:"source"`
+	Action          string          `json:"action" db:"action"` // e.g. "test_result.update"
+	EntityType      string          `json:"entity_type" db:"entity_type"`
+	EntityID        string          `json:"entity_id,omitempty" db:"entity_id"`
+	Before          json.RawMessage `json:"before,omitempty" db:"before_data"`
+	After           json.RawMessage `json:"after,omitempty" db:"after_data"`
+	CreatedAt       time.Time       `json:"created_at" db:"created_at"`
+}
+
+// AuditFilter selects audit entries for listing
+type AuditFilter struct {
+	EntityType      string
+	EntityID        string
+	Action          string
+	ActorTelegramID *int64
+	Source          string
+	Since           *time.Time
+	Until           *time.Time
+	Limit           int
+	Offset          int
+}
@@ -13,5 +13,19 @@ type Class struct {
 
 // CreateClassRequest is the request to create a new class
 type CreateClassRequest struct {
-	ClassName string `json:"class_name"`
+	ClassName string `json:"class_name" validate:"required,min=1,max=50"`
+}
+
+// UpdateClassRequest is the request to update class data
+type UpdateClassRequest struct {
+	ClassName string `json:"class_name,omitempty" validate:"omitempty,min=1,max=50"`
+	IsActive  *bool  `json:"is_active,omitempty"`
+}
+
+// ClassFilter filters and paginates class lists
+type ClassFilter struct {
+	Search   string // Substring of class name
+	IsActive *bool
+	Limit    int
+	Offset   int
 }
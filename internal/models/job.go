@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Job run statuses
+const (
+	JobStatusRunning = "running"
+	JobStatusOK      = "ok"
+	JobStatusFailed  = "failed"
+)
+
+// What started a job run
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerCatchUp  = "catch_up" // a run missed while the bot was down
+	JobTriggerManual   = "manual"
+)
+
+// Job is the persisted run history of a scheduled background job
+type Job struct {
+	Name           string     `json:"name" db:"name"`
+	Schedule       string     `json:"schedule" db:"schedule"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty" db:"next_run_at"`
+	LastStartedAt  *time.Time `json:"last_started_at,omitempty" db:"last_started_at"`
+	LastFinishedAt *time.Time `json:"last_finished_at,omitempty" db:"last_finished_at"`
+	LastStatus     string     `json:"last_status" db:"last_status"`
+	LastTrigger    string     `json:"last_trigger" db:"last_trigger"`
+	LastError      string     `json:"last_error,omitempty" db:"last_error"`
+	RunCount       int        `json:"run_count" db:"run_count"`
+	FailureCount   int        `json:"failure_count" db:"failure_count"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// LastDuration returns how long the last finished run took
+func (j *Job) LastDuration() time.Duration {
+	if j.LastStartedAt == nil || j.LastFinishedAt == nil || j.LastFinishedAt.Before(*j.LastStartedAt) {
+		return 0
+	}
+	return j.LastFinishedAt.Sub(*j.LastStartedAt)
+}
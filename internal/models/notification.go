@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Notification delivery statuses
+const (
+	NotificationPending     = "pending"
+	NotificationSent        = "sent"
+	NotificationFailed      = "failed"      // gave up after an error or too many attempts
+	NotificationUnreachable = "unreachable" // the chat blocked the bot or no longer exists
+)
+
+// Notification kinds
+const (
+	NotificationAbsence          = "absence"
+	NotificationGrade            = "grade"
+	NotificationAttendanceReport = "attendance_report"
+	NotificationAnnouncement     = "announcement"
+	NotificationComplaint        = "complaint"
+	NotificationProposal         = "proposal"
+)
+
+// Media types of a notification with a file
+const (
+	MediaDocument = "document"
+	MediaPhoto    = "photo"
+)
+
+// Notification is a message queued in the outbox for delivery to one chat
+type Notification struct {
+	ID            int64      `json:"id" db:"id"`
+	ChatID        int64      `json:"chat_id" db:"chat_id"`
+	Kind          string     `json:"kind" db:"kind"`
+	Text          string     `json:"text" db:"text"` // HTML; the caption when FileID is set
+	FileID        string     `json:"file_id,omitempty" db:"file_id"`
+	MediaType     string     `json:"media_type,omitempty" db:"media_type"`
+	ReplyMarkup   string     `json:"reply_markup,omitempty" db:"reply_markup"` // keyboard as Bot API JSON
+	Ref           string     `json:"ref,omitempty" db:"ref"`                   // groups notifications sent for the same thing, e.g. "announcement:42"
+	Bulk          bool       `json:"bulk" db:"bulk"`                           // part of a broadcast; sent after other pending notifications
+	Status        string     `json:"status" db:"status"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+}
+
+// SetReplyMarkup stores a keyboard to attach to the message
+func (n *Notification) SetReplyMarkup(markup any) error {
+	data, err := json.Marshal(markup)
+	if err != nil {
+		return fmt.Errorf("failed to encode reply markup: %w", err)
+	}
+	n.ReplyMarkup = string(data)
+	return nil
+}
+
+// NotificationFilter selects notifications for listing
+type NotificationFilter struct {
+	ChatID *int64
+	Kind   string
+	Status string
+	Ref    string
+	Limit  int
+	Offset int
+}
@@ -0,0 +1,109 @@
+package models
+
+// Roles. Staff roles belong to admins records and teacher roles to teachers
+// records; someone who is both gets the permissions of both roles.
+const (
+	RoleSuperAdmin     = "super_admin"
+	RoleAdmin          = "admin"
+	RoleDeputyDirector = "deputy_director"
+	RoleInspector      = "inspector"
+	RoleClassTeacher   = "class_teacher"
+	RoleSubjectTeacher = "subject_teacher"
+)
+
+// StaffRoles are the roles of admins records, most powerful first
+var StaffRoles = []string{RoleSuperAdmin, RoleAdmin, RoleDeputyDirector, RoleInspector}
+
+// TeacherRoles are the roles of teachers records
+var TeacherRoles = []string{RoleClassTeacher, RoleSubjectTeacher}
+
+// Roles lists every role in display order
+var Roles = append(append([]string{}, StaffRoles...), TeacherRoles...)
+
+// Permission is something a role may be granted
+type Permission string
+
+// Permissions of the admin panel, over the whole school
+const (
+	PermClassesManage       Permission = "classes.manage"
+	PermStudentsManage      Permission = "students.manage"
+	PermTeachersManage      Permission = "teachers.manage"
+	PermTimetablesManage    Permission = "timetables.manage"
+	PermAnnouncementsManage Permission = "announcements.manage"
+	PermComplaintsView      Permission = "complaints.view" // complaints and proposals
+	PermUsersView           Permission = "users.view"
+	PermStatsView           Permission = "stats.view"
+	PermAttendanceView      Permission = "attendance.view"
+	PermGradesView          Permission = "grades.view"
+	PermReportsExport       Permission = "reports.export"
+	PermJobsManage          Permission = "jobs.manage"
+	PermAuditView           Permission = "audit.view"
+	PermAPITokensManage     Permission = "api_tokens.manage"
+	PermRolesManage         Permission = "roles.manage"
+)
+
+// Permissions of the teacher menu, over the teacher's own classes
+const (
+	PermAttendanceMark         Permission = "attendance.mark"
+	PermGradesEdit             Permission = "grades.edit"
+	PermClassStudentsManage    Permission = "class_students.manage"
+	PermClassAnnouncementsPost Permission = "class_announcements.post"
+)
+
+// AdminPermissions are the permissions of the admin panel, in display order;
+// staff with none of them have no admin panel
+var AdminPermissions = []Permission{
+	PermClassesManage,
+	PermStudentsManage,
+	PermTeachersManage,
+	PermTimetablesManage,
+	PermAnnouncementsManage,
+	PermComplaintsView,
+	PermUsersView,
+	PermStatsView,
+	PermAttendanceView,
+	PermGradesView,
+	PermReportsExport,
+	PermJobsManage,
+	PermAuditView,
+	PermAPITokensManage,
+	PermRolesManage,
+}
+
+// TeacherPermissions are the permissions of the teacher menu, in display order
+var TeacherPermissions = []Permission{
+	PermAttendanceMark,
+	PermGradesEdit,
+	PermClassStudentsManage,
+	PermClassAnnouncementsPost,
+}
+
+// Permissions lists every permission in display order
+var Permissions = append(append([]Permission{}, AdminPermissions...), TeacherPermissions...)
+
+// PermissionSet is the set of permissions granted to someone
+type PermissionSet map[Permission]bool
+
+// Has reports whether p is granted
+func (s PermissionSet) Has(p Permission) bool {
+	return s[p]
+}
+
+// HasAny reports whether any of ps is granted
+func (s PermissionSet) HasAny(ps ...Permission) bool {
+	for _, p := range ps {
+		if s[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// AllPermissions returns a set of every permission, as super-admins have
+func AllPermissions() PermissionSet {
+	all := make(PermissionSet, len(Permissions))
+	for _, p := range Permissions {
+		all[p] = true
+	}
+	return all
+}
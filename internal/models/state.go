@@ -7,111 +7,157 @@ import (
 
 // UserState represents the conversation state of a user
 type UserState struct {
-	TelegramID int64           `json:"telegram_id" db:"telegram_id"`
-	State      string          `json:"state" db:"state"`
-	Data       json.RawMessage `json:"data" db:"data"`
-	UpdatedAt  time.Time       `json:"updated_at" db:"updated_at"`
+	TelegramID  int64           `json:"telegram_id" db:"telegram_id"`
+	State       string          `json:"state" db:"state"`
+	Flow        string          `json:"flow" db:"flow"`                 // empty for idle states
+	FlowVersion int             `json:"flow_version" db:"flow_version"` // version of the flow that saved Data
+	Data        json.RawMessage `json:"data" db:"data"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty" db:"expires_at"` // nil for idle states
+	Revision    int64           `json:"revision" db:"revision"`               // bumped by every write of the row
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
 }
 
-// StateData is a helper struct for storing state data
-type StateData struct {
-	PhoneNumber       string `json:"phone_number,omitempty"`
-	// ChildName and ChildClass are deprecated - students are now managed separately
-	// Kept for backward compatibility with old state data
-	ChildName         string `json:"child_name,omitempty"`
-	ChildClass        string `json:"child_class,omitempty"`
+// Expired reports whether the user's flow was left unfinished for too long
+func (s *UserState) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
+
+// Flow data. Each conversation flow keeps its own struct while the user is
+// in one of its states. Field JSON names match the catch-all object states
+// were saved as before flows existed, so those blobs decode unchanged.
+
+// RegistrationData is kept while a parent signs up
+type RegistrationData struct {
+	Language string `json:"language,omitempty"`
+}
+
+// ChildData is kept while a parent picks a child to link
+type ChildData struct {
+	ClassID *int `json:"class_id,omitempty"`
+}
+
+// ComplaintData is kept while a parent writes a complaint
+type ComplaintData struct {
 	Language          string `json:"language,omitempty"`
+	SelectedStudentID *int   `json:"selected_student_id,omitempty"`
 	ComplaintText     string `json:"complaint_text,omitempty"`
-	ProposalText      string `json:"proposal_text,omitempty"`
-	ClassID           *int   `json:"class_id,omitempty"`
-	// Selected student for complaints/proposals
+}
+
+// ProposalData is kept while a parent writes a proposal
+type ProposalData struct {
+	Language          string `json:"language,omitempty"`
 	SelectedStudentID *int   `json:"selected_student_id,omitempty"`
-	AnnouncementText  string `json:"announcement_text,omitempty"`
-	AnnouncementTitle string `json:"announcement_title,omitempty"`
-	AnnouncementID    int    `json:"announcement_id,omitempty"`
-	// Attendance tracking
-	AbsentList        []int  `json:"absent_list,omitempty"`
-	PresentList       []int  `json:"present_list,omitempty"`
-	Date              string `json:"date,omitempty"`
-	// Multi-class selection (for announcements, etc.)
-	SelectedClasses   []int  `json:"selected_classes,omitempty"`
-	// Teacher management
-	TeacherPhone      string `json:"teacher_phone,omitempty"`
-	TeacherFirstName  string `json:"teacher_first_name,omitempty"`
-	TeacherLastName   string `json:"teacher_last_name,omitempty"`
-	// Student management
-	StudentFirstName  string `json:"student_first_name,omitempty"`
-	StudentLastName   string `json:"student_last_name,omitempty"`
-	// Test results
-	SubjectName       string `json:"subject_name,omitempty"`
-	Score             string `json:"score,omitempty"`
-	TestDate          string `json:"test_date,omitempty"`
-	StartDate         string `json:"start_date,omitempty"`
-	EndDate           string `json:"end_date,omitempty"`
-	// Pagination
-	Page              int    `json:"page,omitempty"`
+	ProposalText      string `json:"proposal_text,omitempty"`
+}
+
+// TimetableData is kept while an admin uploads a timetable
+type TimetableData struct {
+	Language string `json:"language,omitempty"`
+	ClassID  *int   `json:"class_id,omitempty"`
+}
+
+// AnnouncementData is kept while an admin or teacher writes an announcement
+type AnnouncementData struct {
+	Language         string `json:"language,omitempty"`
+	AnnouncementText string `json:"announcement_text,omitempty"`
+	SelectedClasses  []int  `json:"selected_classes,omitempty"` // teacher announcements only
+}
+
+// AnnouncementEditData is kept while an admin or teacher edits an announcement
+type AnnouncementEditData struct {
+	Language       string `json:"language,omitempty"`
+	AnnouncementID int    `json:"announcement_id,omitempty"`
+}
+
+// StudentData is kept while an admin or teacher adds a student to a class
+type StudentData struct {
+	ClassID *int `json:"class_id,omitempty"`
+}
+
+// TeacherData is kept while an admin adds a teacher
+type TeacherData struct {
+	TeacherFirstName string `json:"teacher_first_name,omitempty"`
+	TeacherLastName  string `json:"teacher_last_name,omitempty"`
+}
+
+// AttendanceData is kept while a class's attendance is taken
+type AttendanceData struct {
+	ClassID    *int   `json:"class_id,omitempty"`
+	AbsentList []int  `json:"absent_list,omitempty"`
+	Date       string `json:"date,omitempty"`
+}
+
+// TestResultData is kept while a teacher enters a student's grades
+type TestResultData struct {
+	SelectedStudentID *int `json:"selected_student_id,omitempty"`
+}
+
+// ExportData is kept while an admin enters a date range for an export
+type ExportData struct {
+	ClassID *int `json:"class_id,omitempty"`
 }
 
-// State constants
+// State constants. Every state except the idle ones belongs to a flow
+// registered with the state manager.
 const (
-	StateStart               = "start"
-	StateAwaitingLanguage    = "awaiting_language"
-	StateAwaitingPhone       = "awaiting_phone"
+	// Idle states
+	StateStart      = "start"
+	StateRegistered = "registered"
+
+	// Registration
+	StateAwaitingLanguage = "awaiting_language"
+	StateAwaitingPhone    = "awaiting_phone"
 	// DEPRECATED: Child name/class are no longer collected during registration
-	StateAwaitingChildName   = "awaiting_child_name"
-	StateAwaitingChildClass  = "awaiting_child_class"
-	StateRegistered          = "registered"
+	StateAwaitingChildName  = "awaiting_child_name"
+	StateAwaitingChildClass = "awaiting_child_class"
 
-	// Parent registration - new flow: register + first child selection
+	// Linking a child: first child after registration, or from My Kids
 	StateSelectingClass          = "selecting_class"
 	StateSelectingChild          = "selecting_child"
+	StateAddingChild             = "adding_child"
+	StateSelectingChildFromClass = "selecting_child_from_class"
 
 	// Complaint/Proposal flow
-	StateAwaitingComplaint   = "awaiting_complaint"
-	StateConfirmingComplaint = "confirming_complaint"
-	StateAwaitingProposal    = "awaiting_proposal"
-	StateConfirmingProposal  = "confirming_proposal"
+	StateSelectingChildForComplaint = "selecting_child_for_complaint"
+	StateAwaitingComplaint          = "awaiting_complaint"
+	StateConfirmingComplaint        = "confirming_complaint"
+	StateSelectingChildForProposal  = "selecting_child_for_proposal"
+	StateAwaitingProposal           = "awaiting_proposal"
+	StateConfirmingProposal         = "confirming_proposal"
 
 	// Admin states
-	StateAwaitingAdminPhone  = "awaiting_admin_phone"
-	StateAwaitingClassName   = "awaiting_class_name"
+	StateAwaitingAdminPhone         = "awaiting_admin_phone"
+	StateAwaitingClassName          = "awaiting_class_name"
+	StateAwaitingLinkInfo           = "awaiting_link_info"
+	StateAwaitingParentPhoneForView = "awaiting_parent_phone_for_view"
+	StateAwaitingExportCustomDates  = "admin_awaiting_export_custom_dates"
 
 	// Timetable states
-	StateSelectClassForTimetable = "select_class_for_timetable"
-	StateAwaitingTimetableFile   = "awaiting_timetable_file"
+	StateAwaitingTimetableFile = "awaiting_timetable_file"
 
 	// Announcement states
-	StateAwaitingAnnouncementTitle         = "awaiting_announcement_title"
-	StateAwaitingAnnouncementContent       = "awaiting_announcement_content"
-	StateAwaitingAnnouncementFile          = "awaiting_announcement_file"
-	StateAwaitingEditedAnnouncementContent = "awaiting_edited_announcement_content"
-	StateSelectingAnnouncementClasses      = "selecting_announcement_classes"
+	StateAwaitingAnnouncementContent         = "awaiting_announcement_content"
+	StateAwaitingAnnouncementFile            = "awaiting_announcement_file"
+	StateAwaitingEditedAnnouncementContent   = "awaiting_edited_announcement_content"
+	StateTeacherSelectingAnnouncementClasses = "teacher_selecting_announcement_classes"
+	StateTeacherAwaitingAnnouncementContent  = "teacher_awaiting_announcement_content"
+	StateTeacherAwaitingAnnouncementFile     = "teacher_awaiting_announcement_file"
+	StateTeacherEditingAnnouncementContent   = "teacher_editing_announcement_content"
 
 	// Teacher management states
-	StateAwaitingTeacherPhone     = "awaiting_teacher_phone"
-	StateAwaitingTeacherName      = "awaiting_teacher_name"
-	StateSelectingTeacherClasses  = "selecting_teacher_classes"
+	StateAwaitingTeacherFullName = "awaiting_teacher_full_name"
+	StateAwaitingTeacherPhone    = "awaiting_teacher_phone"
 
 	// Student management states
-	StateSelectingStudentClass = "selecting_student_class"
-	StateAwaitingStudentName   = "awaiting_student_name"
+	StateAwaitingStudentInfo        = "awaiting_student_info"
+	StateAwaitingAdminStudentName   = "awaiting_admin_student_name"
+	StateTeacherAwaitingStudentName = "teacher_awaiting_student_name"
 
 	// Test results states
-	StateSelectingTestClass     = "selecting_test_class"
-	StateSelectingTestStudent   = "selecting_test_student"
-	StateAwaitingSubjectName    = "awaiting_subject_name"
-	StateAwaitingScore          = "awaiting_score"
-	StateAwaitingTestDate       = "awaiting_test_date"
-	StateSelectingExportRange   = "selecting_export_range"
+	StateAwaitingTestResultInfo         = "awaiting_test_result_info"
+	StateTeacherAwaitingTestResultsText = "teacher_awaiting_test_results_text"
 
 	// Attendance states
-	StateSelectingAttendanceClass = "selecting_attendance_class"
-	StateMarkingAttendance        = "marking_attendance"
-	StateConfirmingAttendance     = "confirming_attendance"
-
-	// My Kids states
-	StateMyKidsMenu           = "my_kids_menu"
-	StateAddingChild          = "adding_child"
-	StateSelectingChildClass  = "selecting_child_class"
-	StateSelectingChildFromClass = "selecting_child_from_class"
+	StateTakingAttendance       = "taking_attendance"
+	StateAwaitingAttendanceInfo = "awaiting_attendance_info"
 )
@@ -42,3 +42,12 @@ type UpdateStudentRequest struct {
 	ClassID   *int   `json:"class_id,omitempty"`
 	IsActive  *bool  `json:"is_active,omitempty"`
 }
+
+// StudentFilter filters and paginates student lists
+type StudentFilter struct {
+	ClassID         *int
+	Search          string // Substring of first or last name
+	IncludeInactive bool   // Include soft-deleted students
+	Limit           int
+	Offset          int
+}
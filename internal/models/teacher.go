@@ -11,6 +11,7 @@ type Teacher struct {
 	LastName      string     `json:"last_name" db:"last_name"`
 	Language      string     `json:"language" db:"language"`
 	IsActive      bool       `json:"is_active" db:"is_active"`
+	Role          string     `json:"role" db:"role"` // RoleClassTeacher or RoleSubjectTeacher
 	AddedByAdminID *int      `json:"added_by_admin_id" db:"added_by_admin_id"`
 	RegisteredAt  *time.Time `json:"registered_at" db:"registered_at"`
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
@@ -23,6 +24,7 @@ type CreateTeacherRequest struct {
 	LastName    string `json:"last_name" validate:"required,min=2,max=100"`
 	Language    string `json:"language" validate:"required,oneof=uz ru"`
 	AddedByAdminID int `json:"added_by_admin_id" validate:"required"`
+	ClassIDs    []int  `json:"class_ids,omitempty" validate:"omitempty,dive,gt=0"` // Classes to assign together with the teacher
 }
 
 // UpdateTeacherRequest is the request to update teacher data
@@ -31,6 +33,17 @@ type UpdateTeacherRequest struct {
 	LastName  string `json:"last_name,omitempty" validate:"omitempty,min=2,max=100"`
 	Language  string `json:"language,omitempty" validate:"omitempty,oneof=uz ru"`
 	IsActive  *bool  `json:"is_active,omitempty"`
+	Role      string `json:"role,omitempty" validate:"omitempty,oneof=class_teacher subject_teacher"`
+}
+
+// TeacherFilter filters and paginates teacher lists
+type TeacherFilter struct {
+	Search   string // Substring of first name, last name or phone number
+	IsActive *bool
+	ClassID  *int // Only teachers assigned to this class
+	Role     string
+	Limit    int
+	Offset   int
 }
 
 // TeacherClass represents the junction table linking teachers to classes
@@ -0,0 +1,484 @@
+// Package outbox delivers notifications queued in the notification_outbox table.
+//
+// Handlers enqueue notifications instead of sending them, so a message is
+// stored before the action that caused it is confirmed. One sender goroutine
+// delivers them oldest first, bulk ones such as broadcasts after all others,
+// never more than one at a time per chat, and records the outcome of every
+// attempt. Sends are paced to stay under Telegram's limits for the whole bot
+// and for each chat.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/config"
+	"parent-bot/internal/metrics"
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+)
+
+const (
+	batchSize  = 50              // due notifications loaded per query
+	idleWait   = time.Minute     // longest sleep when nothing is due; Enqueue wakes the sender early
+	errorWait  = 5 * time.Second // sleep after the outbox could not be read
+	floodFloor = time.Second     // shortest pause after a 429 without retry_after
+)
+
+// Bot is the part of the Bot API the sender uses
+type Bot interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+// Result is the final outcome of a notification
+type Result struct {
+	Notification *models.Notification
+	Status       string // models.NotificationSent, NotificationFailed or NotificationUnreachable
+	Error        string
+	At           time.Time
+}
+
+// Observer is told about notifications that reached a final status. It runs
+// on the sender goroutine, or in Enqueue for chats already known to be
+// unreachable, so it should return quickly.
+type Observer func(ctx context.Context, results []Result)
+
+// Outbox queues notifications and delivers them in the background
+type Outbox struct {
+	repo      *repository.NotificationRepository
+	bot       Bot
+	cfg       config.OutboxConfig
+	logger    *slog.Logger
+	wake      chan struct{}
+	observers []Observer // set before the outbox is used, see Observe
+
+	// Pacing state, used only by the sender goroutine. resumeAt ends a pause
+	// for Telegram's flood control, which applies to the whole bot; nextSend
+	// spaces all sends by cfg.Rate and lastSent spaces sends to one chat by
+	// cfg.ChatInterval.
+	resumeAt time.Time
+	nextSend time.Time
+	lastSent map[int64]time.Time
+
+	now func() time.Time // replaced in tests
+
+	mu     sync.Mutex
+	ctx    context.Context // cancelled by Stop
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates an outbox delivering through bot
+func New(repo *repository.NotificationRepository, bot Bot, cfg config.OutboxConfig, logger *slog.Logger) *Outbox {
+	return &Outbox{
+		repo:     repo,
+		bot:      bot,
+		cfg:      cfg,
+		logger:   logger.With("component", "outbox"),
+		wake:     make(chan struct{}, 1),
+		lastSent: make(map[int64]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Observe adds an observer of delivery results. It must be called before
+// anything is queued or the outbox is started.
+func (o *Outbox) Observe(fn Observer) {
+	o.observers = append(o.observers, fn)
+}
+
+// notify passes results to the observers
+func (o *Outbox) notify(ctx context.Context, results ...Result) {
+	if len(results) == 0 {
+		return
+	}
+	for _, fn := range o.observers {
+		fn(ctx, results)
+	}
+}
+
+// Enqueue stores notifications for delivery. Notifications for chats that
+// blocked the bot are not stored; their Status is set to unreachable.
+func (o *Outbox) Enqueue(ctx context.Context, notifications ...*models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	if _, err := o.repo.Enqueue(ctx, notifications, o.now()); err != nil {
+		return err
+	}
+
+	var skipped []Result
+	for _, n := range notifications {
+		result := "queued"
+		if n.Status == models.NotificationUnreachable {
+			result = "skipped"
+			skipped = append(skipped, Result{
+				Notification: n,
+				Status:       models.NotificationUnreachable,
+				Error:        "chat is unreachable",
+				At:           o.now(),
+			})
+		}
+		metrics.NotificationsTotal.WithLabelValues(n.Kind, result).Inc()
+	}
+	o.notify(ctx, skipped...)
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// MarkReachable lets a chat that had blocked the bot receive notifications
+// again, for when the user comes back to the bot
+func (o *Outbox) MarkReachable(ctx context.Context, chatID int64) error {
+	marked, err := o.repo.MarkChatReachable(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if marked {
+		o.logger.Info("chat is reachable again", "chat_id", chatID)
+	}
+	return nil
+}
+
+// Start delivers notifications, including ones left from before a restart,
+// until ctx is cancelled or Stop is called
+func (o *Outbox) Start(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.ctx != nil {
+		return fmt.Errorf("outbox already started")
+	}
+	o.ctx, o.cancel = context.WithCancel(ctx)
+
+	o.wg.Add(1)
+	go o.loop()
+
+	return nil
+}
+
+// Stop stops delivery and waits for the message being sent, or for ctx to expire.
+// Undelivered notifications stay queued for the next start.
+func (o *Outbox) Stop(ctx context.Context) error {
+	o.mu.Lock()
+	cancel := o.cancel
+	o.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("outbox: still sending at shutdown: %w", ctx.Err())
+	}
+}
+
+// loop delivers what is due, then sleeps until the next notification is due
+// or a new one is queued
+func (o *Outbox) loop() {
+	defer o.wg.Done()
+
+	for {
+		wait := o.deliverDue()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-o.ctx.Done():
+			timer.Stop()
+			return
+		case <-o.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// deliverDue sends every due notification and returns how long to wait
+// before looking again
+func (o *Outbox) deliverDue() time.Duration {
+	if pause := o.resumeAt.Sub(o.now()); pause > 0 {
+		return pause
+	}
+
+	// Shortest wait for a chat that was skipped because it got a message
+	// less than ChatInterval ago
+	var chatWait time.Duration
+
+	for {
+		due, err := o.repo.Due(o.ctx, o.now(), batchSize)
+		if err != nil {
+			if o.ctx.Err() == nil {
+				o.logger.Error("failed to read outbox", "error", err)
+			}
+			return errorWait
+		}
+
+		o.forgetQuietChats()
+
+		sent := 0
+		for _, n := range due {
+			if wait := o.chatWait(n.ChatID); wait > 0 {
+				if chatWait == 0 || wait < chatWait {
+					chatWait = wait
+				}
+				continue
+			}
+			if !o.pace() {
+				return 0
+			}
+			pause := o.deliver(n)
+			o.lastSent[n.ChatID] = o.now()
+			sent++
+			if pause > 0 {
+				o.resumeAt = o.now().Add(pause)
+				return pause
+			}
+		}
+		if sent == 0 {
+			break
+		}
+	}
+
+	next, err := o.repo.NextAttemptAt(o.ctx)
+	if err != nil {
+		if o.ctx.Err() == nil {
+			o.logger.Error("failed to read outbox", "error", err)
+		}
+		return errorWait
+	}
+
+	wait := idleWait
+	if next != nil {
+		wait = min(max(next.Sub(o.now()), 0), idleWait)
+	}
+	// A head that is already due was skipped for its chat's interval;
+	// waiting on its due time would spin until the interval ends
+	if chatWait > 0 && (wait == 0 || chatWait < wait) {
+		wait = chatWait
+	}
+
+	return wait
+}
+
+// pace waits for the next send slot under cfg.Rate. It returns false if the
+// outbox was stopped while waiting.
+func (o *Outbox) pace() bool {
+	if wait := o.nextSend.Sub(o.now()); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-o.ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+	if o.ctx.Err() != nil {
+		return false
+	}
+
+	o.nextSend = o.now().Add(time.Second / time.Duration(o.cfg.Rate))
+	return true
+}
+
+// chatWait returns how long a chat must wait before its next message
+func (o *Outbox) chatWait(chatID int64) time.Duration {
+	last, ok := o.lastSent[chatID]
+	if !ok {
+		return 0
+	}
+	return max(o.cfg.ChatInterval-o.now().Sub(last), 0)
+}
+
+// forgetQuietChats drops chats whose last message is older than
+// ChatInterval, so lastSent stays as small as the set of busy chats
+func (o *Outbox) forgetQuietChats() {
+	for chatID := range o.lastSent {
+		if o.chatWait(chatID) == 0 {
+			delete(o.lastSent, chatID)
+		}
+	}
+}
+
+// outcome is what a failed send means for the notification
+type outcome int
+
+const (
+	transient   outcome = iota // network or server error: retry with backoff
+	throttled                  // 429: retry after the wait Telegram asked for
+	unreachable                // the user blocked the bot or the chat is gone
+	rejected                   // Telegram refused this message: retrying will not help
+)
+
+// deliver makes one delivery attempt and records its outcome. It returns how
+// long to pause all sending when Telegram's flood control was hit.
+func (o *Outbox) deliver(n *models.Notification) time.Duration {
+	logger := o.logger.With("notification_id", n.ID, "chat_id", n.ChatID, "kind", n.Kind)
+
+	sendErr := o.send(n)
+
+	// The message has left; record that even if shutdown has begun, or it
+	// would be sent a second time after the restart
+	ctx := context.WithoutCancel(o.ctx)
+	now := o.now()
+
+	if sendErr == nil {
+		if err := o.repo.MarkSent(ctx, n.ID, now); err != nil {
+			logger.Error("notification sent but not recorded", "error", err)
+		}
+		metrics.NotificationsTotal.WithLabelValues(n.Kind, "sent").Inc()
+		metrics.NotificationDelay.WithLabelValues(n.Kind).Observe(now.Sub(n.CreatedAt).Seconds())
+		o.notify(ctx, Result{Notification: n, Status: models.NotificationSent, At: now})
+		return 0
+	}
+
+	kind, retryAfter := classify(sendErr)
+	message := sendErr.Error()
+
+	switch kind {
+	case throttled:
+		wait := max(retryAfter, floodFloor)
+		logger.Warn("telegram flood control, pausing notifications", "retry_after", wait)
+		if err := o.repo.Retry(ctx, n.ID, now.Add(wait), false, message); err != nil {
+			logger.Error("failed to reschedule notification", "error", err)
+		}
+		metrics.NotificationsTotal.WithLabelValues(n.Kind, "throttled").Inc()
+		return wait
+
+	case unreachable:
+		logger.Info("chat is unreachable, dropping its notifications", "error", message)
+		dropped, err := o.repo.MarkChatUnreachable(ctx, n.ChatID, message)
+		if err != nil {
+			logger.Error("failed to mark chat unreachable", "error", err)
+			dropped = []*models.Notification{n}
+		}
+		metrics.NotificationsTotal.WithLabelValues(n.Kind, "unreachable").Inc()
+
+		results := make([]Result, len(dropped))
+		for i, d := range dropped {
+			results[i] = Result{Notification: d, Status: models.NotificationUnreachable, Error: message, At: now}
+		}
+		o.notify(ctx, results...)
+
+	case rejected:
+		// A file or caption Telegram will not take; the text alone may still go
+		if n.FileID != "" {
+			logger.Warn("notification media rejected, sending text only", "error", message)
+			n.FileID, n.MediaType = "", ""
+			return o.deliver(n)
+		}
+		logger.Warn("notification rejected by telegram", "error", message)
+		if err := o.repo.MarkFailed(ctx, n.ID, message); err != nil {
+			logger.Error("failed to mark notification failed", "error", err)
+		}
+		metrics.NotificationsTotal.WithLabelValues(n.Kind, "failed").Inc()
+		o.notify(ctx, Result{Notification: n, Status: models.NotificationFailed, Error: message, At: now})
+
+	default:
+		attempt := n.Attempts + 1
+		if attempt >= o.cfg.MaxAttempts {
+			logger.Warn("giving up on notification", "attempts", attempt, "error", message)
+			if err := o.repo.MarkFailed(ctx, n.ID, message); err != nil {
+				logger.Error("failed to mark notification failed", "error", err)
+			}
+			metrics.NotificationsTotal.WithLabelValues(n.Kind, "failed").Inc()
+			o.notify(ctx, Result{Notification: n, Status: models.NotificationFailed, Error: message, At: now})
+			return 0
+		}
+
+		wait := o.backoff(attempt)
+		logger.Warn("notification failed, will retry", "attempt", attempt, "retry_in", wait, "error", message)
+		if err := o.repo.Retry(ctx, n.ID, now.Add(wait), true, message); err != nil {
+			logger.Error("failed to reschedule notification", "error", err)
+		}
+		metrics.NotificationsTotal.WithLabelValues(n.Kind, "retried").Inc()
+	}
+
+	return 0
+}
+
+// send makes the Bot API call for a notification
+func (o *Outbox) send(n *models.Notification) error {
+	var markup any
+	if n.ReplyMarkup != "" {
+		markup = json.RawMessage(n.ReplyMarkup)
+	}
+
+	var c tgbotapi.Chattable
+	switch {
+	case n.FileID != "" && n.MediaType == models.MediaPhoto:
+		photo := tgbotapi.NewPhoto(n.ChatID, tgbotapi.FileID(n.FileID))
+		photo.Caption = n.Text
+		photo.ParseMode = tgbotapi.ModeHTML
+		photo.ReplyMarkup = markup
+		c = photo
+	case n.FileID != "":
+		doc := tgbotapi.NewDocument(n.ChatID, tgbotapi.FileID(n.FileID))
+		doc.Caption = n.Text
+		doc.ParseMode = tgbotapi.ModeHTML
+		doc.ReplyMarkup = markup
+		c = doc
+	default:
+		msg := tgbotapi.NewMessage(n.ChatID, n.Text)
+		msg.ParseMode = tgbotapi.ModeHTML
+		msg.ReplyMarkup = markup
+		c = msg
+	}
+
+	_, err := o.bot.Send(c)
+	return err
+}
+
+// backoff returns the wait before the given retry attempt
+func (o *Outbox) backoff(attempt int) time.Duration {
+	wait := o.cfg.RetryBackoff
+	for i := 1; i < attempt && wait < o.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, o.cfg.MaxBackoff)
+}
+
+// classify decides what a send error means for the notification
+func classify(err error) (outcome, time.Duration) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		// No Bot API response at all: network error or timeout
+		return transient, 0
+	}
+
+	description := strings.ToLower(apiErr.Message)
+	switch {
+	case apiErr.Code == 429 || apiErr.RetryAfter > 0:
+		return throttled, time.Duration(apiErr.RetryAfter) * time.Second
+	case apiErr.Code == 403:
+		// "bot was blocked by the user", "user is deactivated", "bot was kicked"
+		return unreachable, 0
+	case apiErr.Code == 400 && strings.Contains(description, "chat not found"):
+		return unreachable, 0
+	case apiErr.Code >= 500 || apiErr.Code == 0:
+		return transient, 0
+	default:
+		return rejected, 0
+	}
+}
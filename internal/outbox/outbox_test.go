@@ -0,0 +1,309 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/config"
+	"parent-bot/internal/database"
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+)
+
+// stubBot records the texts it sent. A text listed in errs fails with the
+// listed errors, one per attempt, before it goes through.
+type stubBot struct {
+	sent []string
+	errs map[string][]error
+}
+
+func (b *stubBot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	text := c.(tgbotapi.MessageConfig).Text
+	if errs := b.errs[text]; len(errs) > 0 {
+		b.errs[text] = errs[1:]
+		return tgbotapi.Message{}, errs[0]
+	}
+	b.sent = append(b.sent, text)
+	return tgbotapi.Message{}, nil
+}
+
+// testOutbox is an outbox on an in-memory SQLite database and a fake clock.
+// Tests call deliverDue themselves instead of starting the sender.
+type testOutbox struct {
+	*Outbox
+	bot     *stubBot
+	repo    *repository.NotificationRepository
+	results []Result
+	start   time.Time
+	clock   time.Time
+}
+
+func newTestOutbox(t *testing.T) *testOutbox {
+	t.Helper()
+
+	cfg := config.Defaults()
+	cfg.Database.Path = ":memory:"
+	if err := database.Connect(&cfg.Database); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if _, err := database.RunMigrations(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	cfg.Outbox.MaxAttempts = 4
+	cfg.Outbox.RetryBackoff = 5 * time.Second
+	cfg.Outbox.MaxBackoff = 12 * time.Second
+	cfg.Outbox.Rate = 1000
+	cfg.Outbox.ChatInterval = time.Second
+
+	to := &testOutbox{
+		bot:   &stubBot{errs: map[string][]error{}},
+		repo:  repository.NewNotificationRepository(database.DB),
+		start: time.Date(2024, 9, 2, 8, 0, 0, 0, time.UTC),
+	}
+	to.clock = to.start
+
+	to.Outbox = New(to.repo, to.bot, cfg.Outbox, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	to.now = func() time.Time { return to.clock }
+	to.ctx, to.cancel = context.WithCancel(context.Background())
+	t.Cleanup(to.cancel)
+	to.Observe(func(_ context.Context, results []Result) {
+		to.results = append(to.results, results...)
+	})
+
+	return to
+}
+
+func (to *testOutbox) advance(d time.Duration) {
+	to.clock = to.clock.Add(d)
+}
+
+// queue enqueues a notification for each text
+func (to *testOutbox) queue(t *testing.T, chatID int64, texts ...string) {
+	t.Helper()
+
+	var notifications []*models.Notification
+	for _, text := range texts {
+		notifications = append(notifications, &models.Notification{
+			ChatID: chatID,
+			Kind:   models.NotificationAnnouncement,
+			Text:   text,
+		})
+	}
+	if err := to.Enqueue(context.Background(), notifications...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stored returns the stored notification with a text
+func (to *testOutbox) stored(t *testing.T, text string) *models.Notification {
+	t.Helper()
+
+	all, err := to.repo.List(context.Background(), &models.NotificationFilter{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range all {
+		if n.Text == text {
+			return n
+		}
+	}
+	t.Fatalf("notification %q not stored", text)
+	return nil
+}
+
+func (to *testOutbox) expectSent(t *testing.T, want ...string) {
+	t.Helper()
+
+	if !slices.Equal(to.bot.sent, want) {
+		t.Fatalf("sent %q, want %q", to.bot.sent, want)
+	}
+}
+
+func TestChatOrderIsKept(t *testing.T) {
+	to := newTestOutbox(t)
+	to.queue(t, 1, "a1", "a2", "a3")
+	to.queue(t, 2, "b1")
+
+	// Only the head of each chat goes; the next one waits out the chat interval
+	if wait := to.deliverDue(); wait != time.Second {
+		t.Errorf("wait = %s, want 1s", wait)
+	}
+	to.expectSent(t, "a1", "b1")
+
+	to.advance(time.Second)
+	to.deliverDue()
+	to.expectSent(t, "a1", "b1", "a2")
+
+	to.advance(time.Second)
+	if wait := to.deliverDue(); wait != idleWait {
+		t.Errorf("wait with nothing queued = %s, want %s", wait, idleWait)
+	}
+	to.expectSent(t, "a1", "b1", "a2", "a3")
+}
+
+func TestFailedSendBacksOffAndHoldsItsChat(t *testing.T) {
+	to := newTestOutbox(t)
+	to.bot.errs["a1"] = []error{
+		errors.New("connection reset by peer"),
+		&tgbotapi.Error{Code: 502, Message: "Bad Gateway"},
+		errors.New("i/o timeout"),
+	}
+	to.queue(t, 1, "a1", "a2")
+
+	// The retry is delayed twice as long each time, up to MaxBackoff, and a2
+	// never overtakes a1 in the meantime
+	for i, backoff := range []time.Duration{5 * time.Second, 10 * time.Second, 12 * time.Second} {
+		if wait := to.deliverDue(); wait != backoff {
+			t.Errorf("attempt %d: wait = %s, want %s", i+1, wait, backoff)
+		}
+		to.expectSent(t)
+
+		n := to.stored(t, "a1")
+		if n.Attempts != i+1 || !n.NextAttemptAt.Equal(to.clock.Add(backoff)) {
+			t.Errorf("attempt %d: %d attempts, next at %s; want %d, %s",
+				i+1, n.Attempts, n.NextAttemptAt, i+1, to.clock.Add(backoff))
+		}
+
+		to.advance(backoff - time.Millisecond)
+		to.deliverDue()
+		to.expectSent(t)
+		to.advance(time.Millisecond)
+	}
+
+	to.deliverDue()
+	to.expectSent(t, "a1")
+	to.advance(time.Second)
+	to.deliverDue()
+	to.expectSent(t, "a1", "a2")
+}
+
+func TestSendIsGivenUpAfterMaxAttempts(t *testing.T) {
+	to := newTestOutbox(t)
+	for i := 0; i < 4; i++ {
+		to.bot.errs["a1"] = append(to.bot.errs["a1"], errors.New("connection refused"))
+	}
+	to.queue(t, 1, "a1")
+
+	for i := 0; i < 4; i++ {
+		to.advance(to.deliverDue())
+	}
+
+	if n := to.stored(t, "a1"); n.Status != models.NotificationFailed {
+		t.Errorf("status = %s, want %s", n.Status, models.NotificationFailed)
+	}
+	if len(to.results) != 1 || to.results[0].Status != models.NotificationFailed {
+		t.Errorf("results = %+v, want one failed", to.results)
+	}
+}
+
+func TestFloodControlPausesEveryChat(t *testing.T) {
+	to := newTestOutbox(t)
+	to.bot.errs["a1"] = []error{&tgbotapi.Error{
+		Code:               429,
+		Message:            "Too Many Requests: retry after 7",
+		ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7},
+	}}
+	to.queue(t, 1, "a1")
+	to.queue(t, 2, "b1")
+
+	if wait := to.deliverDue(); wait != 7*time.Second {
+		t.Errorf("wait = %s, want 7s", wait)
+	}
+	to.expectSent(t)
+
+	// A 429 is not the message's fault and does not count as an attempt
+	if n := to.stored(t, "a1"); n.Attempts != 0 {
+		t.Errorf("throttled send counted as attempt %d", n.Attempts)
+	}
+
+	to.advance(3 * time.Second)
+	if wait := to.deliverDue(); wait != 4*time.Second {
+		t.Errorf("wait during the pause = %s, want 4s", wait)
+	}
+	to.expectSent(t)
+
+	to.advance(4 * time.Second)
+	to.deliverDue()
+	to.expectSent(t, "a1", "b1")
+}
+
+func TestBlockedChatIsMarkedUnreachable(t *testing.T) {
+	ctx := context.Background()
+	to := newTestOutbox(t)
+	to.bot.errs["a1"] = []error{&tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}}
+	to.queue(t, 1, "a1", "a2")
+	to.queue(t, 2, "b1")
+
+	to.deliverDue()
+	to.expectSent(t, "b1")
+
+	// The chat's queued notifications are dropped along with the failed one
+	for _, text := range []string{"a1", "a2"} {
+		if n := to.stored(t, text); n.Status != models.NotificationUnreachable {
+			t.Errorf("%s: status = %s, want %s", text, n.Status, models.NotificationUnreachable)
+		}
+	}
+	var unreachable []string
+	for _, r := range to.results {
+		if r.Status == models.NotificationUnreachable {
+			unreachable = append(unreachable, r.Notification.Text)
+		}
+	}
+	if !slices.Equal(unreachable, []string{"a1", "a2"}) {
+		t.Errorf("reported unreachable %q, want a1 and a2", unreachable)
+	}
+
+	// Later notifications for the chat are not even stored
+	to.results = nil
+	to.queue(t, 1, "a3")
+	if len(to.results) != 1 || to.results[0].Notification.ID != 0 {
+		t.Errorf("results = %+v, want a3 reported unreachable without being stored", to.results)
+	}
+
+	// Until the user comes back
+	if err := to.MarkReachable(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	to.queue(t, 1, "a4")
+	to.advance(time.Second)
+	to.deliverDue()
+	to.expectSent(t, "b1", "a4")
+}
+
+func TestBulkNotificationsGoLast(t *testing.T) {
+	ctx := context.Background()
+	to := newTestOutbox(t)
+
+	var broadcast []*models.Notification
+	for _, chatID := range []int64{1, 2} {
+		broadcast = append(broadcast, &models.Notification{
+			ChatID: chatID,
+			Kind:   models.NotificationAnnouncement,
+			Text:   fmt.Sprintf("news%d", chatID),
+			Bulk:   true,
+		})
+	}
+	if err := to.Enqueue(ctx, broadcast...); err != nil {
+		t.Fatal(err)
+	}
+	to.queue(t, 3, "absent3")
+	to.queue(t, 1, "absent1")
+
+	// Alerts queued after a broadcast go first, even to a chat the broadcast
+	// reaches
+	to.deliverDue()
+	to.expectSent(t, "absent3", "absent1", "news2")
+
+	to.advance(time.Second)
+	to.deliverDue()
+	to.expectSent(t, "absent3", "absent1", "news2", "news1")
+}
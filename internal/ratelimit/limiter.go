@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Roles with separate limits
+const (
+	RoleAdmin   = "admin"
+	RoleTeacher = "teacher"
+	RoleParent  = "parent"
+)
+
+// sweepInterval is how often idle buckets are dropped from memory
+const sweepInterval = 10 * time.Minute
+
+// Limit allows Requests per Per, refilled continuously
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Unlimited reports whether the limit disables throttling
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// bucket is a token bucket for one user
+type bucket struct {
+	role     string
+	tokens   float64
+	last     time.Time
+	notified bool // user was already told to slow down in this burst
+}
+
+// Limiter keeps a token bucket per Telegram user with per-role limits
+type Limiter struct {
+	mu           sync.Mutex
+	defaultLimit Limit
+	limits       map[string]Limit
+	buckets      map[int64]*bucket
+	lastSweep    time.Time
+	now          func() time.Time // replaced in tests
+}
+
+// New creates a limiter that applies defaultLimit to roles without their own limit
+func New(defaultLimit Limit) *Limiter {
+	return &Limiter{
+		defaultLimit: defaultLimit,
+		limits:       make(map[string]Limit),
+		buckets:      make(map[int64]*bucket),
+		lastSweep:    time.Now(),
+		now:          time.Now,
+	}
+}
+
+// SetDefaultLimit sets the limit for roles without their own limit
+func (l *Limiter) SetDefaultLimit(limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.defaultLimit = limit
+}
+
+// ClearLimit makes a role use the default limit again
+func (l *Limiter) ClearLimit(role string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.limits, role)
+}
+
+// SetLimit sets the limit for a role. A zero limit exempts the role.
+func (l *Limiter) SetLimit(role string, limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits[role] = limit
+}
+
+// limitFor returns the limit for a role (caller must hold mu)
+func (l *Limiter) limitFor(role string) Limit {
+	if limit, ok := l.limits[role]; ok {
+		return limit
+	}
+	return l.defaultLimit
+}
+
+// Allow consumes a token for the user. It returns whether the request may
+// proceed and, if not, whether this is the first rejection of the current
+// burst (so the caller can reply once instead of on every tap).
+func (l *Limiter) Allow(userID int64, role string) (allowed bool, notify bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[userID]
+	limit := l.limitFor(role)
+	if limit.Unlimited() {
+		// Only the role is kept for exempt users; seen now, it isn't swept
+		if ok && b.role == role {
+			b.last = now
+		}
+		return true, false
+	}
+
+	if !ok || b.role != role {
+		b = &bucket{role: role, tokens: float64(limit.Requests), last: now}
+		l.buckets[userID] = b
+	}
+
+	// Refill proportionally to elapsed time
+	rate := float64(limit.Requests) / limit.Per.Seconds()
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(limit.Requests) {
+		b.tokens = float64(limit.Requests)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.notified = false
+		return true, false
+	}
+
+	notify = !b.notified
+	b.notified = true
+	return false, notify
+}
+
+// Role returns the role a user was last limited as, or RoleParent for users
+// the limiter hasn't seen. It lets updates be limited before the sender is
+// looked up.
+func (l *Limiter) Role(userID int64) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[userID]; ok {
+		return b.role
+	}
+	return RoleParent
+}
+
+// SetRole records the role a user turned out to have, for their next
+// updates. Tokens left in the current burst carry over, up to the new limit.
+func (l *Limiter) SetRole(userID int64, role string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[userID]
+	if !ok {
+		limit := l.limitFor(role)
+		b = &bucket{role: role, tokens: float64(limit.Requests), last: l.now()}
+		l.buckets[userID] = b
+		return
+	}
+	if b.role == role {
+		return
+	}
+
+	b.role = role
+	if limit := l.limitFor(role); b.tokens > float64(limit.Requests) {
+		b.tokens = float64(limit.Requests)
+	}
+}
+
+// sweep drops buckets that have been idle long enough to be full again
+// (caller must hold mu)
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for userID, b := range l.buckets {
+		// Exempt users are kept while active, so their updates are not
+		// limited as a parent's until the role is looked up again
+		idle := sweepInterval
+		if limit := l.limitFor(b.role); !limit.Unlimited() {
+			idle = limit.Per
+		}
+		if now.Sub(b.last) >= idle {
+			delete(l.buckets, userID)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter on a clock the test moves with advance
+func newTestLimiter(defaultLimit Limit) (*Limiter, func(time.Duration)) {
+	now := time.Date(2024, 9, 2, 8, 0, 0, 0, time.UTC)
+
+	l := New(defaultLimit)
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestTokensRefill(t *testing.T) {
+	l, advance := newTestLimiter(Limit{Requests: 2, Per: time.Second})
+	const user = 1
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow(user, RoleParent); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+
+	// Only the first rejection of a burst asks to notify the user
+	if ok, notify := l.Allow(user, RoleParent); ok || !notify {
+		t.Errorf("third request = %v, notify %v; want refused and notify", ok, notify)
+	}
+	if ok, notify := l.Allow(user, RoleParent); ok || notify {
+		t.Errorf("fourth request = %v, notify %v; want refused quietly", ok, notify)
+	}
+
+	// Half the period refills one token
+	advance(500 * time.Millisecond)
+	if ok, _ := l.Allow(user, RoleParent); !ok {
+		t.Error("request after a partial refill refused")
+	}
+	if ok, notify := l.Allow(user, RoleParent); ok || !notify {
+		t.Errorf("request past the refill = %v, notify %v; want refused and notify", ok, notify)
+	}
+
+	// A long pause refills up to the limit, not beyond
+	advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow(user, RoleParent); !ok {
+			t.Fatalf("request %d after a pause refused", i+1)
+		}
+	}
+	if ok, _ := l.Allow(user, RoleParent); ok {
+		t.Error("bucket refilled past its limit")
+	}
+}
+
+func TestRolesHaveTheirOwnLimits(t *testing.T) {
+	l, _ := newTestLimiter(Limit{Requests: 1, Per: time.Minute})
+	l.SetLimit(RoleTeacher, Limit{Requests: 3, Per: time.Minute})
+
+	allowed := func(user int64, role string) int {
+		n := 0
+		for i := 0; i < 10; i++ {
+			if ok, _ := l.Allow(user, role); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := allowed(1, RoleParent); n != 1 {
+		t.Errorf("parent allowed %d requests, want 1", n)
+	}
+	if n := allowed(2, RoleTeacher); n != 3 {
+		t.Errorf("teacher allowed %d requests, want 3", n)
+	}
+
+	// Clearing the role's limit falls back to the default
+	l.ClearLimit(RoleTeacher)
+	if n := allowed(3, RoleTeacher); n != 1 {
+		t.Errorf("teacher allowed %d requests after ClearLimit, want 1", n)
+	}
+}
+
+func TestExemptRoleIsNotLimited(t *testing.T) {
+	l, _ := newTestLimiter(Limit{Requests: 1, Per: time.Minute})
+	l.SetLimit(RoleAdmin, Limit{})
+	const admin = 1
+
+	l.SetRole(admin, RoleAdmin)
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow(admin, RoleAdmin); !ok {
+			t.Fatalf("exempt request %d refused", i+1)
+		}
+	}
+	if role := l.Role(admin); role != RoleAdmin {
+		t.Errorf("Role = %q, want %q", role, RoleAdmin)
+	}
+}
+
+func TestSetRoleCapsTokens(t *testing.T) {
+	l, _ := newTestLimiter(Limit{Requests: 1, Per: time.Minute})
+	l.SetLimit(RoleTeacher, Limit{Requests: 5, Per: time.Minute})
+	const user = 1
+
+	// Limited as a parent before the sender was looked up
+	if ok, _ := l.Allow(user, l.Role(user)); !ok {
+		t.Fatal("first request refused")
+	}
+	l.SetRole(user, RoleTeacher)
+	if role := l.Role(user); role != RoleTeacher {
+		t.Fatalf("Role = %q, want %q", role, RoleTeacher)
+	}
+
+	// The spent parent burst carries over instead of resetting to the teacher's
+	if ok, _ := l.Allow(user, RoleTeacher); ok {
+		t.Error("SetRole refilled the bucket")
+	}
+}
+
+func TestSweepDropsIdleBuckets(t *testing.T) {
+	l, advance := newTestLimiter(Limit{Requests: 5, Per: time.Minute})
+	l.SetLimit(RoleAdmin, Limit{})
+	const (
+		teacher      = 1
+		activeAdmin  = 2
+		idleAdmin    = 3
+		otherRequest = 4
+	)
+
+	l.SetRole(teacher, RoleTeacher)
+	l.SetRole(activeAdmin, RoleAdmin)
+	l.SetRole(idleAdmin, RoleAdmin)
+
+	// The active admin keeps sending while the others stay quiet
+	for elapsed := time.Duration(0); elapsed <= sweepInterval; elapsed += time.Minute {
+		advance(time.Minute)
+		l.Allow(activeAdmin, RoleAdmin)
+	}
+	l.Allow(otherRequest, RoleParent)
+
+	if _, ok := l.buckets[teacher]; ok {
+		t.Error("idle limited bucket kept")
+	}
+	if _, ok := l.buckets[idleAdmin]; ok {
+		t.Error("idle exempt bucket kept")
+	}
+	if role := l.Role(activeAdmin); role != RoleAdmin {
+		t.Errorf("active exempt user's role = %q, want %q", role, RoleAdmin)
+	}
+	if role := l.Role(idleAdmin); role != RoleParent {
+		t.Errorf("swept user's role = %q, want %q", role, RoleParent)
+	}
+}
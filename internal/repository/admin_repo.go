@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -15,20 +16,21 @@ func NewAdminRepository(db *sql.DB) *AdminRepository {
 	return &AdminRepository{db: db}
 }
 
-// Create creates a new admin
-func (r *AdminRepository) Create(phoneNumber, name string) (*models.Admin, error) {
+// Create creates a new admin with a staff role
+func (r *AdminRepository) Create(ctx context.Context, phoneNumber, name, role string) (*models.Admin, error) {
 	query := `
-		INSERT INTO admins (phone_number, name)
-		VALUES (?, ?)
-		RETURNING id, phone_number, telegram_id, name, added_at
+		INSERT INTO admins (phone_number, name, role)
+		VALUES (?, ?, ?)
+		RETURNING id, phone_number, telegram_id, name, role, added_at
 	`
 
 	var admin models.Admin
-	err := r.db.QueryRow(query, phoneNumber, name).Scan(
+	err := r.db.QueryRowContext(ctx, query, phoneNumber, name, role).Scan(
 		&admin.ID,
 		&admin.PhoneNumber,
 		&admin.TelegramID,
 		&admin.Name,
+		&admin.Role,
 		&admin.AddedAt,
 	)
 
@@ -40,19 +42,20 @@ func (r *AdminRepository) Create(phoneNumber, name string) (*models.Admin, error
 }
 
 // GetByPhoneNumber gets admin by phone number (indexed, fast query)
-func (r *AdminRepository) GetByPhoneNumber(phoneNumber string) (*models.Admin, error) {
+func (r *AdminRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.Admin, error) {
 	query := `
-		SELECT id, phone_number, telegram_id, name, added_at
+		SELECT id, phone_number, telegram_id, name, role, added_at
 		FROM admins
 		WHERE phone_number = ?
 	`
 
 	var admin models.Admin
-	err := r.db.QueryRow(query, phoneNumber).Scan(
+	err := r.db.QueryRowContext(ctx, query, phoneNumber).Scan(
 		&admin.ID,
 		&admin.PhoneNumber,
 		&admin.TelegramID,
 		&admin.Name,
+		&admin.Role,
 		&admin.AddedAt,
 	)
 
@@ -68,19 +71,20 @@ func (r *AdminRepository) GetByPhoneNumber(phoneNumber string) (*models.Admin, e
 }
 
 // GetByTelegramID gets admin by telegram ID (indexed, fast query)
-func (r *AdminRepository) GetByTelegramID(telegramID int64) (*models.Admin, error) {
+func (r *AdminRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*models.Admin, error) {
 	query := `
-		SELECT id, phone_number, telegram_id, name, added_at
+		SELECT id, phone_number, telegram_id, name, role, added_at
 		FROM admins
 		WHERE telegram_id = ?
 	`
 
 	var admin models.Admin
-	err := r.db.QueryRow(query, telegramID).Scan(
+	err := r.db.QueryRowContext(ctx, query, telegramID).Scan(
 		&admin.ID,
 		&admin.PhoneNumber,
 		&admin.TelegramID,
 		&admin.Name,
+		&admin.Role,
 		&admin.AddedAt,
 	)
 
@@ -96,14 +100,14 @@ func (r *AdminRepository) GetByTelegramID(telegramID int64) (*models.Admin, erro
 }
 
 // GetAll gets all admins
-func (r *AdminRepository) GetAll() ([]*models.Admin, error) {
+func (r *AdminRepository) GetAll(ctx context.Context) ([]*models.Admin, error) {
 	query := `
-		SELECT id, phone_number, telegram_id, name, added_at
+		SELECT id, phone_number, telegram_id, name, role, added_at
 		FROM admins
 		ORDER BY added_at ASC
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get admins: %w", err)
 	}
@@ -117,6 +121,7 @@ func (r *AdminRepository) GetAll() ([]*models.Admin, error) {
 			&admin.PhoneNumber,
 			&admin.TelegramID,
 			&admin.Name,
+			&admin.Role,
 			&admin.AddedAt,
 		)
 		if err != nil {
@@ -129,18 +134,36 @@ func (r *AdminRepository) GetAll() ([]*models.Admin, error) {
 }
 
 // UpdateTelegramID updates admin telegram ID
-func (r *AdminRepository) UpdateTelegramID(phoneNumber string, telegramID int64) error {
+func (r *AdminRepository) UpdateTelegramID(ctx context.Context, phoneNumber string, telegramID int64) error {
 	query := `UPDATE admins SET telegram_id = ? WHERE phone_number = ?`
-	_, err := r.db.Exec(query, telegramID, phoneNumber)
+	_, err := r.db.ExecContext(ctx, query, telegramID, phoneNumber)
 	if err != nil {
 		return fmt.Errorf("failed to update admin telegram ID: %w", err)
 	}
 	return nil
 }
 
+// Find gets the admin with a phone number or Telegram ID, nil if neither
+// matches. An empty phone number or zero ID is not matched; the phone number
+// wins if they match different admins.
+func (r *AdminRepository) Find(ctx context.Context, phoneNumber string, telegramID int64) (*models.Admin, error) {
+	if phoneNumber != "" {
+		admin, err := r.GetByPhoneNumber(ctx, phoneNumber)
+		if err != nil || admin != nil {
+			return admin, err
+		}
+	}
+
+	if telegramID != 0 {
+		return r.GetByTelegramID(ctx, telegramID)
+	}
+
+	return nil, nil
+}
+
 // IsAdmin checks if phone number or telegram ID is an admin
 // Note: Empty phone numbers are ignored to avoid false matches
-func (r *AdminRepository) IsAdmin(phoneNumber string, telegramID int64) (bool, error) {
+func (r *AdminRepository) IsAdmin(ctx context.Context, phoneNumber string, telegramID int64) (bool, error) {
 	// Build dynamic query based on what parameters are provided
 	var query string
 	var args []any
@@ -178,7 +201,7 @@ func (r *AdminRepository) IsAdmin(phoneNumber string, telegramID int64) (bool, e
 	}
 
 	var exists bool
-	err := r.db.QueryRow(query, args...).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check admin: %w", err)
 	}
@@ -187,9 +210,29 @@ func (r *AdminRepository) IsAdmin(phoneNumber string, telegramID int64) (bool, e
 }
 
 // Count counts total admins
-func (r *AdminRepository) Count() (int, error) {
+func (r *AdminRepository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM admins").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count admins: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateRole changes an admin's staff role
+func (r *AdminRepository) UpdateRole(ctx context.Context, phoneNumber, role string) error {
+	query := `UPDATE admins SET role = ?, updated_at = CURRENT_TIMESTAMP WHERE phone_number = ?`
+	_, err := r.db.ExecContext(ctx, query, role, phoneNumber)
+	if err != nil {
+		return fmt.Errorf("failed to update admin role: %w", err)
+	}
+	return nil
+}
+
+// CountByRole counts admins with a staff role
+func (r *AdminRepository) CountByRole(ctx context.Context, role string) (int, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM admins").Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM admins WHERE role = ?", role).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count admins: %w", err)
 	}
@@ -197,9 +240,9 @@ func (r *AdminRepository) Count() (int, error) {
 }
 
 // Delete deletes an admin by phone number
-func (r *AdminRepository) Delete(phoneNumber string) error {
+func (r *AdminRepository) Delete(ctx context.Context, phoneNumber string) error {
 	query := `DELETE FROM admins WHERE phone_number = ?`
-	_, err := r.db.Exec(query, phoneNumber)
+	_, err := r.db.ExecContext(ctx, query, phoneNumber)
 	if err != nil {
 		return fmt.Errorf("failed to delete admin: %w", err)
 	}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"parent-bot/internal/database"
+	"parent-bot/internal/models"
+)
+
+// AnnouncementDeliveryRepository records who an announcement was sent to
+type AnnouncementDeliveryRepository struct {
+	db      database.DBTX
+	dialect database.Dialect
+}
+
+// NewAnnouncementDeliveryRepository creates a new announcement delivery repository
+func NewAnnouncementDeliveryRepository(db *sql.DB) *AnnouncementDeliveryRepository {
+	return &AnnouncementDeliveryRepository{db: db, dialect: database.DialectOf(db)}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx
+func (r *AnnouncementDeliveryRepository) WithTx(tx *sql.Tx) *AnnouncementDeliveryRepository {
+	return &AnnouncementDeliveryRepository{db: tx, dialect: r.dialect}
+}
+
+// Queue records the users as queued recipients of an announcement, not yet in
+// the outbox. Users who already have a delivery, such as failed ones being
+// resent, start over.
+func (r *AnnouncementDeliveryRepository) Queue(ctx context.Context, announcementID int, users []*models.User, now time.Time) error {
+	query := `
+		INSERT INTO announcement_deliveries (announcement_id, user_id, chat_id, status, queued_at, updated_at)
+		VALUES (?, ?, ?, 'queued', ?, ?)
+		ON CONFLICT (announcement_id, user_id) DO UPDATE SET
+			chat_id = excluded.chat_id,
+			status = 'queued',
+			error = '',
+			queued_at = excluded.queued_at,
+			sent_at = NULL,
+			enqueued_at = NULL,
+			updated_at = excluded.updated_at
+	`
+
+	return database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		for _, user := range users {
+			_, err := tx.ExecContext(ctx, query, announcementID, user.ID, user.TelegramID, now.UTC(), now.UTC())
+			if err != nil {
+				return fmt.Errorf("failed to record announcement delivery: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// MarkEnqueued records that the users' notifications of an announcement are
+// in the outbox
+func (r *AnnouncementDeliveryRepository) MarkEnqueued(ctx context.Context, announcementID int, users []*models.User, now time.Time) error {
+	query := `
+		UPDATE announcement_deliveries
+		SET enqueued_at = ?, updated_at = ?
+		WHERE announcement_id = ? AND user_id = ?
+	`
+
+	return database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		for _, user := range users {
+			_, err := tx.ExecContext(ctx, query, now.UTC(), now.UTC(), announcementID, user.ID)
+			if err != nil {
+				return fmt.Errorf("failed to mark announcement delivery enqueued: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Record sets the outcome of the queued delivery of an announcement to a chat
+func (r *AnnouncementDeliveryRepository) Record(ctx context.Context, announcementID int, chatID int64, status, errorText string, at time.Time) error {
+	var sentAt *time.Time
+	if status == models.DeliverySent {
+		utc := at.UTC()
+		sentAt = &utc
+	}
+
+	query := `
+		UPDATE announcement_deliveries
+		SET status = ?, error = ?, sent_at = ?, updated_at = ?
+		WHERE announcement_id = ? AND chat_id = ? AND status = 'queued'
+	`
+
+	_, err := r.db.ExecContext(ctx, query, status, errorText, sentAt, at.UTC(), announcementID, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to update announcement delivery: %w", err)
+	}
+
+	return nil
+}
+
+// Summary counts the deliveries of an announcement by status
+func (r *AnnouncementDeliveryRepository) Summary(ctx context.Context, announcementID int) (*models.DeliverySummary, error) {
+	query := `
+		SELECT status, COUNT(*)
+		FROM announcement_deliveries
+		WHERE announcement_id = ?
+		GROUP BY status
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, announcementID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count announcement deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var summary models.DeliverySummary
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery count: %w", err)
+		}
+
+		switch status {
+		case models.DeliveryQueued:
+			summary.Queued = count
+		case models.DeliverySent:
+			summary.Sent = count
+		case models.DeliveryFailed:
+			summary.Failed = count
+		case models.DeliveryBlocked:
+			summary.Blocked = count
+		}
+	}
+
+	return &summary, rows.Err()
+}
+
+// GetFailedRecipients gets up to limit users whose delivery of an
+// announcement failed, ordered by ID. Pass the last ID of a page as afterID
+// to get the next one.
+func (r *AnnouncementDeliveryRepository) GetFailedRecipients(ctx context.Context, announcementID, afterID, limit int) ([]*models.User, error) {
+	users, err := r.getRecipients(ctx, "d.status = 'failed'", announcementID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failed recipients: %w", err)
+	}
+	return users, nil
+}
+
+// GetPendingRecipients gets up to limit users recorded as recipients of an
+// announcement whose notification is not in the outbox yet, ordered by ID
+func (r *AnnouncementDeliveryRepository) GetPendingRecipients(ctx context.Context, announcementID, afterID, limit int) ([]*models.User, error) {
+	users, err := r.getRecipients(ctx, "d.status = 'queued' AND d.enqueued_at IS NULL", announcementID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending recipients: %w", err)
+	}
+	return users, nil
+}
+
+// GetPendingAnnouncementIDs gets the announcements that have recipients
+// whose notification is not in the outbox yet, such as ones whose broadcast
+// was stopped by a shutdown
+func (r *AnnouncementDeliveryRepository) GetPendingAnnouncementIDs(ctx context.Context) ([]int, error) {
+	query := `
+		SELECT DISTINCT announcement_id
+		FROM announcement_deliveries
+		WHERE status = 'queued' AND enqueued_at IS NULL
+		ORDER BY announcement_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get announcements with pending deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan announcement ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// getRecipients gets a page of the users whose delivery of an announcement
+// matches condition, ordered by ID
+func (r *AnnouncementDeliveryRepository) getRecipients(ctx context.Context, condition string, announcementID, afterID, limit int) ([]*models.User, error) {
+	query := `
+		SELECT u.id, u.telegram_id, u.telegram_username, u.phone_number,
+		       u.language, u.registered_at
+		FROM announcement_deliveries d
+		INNER JOIN users u ON d.user_id = u.id
+		WHERE d.announcement_id = ? AND ` + condition + ` AND u.id > ?
+		ORDER BY u.id
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, announcementID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(
+			&user.ID,
+			&user.TelegramID,
+			&user.TelegramUsername,
+			&user.PhoneNumber,
+			&user.Language,
+			&user.RegisteredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
@@ -1,9 +1,11 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
+	"parent-bot/internal/database"
 	"parent-bot/internal/models"
 )
 
@@ -15,44 +17,85 @@ func NewAnnouncementRepository(db *sql.DB) *AnnouncementRepository {
 	return &AnnouncementRepository{db: db}
 }
 
-// Create creates a new announcement
-func (r *AnnouncementRepository) Create(req *models.CreateAnnouncementRequest) (*models.Announcement, error) {
+// Create creates a new announcement together with its target classes
+func (r *AnnouncementRepository) Create(ctx context.Context, req *models.CreateAnnouncementRequest) (*models.Announcement, error) {
 	query := `
-		INSERT INTO announcements (title, content, telegram_file_id, filename, file_type, admin_id)
-		VALUES (?, ?, ?, ?, ?, ?)
-		RETURNING id, title, content, telegram_file_id, filename, file_type, admin_id, created_at, is_active
+		INSERT INTO announcements (title, content, telegram_file_id, filename, file_type, admin_id, teacher_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, title, content, telegram_file_id, filename, file_type, admin_id, teacher_id, created_at, is_active
 	`
 
 	var announcement models.Announcement
-	err := r.db.QueryRow(
-		query,
-		req.Title,
-		req.Content,
-		req.TelegramFileID,
-		req.Filename,
-		req.FileType,
-		req.PostedByAdminID,
-	).Scan(
-		&announcement.ID,
-		&announcement.Title,
-		&announcement.Content,
-		&announcement.TelegramFileID,
-		&announcement.Filename,
-		&announcement.FileType,
-		&announcement.PostedByAdminID,
-		&announcement.CreatedAt,
-		&announcement.IsActive,
-	)
+	err := database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			query,
+			req.Title,
+			req.Content,
+			req.TelegramFileID,
+			req.Filename,
+			req.FileType,
+			req.PostedByAdminID,
+			req.PostedByTeacherID,
+		).Scan(
+			&announcement.ID,
+			&announcement.Title,
+			&announcement.Content,
+			&announcement.TelegramFileID,
+			&announcement.Filename,
+			&announcement.FileType,
+			&announcement.PostedByAdminID,
+			&announcement.PostedByTeacherID,
+			&announcement.CreatedAt,
+			&announcement.IsActive,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create announcement: %w", err)
+		}
+
+		for _, classID := range req.ClassIDs {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO announcement_classes (announcement_id, class_id) VALUES (?, ?)`,
+				announcement.ID, classID,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to add announcement class: %w", err)
+			}
+		}
 
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create announcement: %w", err)
+		return nil, err
 	}
 
 	return &announcement, nil
 }
 
+// GetClassIDs gets the classes an announcement was posted to. Announcements
+// posted by admins have none and are meant for the whole school.
+func (r *AnnouncementRepository) GetClassIDs(ctx context.Context, announcementID int) ([]int, error) {
+	query := `SELECT class_id FROM announcement_classes WHERE announcement_id = ? ORDER BY class_id`
+
+	rows, err := r.db.QueryContext(ctx, query, announcementID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get announcement classes: %w", err)
+	}
+	defer rows.Close()
+
+	var classIDs []int
+	for rows.Next() {
+		var classID int
+		if err := rows.Scan(&classID); err != nil {
+			return nil, fmt.Errorf("failed to scan class: %w", err)
+		}
+		classIDs = append(classIDs, classID)
+	}
+
+	return classIDs, rows.Err()
+}
+
 // GetByID gets announcement by ID
-func (r *AnnouncementRepository) GetByID(id int) (*models.Announcement, error) {
+func (r *AnnouncementRepository) GetByID(ctx context.Context, id int) (*models.Announcement, error) {
 	query := `
 		SELECT id, title, content, telegram_file_id, filename, file_type, admin_id, teacher_id, created_at, is_active
 		FROM announcements
@@ -60,7 +103,7 @@ func (r *AnnouncementRepository) GetByID(id int) (*models.Announcement, error) {
 	`
 
 	var announcement models.Announcement
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&announcement.ID,
 		&announcement.Title,
 		&announcement.Content,
@@ -85,16 +128,16 @@ func (r *AnnouncementRepository) GetByID(id int) (*models.Announcement, error) {
 }
 
 // GetActive gets all active announcements with pagination
-func (r *AnnouncementRepository) GetActive(limit, offset int) ([]*models.Announcement, error) {
+func (r *AnnouncementRepository) GetActive(ctx context.Context, limit, offset int) ([]*models.Announcement, error) {
 	query := `
 		SELECT id, title, content, telegram_file_id, filename, file_type, admin_id, teacher_id, created_at, is_active
 		FROM announcements
-		WHERE is_active = 1
+		WHERE is_active = TRUE
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get active announcements: %w", err)
 	}
@@ -125,7 +168,7 @@ func (r *AnnouncementRepository) GetActive(limit, offset int) ([]*models.Announc
 }
 
 // GetAll gets all announcements with pagination (for admin)
-func (r *AnnouncementRepository) GetAll(limit, offset int) ([]*models.Announcement, error) {
+func (r *AnnouncementRepository) GetAll(ctx context.Context, limit, offset int) ([]*models.Announcement, error) {
 	query := `
 		SELECT id, title, content, telegram_file_id, filename, file_type, admin_id, teacher_id, created_at, is_active
 		FROM announcements
@@ -133,7 +176,7 @@ func (r *AnnouncementRepository) GetAll(limit, offset int) ([]*models.Announceme
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get announcements: %w", err)
 	}
@@ -164,7 +207,7 @@ func (r *AnnouncementRepository) GetAll(limit, offset int) ([]*models.Announceme
 }
 
 // Update updates an existing announcement
-func (r *AnnouncementRepository) Update(id int, req *models.CreateAnnouncementRequest) (*models.Announcement, error) {
+func (r *AnnouncementRepository) Update(ctx context.Context, id int, req *models.CreateAnnouncementRequest) (*models.Announcement, error) {
 	query := `
 		UPDATE announcements
 		SET title = ?, content = ?, telegram_file_id = ?, filename = ?, file_type = ?
@@ -173,7 +216,7 @@ func (r *AnnouncementRepository) Update(id int, req *models.CreateAnnouncementRe
 	`
 
 	var announcement models.Announcement
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(ctx,
 		query,
 		req.Title,
 		req.Content,
@@ -201,9 +244,9 @@ func (r *AnnouncementRepository) Update(id int, req *models.CreateAnnouncementRe
 }
 
 // ToggleActive toggles the active status of an announcement
-func (r *AnnouncementRepository) ToggleActive(id int) error {
-	query := `UPDATE announcements SET is_active = CASE WHEN is_active = 1 THEN 0 ELSE 1 END WHERE id = ?`
-	_, err := r.db.Exec(query, id)
+func (r *AnnouncementRepository) ToggleActive(ctx context.Context, id int) error {
+	query := `UPDATE announcements SET is_active = NOT is_active WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to toggle announcement active status: %w", err)
 	}
@@ -211,9 +254,9 @@ func (r *AnnouncementRepository) ToggleActive(id int) error {
 }
 
 // Delete deletes an announcement
-func (r *AnnouncementRepository) Delete(id int) error {
+func (r *AnnouncementRepository) Delete(ctx context.Context, id int) error {
 	query := `DELETE FROM announcements WHERE id = ?`
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete announcement: %w", err)
 	}
@@ -221,9 +264,9 @@ func (r *AnnouncementRepository) Delete(id int) error {
 }
 
 // Count counts total announcements
-func (r *AnnouncementRepository) Count() (int, error) {
+func (r *AnnouncementRepository) Count(ctx context.Context) (int, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM announcements").Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM announcements").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count announcements: %w", err)
 	}
@@ -231,10 +274,10 @@ func (r *AnnouncementRepository) Count() (int, error) {
 }
 
 // CountActive counts active announcements
-func (r *AnnouncementRepository) CountActive() (int, error) {
+func (r *AnnouncementRepository) CountActive(ctx context.Context) (int, error) {
 	var count int
-	query := `SELECT COUNT(*) FROM announcements WHERE is_active = 1`
-	err := r.db.QueryRow(query).Scan(&count)
+	query := `SELECT COUNT(*) FROM announcements WHERE is_active = TRUE`
+	err := r.db.QueryRowContext(ctx, query).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count active announcements: %w", err)
 	}
@@ -242,7 +285,7 @@ func (r *AnnouncementRepository) CountActive() (int, error) {
 }
 
 // GetByTeacherID gets all announcements posted by a specific teacher
-func (r *AnnouncementRepository) GetByTeacherID(teacherID int, limit, offset int) ([]*models.AnnouncementWithClasses, error) {
+func (r *AnnouncementRepository) GetByTeacherID(ctx context.Context, teacherID int, limit, offset int) ([]*models.AnnouncementWithClasses, error) {
 	query := `
 		SELECT
 			a.id, a.title, a.content, a.telegram_file_id, a.filename, a.file_type,
@@ -253,7 +296,7 @@ func (r *AnnouncementRepository) GetByTeacherID(teacherID int, limit, offset int
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, teacherID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, teacherID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get teacher announcements: %w", err)
 	}
@@ -277,16 +320,24 @@ func (r *AnnouncementRepository) GetByTeacherID(teacherID int, limit, offset int
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan announcement: %w", err)
 		}
-
-		// Get associated classes
-		classQuery := `
-			SELECT ac.class_id, c.class_name
-			FROM announcement_classes ac
-			JOIN classes c ON ac.class_id = c.id
-			WHERE ac.announcement_id = ?
-			ORDER BY c.class_name
-		`
-		classRows, err := r.db.Query(classQuery, a.ID)
+		announcements = append(announcements, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get teacher announcements: %w", err)
+	}
+	rows.Close()
+
+	// Get associated classes once the announcements are read; SQLite has a
+	// single connection, so the queries cannot overlap
+	classQuery := `
+		SELECT ac.class_id, c.class_name
+		FROM announcement_classes ac
+		JOIN classes c ON ac.class_id = c.id
+		WHERE ac.announcement_id = ?
+		ORDER BY c.class_name
+	`
+	for _, a := range announcements {
+		classRows, err := r.db.QueryContext(ctx, classQuery, a.ID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get announcement classes: %w", err)
 		}
@@ -307,8 +358,6 @@ func (r *AnnouncementRepository) GetByTeacherID(teacherID int, limit, offset int
 
 		a.ClassIDs = classIDs
 		a.ClassNames = classNames
-
-		announcements = append(announcements, &a)
 	}
 
 	return announcements, nil
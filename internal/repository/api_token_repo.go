@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"parent-bot/internal/models"
+)
+
+// APITokenRepository handles admin API token data operations
+type APITokenRepository struct {
+	db *sql.DB
+}
+
+// NewAPITokenRepository creates a new API token repository
+func NewAPITokenRepository(db *sql.DB) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+// Create creates a new token record
+func (r *APITokenRepository) Create(ctx context.Context, adminID int, name, scope string) (*models.APIToken, error) {
+	query := `
+		INSERT INTO api_tokens (admin_id, name, scope)
+		VALUES (?, ?, ?)
+		RETURNING id, admin_id, name, scope, created_at, last_used_at, revoked_at
+	`
+
+	var token models.APIToken
+	err := r.db.QueryRowContext(ctx, query, adminID, name, scope).Scan(
+		&token.ID,
+		&token.AdminID,
+		&token.Name,
+		&token.Scope,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.RevokedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// GetByID gets a token by ID
+func (r *APITokenRepository) GetByID(ctx context.Context, id int) (*models.APIToken, error) {
+	query := `
+		SELECT t.id, t.admin_id, t.name, t.scope, t.created_at, t.last_used_at, t.revoked_at,
+		       COALESCE(a.role, '')
+		FROM api_tokens t
+		LEFT JOIN admins a ON a.id = t.admin_id
+		WHERE t.id = ?
+	`
+
+	var token models.APIToken
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&token.ID,
+		&token.AdminID,
+		&token.Name,
+		&token.Scope,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.RevokedAt,
+		&token.AdminRole,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// GetAll gets all tokens, newest first
+func (r *APITokenRepository) GetAll(ctx context.Context) ([]*models.APIToken, error) {
+	query := `
+		SELECT t.id, t.admin_id, t.name, t.scope, t.created_at, t.last_used_at, t.revoked_at,
+		       COALESCE(a.role, '')
+		FROM api_tokens t
+		LEFT JOIN admins a ON a.id = t.admin_id
+		ORDER BY t.created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*models.APIToken
+	for rows.Next() {
+		var token models.APIToken
+		err := rows.Scan(
+			&token.ID,
+			&token.AdminID,
+			&token.Name,
+			&token.Scope,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.RevokedAt,
+			&token.AdminRole,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api token: %w", err)
+		}
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, nil
+}
+
+// Revoke marks a token as revoked
+func (r *APITokenRepository) Revoke(ctx context.Context, id int) error {
+	query := `UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api token: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("token not found or already revoked")
+	}
+
+	return nil
+}
+
+// TouchLastUsed records that a token was just used
+func (r *APITokenRepository) TouchLastUsed(ctx context.Context, id int) error {
+	query := `UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to update api token usage: %w", err)
+	}
+	return nil
+}
@@ -1,30 +1,40 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"time"
 
+	"parent-bot/internal/database"
 	"parent-bot/internal/models"
 )
 
 // AttendanceRepository handles attendance data operations
 type AttendanceRepository struct {
-	db *sql.DB
+	db       database.DBTX
+	dialect  database.Dialect
+	location *time.Location // the school's timezone, which decides what "today" is
 }
 
 // NewAttendanceRepository creates a new attendance repository
-func NewAttendanceRepository(db *sql.DB) *AttendanceRepository {
-	return &AttendanceRepository{db: db}
+func NewAttendanceRepository(db *sql.DB, location *time.Location) *AttendanceRepository {
+	return &AttendanceRepository{db: db, dialect: database.DialectOf(db), location: location}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx
+func (r *AttendanceRepository) WithTx(tx *sql.Tx) *AttendanceRepository {
+	return &AttendanceRepository{db: tx, dialect: r.dialect, location: r.location}
 }
 
 // Create creates or updates an attendance record
-func (r *AttendanceRepository) Create(req *models.CreateAttendanceRequest) (int64, error) {
+func (r *AttendanceRepository) Create(ctx context.Context, req *models.CreateAttendanceRequest) (int64, error) {
 	date, err := time.Parse("2006-01-02", req.Date)
 	if err != nil {
 		return 0, err
 	}
 
-	// Use INSERT OR REPLACE to handle duplicate date+student
+	// Upsert to handle duplicate date+student
 	query := `
 		INSERT INTO attendance (student_id, date, status, marked_by_teacher_id, marked_by_admin_id)
 		VALUES (?, ?, ?, ?, ?)
@@ -34,113 +44,102 @@ func (r *AttendanceRepository) Create(req *models.CreateAttendanceRequest) (int6
 			marked_by_teacher_id = excluded.marked_by_teacher_id,
 			marked_by_admin_id = excluded.marked_by_admin_id,
 			updated_at = CURRENT_TIMESTAMP
+		RETURNING id
 	`
-	result, err := r.db.Exec(query,
+	var id int64
+	err = r.db.QueryRowContext(ctx, query,
 		req.StudentID,
 		date,
 		req.Status,
 		req.MarkedByTeacherID,
 		req.MarkedByAdminID,
-	)
+	).Scan(&id)
 	if err != nil {
-		return 0, err
+		return 0, database.Classify(err)
 	}
 
-	return result.LastInsertId()
+	return id, nil
 }
 
-// BulkCreate creates or updates multiple attendance records
-func (r *AttendanceRepository) BulkCreate(req *models.BulkAttendanceRequest) error {
+// BulkCreate creates or updates multiple attendance records. Either every
+// record is saved or none is.
+func (r *AttendanceRepository) BulkCreate(ctx context.Context, req *models.BulkAttendanceRequest) error {
 	date, err := time.Parse("2006-01-02", req.Date)
 	if err != nil {
 		return err
 	}
 
-	// Start transaction
-	tx, err := r.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	// Insert/update absent students
-	for _, studentID := range req.AbsentStudentIDs {
-		query := `
-			INSERT INTO attendance (student_id, date, status, marked_by_teacher_id, marked_by_admin_id)
-			VALUES (?, ?, 'absent', ?, ?)
-			ON CONFLICT(student_id, date)
-			DO UPDATE SET
-				status = 'absent',
-				marked_by_teacher_id = excluded.marked_by_teacher_id,
-				marked_by_admin_id = excluded.marked_by_admin_id,
-				updated_at = CURRENT_TIMESTAMP
-		`
-		_, err = tx.Exec(query, studentID, date, req.MarkedByTeacherID, req.MarkedByAdminID)
-		if err != nil {
-			return err
+	return database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		// Insert/update absent students
+		for _, studentID := range req.AbsentStudentIDs {
+			if err := upsertAttendance(ctx, tx, studentID, date, "absent", req.MarkedByTeacherID, req.MarkedByAdminID); err != nil {
+				return err
+			}
 		}
-	}
 
-	// Insert/update explicitly present students
-	for _, studentID := range req.PresentStudentIDs {
-		query := `
-			INSERT INTO attendance (student_id, date, status, marked_by_teacher_id, marked_by_admin_id)
-			VALUES (?, ?, 'present', ?, ?)
-			ON CONFLICT(student_id, date)
-			DO UPDATE SET
-				status = 'present',
-				marked_by_teacher_id = excluded.marked_by_teacher_id,
-				marked_by_admin_id = excluded.marked_by_admin_id,
-				updated_at = CURRENT_TIMESTAMP
-		`
-		_, err = tx.Exec(query, studentID, date, req.MarkedByTeacherID, req.MarkedByAdminID)
-		if err != nil {
-			return err
+		// Insert/update explicitly present students
+		for _, studentID := range req.PresentStudentIDs {
+			if err := upsertAttendance(ctx, tx, studentID, date, "present", req.MarkedByTeacherID, req.MarkedByAdminID); err != nil {
+				return err
+			}
 		}
-	}
 
-	return tx.Commit()
+		return nil
+	})
 }
 
-// MarkAllPresentExcept marks all students in a class as present except the specified ones
-func (r *AttendanceRepository) MarkAllPresentExcept(classID int, date string, absentStudentIDs []int, markedByTeacherID, markedByAdminID *int) error {
+// MarkAllPresentExcept marks all active students in a class as present except
+// the specified ones. Either the whole class is recorded or nothing is.
+func (r *AttendanceRepository) MarkAllPresentExcept(ctx context.Context, classID int, date string, absentStudentIDs []int, markedByTeacherID, markedByAdminID *int) error {
 	parsedDate, err := time.Parse("2006-01-02", date)
 	if err != nil {
 		return err
 	}
 
-	// Get all students in the class
-	studentsQuery := `
-		SELECT id FROM students WHERE class_id = ? AND is_active = 1
-	`
-	rows, err := r.db.Query(studentsQuery, classID)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	var allStudentIDs []int
-	for rows.Next() {
-		var studentID int
-		if err := rows.Scan(&studentID); err != nil {
-			return err
-		}
-		allStudentIDs = append(allStudentIDs, studentID)
-	}
-
 	// Create a map of absent students for quick lookup
 	absentMap := make(map[int]bool)
 	for _, id := range absentStudentIDs {
 		absentMap[id] = true
 	}
 
-	// Start transaction
-	tx, err := r.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	return database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		// Get all students in the class
+		rows, err := tx.QueryContext(ctx, "SELECT id FROM students WHERE class_id = ? AND is_active = TRUE", classID)
+		if err != nil {
+			return err
+		}
 
+		var allStudentIDs []int
+		for rows.Next() {
+			var studentID int
+			if err := rows.Scan(&studentID); err != nil {
+				rows.Close()
+				return err
+			}
+			allStudentIDs = append(allStudentIDs, studentID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// Mark attendance for all students
+		for _, studentID := range allStudentIDs {
+			status := "present"
+			if absentMap[studentID] {
+				status = "absent"
+			}
+			if err := upsertAttendance(ctx, tx, studentID, parsedDate, status, markedByTeacherID, markedByAdminID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// upsertAttendance creates or overwrites one student's record for a date
+func upsertAttendance(ctx context.Context, db database.DBTX, studentID int, date time.Time, status string, markedByTeacherID, markedByAdminID *int) error {
 	query := `
 		INSERT INTO attendance (student_id, date, status, marked_by_teacher_id, marked_by_admin_id)
 		VALUES (?, ?, ?, ?, ?)
@@ -151,24 +150,16 @@ func (r *AttendanceRepository) MarkAllPresentExcept(classID int, date string, ab
 			marked_by_admin_id = excluded.marked_by_admin_id,
 			updated_at = CURRENT_TIMESTAMP
 	`
-
-	// Mark attendance for all students
-	for _, studentID := range allStudentIDs {
-		status := "present"
-		if absentMap[studentID] {
-			status = "absent"
-		}
-		_, err = tx.Exec(query, studentID, parsedDate, status, markedByTeacherID, markedByAdminID)
-		if err != nil {
-			return err
-		}
+	_, err := db.ExecContext(ctx, query, studentID, date, status, markedByTeacherID, markedByAdminID)
+	if err != nil {
+		return fmt.Errorf("failed to save attendance for student %d: %w", studentID, database.Classify(err))
 	}
 
-	return tx.Commit()
+	return nil
 }
 
 // GetByID retrieves an attendance record by ID
-func (r *AttendanceRepository) GetByID(id int) (*models.Attendance, error) {
+func (r *AttendanceRepository) GetByID(ctx context.Context, id int) (*models.Attendance, error) {
 	query := `
 		SELECT id, student_id, date, status, marked_by_teacher_id, marked_by_admin_id,
 		       created_at, updated_at
@@ -176,7 +167,7 @@ func (r *AttendanceRepository) GetByID(id int) (*models.Attendance, error) {
 		WHERE id = ?
 	`
 	record := &models.Attendance{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&record.ID,
 		&record.StudentID,
 		&record.Date,
@@ -194,7 +185,7 @@ func (r *AttendanceRepository) GetByID(id int) (*models.Attendance, error) {
 }
 
 // GetByStudentID retrieves attendance records for a student
-func (r *AttendanceRepository) GetByStudentID(studentID int, limit, offset int) ([]*models.AttendanceDetailed, error) {
+func (r *AttendanceRepository) GetByStudentID(ctx context.Context, studentID int, limit, offset int) ([]*models.AttendanceDetailed, error) {
 	query := `
 		SELECT id, student_id, first_name, last_name, class_id, class_name,
 		       date, status, created_at
@@ -203,7 +194,7 @@ func (r *AttendanceRepository) GetByStudentID(studentID int, limit, offset int)
 		ORDER BY date DESC
 		LIMIT ? OFFSET ?
 	`
-	rows, err := r.db.Query(query, studentID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, studentID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -233,15 +224,15 @@ func (r *AttendanceRepository) GetByStudentID(studentID int, limit, offset int)
 }
 
 // GetByStudentIDAndDateRange retrieves attendance for a student within a date range
-func (r *AttendanceRepository) GetByStudentIDAndDateRange(studentID int, startDate, endDate string) ([]*models.AttendanceDetailed, error) {
-	query := `
+func (r *AttendanceRepository) GetByStudentIDAndDateRange(ctx context.Context, studentID int, startDate, endDate string) ([]*models.AttendanceDetailed, error) {
+	query := fmt.Sprintf(`
 		SELECT id, student_id, first_name, last_name, class_id, class_name,
 		       date, status, created_at
 		FROM v_attendance_detailed
-		WHERE student_id = ? AND date(date) BETWEEN date(?) AND date(?)
+		WHERE student_id = ? AND %s BETWEEN %s AND %s
 		ORDER BY date DESC
-	`
-	rows, err := r.db.Query(query, studentID, startDate, endDate)
+	`, r.dialect.Date("date"), r.dialect.Date("?"), r.dialect.Date("?"))
+	rows, err := r.db.QueryContext(ctx, query, studentID, startDate, endDate)
 	if err != nil {
 		return nil, err
 	}
@@ -271,15 +262,15 @@ func (r *AttendanceRepository) GetByStudentIDAndDateRange(studentID int, startDa
 }
 
 // GetByClassIDAndDate retrieves attendance for all students in a class on a specific date
-func (r *AttendanceRepository) GetByClassIDAndDate(classID int, date string) ([]*models.AttendanceDetailed, error) {
-	query := `
+func (r *AttendanceRepository) GetByClassIDAndDate(ctx context.Context, classID int, date string) ([]*models.AttendanceDetailed, error) {
+	query := fmt.Sprintf(`
 		SELECT id, student_id, first_name, last_name, class_id, class_name,
 		       date, status, created_at
 		FROM v_attendance_detailed
-		WHERE class_id = ? AND date(date) = date(?)
+		WHERE class_id = ? AND %s = %s
 		ORDER BY last_name, first_name
-	`
-	rows, err := r.db.Query(query, classID, date)
+	`, r.dialect.Date("date"), r.dialect.Date("?"))
+	rows, err := r.db.QueryContext(ctx, query, classID, date)
 	if err != nil {
 		return nil, err
 	}
@@ -309,26 +300,22 @@ func (r *AttendanceRepository) GetByClassIDAndDate(classID int, date string) ([]
 }
 
 // GetTodayAttendanceByClass retrieves today's attendance for a specific class
-func (r *AttendanceRepository) GetTodayAttendanceByClass(classID int) ([]*models.AttendanceDetailed, error) {
-	// Use Uzbekistan timezone (Asia/Tashkent UTC+5) to match attendance taking
-	location, _ := time.LoadLocation("Asia/Tashkent")
-	today := time.Now().In(location).Format("2006-01-02")
-	return r.GetByClassIDAndDate(classID, today)
+func (r *AttendanceRepository) GetTodayAttendanceByClass(ctx context.Context, classID int) ([]*models.AttendanceDetailed, error) {
+	today := time.Now().In(r.location).Format("2006-01-02")
+	return r.GetByClassIDAndDate(ctx, classID, today)
 }
 
 // GetTodayAttendanceAllClasses retrieves today's attendance for all classes
-func (r *AttendanceRepository) GetTodayAttendanceAllClasses() ([]*models.AttendanceDetailed, error) {
-	// Use Uzbekistan timezone (Asia/Tashkent UTC+5) to match attendance taking
-	location, _ := time.LoadLocation("Asia/Tashkent")
-	today := time.Now().In(location).Format("2006-01-02")
-	query := `
+func (r *AttendanceRepository) GetTodayAttendanceAllClasses(ctx context.Context) ([]*models.AttendanceDetailed, error) {
+	today := time.Now().In(r.location).Format("2006-01-02")
+	query := fmt.Sprintf(`
 		SELECT id, student_id, first_name, last_name, class_id, class_name,
 		       date, status, created_at
 		FROM v_attendance_detailed
-		WHERE date(date) = date(?)
+		WHERE %s = %s
 		ORDER BY class_name, last_name, first_name
-	`
-	rows, err := r.db.Query(query, today)
+	`, r.dialect.Date("date"), r.dialect.Date("?"))
+	rows, err := r.db.QueryContext(ctx, query, today)
 	if err != nil {
 		return nil, err
 	}
@@ -358,52 +345,50 @@ func (r *AttendanceRepository) GetTodayAttendanceAllClasses() ([]*models.Attenda
 }
 
 // Update updates an attendance record
-func (r *AttendanceRepository) Update(id int, req *models.UpdateAttendanceRequest) error {
+func (r *AttendanceRepository) Update(ctx context.Context, id int, req *models.UpdateAttendanceRequest) error {
 	query := `
 		UPDATE attendance
 		SET status = ?,
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, req.Status, id)
+	_, err := r.db.ExecContext(ctx, query, req.Status, id)
 	return err
 }
 
 // Delete deletes an attendance record (restricted)
-func (r *AttendanceRepository) Delete(id int) error {
+func (r *AttendanceRepository) Delete(ctx context.Context, id int) error {
 	query := "DELETE FROM attendance WHERE id = ?"
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
 // Count returns total number of attendance records
-func (r *AttendanceRepository) Count() (int, error) {
+func (r *AttendanceRepository) Count(ctx context.Context) (int, error) {
 	var count int
 	query := "SELECT COUNT(*) FROM attendance"
-	err := r.db.QueryRow(query).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query).Scan(&count)
 	return count, err
 }
 
 // IsAttendanceTaken checks if attendance has been taken for a class on a specific date
-func (r *AttendanceRepository) IsAttendanceTaken(classID int, date string) (bool, error) {
-	query := `
+func (r *AttendanceRepository) IsAttendanceTaken(ctx context.Context, classID int, date string) (bool, error) {
+	query := fmt.Sprintf(`
 		SELECT EXISTS(
 			SELECT 1 FROM attendance a
 			INNER JOIN students s ON a.student_id = s.id
-			WHERE s.class_id = ? AND date(a.date) = date(?)
+			WHERE s.class_id = ? AND %s = %s
 		)
-	`
+	`, r.dialect.Date("a.date"), r.dialect.Date("?"))
 	var exists bool
-	err := r.db.QueryRow(query, classID, date).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, classID, date).Scan(&exists)
 	return exists, err
 }
 
 // GetLast30DaysByStudent retrieves last 30 days attendance for a student
-func (r *AttendanceRepository) GetLast30DaysByStudent(studentID int) ([]*models.AttendanceDetailed, error) {
-	// Use Uzbekistan timezone (Asia/Tashkent UTC+5) to match attendance taking
-	location, _ := time.LoadLocation("Asia/Tashkent")
-	now := time.Now().In(location)
+func (r *AttendanceRepository) GetLast30DaysByStudent(ctx context.Context, studentID int) ([]*models.AttendanceDetailed, error) {
+	now := time.Now().In(r.location)
 	thirtyDaysAgo := now.AddDate(0, 0, -30).Format("2006-01-02")
 	today := now.Format("2006-01-02")
-	return r.GetByStudentIDAndDateRange(studentID, thirtyDaysAgo, today)
+	return r.GetByStudentIDAndDateRange(ctx, studentID, thirtyDaysAgo, today)
 }
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"parent-bot/internal/database"
+	"parent-bot/internal/models"
+)
+
+// AuditRepository handles the audit log
+type AuditRepository struct {
+	db database.DBTX
+}
+
+// NewAuditRepository creates a new audit repository
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx
+func (r *AuditRepository) WithTx(tx *sql.Tx) *AuditRepository {
+	return &AuditRepository{db: tx}
+}
+
+const auditColumns = `
+	id, actor_telegram_id, actor_name, actor_role, source, action,
+	entity_type, entity_id, before_data, after_data, created_at
+`
+
+// scanAuditEntry scans a row selected with auditColumns
+func scanAuditEntry(row interface{ Scan(...any) error }) (*models.AuditEntry, error) {
+	var e models.AuditEntry
+	var before, after sql.NullString
+	err := row.Scan(
+		&e.ID,
+		&e.ActorTelegramID,
+		&e.ActorName,
+		&e.ActorRole,
+		&e.Source,
+		&e.Action,
+		&e.EntityType,
+		&e.EntityID,
+		&before,
+		&after,
+		&e.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if before.Valid {
+		e.Before = []byte(before.String)
+	}
+	if after.Valid {
+		e.After = []byte(after.String)
+	}
+	return &e, nil
+}
+
+// nullJSON stores empty JSON as NULL
+func nullJSON(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+// Create records an audit entry and sets its ID
+func (r *AuditRepository) Create(ctx context.Context, e *models.AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_telegram_id, actor_name, actor_role, source, action,
+			entity_type, entity_id, before_data, after_data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		e.ActorTelegramID, e.ActorName, e.ActorRole, e.Source, e.Action,
+		e.EntityType, e.EntityID, nullJSON(e.Before), nullJSON(e.After), e.CreatedAt.UTC(),
+	).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// auditFilterWhere builds the WHERE clause for a filter
+func auditFilterWhere(filter *models.AuditFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entity_type = ?")
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, filter.EntityID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.ActorTelegramID != nil {
+		conditions = append(conditions, "actor_telegram_id = ?")
+		args = append(args, *filter.ActorTelegramID)
+	}
+	if filter.Source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, filter.Source)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// List gets audit entries matching a filter, newest first
+func (r *AuditRepository) List(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEntry, error) {
+	where, args := auditFilterWhere(filter)
+	query := `SELECT ` + auditColumns + ` FROM audit_log ` + where + `
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// CountFiltered counts audit entries matching a filter
+func (r *AuditRepository) CountFiltered(ctx context.Context, filter *models.AuditFilter) (int, error) {
+	where, args := auditFilterWhere(filter)
+
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log "+where, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+	return count, nil
+}
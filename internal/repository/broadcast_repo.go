@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"parent-bot/internal/database"
+)
+
+// BroadcastRepository keeps the counts of a broadcast that the outbox does not
+type BroadcastRepository struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+// NewBroadcastRepository creates a new broadcast repository
+func NewBroadcastRepository(db *sql.DB) *BroadcastRepository {
+	return &BroadcastRepository{db: db, dialect: database.DialectOf(db)}
+}
+
+// AddSkipped adds n to the recipients a broadcast skipped
+func (r *BroadcastRepository) AddSkipped(ctx context.Context, ref string, n int) error {
+	query := `
+		INSERT INTO broadcasts (ref, skipped)
+		VALUES (?, ?)
+		ON CONFLICT (ref)
+		DO UPDATE SET skipped = broadcasts.skipped + excluded.skipped, updated_at = CURRENT_TIMESTAMP
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, ref, n); err != nil {
+		return fmt.Errorf("failed to record skipped recipients: %w", err)
+	}
+
+	return nil
+}
+
+// Skipped returns how many recipients a broadcast skipped, across resumes
+func (r *BroadcastRepository) Skipped(ctx context.Context, ref string) (int, error) {
+	var skipped int
+	err := r.db.QueryRowContext(ctx, `SELECT skipped FROM broadcasts WHERE ref = ?`, ref).Scan(&skipped)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get skipped recipients: %w", err)
+	}
+
+	return skipped, nil
+}
@@ -1,50 +1,54 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
+	"parent-bot/internal/database"
 	"parent-bot/internal/models"
 )
 
 type ClassRepository struct {
-	db *sql.DB
+	db database.DBTX
 }
 
 func NewClassRepository(db *sql.DB) *ClassRepository {
 	return &ClassRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its statements in tx
+func (r *ClassRepository) WithTx(tx *sql.Tx) *ClassRepository {
+	return &ClassRepository{db: tx}
+}
+
 // Create creates a new class
-func (r *ClassRepository) Create(className string) (*models.Class, error) {
+func (r *ClassRepository) Create(ctx context.Context, className string) (*models.Class, error) {
 	query := `
 		INSERT INTO classes (class_name, is_active)
-		VALUES (?, 1)
+		VALUES (?, TRUE)
+		RETURNING id
 	`
 
-	result, err := r.db.Exec(query, className)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create class: %w", err)
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %w", err)
+	var id int
+	if err := r.db.QueryRowContext(ctx, query, className).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create class: %w", database.Classify(err))
 	}
 
 	// Get the created class
-	return r.GetByID(int(id))
+	return r.GetByID(ctx, id)
 }
 
 // GetAll gets all classes
-func (r *ClassRepository) GetAll() ([]*models.Class, error) {
+func (r *ClassRepository) GetAll(ctx context.Context) ([]*models.Class, error) {
 	query := `
 		SELECT id, class_name, is_active, created_at
 		FROM classes
 		ORDER BY class_name ASC
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get classes: %w", err)
 	}
@@ -69,15 +73,15 @@ func (r *ClassRepository) GetAll() ([]*models.Class, error) {
 }
 
 // GetActive gets all active classes
-func (r *ClassRepository) GetActive() ([]*models.Class, error) {
+func (r *ClassRepository) GetActive(ctx context.Context) ([]*models.Class, error) {
 	query := `
 		SELECT id, class_name, is_active, created_at
 		FROM classes
-		WHERE is_active = 1
+		WHERE is_active = TRUE
 		ORDER BY class_name ASC
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get active classes: %w", err)
 	}
@@ -102,7 +106,7 @@ func (r *ClassRepository) GetActive() ([]*models.Class, error) {
 }
 
 // GetByID gets class by ID
-func (r *ClassRepository) GetByID(id int) (*models.Class, error) {
+func (r *ClassRepository) GetByID(ctx context.Context, id int) (*models.Class, error) {
 	query := `
 		SELECT id, class_name, is_active, created_at
 		FROM classes
@@ -110,7 +114,7 @@ func (r *ClassRepository) GetByID(id int) (*models.Class, error) {
 	`
 
 	var class models.Class
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&class.ID,
 		&class.ClassName,
 		&class.IsActive,
@@ -129,7 +133,7 @@ func (r *ClassRepository) GetByID(id int) (*models.Class, error) {
 }
 
 // GetByName gets class by name
-func (r *ClassRepository) GetByName(className string) (*models.Class, error) {
+func (r *ClassRepository) GetByName(ctx context.Context, className string) (*models.Class, error) {
 	query := `
 		SELECT id, class_name, is_active, created_at
 		FROM classes
@@ -137,7 +141,7 @@ func (r *ClassRepository) GetByName(className string) (*models.Class, error) {
 	`
 
 	var class models.Class
-	err := r.db.QueryRow(query, className).Scan(
+	err := r.db.QueryRowContext(ctx, query, className).Scan(
 		&class.ID,
 		&class.ClassName,
 		&class.IsActive,
@@ -156,9 +160,9 @@ func (r *ClassRepository) GetByName(className string) (*models.Class, error) {
 }
 
 // Delete deletes a class by name
-func (r *ClassRepository) Delete(className string) error {
+func (r *ClassRepository) Delete(ctx context.Context, className string) error {
 	query := `DELETE FROM classes WHERE class_name = ?`
-	result, err := r.db.Exec(query, className)
+	result, err := r.db.ExecContext(ctx, query, className)
 	if err != nil {
 		return fmt.Errorf("failed to delete class: %w", err)
 	}
@@ -176,9 +180,9 @@ func (r *ClassRepository) Delete(className string) error {
 }
 
 // DeleteByID deletes a class by ID
-func (r *ClassRepository) DeleteByID(id int) error {
+func (r *ClassRepository) DeleteByID(ctx context.Context, id int) error {
 	query := `DELETE FROM classes WHERE id = ?`
-	result, err := r.db.Exec(query, id)
+	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete class: %w", err)
 	}
@@ -196,13 +200,13 @@ func (r *ClassRepository) DeleteByID(id int) error {
 }
 
 // ToggleActive toggles class active status
-func (r *ClassRepository) ToggleActive(className string) error {
+func (r *ClassRepository) ToggleActive(ctx context.Context, className string) error {
 	query := `
 		UPDATE classes
-		SET is_active = CASE WHEN is_active = 1 THEN 0 ELSE 1 END
+		SET is_active = NOT is_active
 		WHERE class_name = ?
 	`
-	result, err := r.db.Exec(query, className)
+	result, err := r.db.ExecContext(ctx, query, className)
 	if err != nil {
 		return fmt.Errorf("failed to toggle class status: %w", err)
 	}
@@ -220,9 +224,9 @@ func (r *ClassRepository) ToggleActive(className string) error {
 }
 
 // Count counts total classes
-func (r *ClassRepository) Count() (int, error) {
+func (r *ClassRepository) Count(ctx context.Context) (int, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM classes").Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM classes").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count classes: %w", err)
 	}
@@ -230,12 +234,105 @@ func (r *ClassRepository) Count() (int, error) {
 }
 
 // Exists checks if a class name exists and is active
-func (r *ClassRepository) Exists(className string) (bool, error) {
-	query := `SELECT EXISTS(SELECT 1 FROM classes WHERE class_name = ? AND is_active = 1)`
+func (r *ClassRepository) Exists(ctx context.Context, className string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM classes WHERE class_name = ? AND is_active = TRUE)`
 	var exists bool
-	err := r.db.QueryRow(query, className).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, className).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check class existence: %w", err)
 	}
 	return exists, nil
 }
+
+// classFilterWhere builds the WHERE clause for a class filter
+func classFilterWhere(filter *models.ClassFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if filter.Search != "" {
+		conditions = append(conditions, "LOWER(class_name) LIKE LOWER(?)")
+		args = append(args, "%"+filter.Search+"%")
+	}
+	if filter.IsActive != nil {
+		conditions = append(conditions, "is_active = ?")
+		args = append(args, *filter.IsActive)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// List gets classes matching a filter with pagination
+func (r *ClassRepository) List(ctx context.Context, filter *models.ClassFilter) ([]*models.Class, error) {
+	where, args := classFilterWhere(filter)
+	query := `
+		SELECT id, class_name, is_active, created_at
+		FROM classes
+		` + where + `
+		ORDER BY class_name ASC
+		LIMIT ? OFFSET ?
+	`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list classes: %w", err)
+	}
+	defer rows.Close()
+
+	var classes []*models.Class
+	for rows.Next() {
+		var class models.Class
+		err := rows.Scan(
+			&class.ID,
+			&class.ClassName,
+			&class.IsActive,
+			&class.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan class: %w", err)
+		}
+		classes = append(classes, &class)
+	}
+
+	return classes, nil
+}
+
+// CountFiltered counts classes matching a filter
+func (r *ClassRepository) CountFiltered(ctx context.Context, filter *models.ClassFilter) (int, error) {
+	where, args := classFilterWhere(filter)
+
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM classes "+where, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count classes: %w", err)
+	}
+	return count, nil
+}
+
+// Update updates class name and/or active status
+func (r *ClassRepository) Update(ctx context.Context, id int, req *models.UpdateClassRequest) error {
+	query := `
+		UPDATE classes
+		SET class_name = COALESCE(NULLIF(?, ''), class_name),
+		    is_active = COALESCE(?, is_active)
+		WHERE id = ?
+	`
+	result, err := r.db.ExecContext(ctx, query, req.ClassName, req.IsActive, id)
+	if err != nil {
+		return fmt.Errorf("failed to update class: %w", database.Classify(err))
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("class not found")
+	}
+
+	return nil
+}
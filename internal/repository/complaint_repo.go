@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -16,7 +17,7 @@ func NewComplaintRepository(db *sql.DB) *ComplaintRepository {
 }
 
 // Create creates a new complaint
-func (r *ComplaintRepository) Create(req *models.CreateComplaintRequest) (*models.Complaint, error) {
+func (r *ComplaintRepository) Create(ctx context.Context, req *models.CreateComplaintRequest) (*models.Complaint, error) {
 	query := `
 		INSERT INTO complaints (user_id, complaint_text, telegram_file_id, filename)
 		VALUES (?, ?, ?, ?)
@@ -24,7 +25,7 @@ func (r *ComplaintRepository) Create(req *models.CreateComplaintRequest) (*model
 	`
 
 	var complaint models.Complaint
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(ctx,
 		query,
 		req.UserID,
 		req.ComplaintText,
@@ -48,7 +49,7 @@ func (r *ComplaintRepository) Create(req *models.CreateComplaintRequest) (*model
 }
 
 // GetByID gets complaint by ID
-func (r *ComplaintRepository) GetByID(id int) (*models.Complaint, error) {
+func (r *ComplaintRepository) GetByID(ctx context.Context, id int) (*models.Complaint, error) {
 	query := `
 		SELECT id, user_id, complaint_text, telegram_file_id, filename, created_at, status
 		FROM complaints
@@ -56,7 +57,7 @@ func (r *ComplaintRepository) GetByID(id int) (*models.Complaint, error) {
 	`
 
 	var complaint models.Complaint
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&complaint.ID,
 		&complaint.UserID,
 		&complaint.ComplaintText,
@@ -78,7 +79,7 @@ func (r *ComplaintRepository) GetByID(id int) (*models.Complaint, error) {
 }
 
 // GetByUserID gets complaints by user ID (indexed, fast query)
-func (r *ComplaintRepository) GetByUserID(userID int, limit, offset int) ([]*models.Complaint, error) {
+func (r *ComplaintRepository) GetByUserID(ctx context.Context, userID int, limit, offset int) ([]*models.Complaint, error) {
 	query := `
 		SELECT id, user_id, complaint_text, telegram_file_id, filename, created_at, status
 		FROM complaints
@@ -87,7 +88,7 @@ func (r *ComplaintRepository) GetByUserID(userID int, limit, offset int) ([]*mod
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, userID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get complaints: %w", err)
 	}
@@ -115,7 +116,7 @@ func (r *ComplaintRepository) GetByUserID(userID int, limit, offset int) ([]*mod
 }
 
 // GetAll gets all complaints with pagination (for admin)
-func (r *ComplaintRepository) GetAll(limit, offset int) ([]*models.Complaint, error) {
+func (r *ComplaintRepository) GetAll(ctx context.Context, limit, offset int) ([]*models.Complaint, error) {
 	query := `
 		SELECT id, user_id, complaint_text, telegram_file_id, filename, created_at, status
 		FROM complaints
@@ -123,7 +124,7 @@ func (r *ComplaintRepository) GetAll(limit, offset int) ([]*models.Complaint, er
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get complaints: %w", err)
 	}
@@ -151,7 +152,7 @@ func (r *ComplaintRepository) GetAll(limit, offset int) ([]*models.Complaint, er
 }
 
 // GetAllWithUser gets all complaints with user info using view (optimized for admin)
-func (r *ComplaintRepository) GetAllWithUser(limit, offset int) ([]*models.ComplaintWithUser, error) {
+func (r *ComplaintRepository) GetAllWithUser(ctx context.Context, limit, offset int) ([]*models.ComplaintWithUser, error) {
 	query := `
 		SELECT id, user_id, complaint_text, telegram_file_id, filename, created_at, status,
 		       telegram_id as user_telegram_id, telegram_username, phone_number, language
@@ -160,7 +161,7 @@ func (r *ComplaintRepository) GetAllWithUser(limit, offset int) ([]*models.Compl
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get complaints with user: %w", err)
 	}
@@ -192,7 +193,7 @@ func (r *ComplaintRepository) GetAllWithUser(limit, offset int) ([]*models.Compl
 }
 
 // GetByStatus gets complaints by status (indexed, fast query)
-func (r *ComplaintRepository) GetByStatus(status string, limit, offset int) ([]*models.Complaint, error) {
+func (r *ComplaintRepository) GetByStatus(ctx context.Context, status string, limit, offset int) ([]*models.Complaint, error) {
 	query := `
 		SELECT id, user_id, complaint_text, telegram_file_id, filename, created_at, status
 		FROM complaints
@@ -201,7 +202,7 @@ func (r *ComplaintRepository) GetByStatus(status string, limit, offset int) ([]*
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, status, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, status, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get complaints by status: %w", err)
 	}
@@ -229,9 +230,9 @@ func (r *ComplaintRepository) GetByStatus(status string, limit, offset int) ([]*
 }
 
 // UpdateStatus updates complaint status
-func (r *ComplaintRepository) UpdateStatus(id int, status string) error {
+func (r *ComplaintRepository) UpdateStatus(ctx context.Context, id int, status string) error {
 	query := `UPDATE complaints SET status = ? WHERE id = ?`
-	_, err := r.db.Exec(query, status, id)
+	_, err := r.db.ExecContext(ctx, query, status, id)
 	if err != nil {
 		return fmt.Errorf("failed to update complaint status: %w", err)
 	}
@@ -239,9 +240,9 @@ func (r *ComplaintRepository) UpdateStatus(id int, status string) error {
 }
 
 // Count counts total complaints
-func (r *ComplaintRepository) Count() (int, error) {
+func (r *ComplaintRepository) Count(ctx context.Context) (int, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM complaints").Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM complaints").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count complaints: %w", err)
 	}
@@ -249,10 +250,10 @@ func (r *ComplaintRepository) Count() (int, error) {
 }
 
 // CountByStatus counts complaints by status
-func (r *ComplaintRepository) CountByStatus(status string) (int, error) {
+func (r *ComplaintRepository) CountByStatus(ctx context.Context, status string) (int, error) {
 	var count int
 	query := `SELECT COUNT(*) FROM complaints WHERE status = ?`
-	err := r.db.QueryRow(query, status).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, status).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count complaints by status: %w", err)
 	}
@@ -260,10 +261,10 @@ func (r *ComplaintRepository) CountByStatus(status string) (int, error) {
 }
 
 // CountByUserID counts complaints by user ID
-func (r *ComplaintRepository) CountByUserID(userID int) (int, error) {
+func (r *ComplaintRepository) CountByUserID(ctx context.Context, userID int) (int, error) {
 	var count int
 	query := `SELECT COUNT(*) FROM complaints WHERE user_id = ?`
-	err := r.db.QueryRow(query, userID).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count user complaints: %w", err)
 	}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"parent-bot/internal/models"
+)
+
+// JobRepository handles background job run history
+type JobRepository struct {
+	db *sql.DB
+}
+
+// NewJobRepository creates a new job repository
+func NewJobRepository(db *sql.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+const jobColumns = `
+	name, schedule, next_run_at, last_started_at, last_finished_at,
+	last_status, last_trigger, last_error, run_count, failure_count, updated_at
+`
+
+// scanJob scans a row selected with jobColumns
+func scanJob(row interface{ Scan(...any) error }) (*models.Job, error) {
+	var job models.Job
+	err := row.Scan(
+		&job.Name,
+		&job.Schedule,
+		&job.NextRunAt,
+		&job.LastStartedAt,
+		&job.LastFinishedAt,
+		&job.LastStatus,
+		&job.LastTrigger,
+		&job.LastError,
+		&job.RunCount,
+		&job.FailureCount,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetByName gets a job's history, or nil if it has never been registered
+func (r *JobRepository) GetByName(ctx context.Context, name string) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE name = ?`
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return job, nil
+}
+
+// GetAll gets the history of every job ordered by name
+func (r *JobRepository) GetAll(ctx context.Context) ([]*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs ORDER BY name`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// Register creates a job row or updates its schedule, keeping its run history
+func (r *JobRepository) Register(ctx context.Context, name, schedule string, nextRunAt time.Time) error {
+	query := `
+		INSERT INTO jobs (name, schedule, next_run_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (name)
+		DO UPDATE SET schedule = excluded.schedule, next_run_at = excluded.next_run_at, updated_at = CURRENT_TIMESTAMP
+	`
+
+	_, err := r.db.ExecContext(ctx, query, name, schedule, nextRunAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to register job: %w", err)
+	}
+
+	return nil
+}
+
+// SetNextRun records when a job is next due
+func (r *JobRepository) SetNextRun(ctx context.Context, name string, nextRunAt time.Time) error {
+	query := `UPDATE jobs SET next_run_at = ?, updated_at = CURRENT_TIMESTAMP WHERE name = ?`
+
+	_, err := r.db.ExecContext(ctx, query, nextRunAt.UTC(), name)
+	if err != nil {
+		return fmt.Errorf("failed to set job next run: %w", err)
+	}
+
+	return nil
+}
+
+// MarkStarted records that a run has started
+func (r *JobRepository) MarkStarted(ctx context.Context, name, trigger string, startedAt time.Time) error {
+	query := `
+		UPDATE jobs
+		SET last_started_at = ?, last_status = ?, last_trigger = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE name = ?
+	`
+
+	_, err := r.db.ExecContext(ctx, query, startedAt.UTC(), models.JobStatusRunning, trigger, name)
+	if err != nil {
+		return fmt.Errorf("failed to mark job started: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFinished records the outcome of a run; runErr is nil on success
+func (r *JobRepository) MarkFinished(ctx context.Context, name string, finishedAt time.Time, runErr error) error {
+	status, message, failed := models.JobStatusOK, "", 0
+	if runErr != nil {
+		status, message, failed = models.JobStatusFailed, runErr.Error(), 1
+	}
+
+	query := `
+		UPDATE jobs
+		SET last_finished_at = ?, last_status = ?, last_error = ?,
+		    run_count = run_count + 1, failure_count = failure_count + ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE name = ?
+	`
+
+	_, err := r.db.ExecContext(ctx, query, finishedAt.UTC(), status, message, failed, name)
+	if err != nil {
+		return fmt.Errorf("failed to mark job finished: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,396 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"parent-bot/internal/database"
+	"parent-bot/internal/models"
+)
+
+// NotificationRepository handles the notification outbox and unreachable chats
+type NotificationRepository struct {
+	db      database.DBTX
+	dialect database.Dialect
+}
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db, dialect: database.DialectOf(db)}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx
+func (r *NotificationRepository) WithTx(tx *sql.Tx) *NotificationRepository {
+	return &NotificationRepository{db: tx, dialect: r.dialect}
+}
+
+const notificationColumns = `
+	id, chat_id, kind, text, file_id, media_type, reply_markup, ref, bulk,
+	status, attempts, next_attempt_at, last_error, created_at, sent_at
+`
+
+// scanNotification scans a row selected with notificationColumns
+func scanNotification(row interface{ Scan(...any) error }) (*models.Notification, error) {
+	var n models.Notification
+	err := row.Scan(
+		&n.ID,
+		&n.ChatID,
+		&n.Kind,
+		&n.Text,
+		&n.FileID,
+		&n.MediaType,
+		&n.ReplyMarkup,
+		&n.Ref,
+		&n.Bulk,
+		&n.Status,
+		&n.Attempts,
+		&n.NextAttemptAt,
+		&n.LastError,
+		&n.CreatedAt,
+		&n.SentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// Enqueue queues notifications in one transaction and returns how many were
+// queued. Notifications for unreachable chats are skipped and keep ID 0.
+func (r *NotificationRepository) Enqueue(ctx context.Context, notifications []*models.Notification, now time.Time) (int, error) {
+	query := `
+		INSERT INTO notification_outbox (chat_id, kind, text, file_id, media_type, reply_markup, ref, bulk, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	queued := 0
+	err := database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		for _, n := range notifications {
+			var blocked bool
+			err := tx.QueryRowContext(ctx,
+				`SELECT EXISTS (SELECT 1 FROM unreachable_chats WHERE chat_id = ?)`, n.ChatID,
+			).Scan(&blocked)
+			if err != nil {
+				return fmt.Errorf("failed to check chat: %w", err)
+			}
+			if blocked {
+				n.Status = models.NotificationUnreachable
+				continue
+			}
+
+			err = tx.QueryRowContext(ctx, query,
+				n.ChatID, n.Kind, n.Text, n.FileID, n.MediaType, n.ReplyMarkup, n.Ref, n.Bulk, now.UTC(),
+			).Scan(&n.ID)
+			if err != nil {
+				return fmt.Errorf("failed to enqueue notification: %w", err)
+			}
+			n.Status = models.NotificationPending
+			n.NextAttemptAt = now
+			queued++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return queued, nil
+}
+
+// pendingHeads selects the next pending notification of each chat: the
+// oldest one that is not bulk, or else the oldest bulk one. Later
+// notifications for a chat wait behind it, which keeps delivery in order.
+const pendingHeads = `
+	FROM notification_outbox o
+	WHERE o.status = 'pending'
+	  AND o.id = (
+		SELECT id FROM notification_outbox
+		WHERE chat_id = o.chat_id AND status = 'pending'
+		ORDER BY bulk, id
+		LIMIT 1
+	  )
+`
+
+// Due gets up to limit notifications that are next in line for their chat
+// and due at now, bulk ones last and otherwise oldest first
+func (r *NotificationRepository) Due(ctx context.Context, now time.Time, limit int) ([]*models.Notification, error) {
+	query := `SELECT ` + notificationColumns + pendingHeads + `
+		AND o.next_attempt_at <= ?
+		ORDER BY o.bulk, o.id
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// NextAttemptAt returns when the next notification in line is due, or nil
+// if nothing is pending
+func (r *NotificationRepository) NextAttemptAt(ctx context.Context) (*time.Time, error) {
+	query := `SELECT o.next_attempt_at ` + pendingHeads + `
+		ORDER BY o.next_attempt_at
+		LIMIT 1
+	`
+
+	var next time.Time
+	err := r.db.QueryRowContext(ctx, query).Scan(&next)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next notification: %w", err)
+	}
+
+	return &next, nil
+}
+
+// MarkSent records a successful delivery
+func (r *NotificationRepository) MarkSent(ctx context.Context, id int64, sentAt time.Time) error {
+	query := `
+		UPDATE notification_outbox
+		SET status = 'sent', attempts = attempts + 1, last_error = '', sent_at = ?
+		WHERE id = ?
+	`
+
+	_, err := r.db.ExecContext(ctx, query, sentAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification sent: %w", err)
+	}
+
+	return nil
+}
+
+// Retry schedules another attempt. countAttempt is false when Telegram asked
+// us to slow down, which says nothing about the message itself.
+func (r *NotificationRepository) Retry(ctx context.Context, id int64, next time.Time, countAttempt bool, lastError string) error {
+	increment := 0
+	if countAttempt {
+		increment = 1
+	}
+
+	query := `
+		UPDATE notification_outbox
+		SET attempts = attempts + ?, next_attempt_at = ?, last_error = ?
+		WHERE id = ?
+	`
+
+	_, err := r.db.ExecContext(ctx, query, increment, next.UTC(), lastError, id)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule notification: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed gives up on a notification
+func (r *NotificationRepository) MarkFailed(ctx context.Context, id int64, lastError string) error {
+	query := `
+		UPDATE notification_outbox
+		SET status = 'failed', attempts = attempts + 1, last_error = ?
+		WHERE id = ?
+	`
+
+	_, err := r.db.ExecContext(ctx, query, lastError, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification failed: %w", err)
+	}
+
+	return nil
+}
+
+// MarkChatUnreachable records that a chat blocked the bot or no longer exists
+// and drops its pending notifications, including the one that failed. It
+// returns the dropped notifications.
+func (r *NotificationRepository) MarkChatUnreachable(ctx context.Context, chatID int64, reason string) ([]*models.Notification, error) {
+	var dropped []*models.Notification
+	err := database.InTx(ctx, r.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO unreachable_chats (chat_id, reason)
+			VALUES (?, ?)
+			ON CONFLICT (chat_id) DO UPDATE SET reason = excluded.reason, marked_at = CURRENT_TIMESTAMP
+		`, chatID, reason)
+		if err != nil {
+			return fmt.Errorf("failed to mark chat unreachable: %w", err)
+		}
+
+		rows, err := tx.QueryContext(ctx, `SELECT `+notificationColumns+`
+			FROM notification_outbox
+			WHERE chat_id = ? AND status = 'pending'
+			ORDER BY id
+		`, chatID)
+		if err != nil {
+			return fmt.Errorf("failed to get pending notifications: %w", err)
+		}
+		for rows.Next() {
+			n, err := scanNotification(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan notification: %w", err)
+			}
+			dropped = append(dropped, n)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to get pending notifications: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE notification_outbox
+			SET status = 'unreachable', last_error = ?
+			WHERE chat_id = ? AND status = 'pending'
+		`, reason, chatID)
+		if err != nil {
+			return fmt.Errorf("failed to drop notifications: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dropped, nil
+}
+
+// MarkChatReachable forgets that a chat was unreachable. It returns true if
+// the chat had been marked.
+func (r *NotificationRepository) MarkChatReachable(ctx context.Context, chatID int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM unreachable_chats WHERE chat_id = ?`, chatID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark chat reachable: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+// notificationFilterWhere builds the WHERE clause for a NotificationFilter
+func notificationFilterWhere(filter *models.NotificationFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if filter.ChatID != nil {
+		conditions = append(conditions, "chat_id = ?")
+		args = append(args, *filter.ChatID)
+	}
+	if filter.Kind != "" {
+		conditions = append(conditions, "kind = ?")
+		args = append(args, filter.Kind)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Ref != "" {
+		conditions = append(conditions, "ref = ?")
+		args = append(args, filter.Ref)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// List gets notifications matching a filter, newest first
+func (r *NotificationRepository) List(ctx context.Context, filter *models.NotificationFilter) ([]*models.Notification, error) {
+	where, args := notificationFilterWhere(filter)
+	query := `SELECT ` + notificationColumns + ` FROM notification_outbox ` + where + `
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// CountFiltered counts notifications matching a filter
+func (r *NotificationRepository) CountFiltered(ctx context.Context, filter *models.NotificationFilter) (int, error) {
+	where, args := notificationFilterWhere(filter)
+
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notification_outbox "+where, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	return count, nil
+}
+
+// CountByStatus counts the notifications sharing a reference by status
+func (r *NotificationRepository) CountByStatus(ctx context.Context, ref string) (map[string]int, error) {
+	query := `
+		SELECT status, COUNT(*)
+		FROM notification_outbox
+		WHERE ref = ?
+		GROUP BY status
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan notification count: %w", err)
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// DeleteOlderThan removes delivered and abandoned notifications created more
+// than the given number of hours ago. Pending ones are always kept.
+func (r *NotificationRepository) DeleteOlderThan(ctx context.Context, hours int) (int64, error) {
+	query := `
+		DELETE FROM notification_outbox
+		WHERE status <> 'pending' AND created_at < ` + r.dialect.HoursAgo()
+	result, err := r.db.ExecContext(ctx, query, hours)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean notifications: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"parent-bot/internal/database"
+)
+
+// ProcessedUpdateRepository records Telegram update IDs that were already received
+type ProcessedUpdateRepository struct {
+	db      *sql.DB
+	dialect database.Dialect
+}
+
+// NewProcessedUpdateRepository creates a new processed update repository
+func NewProcessedUpdateRepository(db *sql.DB) *ProcessedUpdateRepository {
+	return &ProcessedUpdateRepository{db: db, dialect: database.DialectOf(db)}
+}
+
+// Mark records an update ID. It returns false if the ID was already recorded.
+func (r *ProcessedUpdateRepository) Mark(ctx context.Context, updateID int) (bool, error) {
+	query := `INSERT INTO processed_updates (update_id) VALUES (?) ON CONFLICT DO NOTHING`
+	result, err := r.db.ExecContext(ctx, query, updateID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark update: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+// Unmark removes an update ID so a redelivery will be processed
+func (r *ProcessedUpdateRepository) Unmark(ctx context.Context, updateID int) error {
+	query := `DELETE FROM processed_updates WHERE update_id = ?`
+	_, err := r.db.ExecContext(ctx, query, updateID)
+	if err != nil {
+		return fmt.Errorf("failed to unmark update: %w", err)
+	}
+	return nil
+}
+
+// DeleteOlderThan removes records older than the given number of hours
+func (r *ProcessedUpdateRepository) DeleteOlderThan(ctx context.Context, hours int) (int64, error) {
+	query := `
+		DELETE FROM processed_updates
+		WHERE received_at < ` + r.dialect.HoursAgo()
+	result, err := r.db.ExecContext(ctx, query, hours)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean processed updates: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -16,7 +17,7 @@ func NewProposalRepository(db *sql.DB) *ProposalRepository {
 }
 
 // Create creates a new proposal
-func (r *ProposalRepository) Create(req *models.CreateProposalRequest) (*models.Proposal, error) {
+func (r *ProposalRepository) Create(ctx context.Context, req *models.CreateProposalRequest) (*models.Proposal, error) {
 	query := `
 		INSERT INTO proposals (user_id, proposal_text, telegram_file_id, filename)
 		VALUES (?, ?, ?, ?)
@@ -24,7 +25,7 @@ func (r *ProposalRepository) Create(req *models.CreateProposalRequest) (*models.
 	`
 
 	var proposal models.Proposal
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(ctx,
 		query,
 		req.UserID,
 		req.ProposalText,
@@ -48,7 +49,7 @@ func (r *ProposalRepository) Create(req *models.CreateProposalRequest) (*models.
 }
 
 // GetByID gets proposal by ID
-func (r *ProposalRepository) GetByID(id int) (*models.Proposal, error) {
+func (r *ProposalRepository) GetByID(ctx context.Context, id int) (*models.Proposal, error) {
 	query := `
 		SELECT id, user_id, proposal_text, telegram_file_id, filename, created_at, status
 		FROM proposals
@@ -56,7 +57,7 @@ func (r *ProposalRepository) GetByID(id int) (*models.Proposal, error) {
 	`
 
 	var proposal models.Proposal
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&proposal.ID,
 		&proposal.UserID,
 		&proposal.ProposalText,
@@ -78,7 +79,7 @@ func (r *ProposalRepository) GetByID(id int) (*models.Proposal, error) {
 }
 
 // GetByUserID gets proposals by user ID (indexed, fast query)
-func (r *ProposalRepository) GetByUserID(userID int, limit, offset int) ([]*models.Proposal, error) {
+func (r *ProposalRepository) GetByUserID(ctx context.Context, userID int, limit, offset int) ([]*models.Proposal, error) {
 	query := `
 		SELECT id, user_id, proposal_text, telegram_file_id, filename, created_at, status
 		FROM proposals
@@ -87,7 +88,7 @@ func (r *ProposalRepository) GetByUserID(userID int, limit, offset int) ([]*mode
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, userID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get proposals: %w", err)
 	}
@@ -115,7 +116,7 @@ func (r *ProposalRepository) GetByUserID(userID int, limit, offset int) ([]*mode
 }
 
 // GetAll gets all proposals with pagination (for admin)
-func (r *ProposalRepository) GetAll(limit, offset int) ([]*models.Proposal, error) {
+func (r *ProposalRepository) GetAll(ctx context.Context, limit, offset int) ([]*models.Proposal, error) {
 	query := `
 		SELECT id, user_id, proposal_text, telegram_file_id, filename, created_at, status
 		FROM proposals
@@ -123,7 +124,7 @@ func (r *ProposalRepository) GetAll(limit, offset int) ([]*models.Proposal, erro
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get proposals: %w", err)
 	}
@@ -151,7 +152,7 @@ func (r *ProposalRepository) GetAll(limit, offset int) ([]*models.Proposal, erro
 }
 
 // GetAllWithUser gets all proposals with user info using view (optimized for admin)
-func (r *ProposalRepository) GetAllWithUser(limit, offset int) ([]*models.ProposalWithUser, error) {
+func (r *ProposalRepository) GetAllWithUser(ctx context.Context, limit, offset int) ([]*models.ProposalWithUser, error) {
 	query := `
 		SELECT id, user_id, proposal_text, telegram_file_id, filename, created_at, status,
 		       telegram_username, phone_number, language
@@ -159,7 +160,7 @@ func (r *ProposalRepository) GetAllWithUser(limit, offset int) ([]*models.Propos
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get proposals with user: %w", err)
 	}
@@ -190,7 +191,7 @@ func (r *ProposalRepository) GetAllWithUser(limit, offset int) ([]*models.Propos
 }
 
 // GetByStatus gets proposals by status (indexed, fast query)
-func (r *ProposalRepository) GetByStatus(status string, limit, offset int) ([]*models.Proposal, error) {
+func (r *ProposalRepository) GetByStatus(ctx context.Context, status string, limit, offset int) ([]*models.Proposal, error) {
 	query := `
 		SELECT id, user_id, proposal_text, telegram_file_id, filename, created_at, status
 		FROM proposals
@@ -199,7 +200,7 @@ func (r *ProposalRepository) GetByStatus(status string, limit, offset int) ([]*m
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, status, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, status, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get proposals by status: %w", err)
 	}
@@ -227,9 +228,9 @@ func (r *ProposalRepository) GetByStatus(status string, limit, offset int) ([]*m
 }
 
 // UpdateStatus updates proposal status
-func (r *ProposalRepository) UpdateStatus(id int, status string) error {
+func (r *ProposalRepository) UpdateStatus(ctx context.Context, id int, status string) error {
 	query := `UPDATE proposals SET status = ? WHERE id = ?`
-	_, err := r.db.Exec(query, status, id)
+	_, err := r.db.ExecContext(ctx, query, status, id)
 	if err != nil {
 		return fmt.Errorf("failed to update proposal status: %w", err)
 	}
@@ -237,9 +238,9 @@ func (r *ProposalRepository) UpdateStatus(id int, status string) error {
 }
 
 // Count counts total proposals
-func (r *ProposalRepository) Count() (int, error) {
+func (r *ProposalRepository) Count(ctx context.Context) (int, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM proposals").Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM proposals").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count proposals: %w", err)
 	}
@@ -247,10 +248,10 @@ func (r *ProposalRepository) Count() (int, error) {
 }
 
 // CountByStatus counts proposals by status
-func (r *ProposalRepository) CountByStatus(status string) (int, error) {
+func (r *ProposalRepository) CountByStatus(ctx context.Context, status string) (int, error) {
 	var count int
 	query := `SELECT COUNT(*) FROM proposals WHERE status = ?`
-	err := r.db.QueryRow(query, status).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, status).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count proposals by status: %w", err)
 	}
@@ -258,10 +259,10 @@ func (r *ProposalRepository) CountByStatus(status string) (int, error) {
 }
 
 // CountByUserID counts proposals by user ID
-func (r *ProposalRepository) CountByUserID(userID int) (int, error) {
+func (r *ProposalRepository) CountByUserID(ctx context.Context, userID int) (int, error) {
 	var count int
 	query := `SELECT COUNT(*) FROM proposals WHERE user_id = ?`
-	err := r.db.QueryRow(query, userID).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count user proposals: %w", err)
 	}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"parent-bot/internal/models"
+)
+
+// RoleRepository handles the permissions granted to roles
+type RoleRepository struct {
+	db *sql.DB
+}
+
+// NewRoleRepository creates a new role repository
+func NewRoleRepository(db *sql.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// Permissions gets the permissions granted to any of the roles
+func (r *RoleRepository) Permissions(ctx context.Context, roles ...string) (models.PermissionSet, error) {
+	granted := models.PermissionSet{}
+	if len(roles) == 0 {
+		return granted, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(roles)), ", ")
+	query := `SELECT DISTINCT permission FROM role_permissions WHERE role IN (` + placeholders + `)`
+
+	args := make([]any, len(roles))
+	for i, role := range roles {
+		args[i] = role
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission); err != nil {
+			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		granted[permission] = true
+	}
+
+	return granted, rows.Err()
+}
+
+// Grant grants a permission to a role
+func (r *RoleRepository) Grant(ctx context.Context, role string, permission models.Permission) error {
+	query := `INSERT INTO role_permissions (role, permission) VALUES (?, ?) ON CONFLICT DO NOTHING`
+
+	_, err := r.db.ExecContext(ctx, query, role, permission)
+	if err != nil {
+		return fmt.Errorf("failed to grant permission: %w", err)
+	}
+
+	return nil
+}
+
+// Revoke revokes a permission from a role
+func (r *RoleRepository) Revoke(ctx context.Context, role string, permission models.Permission) error {
+	query := `DELETE FROM role_permissions WHERE role = ? AND permission = ?`
+
+	_, err := r.db.ExecContext(ctx, query, role, permission)
+	if err != nil {
+		return fmt.Errorf("failed to revoke permission: %w", err)
+	}
+
+	return nil
+}
@@ -1,15 +1,18 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
+	"parent-bot/internal/database"
 	"parent-bot/internal/models"
 )
 
 // StudentRepository handles student data operations
 type StudentRepository struct {
-	db *sql.DB
+	db database.DBTX
 }
 
 // NewStudentRepository creates a new student repository
@@ -17,28 +20,35 @@ func NewStudentRepository(db *sql.DB) *StudentRepository {
 	return &StudentRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its statements in tx
+func (r *StudentRepository) WithTx(tx *sql.Tx) *StudentRepository {
+	return &StudentRepository{db: tx}
+}
+
 // Create creates a new student
-func (r *StudentRepository) Create(student *models.CreateStudentRequest) (int64, error) {
+func (r *StudentRepository) Create(ctx context.Context, student *models.CreateStudentRequest) (int64, error) {
 	query := `
 		INSERT INTO students (first_name, last_name, class_id, added_by_admin_id, added_by_teacher_id)
 		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
 	`
-	result, err := r.db.Exec(query,
+	var id int64
+	err := r.db.QueryRowContext(ctx, query,
 		student.FirstName,
 		student.LastName,
 		student.ClassID,
 		student.AddedByAdminID,
 		student.AddedByTeacherID,
-	)
+	).Scan(&id)
 	if err != nil {
-		return 0, err
+		return 0, database.Classify(err)
 	}
 
-	return result.LastInsertId()
+	return id, nil
 }
 
 // GetByID retrieves a student by ID
-func (r *StudentRepository) GetByID(id int) (*models.Student, error) {
+func (r *StudentRepository) GetByID(ctx context.Context, id int) (*models.Student, error) {
 	query := `
 		SELECT id, first_name, last_name, class_id, is_active,
 		       added_by_admin_id, added_by_teacher_id, created_at, updated_at
@@ -46,7 +56,7 @@ func (r *StudentRepository) GetByID(id int) (*models.Student, error) {
 		WHERE id = ?
 	`
 	student := &models.Student{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&student.ID,
 		&student.FirstName,
 		&student.LastName,
@@ -65,14 +75,14 @@ func (r *StudentRepository) GetByID(id int) (*models.Student, error) {
 }
 
 // GetByIDWithClass retrieves a student with class information
-func (r *StudentRepository) GetByIDWithClass(id int) (*models.StudentWithClass, error) {
+func (r *StudentRepository) GetByIDWithClass(ctx context.Context, id int) (*models.StudentWithClass, error) {
 	query := `
 		SELECT id, first_name, last_name, class_id, class_name, is_active, created_at
 		FROM v_students_with_class
 		WHERE id = ?
 	`
 	student := &models.StudentWithClass{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&student.ID,
 		&student.FirstName,
 		&student.LastName,
@@ -89,14 +99,14 @@ func (r *StudentRepository) GetByIDWithClass(id int) (*models.StudentWithClass,
 }
 
 // GetByClassID retrieves all students in a class
-func (r *StudentRepository) GetByClassID(classID int) ([]*models.StudentWithClass, error) {
+func (r *StudentRepository) GetByClassID(ctx context.Context, classID int) ([]*models.StudentWithClass, error) {
 	query := `
 		SELECT id, first_name, last_name, class_id, class_name, is_active, created_at
 		FROM v_students_with_class
-		WHERE class_id = ? AND is_active = 1
+		WHERE class_id = ? AND is_active = TRUE
 		ORDER BY last_name, first_name
 	`
-	rows, err := r.db.Query(query, classID)
+	rows, err := r.db.QueryContext(ctx, query, classID)
 	if err != nil {
 		return nil, err
 	}
@@ -124,16 +134,16 @@ func (r *StudentRepository) GetByClassID(classID int) ([]*models.StudentWithClas
 }
 
 // SearchByName searches for students by first or last name in a specific class
-func (r *StudentRepository) SearchByName(classID int, searchTerm string) ([]*models.StudentWithClass, error) {
+func (r *StudentRepository) SearchByName(ctx context.Context, classID int, searchTerm string) ([]*models.StudentWithClass, error) {
 	query := `
 		SELECT id, first_name, last_name, class_id, class_name, is_active, created_at
 		FROM v_students_with_class
-		WHERE class_id = ? AND is_active = 1
-		  AND (first_name LIKE ? OR last_name LIKE ?)
+		WHERE class_id = ? AND is_active = TRUE
+		  AND (LOWER(first_name) LIKE LOWER(?) OR LOWER(last_name) LIKE LOWER(?))
 		ORDER BY last_name, first_name
 	`
 	searchPattern := "%" + searchTerm + "%"
-	rows, err := r.db.Query(query, classID, searchPattern, searchPattern)
+	rows, err := r.db.QueryContext(ctx, query, classID, searchPattern, searchPattern)
 	if err != nil {
 		return nil, err
 	}
@@ -161,44 +171,44 @@ func (r *StudentRepository) SearchByName(classID int, searchTerm string) ([]*mod
 }
 
 // Update updates student information
-func (r *StudentRepository) Update(id int, req *models.UpdateStudentRequest) error {
+func (r *StudentRepository) Update(ctx context.Context, id int, req *models.UpdateStudentRequest) error {
 	query := `
 		UPDATE students
-		SET first_name = COALESCE(?, first_name),
-		    last_name = COALESCE(?, last_name),
+		SET first_name = COALESCE(NULLIF(?, ''), first_name),
+		    last_name = COALESCE(NULLIF(?, ''), last_name),
 		    class_id = COALESCE(?, class_id),
 		    is_active = COALESCE(?, is_active),
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, req.FirstName, req.LastName, req.ClassID, req.IsActive, id)
-	return err
+	_, err := r.db.ExecContext(ctx, query, req.FirstName, req.LastName, req.ClassID, req.IsActive, id)
+	return database.Classify(err)
 }
 
 // Delete deletes a student (soft delete by setting is_active = false)
-func (r *StudentRepository) Delete(id int) error {
-	query := "UPDATE students SET is_active = 0 WHERE id = ?"
-	_, err := r.db.Exec(query, id)
+func (r *StudentRepository) Delete(ctx context.Context, id int) error {
+	query := "UPDATE students SET is_active = FALSE WHERE id = ?"
+	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
 // HardDelete permanently deletes a student
-func (r *StudentRepository) HardDelete(id int) error {
+func (r *StudentRepository) HardDelete(ctx context.Context, id int) error {
 	query := "DELETE FROM students WHERE id = ?"
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
 // GetAll retrieves all students with pagination
-func (r *StudentRepository) GetAll(limit, offset int) ([]*models.StudentWithClass, error) {
+func (r *StudentRepository) GetAll(ctx context.Context, limit, offset int) ([]*models.StudentWithClass, error) {
 	query := `
 		SELECT id, first_name, last_name, class_id, class_name, is_active, created_at
 		FROM v_students_with_class
-		WHERE is_active = 1
+		WHERE is_active = TRUE
 		ORDER BY class_name, last_name, first_name
 		LIMIT ? OFFSET ?
 	`
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -226,41 +236,41 @@ func (r *StudentRepository) GetAll(limit, offset int) ([]*models.StudentWithClas
 }
 
 // Count returns total number of active students
-func (r *StudentRepository) Count() (int, error) {
+func (r *StudentRepository) Count(ctx context.Context) (int, error) {
 	var count int
-	query := "SELECT COUNT(*) FROM students WHERE is_active = 1"
-	err := r.db.QueryRow(query).Scan(&count)
+	query := "SELECT COUNT(*) FROM students WHERE is_active = TRUE"
+	err := r.db.QueryRowContext(ctx, query).Scan(&count)
 	return count, err
 }
 
 // CountByClass returns number of students in a class
-func (r *StudentRepository) CountByClass(classID int) (int, error) {
+func (r *StudentRepository) CountByClass(ctx context.Context, classID int) (int, error) {
 	var count int
-	query := "SELECT COUNT(*) FROM students WHERE class_id = ? AND is_active = 1"
-	err := r.db.QueryRow(query, classID).Scan(&count)
+	query := "SELECT COUNT(*) FROM students WHERE class_id = ? AND is_active = TRUE"
+	err := r.db.QueryRowContext(ctx, query, classID).Scan(&count)
 	return count, err
 }
 
 // LinkToParent links a student to a parent
-func (r *StudentRepository) LinkToParent(parentID, studentID int) error {
-	query := "INSERT OR IGNORE INTO parent_students (parent_id, student_id) VALUES (?, ?)"
-	_, err := r.db.Exec(query, parentID, studentID)
+func (r *StudentRepository) LinkToParent(ctx context.Context, parentID, studentID int) error {
+	query := "INSERT INTO parent_students (parent_id, student_id) VALUES (?, ?) ON CONFLICT DO NOTHING"
+	_, err := r.db.ExecContext(ctx, query, parentID, studentID)
 	if err != nil {
-		return err
+		return database.Classify(err)
 	}
 
 	return nil
 }
 
 // UnlinkFromParent removes the link between student and parent
-func (r *StudentRepository) UnlinkFromParent(parentID, studentID int) error {
+func (r *StudentRepository) UnlinkFromParent(ctx context.Context, parentID, studentID int) error {
 	query := "DELETE FROM parent_students WHERE parent_id = ? AND student_id = ?"
-	_, err := r.db.Exec(query, parentID, studentID)
+	_, err := r.db.ExecContext(ctx, query, parentID, studentID)
 	return err
 }
 
 // GetStudentParents retrieves all parents linked to a student
-func (r *StudentRepository) GetStudentParents(studentID int) ([]*models.User, error) {
+func (r *StudentRepository) GetStudentParents(ctx context.Context, studentID int) ([]*models.User, error) {
 	query := `
 		SELECT u.id, u.telegram_id, u.telegram_username, u.phone_number,
 		       u.language, u.registered_at
@@ -269,7 +279,7 @@ func (r *StudentRepository) GetStudentParents(studentID int) ([]*models.User, er
 		WHERE ps.student_id = ?
 		ORDER BY u.registered_at
 	`
-	rows, err := r.db.Query(query, studentID)
+	rows, err := r.db.QueryContext(ctx, query, studentID)
 	if err != nil {
 		return nil, err
 	}
@@ -296,7 +306,7 @@ func (r *StudentRepository) GetStudentParents(studentID int) ([]*models.User, er
 }
 
 // GetParentStudents retrieves all students linked to a parent
-func (r *StudentRepository) GetParentStudents(parentID int) ([]*models.ParentChild, error) {
+func (r *StudentRepository) GetParentStudents(ctx context.Context, parentID int) ([]*models.ParentChild, error) {
 	query := `
 		SELECT id, parent_id, telegram_id, phone_number, student_id,
 		       student_first_name, student_last_name, class_id, class_name, linked_at
@@ -304,7 +314,7 @@ func (r *StudentRepository) GetParentStudents(parentID int) ([]*models.ParentChi
 		WHERE parent_id = ?
 		ORDER BY class_name, student_last_name, student_first_name
 	`
-	rows, err := r.db.Query(query, parentID)
+	rows, err := r.db.QueryContext(ctx, query, parentID)
 	if err != nil {
 		return nil, err
 	}
@@ -335,23 +345,23 @@ func (r *StudentRepository) GetParentStudents(parentID int) ([]*models.ParentChi
 }
 
 // CountParentStudents returns the number of students linked to a parent
-func (r *StudentRepository) CountParentStudents(parentID int) (int, error) {
+func (r *StudentRepository) CountParentStudents(ctx context.Context, parentID int) (int, error) {
 	var count int
 	query := "SELECT COUNT(*) FROM parent_students WHERE parent_id = ?"
-	err := r.db.QueryRow(query, parentID).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, parentID).Scan(&count)
 	return count, err
 }
 
 // IsStudentLinkedToParent checks if a student is already linked to a parent
-func (r *StudentRepository) IsStudentLinkedToParent(parentID, studentID int) (bool, error) {
+func (r *StudentRepository) IsStudentLinkedToParent(ctx context.Context, parentID, studentID int) (bool, error) {
 	query := "SELECT EXISTS(SELECT 1 FROM parent_students WHERE parent_id = ? AND student_id = ?)"
 	var exists bool
-	err := r.db.QueryRow(query, parentID, studentID).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, parentID, studentID).Scan(&exists)
 	return exists, err
 }
 
 // GetStudentsByIDs retrieves multiple students by their IDs
-func (r *StudentRepository) GetStudentsByIDs(studentIDs []int) ([]*models.StudentWithClass, error) {
+func (r *StudentRepository) GetStudentsByIDs(ctx context.Context, studentIDs []int) ([]*models.StudentWithClass, error) {
 	if len(studentIDs) == 0 {
 		return []*models.StudentWithClass{}, nil
 	}
@@ -370,7 +380,70 @@ func (r *StudentRepository) GetStudentsByIDs(studentIDs []int) ([]*models.Studen
 		args[i] = id
 	}
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var students []*models.StudentWithClass
+	for rows.Next() {
+		student := &models.StudentWithClass{}
+		err := rows.Scan(
+			&student.ID,
+			&student.FirstName,
+			&student.LastName,
+			&student.ClassID,
+			&student.ClassName,
+			&student.IsActive,
+			&student.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		students = append(students, student)
+	}
+
+	return students, nil
+}
+
+// studentFilterWhere builds the WHERE clause for a student filter
+func studentFilterWhere(filter *models.StudentFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if !filter.IncludeInactive {
+		conditions = append(conditions, "is_active = TRUE")
+	}
+	if filter.ClassID != nil {
+		conditions = append(conditions, "class_id = ?")
+		args = append(args, *filter.ClassID)
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, "(LOWER(first_name) LIKE LOWER(?) OR LOWER(last_name) LIKE LOWER(?))")
+		pattern := "%" + filter.Search + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// List retrieves students matching a filter with pagination
+func (r *StudentRepository) List(ctx context.Context, filter *models.StudentFilter) ([]*models.StudentWithClass, error) {
+	where, args := studentFilterWhere(filter)
+	query := `
+		SELECT id, first_name, last_name, class_id, class_name, is_active, created_at
+		FROM v_students_with_class
+		` + where + `
+		ORDER BY class_name, last_name, first_name
+		LIMIT ? OFFSET ?
+	`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -397,6 +470,15 @@ func (r *StudentRepository) GetStudentsByIDs(studentIDs []int) ([]*models.Studen
 	return students, nil
 }
 
+// CountFiltered returns the number of students matching a filter
+func (r *StudentRepository) CountFiltered(ctx context.Context, filter *models.StudentFilter) (int, error) {
+	where, args := studentFilterWhere(filter)
+
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM v_students_with_class "+where, args...).Scan(&count)
+	return count, err
+}
+
 // Helper function to build SQL placeholders for IN clause
 func buildPlaceholders(count int) string {
 	if count <= 0 {
@@ -1,15 +1,18 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
+	"parent-bot/internal/database"
 	"parent-bot/internal/models"
 )
 
 // TeacherRepository handles teacher data operations
 type TeacherRepository struct {
-	db *sql.DB
+	db database.DBTX
 }
 
 // NewTeacherRepository creates a new teacher repository
@@ -17,41 +20,48 @@ func NewTeacherRepository(db *sql.DB) *TeacherRepository {
 	return &TeacherRepository{db: db}
 }
 
+// WithTx returns a copy of the repository that runs its statements in tx
+func (r *TeacherRepository) WithTx(tx *sql.Tx) *TeacherRepository {
+	return &TeacherRepository{db: tx}
+}
+
 // Create creates a new teacher
-func (r *TeacherRepository) Create(firstName, lastName, phoneNumber, language string, addedByAdminID int) (int64, error) {
+func (r *TeacherRepository) Create(ctx context.Context, firstName, lastName, phoneNumber, language string, addedByAdminID int) (int64, error) {
 	query := `
 		INSERT INTO teachers (phone_number, first_name, last_name, language, added_by_admin_id)
 		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
 	`
-	result, err := r.db.Exec(query, phoneNumber, firstName, lastName, language, addedByAdminID)
+	var id int64
+	err := r.db.QueryRowContext(ctx, query, phoneNumber, firstName, lastName, language, addedByAdminID).Scan(&id)
 	if err != nil {
-		return 0, err
+		return 0, database.Classify(err)
 	}
 
-	return result.LastInsertId()
+	return id, nil
 }
 
 // UpdateTelegramID updates teacher's telegram ID and marks as registered
-func (r *TeacherRepository) UpdateTelegramID(teacherID int, telegramID int64, username string) error {
+func (r *TeacherRepository) UpdateTelegramID(ctx context.Context, teacherID int, telegramID int64, username string) error {
 	query := `
 		UPDATE teachers
 		SET telegram_id = ?, telegram_username = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, telegramID, username, teacherID)
-	return err
+	_, err := r.db.ExecContext(ctx, query, telegramID, username, teacherID)
+	return database.Classify(err)
 }
 
 // GetByID retrieves a teacher by ID
-func (r *TeacherRepository) GetByID(id int) (*models.Teacher, error) {
+func (r *TeacherRepository) GetByID(ctx context.Context, id int) (*models.Teacher, error) {
 	query := `
 		SELECT id, phone_number, telegram_id, first_name, last_name, language,
-		       is_active, added_by_admin_id, created_at
+		       is_active, added_by_admin_id, created_at, role
 		FROM teachers
 		WHERE id = ?
 	`
 	teacher := &models.Teacher{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&teacher.ID,
 		&teacher.PhoneNumber,
 		&teacher.TelegramID,
@@ -61,6 +71,7 @@ func (r *TeacherRepository) GetByID(id int) (*models.Teacher, error) {
 		&teacher.IsActive,
 		&teacher.AddedByAdminID,
 		&teacher.CreatedAt,
+		&teacher.Role,
 	)
 	if err != nil {
 		return nil, err
@@ -70,15 +81,15 @@ func (r *TeacherRepository) GetByID(id int) (*models.Teacher, error) {
 }
 
 // GetByPhoneNumber retrieves a teacher by phone number
-func (r *TeacherRepository) GetByPhoneNumber(phoneNumber string) (*models.Teacher, error) {
+func (r *TeacherRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.Teacher, error) {
 	query := `
 		SELECT id, phone_number, telegram_id, first_name, last_name, language,
-		       is_active, added_by_admin_id, created_at
+		       is_active, added_by_admin_id, created_at, role
 		FROM teachers
 		WHERE phone_number = ?
 	`
 	teacher := &models.Teacher{}
-	err := r.db.QueryRow(query, phoneNumber).Scan(
+	err := r.db.QueryRowContext(ctx, query, phoneNumber).Scan(
 		&teacher.ID,
 		&teacher.PhoneNumber,
 		&teacher.TelegramID,
@@ -88,6 +99,7 @@ func (r *TeacherRepository) GetByPhoneNumber(phoneNumber string) (*models.Teache
 		&teacher.IsActive,
 		&teacher.AddedByAdminID,
 		&teacher.CreatedAt,
+		&teacher.Role,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -100,20 +112,20 @@ func (r *TeacherRepository) GetByPhoneNumber(phoneNumber string) (*models.Teache
 }
 
 // GetByPhone is an alias for GetByPhoneNumber
-func (r *TeacherRepository) GetByPhone(phoneNumber string) (*models.Teacher, error) {
-	return r.GetByPhoneNumber(phoneNumber)
+func (r *TeacherRepository) GetByPhone(ctx context.Context, phoneNumber string) (*models.Teacher, error) {
+	return r.GetByPhoneNumber(ctx, phoneNumber)
 }
 
 // GetByTelegramID retrieves a teacher by Telegram ID
-func (r *TeacherRepository) GetByTelegramID(telegramID int64) (*models.Teacher, error) {
+func (r *TeacherRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*models.Teacher, error) {
 	query := `
 		SELECT id, phone_number, telegram_id, first_name, last_name, language,
-		       is_active, added_by_admin_id, created_at
+		       is_active, added_by_admin_id, created_at, role
 		FROM teachers
 		WHERE telegram_id = ?
 	`
 	teacher := &models.Teacher{}
-	err := r.db.QueryRow(query, telegramID).Scan(
+	err := r.db.QueryRowContext(ctx, query, telegramID).Scan(
 		&teacher.ID,
 		&teacher.PhoneNumber,
 		&teacher.TelegramID,
@@ -123,6 +135,7 @@ func (r *TeacherRepository) GetByTelegramID(telegramID int64) (*models.Teacher,
 		&teacher.IsActive,
 		&teacher.AddedByAdminID,
 		&teacher.CreatedAt,
+		&teacher.Role,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -135,47 +148,48 @@ func (r *TeacherRepository) GetByTelegramID(telegramID int64) (*models.Teacher,
 }
 
 // LinkTelegramID links a Telegram ID to a teacher account
-func (r *TeacherRepository) LinkTelegramID(phoneNumber string, telegramID int64, language string) error {
+func (r *TeacherRepository) LinkTelegramID(ctx context.Context, phoneNumber string, telegramID int64, language string) error {
 	query := `
 		UPDATE teachers
 		SET telegram_id = ?, language = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE phone_number = ?
 	`
-	_, err := r.db.Exec(query, telegramID, language, phoneNumber)
-	return err
+	_, err := r.db.ExecContext(ctx, query, telegramID, language, phoneNumber)
+	return database.Classify(err)
 }
 
 // Update updates teacher information
-func (r *TeacherRepository) Update(id int, req *models.UpdateTeacherRequest) error {
+func (r *TeacherRepository) Update(ctx context.Context, id int, req *models.UpdateTeacherRequest) error {
 	query := `
 		UPDATE teachers
-		SET first_name = COALESCE(?, first_name),
-		    last_name = COALESCE(?, last_name),
-		    language = COALESCE(?, language),
-		    is_active = COALESCE(?, is_active)
+		SET first_name = COALESCE(NULLIF(?, ''), first_name),
+		    last_name = COALESCE(NULLIF(?, ''), last_name),
+		    language = COALESCE(NULLIF(?, ''), language),
+		    is_active = COALESCE(?, is_active),
+		    role = COALESCE(NULLIF(?, ''), role)
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, req.FirstName, req.LastName, req.Language, req.IsActive, id)
+	_, err := r.db.ExecContext(ctx, query, req.FirstName, req.LastName, req.Language, req.IsActive, req.Role, id)
 	return err
 }
 
 // Delete deletes a teacher
-func (r *TeacherRepository) Delete(id int) error {
+func (r *TeacherRepository) Delete(ctx context.Context, id int) error {
 	query := "DELETE FROM teachers WHERE id = ?"
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
 // GetAll retrieves all teachers with pagination
-func (r *TeacherRepository) GetAll(limit, offset int) ([]*models.Teacher, error) {
+func (r *TeacherRepository) GetAll(ctx context.Context, limit, offset int) ([]*models.Teacher, error) {
 	query := `
 		SELECT id, phone_number, telegram_id, first_name, last_name, language,
-		       is_active, added_by_admin_id, created_at
+		       is_active, added_by_admin_id, created_at, role
 		FROM teachers
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
 	`
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -194,6 +208,7 @@ func (r *TeacherRepository) GetAll(limit, offset int) ([]*models.Teacher, error)
 			&teacher.IsActive,
 			&teacher.AddedByAdminID,
 			&teacher.CreatedAt,
+			&teacher.Role,
 		)
 		if err != nil {
 			return nil, err
@@ -205,15 +220,15 @@ func (r *TeacherRepository) GetAll(limit, offset int) ([]*models.Teacher, error)
 }
 
 // GetActiveTeachers retrieves all active teachers
-func (r *TeacherRepository) GetActiveTeachers() ([]*models.Teacher, error) {
+func (r *TeacherRepository) GetActiveTeachers(ctx context.Context) ([]*models.Teacher, error) {
 	query := `
 		SELECT id, phone_number, telegram_id, first_name, last_name, language,
-		       is_active, added_by_admin_id, created_at
+		       is_active, added_by_admin_id, created_at, role
 		FROM teachers
-		WHERE is_active = 1
+		WHERE is_active = TRUE
 		ORDER BY last_name, first_name
 	`
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -232,6 +247,7 @@ func (r *TeacherRepository) GetActiveTeachers() ([]*models.Teacher, error) {
 			&teacher.IsActive,
 			&teacher.AddedByAdminID,
 			&teacher.CreatedAt,
+			&teacher.Role,
 		)
 		if err != nil {
 			return nil, err
@@ -243,29 +259,29 @@ func (r *TeacherRepository) GetActiveTeachers() ([]*models.Teacher, error) {
 }
 
 // Count returns total number of teachers
-func (r *TeacherRepository) Count() (int, error) {
+func (r *TeacherRepository) Count(ctx context.Context) (int, error) {
 	var count int
 	query := "SELECT COUNT(*) FROM teachers"
-	err := r.db.QueryRow(query).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query).Scan(&count)
 	return count, err
 }
 
 // AssignToClass assigns a teacher to a class
-func (r *TeacherRepository) AssignToClass(teacherID, classID int) error {
-	query := "INSERT OR IGNORE INTO teacher_classes (teacher_id, class_id) VALUES (?, ?)"
-	_, err := r.db.Exec(query, teacherID, classID)
-	return err
+func (r *TeacherRepository) AssignToClass(ctx context.Context, teacherID, classID int) error {
+	query := "INSERT INTO teacher_classes (teacher_id, class_id) VALUES (?, ?) ON CONFLICT DO NOTHING"
+	_, err := r.db.ExecContext(ctx, query, teacherID, classID)
+	return database.Classify(err)
 }
 
 // RemoveFromClass removes a teacher from a class
-func (r *TeacherRepository) RemoveFromClass(teacherID, classID int) error {
+func (r *TeacherRepository) RemoveFromClass(ctx context.Context, teacherID, classID int) error {
 	query := "DELETE FROM teacher_classes WHERE teacher_id = ? AND class_id = ?"
-	_, err := r.db.Exec(query, teacherID, classID)
+	_, err := r.db.ExecContext(ctx, query, teacherID, classID)
 	return err
 }
 
 // GetTeacherClasses retrieves all classes assigned to a teacher
-func (r *TeacherRepository) GetTeacherClasses(teacherID int) ([]*models.Class, error) {
+func (r *TeacherRepository) GetTeacherClasses(ctx context.Context, teacherID int) ([]*models.Class, error) {
 	query := `
 		SELECT c.id, c.class_name, c.is_active, c.created_at, c.updated_at
 		FROM classes c
@@ -273,7 +289,7 @@ func (r *TeacherRepository) GetTeacherClasses(teacherID int) ([]*models.Class, e
 		WHERE tc.teacher_id = ?
 		ORDER BY c.class_name
 	`
-	rows, err := r.db.Query(query, teacherID)
+	rows, err := r.db.QueryContext(ctx, query, teacherID)
 	if err != nil {
 		return nil, err
 	}
@@ -293,16 +309,16 @@ func (r *TeacherRepository) GetTeacherClasses(teacherID int) ([]*models.Class, e
 }
 
 // GetClassTeachers retrieves all teachers assigned to a class
-func (r *TeacherRepository) GetClassTeachers(classID int) ([]*models.Teacher, error) {
+func (r *TeacherRepository) GetClassTeachers(ctx context.Context, classID int) ([]*models.Teacher, error) {
 	query := `
 		SELECT t.id, t.phone_number, t.telegram_id, t.first_name, t.last_name,
-		       t.language, t.is_active, t.added_by_admin_id, t.created_at
+		       t.language, t.is_active, t.added_by_admin_id, t.created_at, t.role
 		FROM teachers t
 		INNER JOIN teacher_classes tc ON t.id = tc.teacher_id
-		WHERE tc.class_id = ? AND t.is_active = 1
+		WHERE tc.class_id = ? AND t.is_active = TRUE
 		ORDER BY t.last_name, t.first_name
 	`
-	rows, err := r.db.Query(query, classID)
+	rows, err := r.db.QueryContext(ctx, query, classID)
 	if err != nil {
 		return nil, err
 	}
@@ -321,6 +337,7 @@ func (r *TeacherRepository) GetClassTeachers(classID int) ([]*models.Teacher, er
 			&teacher.IsActive,
 			&teacher.AddedByAdminID,
 			&teacher.CreatedAt,
+			&teacher.Role,
 		)
 		if err != nil {
 			return nil, err
@@ -332,21 +349,21 @@ func (r *TeacherRepository) GetClassTeachers(classID int) ([]*models.Teacher, er
 }
 
 // IsTeacherAssignedToClass checks if a teacher is assigned to a class
-func (r *TeacherRepository) IsTeacherAssignedToClass(teacherID, classID int) (bool, error) {
+func (r *TeacherRepository) IsTeacherAssignedToClass(ctx context.Context, teacherID, classID int) (bool, error) {
 	query := "SELECT EXISTS(SELECT 1 FROM teacher_classes WHERE teacher_id = ? AND class_id = ?)"
 	var exists bool
-	err := r.db.QueryRow(query, teacherID, classID).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, teacherID, classID).Scan(&exists)
 	return exists, err
 }
 
 // IsTeacher checks if a phone number or telegram ID belongs to a teacher
-func (r *TeacherRepository) IsTeacher(phoneNumber string, telegramID int64) (bool, *models.Teacher, error) {
+func (r *TeacherRepository) IsTeacher(ctx context.Context, phoneNumber string, telegramID int64) (bool, *models.Teacher, error) {
 	var teacher *models.Teacher
 	var err error
 
 	// Try by phone number first
 	if phoneNumber != "" {
-		teacher, err = r.GetByPhoneNumber(phoneNumber)
+		teacher, err = r.GetByPhoneNumber(ctx, phoneNumber)
 		if err == nil {
 			return true, teacher, nil
 		}
@@ -357,7 +374,7 @@ func (r *TeacherRepository) IsTeacher(phoneNumber string, telegramID int64) (boo
 
 	// Try by telegram ID
 	if telegramID != 0 {
-		teacher, err = r.GetByTelegramID(telegramID)
+		teacher, err = r.GetByTelegramID(ctx, telegramID)
 		if err == nil {
 			return true, teacher, nil
 		}
@@ -368,3 +385,84 @@ func (r *TeacherRepository) IsTeacher(phoneNumber string, telegramID int64) (boo
 
 	return false, nil, nil
 }
+
+// teacherFilterWhere builds the WHERE clause for a teacher filter
+func teacherFilterWhere(filter *models.TeacherFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if filter.Search != "" {
+		conditions = append(conditions, "(LOWER(first_name) LIKE LOWER(?) OR LOWER(last_name) LIKE LOWER(?) OR phone_number LIKE ?)")
+		pattern := "%" + filter.Search + "%"
+		args = append(args, pattern, pattern, pattern)
+	}
+	if filter.IsActive != nil {
+		conditions = append(conditions, "is_active = ?")
+		args = append(args, *filter.IsActive)
+	}
+	if filter.ClassID != nil {
+		conditions = append(conditions, "id IN (SELECT teacher_id FROM teacher_classes WHERE class_id = ?)")
+		args = append(args, *filter.ClassID)
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, "role = ?")
+		args = append(args, filter.Role)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// List retrieves teachers matching a filter with pagination
+func (r *TeacherRepository) List(ctx context.Context, filter *models.TeacherFilter) ([]*models.Teacher, error) {
+	where, args := teacherFilterWhere(filter)
+	query := `
+		SELECT id, phone_number, telegram_id, first_name, last_name, language,
+		       is_active, added_by_admin_id, created_at, role
+		FROM teachers
+		` + where + `
+		ORDER BY last_name, first_name, id
+		LIMIT ? OFFSET ?
+	`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teachers []*models.Teacher
+	for rows.Next() {
+		teacher := &models.Teacher{}
+		err := rows.Scan(
+			&teacher.ID,
+			&teacher.PhoneNumber,
+			&teacher.TelegramID,
+			&teacher.FirstName,
+			&teacher.LastName,
+			&teacher.Language,
+			&teacher.IsActive,
+			&teacher.AddedByAdminID,
+			&teacher.CreatedAt,
+			&teacher.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+		teachers = append(teachers, teacher)
+	}
+
+	return teachers, nil
+}
+
+// CountFiltered returns the number of teachers matching a filter
+func (r *TeacherRepository) CountFiltered(ctx context.Context, filter *models.TeacherFilter) (int, error) {
+	where, args := teacherFilterWhere(filter)
+
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM teachers "+where, args...).Scan(&count)
+	return count, err
+}
@@ -1,24 +1,28 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"time"
 
+	"parent-bot/internal/database"
 	"parent-bot/internal/models"
 )
 
 // TestResultRepository handles test result data operations
 type TestResultRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect database.Dialect
 }
 
 // NewTestResultRepository creates a new test result repository
 func NewTestResultRepository(db *sql.DB) *TestResultRepository {
-	return &TestResultRepository{db: db}
+	return &TestResultRepository{db: db, dialect: database.DialectOf(db)}
 }
 
 // Create creates a new test result
-func (r *TestResultRepository) Create(req *models.CreateTestResultRequest) (int64, error) {
+func (r *TestResultRepository) Create(ctx context.Context, req *models.CreateTestResultRequest) (int64, error) {
 	testDate, err := time.Parse("2006-01-02", req.TestDate)
 	if err != nil {
 		return 0, err
@@ -27,24 +31,26 @@ func (r *TestResultRepository) Create(req *models.CreateTestResultRequest) (int6
 	query := `
 		INSERT INTO test_results (student_id, subject_name, score, test_date, teacher_id, admin_id)
 		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
 	`
-	result, err := r.db.Exec(query,
+	var id int64
+	err = r.db.QueryRowContext(ctx, query,
 		req.StudentID,
 		req.SubjectName,
 		req.Score,
 		testDate,
 		req.TeacherID,
 		req.AdminID,
-	)
+	).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	return id, nil
 }
 
 // GetByID retrieves a test result by ID
-func (r *TestResultRepository) GetByID(id int) (*models.TestResult, error) {
+func (r *TestResultRepository) GetByID(ctx context.Context, id int) (*models.TestResult, error) {
 	query := `
 		SELECT id, student_id, subject_name, score, test_date,
 		       teacher_id, admin_id, created_at, updated_at
@@ -52,7 +58,7 @@ func (r *TestResultRepository) GetByID(id int) (*models.TestResult, error) {
 		WHERE id = ?
 	`
 	result := &models.TestResult{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&result.ID,
 		&result.StudentID,
 		&result.SubjectName,
@@ -71,7 +77,7 @@ func (r *TestResultRepository) GetByID(id int) (*models.TestResult, error) {
 }
 
 // GetByStudentID retrieves all test results for a student
-func (r *TestResultRepository) GetByStudentID(studentID int, limit, offset int) ([]*models.TestResultDetailed, error) {
+func (r *TestResultRepository) GetByStudentID(ctx context.Context, studentID int, limit, offset int) ([]*models.TestResultDetailed, error) {
 	query := `
 		SELECT id, student_id, first_name, last_name, class_id, class_name,
 		       subject_name, score, test_date, created_at
@@ -80,7 +86,7 @@ func (r *TestResultRepository) GetByStudentID(studentID int, limit, offset int)
 		ORDER BY test_date DESC, created_at DESC
 		LIMIT ? OFFSET ?
 	`
-	rows, err := r.db.Query(query, studentID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, studentID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -111,7 +117,7 @@ func (r *TestResultRepository) GetByStudentID(studentID int, limit, offset int)
 }
 
 // GetByClassID retrieves all test results for a class
-func (r *TestResultRepository) GetByClassID(classID int, limit, offset int) ([]*models.TestResultDetailed, error) {
+func (r *TestResultRepository) GetByClassID(ctx context.Context, classID int, limit, offset int) ([]*models.TestResultDetailed, error) {
 	query := `
 		SELECT id, student_id, first_name, last_name, class_id, class_name,
 		       subject_name, score, test_date, created_at
@@ -120,7 +126,7 @@ func (r *TestResultRepository) GetByClassID(classID int, limit, offset int) ([]*
 		ORDER BY class_name, last_name, first_name, test_date DESC
 		LIMIT ? OFFSET ?
 	`
-	rows, err := r.db.Query(query, classID, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, classID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -151,16 +157,16 @@ func (r *TestResultRepository) GetByClassID(classID int, limit, offset int) ([]*
 }
 
 // GetByClassIDAndDateRange retrieves test results for a class within a date range
-func (r *TestResultRepository) GetByClassIDAndDateRange(classID int, startDate, endDate string, limit, offset int) ([]*models.TestResultDetailed, error) {
-	query := `
+func (r *TestResultRepository) GetByClassIDAndDateRange(ctx context.Context, classID int, startDate, endDate string, limit, offset int) ([]*models.TestResultDetailed, error) {
+	query := fmt.Sprintf(`
 		SELECT id, student_id, first_name, last_name, class_id, class_name,
 		       subject_name, score, test_date, created_at
 		FROM v_test_results_detailed
-		WHERE class_id = ? AND test_date >= ? AND test_date <= ?
+		WHERE class_id = ? AND %s BETWEEN %s AND %s
 		ORDER BY class_name, last_name, first_name, test_date DESC
 		LIMIT ? OFFSET ?
-	`
-	rows, err := r.db.Query(query, classID, startDate, endDate, limit, offset)
+	`, r.dialect.Date("test_date"), r.dialect.Date("?"), r.dialect.Date("?"))
+	rows, err := r.db.QueryContext(ctx, query, classID, startDate, endDate, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -191,7 +197,7 @@ func (r *TestResultRepository) GetByClassIDAndDateRange(classID int, startDate,
 }
 
 // GetAllByClassID retrieves all test results for a class without pagination (for export)
-func (r *TestResultRepository) GetAllByClassID(classID int) ([]*models.TestResultDetailed, error) {
+func (r *TestResultRepository) GetAllByClassID(ctx context.Context, classID int) ([]*models.TestResultDetailed, error) {
 	query := `
 		SELECT id, student_id, first_name, last_name, class_id, class_name,
 		       subject_name, score, test_date, created_at
@@ -199,7 +205,7 @@ func (r *TestResultRepository) GetAllByClassID(classID int) ([]*models.TestResul
 		WHERE class_id = ?
 		ORDER BY last_name, first_name, subject_name, test_date DESC
 	`
-	rows, err := r.db.Query(query, classID)
+	rows, err := r.db.QueryContext(ctx, query, classID)
 	if err != nil {
 		return nil, err
 	}
@@ -230,7 +236,7 @@ func (r *TestResultRepository) GetAllByClassID(classID int) ([]*models.TestResul
 }
 
 // Update updates a test result
-func (r *TestResultRepository) Update(id int, req *models.UpdateTestResultRequest) error {
+func (r *TestResultRepository) Update(ctx context.Context, id int, req *models.UpdateTestResultRequest) error {
 	var testDate *time.Time
 	if req.TestDate != "" {
 		t, err := time.Parse("2006-01-02", req.TestDate)
@@ -248,35 +254,35 @@ func (r *TestResultRepository) Update(id int, req *models.UpdateTestResultReques
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := r.db.Exec(query, req.SubjectName, req.Score, testDate, id)
+	_, err := r.db.ExecContext(ctx, query, req.SubjectName, req.Score, testDate, id)
 	return err
 }
 
 // Delete deletes a test result (only admins can delete)
-func (r *TestResultRepository) Delete(id int) error {
+func (r *TestResultRepository) Delete(ctx context.Context, id int) error {
 	query := "DELETE FROM test_results WHERE id = ?"
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
 
 // Count returns total number of test results
-func (r *TestResultRepository) Count() (int, error) {
+func (r *TestResultRepository) Count(ctx context.Context) (int, error) {
 	var count int
 	query := "SELECT COUNT(*) FROM test_results"
-	err := r.db.QueryRow(query).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query).Scan(&count)
 	return count, err
 }
 
 // CountByStudent returns number of test results for a student
-func (r *TestResultRepository) CountByStudent(studentID int) (int, error) {
+func (r *TestResultRepository) CountByStudent(ctx context.Context, studentID int) (int, error) {
 	var count int
 	query := "SELECT COUNT(*) FROM test_results WHERE student_id = ?"
-	err := r.db.QueryRow(query, studentID).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, studentID).Scan(&count)
 	return count, err
 }
 
 // GetLatestByStudent retrieves the most recent test results for a student
-func (r *TestResultRepository) GetLatestByStudent(studentID int, limit int) ([]*models.TestResultDetailed, error) {
+func (r *TestResultRepository) GetLatestByStudent(ctx context.Context, studentID int, limit int) ([]*models.TestResultDetailed, error) {
 	query := `
 		SELECT id, student_id, first_name, last_name, class_id, class_name,
 		       subject_name, score, test_date, created_at
@@ -285,7 +291,7 @@ func (r *TestResultRepository) GetLatestByStudent(studentID int, limit int) ([]*
 		ORDER BY test_date DESC, created_at DESC
 		LIMIT ?
 	`
-	rows, err := r.db.Query(query, studentID, limit)
+	rows, err := r.db.QueryContext(ctx, query, studentID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -16,7 +17,7 @@ func NewTimetableRepository(db *sql.DB) *TimetableRepository {
 }
 
 // Create creates a new timetable or updates existing one for the class
-func (r *TimetableRepository) Create(req *models.CreateTimetableRequest) (*models.Timetable, error) {
+func (r *TimetableRepository) Create(ctx context.Context, req *models.CreateTimetableRequest) (*models.Timetable, error) {
 	query := `
 		INSERT INTO timetables (class_id, telegram_file_id, filename, file_type, mime_type, uploaded_by_admin_id)
 		VALUES (?, ?, ?, ?, ?, ?)
@@ -24,7 +25,7 @@ func (r *TimetableRepository) Create(req *models.CreateTimetableRequest) (*model
 	`
 
 	var timetable models.Timetable
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(ctx,
 		query,
 		req.ClassID,
 		req.TelegramFileID,
@@ -52,7 +53,7 @@ func (r *TimetableRepository) Create(req *models.CreateTimetableRequest) (*model
 }
 
 // GetByID gets timetable by ID
-func (r *TimetableRepository) GetByID(id int) (*models.Timetable, error) {
+func (r *TimetableRepository) GetByID(ctx context.Context, id int) (*models.Timetable, error) {
 	query := `
 		SELECT id, class_id, telegram_file_id, filename, file_type, mime_type, uploaded_by_admin_id, created_at, updated_at
 		FROM timetables
@@ -60,7 +61,7 @@ func (r *TimetableRepository) GetByID(id int) (*models.Timetable, error) {
 	`
 
 	var timetable models.Timetable
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&timetable.ID,
 		&timetable.ClassID,
 		&timetable.TelegramFileID,
@@ -84,7 +85,7 @@ func (r *TimetableRepository) GetByID(id int) (*models.Timetable, error) {
 }
 
 // GetByClassID gets the latest timetable for a specific class
-func (r *TimetableRepository) GetByClassID(classID int) (*models.Timetable, error) {
+func (r *TimetableRepository) GetByClassID(ctx context.Context, classID int) (*models.Timetable, error) {
 	query := `
 		SELECT id, class_id, telegram_file_id, filename, file_type, mime_type, uploaded_by_admin_id, created_at, updated_at
 		FROM timetables
@@ -94,7 +95,7 @@ func (r *TimetableRepository) GetByClassID(classID int) (*models.Timetable, erro
 	`
 
 	var timetable models.Timetable
-	err := r.db.QueryRow(query, classID).Scan(
+	err := r.db.QueryRowContext(ctx, query, classID).Scan(
 		&timetable.ID,
 		&timetable.ClassID,
 		&timetable.TelegramFileID,
@@ -118,7 +119,7 @@ func (r *TimetableRepository) GetByClassID(classID int) (*models.Timetable, erro
 }
 
 // GetByClassName gets the latest timetable for a class by name
-func (r *TimetableRepository) GetByClassName(className string) (*models.Timetable, error) {
+func (r *TimetableRepository) GetByClassName(ctx context.Context, className string) (*models.Timetable, error) {
 	query := `
 		SELECT t.id, t.class_id, t.telegram_file_id, t.filename, t.file_type, t.mime_type,
 		       t.uploaded_by_admin_id, t.created_at, t.updated_at
@@ -130,7 +131,7 @@ func (r *TimetableRepository) GetByClassName(className string) (*models.Timetabl
 	`
 
 	var timetable models.Timetable
-	err := r.db.QueryRow(query, className).Scan(
+	err := r.db.QueryRowContext(ctx, query, className).Scan(
 		&timetable.ID,
 		&timetable.ClassID,
 		&timetable.TelegramFileID,
@@ -154,7 +155,7 @@ func (r *TimetableRepository) GetByClassName(className string) (*models.Timetabl
 }
 
 // GetAll gets all timetables with pagination (for admin)
-func (r *TimetableRepository) GetAll(limit, offset int) ([]*models.Timetable, error) {
+func (r *TimetableRepository) GetAll(ctx context.Context, limit, offset int) ([]*models.Timetable, error) {
 	query := `
 		SELECT id, class_id, telegram_file_id, filename, file_type, mime_type, uploaded_by_admin_id, created_at, updated_at
 		FROM timetables
@@ -162,7 +163,7 @@ func (r *TimetableRepository) GetAll(limit, offset int) ([]*models.Timetable, er
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get timetables: %w", err)
 	}
@@ -192,7 +193,7 @@ func (r *TimetableRepository) GetAll(limit, offset int) ([]*models.Timetable, er
 }
 
 // Update updates an existing timetable
-func (r *TimetableRepository) Update(id int, req *models.CreateTimetableRequest) (*models.Timetable, error) {
+func (r *TimetableRepository) Update(ctx context.Context, id int, req *models.CreateTimetableRequest) (*models.Timetable, error) {
 	query := `
 		UPDATE timetables
 		SET telegram_file_id = ?, filename = ?, file_type = ?, mime_type = ?, uploaded_by_admin_id = ?
@@ -201,7 +202,7 @@ func (r *TimetableRepository) Update(id int, req *models.CreateTimetableRequest)
 	`
 
 	var timetable models.Timetable
-	err := r.db.QueryRow(
+	err := r.db.QueryRowContext(ctx,
 		query,
 		req.TelegramFileID,
 		req.Filename,
@@ -229,9 +230,9 @@ func (r *TimetableRepository) Update(id int, req *models.CreateTimetableRequest)
 }
 
 // Delete deletes a timetable
-func (r *TimetableRepository) Delete(id int) error {
+func (r *TimetableRepository) Delete(ctx context.Context, id int) error {
 	query := `DELETE FROM timetables WHERE id = ?`
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete timetable: %w", err)
 	}
@@ -239,9 +240,9 @@ func (r *TimetableRepository) Delete(id int) error {
 }
 
 // DeleteByClassID deletes all timetables for a specific class
-func (r *TimetableRepository) DeleteByClassID(classID int) error {
+func (r *TimetableRepository) DeleteByClassID(ctx context.Context, classID int) error {
 	query := `DELETE FROM timetables WHERE class_id = ?`
-	_, err := r.db.Exec(query, classID)
+	_, err := r.db.ExecContext(ctx, query, classID)
 	if err != nil {
 		return fmt.Errorf("failed to delete timetables for class: %w", err)
 	}
@@ -249,9 +250,9 @@ func (r *TimetableRepository) DeleteByClassID(classID int) error {
 }
 
 // Count counts total timetables
-func (r *TimetableRepository) Count() (int, error) {
+func (r *TimetableRepository) Count(ctx context.Context) (int, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM timetables").Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM timetables").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count timetables: %w", err)
 	}
@@ -259,10 +260,10 @@ func (r *TimetableRepository) Count() (int, error) {
 }
 
 // Exists checks if a timetable exists for a class
-func (r *TimetableRepository) Exists(classID int) (bool, error) {
+func (r *TimetableRepository) Exists(ctx context.Context, classID int) (bool, error) {
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM timetables WHERE class_id = ?)`
-	err := r.db.QueryRow(query, classID).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, classID).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check timetable existence: %w", err)
 	}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -16,33 +17,30 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 }
 
 // Create creates a new user (parent)
-func (r *UserRepository) Create(req *models.CreateUserRequest) (*models.User, error) {
+func (r *UserRepository) Create(ctx context.Context, req *models.CreateUserRequest) (*models.User, error) {
 	query := `
 		INSERT INTO users (telegram_id, telegram_username, phone_number, language)
 		VALUES (?, ?, ?, ?)
+		RETURNING id
 	`
 
-	result, err := r.db.Exec(
+	var id int
+	err := r.db.QueryRowContext(ctx,
 		query,
 		req.TelegramID,
 		req.TelegramUsername,
 		req.PhoneNumber,
 		req.Language,
-	)
+	).Scan(&id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %w", err)
-	}
-
-	return r.GetByID(int(id))
+	return r.GetByID(ctx, id)
 }
 
 // GetByTelegramID gets user by telegram ID (indexed, fast query)
-func (r *UserRepository) GetByTelegramID(telegramID int64) (*models.User, error) {
+func (r *UserRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*models.User, error) {
 	query := `
 		SELECT id, telegram_id, telegram_username, phone_number, language, registered_at
 		FROM users
@@ -50,7 +48,7 @@ func (r *UserRepository) GetByTelegramID(telegramID int64) (*models.User, error)
 	`
 
 	var user models.User
-	err := r.db.QueryRow(query, telegramID).Scan(
+	err := r.db.QueryRowContext(ctx, query, telegramID).Scan(
 		&user.ID,
 		&user.TelegramID,
 		&user.TelegramUsername,
@@ -71,7 +69,7 @@ func (r *UserRepository) GetByTelegramID(telegramID int64) (*models.User, error)
 }
 
 // GetByPhoneNumber gets user by phone number (indexed, fast query)
-func (r *UserRepository) GetByPhoneNumber(phoneNumber string) (*models.User, error) {
+func (r *UserRepository) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
 	query := `
 		SELECT id, telegram_id, telegram_username, phone_number, language, registered_at
 		FROM users
@@ -79,7 +77,7 @@ func (r *UserRepository) GetByPhoneNumber(phoneNumber string) (*models.User, err
 	`
 
 	var user models.User
-	err := r.db.QueryRow(query, phoneNumber).Scan(
+	err := r.db.QueryRowContext(ctx, query, phoneNumber).Scan(
 		&user.ID,
 		&user.TelegramID,
 		&user.TelegramUsername,
@@ -100,12 +98,12 @@ func (r *UserRepository) GetByPhoneNumber(phoneNumber string) (*models.User, err
 }
 
 // GetByPhone is an alias for GetByPhoneNumber
-func (r *UserRepository) GetByPhone(phoneNumber string) (*models.User, error) {
-	return r.GetByPhoneNumber(phoneNumber)
+func (r *UserRepository) GetByPhone(ctx context.Context, phoneNumber string) (*models.User, error) {
+	return r.GetByPhoneNumber(ctx, phoneNumber)
 }
 
 // GetByID gets user by ID
-func (r *UserRepository) GetByID(id int) (*models.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
 	query := `
 		SELECT id, telegram_id, telegram_username, phone_number, language, registered_at
 		FROM users
@@ -113,7 +111,7 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 	`
 
 	var user models.User
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.TelegramID,
 		&user.TelegramUsername,
@@ -134,7 +132,7 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 }
 
 // GetAll gets all users with pagination
-func (r *UserRepository) GetAll(limit, offset int) ([]*models.User, error) {
+func (r *UserRepository) GetAll(ctx context.Context, limit, offset int) ([]*models.User, error) {
 	query := `
 		SELECT id, telegram_id, telegram_username, phone_number, language,
  registered_at
@@ -143,7 +141,7 @@ func (r *UserRepository) GetAll(limit, offset int) ([]*models.User, error) {
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
@@ -158,7 +156,7 @@ func (r *UserRepository) GetAll(limit, offset int) ([]*models.User, error) {
 			&user.TelegramUsername,
 			&user.PhoneNumber,
 			&user.Language,
-				&user.RegisteredAt,
+			&user.RegisteredAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
@@ -170,18 +168,18 @@ func (r *UserRepository) GetAll(limit, offset int) ([]*models.User, error) {
 }
 
 // GetParentsByClassID gets all parents who have children in a specific class
-func (r *UserRepository) GetParentsByClassID(classID int) ([]*models.User, error) {
+func (r *UserRepository) GetParentsByClassID(ctx context.Context, classID int) ([]*models.User, error) {
 	query := `
 		SELECT DISTINCT u.id, u.telegram_id, u.telegram_username, u.phone_number,
 		       u.language, u.registered_at
 		FROM users u
 		INNER JOIN parent_students ps ON u.id = ps.parent_id
 		INNER JOIN students s ON ps.student_id = s.id
-		WHERE s.class_id = ? AND s.is_active = 1
+		WHERE s.class_id = ? AND s.is_active = TRUE
 		ORDER BY u.registered_at DESC
 	`
 
-	rows, err := r.db.Query(query, classID)
+	rows, err := r.db.QueryContext(ctx, query, classID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get parents by class: %w", err)
 	}
@@ -207,30 +205,38 @@ func (r *UserRepository) GetParentsByClassID(classID int) ([]*models.User, error
 	return users, nil
 }
 
-// GetParentsByClassIDs gets all parents who have children in any of the specified classes
-func (r *UserRepository) GetParentsByClassIDs(classIDs []int) ([]*models.User, error) {
+// GetParentsByClassIDs gets up to limit parents who have children in any of
+// the specified classes, ordered by ID. Pass the last ID of a page as afterID
+// to get the next one; 0 starts from the beginning.
+func (r *UserRepository) GetParentsByClassIDs(ctx context.Context, classIDs []int, afterID, limit int) ([]*models.User, error) {
 	if len(classIDs) == 0 {
 		return []*models.User{}, nil
 	}
 
 	// Build query with placeholders
 	query := fmt.Sprintf(`
-		SELECT DISTINCT u.id, u.telegram_id, u.telegram_username, u.phone_number,
+		SELECT u.id, u.telegram_id, u.telegram_username, u.phone_number,
 		       u.language, u.registered_at
 		FROM users u
-		INNER JOIN parent_students ps ON u.id = ps.parent_id
-		INNER JOIN students s ON ps.student_id = s.id
-		WHERE s.class_id IN (?%s) AND s.is_active = 1
-		ORDER BY u.registered_at DESC
+		WHERE u.id > ?
+		  AND EXISTS (
+			SELECT 1
+			FROM parent_students ps
+			INNER JOIN students s ON ps.student_id = s.id
+			WHERE ps.parent_id = u.id AND s.class_id IN (?%s) AND s.is_active = TRUE
+		  )
+		ORDER BY u.id
+		LIMIT ?
 	`, buildPlaceholders(len(classIDs)-1))
 
-	// Convert classIDs to interface slice
-	args := make([]interface{}, len(classIDs))
-	for i, id := range classIDs {
-		args[i] = id
+	args := make([]interface{}, 0, len(classIDs)+2)
+	args = append(args, afterID)
+	for _, id := range classIDs {
+		args = append(args, id)
 	}
+	args = append(args, limit)
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get parents by classes: %w", err)
 	}
@@ -253,18 +259,18 @@ func (r *UserRepository) GetParentsByClassIDs(classIDs []int) ([]*models.User, e
 		users = append(users, &user)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
 // Update updates user data
-func (r *UserRepository) Update(userID int, req *models.UpdateUserRequest) error {
+func (r *UserRepository) Update(ctx context.Context, userID int, req *models.UpdateUserRequest) error {
 	query := `
 		UPDATE users
 		SET language = COALESCE(?, language)
 		WHERE id = ?
 	`
 
-	_, err := r.db.Exec(query, req.Language, userID)
+	_, err := r.db.ExecContext(ctx, query, req.Language, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -273,9 +279,9 @@ func (r *UserRepository) Update(userID int, req *models.UpdateUserRequest) error
 }
 
 // Count counts total users
-func (r *UserRepository) Count() (int, error) {
+func (r *UserRepository) Count(ctx context.Context) (int, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count users: %w", err)
 	}
@@ -283,10 +289,10 @@ func (r *UserRepository) Count() (int, error) {
 }
 
 // Exists checks if user exists by telegram ID
-func (r *UserRepository) Exists(telegramID int64) (bool, error) {
+func (r *UserRepository) Exists(ctx context.Context, telegramID int64) (bool, error) {
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM users WHERE telegram_id = ?)`
-	err := r.db.QueryRow(query, telegramID).Scan(&exists)
+	err := r.db.QueryRowContext(ctx, query, telegramID).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check user existence: %w", err)
 	}
@@ -294,9 +300,8 @@ func (r *UserRepository) Exists(telegramID int64) (bool, error) {
 }
 
 // Delete deletes a user
-func (r *UserRepository) Delete(id int) error {
+func (r *UserRepository) Delete(ctx context.Context, id int) error {
 	query := "DELETE FROM users WHERE id = ?"
-	_, err := r.db.Exec(query, id)
+	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
-
@@ -0,0 +1,392 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"parent-bot/internal/metrics"
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+)
+
+// Errors returned by Trigger
+var (
+	ErrUnknownJob = errors.New("unknown job")
+	ErrJobRunning = errors.New("job is already running")
+	ErrStopped    = errors.New("scheduler is not running")
+)
+
+// Job is a background task run on a cron schedule
+type Job struct {
+	Name        string
+	Description string // "Uz / Ru" text shown to admins
+	Schedule    string // standard 5-field cron expression or descriptor such as @daily
+	CatchUp     bool   // run once at startup if a scheduled run was missed while the bot was down
+	Run         func(ctx context.Context) error
+}
+
+// Info describes a registered job for listing
+type Info struct {
+	Name        string
+	Description string
+	Schedule    string
+	NextRun     time.Time
+	Running     bool
+	History     *models.Job // persisted run history, nil until the job has been registered in the database
+}
+
+// entry is a registered job and its parsed schedule
+type entry struct {
+	job      Job
+	schedule cron.Schedule
+	next     time.Time
+	running  bool
+}
+
+// Scheduler runs registered jobs on their cron schedules in the school's timezone.
+// Runs are recorded in the jobs table; a job never runs twice concurrently.
+type Scheduler struct {
+	repo     *repository.JobRepository
+	location *time.Location
+	logger   *slog.Logger
+	now      func() time.Time // replaced in tests
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	ctx     context.Context // cancelled by Stop; passed to running jobs
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// New creates a scheduler evaluating schedules in location
+func New(repo *repository.JobRepository, location *time.Location, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		repo:     repo,
+		location: location,
+		logger:   logger,
+		now:      time.Now,
+		entries:  make(map[string]*entry),
+	}
+}
+
+// ParseSchedule validates a cron expression
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// Register adds a job. It must be called before Start.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job needs a name and a run function")
+	}
+
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx != nil {
+		return fmt.Errorf("job %s: scheduler already started", job.Name)
+	}
+	if _, exists := s.entries[job.Name]; exists {
+		return fmt.Errorf("job %s: already registered", job.Name)
+	}
+
+	s.entries[job.Name] = &entry{job: job, schedule: schedule}
+	return nil
+}
+
+// Start loads run history, catches up missed runs and schedules jobs until
+// ctx is cancelled or Stop is called
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.ctx != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("scheduler already started")
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	now := s.now()
+	var missed []*entry
+	for name, e := range s.entries {
+		history, err := s.repo.GetByName(ctx, name)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+
+		e.next = s.nextAfter(e, now)
+		if err := s.repo.Register(ctx, name, e.job.Schedule, e.next); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+
+		if e.job.CatchUp && s.wasMissed(e, history, now) {
+			missed = append(missed, e)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range missed {
+		s.logger.Info("catching up missed job run", "job", e.job.Name)
+		_ = s.launch(e, models.JobTriggerCatchUp)
+	}
+
+	s.wg.Add(1)
+	go s.loop()
+
+	return nil
+}
+
+// Stop stops scheduling and waits for running jobs, or for ctx to expire
+func (s *Scheduler) Stop(ctx context.Context) error {
+	// Cancelled under the lock, so that no run is launched once waiting starts
+	s.mu.Lock()
+	cancel := s.cancel
+	if cancel != nil {
+		cancel()
+	}
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler: jobs still running at shutdown: %w", ctx.Err())
+	}
+}
+
+// Location returns the timezone schedules are evaluated in
+func (s *Scheduler) Location() *time.Location {
+	return s.location
+}
+
+// Jobs lists registered jobs with their run history, ordered by name
+func (s *Scheduler) Jobs(ctx context.Context) ([]Info, error) {
+	history, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*models.Job, len(history))
+	for _, h := range history {
+		byName[h.Name] = h
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]Info, 0, len(s.entries))
+	for name, e := range s.entries {
+		infos = append(infos, Info{
+			Name:        name,
+			Description: e.job.Description,
+			Schedule:    e.job.Schedule,
+			NextRun:     e.next,
+			Running:     e.running,
+			History:     byName[name],
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Trigger starts a job now, outside its schedule. It does not wait for the run
+// to finish. It returns ErrUnknownJob, ErrJobRunning or ErrStopped.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	if err := s.launch(e, models.JobTriggerManual); err != nil {
+		return fmt.Errorf("%w: %s", err, name)
+	}
+	return nil
+}
+
+// loop sleeps until the earliest due job and launches every job that is due
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+
+	for {
+		s.mu.Lock()
+		var next time.Time
+		for _, e := range s.entries {
+			if next.IsZero() || e.next.Before(next) {
+				next = e.next
+			}
+		}
+		s.mu.Unlock()
+
+		// With no jobs, only shutdown can end the wait
+		wait := next.Sub(s.now())
+		if next.IsZero() {
+			wait = 24 * time.Hour
+		}
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.runDue(s.now())
+		}
+	}
+}
+
+// runDue launches jobs whose next run time has passed and reschedules them
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	var due []*entry
+	nextRuns := make(map[string]time.Time)
+	for _, e := range s.entries {
+		if e.next.After(now) {
+			continue
+		}
+
+		e.next = s.nextAfter(e, now)
+		nextRuns[e.job.Name] = e.next
+
+		if e.running {
+			s.logger.Warn("skipping job run, previous run still in progress", "job", e.job.Name)
+			continue
+		}
+		due = append(due, e)
+	}
+	s.mu.Unlock()
+
+	// Recorded outside the lock, so a slow database doesn't hold up Jobs and Trigger
+	for name, next := range nextRuns {
+		if err := s.repo.SetNextRun(s.ctx, name, next); err != nil {
+			s.logger.Warn("failed to record job next run", "job", name, "error", err)
+		}
+	}
+
+	for _, e := range due {
+		_ = s.launch(e, models.JobTriggerSchedule)
+	}
+}
+
+// launch runs a job in its own goroutine, recording start and outcome.
+// It returns ErrStopped once Stop has been called and ErrJobRunning if the
+// job is already running.
+func (s *Scheduler) launch(e *entry, trigger string) error {
+	s.mu.Lock()
+	if s.ctx == nil || s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return ErrStopped
+	}
+	if e.running {
+		s.mu.Unlock()
+		return ErrJobRunning
+	}
+	e.running = true
+	ctx := s.ctx
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			e.running = false
+			s.mu.Unlock()
+		}()
+
+		s.run(ctx, e.job, trigger)
+	}()
+
+	return nil
+}
+
+// run executes one job run
+func (s *Scheduler) run(ctx context.Context, job Job, trigger string) {
+	logger := s.logger.With("job", job.Name, "trigger", trigger)
+
+	start := s.now()
+	if err := s.repo.MarkStarted(ctx, job.Name, trigger, start); err != nil {
+		logger.Warn("failed to record job start", "error", err)
+	}
+	logger.Debug("job started")
+
+	err := runSafely(ctx, job)
+
+	duration := s.now().Sub(start)
+	// Record the outcome even when the run was cancelled by shutdown
+	if recErr := s.repo.MarkFinished(context.WithoutCancel(ctx), job.Name, s.now(), err); recErr != nil {
+		logger.Warn("failed to record job result", "error", recErr)
+	}
+
+	metrics.JobDuration.WithLabelValues(job.Name).Observe(duration.Seconds())
+	if err != nil {
+		metrics.JobRunsTotal.WithLabelValues(job.Name, models.JobStatusFailed).Inc()
+		logger.Error("job failed", "error", err, "duration", duration)
+		return
+	}
+
+	metrics.JobRunsTotal.WithLabelValues(job.Name, models.JobStatusOK).Inc()
+	logger.Info("job finished", "duration", duration)
+}
+
+// runSafely turns a panicking job into a failed run
+func runSafely(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return job.Run(ctx)
+}
+
+// nextAfter returns the job's next run time after t, evaluated in the scheduler's timezone
+func (s *Scheduler) nextAfter(e *entry, t time.Time) time.Time {
+	return e.schedule.Next(t.In(s.location))
+}
+
+// wasMissed reports whether a run came due, or was interrupted, while the bot was down
+func (s *Scheduler) wasMissed(e *entry, history *models.Job, now time.Time) bool {
+	if history == nil {
+		return false
+	}
+
+	// A run cut off by a crash or restart never recorded its result
+	if history.LastStatus == models.JobStatusRunning {
+		return true
+	}
+
+	// A changed schedule makes the stored next run meaningless
+	if history.Schedule != e.job.Schedule || history.NextRunAt == nil {
+		return false
+	}
+
+	return !history.NextRunAt.After(now)
+}
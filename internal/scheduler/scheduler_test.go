@@ -0,0 +1,303 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"parent-bot/internal/config"
+	"parent-bot/internal/database"
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+)
+
+// clock is a fake time source tests move by hand
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// newScheduler returns a scheduler on an in-memory SQLite database and a
+// fake clock set to 08:00 on a Monday
+func newScheduler(t *testing.T) (*Scheduler, *repository.JobRepository, *clock) {
+	t.Helper()
+
+	cfg := config.Defaults()
+	cfg.Database.Path = ":memory:"
+	if err := database.Connect(&cfg.Database); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if _, err := database.RunMigrations(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	repo := repository.NewJobRepository(database.DB)
+	c := &clock{now: time.Date(2024, 9, 2, 8, 0, 0, 0, time.UTC)}
+
+	s := New(repo, time.UTC, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	s.now = c.Now
+	t.Cleanup(func() { _ = s.Stop(context.Background()) })
+
+	return s, repo, c
+}
+
+// runs returns a job run function that reports each run on the channel and
+// then returns err
+func runs(err error) (func(context.Context) error, chan struct{}) {
+	ran := make(chan struct{}, 10)
+	return func(context.Context) error {
+		ran <- struct{}{}
+		return err
+	}, ran
+}
+
+// waitRun waits for a run to be reported
+func waitRun(t *testing.T, ran chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("job did not run")
+	}
+}
+
+// waitFinished waits until the job's run is recorded as finished
+func waitFinished(t *testing.T, repo *repository.JobRepository, name string, runCount int) *models.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := repo.GetByName(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job != nil && job.RunCount >= runCount {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("run %d of %s was not recorded", runCount, name)
+	return nil
+}
+
+func TestMissedRunIsCaughtUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		catchUp bool
+		history func(ctx context.Context, repo *repository.JobRepository, now time.Time) error
+		wantRun bool
+	}{
+		{
+			name:    "due while down",
+			catchUp: true,
+			history: func(ctx context.Context, repo *repository.JobRepository, now time.Time) error {
+				return repo.Register(ctx, "cleanup", "0 3 * * *", now.Add(-5*time.Hour))
+			},
+			wantRun: true,
+		},
+		{
+			name:    "interrupted by a restart",
+			catchUp: true,
+			history: func(ctx context.Context, repo *repository.JobRepository, now time.Time) error {
+				if err := repo.Register(ctx, "cleanup", "0 3 * * *", now.Add(19*time.Hour)); err != nil {
+					return err
+				}
+				return repo.MarkStarted(ctx, "cleanup", models.JobTriggerSchedule, now.Add(-5*time.Hour))
+			},
+			wantRun: true,
+		},
+		{
+			name:    "not due yet",
+			catchUp: true,
+			history: func(ctx context.Context, repo *repository.JobRepository, now time.Time) error {
+				return repo.Register(ctx, "cleanup", "0 3 * * *", now.Add(19*time.Hour))
+			},
+		},
+		{
+			name:    "schedule changed",
+			catchUp: true,
+			history: func(ctx context.Context, repo *repository.JobRepository, now time.Time) error {
+				return repo.Register(ctx, "cleanup", "0 4 * * *", now.Add(-4*time.Hour))
+			},
+		},
+		{
+			name: "catch-up disabled",
+			history: func(ctx context.Context, repo *repository.JobRepository, now time.Time) error {
+				return repo.Register(ctx, "cleanup", "0 3 * * *", now.Add(-5*time.Hour))
+			},
+		},
+		{
+			name:    "never registered",
+			catchUp: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, repo, c := newScheduler(t)
+
+			if tt.history != nil {
+				if err := tt.history(ctx, repo, c.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			run, ran := runs(nil)
+			if err := s.Register(Job{Name: "cleanup", Schedule: "0 3 * * *", CatchUp: tt.catchUp, Run: run}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Start(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.wantRun {
+				select {
+				case <-ran:
+					t.Error("job caught up, want no run")
+				case <-time.After(50 * time.Millisecond):
+				}
+				return
+			}
+
+			waitRun(t, ran)
+			job := waitFinished(t, repo, "cleanup", 1)
+			if job.LastTrigger != models.JobTriggerCatchUp {
+				t.Errorf("trigger = %q, want %q", job.LastTrigger, models.JobTriggerCatchUp)
+			}
+		})
+	}
+}
+
+func TestDueRunIsRecorded(t *testing.T) {
+	ctx := context.Background()
+	s, repo, c := newScheduler(t)
+
+	run, ran := runs(errors.New("disk full"))
+	if err := s.Register(Job{Name: "backup", Schedule: "0 3 * * *", Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := repo.GetByName(ctx, "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNext := time.Date(2024, 9, 3, 3, 0, 0, 0, time.UTC)
+	if job.NextRunAt == nil || !job.NextRunAt.Equal(wantNext) {
+		t.Fatalf("next run = %v, want %v", job.NextRunAt, wantNext)
+	}
+
+	// The run comes due
+	c.Set(wantNext.Add(time.Second))
+	s.runDue(c.Now())
+	waitRun(t, ran)
+
+	job = waitFinished(t, repo, "backup", 1)
+	if job.LastStatus != models.JobStatusFailed || job.LastError != "disk full" || job.FailureCount != 1 {
+		t.Errorf("history = %s %q, %d failures; want failed \"disk full\", 1", job.LastStatus, job.LastError, job.FailureCount)
+	}
+	if job.LastTrigger != models.JobTriggerSchedule {
+		t.Errorf("trigger = %q, want %q", job.LastTrigger, models.JobTriggerSchedule)
+	}
+	if job.LastStartedAt == nil || !job.LastStartedAt.Equal(c.Now()) {
+		t.Errorf("started at %v, want %v", job.LastStartedAt, c.Now())
+	}
+	if next := wantNext.Add(24 * time.Hour); job.NextRunAt == nil || !job.NextRunAt.Equal(next) {
+		t.Errorf("next run = %v, want %v", job.NextRunAt, next)
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	ctx := context.Background()
+	s, repo, _ := newScheduler(t)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	err := s.Register(Job{Name: "export", Schedule: "@daily", Run: func(context.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Trigger("export"); !errors.Is(err, ErrStopped) {
+		t.Errorf("Trigger before Start = %v, want %v", err, ErrStopped)
+	}
+
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Trigger("missing"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Trigger of an unknown job = %v, want %v", err, ErrUnknownJob)
+	}
+
+	if err := s.Trigger("export"); err != nil {
+		t.Fatalf("Trigger: %v", err)
+	}
+	waitRun(t, started)
+
+	// A job never runs twice at once
+	if err := s.Trigger("export"); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Trigger while running = %v, want %v", err, ErrJobRunning)
+	}
+
+	close(release)
+	job := waitFinished(t, repo, "export", 1)
+	if job.LastTrigger != models.JobTriggerManual || job.LastStatus != models.JobStatusOK {
+		t.Errorf("history = %s by %s, want ok by %s", job.LastStatus, job.LastTrigger, models.JobTriggerManual)
+	}
+}
+
+func TestNoRunStartsAfterStop(t *testing.T) {
+	ctx := context.Background()
+	s, _, c := newScheduler(t)
+
+	run, ran := runs(nil)
+	if err := s.Register(Job{Name: "cleanup", Schedule: "0 3 * * *", Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Trigger("cleanup"); !errors.Is(err, ErrStopped) {
+		t.Errorf("Trigger after Stop = %v, want %v", err, ErrStopped)
+	}
+
+	// A run coming due as the loop stops is not launched either
+	c.Set(c.Now().Add(24 * time.Hour))
+	s.runDue(c.Now())
+
+	select {
+	case <-ran:
+		t.Error("job ran after Stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
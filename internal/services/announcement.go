@@ -1,37 +1,48 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"parent-bot/internal/models"
+	"parent-bot/internal/outbox"
 	"parent-bot/internal/repository"
 )
 
 // AnnouncementService handles announcement-related business logic
 type AnnouncementService struct {
-	repo *repository.AnnouncementRepository
+	repo         *repository.AnnouncementRepository
+	deliveryRepo *repository.AnnouncementDeliveryRepository
+	audit        *AuditService
+	logger       *slog.Logger
 }
 
 // NewAnnouncementService creates a new announcement service
-func NewAnnouncementService(repo *repository.AnnouncementRepository) *AnnouncementService {
+func NewAnnouncementService(repo *repository.AnnouncementRepository, deliveryRepo *repository.AnnouncementDeliveryRepository, audit *AuditService, logger *slog.Logger) *AnnouncementService {
 	return &AnnouncementService{
-		repo: repo,
+		repo:         repo,
+		deliveryRepo: deliveryRepo,
+		audit:        audit,
+		logger:       logger,
 	}
 }
 
 // CreateAnnouncement creates a new announcement
-func (s *AnnouncementService) CreateAnnouncement(req *models.CreateAnnouncementRequest) (*models.Announcement, error) {
-	announcement, err := s.repo.Create(req)
+func (s *AnnouncementService) CreateAnnouncement(ctx context.Context, req *models.CreateAnnouncementRequest) (*models.Announcement, error) {
+	announcement, err := s.repo.Create(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create announcement: %w", err)
 	}
 
+	s.audit.Record(ctx, models.AuditEntityAnnouncement, "create", announcement.ID, nil, announcement)
 	return announcement, nil
 }
 
 // GetAnnouncementByID gets announcement by ID
-func (s *AnnouncementService) GetAnnouncementByID(id int) (*models.Announcement, error) {
-	announcement, err := s.repo.GetByID(id)
+func (s *AnnouncementService) GetAnnouncementByID(ctx context.Context, id int) (*models.Announcement, error) {
+	announcement, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get announcement: %w", err)
 	}
@@ -40,8 +51,8 @@ func (s *AnnouncementService) GetAnnouncementByID(id int) (*models.Announcement,
 }
 
 // GetActiveAnnouncements gets all active announcements with pagination
-func (s *AnnouncementService) GetActiveAnnouncements(limit, offset int) ([]*models.Announcement, error) {
-	announcements, err := s.repo.GetActive(limit, offset)
+func (s *AnnouncementService) GetActiveAnnouncements(ctx context.Context, limit, offset int) ([]*models.Announcement, error) {
+	announcements, err := s.repo.GetActive(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get active announcements: %w", err)
 	}
@@ -50,8 +61,8 @@ func (s *AnnouncementService) GetActiveAnnouncements(limit, offset int) ([]*mode
 }
 
 // GetAllAnnouncements gets all announcements with pagination (for admin)
-func (s *AnnouncementService) GetAllAnnouncements(limit, offset int) ([]*models.Announcement, error) {
-	announcements, err := s.repo.GetAll(limit, offset)
+func (s *AnnouncementService) GetAllAnnouncements(ctx context.Context, limit, offset int) ([]*models.Announcement, error) {
+	announcements, err := s.repo.GetAll(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get announcements: %w", err)
 	}
@@ -60,38 +71,48 @@ func (s *AnnouncementService) GetAllAnnouncements(limit, offset int) ([]*models.
 }
 
 // UpdateAnnouncement updates an existing announcement
-func (s *AnnouncementService) UpdateAnnouncement(id int, req *models.CreateAnnouncementRequest) (*models.Announcement, error) {
-	announcement, err := s.repo.Update(id, req)
+func (s *AnnouncementService) UpdateAnnouncement(ctx context.Context, id int, req *models.CreateAnnouncementRequest) (*models.Announcement, error) {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	announcement, err := s.repo.Update(ctx, id, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update announcement: %w", err)
 	}
 
+	s.audit.Record(ctx, models.AuditEntityAnnouncement, "update", id, before, announcement)
 	return announcement, nil
 }
 
 // ToggleAnnouncementActive toggles the active status of an announcement
-func (s *AnnouncementService) ToggleAnnouncementActive(id int) error {
-	err := s.repo.ToggleActive(id)
+func (s *AnnouncementService) ToggleAnnouncementActive(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	err := s.repo.ToggleActive(ctx, id)
 	if err != nil {
 		return fmt.Errorf("failed to toggle announcement active status: %w", err)
 	}
 
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityAnnouncement, "toggle_active", id, before, after)
 	return nil
 }
 
 // DeleteAnnouncement deletes an announcement
-func (s *AnnouncementService) DeleteAnnouncement(id int) error {
-	err := s.repo.Delete(id)
+func (s *AnnouncementService) DeleteAnnouncement(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	err := s.repo.Delete(ctx, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete announcement: %w", err)
 	}
 
+	s.audit.Record(ctx, models.AuditEntityAnnouncement, "delete", id, before, nil)
 	return nil
 }
 
 // CountAnnouncements counts total announcements
-func (s *AnnouncementService) CountAnnouncements() (int, error) {
-	count, err := s.repo.Count()
+func (s *AnnouncementService) CountAnnouncements(ctx context.Context) (int, error) {
+	count, err := s.repo.Count(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count announcements: %w", err)
 	}
@@ -100,11 +121,74 @@ func (s *AnnouncementService) CountAnnouncements() (int, error) {
 }
 
 // CountActiveAnnouncements counts active announcements
-func (s *AnnouncementService) CountActiveAnnouncements() (int, error) {
-	count, err := s.repo.CountActive()
+func (s *AnnouncementService) CountActiveAnnouncements(ctx context.Context) (int, error) {
+	count, err := s.repo.CountActive(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count active announcements: %w", err)
 	}
 
 	return count, nil
 }
+
+// QueueDeliveries records users as recipients of an announcement before it is queued for them
+func (s *AnnouncementService) QueueDeliveries(ctx context.Context, announcementID int, users []*models.User) error {
+	return s.deliveryRepo.Queue(ctx, announcementID, users, time.Now())
+}
+
+// MarkDeliveriesEnqueued records that an announcement's notifications to
+// users are in the outbox
+func (s *AnnouncementService) MarkDeliveriesEnqueued(ctx context.Context, announcementID int, users []*models.User) error {
+	return s.deliveryRepo.MarkEnqueued(ctx, announcementID, users, time.Now())
+}
+
+// RecordDeliveryResults updates announcement deliveries from outbox results.
+// It is an outbox.Observer; results for other notifications are ignored.
+func (s *AnnouncementService) RecordDeliveryResults(ctx context.Context, results []outbox.Result) {
+	for _, result := range results {
+		announcementID, ok := models.ParseAnnouncementRef(result.Notification.Ref)
+		if !ok {
+			continue
+		}
+
+		status := models.DeliveryFailed
+		switch result.Status {
+		case models.NotificationSent:
+			status = models.DeliverySent
+		case models.NotificationUnreachable:
+			status = models.DeliveryBlocked
+		}
+
+		err := s.deliveryRepo.Record(ctx, announcementID, result.Notification.ChatID, status, result.Error, result.At)
+		if err != nil {
+			s.logger.Error("failed to record announcement delivery",
+				"announcement_id", announcementID, "chat_id", result.Notification.ChatID, "error", err)
+		}
+	}
+}
+
+// GetDeliverySummary counts the deliveries of an announcement by status
+func (s *AnnouncementService) GetDeliverySummary(ctx context.Context, announcementID int) (*models.DeliverySummary, error) {
+	summary, err := s.deliveryRepo.Summary(ctx, announcementID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery summary: %w", err)
+	}
+
+	return summary, nil
+}
+
+// GetFailedRecipients gets a page of users whose delivery of an announcement failed
+func (s *AnnouncementService) GetFailedRecipients(ctx context.Context, announcementID, afterID, limit int) ([]*models.User, error) {
+	return s.deliveryRepo.GetFailedRecipients(ctx, announcementID, afterID, limit)
+}
+
+// GetPendingRecipients gets a page of users recorded as recipients of an
+// announcement who are not queued in the outbox yet
+func (s *AnnouncementService) GetPendingRecipients(ctx context.Context, announcementID, afterID, limit int) ([]*models.User, error) {
+	return s.deliveryRepo.GetPendingRecipients(ctx, announcementID, afterID, limit)
+}
+
+// GetPendingAnnouncementIDs gets the announcements with recipients who are
+// not queued in the outbox yet
+func (s *AnnouncementService) GetPendingAnnouncementIDs(ctx context.Context) ([]int, error) {
+	return s.deliveryRepo.GetPendingAnnouncementIDs(ctx)
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+)
+
+// API token errors
+var (
+	ErrAPIDisabled  = errors.New("admin API is disabled (ADMIN_API_SECRET not set)")
+	ErrInvalidToken = errors.New("invalid API token")
+	ErrTokenRevoked = errors.New("API token has been revoked")
+	ErrTokenIssuer  = errors.New("API token's issuer is no longer staff")
+	ErrTokenDenied  = errors.New("API token's issuer may not do this")
+)
+
+// APITokenService issues and verifies HMAC-signed admin API tokens.
+// A token has the form "<id>.<signature>", where the signature covers the
+// token's ID, admin and scope. The database row allows revocation, and a
+// token can do only what its issuer's role allows at the time of the request.
+type APITokenService struct {
+	repo     *repository.APITokenRepository
+	roleRepo *repository.RoleRepository
+	secret   []byte
+	audit    *AuditService
+}
+
+// NewAPITokenService creates a new API token service
+func NewAPITokenService(repo *repository.APITokenRepository, roleRepo *repository.RoleRepository, secret string, audit *AuditService) *APITokenService {
+	return &APITokenService{repo: repo, roleRepo: roleRepo, secret: []byte(secret), audit: audit}
+}
+
+// Enabled reports whether a signing secret is configured
+func (s *APITokenService) Enabled() bool {
+	return len(s.secret) > 0
+}
+
+// Issue creates a new token for an admin and returns its bearer string
+func (s *APITokenService) Issue(ctx context.Context, adminID int, name, scope string) (string, *models.APIToken, error) {
+	if !s.Enabled() {
+		return "", nil, ErrAPIDisabled
+	}
+
+	if scope != models.APIScopeRead && scope != models.APIScopeWrite {
+		return "", nil, fmt.Errorf("invalid scope: %s", scope)
+	}
+
+	token, err := s.repo.Create(ctx, adminID, name, scope)
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityAPIToken, "issue", token.ID, nil, token)
+	return fmt.Sprintf("%d.%s", token.ID, s.sign(token)), token, nil
+}
+
+// Verify checks a bearer string and returns the active token it refers to,
+// if the token's issuer is still staff and their role grants the permission.
+// Managing API tokens does not stand in for it, so taking a permission from
+// a role also takes it from the tokens its members issued.
+func (s *APITokenService) Verify(ctx context.Context, bearer string, permission models.Permission) (*models.APIToken, error) {
+	if !s.Enabled() {
+		return nil, ErrAPIDisabled
+	}
+
+	idPart, signature, ok := strings.Cut(bearer, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(token))) {
+		return nil, ErrInvalidToken
+	}
+
+	if token.IsRevoked() {
+		return nil, ErrTokenRevoked
+	}
+
+	if token.AdminRole == "" {
+		return nil, ErrTokenIssuer
+	}
+
+	granted := models.AllPermissions()
+	if token.AdminRole != models.RoleSuperAdmin {
+		granted, err = s.roleRepo.Permissions(ctx, token.AdminRole)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !granted.Has(permission) {
+		return nil, ErrTokenDenied
+	}
+
+	_ = s.repo.TouchLastUsed(ctx, token.ID)
+
+	return token, nil
+}
+
+// Revoke revokes a token by ID
+func (s *APITokenService) Revoke(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	if err := s.repo.Revoke(ctx, id); err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityAPIToken, "revoke", id, before, after)
+	return nil
+}
+
+// GetAll lists all tokens
+func (s *APITokenService) GetAll(ctx context.Context) ([]*models.APIToken, error) {
+	return s.repo.GetAll(ctx)
+}
+
+// sign computes the hex HMAC-SHA256 signature for a token
+func (s *APITokenService) sign(token *models.APIToken) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%d:%d:%s", token.ID, token.AdminID, token.Scope)
+	return hex.EncodeToString(mac.Sum(nil))
+}
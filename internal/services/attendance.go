@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"parent-bot/internal/models"
 	"parent-bot/internal/repository"
@@ -13,21 +15,23 @@ type AttendanceService struct {
 	repo        *repository.AttendanceRepository
 	studentRepo *repository.StudentRepository
 	classRepo   *repository.ClassRepository
+	audit       *AuditService
 }
 
 // NewAttendanceService creates a new attendance service
-func NewAttendanceService(db *sql.DB) *AttendanceService {
+func NewAttendanceService(db *sql.DB, location *time.Location, audit *AuditService) *AttendanceService {
 	return &AttendanceService{
-		repo:        repository.NewAttendanceRepository(db),
+		repo:        repository.NewAttendanceRepository(db, location),
 		studentRepo: repository.NewStudentRepository(db),
 		classRepo:   repository.NewClassRepository(db),
+		audit:       audit,
 	}
 }
 
 // CreateAttendance creates or updates an attendance record
-func (s *AttendanceService) CreateAttendance(req *models.CreateAttendanceRequest) (int64, error) {
+func (s *AttendanceService) CreateAttendance(ctx context.Context, req *models.CreateAttendanceRequest) (int64, error) {
 	// Verify student exists
-	_, err := s.studentRepo.GetByID(req.StudentID)
+	_, err := s.studentRepo.GetByID(ctx, req.StudentID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, fmt.Errorf("student not found")
@@ -40,13 +44,19 @@ func (s *AttendanceService) CreateAttendance(req *models.CreateAttendanceRequest
 		return 0, fmt.Errorf("either teacher or admin must be specified")
 	}
 
-	return s.repo.Create(req)
+	id, err := s.repo.Create(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityAttendance, "mark", id, nil, req)
+	return id, nil
 }
 
 // BulkCreateAttendance creates or updates multiple attendance records
-func (s *AttendanceService) BulkCreateAttendance(req *models.BulkAttendanceRequest) error {
+func (s *AttendanceService) BulkCreateAttendance(ctx context.Context, req *models.BulkAttendanceRequest) error {
 	// Verify class exists
-	_, err := s.classRepo.GetByID(req.ClassID)
+	_, err := s.classRepo.GetByID(ctx, req.ClassID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("class not found")
@@ -59,13 +69,18 @@ func (s *AttendanceService) BulkCreateAttendance(req *models.BulkAttendanceReque
 		return fmt.Errorf("either teacher or admin must be specified")
 	}
 
-	return s.repo.BulkCreate(req)
+	if err := s.repo.BulkCreate(ctx, req); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityAttendance, "mark_class", nil, nil, req)
+	return nil
 }
 
 // MarkAllPresentExcept marks all students in a class as present except the specified ones
-func (s *AttendanceService) MarkAllPresentExcept(classID int, date string, absentStudentIDs []int, markedByTeacherID, markedByAdminID *int) error {
+func (s *AttendanceService) MarkAllPresentExcept(ctx context.Context, classID int, date string, absentStudentIDs []int, markedByTeacherID, markedByAdminID *int) error {
 	// Verify class exists
-	_, err := s.classRepo.GetByID(classID)
+	_, err := s.classRepo.GetByID(ctx, classID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("class not found")
@@ -78,43 +93,60 @@ func (s *AttendanceService) MarkAllPresentExcept(classID int, date string, absen
 		return fmt.Errorf("either teacher or admin must be specified")
 	}
 
-	return s.repo.MarkAllPresentExcept(classID, date, absentStudentIDs, markedByTeacherID, markedByAdminID)
+	err = s.repo.MarkAllPresentExcept(ctx, classID, date, absentStudentIDs, markedByTeacherID, markedByAdminID)
+	if err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityAttendance, "mark_class", nil, nil, classAttendance{
+		ClassID:          classID,
+		Date:             date,
+		AbsentStudentIDs: absentStudentIDs,
+	})
+	return nil
+}
+
+// classAttendance is how a class's attendance is recorded in the audit log
+type classAttendance struct {
+	ClassID          int    `json:"class_id"`
+	Date             string `json:"date"`
+	AbsentStudentIDs []int  `json:"absent_student_ids"`
 }
 
 // GetAttendanceByID retrieves an attendance record by ID
-func (s *AttendanceService) GetAttendanceByID(id int) (*models.Attendance, error) {
-	return s.repo.GetByID(id)
+func (s *AttendanceService) GetAttendanceByID(ctx context.Context, id int) (*models.Attendance, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
 // GetAttendanceByStudentID retrieves attendance records for a student
-func (s *AttendanceService) GetAttendanceByStudentID(studentID int, limit, offset int) ([]*models.AttendanceDetailed, error) {
-	return s.repo.GetByStudentID(studentID, limit, offset)
+func (s *AttendanceService) GetAttendanceByStudentID(ctx context.Context, studentID int, limit, offset int) ([]*models.AttendanceDetailed, error) {
+	return s.repo.GetByStudentID(ctx, studentID, limit, offset)
 }
 
 // GetAttendanceByStudentIDAndDateRange retrieves attendance for a student within a date range
-func (s *AttendanceService) GetAttendanceByStudentIDAndDateRange(studentID int, startDate, endDate string) ([]*models.AttendanceDetailed, error) {
-	return s.repo.GetByStudentIDAndDateRange(studentID, startDate, endDate)
+func (s *AttendanceService) GetAttendanceByStudentIDAndDateRange(ctx context.Context, studentID int, startDate, endDate string) ([]*models.AttendanceDetailed, error) {
+	return s.repo.GetByStudentIDAndDateRange(ctx, studentID, startDate, endDate)
 }
 
 // GetAttendanceByClassIDAndDate retrieves attendance for all students in a class on a specific date
-func (s *AttendanceService) GetAttendanceByClassIDAndDate(classID int, date string) ([]*models.AttendanceDetailed, error) {
-	return s.repo.GetByClassIDAndDate(classID, date)
+func (s *AttendanceService) GetAttendanceByClassIDAndDate(ctx context.Context, classID int, date string) ([]*models.AttendanceDetailed, error) {
+	return s.repo.GetByClassIDAndDate(ctx, classID, date)
 }
 
 // GetTodayAttendanceByClass retrieves today's attendance for a specific class
-func (s *AttendanceService) GetTodayAttendanceByClass(classID int) ([]*models.AttendanceDetailed, error) {
-	return s.repo.GetTodayAttendanceByClass(classID)
+func (s *AttendanceService) GetTodayAttendanceByClass(ctx context.Context, classID int) ([]*models.AttendanceDetailed, error) {
+	return s.repo.GetTodayAttendanceByClass(ctx, classID)
 }
 
 // GetTodayAttendanceAllClasses retrieves today's attendance for all classes
-func (s *AttendanceService) GetTodayAttendanceAllClasses() ([]*models.AttendanceDetailed, error) {
-	return s.repo.GetTodayAttendanceAllClasses()
+func (s *AttendanceService) GetTodayAttendanceAllClasses(ctx context.Context) ([]*models.AttendanceDetailed, error) {
+	return s.repo.GetTodayAttendanceAllClasses(ctx)
 }
 
 // UpdateAttendance updates an attendance record
-func (s *AttendanceService) UpdateAttendance(id int, req *models.UpdateAttendanceRequest) error {
+func (s *AttendanceService) UpdateAttendance(ctx context.Context, id int, req *models.UpdateAttendanceRequest) error {
 	// Check if attendance exists
-	_, err := s.repo.GetByID(id)
+	before, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("attendance record not found")
@@ -122,33 +154,46 @@ func (s *AttendanceService) UpdateAttendance(id int, req *models.UpdateAttendanc
 		return err
 	}
 
-	return s.repo.Update(id, req)
+	if err := s.repo.Update(ctx, id, req); err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityAttendance, "update", id, before, after)
+	return nil
 }
 
 // DeleteAttendance deletes an attendance record (restricted)
-func (s *AttendanceService) DeleteAttendance(id int) error {
-	return s.repo.Delete(id)
+func (s *AttendanceService) DeleteAttendance(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityAttendance, "delete", id, before, nil)
+	return nil
 }
 
 // CountAttendance returns total number of attendance records
-func (s *AttendanceService) CountAttendance() (int, error) {
-	return s.repo.Count()
+func (s *AttendanceService) CountAttendance(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
 }
 
 // IsAttendanceTaken checks if attendance has been taken for a class on a specific date
-func (s *AttendanceService) IsAttendanceTaken(classID int, date string) (bool, error) {
-	return s.repo.IsAttendanceTaken(classID, date)
+func (s *AttendanceService) IsAttendanceTaken(ctx context.Context, classID int, date string) (bool, error) {
+	return s.repo.IsAttendanceTaken(ctx, classID, date)
 }
 
 // GetLast30DaysByStudent retrieves last 30 days attendance for a student
-func (s *AttendanceService) GetLast30DaysByStudent(studentID int) ([]*models.AttendanceDetailed, error) {
-	return s.repo.GetLast30DaysByStudent(studentID)
+func (s *AttendanceService) GetLast30DaysByStudent(ctx context.Context, studentID int) ([]*models.AttendanceDetailed, error) {
+	return s.repo.GetLast30DaysByStudent(ctx, studentID)
 }
 
 // GetAttendanceForParent retrieves attendance for a parent's selected child (last 30 days)
-func (s *AttendanceService) GetAttendanceForParent(parentID int, currentStudentID int) ([]*models.AttendanceDetailed, error) {
+func (s *AttendanceService) GetAttendanceForParent(ctx context.Context, parentID int, currentStudentID int) ([]*models.AttendanceDetailed, error) {
 	// Verify student is linked to parent
-	isLinked, err := s.studentRepo.IsStudentLinkedToParent(parentID, currentStudentID)
+	isLinked, err := s.studentRepo.IsStudentLinkedToParent(ctx, parentID, currentStudentID)
 	if err != nil {
 		return nil, err
 	}
@@ -156,5 +201,5 @@ func (s *AttendanceService) GetAttendanceForParent(parentID int, currentStudentI
 		return nil, fmt.Errorf("student is not linked to this parent")
 	}
 
-	return s.repo.GetLast30DaysByStudent(currentStudentID)
+	return s.repo.GetLast30DaysByStudent(ctx, currentStudentID)
 }
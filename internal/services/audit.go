@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+)
+
+// Actor is who a change is made by. It travels in the context of the call,
+// so services can record it without every method taking it.
+type Actor struct {
+	TelegramID int64 // 0 when the change wasn't made from Telegram
+	Name       string
+	Role       string
+	Source     string // one of models.AuditSource*
+}
+
+// systemActor is recorded for changes made without an actor in the context,
+// such as background jobs
+var systemActor = Actor{Name: "system", Role: "system", Source: models.AuditSourceSystem}
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the actor of the changes made with it
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor carried by ctx, or the system actor
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return systemActor
+}
+
+// AuditService records changes to the audit log and reads them back
+type AuditService struct {
+	repo   *repository.AuditRepository
+	logger *slog.Logger
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(repo *repository.AuditRepository, logger *slog.Logger) *AuditService {
+	return &AuditService{repo: repo, logger: logger}
+}
+
+// Record writes an audit entry for a change the actor in ctx made to an
+// entity. The action is recorded as "<entity type>.<verb>". before and after
+// are stored as JSON; nil means the entity didn't exist before or doesn't
+// after. Failures are logged rather than returned, as the change is already
+// made by the time it is recorded.
+func (s *AuditService) Record(ctx context.Context, entityType, verb string, entityID any, before, after any) {
+	actor := ActorFrom(ctx)
+	entry := &models.AuditEntry{
+		ActorName:  actor.Name,
+		ActorRole:  actor.Role,
+		Source:     actor.Source,
+		Action:     entityType + "." + verb,
+		EntityType: entityType,
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+		CreatedAt:  time.Now(),
+	}
+	if actor.TelegramID != 0 {
+		entry.ActorTelegramID = &actor.TelegramID
+	}
+	if entityID != nil {
+		entry.EntityID = fmt.Sprint(entityID)
+	}
+
+	if err := s.repo.Create(ctx, entry); err != nil {
+		s.logger.Error("failed to record audit entry",
+			"action", entry.Action,
+			"entity_id", entry.EntityID,
+			"actor", actor.Name,
+			"error", err,
+		)
+	}
+}
+
+// auditJSON encodes an entity for the audit log, nil for none
+func auditJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+// List gets audit entries matching a filter, newest first
+func (s *AuditService) List(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEntry, error) {
+	return s.repo.List(ctx, filter)
+}
+
+// Count counts audit entries matching a filter
+func (s *AuditService) Count(ctx context.Context, filter *models.AuditFilter) (int, error) {
+	return s.repo.CountFiltered(ctx, filter)
+}
+
+// AuditExportLimit caps how many entries one export writes
+const AuditExportLimit = 50000
+
+// ExportCSV writes the entries matching a filter to w as CSV, newest first
+// and at most AuditExportLimit of them, with times in loc. It returns how
+// many were written.
+func (s *AuditService) ExportCSV(ctx context.Context, filter *models.AuditFilter, loc *time.Location, w io.Writer) (int, error) {
+	export := *filter
+	export.Limit, export.Offset = AuditExportLimit, 0
+
+	entries, err := s.repo.List(ctx, &export)
+	if err != nil {
+		return 0, err
+	}
+
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{
+		"id", "time", "actor_telegram_id", "actor_name", "actor_role", "source",
+		"action", "entity_type", "entity_id", "before", "after",
+	})
+	for _, e := range entries {
+		telegramID := ""
+		if e.ActorTelegramID != nil {
+			telegramID = strconv.FormatInt(*e.ActorTelegramID, 10)
+		}
+		_ = out.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.CreatedAt.In(loc).Format(time.RFC3339),
+			telegramID,
+			e.ActorName,
+			e.ActorRole,
+			e.Source,
+			e.Action,
+			e.EntityType,
+			e.EntityID,
+			string(e.Before),
+			string(e.After),
+		})
+	}
+	out.Flush()
+
+	if err := out.Error(); err != nil {
+		return 0, fmt.Errorf("failed to write audit export: %w", err)
+	}
+	return len(entries), nil
+}
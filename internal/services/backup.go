@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"parent-bot/internal/database"
+)
+
+// maxDocumentSize is the largest file a bot can send through the Bot API
+const maxDocumentSize = 50 << 20
+
+// backupPrefix starts the name of every snapshot written by BackupDatabase
+const backupPrefix = "parent_bot-"
+
+// BackupDatabase writes a compressed snapshot of the database to the backup
+// directory, removes snapshots older than the retention period and, when
+// enabled, sends the snapshot to the admins as a document
+func (s *BotService) BackupDatabase(ctx context.Context) error {
+	cfg := s.Config.Backup
+
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := backupPrefix + time.Now().In(s.Location).Format("20060102-150405") + ".db"
+	path := filepath.Join(cfg.Dir, name)
+	if err := database.Backup(ctx, s.Config.Database.GetDBPath(), path); err != nil {
+		return err
+	}
+
+	gzPath, err := database.Compress(path)
+	if err != nil {
+		return err
+	}
+	s.Logger.Info("database backup written", "file", gzPath)
+
+	if cfg.Retention > 0 {
+		s.pruneBackups(cfg.Dir, cfg.Retention)
+	}
+
+	if cfg.SendToAdmins {
+		return s.sendBackupToAdmins(ctx, gzPath)
+	}
+
+	return nil
+}
+
+// sendBackupToAdmins uploads the snapshot once and forwards it by file_id
+func (s *BotService) sendBackupToAdmins(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat backup: %w", err)
+	}
+	if info.Size() > maxDocumentSize {
+		s.Logger.Warn("backup is too large to send to admins, kept locally only",
+			"file", path, "size", info.Size())
+		return nil
+	}
+
+	// The backup holds every parent's data, so only super-admins get it
+	adminIDs, err := s.GetSuperAdminTelegramIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get admins: %w", err)
+	}
+	if len(adminIDs) == 0 {
+		return nil
+	}
+
+	caption := fmt.Sprintf("💾 Ma'lumotlar bazasi zaxira nusxasi / Резервная копия базы данных\n%s",
+		time.Now().In(s.Location).Format("02.01.2006 15:04"))
+
+	filename := filepath.Base(path)
+	fileID, err := s.TelegramService.UploadDocument(adminIDs[0], path, filename)
+	if err != nil {
+		return fmt.Errorf("failed to send backup: %w", err)
+	}
+
+	return s.TelegramService.SendDocumentToAdmins(adminIDs[1:], fileID, caption)
+}
+
+// pruneBackups removes snapshots in dir older than maxAge
+func (s *BotService) pruneBackups(dir string, maxAge time.Duration) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		s.Logger.Warn("failed to read backup directory", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), backupPrefix) {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		if now.Sub(info.ModTime()) > maxAge {
+			path := filepath.Join(dir, file.Name())
+			if err := os.Remove(path); err != nil {
+				s.Logger.Warn("failed to remove old backup", "file", path, "error", err)
+			}
+		}
+	}
+}
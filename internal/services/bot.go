@@ -1,118 +1,295 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"parent-bot/internal/authz"
+	"parent-bot/internal/broadcast"
+	"parent-bot/internal/callback"
 	"parent-bot/internal/config"
+	"parent-bot/internal/logging"
+	"parent-bot/internal/metrics"
+	"parent-bot/internal/models"
+	"parent-bot/internal/outbox"
+	"parent-bot/internal/ratelimit"
 	"parent-bot/internal/repository"
+	"parent-bot/internal/scheduler"
 	"parent-bot/internal/state"
 )
 
 // BotService is the main bot service
 type BotService struct {
-	Bot                 *tgbotapi.BotAPI
-	Config              *config.Config
-	UserRepo            *repository.UserRepository
-	ComplaintRepo       *repository.ComplaintRepository
-	ProposalRepo        *repository.ProposalRepository
-	TimetableRepo       *repository.TimetableRepository
-	AnnouncementRepo    *repository.AnnouncementRepository
-	AdminRepo           *repository.AdminRepository
-	ClassRepo           *repository.ClassRepository
-	TeacherRepo         *repository.TeacherRepository
-	StudentRepo         *repository.StudentRepository
-	TestResultRepo      *repository.TestResultRepository
-	AttendanceRepo      *repository.AttendanceRepository
-	StateManager        *state.Manager
-	TelegramService     *TelegramService
-	UserService         *UserService
-	ComplaintService    *ComplaintService
-	ProposalService     *ProposalService
-	TimetableService    *TimetableService
-	AnnouncementService *AnnouncementService
-	DocumentService     *DocumentService
-	TeacherService      *TeacherService
-	StudentService      *StudentService
-	TestResultService   *TestResultService
-	AttendanceService   *AttendanceService
-}
-
-// NewBotService creates a new bot service
-func NewBotService(cfg *config.Config, db *sql.DB) (*BotService, error) {
-	// Create bot instance
-	bot, err := tgbotapi.NewBotAPI(cfg.Bot.Token)
+	Bot                      Messenger
+	Self                     tgbotapi.User // the bot's own account
+	Logger                   *slog.Logger
+	UpdateLoggers            *logging.Scopes // per-update loggers, see Log
+	Config                   *config.Config  // configuration at startup; see Settings for reloadable values
+	Location                 *time.Location  // the school's timezone
+	UserRepo                 *repository.UserRepository
+	ComplaintRepo            *repository.ComplaintRepository
+	ProposalRepo             *repository.ProposalRepository
+	TimetableRepo            *repository.TimetableRepository
+	AnnouncementRepo         *repository.AnnouncementRepository
+	AnnouncementDeliveryRepo *repository.AnnouncementDeliveryRepository
+	AdminRepo                *repository.AdminRepository
+	ClassRepo                *repository.ClassRepository
+	TeacherRepo              *repository.TeacherRepository
+	StudentRepo              *repository.StudentRepository
+	TestResultRepo           *repository.TestResultRepository
+	AttendanceRepo           *repository.AttendanceRepository
+	APITokenRepo             *repository.APITokenRepository
+	ProcessedUpdateRepo      *repository.ProcessedUpdateRepository
+	JobRepo                  *repository.JobRepository
+	NotificationRepo         *repository.NotificationRepository
+	AuditRepo                *repository.AuditRepository
+	RoleRepo                 *repository.RoleRepository
+	StateManager             *state.Manager
+	RateLimiter              *ratelimit.Limiter
+	Policy                   *authz.Policy
+	CallbackRouter           *callback.Router     // set by handlers.RegisterCallbackRoutes
+	Scheduler                *scheduler.Scheduler // jobs are added by RegisterJobs
+	Outbox                   *outbox.Outbox       // queues and delivers notifications
+	Broadcaster              *broadcast.Broadcaster
+	TelegramService          *TelegramService
+	AuditService             *AuditService
+	UserService              *UserService
+	ClassService             *ClassService
+	ComplaintService         *ComplaintService
+	ProposalService          *ProposalService
+	TimetableService         *TimetableService
+	AnnouncementService      *AnnouncementService
+	DocumentService          *DocumentService
+	TeacherService           *TeacherService
+	StudentService           *StudentService
+	TestResultService        *TestResultService
+	AttendanceService        *AttendanceService
+	APITokenService          *APITokenService
+	RoleService              *RoleService
+	UpdateLogService         *UpdateLogService
+
+	settings atomic.Pointer[config.Config]
+}
+
+// NewBotService creates a new bot service talking to the configured Bot API endpoint
+func NewBotService(cfg *config.Config, db *sql.DB, logger *slog.Logger) (*BotService, error) {
+	endpoint := cfg.Bot.APIEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+
+	// Create bot instance; Bot API calls are timed and failures counted
+	client := metrics.InstrumentTelegram(&http.Client{})
+	bot, err := tgbotapi.NewBotAPIWithClient(cfg.Bot.Token, endpoint, client)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bot: %w", err)
 	}
 
+	return newBotService(cfg, db, bot, bot.Self, logger), nil
+}
+
+// NewBotServiceWithMessenger creates a bot service on top of any Messenger,
+// such as a BotAPI pointed at a fake server
+func NewBotServiceWithMessenger(cfg *config.Config, db *sql.DB, bot Messenger, logger *slog.Logger) (*BotService, error) {
+	self, err := bot.GetMe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bot info: %w", err)
+	}
+
+	return newBotService(cfg, db, bot, self, logger), nil
+}
+
+func newBotService(cfg *config.Config, db *sql.DB, bot Messenger, self tgbotapi.User, logger *slog.Logger) *BotService {
+	// The school's timezone decides what "today" is and when jobs run
+	location, err := time.LoadLocation(cfg.School.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
 	complaintRepo := repository.NewComplaintRepository(db)
 	proposalRepo := repository.NewProposalRepository(db)
 	timetableRepo := repository.NewTimetableRepository(db)
 	announcementRepo := repository.NewAnnouncementRepository(db)
+	announcementDeliveryRepo := repository.NewAnnouncementDeliveryRepository(db)
 	adminRepo := repository.NewAdminRepository(db)
 	classRepo := repository.NewClassRepository(db)
 	teacherRepo := repository.NewTeacherRepository(db)
 	studentRepo := repository.NewStudentRepository(db)
 	testResultRepo := repository.NewTestResultRepository(db)
-	attendanceRepo := repository.NewAttendanceRepository(db)
+	attendanceRepo := repository.NewAttendanceRepository(db, location)
+	apiTokenRepo := repository.NewAPITokenRepository(db)
+	processedUpdateRepo := repository.NewProcessedUpdateRepository(db)
+	jobRepo := repository.NewJobRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	broadcastRepo := repository.NewBroadcastRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
 
 	// Initialize state manager
-	stateManager := state.NewManager(db)
-
-	// Initialize services
-	telegramService := NewTelegramService(bot)
-	userService := NewUserService(userRepo)
-	complaintService := NewComplaintService(complaintRepo, userRepo)
-	proposalService := NewProposalService(proposalRepo, userRepo)
-	timetableService := NewTimetableService(timetableRepo, classRepo)
-	announcementService := NewAnnouncementService(announcementRepo)
-	documentService := NewDocumentService("./temp_docs") // temp directory for generated documents
-	teacherService := NewTeacherService(db)
-	studentService := NewStudentService(db)
-	testResultService := NewTestResultService(db)
-	attendanceService := NewAttendanceService(db)
-
-	return &BotService{
-		Bot:                 bot,
-		Config:              cfg,
-		UserRepo:            userRepo,
-		ComplaintRepo:       complaintRepo,
-		ProposalRepo:        proposalRepo,
-		TimetableRepo:       timetableRepo,
-		AnnouncementRepo:    announcementRepo,
-		AdminRepo:           adminRepo,
-		ClassRepo:           classRepo,
-		TeacherRepo:         teacherRepo,
-		StudentRepo:         studentRepo,
-		TestResultRepo:      testResultRepo,
-		AttendanceRepo:      attendanceRepo,
-		StateManager:        stateManager,
-		TelegramService:     telegramService,
-		UserService:         userService,
-		ComplaintService:    complaintService,
-		ProposalService:     proposalService,
-		TimetableService:    timetableService,
-		AnnouncementService: announcementService,
-		DocumentService:     documentService,
-		TeacherService:      teacherService,
-		StudentService:      studentService,
-		TestResultService:   testResultService,
-		AttendanceService:   attendanceService,
-	}, nil
-}
-
-// SetWebhook sets up webhook
-func (s *BotService) SetWebhook(webhookURL string) error {
-	wh, err := tgbotapi.NewWebhook(webhookURL)
-	if err != nil {
-		return fmt.Errorf("failed to create webhook: %w", err)
+	stateManager := state.NewManager(db, cfg.Updates, logger)
+
+	// Initialize per-user rate limiter
+	rateLimiter := newRateLimiter(&cfg.RateLimit)
+
+	// Initialize background job scheduler
+	jobScheduler := scheduler.New(jobRepo, location, logger)
+
+	// Initialize notification outbox
+	notificationOutbox := outbox.New(notificationRepo, bot, cfg.Outbox, logger)
+	broadcaster := broadcast.New(userRepo, notificationRepo, broadcastRepo, notificationOutbox, bot, logger)
+
+	// Initialize services; changes they make are recorded by the audit service
+	auditService := NewAuditService(auditRepo, logger)
+	policy := authz.NewPolicy(adminRepo, teacherRepo, userRepo, studentRepo, announcementRepo, roleRepo, auditService, logger)
+	telegramService := NewTelegramService(bot, logger)
+	userService := NewUserService(userRepo, auditService)
+	classService := NewClassService(classRepo, auditService)
+	complaintService := NewComplaintService(complaintRepo, userRepo, auditService)
+	proposalService := NewProposalService(proposalRepo, userRepo, auditService)
+	timetableService := NewTimetableService(timetableRepo, classRepo, auditService)
+	announcementService := NewAnnouncementService(announcementRepo, announcementDeliveryRepo, auditService, logger)
+	documentService := NewDocumentService(cfg.Documents.TempDir, logger)
+	teacherService := NewTeacherService(db, auditService)
+	studentService := NewStudentService(db, auditService)
+	testResultService := NewTestResultService(db, auditService)
+	attendanceService := NewAttendanceService(db, location, auditService)
+	apiTokenService := NewAPITokenService(apiTokenRepo, roleRepo, cfg.Admin.APISecret, auditService)
+	updateLogService := NewUpdateLogService(processedUpdateRepo, logger)
+
+	s := &BotService{
+		Bot:                      bot,
+		Self:                     self,
+		Logger:                   logger,
+		UpdateLoggers:            logging.NewScopes(logger),
+		Config:                   cfg,
+		Location:                 location,
+		UserRepo:                 userRepo,
+		ComplaintRepo:            complaintRepo,
+		ProposalRepo:             proposalRepo,
+		TimetableRepo:            timetableRepo,
+		AnnouncementRepo:         announcementRepo,
+		AnnouncementDeliveryRepo: announcementDeliveryRepo,
+		AdminRepo:                adminRepo,
+		ClassRepo:                classRepo,
+		TeacherRepo:              teacherRepo,
+		StudentRepo:              studentRepo,
+		TestResultRepo:           testResultRepo,
+		AttendanceRepo:           attendanceRepo,
+		APITokenRepo:             apiTokenRepo,
+		ProcessedUpdateRepo:      processedUpdateRepo,
+		JobRepo:                  jobRepo,
+		NotificationRepo:         notificationRepo,
+		AuditRepo:                auditRepo,
+		RoleRepo:                 roleRepo,
+		StateManager:             stateManager,
+		RateLimiter:              rateLimiter,
+		Policy:                   policy,
+		Scheduler:                jobScheduler,
+		Outbox:                   notificationOutbox,
+		Broadcaster:              broadcaster,
+		TelegramService:          telegramService,
+		AuditService:             auditService,
+		UserService:              userService,
+		ClassService:             classService,
+		ComplaintService:         complaintService,
+		ProposalService:          proposalService,
+		TimetableService:         timetableService,
+		AnnouncementService:      announcementService,
+		DocumentService:          documentService,
+		TeacherService:           teacherService,
+		StudentService:           studentService,
+		TestResultService:        testResultService,
+		AttendanceService:        attendanceService,
+		APITokenService:          apiTokenService,
+		UpdateLogService:         updateLogService,
+	}
+	s.settings.Store(cfg)
+
+	// ADMIN_PHONES are super-admins, managed in the config rather than the bot
+	s.RoleService = NewRoleService(roleRepo, adminRepo, teacherService, func() []string {
+		return s.Settings().Admin.PhoneNumbers
+	}, auditService)
+
+	// Keep announcement deliveries in step with the outbox
+	notificationOutbox.Observe(announcementService.RecordDeliveryResults)
+
+	return s
+}
+
+// Log returns the logger for a user's in-flight update, carrying its
+// update_id, telegram_id, role, state and handler fields
+func (s *BotService) Log(telegramID int64) *slog.Logger {
+	return s.UpdateLoggers.For(telegramID)
+}
+
+// Settings returns the current configuration, including values reloaded on SIGHUP
+func (s *BotService) Settings() *config.Config {
+	return s.settings.Load()
+}
+
+// ReloadConfig applies the reloadable settings of next (rate limits, admin
+// phones, notifications) without a restart. It returns the names of changed
+// settings that were applied and of those that need a restart.
+func (s *BotService) ReloadConfig(ctx context.Context, next *config.Config) (applied, needRestart []string, err error) {
+	current := s.Settings()
+	reloaded, needRestart := current.Reload(next)
+	applied = current.Changed(reloaded)
+
+	s.settings.Store(reloaded)
+	configureRateLimiter(s.RateLimiter, &reloaded.RateLimit)
+
+	// Phones dropped from the config lose admin rights; new ones get admin records
+	for _, phone := range current.Admin.PhoneNumbers {
+		if !slices.Contains(reloaded.Admin.PhoneNumbers, phone) {
+			if err := s.removeConfigAdmin(ctx, phone); err != nil {
+				return applied, needRestart, err
+			}
+		}
+	}
+	if err := s.InitializeAdmins(ctx); err != nil {
+		return applied, needRestart, err
+	}
+
+	return applied, needRestart, nil
+}
+
+// newRateLimiter builds the per-role limiter from config
+func newRateLimiter(cfg *config.RateLimitConfig) *ratelimit.Limiter {
+	limiter := ratelimit.New(ratelimit.Limit{})
+	configureRateLimiter(limiter, cfg)
+	return limiter
+}
+
+// configureRateLimiter sets the per-role limits from config
+func configureRateLimiter(limiter *ratelimit.Limiter, cfg *config.RateLimitConfig) {
+	limiter.SetDefaultLimit(ratelimit.Limit{Requests: cfg.Requests, Per: cfg.Duration})
+	limiter.SetLimit(ratelimit.RoleTeacher, ratelimit.Limit{Requests: cfg.TeacherRequests, Per: cfg.Duration})
+	if cfg.ExemptAdmins {
+		limiter.SetLimit(ratelimit.RoleAdmin, ratelimit.Limit{})
+	} else {
+		limiter.ClearLimit(ratelimit.RoleAdmin)
+	}
+}
+
+// SetWebhook sets up webhook. Telegram will send secretToken in the
+// X-Telegram-Bot-Api-Secret-Token header of every webhook request.
+func (s *BotService) SetWebhook(webhookURL, secretToken string) error {
+	// tgbotapi.WebhookConfig predates secret_token, so call the method directly
+	params := tgbotapi.Params{
+		"url":          webhookURL,
+		"secret_token": secretToken,
 	}
 
-	_, err = s.Bot.Request(wh)
+	_, err := s.Bot.MakeRequest("setWebhook", params)
 	if err != nil {
 		return fmt.Errorf("failed to set webhook: %w", err)
 	}
@@ -130,84 +307,104 @@ func (s *BotService) RemoveWebhook() error {
 	return nil
 }
 
-// InitializeAdmins initializes admins from config
-func (s *BotService) InitializeAdmins() error {
-	for _, phone := range s.Config.Admin.PhoneNumbers {
+// InitializeAdmins creates the admins listed in the config as super-admins,
+// or makes them super-admins if they already exist. It warns when there is
+// no super-admin at all, as then nobody can manage roles in the bot.
+func (s *BotService) InitializeAdmins(ctx context.Context) error {
+	for _, phone := range s.Settings().Admin.PhoneNumbers {
 		// Check if admin already exists
-		admin, err := s.AdminRepo.GetByPhoneNumber(phone)
+		admin, err := s.AdminRepo.GetByPhoneNumber(ctx, phone)
 		if err != nil {
 			return fmt.Errorf("failed to check admin: %w", err)
 		}
 
 		if admin == nil {
 			// Create admin
-			_, err = s.AdminRepo.Create(phone, "Admin")
+			created, err := s.AdminRepo.Create(ctx, phone, "Admin", models.RoleSuperAdmin)
 			if err != nil {
-				fmt.Printf("Warning: failed to create admin %s: %v\n", phone, err)
+				s.Logger.Warn("failed to create admin", "phone", phone, "error", err)
+				continue
+			}
+			s.AuditService.Record(ctx, models.AuditEntityAdmin, "create", created.ID, nil, created)
+			continue
+		}
+
+		if admin.Role != models.RoleSuperAdmin {
+			if err := s.AdminRepo.UpdateRole(ctx, phone, models.RoleSuperAdmin); err != nil {
+				return err
 			}
+			after, _ := s.AdminRepo.GetByPhoneNumber(ctx, phone)
+			s.AuditService.Record(ctx, models.AuditEntityAdmin, "update_role", admin.ID, admin, after)
 		}
 	}
 
+	superAdmins, err := s.AdminRepo.CountByRole(ctx, models.RoleSuperAdmin)
+	if err != nil {
+		return fmt.Errorf("failed to count super-admins: %w", err)
+	}
+	if superAdmins == 0 {
+		s.Logger.Warn("there is no super-admin, so nobody can manage roles; set ADMIN_PHONES or run `bot admin add <phone> --role super_admin`")
+	}
+
 	return nil
 }
 
-// GetAdminTelegramIDs gets all admin telegram IDs
-func (s *BotService) GetAdminTelegramIDs() ([]int64, error) {
-	admins, err := s.AdminRepo.GetAll()
+// removeConfigAdmin deletes the admin record of a phone dropped from the config
+func (s *BotService) removeConfigAdmin(ctx context.Context, phone string) error {
+	before, err := s.AdminRepo.GetByPhoneNumber(ctx, phone)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to check admin %s: %w", phone, err)
+	}
+	if before == nil {
+		return nil
 	}
 
-	var ids []int64
-	for _, admin := range admins {
-		if admin.TelegramID != nil {
-			ids = append(ids, *admin.TelegramID)
-		}
+	if err := s.AdminRepo.Delete(ctx, phone); err != nil {
+		return fmt.Errorf("failed to remove admin %s: %w", phone, err)
 	}
 
-	return ids, nil
+	s.AuditService.Record(ctx, models.AuditEntityAdmin, "delete", before.ID, before, nil)
+	return nil
 }
 
-// IsAdmin checks if user is admin by checking:
-// 1. Database admins table (by phone or telegram_id)
-// 2. Config admin phones (if user is registered)
-// 3. Attempts to link telegram_id if admin phone matches
-func (s *BotService) IsAdmin(phoneNumber string, telegramID int64) (bool, error) {
-	// First check database
-	isAdminInDB, err := s.AdminRepo.IsAdmin(phoneNumber, telegramID)
-	if err != nil {
-		return false, err
+// GetAdminTelegramIDs gets the telegram IDs of staff whose role grants any
+// of the permissions
+func (s *BotService) GetAdminTelegramIDs(ctx context.Context, permissions ...models.Permission) ([]int64, error) {
+	granted := map[string]bool{}
+	for _, role := range models.StaffRoles {
+		perms, err := s.RoleService.Permissions(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		granted[role] = perms.HasAny(permissions...)
 	}
 
-	if isAdminInDB {
-		return true, nil
-	}
+	return s.staffTelegramIDs(ctx, func(admin *models.Admin) bool {
+		return granted[admin.Role]
+	})
+}
 
-	// If not found in DB, check if user's phone matches config admin phones
-	if phoneNumber != "" {
-		for _, adminPhone := range s.Config.Admin.PhoneNumbers {
-			if phoneNumber == adminPhone {
-				// Found admin by phone from config, link telegram_id
-				_ = s.AdminRepo.UpdateTelegramID(phoneNumber, telegramID)
-				return true, nil
-			}
-		}
+// GetSuperAdminTelegramIDs gets the telegram IDs of super-admins, which
+// include the ADMIN_PHONES admins
+func (s *BotService) GetSuperAdminTelegramIDs(ctx context.Context) ([]int64, error) {
+	return s.staffTelegramIDs(ctx, func(admin *models.Admin) bool {
+		return admin.Role == models.RoleSuperAdmin
+	})
+}
+
+// staffTelegramIDs gets the telegram IDs of the admins include accepts
+func (s *BotService) staffTelegramIDs(ctx context.Context, include func(*models.Admin) bool) ([]int64, error) {
+	admins, err := s.AdminRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// If phone is empty, try to get it from user record
-	if phoneNumber == "" && telegramID != 0 {
-		user, err := s.UserService.GetUserByTelegramID(telegramID)
-		if err == nil && user != nil {
-			// Check if user's phone is an admin phone
-			for _, adminPhone := range s.Config.Admin.PhoneNumbers {
-				if user.PhoneNumber == adminPhone {
-					// Found admin by phone from config, link telegram_id
-					_ = s.AdminRepo.UpdateTelegramID(user.PhoneNumber, telegramID)
-					return true, nil
-				}
-			}
+	var ids []int64
+	for _, admin := range admins {
+		if admin.TelegramID != nil && *admin.TelegramID != 0 && include(admin) {
+			ids = append(ids, *admin.TelegramID)
 		}
 	}
 
-	return false, nil
+	return ids, nil
 }
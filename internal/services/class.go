@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+)
+
+// ClassService handles class changes, recording each in the audit log
+type ClassService struct {
+	repo  *repository.ClassRepository
+	audit *AuditService
+}
+
+// NewClassService creates a new class service
+func NewClassService(repo *repository.ClassRepository, audit *AuditService) *ClassService {
+	return &ClassService{repo: repo, audit: audit}
+}
+
+// CreateClass creates a new class
+func (s *ClassService) CreateClass(ctx context.Context, className string) (*models.Class, error) {
+	class, err := s.repo.Create(ctx, className)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityClass, "create", class.ID, nil, class)
+	return class, nil
+}
+
+// UpdateClass renames a class or changes whether it is active
+func (s *ClassService) UpdateClass(ctx context.Context, id int, req *models.UpdateClassRequest) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	if err := s.repo.Update(ctx, id, req); err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityClass, "update", id, before, after)
+	return nil
+}
+
+// ToggleClassActive activates an inactive class or deactivates an active one
+func (s *ClassService) ToggleClassActive(ctx context.Context, className string) error {
+	before, _ := s.repo.GetByName(ctx, className)
+
+	if err := s.repo.ToggleActive(ctx, className); err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByName(ctx, className)
+	s.audit.Record(ctx, models.AuditEntityClass, "toggle_active", classID(before, after), before, after)
+	return nil
+}
+
+// DeleteClass deletes a class by ID
+func (s *ClassService) DeleteClass(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	if err := s.repo.DeleteByID(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityClass, "delete", id, before, nil)
+	return nil
+}
+
+// DeleteClassByName deletes a class by name
+func (s *ClassService) DeleteClassByName(ctx context.Context, className string) error {
+	before, _ := s.repo.GetByName(ctx, className)
+
+	if err := s.repo.Delete(ctx, className); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityClass, "delete", classID(before, nil), before, nil)
+	return nil
+}
+
+// classID returns the ID of whichever class was read, for the audit log
+func classID(classes ...*models.Class) any {
+	for _, class := range classes {
+		if class != nil {
+			return class.ID
+		}
+	}
+	return nil
+}
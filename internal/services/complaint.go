@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 
 	"parent-bot/internal/models"
@@ -11,20 +12,22 @@ import (
 type ComplaintService struct {
 	repo     *repository.ComplaintRepository
 	userRepo *repository.UserRepository
+	audit    *AuditService
 }
 
 // NewComplaintService creates a new complaint service
-func NewComplaintService(repo *repository.ComplaintRepository, userRepo *repository.UserRepository) *ComplaintService {
+func NewComplaintService(repo *repository.ComplaintRepository, userRepo *repository.UserRepository, audit *AuditService) *ComplaintService {
 	return &ComplaintService{
 		repo:     repo,
 		userRepo: userRepo,
+		audit:    audit,
 	}
 }
 
 // CreateComplaint creates a new complaint
-func (s *ComplaintService) CreateComplaint(req *models.CreateComplaintRequest) (*models.Complaint, error) {
+func (s *ComplaintService) CreateComplaint(ctx context.Context, req *models.CreateComplaintRequest) (*models.Complaint, error) {
 	// Create complaint directly - user validation already done in handler
-	complaint, err := s.repo.Create(req)
+	complaint, err := s.repo.Create(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create complaint: %w", err)
 	}
@@ -33,8 +36,8 @@ func (s *ComplaintService) CreateComplaint(req *models.CreateComplaintRequest) (
 }
 
 // GetComplaintByID gets complaint by ID
-func (s *ComplaintService) GetComplaintByID(id int) (*models.Complaint, error) {
-	complaint, err := s.repo.GetByID(id)
+func (s *ComplaintService) GetComplaintByID(ctx context.Context, id int) (*models.Complaint, error) {
+	complaint, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get complaint: %w", err)
 	}
@@ -43,8 +46,8 @@ func (s *ComplaintService) GetComplaintByID(id int) (*models.Complaint, error) {
 }
 
 // GetUserComplaints gets complaints by user ID
-func (s *ComplaintService) GetUserComplaints(userID int, limit, offset int) ([]*models.Complaint, error) {
-	complaints, err := s.repo.GetByUserID(userID, limit, offset)
+func (s *ComplaintService) GetUserComplaints(ctx context.Context, userID int, limit, offset int) ([]*models.Complaint, error) {
+	complaints, err := s.repo.GetByUserID(ctx, userID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user complaints: %w", err)
 	}
@@ -53,8 +56,8 @@ func (s *ComplaintService) GetUserComplaints(userID int, limit, offset int) ([]*
 }
 
 // GetAllComplaints gets all complaints with pagination
-func (s *ComplaintService) GetAllComplaints(limit, offset int) ([]*models.Complaint, error) {
-	complaints, err := s.repo.GetAll(limit, offset)
+func (s *ComplaintService) GetAllComplaints(ctx context.Context, limit, offset int) ([]*models.Complaint, error) {
+	complaints, err := s.repo.GetAll(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get complaints: %w", err)
 	}
@@ -63,8 +66,8 @@ func (s *ComplaintService) GetAllComplaints(limit, offset int) ([]*models.Compla
 }
 
 // GetAllComplaintsWithUser gets all complaints with user info
-func (s *ComplaintService) GetAllComplaintsWithUser(limit, offset int) ([]*models.ComplaintWithUser, error) {
-	complaints, err := s.repo.GetAllWithUser(limit, offset)
+func (s *ComplaintService) GetAllComplaintsWithUser(ctx context.Context, limit, offset int) ([]*models.ComplaintWithUser, error) {
+	complaints, err := s.repo.GetAllWithUser(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get complaints with user: %w", err)
 	}
@@ -73,8 +76,8 @@ func (s *ComplaintService) GetAllComplaintsWithUser(limit, offset int) ([]*model
 }
 
 // GetComplaintsByStatus gets complaints by status
-func (s *ComplaintService) GetComplaintsByStatus(status string, limit, offset int) ([]*models.Complaint, error) {
-	complaints, err := s.repo.GetByStatus(status, limit, offset)
+func (s *ComplaintService) GetComplaintsByStatus(ctx context.Context, status string, limit, offset int) ([]*models.Complaint, error) {
+	complaints, err := s.repo.GetByStatus(ctx, status, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get complaints by status: %w", err)
 	}
@@ -83,7 +86,7 @@ func (s *ComplaintService) GetComplaintsByStatus(status string, limit, offset in
 }
 
 // UpdateComplaintStatus updates complaint status
-func (s *ComplaintService) UpdateComplaintStatus(id int, status string) error {
+func (s *ComplaintService) UpdateComplaintStatus(ctx context.Context, id int, status string) error {
 	// Validate status
 	validStatuses := map[string]bool{
 		models.StatusPending:  true,
@@ -95,17 +98,21 @@ func (s *ComplaintService) UpdateComplaintStatus(id int, status string) error {
 		return fmt.Errorf("invalid status: %s", status)
 	}
 
-	err := s.repo.UpdateStatus(id, status)
+	before, _ := s.repo.GetByID(ctx, id)
+
+	err := s.repo.UpdateStatus(ctx, id, status)
 	if err != nil {
 		return fmt.Errorf("failed to update complaint status: %w", err)
 	}
 
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityComplaint, "update_status", id, before, after)
 	return nil
 }
 
 // CountComplaints counts total complaints
-func (s *ComplaintService) CountComplaints() (int, error) {
-	count, err := s.repo.Count()
+func (s *ComplaintService) CountComplaints(ctx context.Context) (int, error) {
+	count, err := s.repo.Count(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count complaints: %w", err)
 	}
@@ -114,8 +121,8 @@ func (s *ComplaintService) CountComplaints() (int, error) {
 }
 
 // CountComplaintsByStatus counts complaints by status
-func (s *ComplaintService) CountComplaintsByStatus(status string) (int, error) {
-	count, err := s.repo.CountByStatus(status)
+func (s *ComplaintService) CountComplaintsByStatus(ctx context.Context, status string) (int, error) {
+	count, err := s.repo.CountByStatus(ctx, status)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count complaints by status: %w", err)
 	}
@@ -124,8 +131,8 @@ func (s *ComplaintService) CountComplaintsByStatus(status string) (int, error) {
 }
 
 // CountUserComplaints counts complaints by user ID
-func (s *ComplaintService) CountUserComplaints(userID int) (int, error) {
-	count, err := s.repo.CountByUserID(userID)
+func (s *ComplaintService) CountUserComplaints(ctx context.Context, userID int) (int, error) {
+	count, err := s.repo.CountByUserID(ctx, userID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count user complaints: %w", err)
 	}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"time"
@@ -14,11 +15,12 @@ import (
 // DocumentService handles document generation and management
 type DocumentService struct {
 	tempDir string
+	logger  *slog.Logger
 }
 
 // NewDocumentService creates a new document service
-func NewDocumentService(tempDir string) *DocumentService {
-	return &DocumentService{tempDir: tempDir}
+func NewDocumentService(tempDir string, logger *slog.Logger) *DocumentService {
+	return &DocumentService{tempDir: tempDir, logger: logger}
 }
 
 // GenerateComplaintDocument generates a DOCX document for a complaint
@@ -65,7 +67,7 @@ func (s *DocumentService) GenerateComplaintDocument(user *models.User, student *
 		return "", "", fmt.Errorf("generated file is too small (%d bytes), might be corrupted", fileInfo.Size())
 	}
 
-	fmt.Printf("[DEBUG] Document verified: %s, size: %d bytes\n", filename, fileInfo.Size())
+	s.logger.Debug("document verified", "file", filename, "size", fileInfo.Size())
 
 	return filePath, filename, nil
 }
@@ -114,7 +116,7 @@ func (s *DocumentService) GenerateProposalDocument(user *models.User, student *m
 		return "", "", fmt.Errorf("generated file is too small (%d bytes), might be corrupted", fileInfo.Size())
 	}
 
-	fmt.Printf("[DEBUG] Document verified: %s, size: %d bytes\n", filename, fileInfo.Size())
+	s.logger.Debug("document verified", "file", filename, "size", fileInfo.Size())
 
 	return filePath, filename, nil
 }
@@ -200,7 +202,7 @@ func (s *DocumentService) GenerateClassTestResultsDocument(className string, res
 		return "", "", fmt.Errorf("generated file is empty")
 	}
 
-	fmt.Printf("[DEBUG] Test results document verified: %s, size: %d bytes\n", filename, fileInfo.Size())
+	s.logger.Debug("test results document verified", "file", filename, "size", fileInfo.Size())
 
 	return filePath, filename, nil
 }
@@ -266,7 +268,7 @@ func (s *DocumentService) GenerateTodayAttendanceDocument(classesData []struct {
 		return "", "", fmt.Errorf("generated file is empty")
 	}
 
-	fmt.Printf("[DEBUG] Attendance document verified: %s, size: %d bytes\n", filename, fileInfo.Size())
+	s.logger.Debug("attendance document verified", "file", filename, "size", fileInfo.Size())
 
 	return filePath, filename, nil
 }
@@ -0,0 +1,10 @@
+package services
+
+import "errors"
+
+// Errors returned by entity services, wrapped with the entity name
+// (e.g. "class not found") so callers can match them with errors.Is
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
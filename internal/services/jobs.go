@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+
+	"parent-bot/internal/scheduler"
+)
+
+// Background job names
+const (
+	JobCleanStates   = "clean_states"
+	JobCleanTempDocs = "clean_temp_docs"
+	JobBackup        = "backup_database"
+	JobCleanOutbox   = "clean_outbox"
+)
+
+// RegisterJobs adds the built-in background jobs to the scheduler
+func (s *BotService) RegisterJobs() error {
+	cfg := s.Config.Scheduler
+
+	jobs := []scheduler.Job{
+		{
+			Name:        JobCleanStates,
+			Description: "Eskirgan suhbat holatlarini o'chirish / Удаление устаревших состояний диалогов",
+			Schedule:    cfg.StateCleanupSchedule,
+			CatchUp:     true,
+			Run: func(ctx context.Context) error {
+				return s.StateManager.CleanOldStates(ctx, int(cfg.StateRetention.Hours()))
+			},
+		},
+		{
+			Name:        JobCleanTempDocs,
+			Description: "Vaqtinchalik hujjatlarni o'chirish / Удаление временных документов",
+			Schedule:    cfg.TempCleanupSchedule,
+			CatchUp:     true,
+			Run: func(ctx context.Context) error {
+				return s.DocumentService.CleanTempDirectory(cfg.TempFileRetention)
+			},
+		},
+		{
+			Name:        JobCleanOutbox,
+			Description: "Eski bildirishnomalarni o'chirish / Удаление старых уведомлений",
+			Schedule:    s.Config.Outbox.CleanupSchedule,
+			CatchUp:     true,
+			Run: func(ctx context.Context) error {
+				removed, err := s.NotificationRepo.DeleteOlderThan(ctx, int(s.Config.Outbox.Retention.Hours()))
+				if err != nil {
+					return err
+				}
+				s.Logger.Info("old notifications removed", "count", removed)
+				return nil
+			},
+		},
+	}
+
+	// Scheduled backups are off unless a schedule is configured
+	if s.Config.Backup.Schedule != "" {
+		jobs = append(jobs, scheduler.Job{
+			Name:        JobBackup,
+			Description: "Ma'lumotlar bazasini zaxiralash / Резервное копирование базы данных",
+			Schedule:    s.Config.Backup.Schedule,
+			CatchUp:     true,
+			Run:         s.BackupDatabase,
+		})
+	}
+
+	for _, job := range jobs {
+		if err := s.Scheduler.Register(job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
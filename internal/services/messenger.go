@@ -0,0 +1,21 @@
+package services
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Messenger is the part of the Telegram Bot API the bot uses.
+// *tgbotapi.BotAPI implements it; end-to-end tests point a BotAPI at
+// the fake server in internal/fakebot instead of api.telegram.org.
+type Messenger interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+	GetMe() (tgbotapi.User, error)
+	GetFile(config tgbotapi.FileConfig) (tgbotapi.File, error)
+	GetFileDirectURL(fileID string) (string, error)
+	GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
+	StopReceivingUpdates()
+}
+
+var _ Messenger = (*tgbotapi.BotAPI)(nil)
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 
 	"parent-bot/internal/models"
@@ -11,20 +12,22 @@ import (
 type ProposalService struct {
 	repo     *repository.ProposalRepository
 	userRepo *repository.UserRepository
+	audit    *AuditService
 }
 
 // NewProposalService creates a new proposal service
-func NewProposalService(repo *repository.ProposalRepository, userRepo *repository.UserRepository) *ProposalService {
+func NewProposalService(repo *repository.ProposalRepository, userRepo *repository.UserRepository, audit *AuditService) *ProposalService {
 	return &ProposalService{
 		repo:     repo,
 		userRepo: userRepo,
+		audit:    audit,
 	}
 }
 
 // CreateProposal creates a new proposal
-func (s *ProposalService) CreateProposal(req *models.CreateProposalRequest) (*models.Proposal, error) {
+func (s *ProposalService) CreateProposal(ctx context.Context, req *models.CreateProposalRequest) (*models.Proposal, error) {
 	// Create proposal directly - user validation already done in handler
-	proposal, err := s.repo.Create(req)
+	proposal, err := s.repo.Create(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create proposal: %w", err)
 	}
@@ -33,8 +36,8 @@ func (s *ProposalService) CreateProposal(req *models.CreateProposalRequest) (*mo
 }
 
 // GetProposalByID gets proposal by ID
-func (s *ProposalService) GetProposalByID(id int) (*models.Proposal, error) {
-	proposal, err := s.repo.GetByID(id)
+func (s *ProposalService) GetProposalByID(ctx context.Context, id int) (*models.Proposal, error) {
+	proposal, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get proposal: %w", err)
 	}
@@ -43,8 +46,8 @@ func (s *ProposalService) GetProposalByID(id int) (*models.Proposal, error) {
 }
 
 // GetUserProposals gets proposals by user ID
-func (s *ProposalService) GetUserProposals(userID int, limit, offset int) ([]*models.Proposal, error) {
-	proposals, err := s.repo.GetByUserID(userID, limit, offset)
+func (s *ProposalService) GetUserProposals(ctx context.Context, userID int, limit, offset int) ([]*models.Proposal, error) {
+	proposals, err := s.repo.GetByUserID(ctx, userID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user proposals: %w", err)
 	}
@@ -53,8 +56,8 @@ func (s *ProposalService) GetUserProposals(userID int, limit, offset int) ([]*mo
 }
 
 // GetAllProposals gets all proposals with pagination
-func (s *ProposalService) GetAllProposals(limit, offset int) ([]*models.Proposal, error) {
-	proposals, err := s.repo.GetAll(limit, offset)
+func (s *ProposalService) GetAllProposals(ctx context.Context, limit, offset int) ([]*models.Proposal, error) {
+	proposals, err := s.repo.GetAll(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get proposals: %w", err)
 	}
@@ -63,8 +66,8 @@ func (s *ProposalService) GetAllProposals(limit, offset int) ([]*models.Proposal
 }
 
 // GetAllProposalsWithUser gets all proposals with user info
-func (s *ProposalService) GetAllProposalsWithUser(limit, offset int) ([]*models.ProposalWithUser, error) {
-	proposals, err := s.repo.GetAllWithUser(limit, offset)
+func (s *ProposalService) GetAllProposalsWithUser(ctx context.Context, limit, offset int) ([]*models.ProposalWithUser, error) {
+	proposals, err := s.repo.GetAllWithUser(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get proposals with user: %w", err)
 	}
@@ -73,8 +76,8 @@ func (s *ProposalService) GetAllProposalsWithUser(limit, offset int) ([]*models.
 }
 
 // GetProposalsByStatus gets proposals by status
-func (s *ProposalService) GetProposalsByStatus(status string, limit, offset int) ([]*models.Proposal, error) {
-	proposals, err := s.repo.GetByStatus(status, limit, offset)
+func (s *ProposalService) GetProposalsByStatus(ctx context.Context, status string, limit, offset int) ([]*models.Proposal, error) {
+	proposals, err := s.repo.GetByStatus(ctx, status, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get proposals by status: %w", err)
 	}
@@ -83,7 +86,7 @@ func (s *ProposalService) GetProposalsByStatus(status string, limit, offset int)
 }
 
 // UpdateProposalStatus updates proposal status
-func (s *ProposalService) UpdateProposalStatus(id int, status string) error {
+func (s *ProposalService) UpdateProposalStatus(ctx context.Context, id int, status string) error {
 	// Validate status (using same statuses as complaints)
 	validStatuses := map[string]bool{
 		models.StatusPending:  true,
@@ -95,17 +98,21 @@ func (s *ProposalService) UpdateProposalStatus(id int, status string) error {
 		return fmt.Errorf("invalid status: %s", status)
 	}
 
-	err := s.repo.UpdateStatus(id, status)
+	before, _ := s.repo.GetByID(ctx, id)
+
+	err := s.repo.UpdateStatus(ctx, id, status)
 	if err != nil {
 		return fmt.Errorf("failed to update proposal status: %w", err)
 	}
 
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityProposal, "update_status", id, before, after)
 	return nil
 }
 
 // CountProposals counts total proposals
-func (s *ProposalService) CountProposals() (int, error) {
-	count, err := s.repo.Count()
+func (s *ProposalService) CountProposals(ctx context.Context) (int, error) {
+	count, err := s.repo.Count(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count proposals: %w", err)
 	}
@@ -114,8 +121,8 @@ func (s *ProposalService) CountProposals() (int, error) {
 }
 
 // CountProposalsByStatus counts proposals by status
-func (s *ProposalService) CountProposalsByStatus(status string) (int, error) {
-	count, err := s.repo.CountByStatus(status)
+func (s *ProposalService) CountProposalsByStatus(ctx context.Context, status string) (int, error) {
+	count, err := s.repo.CountByStatus(ctx, status)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count proposals by status: %w", err)
 	}
@@ -124,8 +131,8 @@ func (s *ProposalService) CountProposalsByStatus(status string) (int, error) {
 }
 
 // CountUserProposals counts proposals by user ID
-func (s *ProposalService) CountUserProposals(userID int) (int, error) {
-	count, err := s.repo.CountByUserID(userID)
+func (s *ProposalService) CountUserProposals(ctx context.Context, userID int) (int, error) {
+	count, err := s.repo.CountByUserID(ctx, userID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count user proposals: %w", err)
 	}
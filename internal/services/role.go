@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"parent-bot/internal/authz"
+	"parent-bot/internal/models"
+	"parent-bot/internal/repository"
+	"parent-bot/internal/validator"
+)
+
+// Errors returned when a role change isn't allowed
+var (
+	ErrUnknownRole    = errors.New("unknown role")
+	ErrConfigAdmin    = errors.New("listed in ADMIN_PHONES; change the configuration instead")
+	ErrLastSuperAdmin = errors.New("the last super-admin can't be removed")
+	ErrSuperAdminOnly = errors.New("only a super-admin can do this")
+	ErrOwnRole        = errors.New("you can't change your own role")
+)
+
+// RoleService manages roles: the permissions granted to each and who has
+// them. Super-admins have every permission; theirs can't be changed. Changes
+// are made as the caller in the context: only super-admins may touch the
+// super-admin role or roles.manage, and nobody may change their own role.
+type RoleService struct {
+	repo           *repository.RoleRepository
+	adminRepo      *repository.AdminRepository
+	teacherService *TeacherService
+	configAdmins   func() []string
+	audit          *AuditService
+}
+
+// NewRoleService creates a new role service. configAdmins returns the
+// current ADMIN_PHONES, whose super-admin role is managed in the config.
+func NewRoleService(repo *repository.RoleRepository, adminRepo *repository.AdminRepository, teacherService *TeacherService, configAdmins func() []string, audit *AuditService) *RoleService {
+	return &RoleService{
+		repo:           repo,
+		adminRepo:      adminRepo,
+		teacherService: teacherService,
+		configAdmins:   configAdmins,
+		audit:          audit,
+	}
+}
+
+// Permissions gets the permissions granted to a role
+func (s *RoleService) Permissions(ctx context.Context, role string) (models.PermissionSet, error) {
+	if role == models.RoleSuperAdmin {
+		return models.AllPermissions(), nil
+	}
+	return s.repo.Permissions(ctx, role)
+}
+
+// SetPermission grants a permission to a role or revokes it
+func (s *RoleService) SetPermission(ctx context.Context, role string, permission models.Permission, granted bool) error {
+	if !slices.Contains(models.Roles, role) || role == models.RoleSuperAdmin {
+		return fmt.Errorf("%w: %s", ErrUnknownRole, role)
+	}
+	if !slices.Contains(models.Permissions, permission) {
+		return fmt.Errorf("permission %s %w", permission, ErrNotFound)
+	}
+
+	// Otherwise whoever manages roles could grant their own role anything
+	caller := authz.CallerFrom(ctx)
+	if !caller.IsSuperAdmin() {
+		if permission == models.PermRolesManage {
+			return ErrSuperAdminOnly
+		}
+		if (caller.Admin != nil && caller.Admin.Role == role) || (caller.Teacher != nil && caller.Teacher.Role == role) {
+			return ErrOwnRole
+		}
+	}
+
+	change := rolePermission{Role: role, Permission: permission}
+	if granted {
+		if err := s.repo.Grant(ctx, role, permission); err != nil {
+			return err
+		}
+		s.audit.Record(ctx, models.AuditEntityRole, "grant", role, nil, change)
+		return nil
+	}
+
+	if err := s.repo.Revoke(ctx, role, permission); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, models.AuditEntityRole, "revoke", role, change, nil)
+	return nil
+}
+
+// rolePermission is a grant as recorded in the audit log
+type rolePermission struct {
+	Role       string            `json:"role"`
+	Permission models.Permission `json:"permission"`
+}
+
+// Staff gets the admins with a staff role
+func (s *RoleService) Staff(ctx context.Context, role string) ([]*models.Admin, error) {
+	admins, err := s.adminRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var staff []*models.Admin
+	for _, admin := range admins {
+		if admin.Role == role {
+			staff = append(staff, admin)
+		}
+	}
+	return staff, nil
+}
+
+// Teachers gets all teachers with a teacher role, reading them page by page
+func (s *RoleService) Teachers(ctx context.Context, role string) ([]*models.Teacher, error) {
+	const pageSize = 200
+
+	var teachers []*models.Teacher
+	for {
+		page, total, err := s.teacherService.ListTeachers(ctx, &models.TeacherFilter{
+			Role:   role,
+			Limit:  pageSize,
+			Offset: len(teachers),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		teachers = append(teachers, page...)
+		if len(page) < pageSize || len(teachers) >= total {
+			return teachers, nil
+		}
+	}
+}
+
+// AssignRole gives the person with a phone number a role. A staff role
+// creates their admin record, named name, if they have none; a teacher role
+// needs an existing teacher.
+func (s *RoleService) AssignRole(ctx context.Context, phoneNumber, role, name string) error {
+	phone, err := validator.ValidateUzbekPhone(phoneNumber)
+	if err != nil {
+		return fmt.Errorf("invalid phone number: %w", err)
+	}
+	if err := s.checkCaller(ctx, phone, role == models.RoleSuperAdmin); err != nil {
+		return err
+	}
+
+	switch {
+	case slices.Contains(models.TeacherRoles, role):
+		teacher, err := s.teacherService.GetTeacherByPhoneNumber(ctx, phone)
+		if err != nil {
+			return err
+		}
+		if teacher == nil {
+			return fmt.Errorf("teacher %s %w", phone, ErrNotFound)
+		}
+		return s.teacherService.UpdateTeacher(ctx, teacher.ID, &models.UpdateTeacherRequest{Role: role})
+
+	case slices.Contains(models.StaffRoles, role):
+		if slices.Contains(s.configAdmins(), phone) {
+			return fmt.Errorf("%s is %w", phone, ErrConfigAdmin)
+		}
+
+		before, err := s.adminRepo.GetByPhoneNumber(ctx, phone)
+		if err != nil {
+			return err
+		}
+
+		if before == nil {
+			if name == "" {
+				name = "Admin"
+			}
+			admin, err := s.adminRepo.Create(ctx, phone, name, role)
+			if err != nil {
+				return err
+			}
+			s.audit.Record(ctx, models.AuditEntityAdmin, "create", admin.ID, nil, admin)
+			return nil
+		}
+
+		if before.Role == role {
+			return nil
+		}
+		if err := s.checkCaller(ctx, phone, before.Role == models.RoleSuperAdmin); err != nil {
+			return err
+		}
+		if err := s.checkNotLastSuperAdmin(ctx, before); err != nil {
+			return err
+		}
+
+		if err := s.adminRepo.UpdateRole(ctx, phone, role); err != nil {
+			return err
+		}
+		after, _ := s.adminRepo.GetByPhoneNumber(ctx, phone)
+		s.audit.Record(ctx, models.AuditEntityAdmin, "update_role", before.ID, before, after)
+		return nil
+
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownRole, role)
+	}
+}
+
+// RevokeStaff removes the admin record, and with it the staff role, of the
+// person with a phone number
+func (s *RoleService) RevokeStaff(ctx context.Context, phoneNumber string) error {
+	phone, err := validator.ValidateUzbekPhone(phoneNumber)
+	if err != nil {
+		return fmt.Errorf("invalid phone number: %w", err)
+	}
+
+	if slices.Contains(s.configAdmins(), phone) {
+		return fmt.Errorf("%s is %w", phone, ErrConfigAdmin)
+	}
+
+	before, err := s.adminRepo.GetByPhoneNumber(ctx, phone)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return fmt.Errorf("admin %s %w", phone, ErrNotFound)
+	}
+	if err := s.checkCaller(ctx, phone, before.Role == models.RoleSuperAdmin); err != nil {
+		return err
+	}
+	if err := s.checkNotLastSuperAdmin(ctx, before); err != nil {
+		return err
+	}
+
+	if err := s.adminRepo.Delete(ctx, phone); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityAdmin, "delete", before.ID, before, nil)
+	return nil
+}
+
+// LinkTelegramID links a Telegram account to the admin with a phone number.
+// It does nothing if there is no such admin or the account is already linked.
+func (s *RoleService) LinkTelegramID(ctx context.Context, phoneNumber string, telegramID int64) error {
+	before, err := s.adminRepo.GetByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return err
+	}
+	if before == nil || (before.TelegramID != nil && *before.TelegramID == telegramID) {
+		return nil
+	}
+
+	if err := s.adminRepo.UpdateTelegramID(ctx, phoneNumber, telegramID); err != nil {
+		return err
+	}
+
+	after, _ := s.adminRepo.GetByPhoneNumber(ctx, phoneNumber)
+	s.audit.Record(ctx, models.AuditEntityAdmin, "link_telegram", before.ID, before, after)
+	return nil
+}
+
+// checkCaller refuses to let the caller change their own role, or, unless
+// they are a super-admin, a change that involves the super-admin role
+func (s *RoleService) checkCaller(ctx context.Context, phone string, superAdmin bool) error {
+	caller := authz.CallerFrom(ctx)
+	if caller.HasPhone(phone) {
+		return ErrOwnRole
+	}
+	if superAdmin && !caller.IsSuperAdmin() {
+		return ErrSuperAdminOnly
+	}
+	return nil
+}
+
+// checkNotLastSuperAdmin refuses to take the role of the only super-admin,
+// which would leave nobody able to manage roles in the bot
+func (s *RoleService) checkNotLastSuperAdmin(ctx context.Context, admin *models.Admin) error {
+	if admin.Role != models.RoleSuperAdmin {
+		return nil
+	}
+
+	count, err := s.adminRepo.CountByRole(ctx, models.RoleSuperAdmin)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return ErrLastSuperAdmin
+	}
+	return nil
+}
@@ -1,9 +1,12 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
+	"parent-bot/internal/database"
 	"parent-bot/internal/models"
 	"parent-bot/internal/repository"
 )
@@ -13,170 +16,310 @@ type StudentService struct {
 	repo      *repository.StudentRepository
 	classRepo *repository.ClassRepository
 	userRepo  *repository.UserRepository
+	uow       *database.UnitOfWork
+	audit     *AuditService
 }
 
 // NewStudentService creates a new student service
-func NewStudentService(db *sql.DB) *StudentService {
+func NewStudentService(db *sql.DB, audit *AuditService) *StudentService {
 	return &StudentService{
 		repo:      repository.NewStudentRepository(db),
 		classRepo: repository.NewClassRepository(db),
 		userRepo:  repository.NewUserRepository(db),
+		uow:       database.NewUnitOfWork(db),
+		audit:     audit,
 	}
 }
 
 // CreateStudent creates a new student
-func (s *StudentService) CreateStudent(req *models.CreateStudentRequest) (int64, error) {
+func (s *StudentService) CreateStudent(ctx context.Context, req *models.CreateStudentRequest) (int64, error) {
 	// Verify class exists
-	_, err := s.classRepo.GetByID(req.ClassID)
+	class, err := s.classRepo.GetByID(ctx, req.ClassID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, fmt.Errorf("class not found")
-		}
 		return 0, err
 	}
+	if class == nil {
+		return 0, fmt.Errorf("class %w", ErrNotFound)
+	}
 
 	// Ensure either admin or teacher is set
 	if req.AddedByAdminID == nil && req.AddedByTeacherID == nil {
 		return 0, fmt.Errorf("either admin or teacher must be specified")
 	}
 
-	return s.repo.Create(req)
+	id, err := s.repo.Create(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityStudent, "create", id, nil, req)
+	return id, nil
+}
+
+// ImportStudents creates many students at once. Students whose class already
+// has an active student of the same name are skipped, so an import can be
+// run again. If any student fails, none are saved.
+func (s *StudentService) ImportStudents(ctx context.Context, reqs []*models.CreateStudentRequest) (added, skipped int, err error) {
+	type createdStudent struct {
+		id  int64
+		req *models.CreateStudentRequest
+	}
+	var created []createdStudent
+
+	err = s.uow.Do(ctx, func(tx *sql.Tx) error {
+		students := s.repo.WithTx(tx)
+		classes := s.classRepo.WithTx(tx)
+
+		// Names already in each class, including earlier rows of this import
+		existing := make(map[int]map[string]bool)
+		added, skipped = 0, 0
+		created = created[:0]
+
+		for _, req := range reqs {
+			if req.AddedByAdminID == nil && req.AddedByTeacherID == nil {
+				return fmt.Errorf("either admin or teacher must be specified")
+			}
+
+			names, ok := existing[req.ClassID]
+			if !ok {
+				class, err := classes.GetByID(ctx, req.ClassID)
+				if err != nil {
+					return err
+				}
+				if class == nil {
+					return fmt.Errorf("class %d %w", req.ClassID, ErrNotFound)
+				}
+
+				current, err := students.GetByClassID(ctx, req.ClassID)
+				if err != nil {
+					return err
+				}
+				names = make(map[string]bool, len(current))
+				for _, student := range current {
+					names[importKey(student.FirstName, student.LastName)] = true
+				}
+				existing[req.ClassID] = names
+			}
+
+			key := importKey(req.FirstName, req.LastName)
+			if names[key] {
+				skipped++
+				continue
+			}
+
+			id, err := students.Create(ctx, req)
+			if err != nil {
+				return fmt.Errorf("failed to create student %s %s: %w", req.FirstName, req.LastName, err)
+			}
+			names[key] = true
+			created = append(created, createdStudent{id, req})
+			added++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Recorded once committed, as a failed import saves nothing
+	for _, c := range created {
+		s.audit.Record(ctx, models.AuditEntityStudent, "import", c.id, nil, c.req)
+	}
+
+	return added, skipped, nil
+}
+
+// importKey identifies a student by name within a class
+func importKey(firstName, lastName string) string {
+	return strings.ToLower(firstName) + "\x00" + strings.ToLower(lastName)
 }
 
 // GetStudentByID retrieves a student by ID
-func (s *StudentService) GetStudentByID(id int) (*models.Student, error) {
-	return s.repo.GetByID(id)
+func (s *StudentService) GetStudentByID(ctx context.Context, id int) (*models.Student, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
 // GetStudentByIDWithClass retrieves a student with class information
-func (s *StudentService) GetStudentByIDWithClass(id int) (*models.StudentWithClass, error) {
-	return s.repo.GetByIDWithClass(id)
+func (s *StudentService) GetStudentByIDWithClass(ctx context.Context, id int) (*models.StudentWithClass, error) {
+	return s.repo.GetByIDWithClass(ctx, id)
 }
 
 // GetStudentsByClassID retrieves all students in a class
-func (s *StudentService) GetStudentsByClassID(classID int) ([]*models.StudentWithClass, error) {
-	return s.repo.GetByClassID(classID)
+func (s *StudentService) GetStudentsByClassID(ctx context.Context, classID int) ([]*models.StudentWithClass, error) {
+	return s.repo.GetByClassID(ctx, classID)
 }
 
 // SearchStudentsByName searches for students by name in a specific class
-func (s *StudentService) SearchStudentsByName(classID int, searchTerm string) ([]*models.StudentWithClass, error) {
-	return s.repo.SearchByName(classID, searchTerm)
+func (s *StudentService) SearchStudentsByName(ctx context.Context, classID int, searchTerm string) ([]*models.StudentWithClass, error) {
+	return s.repo.SearchByName(ctx, classID, searchTerm)
 }
 
 // UpdateStudent updates student information
-func (s *StudentService) UpdateStudent(id int, req *models.UpdateStudentRequest) error {
+func (s *StudentService) UpdateStudent(ctx context.Context, id int, req *models.UpdateStudentRequest) error {
 	// Check if student exists
-	_, err := s.repo.GetByID(id)
+	before, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("student not found")
+			return fmt.Errorf("student %w", ErrNotFound)
 		}
 		return err
 	}
 
 	// If updating class, verify new class exists
 	if req.ClassID != nil {
-		_, err := s.classRepo.GetByID(*req.ClassID)
+		class, err := s.classRepo.GetByID(ctx, *req.ClassID)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				return fmt.Errorf("new class not found")
-			}
 			return err
 		}
+		if class == nil {
+			return fmt.Errorf("new class %w", ErrNotFound)
+		}
 	}
 
-	return s.repo.Update(id, req)
+	if err := s.repo.Update(ctx, id, req); err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityStudent, "update", id, before, after)
+	return nil
 }
 
 // DeleteStudent soft deletes a student
-func (s *StudentService) DeleteStudent(id int) error {
-	return s.repo.Delete(id)
+func (s *StudentService) DeleteStudent(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityStudent, "delete", id, before, nil)
+	return nil
 }
 
 // HardDeleteStudent permanently deletes a student
-func (s *StudentService) HardDeleteStudent(id int) error {
-	return s.repo.HardDelete(id)
+func (s *StudentService) HardDeleteStudent(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	if err := s.repo.HardDelete(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityStudent, "hard_delete", id, before, nil)
+	return nil
 }
 
 // GetAllStudents retrieves all students with pagination
-func (s *StudentService) GetAllStudents(limit, offset int) ([]*models.StudentWithClass, error) {
-	return s.repo.GetAll(limit, offset)
+func (s *StudentService) GetAllStudents(ctx context.Context, limit, offset int) ([]*models.StudentWithClass, error) {
+	return s.repo.GetAll(ctx, limit, offset)
 }
 
 // CountStudents returns total number of active students
-func (s *StudentService) CountStudents() (int, error) {
-	return s.repo.Count()
+func (s *StudentService) CountStudents(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// ListStudents retrieves students matching a filter and the total number of matches
+func (s *StudentService) ListStudents(ctx context.Context, filter *models.StudentFilter) ([]*models.StudentWithClass, int, error) {
+	students, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.repo.CountFiltered(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return students, total, nil
 }
 
 // CountStudentsByClass returns number of students in a class
-func (s *StudentService) CountStudentsByClass(classID int) (int, error) {
-	return s.repo.CountByClass(classID)
+func (s *StudentService) CountStudentsByClass(ctx context.Context, classID int) (int, error) {
+	return s.repo.CountByClass(ctx, classID)
 }
 
 // LinkToParent links a student to a parent
-func (s *StudentService) LinkToParent(parentID, studentID int) error {
+func (s *StudentService) LinkToParent(ctx context.Context, parentID, studentID int) error {
 	// Check if parent exists
-	_, err := s.userRepo.GetByID(parentID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("parent not found")
-		}
+	parent, err := s.userRepo.GetByID(ctx, parentID)
+	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
+	if parent == nil {
+		return fmt.Errorf("parent %w", ErrNotFound)
+	}
 
 	// Check if student exists
-	_, err = s.repo.GetByID(studentID)
+	_, err = s.repo.GetByID(ctx, studentID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("student not found")
+			return fmt.Errorf("student %w", ErrNotFound)
 		}
 		return err
 	}
 
 	// Check if already linked
-	isLinked, err := s.repo.IsStudentLinkedToParent(parentID, studentID)
+	isLinked, err := s.repo.IsStudentLinkedToParent(ctx, parentID, studentID)
 	if err != nil {
 		return err
 	}
 	if isLinked {
-		return fmt.Errorf("student already linked to this parent")
+		return fmt.Errorf("student already linked to this parent: %w", ErrConflict)
 	}
 
 	// Check parent's current children count
-	count, err := s.repo.CountParentStudents(parentID)
+	count, err := s.repo.CountParentStudents(ctx, parentID)
 	if err != nil {
 		return err
 	}
 	if count >= 4 {
-		return fmt.Errorf("parent already has maximum 4 children")
+		return fmt.Errorf("parent already has maximum 4 children: %w", ErrConflict)
 	}
 
-	return s.repo.LinkToParent(parentID, studentID)
+	if err := s.repo.LinkToParent(ctx, parentID, studentID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityParent, "link_student", parentID, nil, parentLink{parentID, studentID})
+	return nil
 }
 
 // UnlinkFromParent removes the link between student and parent
-func (s *StudentService) UnlinkFromParent(parentID, studentID int) error {
-	return s.repo.UnlinkFromParent(parentID, studentID)
+func (s *StudentService) UnlinkFromParent(ctx context.Context, parentID, studentID int) error {
+	if err := s.repo.UnlinkFromParent(ctx, parentID, studentID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityParent, "unlink_student", parentID, parentLink{parentID, studentID}, nil)
+	return nil
+}
+
+// parentLink is how a parent-student link is recorded in the audit log
+type parentLink struct {
+	ParentID  int `json:"parent_id"`
+	StudentID int `json:"student_id"`
 }
 
 // GetStudentParents retrieves all parents linked to a student
-func (s *StudentService) GetStudentParents(studentID int) ([]*models.User, error) {
-	return s.repo.GetStudentParents(studentID)
+func (s *StudentService) GetStudentParents(ctx context.Context, studentID int) ([]*models.User, error) {
+	return s.repo.GetStudentParents(ctx, studentID)
 }
 
 // GetParentStudents retrieves all students linked to a parent
-func (s *StudentService) GetParentStudents(parentID int) ([]*models.ParentChild, error) {
-	return s.repo.GetParentStudents(parentID)
+func (s *StudentService) GetParentStudents(ctx context.Context, parentID int) ([]*models.ParentChild, error) {
+	return s.repo.GetParentStudents(ctx, parentID)
 }
 
 // CountParentStudents returns the number of students linked to a parent
-func (s *StudentService) CountParentStudents(parentID int) (int, error) {
-	return s.repo.CountParentStudents(parentID)
+func (s *StudentService) CountParentStudents(ctx context.Context, parentID int) (int, error) {
+	return s.repo.CountParentStudents(ctx, parentID)
 }
 
 // IsStudentLinkedToParent checks if a student is already linked to a parent
-func (s *StudentService) IsStudentLinkedToParent(parentID, studentID int) (bool, error) {
-	return s.repo.IsStudentLinkedToParent(parentID, studentID)
+func (s *StudentService) IsStudentLinkedToParent(ctx context.Context, parentID, studentID int) (bool, error) {
+	return s.repo.IsStudentLinkedToParent(ctx, parentID, studentID)
 }
 
 // GetStudentFullName returns the full name of a student
@@ -196,13 +339,13 @@ func (s *StudentService) GetStudentWithClassFullName(student *models.StudentWith
 }
 
 // GetStudentsByIDs retrieves multiple students by their IDs
-func (s *StudentService) GetStudentsByIDs(studentIDs []int) ([]*models.StudentWithClass, error) {
-	return s.repo.GetStudentsByIDs(studentIDs)
+func (s *StudentService) GetStudentsByIDs(ctx context.Context, studentIDs []int) ([]*models.StudentWithClass, error) {
+	return s.repo.GetStudentsByIDs(ctx, studentIDs)
 }
 
 // CanParentAddChild checks if a parent can add another child
-func (s *StudentService) CanParentAddChild(parentID int) (bool, error) {
-	count, err := s.repo.CountParentStudents(parentID)
+func (s *StudentService) CanParentAddChild(ctx context.Context, parentID int) (bool, error) {
+	count, err := s.repo.CountParentStudents(ctx, parentID)
 	if err != nil {
 		return false, err
 	}
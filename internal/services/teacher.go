@@ -1,9 +1,12 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
+	"parent-bot/internal/database"
 	"parent-bot/internal/models"
 	"parent-bot/internal/repository"
 	"parent-bot/internal/validator"
@@ -13,18 +16,23 @@ import (
 type TeacherService struct {
 	repo      *repository.TeacherRepository
 	classRepo *repository.ClassRepository
+	uow       *database.UnitOfWork
+	audit     *AuditService
 }
 
 // NewTeacherService creates a new teacher service
-func NewTeacherService(db *sql.DB) *TeacherService {
+func NewTeacherService(db *sql.DB, audit *AuditService) *TeacherService {
 	return &TeacherService{
 		repo:      repository.NewTeacherRepository(db),
 		classRepo: repository.NewClassRepository(db),
+		uow:       database.NewUnitOfWork(db),
+		audit:     audit,
 	}
 }
 
-// CreateTeacher creates a new teacher
-func (s *TeacherService) CreateTeacher(req *models.CreateTeacherRequest) (int64, error) {
+// CreateTeacher creates a new teacher and assigns the requested classes.
+// If any step fails, nothing is saved.
+func (s *TeacherService) CreateTeacher(ctx context.Context, req *models.CreateTeacherRequest) (int64, error) {
 	// Validate and normalize phone number
 	normalizedPhone, err := validator.ValidateUzbekPhone(req.PhoneNumber)
 	if err != nil {
@@ -32,39 +40,66 @@ func (s *TeacherService) CreateTeacher(req *models.CreateTeacherRequest) (int64,
 	}
 	req.PhoneNumber = normalizedPhone
 
-	// Check if teacher already exists
-	existing, _ := s.repo.GetByPhoneNumber(normalizedPhone)
-	if existing != nil {
-		return 0, fmt.Errorf("teacher with phone %s already exists", normalizedPhone)
+	var id int64
+	err = s.uow.Do(ctx, func(tx *sql.Tx) error {
+		teachers := s.repo.WithTx(tx)
+		classes := s.classRepo.WithTx(tx)
+
+		id, err = teachers.Create(ctx, req.FirstName, req.LastName, req.PhoneNumber, req.Language, req.AddedByAdminID)
+		if errors.Is(err, database.ErrDuplicate) {
+			return fmt.Errorf("teacher with phone %s already exists: %w", normalizedPhone, ErrConflict)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, classID := range req.ClassIDs {
+			class, err := classes.GetByID(ctx, classID)
+			if err != nil {
+				return err
+			}
+			if class == nil {
+				return fmt.Errorf("class %d %w", classID, ErrNotFound)
+			}
+
+			if err := teachers.AssignToClass(ctx, int(id), classID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	// Create teacher
-	return s.repo.Create(req.FirstName, req.LastName, req.PhoneNumber, req.Language, req.AddedByAdminID)
+	s.audit.Record(ctx, models.AuditEntityTeacher, "create", id, nil, req)
+	return id, nil
 }
 
 // GetTeacherByID retrieves a teacher by ID
-func (s *TeacherService) GetTeacherByID(id int) (*models.Teacher, error) {
-	return s.repo.GetByID(id)
+func (s *TeacherService) GetTeacherByID(ctx context.Context, id int) (*models.Teacher, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
 // GetTeacherByPhoneNumber retrieves a teacher by phone number
-func (s *TeacherService) GetTeacherByPhoneNumber(phoneNumber string) (*models.Teacher, error) {
+func (s *TeacherService) GetTeacherByPhoneNumber(ctx context.Context, phoneNumber string) (*models.Teacher, error) {
 	// Normalize phone first
 	normalizedPhone, err := validator.ValidateUzbekPhone(phoneNumber)
 	if err != nil {
 		return nil, fmt.Errorf("invalid phone number: %w", err)
 	}
 
-	return s.repo.GetByPhoneNumber(normalizedPhone)
+	return s.repo.GetByPhoneNumber(ctx, normalizedPhone)
 }
 
 // GetTeacherByTelegramID retrieves a teacher by Telegram ID
-func (s *TeacherService) GetTeacherByTelegramID(telegramID int64) (*models.Teacher, error) {
-	return s.repo.GetByTelegramID(telegramID)
+func (s *TeacherService) GetTeacherByTelegramID(ctx context.Context, telegramID int64) (*models.Teacher, error) {
+	return s.repo.GetByTelegramID(ctx, telegramID)
 }
 
 // LinkTelegramID links a Telegram account to a teacher
-func (s *TeacherService) LinkTelegramID(phoneNumber string, telegramID int64, language string) error {
+func (s *TeacherService) LinkTelegramID(ctx context.Context, phoneNumber string, telegramID int64, language string) error {
 	// Normalize phone first
 	normalizedPhone, err := validator.ValidateUzbekPhone(phoneNumber)
 	if err != nil {
@@ -72,109 +107,188 @@ func (s *TeacherService) LinkTelegramID(phoneNumber string, telegramID int64, la
 	}
 
 	// Check if teacher exists
-	teacher, err := s.repo.GetByPhoneNumber(normalizedPhone)
+	teacher, err := s.repo.GetByPhoneNumber(ctx, normalizedPhone)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("teacher not found with phone number %s", normalizedPhone)
-		}
 		return err
 	}
+	if teacher == nil {
+		return fmt.Errorf("teacher not found with phone number %s", normalizedPhone)
+	}
 
 	// Check if already linked to different telegram ID
 	if teacher.TelegramID != nil && *teacher.TelegramID != telegramID {
 		return fmt.Errorf("this phone number is already linked to another Telegram account")
 	}
 
-	return s.repo.LinkTelegramID(normalizedPhone, telegramID, language)
+	if err := s.repo.LinkTelegramID(ctx, normalizedPhone, telegramID, language); err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByID(ctx, teacher.ID)
+	s.audit.Record(ctx, models.AuditEntityTeacher, "link_telegram", teacher.ID, teacher, after)
+	return nil
+}
+
+// Register links the teacher's Telegram account, with its username, when
+// they first write to the bot
+func (s *TeacherService) Register(ctx context.Context, teacherID int, telegramID int64, username string) error {
+	before, err := s.repo.GetByID(ctx, teacherID)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return fmt.Errorf("teacher %d %w", teacherID, ErrNotFound)
+	}
+
+	if err := s.repo.UpdateTelegramID(ctx, teacherID, telegramID, username); err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByID(ctx, teacherID)
+	s.audit.Record(ctx, models.AuditEntityTeacher, "link_telegram", teacherID, before, after)
+	return nil
 }
 
 // UpdateTeacher updates teacher information
-func (s *TeacherService) UpdateTeacher(id int, req *models.UpdateTeacherRequest) error {
+func (s *TeacherService) UpdateTeacher(ctx context.Context, id int, req *models.UpdateTeacherRequest) error {
 	// Check if teacher exists
-	_, err := s.repo.GetByID(id)
+	before, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("teacher not found")
+			return fmt.Errorf("teacher %w", ErrNotFound)
 		}
 		return err
 	}
 
-	return s.repo.Update(id, req)
+	if err := s.repo.Update(ctx, id, req); err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityTeacher, "update", id, before, after)
+	return nil
 }
 
 // DeleteTeacher deletes a teacher
-func (s *TeacherService) DeleteTeacher(id int) error {
-	return s.repo.Delete(id)
+func (s *TeacherService) DeleteTeacher(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityTeacher, "delete", id, before, nil)
+	return nil
 }
 
 // DeactivateTeacher deactivates a teacher (soft delete)
-func (s *TeacherService) DeactivateTeacher(id int) error {
+func (s *TeacherService) DeactivateTeacher(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
 	isActive := false
-	return s.repo.Update(id, &models.UpdateTeacherRequest{
+	err := s.repo.Update(ctx, id, &models.UpdateTeacherRequest{
 		IsActive: &isActive,
 	})
+	if err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityTeacher, "deactivate", id, before, after)
+	return nil
 }
 
 // GetAllTeachers retrieves all teachers with pagination
-func (s *TeacherService) GetAllTeachers(limit, offset int) ([]*models.Teacher, error) {
-	return s.repo.GetAll(limit, offset)
+func (s *TeacherService) GetAllTeachers(ctx context.Context, limit, offset int) ([]*models.Teacher, error) {
+	return s.repo.GetAll(ctx, limit, offset)
+}
+
+// ListTeachers retrieves teachers matching a filter and the total number of matches
+func (s *TeacherService) ListTeachers(ctx context.Context, filter *models.TeacherFilter) ([]*models.Teacher, int, error) {
+	teachers, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.repo.CountFiltered(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return teachers, total, nil
 }
 
 // GetActiveTeachers retrieves all active teachers
-func (s *TeacherService) GetActiveTeachers() ([]*models.Teacher, error) {
-	return s.repo.GetActiveTeachers()
+func (s *TeacherService) GetActiveTeachers(ctx context.Context) ([]*models.Teacher, error) {
+	return s.repo.GetActiveTeachers(ctx)
 }
 
 // CountTeachers returns total number of teachers
-func (s *TeacherService) CountTeachers() (int, error) {
-	return s.repo.Count()
+func (s *TeacherService) CountTeachers(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
 }
 
 // AssignToClass assigns a teacher to a class
-func (s *TeacherService) AssignToClass(teacherID, classID int) error {
+func (s *TeacherService) AssignToClass(ctx context.Context, teacherID, classID int) error {
 	// Verify teacher exists
-	_, err := s.repo.GetByID(teacherID)
+	_, err := s.repo.GetByID(ctx, teacherID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("teacher not found")
+			return fmt.Errorf("teacher %w", ErrNotFound)
 		}
 		return err
 	}
 
 	// Verify class exists
-	_, err = s.classRepo.GetByID(classID)
+	class, err := s.classRepo.GetByID(ctx, classID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("class not found")
-		}
+		return err
+	}
+	if class == nil {
+		return fmt.Errorf("class %w", ErrNotFound)
+	}
+
+	if err := s.repo.AssignToClass(ctx, teacherID, classID); err != nil {
 		return err
 	}
 
-	return s.repo.AssignToClass(teacherID, classID)
+	s.audit.Record(ctx, models.AuditEntityTeacher, "assign_class", teacherID, nil, teacherClass{teacherID, classID})
+	return nil
 }
 
 // RemoveFromClass removes a teacher from a class
-func (s *TeacherService) RemoveFromClass(teacherID, classID int) error {
-	return s.repo.RemoveFromClass(teacherID, classID)
+func (s *TeacherService) RemoveFromClass(ctx context.Context, teacherID, classID int) error {
+	if err := s.repo.RemoveFromClass(ctx, teacherID, classID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityTeacher, "remove_class", teacherID, teacherClass{teacherID, classID}, nil)
+	return nil
+}
+
+// teacherClass is how a class assignment is recorded in the audit log
+type teacherClass struct {
+	TeacherID int `json:"teacher_id"`
+	ClassID   int `json:"class_id"`
 }
 
 // GetTeacherClasses retrieves all classes assigned to a teacher
-func (s *TeacherService) GetTeacherClasses(teacherID int) ([]*models.Class, error) {
-	return s.repo.GetTeacherClasses(teacherID)
+func (s *TeacherService) GetTeacherClasses(ctx context.Context, teacherID int) ([]*models.Class, error) {
+	return s.repo.GetTeacherClasses(ctx, teacherID)
 }
 
 // GetClassTeachers retrieves all teachers assigned to a class
-func (s *TeacherService) GetClassTeachers(classID int) ([]*models.Teacher, error) {
-	return s.repo.GetClassTeachers(classID)
+func (s *TeacherService) GetClassTeachers(ctx context.Context, classID int) ([]*models.Teacher, error) {
+	return s.repo.GetClassTeachers(ctx, classID)
 }
 
 // IsTeacherAssignedToClass checks if a teacher is assigned to a class
-func (s *TeacherService) IsTeacherAssignedToClass(teacherID, classID int) (bool, error) {
-	return s.repo.IsTeacherAssignedToClass(teacherID, classID)
+func (s *TeacherService) IsTeacherAssignedToClass(ctx context.Context, teacherID, classID int) (bool, error) {
+	return s.repo.IsTeacherAssignedToClass(ctx, teacherID, classID)
 }
 
 // IsTeacher checks if a phone number or telegram ID belongs to a teacher
-func (s *TeacherService) IsTeacher(phoneNumber string, telegramID int64) (bool, *models.Teacher, error) {
+func (s *TeacherService) IsTeacher(ctx context.Context, phoneNumber string, telegramID int64) (bool, *models.Teacher, error) {
 	// Normalize phone if provided
 	if phoneNumber != "" {
 		normalized, err := validator.ValidateUzbekPhone(phoneNumber)
@@ -183,7 +297,7 @@ func (s *TeacherService) IsTeacher(phoneNumber string, telegramID int64) (bool,
 		}
 	}
 
-	return s.repo.IsTeacher(phoneNumber, telegramID)
+	return s.repo.IsTeacher(ctx, phoneNumber, telegramID)
 }
 
 // GetTeacherFullName returns the full name of a teacher
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 
@@ -10,12 +11,13 @@ import (
 
 // TelegramService handles Telegram file operations
 type TelegramService struct {
-	bot *tgbotapi.BotAPI
+	bot    Messenger
+	logger *slog.Logger
 }
 
 // NewTelegramService creates a new Telegram service
-func NewTelegramService(bot *tgbotapi.BotAPI) *TelegramService {
-	return &TelegramService{bot: bot}
+func NewTelegramService(bot Messenger, logger *slog.Logger) *TelegramService {
+	return &TelegramService{bot: bot, logger: logger}
 }
 
 // UploadDocument uploads a document to Telegram and returns file_id
@@ -26,7 +28,8 @@ func (s *TelegramService) UploadDocument(chatID int64, docPath, filename string)
 	if err != nil {
 		return "", fmt.Errorf("failed to stat file: %w", err)
 	}
-	fmt.Printf("[DEBUG] Uploading file: %s, size: %d bytes\n", filename, fileInfo.Size())
+	logger := s.logger.With("chat_id", chatID, "file", filename)
+	logger.Debug("uploading document", "size", fileInfo.Size())
 
 	// Open the file
 	file, err := os.Open(docPath)
@@ -42,7 +45,6 @@ func (s *TelegramService) UploadDocument(chatID int64, docPath, filename string)
 	})
 
 	// Send document
-	fmt.Printf("[DEBUG] Sending document to Telegram...\n")
 	msg, err := s.bot.Send(doc)
 	if err != nil {
 		return "", fmt.Errorf("failed to upload document: %w", err)
@@ -50,8 +52,7 @@ func (s *TelegramService) UploadDocument(chatID int64, docPath, filename string)
 
 	// Extract file_id from message
 	if msg.Document != nil {
-		fmt.Printf("[DEBUG] Document uploaded successfully, file_id: %s, file_size: %d\n",
-			msg.Document.FileID, msg.Document.FileSize)
+		logger.Debug("document uploaded", "file_id", msg.Document.FileID, "size", msg.Document.FileSize)
 		return msg.Document.FileID, nil
 	}
 
@@ -71,6 +72,12 @@ func (s *TelegramService) SendDocumentByFileID(chatID int64, fileID, caption str
 	return nil
 }
 
+// Send sends a prepared message, photo, document or edit that the helpers
+// below don't cover
+func (s *TelegramService) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return s.bot.Send(c)
+}
+
 // SendMessage sends a text message
 func (s *TelegramService) SendMessage(chatID int64, text string, replyMarkup interface{}) error {
 	msg := tgbotapi.NewMessage(chatID, text)
@@ -139,13 +146,11 @@ func (s *TelegramService) GetFile(fileID string) (*tgbotapi.File, error) {
 
 // DownloadFile downloads a file from Telegram
 func (s *TelegramService) DownloadFile(fileID, savePath string) error {
-	file, err := s.GetFile(fileID)
+	link, err := s.bot.GetFileDirectURL(fileID)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to get file: %w", err)
 	}
 
-	link := file.Link(s.bot.Token)
-
 	// Download file using http client
 	client := &http.Client{}
 	resp, err := client.Get(link)
@@ -175,7 +180,7 @@ func (s *TelegramService) NotifyAdmins(adminTelegramIDs []int64, message string)
 		err := s.SendMessage(adminID, message, nil)
 		if err != nil {
 			// Log error but continue notifying other admins
-			fmt.Printf("Failed to notify admin %d: %v\n", adminID, err)
+			s.logger.Warn("failed to notify admin", "admin_telegram_id", adminID, "error", err)
 		}
 	}
 
@@ -188,7 +193,7 @@ func (s *TelegramService) SendDocumentToAdmins(adminTelegramIDs []int64, fileID,
 		err := s.SendDocumentByFileID(adminID, fileID, caption)
 		if err != nil {
 			// Log error but continue sending to other admins
-			fmt.Printf("Failed to send document to admin %d: %v\n", adminID, err)
+			s.logger.Warn("failed to send document to admin", "admin_telegram_id", adminID, "error", err)
 		}
 	}
 
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -12,20 +13,22 @@ import (
 type TestResultService struct {
 	repo        *repository.TestResultRepository
 	studentRepo *repository.StudentRepository
+	audit       *AuditService
 }
 
 // NewTestResultService creates a new test result service
-func NewTestResultService(db *sql.DB) *TestResultService {
+func NewTestResultService(db *sql.DB, audit *AuditService) *TestResultService {
 	return &TestResultService{
 		repo:        repository.NewTestResultRepository(db),
 		studentRepo: repository.NewStudentRepository(db),
+		audit:       audit,
 	}
 }
 
 // CreateTestResult creates a new test result
-func (s *TestResultService) CreateTestResult(req *models.CreateTestResultRequest) (int64, error) {
+func (s *TestResultService) CreateTestResult(ctx context.Context, req *models.CreateTestResultRequest) (int64, error) {
 	// Verify student exists
-	_, err := s.studentRepo.GetByID(req.StudentID)
+	_, err := s.studentRepo.GetByID(ctx, req.StudentID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, fmt.Errorf("student not found")
@@ -38,38 +41,44 @@ func (s *TestResultService) CreateTestResult(req *models.CreateTestResultRequest
 		return 0, fmt.Errorf("either teacher or admin must be specified")
 	}
 
-	return s.repo.Create(req)
+	id, err := s.repo.Create(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityTestResult, "create", id, nil, req)
+	return id, nil
 }
 
 // GetTestResultByID retrieves a test result by ID
-func (s *TestResultService) GetTestResultByID(id int) (*models.TestResult, error) {
-	return s.repo.GetByID(id)
+func (s *TestResultService) GetTestResultByID(ctx context.Context, id int) (*models.TestResult, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
 // GetTestResultsByStudentID retrieves all test results for a student
-func (s *TestResultService) GetTestResultsByStudentID(studentID int, limit, offset int) ([]*models.TestResultDetailed, error) {
-	return s.repo.GetByStudentID(studentID, limit, offset)
+func (s *TestResultService) GetTestResultsByStudentID(ctx context.Context, studentID int, limit, offset int) ([]*models.TestResultDetailed, error) {
+	return s.repo.GetByStudentID(ctx, studentID, limit, offset)
 }
 
 // GetTestResultsByClassID retrieves all test results for a class
-func (s *TestResultService) GetTestResultsByClassID(classID int, limit, offset int) ([]*models.TestResultDetailed, error) {
-	return s.repo.GetByClassID(classID, limit, offset)
+func (s *TestResultService) GetTestResultsByClassID(ctx context.Context, classID int, limit, offset int) ([]*models.TestResultDetailed, error) {
+	return s.repo.GetByClassID(ctx, classID, limit, offset)
 }
 
 // GetTestResultsByClassIDAndDateRange retrieves test results for a class within a date range
-func (s *TestResultService) GetTestResultsByClassIDAndDateRange(classID int, startDate, endDate string, limit, offset int) ([]*models.TestResultDetailed, error) {
-	return s.repo.GetByClassIDAndDateRange(classID, startDate, endDate, limit, offset)
+func (s *TestResultService) GetTestResultsByClassIDAndDateRange(ctx context.Context, classID int, startDate, endDate string, limit, offset int) ([]*models.TestResultDetailed, error) {
+	return s.repo.GetByClassIDAndDateRange(ctx, classID, startDate, endDate, limit, offset)
 }
 
 // GetAllTestResultsByClassID retrieves all test results for a class without pagination (for export)
-func (s *TestResultService) GetAllTestResultsByClassID(classID int) ([]*models.TestResultDetailed, error) {
-	return s.repo.GetAllByClassID(classID)
+func (s *TestResultService) GetAllTestResultsByClassID(ctx context.Context, classID int) ([]*models.TestResultDetailed, error) {
+	return s.repo.GetAllByClassID(ctx, classID)
 }
 
 // UpdateTestResult updates a test result
-func (s *TestResultService) UpdateTestResult(id int, req *models.UpdateTestResultRequest) error {
+func (s *TestResultService) UpdateTestResult(ctx context.Context, id int, req *models.UpdateTestResultRequest) error {
 	// Check if test result exists
-	_, err := s.repo.GetByID(id)
+	before, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return fmt.Errorf("test result not found")
@@ -77,33 +86,46 @@ func (s *TestResultService) UpdateTestResult(id int, req *models.UpdateTestResul
 		return err
 	}
 
-	return s.repo.Update(id, req)
+	if err := s.repo.Update(ctx, id, req); err != nil {
+		return err
+	}
+
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, models.AuditEntityTestResult, "update", id, before, after)
+	return nil
 }
 
 // DeleteTestResult deletes a test result (admin only)
-func (s *TestResultService) DeleteTestResult(id int) error {
-	return s.repo.Delete(id)
+func (s *TestResultService) DeleteTestResult(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, models.AuditEntityTestResult, "delete", id, before, nil)
+	return nil
 }
 
 // CountTestResults returns total number of test results
-func (s *TestResultService) CountTestResults() (int, error) {
-	return s.repo.Count()
+func (s *TestResultService) CountTestResults(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
 }
 
 // CountTestResultsByStudent returns number of test results for a student
-func (s *TestResultService) CountTestResultsByStudent(studentID int) (int, error) {
-	return s.repo.CountByStudent(studentID)
+func (s *TestResultService) CountTestResultsByStudent(ctx context.Context, studentID int) (int, error) {
+	return s.repo.CountByStudent(ctx, studentID)
 }
 
 // GetLatestTestResultsByStudent retrieves the most recent test results for a student
-func (s *TestResultService) GetLatestTestResultsByStudent(studentID int, limit int) ([]*models.TestResultDetailed, error) {
-	return s.repo.GetLatestByStudent(studentID, limit)
+func (s *TestResultService) GetLatestTestResultsByStudent(ctx context.Context, studentID int, limit int) ([]*models.TestResultDetailed, error) {
+	return s.repo.GetLatestByStudent(ctx, studentID, limit)
 }
 
 // GetTestResultsForParent retrieves test results for a parent's selected child
-func (s *TestResultService) GetTestResultsForParent(parentID int, currentStudentID int, limit, offset int) ([]*models.TestResultDetailed, error) {
+func (s *TestResultService) GetTestResultsForParent(ctx context.Context, parentID int, currentStudentID int, limit, offset int) ([]*models.TestResultDetailed, error) {
 	// Verify student is linked to parent
-	isLinked, err := s.studentRepo.IsStudentLinkedToParent(parentID, currentStudentID)
+	isLinked, err := s.studentRepo.IsStudentLinkedToParent(ctx, parentID, currentStudentID)
 	if err != nil {
 		return nil, err
 	}
@@ -111,5 +133,5 @@ func (s *TestResultService) GetTestResultsForParent(parentID int, currentStudent
 		return nil, fmt.Errorf("student is not linked to this parent")
 	}
 
-	return s.repo.GetByStudentID(currentStudentID, limit, offset)
+	return s.repo.GetByStudentID(ctx, currentStudentID, limit, offset)
 }
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 
 	"parent-bot/internal/models"
@@ -11,20 +12,22 @@ import (
 type TimetableService struct {
 	repo      *repository.TimetableRepository
 	classRepo *repository.ClassRepository
+	audit     *AuditService
 }
 
 // NewTimetableService creates a new timetable service
-func NewTimetableService(repo *repository.TimetableRepository, classRepo *repository.ClassRepository) *TimetableService {
+func NewTimetableService(repo *repository.TimetableRepository, classRepo *repository.ClassRepository, audit *AuditService) *TimetableService {
 	return &TimetableService{
 		repo:      repo,
 		classRepo: classRepo,
+		audit:     audit,
 	}
 }
 
 // CreateTimetable creates a new timetable
-func (s *TimetableService) CreateTimetable(req *models.CreateTimetableRequest) (*models.Timetable, error) {
+func (s *TimetableService) CreateTimetable(ctx context.Context, req *models.CreateTimetableRequest) (*models.Timetable, error) {
 	// Validate that class exists
-	class, err := s.classRepo.GetByID(req.ClassID)
+	class, err := s.classRepo.GetByID(ctx, req.ClassID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get class: %w", err)
 	}
@@ -32,17 +35,18 @@ func (s *TimetableService) CreateTimetable(req *models.CreateTimetableRequest) (
 		return nil, fmt.Errorf("class not found")
 	}
 
-	timetable, err := s.repo.Create(req)
+	timetable, err := s.repo.Create(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create timetable: %w", err)
 	}
 
+	s.audit.Record(ctx, models.AuditEntityTimetable, "create", timetable.ID, nil, timetable)
 	return timetable, nil
 }
 
 // GetTimetableByID gets timetable by ID
-func (s *TimetableService) GetTimetableByID(id int) (*models.Timetable, error) {
-	timetable, err := s.repo.GetByID(id)
+func (s *TimetableService) GetTimetableByID(ctx context.Context, id int) (*models.Timetable, error) {
+	timetable, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get timetable: %w", err)
 	}
@@ -51,8 +55,8 @@ func (s *TimetableService) GetTimetableByID(id int) (*models.Timetable, error) {
 }
 
 // GetTimetableByClassID gets the latest timetable for a class
-func (s *TimetableService) GetTimetableByClassID(classID int) (*models.Timetable, error) {
-	timetable, err := s.repo.GetByClassID(classID)
+func (s *TimetableService) GetTimetableByClassID(ctx context.Context, classID int) (*models.Timetable, error) {
+	timetable, err := s.repo.GetByClassID(ctx, classID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get timetable by class: %w", err)
 	}
@@ -61,8 +65,8 @@ func (s *TimetableService) GetTimetableByClassID(classID int) (*models.Timetable
 }
 
 // GetTimetableByClassName gets the latest timetable for a class by name
-func (s *TimetableService) GetTimetableByClassName(className string) (*models.Timetable, error) {
-	timetable, err := s.repo.GetByClassName(className)
+func (s *TimetableService) GetTimetableByClassName(ctx context.Context, className string) (*models.Timetable, error) {
+	timetable, err := s.repo.GetByClassName(ctx, className)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get timetable by class name: %w", err)
 	}
@@ -71,8 +75,8 @@ func (s *TimetableService) GetTimetableByClassName(className string) (*models.Ti
 }
 
 // GetAllTimetables gets all timetables with pagination
-func (s *TimetableService) GetAllTimetables(limit, offset int) ([]*models.Timetable, error) {
-	timetables, err := s.repo.GetAll(limit, offset)
+func (s *TimetableService) GetAllTimetables(ctx context.Context, limit, offset int) ([]*models.Timetable, error) {
+	timetables, err := s.repo.GetAll(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get timetables: %w", err)
 	}
@@ -81,38 +85,50 @@ func (s *TimetableService) GetAllTimetables(limit, offset int) ([]*models.Timeta
 }
 
 // UpdateTimetable updates an existing timetable
-func (s *TimetableService) UpdateTimetable(id int, req *models.CreateTimetableRequest) (*models.Timetable, error) {
-	timetable, err := s.repo.Update(id, req)
+func (s *TimetableService) UpdateTimetable(ctx context.Context, id int, req *models.CreateTimetableRequest) (*models.Timetable, error) {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	timetable, err := s.repo.Update(ctx, id, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update timetable: %w", err)
 	}
 
+	s.audit.Record(ctx, models.AuditEntityTimetable, "update", id, before, timetable)
 	return timetable, nil
 }
 
 // DeleteTimetable deletes a timetable
-func (s *TimetableService) DeleteTimetable(id int) error {
-	err := s.repo.Delete(id)
+func (s *TimetableService) DeleteTimetable(ctx context.Context, id int) error {
+	before, _ := s.repo.GetByID(ctx, id)
+
+	err := s.repo.Delete(ctx, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete timetable: %w", err)
 	}
 
+	s.audit.Record(ctx, models.AuditEntityTimetable, "delete", id, before, nil)
 	return nil
 }
 
 // DeleteTimetablesByClassID deletes all timetables for a class
-func (s *TimetableService) DeleteTimetablesByClassID(classID int) error {
-	err := s.repo.DeleteByClassID(classID)
+func (s *TimetableService) DeleteTimetablesByClassID(ctx context.Context, classID int) error {
+	err := s.repo.DeleteByClassID(ctx, classID)
 	if err != nil {
 		return fmt.Errorf("failed to delete timetables for class: %w", err)
 	}
 
+	s.audit.Record(ctx, models.AuditEntityTimetable, "delete_class", nil, classTimetables{classID}, nil)
 	return nil
 }
 
+// classTimetables is how deleting a class's timetables is recorded in the audit log
+type classTimetables struct {
+	ClassID int `json:"class_id"`
+}
+
 // CountTimetables counts total timetables
-func (s *TimetableService) CountTimetables() (int, error) {
-	count, err := s.repo.Count()
+func (s *TimetableService) CountTimetables(ctx context.Context) (int, error) {
+	count, err := s.repo.Count(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count timetables: %w", err)
 	}
@@ -121,8 +137,8 @@ func (s *TimetableService) CountTimetables() (int, error) {
 }
 
 // TimetableExists checks if a timetable exists for a class
-func (s *TimetableService) TimetableExists(classID int) (bool, error) {
-	exists, err := s.repo.Exists(classID)
+func (s *TimetableService) TimetableExists(ctx context.Context, classID int) (bool, error) {
+	exists, err := s.repo.Exists(ctx, classID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check timetable existence: %w", err)
 	}
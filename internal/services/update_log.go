@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"parent-bot/internal/repository"
+)
+
+// updateRetentionHours matches how long Telegram keeps undelivered updates
+const updateRetentionHours = 24
+
+// UpdateLogService deduplicates Telegram updates by update_id
+type UpdateLogService struct {
+	repo      *repository.ProcessedUpdateRepository
+	logger    *slog.Logger
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewUpdateLogService creates a new update log service
+func NewUpdateLogService(repo *repository.ProcessedUpdateRepository, logger *slog.Logger) *UpdateLogService {
+	return &UpdateLogService{repo: repo, logger: logger}
+}
+
+// MarkReceived records an update ID and reports whether it is new.
+// Errors are logged and treated as "new" so updates are never lost.
+func (s *UpdateLogService) MarkReceived(ctx context.Context, updateID int) bool {
+	s.pruneIfDue(ctx)
+
+	isNew, err := s.repo.Mark(ctx, updateID)
+	if err != nil {
+		s.logger.Warn("failed to record update", "update_id", updateID, "error", err)
+		return true
+	}
+
+	return isNew
+}
+
+// Forget removes an update ID, e.g. when it was received but could not be queued
+func (s *UpdateLogService) Forget(ctx context.Context, updateID int) {
+	if err := s.repo.Unmark(ctx, updateID); err != nil {
+		s.logger.Warn("failed to forget update", "update_id", updateID, "error", err)
+	}
+}
+
+// pruneIfDue deletes old records at most once an hour
+func (s *UpdateLogService) pruneIfDue(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastPrune) < time.Hour {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPrune = time.Now()
+	s.mu.Unlock()
+
+	if _, err := s.repo.DeleteOlderThan(ctx, updateRetentionHours); err != nil {
+		s.logger.Warn("failed to prune processed updates", "error", err)
+	}
+}
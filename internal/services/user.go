@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 
 	"parent-bot/internal/models"
@@ -9,18 +10,19 @@ import (
 
 // UserService handles user-related business logic
 type UserService struct {
-	repo *repository.UserRepository
+	repo  *repository.UserRepository
+	audit *AuditService
 }
 
 // NewUserService creates a new user service
-func NewUserService(repo *repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(repo *repository.UserRepository, audit *AuditService) *UserService {
+	return &UserService{repo: repo, audit: audit}
 }
 
 // CreateUser creates a new user
-func (s *UserService) CreateUser(req *models.CreateUserRequest) (*models.User, error) {
+func (s *UserService) CreateUser(ctx context.Context, req *models.CreateUserRequest) (*models.User, error) {
 	// Check if user already exists
-	existing, err := s.repo.GetByTelegramID(req.TelegramID)
+	existing, err := s.repo.GetByTelegramID(ctx, req.TelegramID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check existing user: %w", err)
 	}
@@ -30,7 +32,7 @@ func (s *UserService) CreateUser(req *models.CreateUserRequest) (*models.User, e
 	}
 
 	// Check if phone number is already used
-	existingPhone, err := s.repo.GetByPhoneNumber(req.PhoneNumber)
+	existingPhone, err := s.repo.GetByPhoneNumber(ctx, req.PhoneNumber)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check existing phone: %w", err)
 	}
@@ -40,17 +42,18 @@ func (s *UserService) CreateUser(req *models.CreateUserRequest) (*models.User, e
 	}
 
 	// Create user
-	user, err := s.repo.Create(req)
+	user, err := s.repo.Create(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	s.audit.Record(ctx, models.AuditEntityParent, "create", user.ID, nil, user)
 	return user, nil
 }
 
 // GetUserByTelegramID gets user by telegram ID
-func (s *UserService) GetUserByTelegramID(telegramID int64) (*models.User, error) {
-	user, err := s.repo.GetByTelegramID(telegramID)
+func (s *UserService) GetUserByTelegramID(ctx context.Context, telegramID int64) (*models.User, error) {
+	user, err := s.repo.GetByTelegramID(ctx, telegramID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -59,8 +62,8 @@ func (s *UserService) GetUserByTelegramID(telegramID int64) (*models.User, error
 }
 
 // GetUserByPhoneNumber gets user by phone number
-func (s *UserService) GetUserByPhoneNumber(phoneNumber string) (*models.User, error) {
-	user, err := s.repo.GetByPhoneNumber(phoneNumber)
+func (s *UserService) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*models.User, error) {
+	user, err := s.repo.GetByPhoneNumber(ctx, phoneNumber)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -69,8 +72,8 @@ func (s *UserService) GetUserByPhoneNumber(phoneNumber string) (*models.User, er
 }
 
 // GetUserByID gets user by ID
-func (s *UserService) GetUserByID(id int) (*models.User, error) {
-	user, err := s.repo.GetByID(id)
+func (s *UserService) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	user, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -79,19 +82,22 @@ func (s *UserService) GetUserByID(id int) (*models.User, error) {
 }
 
 // UpdateUser updates user information
-func (s *UserService) UpdateUser(userID int, req *models.UpdateUserRequest) error {
-	err := s.repo.Update(userID, req)
+func (s *UserService) UpdateUser(ctx context.Context, userID int, req *models.UpdateUserRequest) error {
+	before, err := s.repo.GetByID(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if before == nil {
+		return fmt.Errorf("user not found")
 	}
 
-	return nil
+	return s.update(ctx, before, req)
 }
 
 // UpdateUserByTelegramID updates user information by telegram ID
-func (s *UserService) UpdateUserByTelegramID(telegramID int64, req *models.UpdateUserRequest) error {
+func (s *UserService) UpdateUserByTelegramID(ctx context.Context, telegramID int64, req *models.UpdateUserRequest) error {
 	// Get user first to get the ID
-	user, err := s.repo.GetByTelegramID(telegramID)
+	user, err := s.repo.GetByTelegramID(ctx, telegramID)
 	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
@@ -99,17 +105,23 @@ func (s *UserService) UpdateUserByTelegramID(telegramID int64, req *models.Updat
 		return fmt.Errorf("user not found")
 	}
 
-	err = s.repo.Update(user.ID, req)
-	if err != nil {
+	return s.update(ctx, user, req)
+}
+
+// update applies req to a user read as before and records the change
+func (s *UserService) update(ctx context.Context, before *models.User, req *models.UpdateUserRequest) error {
+	if err := s.repo.Update(ctx, before.ID, req); err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
+	after, _ := s.repo.GetByID(ctx, before.ID)
+	s.audit.Record(ctx, models.AuditEntityParent, "update", before.ID, before, after)
 	return nil
 }
 
 // GetAllUsers gets all users with pagination
-func (s *UserService) GetAllUsers(limit, offset int) ([]*models.User, error) {
-	users, err := s.repo.GetAll(limit, offset)
+func (s *UserService) GetAllUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	users, err := s.repo.GetAll(ctx, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
@@ -118,8 +130,8 @@ func (s *UserService) GetAllUsers(limit, offset int) ([]*models.User, error) {
 }
 
 // GetParentsByClassID gets all parents who have children in a specific class
-func (s *UserService) GetParentsByClassID(classID int) ([]*models.User, error) {
-	users, err := s.repo.GetParentsByClassID(classID)
+func (s *UserService) GetParentsByClassID(ctx context.Context, classID int) ([]*models.User, error) {
+	users, err := s.repo.GetParentsByClassID(ctx, classID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get parents by class: %w", err)
 	}
@@ -127,9 +139,9 @@ func (s *UserService) GetParentsByClassID(classID int) ([]*models.User, error) {
 	return users, nil
 }
 
-// GetParentsByClassIDs gets all parents who have children in any of the specified classes
-func (s *UserService) GetParentsByClassIDs(classIDs []int) ([]*models.User, error) {
-	users, err := s.repo.GetParentsByClassIDs(classIDs)
+// GetParentsByClassIDs gets a page of parents who have children in any of the specified classes
+func (s *UserService) GetParentsByClassIDs(ctx context.Context, classIDs []int, afterID, limit int) ([]*models.User, error) {
+	users, err := s.repo.GetParentsByClassIDs(ctx, classIDs, afterID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get parents by classes: %w", err)
 	}
@@ -138,8 +150,8 @@ func (s *UserService) GetParentsByClassIDs(classIDs []int) ([]*models.User, erro
 }
 
 // CountUsers counts total users
-func (s *UserService) CountUsers() (int, error) {
-	count, err := s.repo.Count()
+func (s *UserService) CountUsers(ctx context.Context) (int, error) {
+	count, err := s.repo.Count(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count users: %w", err)
 	}
@@ -148,8 +160,8 @@ func (s *UserService) CountUsers() (int, error) {
 }
 
 // IsUserRegistered checks if user is registered
-func (s *UserService) IsUserRegistered(telegramID int64) (bool, error) {
-	exists, err := s.repo.Exists(telegramID)
+func (s *UserService) IsUserRegistered(ctx context.Context, telegramID int64) (bool, error) {
+	exists, err := s.repo.Exists(ctx, telegramID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check user registration: %w", err)
 	}
@@ -0,0 +1,139 @@
+package state
+
+import (
+	"container/list"
+	"time"
+
+	"parent-bot/internal/models"
+)
+
+// CacheStats describes the state cache
+type CacheStats struct {
+	Size      int    // cached users
+	Hits      uint64 // reads served from the cache
+	Misses    uint64 // reads that went to the database
+	Evictions uint64 // entries dropped to stay within the size limit
+}
+
+// cache keeps the most recently used states in memory. Entries are read again
+// from the database once they are older than ttl, so changes made by another
+// bot instance show up. Users with an update in flight are pinned: their entry
+// is not evicted, as it holds the revision the update's writes are checked
+// against, and an entry read before the pin is read again, as another
+// instance may have changed the row since. The manager's mutex guards the
+// cache.
+type cache struct {
+	size    int
+	ttl     time.Duration
+	order   *list.List              // most recently used first
+	entries map[int64]*list.Element // values are *cacheEntry
+	pins    map[int64]int           // in-flight updates per user
+	stats   CacheStats
+}
+
+// cacheEntry is a cached read of one user's row
+type cacheEntry struct {
+	telegramID int64
+	state      *models.UserState // nil: the user has no saved state
+	loadedAt   time.Time
+	pinned     bool // read or written while the user was pinned
+}
+
+func newCache(size int, ttl time.Duration) *cache {
+	return &cache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[int64]*list.Element),
+		pins:    make(map[int64]int),
+	}
+}
+
+// get returns the user's cached entry, counting a hit or a miss. Entries
+// older than ttl are misses, and so are entries of a pinned user that were
+// read before the pin.
+func (c *cache) get(telegramID int64, now time.Time) (*cacheEntry, bool) {
+	el, ok := c.entries[telegramID]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if now.Sub(entry.loadedAt) >= c.ttl || (c.pins[telegramID] > 0 && !entry.pinned) {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	c.stats.Hits++
+	return entry, true
+}
+
+// peek returns the user's entry whatever its age, without counting a read
+func (c *cache) peek(telegramID int64) (*cacheEntry, bool) {
+	el, ok := c.entries[telegramID]
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(*cacheEntry), true
+}
+
+// put caches the user's state, nil for none, then evicts the least recently
+// used unpinned entries while the cache is over its size
+func (c *cache) put(telegramID int64, st *models.UserState, now time.Time) {
+	entry := &cacheEntry{telegramID: telegramID, state: st, loadedAt: now, pinned: c.pins[telegramID] > 0}
+
+	if el, ok := c.entries[telegramID]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+	} else {
+		c.entries[telegramID] = c.order.PushFront(entry)
+	}
+
+	for el := c.order.Back(); el != nil && c.order.Len() > c.size; {
+		prev := el.Prev()
+		if id := el.Value.(*cacheEntry).telegramID; c.pins[id] == 0 {
+			c.order.Remove(el)
+			delete(c.entries, id)
+			c.stats.Evictions++
+		}
+		el = prev
+	}
+}
+
+// remove drops the user's entry
+func (c *cache) remove(telegramID int64) {
+	if el, ok := c.entries[telegramID]; ok {
+		c.order.Remove(el)
+		delete(c.entries, telegramID)
+	}
+}
+
+// clear drops every unpinned entry
+func (c *cache) clear() {
+	for id, el := range c.entries {
+		if c.pins[id] == 0 {
+			c.order.Remove(el)
+			delete(c.entries, id)
+		}
+	}
+}
+
+// pin keeps the user's entry from being evicted until unpin
+func (c *cache) pin(telegramID int64) {
+	c.pins[telegramID]++
+}
+
+// unpin ends one pin. Once the last one ends, the entry is no longer a read
+// of an update in flight.
+func (c *cache) unpin(telegramID int64) {
+	if c.pins[telegramID] <= 1 {
+		delete(c.pins, telegramID)
+		if el, ok := c.entries[telegramID]; ok {
+			el.Value.(*cacheEntry).pinned = false
+		}
+		return
+	}
+	c.pins[telegramID]--
+}
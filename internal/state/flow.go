@@ -0,0 +1,114 @@
+package state
+
+import (
+	"encoding/json"
+
+	"parent-bot/internal/models"
+)
+
+// Flow is a conversation that spans several messages, such as writing a
+// complaint. While the user is in one of its states, the flow's data is
+// kept as one struct of its own type.
+type Flow struct {
+	Name    string
+	Version int        // bumped when the data struct changes shape
+	States  []string   // states that belong to the flow
+	New     func() any // returns a pointer to empty data
+
+	// Upgrade rewrites data saved by an earlier version of the flow so it
+	// decodes into the current struct; optional. Version 0 is data saved
+	// before flows existed, as one catch-all object. Flows without Upgrade
+	// decode data of any earlier version as is, which is safe while fields
+	// are only added.
+	Upgrade func(from int, data json.RawMessage) (json.RawMessage, error)
+}
+
+// newFlow describes a flow whose data is a T
+func newFlow[T any](name string, version int, states ...string) Flow {
+	return Flow{
+		Name:    name,
+		Version: version,
+		States:  states,
+		New:     func() any { return new(T) },
+	}
+}
+
+// noData is the data of flows that keep nothing between messages
+type noData struct{}
+
+// flows are the built-in conversation flows
+var flows = []Flow{
+	newFlow[models.RegistrationData]("registration", 1,
+		models.StateAwaitingLanguage,
+		models.StateAwaitingPhone,
+		models.StateAwaitingChildName,
+		models.StateAwaitingChildClass,
+	),
+	newFlow[models.ChildData]("link_child", 1,
+		models.StateSelectingClass,
+		models.StateSelectingChild,
+		models.StateAddingChild,
+		models.StateSelectingChildFromClass,
+	),
+	newFlow[models.ComplaintData]("complaint", 1,
+		models.StateSelectingChildForComplaint,
+		models.StateAwaitingComplaint,
+		models.StateConfirmingComplaint,
+	),
+	newFlow[models.ProposalData]("proposal", 1,
+		models.StateSelectingChildForProposal,
+		models.StateAwaitingProposal,
+		models.StateConfirmingProposal,
+	),
+	newFlow[noData]("admin_link", 1,
+		models.StateAwaitingAdminPhone,
+	),
+	newFlow[noData]("class_create", 1,
+		models.StateAwaitingClassName,
+	),
+	newFlow[models.TimetableData]("timetable_upload", 1,
+		models.StateAwaitingTimetableFile,
+	),
+	newFlow[models.AnnouncementData]("announcement", 1,
+		models.StateAwaitingAnnouncementContent,
+		models.StateAwaitingAnnouncementFile,
+		models.StateTeacherSelectingAnnouncementClasses,
+		models.StateTeacherAwaitingAnnouncementContent,
+		models.StateTeacherAwaitingAnnouncementFile,
+	),
+	newFlow[models.AnnouncementEditData]("announcement_edit", 1,
+		models.StateAwaitingEditedAnnouncementContent,
+		models.StateTeacherEditingAnnouncementContent,
+	),
+	newFlow[models.TeacherData]("teacher_create", 1,
+		models.StateAwaitingTeacherFullName,
+		models.StateAwaitingTeacherPhone,
+	),
+	newFlow[models.StudentData]("student_create", 1,
+		models.StateAwaitingStudentInfo,
+		models.StateAwaitingAdminStudentName,
+		models.StateTeacherAwaitingStudentName,
+	),
+	newFlow[noData]("parent_link", 1,
+		models.StateAwaitingLinkInfo,
+	),
+	newFlow[noData]("parent_lookup", 1,
+		models.StateAwaitingParentPhoneForView,
+	),
+	newFlow[models.AttendanceData]("attendance", 1,
+		models.StateTakingAttendance,
+		models.StateAwaitingAttendanceInfo,
+	),
+	newFlow[models.TestResultData]("test_results", 1,
+		models.StateAwaitingTestResultInfo,
+		models.StateTeacherAwaitingTestResultsText,
+	),
+	newFlow[models.ExportData]("grade_export", 1,
+		models.StateAwaitingExportCustomDates,
+	),
+}
+
+// idle reports whether a state is outside any flow
+func idle(state string) bool {
+	return state == models.StateStart || state == models.StateRegistered
+}
@@ -1,169 +1,506 @@
 package state
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"reflect"
 	"sync"
+	"time"
 
+	"parent-bot/internal/config"
+	"parent-bot/internal/database"
 	"parent-bot/internal/models"
 )
 
+// ErrConflict is returned when a user's state was changed since it was read,
+// by another update from the same user or by another bot instance
+var ErrConflict = errors.New("state changed since it was read")
+
 // Manager manages user conversation states
 type Manager struct {
-	db    *sql.DB
-	cache map[int64]*models.UserState // In-memory cache for faster access
-	mu    sync.RWMutex
+	db      *sql.DB
+	dialect database.Dialect
+	ttl     time.Duration // unfinished flows expire this long after their last step
+	logger  *slog.Logger
+	flows   map[string]*Flow // registered flows by name
+	byState map[string]*Flow // registered flows by state
+	cache   *cache           // recently used states and the revisions they were read at
+	mu      sync.RWMutex
 }
 
-// NewManager creates a new state manager
-func NewManager(db *sql.DB) *Manager {
-	return &Manager{
-		db:    db,
-		cache: make(map[int64]*models.UserState),
+// NewManager creates a new state manager with the built-in flows registered
+func NewManager(db *sql.DB, cfg config.UpdatesConfig, logger *slog.Logger) *Manager {
+	m := &Manager{
+		db:      db,
+		dialect: database.DialectOf(db),
+		ttl:     cfg.FlowTTL,
+		logger:  logger.With("component", "state"),
+		flows:   make(map[string]*Flow),
+		byState: make(map[string]*Flow),
+		cache:   newCache(cfg.StateCacheSize, cfg.StateCacheTTL),
+	}
+
+	for _, flow := range flows {
+		if err := m.Register(flow); err != nil {
+			panic(err)
+		}
 	}
+
+	return m
 }
 
-// Set sets user state
-func (m *Manager) Set(telegramID int64, state string, data *models.StateData) error {
+// Register adds a flow. Flow names and states must not be registered yet.
+func (m *Manager) Register(flow Flow) error {
+	if flow.Name == "" || flow.New == nil || len(flow.States) == 0 {
+		return fmt.Errorf("flow %q needs a name, a data constructor and states", flow.Name)
+	}
+	if flow.Version < 1 {
+		return fmt.Errorf("flow %q: version must be at least 1, got %d", flow.Name, flow.Version)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	dataJSON, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal state data: %w", err)
+	if _, ok := m.flows[flow.Name]; ok {
+		return fmt.Errorf("flow %q already registered", flow.Name)
+	}
+	for _, state := range flow.States {
+		if idle(state) {
+			return fmt.Errorf("flow %q: %q is an idle state", flow.Name, state)
+		}
+		if other, ok := m.byState[state]; ok {
+			return fmt.Errorf("flow %q: state %q already belongs to flow %q", flow.Name, state, other.Name)
+		}
 	}
 
-	query := `
-		INSERT INTO user_states (telegram_id, state, data)
-		VALUES (?, ?, ?)
-		ON CONFLICT (telegram_id)
-		DO UPDATE SET state = excluded.state, data = excluded.data, updated_at = CURRENT_TIMESTAMP
-	`
+	f := &flow
+	m.flows[f.Name] = f
+	for _, state := range f.States {
+		m.byState[state] = f
+	}
+
+	return nil
+}
+
+// FlowOf returns the flow a state belongs to, or nil for idle and unknown states
+func (m *Manager) FlowOf(state string) *Flow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.byState[state]
+}
+
+// Set moves the user to a state. For flow states, data must be a pointer to
+// the flow's data struct, or nil for empty data, and the flow's expiry starts
+// over. Idle states keep no data.
+//
+// If the state was read during the current update (see Begin), the write
+// only succeeds while the saved state is still the one that was read;
+// otherwise it fails with ErrConflict and the saved state is kept. States
+// cached before the update began are not checked against, as another
+// instance may have changed them since.
+func (m *Manager) Set(ctx context.Context, telegramID int64, state string, data any) error {
+	st := &models.UserState{
+		TelegramID: telegramID,
+		State:      state,
+		Data:       json.RawMessage("{}"),
+	}
+
+	if !idle(state) {
+		flow := m.FlowOf(state)
+		if flow == nil {
+			return fmt.Errorf("state %q belongs to no flow", state)
+		}
+
+		if data == nil {
+			data = flow.New()
+		}
+		if want := reflect.TypeOf(flow.New()); reflect.TypeOf(data) != want {
+			return fmt.Errorf("state %q of flow %q keeps %s, got %T", state, flow.Name, want, data)
+		}
+
+		dataJSON, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal state data: %w", err)
+		}
+
+		expiresAt := time.Now().Add(m.ttl).UTC()
+		st.Flow = flow.Name
+		st.FlowVersion = flow.Version
+		st.Data = dataJSON
+		st.ExpiresAt = &expiresAt
+	}
+
+	m.mu.Lock()
+	read, ok := m.cache.peek(telegramID)
+	m.mu.Unlock()
+	known := ok && read.pinned
+
+	var query string
+	args := []any{telegramID, st.State, st.Flow, st.FlowVersion, string(st.Data), st.ExpiresAt}
+
+	switch {
+	case known && read.state != nil:
+		// Replace the revision that was read, and only that one
+		query = `
+			UPDATE user_states
+			SET state = ?, flow = ?, flow_version = ?, data = ?, expires_at = ?,
+				revision = revision + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE telegram_id = ? AND revision = ?
+			RETURNING revision
+		`
+		args = append(args[1:], telegramID, read.state.Revision)
+	case known:
+		// No state was saved when it was read; one may have been since
+		query = `
+			INSERT INTO user_states (telegram_id, state, flow, flow_version, data, expires_at, revision)
+			VALUES (?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT (telegram_id) DO NOTHING
+			RETURNING revision
+		`
+	default:
+		// Not read, so there is nothing to check against
+		query = `
+			INSERT INTO user_states (telegram_id, state, flow, flow_version, data, expires_at, revision)
+			VALUES (?, ?, ?, ?, ?, ?, 1)
+			ON CONFLICT (telegram_id)
+			DO UPDATE SET state = excluded.state, flow = excluded.flow, flow_version = excluded.flow_version,
+				data = excluded.data, expires_at = excluded.expires_at,
+				revision = user_states.revision + 1, updated_at = CURRENT_TIMESTAMP
+			RETURNING revision
+		`
+	}
+
+	err := m.db.QueryRowContext(ctx, query, args...).Scan(&st.Revision)
+	if err == sql.ErrNoRows {
+		// Whoever changed the state won; read it again next time
+		m.mu.Lock()
+		m.cache.remove(telegramID)
+		m.mu.Unlock()
 
-	_, err = m.db.Exec(query, telegramID, state, dataJSON)
+		return fmt.Errorf("failed to set state %q: %w", state, ErrConflict)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to set state: %w", err)
 	}
 
 	// Update cache
-	m.cache[telegramID] = &models.UserState{
-		TelegramID: telegramID,
-		State:      state,
-		Data:       dataJSON,
-	}
+	st.UpdatedAt = time.Now()
+	m.mu.Lock()
+	m.cache.put(telegramID, st, time.Now())
+	m.mu.Unlock()
 
 	return nil
 }
 
-// Get gets user state
-func (m *Manager) Get(telegramID int64) (*models.UserState, error) {
-	m.mu.RLock()
+// Get gets user state. States saved by an older version of their flow are
+// upgraded first; states no flow can read any more are dropped.
+func (m *Manager) Get(ctx context.Context, telegramID int64) (*models.UserState, error) {
+	m.mu.Lock()
 
 	// Check cache first
-	if state, ok := m.cache[telegramID]; ok {
-		m.mu.RUnlock()
-		return state, nil
+	if entry, ok := m.cache.get(telegramID, time.Now()); ok {
+		m.mu.Unlock()
+		return entry.state, nil
 	}
-	m.mu.RUnlock()
+	m.mu.Unlock()
 
 	// Query database
+	st, err := m.Saved(ctx, telegramID)
+	if err != nil {
+		return nil, err
+	}
+	// A missing row is cached too, so a later Set knows there was nothing
+	// to overwrite
+	if st != nil {
+		st, err = m.migrate(ctx, st)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Update cache
+	m.mu.Lock()
+	m.cache.put(telegramID, st, time.Now())
+	m.mu.Unlock()
+
+	return st, nil
+}
+
+// Saved reads the user's state as saved, bypassing the cache and without
+// upgrading or dropping it. It returns nil if there is none.
+func (m *Manager) Saved(ctx context.Context, telegramID int64) (*models.UserState, error) {
 	query := `
-		SELECT telegram_id, state, data, updated_at
+		SELECT telegram_id, state, flow, flow_version, data, expires_at, revision, updated_at
 		FROM user_states
 		WHERE telegram_id = ?
 	`
 
 	var state models.UserState
-	err := m.db.QueryRow(query, telegramID).Scan(
+	var data sql.NullString
+	err := m.db.QueryRowContext(ctx, query, telegramID).Scan(
 		&state.TelegramID,
 		&state.State,
-		&state.Data,
+		&state.Flow,
+		&state.FlowVersion,
+		&data,
+		&state.ExpiresAt,
+		&state.Revision,
 		&state.UpdatedAt,
 	)
-
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-
 	if err != nil {
 		return nil, fmt.Errorf("failed to get state: %w", err)
 	}
 
-	// Update cache
-	m.mu.Lock()
-	m.cache[telegramID] = &state
-	m.mu.Unlock()
+	if data.Valid {
+		state.Data = json.RawMessage(data.String)
+	}
 
 	return &state, nil
 }
 
-// GetData gets and parses state data
-func (m *Manager) GetData(telegramID int64) (*models.StateData, error) {
-	state, err := m.Get(telegramID)
+// migrate brings a saved state up to date with the registered flows. Data
+// saved before flows existed, or by an older version of its flow, is
+// upgraded and saved back; a state whose data can't be read is dropped, which
+// returns the user to the menu instead of failing every message. It returns
+// nil for a dropped state.
+func (m *Manager) migrate(ctx context.Context, st *models.UserState) (*models.UserState, error) {
+	if idle(st.State) {
+		return st, nil
+	}
+
+	flow := m.FlowOf(st.State)
+	drop := func(reason string, args ...any) (*models.UserState, error) {
+		args = append([]any{"telegram_id", st.TelegramID, "state", st.State, "flow", st.Flow,
+			"flow_version", st.FlowVersion, "reason", reason}, args...)
+		m.logger.Warn("dropping saved state", args...)
+
+		query := `DELETE FROM user_states WHERE telegram_id = ? AND revision = ?`
+		res, err := m.db.ExecContext(ctx, query, st.TelegramID, st.Revision)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete state: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil, fmt.Errorf("failed to delete state: %w", ErrConflict)
+		}
+		return nil, nil
+	}
+
+	switch {
+	case flow == nil:
+		return drop("state belongs to no flow")
+	case st.Flow != "" && st.Flow != flow.Name:
+		return drop("state moved to flow " + flow.Name)
+	case st.FlowVersion > flow.Version:
+		return drop("saved by a newer version of the flow")
+	case st.FlowVersion == flow.Version:
+		return st, nil
+	}
+
+	data := st.Data
+	if len(data) == 0 {
+		data = json.RawMessage("{}")
+	}
+	if flow.Upgrade != nil {
+		upgraded, err := flow.Upgrade(st.FlowVersion, data)
+		if err != nil {
+			return drop("upgrade failed", "error", err)
+		}
+		data = upgraded
+	}
+	if err := json.Unmarshal(data, flow.New()); err != nil {
+		return drop("data does not decode", "error", err)
+	}
+
+	// Flows saved before expiry existed are as old as their last update
+	expiresAt := st.ExpiresAt
+	if expiresAt == nil {
+		t := st.UpdatedAt.Add(m.ttl).UTC()
+		expiresAt = &t
+	}
+
+	query := `
+		UPDATE user_states
+		SET flow = ?, flow_version = ?, data = ?, expires_at = ?, revision = revision + 1
+		WHERE telegram_id = ? AND revision = ?
+		RETURNING revision
+	`
+
+	var revision int64
+	err := m.db.QueryRowContext(ctx, query, flow.Name, flow.Version, string(data), expiresAt,
+		st.TelegramID, st.Revision).Scan(&revision)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to upgrade state: %w", ErrConflict)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to upgrade state: %w", err)
 	}
 
-	if state == nil || state.Data == nil {
-		return &models.StateData{}, nil
+	m.logger.Info("upgraded saved state", "telegram_id", st.TelegramID, "state", st.State,
+		"flow", flow.Name, "from_version", st.FlowVersion, "to_version", flow.Version)
+
+	st.Flow = flow.Name
+	st.FlowVersion = flow.Version
+	st.Data = data
+	st.ExpiresAt = expiresAt
+	st.Revision = revision
+
+	return st, nil
+}
+
+// Data decodes the flow data of a state into the flow's struct. It returns
+// nil for no state, an idle state or an expired flow.
+func (m *Manager) Data(st *models.UserState) (any, error) {
+	if st == nil || idle(st.State) || st.Expired(time.Now()) {
+		return nil, nil
+	}
+
+	flow := m.FlowOf(st.State)
+	if flow == nil {
+		return nil, nil
+	}
+
+	data := flow.New()
+	if len(st.Data) > 0 {
+		if err := json.Unmarshal(st.Data, data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s data: %w", flow.Name, err)
+		}
 	}
 
-	var data models.StateData
-	err = json.Unmarshal(state.Data, &data)
+	return data, nil
+}
+
+// Load gets the user's flow data as a T. Users in another flow or in none,
+// and users whose flow expired, get empty data.
+func Load[T any](ctx context.Context, m *Manager, telegramID int64) (*T, error) {
+	st, err := m.Get(ctx, telegramID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal state data: %w", err)
+		return nil, err
+	}
+
+	data, err := m.Data(st)
+	if err != nil {
+		return nil, err
 	}
 
-	return &data, nil
+	return As[T](data), nil
 }
 
-// Delete deletes user state
-func (m *Manager) Delete(telegramID int64) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// As returns flow data as a *T, or empty data if it is of another type
+func As[T any](data any) *T {
+	if d, ok := data.(*T); ok && d != nil {
+		return d
+	}
+	return new(T)
+}
 
+// Delete deletes user state whatever its revision, overriding any update in
+// flight; an update another instance has in flight fails its next Set with
+// ErrConflict.
+func (m *Manager) Delete(ctx context.Context, telegramID int64) error {
 	query := `DELETE FROM user_states WHERE telegram_id = ?`
-	_, err := m.db.Exec(query, telegramID)
+	_, err := m.db.ExecContext(ctx, query, telegramID)
 	if err != nil {
 		return fmt.Errorf("failed to delete state: %w", err)
 	}
 
-	// Remove from cache
-	delete(m.cache, telegramID)
+	// The user now has no state
+	m.mu.Lock()
+	m.cache.put(telegramID, nil, time.Now())
+	m.mu.Unlock()
 
 	return nil
 }
 
 // Clear clears user state (sets to registered)
-func (m *Manager) Clear(telegramID int64) error {
-	return m.Set(telegramID, models.StateRegistered, &models.StateData{})
+func (m *Manager) Clear(ctx context.Context, telegramID int64) error {
+	return m.Set(ctx, telegramID, models.StateRegistered, nil)
 }
 
 // CleanOldStates removes states older than specified hours
-func (m *Manager) CleanOldStates(hours int) error {
-	// SQLite uses datetime() function, not INTERVAL
+func (m *Manager) CleanOldStates(ctx context.Context, hours int) error {
 	query := `
 		DELETE FROM user_states
-		WHERE updated_at < datetime('now', '-' || ? || ' hours')
-	`
+		WHERE updated_at < ` + m.dialect.HoursAgo()
 
-	_, err := m.db.Exec(query, hours)
+	_, err := m.db.ExecContext(ctx, query, hours)
 	if err != nil {
 		return fmt.Errorf("failed to clean old states: %w", err)
 	}
 
-	// Clear cache
+	// Clear cache, except for updates in flight
 	m.mu.Lock()
-	m.cache = make(map[int64]*models.UserState)
+	m.cache.clear()
 	m.mu.Unlock()
 
 	return nil
 }
 
+// CountFlows counts the users in each flow, leaving out expired flows
+func (m *Manager) CountFlows(ctx context.Context) (map[string]int, error) {
+	query := `
+		SELECT flow, COUNT(*)
+		FROM user_states
+		WHERE flow <> '' AND (expires_at IS NULL OR expires_at > ?)
+		GROUP BY flow
+	`
+
+	rows, err := m.db.QueryContext(ctx, query, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count flows: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var flow string
+		var count int
+		if err := rows.Scan(&flow, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan flow count: %w", err)
+		}
+		counts[flow] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// Begin marks the start of an update from the user. Until End, the state the
+// update reads stays cached, so Set can tell whether it changed meanwhile.
+func (m *Manager) Begin(telegramID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cache.pin(telegramID)
+}
+
+// End marks the end of the user's update
+func (m *Manager) End(telegramID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cache.unpin(telegramID)
+}
+
+// CacheStats returns the size and hit counts of the state cache
+func (m *Manager) CacheStats() CacheStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := m.cache.stats
+	stats.Size = m.cache.order.Len()
+	return stats
+}
+
 // GetState returns just the state string
-func (m *Manager) GetState(telegramID int64) (string, error) {
-	state, err := m.Get(telegramID)
+func (m *Manager) GetState(ctx context.Context, telegramID int64) (string, error) {
+	state, err := m.Get(ctx, telegramID)
 	if err != nil {
 		return "", err
 	}
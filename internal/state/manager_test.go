@@ -0,0 +1,243 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"parent-bot/internal/config"
+	"parent-bot/internal/database"
+	"parent-bot/internal/models"
+)
+
+const user = int64(7001)
+
+// newManagers returns two managers sharing an in-memory SQLite database, as
+// two bot instances would share one
+func newManagers(t *testing.T, cacheSize int) (*Manager, *Manager) {
+	t.Helper()
+
+	cfg := config.Defaults()
+	cfg.Database.Path = ":memory:"
+	cfg.Updates.StateCacheSize = cacheSize
+
+	if err := database.Connect(&cfg.Database); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if _, err := database.RunMigrations(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewManager(database.DB, cfg.Updates, logger), NewManager(database.DB, cfg.Updates, logger)
+}
+
+// savedState returns the user's saved state, "" for none
+func savedState(t *testing.T, m *Manager) string {
+	t.Helper()
+
+	st, err := m.Saved(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st == nil {
+		return ""
+	}
+	return st.State
+}
+
+func TestSetChecksRevision(t *testing.T) {
+	tests := []struct {
+		name      string
+		saved     string                                // state before the update reads it; "" for none
+		meanwhile func(t *testing.T, m, other *Manager) // runs between the update's read and write
+		wantErr   error
+		want      string // saved state afterwards; "" for none
+	}{
+		{
+			name:  "unchanged since read",
+			saved: models.StateStart,
+			want:  models.StateRegistered,
+		},
+		{
+			name: "no state, still none",
+			want: models.StateRegistered,
+		},
+		{
+			name:  "changed by another instance",
+			saved: models.StateRegistered,
+			meanwhile: func(t *testing.T, _, other *Manager) {
+				if err := other.Set(context.Background(), user, models.StateStart, nil); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrConflict,
+			want:    models.StateStart,
+		},
+		{
+			name: "first write races another first write",
+			meanwhile: func(t *testing.T, _, other *Manager) {
+				if err := other.Set(context.Background(), user, models.StateStart, nil); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrConflict,
+			want:    models.StateStart,
+		},
+		{
+			name:  "deleted by another instance",
+			saved: models.StateStart,
+			meanwhile: func(t *testing.T, _, other *Manager) {
+				if err := other.Delete(context.Background(), user); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrConflict,
+		},
+		{
+			name:  "cleaned up while pinned",
+			saved: models.StateStart,
+			meanwhile: func(t *testing.T, m, _ *Manager) {
+				_, err := m.db.Exec(`UPDATE user_states SET updated_at = datetime('now', '-48 hours') WHERE telegram_id = ?`, user)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := m.CleanOldStates(context.Background(), 24); err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := m.cache.peek(user); !ok {
+					t.Error("CleanOldStates dropped the pinned entry")
+				}
+			},
+			wantErr: ErrConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m, other := newManagers(t, 100)
+
+			if tt.saved != "" {
+				if err := other.Set(ctx, user, tt.saved, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m.Begin(user)
+			defer m.End(user)
+
+			if _, err := m.Get(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			if tt.meanwhile != nil {
+				tt.meanwhile(t, m, other)
+			}
+
+			err := m.Set(ctx, user, models.StateRegistered, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Set error = %v, want %v", err, tt.wantErr)
+			}
+			if got := savedState(t, m); got != tt.want {
+				t.Errorf("saved state = %q, want %q", got, tt.want)
+			}
+
+			// A conflict drops the cached read, so the next update sees the
+			// saved state and its write goes through
+			if tt.wantErr != nil {
+				if _, err := m.Get(ctx, user); err != nil {
+					t.Fatal(err)
+				}
+				if err := m.Set(ctx, user, models.StateRegistered, nil); err != nil {
+					t.Errorf("Set after re-reading: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPinnedEntryIsNotEvicted(t *testing.T) {
+	ctx := context.Background()
+	m, other := newManagers(t, 1)
+
+	if err := other.Set(ctx, user, models.StateStart, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Begin(user)
+	if _, err := m.Get(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading other users fills the one-entry cache past its size
+	for id := user + 1; id < user+5; id++ {
+		if _, err := m.Get(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := m.cache.peek(user); !ok {
+		t.Fatal("pinned entry was evicted")
+	}
+
+	// The revision read before the other reads is still checked
+	if err := other.Set(ctx, user, models.StateRegistered, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set(ctx, user, models.StateStart, nil); !errors.Is(err, ErrConflict) {
+		t.Errorf("Set error = %v, want %v", err, ErrConflict)
+	}
+	m.End(user)
+
+	// Once the update ends, the entry can be evicted again
+	if _, err := m.Get(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(ctx, user+10); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.cache.peek(user); ok {
+		t.Error("entry still cached after End and further reads")
+	}
+}
+
+func TestStaleEntryIsReadAgain(t *testing.T) {
+	ctx := context.Background()
+	m, other := newManagers(t, 100)
+
+	// m caches the state outside of any update
+	if err := m.Set(ctx, user, models.StateStart, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance changes it; m's entry is now stale but within its TTL
+	other.Begin(user)
+	if _, err := other.Get(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Set(ctx, user, models.StateRegistered, nil); err != nil {
+		t.Fatal(err)
+	}
+	other.End(user)
+
+	// m's next update reads the row again instead of trusting the old entry,
+	// so its write is checked against the current revision and goes through
+	m.Begin(user)
+	defer m.End(user)
+
+	st, err := m.Get(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st == nil || st.State != models.StateRegistered {
+		t.Fatalf("Get = %+v, want state %q", st, models.StateRegistered)
+	}
+	if err := m.Set(ctx, user, models.StateStart, nil); err != nil {
+		t.Errorf("Set error = %v, want none", err)
+	}
+	if got := savedState(t, m); got != models.StateStart {
+		t.Errorf("saved state = %q, want %q", got, models.StateStart)
+	}
+}
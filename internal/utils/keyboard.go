@@ -111,82 +111,68 @@ func MakeProposalConfirmationKeyboard(lang i18n.Language) tgbotapi.InlineKeyboar
 	)
 }
 
-// MakeAdminKeyboard creates admin panel keyboard
-func MakeAdminKeyboard(lang i18n.Language) tgbotapi.InlineKeyboardMarkup {
-	return tgbotapi.NewInlineKeyboardMarkup(
-		// Row 1: Class Management
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnManageClasses, lang),
-				"admin_manage_classes",
-			),
-		),
+// adminButton is an admin panel button and the permissions, any of which
+// shows it
+type adminButton struct {
+	text        string
+	data        string
+	permissions []models.Permission
+}
+
+// MakeAdminKeyboard creates admin panel keyboard with the buttons perms allow
+func MakeAdminKeyboard(lang i18n.Language, perms models.PermissionSet) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]adminButton{
+		// Row 1: Class Management (students are managed per class)
+		{{i18n.BtnManageClasses, "admin_manage_classes", []models.Permission{models.PermClassesManage, models.PermStudentsManage}}},
 		// Row 2: Teacher Management
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnManageTeachers, lang),
-				"admin_manage_teachers",
-			),
-		),
+		{{i18n.BtnManageTeachers, "admin_manage_teachers", []models.Permission{models.PermTeachersManage}}},
 		// Row 3: Announcement Management
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnPostAnnouncement, lang),
-				"admin_post_announcement",
-			),
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnViewAllAnnouncements, lang),
-				"admin_view_announcements",
-			),
-		),
+		{
+			{i18n.BtnPostAnnouncement, "admin_post_announcement", []models.Permission{models.PermAnnouncementsManage}},
+			{i18n.BtnViewAllAnnouncements, "admin_view_announcements", []models.Permission{models.PermAnnouncementsManage}},
+		},
 		// Row 4: Attendance Export
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnExportAttendance, lang),
-				"admin_export_attendance",
-			),
-		),
+		{{i18n.BtnExportAttendance, "admin_export_attendance", []models.Permission{models.PermReportsExport}}},
 		// Row 5: Test Results Export
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnExportTestResults, lang),
-				"admin_export_test_results",
-			),
-		),
+		{{i18n.BtnExportTestResults, "admin_export_test_results", []models.Permission{models.PermReportsExport}}},
 		// Row 6: Timetable Management
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnUploadTimetable, lang),
-				"admin_upload_timetable",
-			),
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnViewTimetables, lang),
-				"admin_view_timetables",
-			),
-		),
+		{
+			{i18n.BtnUploadTimetable, "admin_upload_timetable", []models.Permission{models.PermTimetablesManage}},
+			{i18n.BtnViewTimetables, "admin_view_timetables", []models.Permission{models.PermTimetablesManage}},
+		},
 		// Row 7: Complaints & Proposals
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnViewComplaints, lang),
-				"admin_complaints",
-			),
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnViewProposals, lang),
-				"admin_proposals",
-			),
-		),
+		{
+			{i18n.BtnViewComplaints, "admin_complaints", []models.Permission{models.PermComplaintsView}},
+			{i18n.BtnViewProposals, "admin_proposals", []models.Permission{models.PermComplaintsView}},
+		},
 		// Row 8: Users & Stats
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnViewUsers, lang),
-				"admin_users",
-			),
-			tgbotapi.NewInlineKeyboardButtonData(
-				i18n.Get(i18n.BtnViewStats, lang),
-				"admin_stats",
-			),
-		),
-	)
+		{
+			{i18n.BtnViewUsers, "admin_users", []models.Permission{models.PermUsersView}},
+			{i18n.BtnViewStats, "admin_stats", []models.Permission{models.PermStatsView}},
+		},
+		// Row 9: Background Jobs and Audit Log
+		{
+			{i18n.BtnBackgroundJobs, "admin_jobs", []models.Permission{models.PermJobsManage}},
+			{i18n.BtnAuditLog, "admin_audit", []models.Permission{models.PermAuditView}},
+		},
+		// Row 10: Roles and Permissions
+		{{i18n.BtnRoles, "admin_roles", []models.Permission{models.PermRolesManage}}},
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	for _, row := range rows {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for _, button := range row {
+			if perms.HasAny(button.permissions...) {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(i18n.Get(button.text, lang), button.data))
+			}
+		}
+		if len(buttons) > 0 {
+			keyboard = append(keyboard, buttons)
+		}
+	}
+
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: keyboard}
 }
 
 // RemoveKeyboard creates a keyboard removal markup
@@ -273,24 +259,39 @@ func MakeStudentSelectionKeyboard(students []*models.StudentWithClass, lang i18n
 	return tgbotapi.NewInlineKeyboardMarkup(rows...)
 }
 
-// MakeTeacherMainMenuKeyboard creates teacher main menu keyboard
-func MakeTeacherMainMenuKeyboard(lang i18n.Language) tgbotapi.ReplyKeyboardMarkup {
-	keyboard := tgbotapi.NewReplyKeyboard(
-		// Row 1: Student Management
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton(i18n.Get(i18n.BtnAddStudent, lang)),
-			tgbotapi.NewKeyboardButton(i18n.Get(i18n.BtnViewClassStudents, lang)),
-		),
-		// Row 2: Attendance & Test Results
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton(i18n.Get(i18n.BtnMarkAttendance, lang)),
-			tgbotapi.NewKeyboardButton(i18n.Get(i18n.BtnAddTestResult, lang)),
-		),
-		// Row 3: Announcements
-		tgbotapi.NewKeyboardButtonRow(
+// MakeTeacherMainMenuKeyboard creates teacher main menu keyboard with the
+// buttons perms allow. Viewing class students is always offered.
+func MakeTeacherMainMenuKeyboard(lang i18n.Language, perms models.PermissionSet) tgbotapi.ReplyKeyboardMarkup {
+	var rows [][]tgbotapi.KeyboardButton
+
+	// Row 1: Student Management
+	row := []tgbotapi.KeyboardButton{}
+	if perms.Has(models.PermClassStudentsManage) {
+		row = append(row, tgbotapi.NewKeyboardButton(i18n.Get(i18n.BtnAddStudent, lang)))
+	}
+	row = append(row, tgbotapi.NewKeyboardButton(i18n.Get(i18n.BtnViewClassStudents, lang)))
+	rows = append(rows, row)
+
+	// Row 2: Attendance & Test Results
+	row = []tgbotapi.KeyboardButton{}
+	if perms.Has(models.PermAttendanceMark) {
+		row = append(row, tgbotapi.NewKeyboardButton(i18n.Get(i18n.BtnMarkAttendance, lang)))
+	}
+	if perms.Has(models.PermGradesEdit) {
+		row = append(row, tgbotapi.NewKeyboardButton(i18n.Get(i18n.BtnAddTestResult, lang)))
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	// Row 3: Announcements
+	if perms.Has(models.PermClassAnnouncementsPost) {
+		rows = append(rows, tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton(i18n.Get(i18n.BtnPostAnnouncement, lang)),
-		),
-	)
+		))
+	}
+
+	keyboard := tgbotapi.NewReplyKeyboard(rows...)
 	keyboard.ResizeKeyboard = true
 	return keyboard
 }
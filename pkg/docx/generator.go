@@ -2,6 +2,7 @@ package docx
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"time"
 
@@ -110,7 +111,7 @@ func Generate(data *ComplaintData, outputPath string) error {
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
 
-	fmt.Printf("[DEBUG] DOCX generated: %s, size: %d bytes\n", outputPath, written)
+	slog.Debug("docx generated", "path", outputPath, "size", written)
 
 	return nil
 }
@@ -207,7 +208,7 @@ func GenerateProposal(data *ComplaintData, outputPath string) error {
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
 
-	fmt.Printf("[DEBUG] DOCX generated: %s, size: %d bytes\n", outputPath, written)
+	slog.Debug("docx generated", "path", outputPath, "size", written)
 
 	return nil
 }
@@ -334,7 +335,7 @@ func GenerateClassTestResults(data *ClassTestResultsData, outputPath string) err
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
 
-	fmt.Printf("[DEBUG] Test results DOCX generated: %s, size: %d bytes\n", outputPath, written)
+	slog.Debug("test results docx generated", "path", outputPath, "size", written)
 
 	return nil
 }
@@ -455,7 +456,7 @@ func GenerateTodayAttendance(data *AllClassesAttendanceData, outputPath string)
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
 
-	fmt.Printf("[DEBUG] Attendance DOCX generated: %s, size: %d bytes\n", outputPath, written)
+	slog.Debug("attendance docx generated", "path", outputPath, "size", written)
 
 	return nil
 }